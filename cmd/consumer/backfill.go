@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/postgres"
+)
+
+// Backfill mode fills derived tables added after their events were stored,
+// over the whole history of the events table by default. It replays the
+// stored events through the live store functions like a rebuild, but
+// without reversing their rows first: rows the tables already hold are left
+// alone, and only the missing rows are inserted. Its progress is kept in
+// backfill_progress, so an interrupted backfill resumes where it stopped.
+
+const (
+	// startBackfillQuery records a backfill, or returns the one recorded
+	// under its name
+	startBackfillQuery = `
+		INSERT INTO backfill_progress (name, event_types, from_block, to_block)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET updated_at = NOW()
+		RETURNING from_block, to_block, last_block, last_log_index, replayed, completed_at IS NOT NULL
+	`
+
+	// checkpointBackfillQuery records the last event of a page, in the
+	// page's transaction
+	checkpointBackfillQuery = `
+		UPDATE backfill_progress
+		SET last_block = $2, last_log_index = $3, replayed = replayed + $4, updated_at = NOW()
+		WHERE name = $1
+	`
+
+	// completeBackfillQuery marks a backfill complete
+	completeBackfillQuery = `
+		UPDATE backfill_progress SET completed_at = NOW(), updated_at = NOW()
+		WHERE name = $1
+		RETURNING replayed
+	`
+)
+
+// backfillProgress is the recorded progress of a backfill.
+type backfillProgress struct {
+	fromBlock    uint64
+	toBlock      uint64
+	lastBlock    *uint64
+	lastLogIndex *int
+	replayed     int
+	completed    bool
+}
+
+// backfillName returns the name a backfill of a comma-separated list of
+// tables is recorded under: its tables, sorted and without duplicates.
+func backfillName(spec string) string {
+	seen := make(map[string]bool)
+	var tables []string
+	for _, table := range strings.Split(spec, ",") {
+		table = strings.TrimSpace(table)
+		if table != "" && !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+	return strings.Join(tables, ",")
+}
+
+// startBackfill records the backfill of opts, or reads the progress of the
+// one recorded under its name. Resuming with another block range fails, as
+// the recorded progress would not cover it.
+func startBackfill(ctx context.Context, db querier, opts rebuildOptions) (backfillProgress, error) {
+	var p backfillProgress
+	var lastBlock *int64
+	var lastLogIndex *int32
+	var replayed int64
+	var fromBlock, toBlock int64
+	err := db.QueryRow(ctx, startBackfillQuery, opts.checkpoint, opts.eventTypes, int64(opts.fromBlock), int64(opts.toBlock)).
+		Scan(&fromBlock, &toBlock, &lastBlock, &lastLogIndex, &replayed, &p.completed)
+	if err != nil {
+		return p, fmt.Errorf("failed to record backfill: %w", err)
+	}
+	p.fromBlock, p.toBlock, p.replayed = uint64(fromBlock), uint64(toBlock), int(replayed)
+	if lastBlock != nil && lastLogIndex != nil {
+		block, logIndex := uint64(*lastBlock), int(*lastLogIndex)
+		p.lastBlock, p.lastLogIndex = &block, &logIndex
+	}
+
+	if p.fromBlock != opts.fromBlock || p.toBlock != opts.toBlock {
+		return p, fmt.Errorf("backfill %s was started for blocks %d to %d (0 for the last block), delete its backfill_progress row to start over",
+			opts.checkpoint, p.fromBlock, p.toBlock)
+	}
+	return p, nil
+}
+
+// checkpointStatement returns the statement recording the last event of a
+// page of replayed events.
+func checkpointStatement(name string, lastBlock uint64, lastLogIndex uint, replayed int) postgres.Statement {
+	return postgres.Statement{
+		Query: checkpointBackfillQuery,
+		Args:  []any{name, int64(lastBlock), int32(lastLogIndex), replayed},
+	}
+}
+
+// completeBackfill marks a backfill complete and returns the number of
+// events it replayed, over every run.
+func completeBackfill(ctx context.Context, db querier, name string) (int, error) {
+	var replayed int64
+	if err := db.QueryRow(ctx, completeBackfillQuery, name).Scan(&replayed); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("backfill %s is not recorded", name)
+		}
+		return 0, fmt.Errorf("failed to complete backfill: %w", err)
+	}
+	return int(replayed), nil
+}
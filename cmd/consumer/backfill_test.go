@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+)
+
+// TestBackfillName tests that the tables of a backfill name it in a stable
+// order, whatever order they are listed in.
+func TestBackfillName(t *testing.T) {
+	require.Equal(t, "order_fills,trades", backfillName(" trades,order_fills,trades, "))
+	require.Equal(t, backfillName("trades,order_fills"), backfillName("order_fills,trades"))
+}
+
+// tradeBlocks returns the blocks of the stored trades, in order.
+func tradeBlocks(t *testing.T, pool *pgxpool.Pool) []uint64 {
+	t.Helper()
+	rows, err := pool.Query(context.Background(), "SELECT block_number FROM trades ORDER BY block_number")
+	require.NoError(t, err)
+	defer rows.Close()
+	var blocks []uint64
+	for rows.Next() {
+		var block uint64
+		require.NoError(t, rows.Scan(&block))
+		blocks = append(blocks, block)
+	}
+	require.NoError(t, rows.Err())
+	return blocks
+}
+
+// TestBackfillAgainstPostgres tests against Postgres that a backfill fills
+// a table missing the rows of stored events without changing the rows
+// derived from them elsewhere, records its progress, does nothing once
+// complete, resumes after its checkpoint and refuses another block range.
+func TestBackfillAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	for block := uint64(100); block <= 102; block++ {
+		event := storetest.FillEvent(block, 0, 1_700_000_000+block, 500_000, 1_000_000)
+		event.EventSig = events.MustLookup(events.OrderFilled).Signature.Hex()
+		m, msg := pendingEvent(t, event)
+		w.add(ctx, m)
+		w.flush(ctx)
+		require.Equal(t, 1, msg.acks)
+	}
+	candles := candlesOf(t, pool)
+
+	// trades is new: none of the stored fills have their row yet
+	_, err := pool.Exec(ctx, "DELETE FROM trades")
+	require.NoError(t, err)
+
+	opts := rebuildOptions{
+		eventTypes: []string{events.OrderFilled},
+		batchSize:  1,
+		backfill:   true,
+		checkpoint: backfillName("trades"),
+	}
+	replayed, err := rebuildDerived(ctx, pool, opts, zerolog.Nop())
+	require.NoError(t, err)
+	require.Equal(t, 3, replayed)
+	require.Equal(t, []uint64{100, 101, 102}, tradeBlocks(t, pool))
+	require.Equal(t, candles, candlesOf(t, pool), "candles counted the fills again")
+	require.Equal(t, 3, countEvents(t, pool))
+
+	var lastBlock, recorded int64
+	var completed bool
+	require.NoError(t, pool.QueryRow(ctx, `
+		SELECT last_block, replayed, completed_at IS NOT NULL FROM backfill_progress WHERE name = 'trades'
+	`).Scan(&lastBlock, &recorded, &completed))
+	require.Equal(t, int64(102), lastBlock)
+	require.Equal(t, int64(3), recorded)
+	require.True(t, completed)
+
+	// Complete backfills are not run again
+	_, err = pool.Exec(ctx, "DELETE FROM trades")
+	require.NoError(t, err)
+	replayed, err = rebuildDerived(ctx, pool, opts, zerolog.Nop())
+	require.NoError(t, err)
+	require.Zero(t, replayed)
+	require.Empty(t, tradeBlocks(t, pool))
+
+	// An interrupted backfill resumes after its last page
+	_, err = pool.Exec(ctx, `
+		UPDATE backfill_progress SET last_block = 100, last_log_index = 0, replayed = 1, completed_at = NULL
+		WHERE name = 'trades'
+	`)
+	require.NoError(t, err)
+	replayed, err = rebuildDerived(ctx, pool, opts, zerolog.Nop())
+	require.NoError(t, err)
+	require.Equal(t, 3, replayed)
+	require.Equal(t, []uint64{101, 102}, tradeBlocks(t, pool))
+
+	opts.fromBlock = 101
+	_, err = rebuildDerived(ctx, pool, opts, zerolog.Nop())
+	require.ErrorContains(t, err, "backfill_progress")
+}
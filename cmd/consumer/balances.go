@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+var (
+	balancesChecked = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "polymarket_balances_checked_total",
+		Help: "Total number of sampled balances compared with their transfers",
+	})
+
+	balancesMismatched = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "polymarket_balances_mismatched",
+		Help: "Sampled balances that differed from the sum of their transfers at the last check",
+	})
+)
+
+const (
+	// defaultBalanceCheckSample is the default number of balances compared
+	// with their transfers per check
+	defaultBalanceCheckSample = 100
+
+	// checkBalancesQuery counts sampled balances and those differing from the
+	// sum of their wallet's transfers of the token. Both tables are read in
+	// one snapshot, and transfers commit together with their balance update.
+	checkBalancesQuery = `
+		WITH sample AS (
+			SELECT wallet, token_id, balance FROM balances ORDER BY random() LIMIT $1
+		)
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE s.balance <> COALESCE((
+				SELECT SUM(CASE WHEN t.to_address = s.wallet THEN t.amount ELSE 0 END)
+				     - SUM(CASE WHEN t.from_address = s.wallet THEN t.amount ELSE 0 END)
+				FROM token_transfers t
+				WHERE t.token_id = s.token_id
+				  AND (t.to_address = s.wallet OR t.from_address = s.wallet)
+			), 0))
+		FROM sample s
+	`
+)
+
+// querier runs a query returning one row (implemented by pgxpool.Pool and
+// pgx.Tx).
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// checkBalances compares up to sample random balances with the transfers
+// they were derived from and returns how many it checked and how many
+// differed.
+func checkBalances(ctx context.Context, db querier, sample int) (checked, mismatched int, err error) {
+	if err := db.QueryRow(ctx, checkBalancesQuery, sample).Scan(&checked, &mismatched); err != nil {
+		return 0, 0, fmt.Errorf("failed to check balances: %w", err)
+	}
+	return checked, mismatched, nil
+}
+
+// runBalanceChecks checks a sample of balances every interval until ctx is
+// cancelled. A mismatch means balances drifted from token_transfers and
+// should be rebuilt with "migrate rebuild-balances".
+func runBalanceChecks(ctx context.Context, db querier, interval time.Duration, sample int, logger zerolog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		checked, mismatched, err := checkBalances(ctx, db, sample)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Warn().Err(err).Msg("failed to check balances")
+			}
+			continue
+		}
+		balancesChecked.Add(float64(checked))
+		balancesMismatched.Set(float64(mismatched))
+		if mismatched > 0 {
+			logger.Error().
+				Int("checked", checked).
+				Int("mismatched", mismatched).
+				Msg("balances differ from token transfers, rebuild them with migrate rebuild-balances")
+		}
+	}
+}
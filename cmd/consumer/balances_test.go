@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// balancesOf returns every stored balance, keyed by wallet and token id.
+func balancesOf(t *testing.T, pool *pgxpool.Pool) map[string]string {
+	t.Helper()
+	rows, err := pool.Query(context.Background(),
+		"SELECT wallet || '/' || token_id::TEXT, balance::TEXT FROM balances")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	balances := make(map[string]string)
+	for rows.Next() {
+		var key, balance string
+		require.NoError(t, rows.Scan(&key, &balance))
+		balances[key] = balance
+	}
+	require.NoError(t, rows.Err())
+	return balances
+}
+
+// TestBalancesAgainstPostgres tests against Postgres that balances follow
+// mints, transfers and batches, ignore redeliveries, are restored when a
+// transfer is removed and match both the consistency check and a rebuild.
+func TestBalancesAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	mint := storetest.TransferEvent(1, models.ZeroAddress, storetest.WalletA, 1000, 50)
+	send := storetest.TransferEvent(2, storetest.WalletA, storetest.WalletB, 1000, 20)
+	// Moves tokens 1000 to 1049 twice each, the first amounts of 1000 and
+	// 1001 from storetest.WalletA's minted balance
+	batch := storetest.TransferBatchEvent(100)
+	batch.LogIndex = 3
+	batch.Payload = models.TransferBatch{
+		Operator: storetest.WalletA,
+		From:     storetest.WalletA,
+		To:       storetest.WalletB,
+		TokenIDs: batch.Payload.(models.TransferBatch).TokenIDs[:2],
+		Amounts:  []*big.Int{big.NewInt(5), big.NewInt(5)},
+	}
+
+	for _, event := range []models.Event{mint, send, batch, send} {
+		m, msg := pendingEvent(t, event)
+		w.add(ctx, m)
+		w.flush(ctx)
+		require.Equal(t, 1, msg.acks, event.EventName)
+	}
+	require.Equal(t, map[string]string{
+		storetest.WalletA + "/1000": "20",
+		storetest.WalletB + "/1000": "30",
+	}, balancesOf(t, pool))
+
+	checked, mismatched, err := checkBalances(ctx, pool, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, checked)
+	require.Zero(t, mismatched)
+
+	// The transfer is reorged out
+	removed := send
+	removed.Success = false
+	m, msg := pendingEvent(t, removed)
+	w.add(ctx, m)
+	w.flush(ctx)
+	require.Equal(t, 1, msg.acks)
+	require.Equal(t, map[string]string{
+		storetest.WalletA + "/1000": "40",
+		storetest.WalletB + "/1000": "10",
+	}, balancesOf(t, pool))
+
+	// Drift is detected and repaired by a rebuild
+	_, err = pool.Exec(ctx, "UPDATE balances SET balance = 0")
+	require.NoError(t, err)
+	_, mismatched, err = checkBalances(ctx, pool, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, mismatched)
+
+	var rebuilt int64
+	require.NoError(t, pool.QueryRow(ctx, "SELECT rebuild_balances()").Scan(&rebuilt))
+	require.Equal(t, int64(2), rebuilt)
+	require.Equal(t, map[string]string{
+		storetest.WalletA + "/1000": "40",
+		storetest.WalletB + "/1000": "10",
+	}, balancesOf(t, pool))
+}
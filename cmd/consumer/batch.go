@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store/postgres"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+const (
+	// defaultBatchSize is the default number of messages buffered before
+	// they are flushed
+	defaultBatchSize = 500
+
+	// defaultBatchInterval is the default time after which buffered messages
+	// are flushed even if the batch is not full
+	defaultBatchInterval = 200 * time.Millisecond
+)
+
+// txBeginner starts the transaction a batch is written in (implemented by
+// pgxpool.Pool).
+type txBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// pendingMessage is a consumed message whose statements await a flush.
+type pendingMessage struct {
+	msg        jetstream.Msg
+	eventType  string
+	event      models.Event
+	statements []postgres.Statement
+
+	// quarantined messages write their event to quarantined_events and
+	// are not counted as stored
+	quarantined bool
+
+	// duplicate, if set, is true once committed when the event was already
+	// stored (see observeDuplicate); it is acknowledged and not counted as
+	// stored
+	duplicate *bool
+}
+
+// batchWriter buffers the statements of consumed messages and writes them
+// in a single pgx.Batch once batchSize messages are buffered or on every
+// tick of run. A batch runs in one transaction, so the raw and parsed rows
+// of an event are never visible without each other, and its messages are
+// acknowledged only after it commits, so messages buffered when the
+// consumer dies are redelivered by JetStream after AckWait and written
+// again; every statement is idempotent (ON CONFLICT), so a message whose
+// flush committed but whose ack was lost is harmless to write twice.
+//
+// COPY is not used for the high-volume tables: it cannot skip the rows of
+// redelivered messages, nor correct the parsed rows of re-published ones,
+// the way ON CONFLICT does.
+type batchWriter struct {
+	db        txBeginner
+	batchSize int
+	logger    zerolog.Logger
+
+	mu      sync.Mutex
+	pending []pendingMessage
+
+	// flushMu serializes flushes, so a reorg reversal never commits before
+	// the insert it undoes
+	flushMu sync.Mutex
+
+	// rejectBatch rejects every message of a batch that failed for a reason
+	// redelivery may fix, instead of writing them one by one
+	rejectBatch bool
+}
+
+// newBatchWriter creates a batch writer flushing every batchSize messages.
+func newBatchWriter(db txBeginner, batchSize int, logger zerolog.Logger) *batchWriter {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	return &batchWriter{
+		db:        db,
+		batchSize: batchSize,
+		logger:    logger,
+	}
+}
+
+// add buffers a message and flushes if the batch is full.
+func (w *batchWriter) add(ctx context.Context, m pendingMessage) {
+	w.mu.Lock()
+	w.pending = append(w.pending, m)
+	buffered := len(w.pending)
+	w.mu.Unlock()
+	consumer.BufferedMessages.Inc()
+
+	if buffered >= w.batchSize {
+		w.flush(ctx)
+	}
+}
+
+// run flushes the buffered messages every interval until ctx is done.
+func (w *batchWriter) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.flush(ctx)
+		}
+	}
+}
+
+// flush writes the buffered messages and acknowledges them. If the batch
+// fails, its messages are written one at a time, so a message that cannot
+// be stored does not hold back the others; it is rejected by failed. With
+// rejectBatch, only a batch rejected for its data (consumer.IsPermanent) is split;
+// any other failure (connection lost, serialization failure) rejects the
+// whole batch for redelivery.
+func (w *batchWriter) flush(ctx context.Context) {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	consumer.BufferedMessages.Sub(float64(len(pending)))
+	if len(pending) == 0 {
+		return
+	}
+
+	// The messages are kept from redelivery until they are settled
+	stop := keepInProgress(ctx, pendingMsgs(pending), w.logger)
+	defer stop()
+
+	start := time.Now()
+	err := w.write(ctx, pending)
+	consumer.FlushDuration.Observe(time.Since(start).Seconds())
+	consumer.FlushSize.Observe(float64(len(pending)))
+	if err == nil {
+		stop()
+		for _, m := range pending {
+			w.stored(m)
+		}
+		return
+	}
+
+	consumer.ConsumeErrors.WithLabelValues("flush").Inc()
+	if w.rejectBatch && !consumer.IsPermanent(err) {
+		stop()
+		w.logger.Warn().
+			Err(err).
+			Int("messages", len(pending)).
+			Msg("batch flush failed, rejecting the batch")
+		for _, m := range pending {
+			w.failed(m, err)
+		}
+		return
+	}
+	w.logger.Warn().
+		Err(err).
+		Int("messages", len(pending)).
+		Msg("batch flush failed, writing messages one by one")
+	for _, m := range pending {
+		if err := w.write(ctx, []pendingMessage{m}); err != nil {
+			w.failed(m, err)
+			continue
+		}
+		w.stored(m)
+	}
+}
+
+// write sends the statements of messages as one batch in a transaction and
+// commits it. Nothing is written if any statement fails.
+func (w *batchWriter) write(ctx context.Context, messages []pendingMessage) error {
+	var statements []postgres.Statement
+	for _, m := range messages {
+		statements = append(statements, m.statements...)
+	}
+	if len(statements) == 0 {
+		return nil
+	}
+
+	tx, err := w.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// Rolling back after a commit is a no-op
+	defer tx.Rollback(context.Background())
+
+	tags, err := execStatements(ctx, tx, statements)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit events: %w", err)
+	}
+
+	observeStatements(statements, tags)
+	return nil
+}
+
+// execStatements sends statements as one batch in tx and returns their
+// command tags. The caller commits tx, then passes the tags to
+// observeStatements. Results come back in order, so the time between two
+// of them is the time the second statement took; the first also includes
+// the round trip.
+func execStatements(ctx context.Context, tx pgx.Tx, statements []postgres.Statement) ([]pgconn.CommandTag, error) {
+	batch := &pgx.Batch{}
+	for _, st := range statements {
+		batch.Queue(st.Query, st.Args...)
+	}
+
+	start := time.Now()
+	results := tx.SendBatch(ctx, batch)
+	tags := make([]pgconn.CommandTag, batch.Len())
+	for i := range tags {
+		var err error
+		if tags[i], err = results.Exec(); err != nil {
+			results.Close()
+			return nil, fmt.Errorf("failed to store event: %w", err)
+		}
+		done := time.Now()
+		consumer.ObserveWrite(statements[i].Query, done.Sub(start))
+		start = done
+	}
+	if err := results.Close(); err != nil {
+		return nil, fmt.Errorf("failed to store event: %w", err)
+	}
+	return tags, nil
+}
+
+// observeStatements passes the command tags of committed statements to
+// their observers and counts the rows their inserts wrote and skipped.
+func observeStatements(statements []postgres.Statement, tags []pgconn.CommandTag) {
+	for i, st := range statements {
+		consumer.ObserveRows(st.Query, tags[i], st.Rows)
+		if st.Observe != nil {
+			st.Observe(tags[i])
+		}
+	}
+}
+
+// stored acknowledges a message whose statements committed.
+func (w *batchWriter) stored(m pendingMessage) {
+	ackStored(m, w.logger)
+}
+
+// failed rejects a message that could not be stored, for redelivery unless
+// the database rejected its data.
+func (w *batchWriter) failed(m pendingMessage, err error) {
+	rejectFailed(m, err, w.logger)
+}
+
+// ackStored acknowledges a message once it is written and accounts for it.
+func ackStored(m pendingMessage, logger zerolog.Logger) {
+	if err := m.msg.Ack(); err != nil {
+		// Redelivered and written again, which is idempotent
+		logger.Warn().Err(err).Str("subject", m.msg.Subject()).Msg("failed to acknowledge message")
+	}
+	consumer.MessageSettled(m.msg)
+	now := time.Now()
+	eventType := m.eventType
+	switch {
+	case m.quarantined:
+		eventType = ""
+	case m.duplicate != nil && *m.duplicate:
+		consumer.EventsDuplicate.WithLabelValues(m.eventType).Inc()
+		logger.Debug().
+			Str("event", m.eventType).
+			Str("tx", m.event.TxHash).
+			Uint("log_index", m.event.LogIndex).
+			Msg("event already stored")
+		eventType = ""
+	default:
+		consumer.EventsStored.WithLabelValues(m.eventType).Inc()
+		consumer.ObserveLatency(m.eventType, m.event, now)
+	}
+
+	var seq uint64
+	if meta, err := m.msg.Metadata(); err == nil {
+		seq = meta.Sequence.Stream
+	}
+	progress.record(eventType, seq, now)
+}
+
+// rejectFailed rejects a message that could not be written.
+func rejectFailed(m pendingMessage, err error, logger zerolog.Logger) {
+	consumer.ConsumeErrors.WithLabelValues("process_message").Inc()
+	rejectMessage(m.msg, err, logger.With().
+		Str("tx", m.event.TxHash).
+		Uint("log_index", m.event.LogIndex).
+		Logger())
+}
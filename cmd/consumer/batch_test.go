@@ -0,0 +1,519 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/postgres"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// fakeMsg is a JetStream message recording how it was acknowledged.
+type fakeMsg struct {
+	jetstream.Msg
+	subject   string
+	header    nats.Header
+	data      []byte
+	delivered uint64 // Zero makes Metadata fail
+	sequence  uint64 // Stream sequence
+	published time.Time
+
+	acks     int
+	naks     int
+	nakDelay time.Duration
+	terms    int
+
+	// inProgress is sent from the heartbeat goroutine
+	inProgress atomic.Int32
+}
+
+func (m *fakeMsg) Subject() string      { return m.subject }
+func (m *fakeMsg) Headers() nats.Header { return m.header }
+func (m *fakeMsg) Data() []byte         { return m.data }
+func (m *fakeMsg) Ack() error           { m.acks++; return nil }
+func (m *fakeMsg) Nak() error           { m.naks++; return nil }
+
+func (m *fakeMsg) NakWithDelay(delay time.Duration) error {
+	m.naks++
+	m.nakDelay = delay
+	return nil
+}
+
+func (m *fakeMsg) TermWithReason(string) error { m.terms++; return nil }
+func (m *fakeMsg) InProgress() error           { m.inProgress.Add(1); return nil }
+
+func (m *fakeMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	if m.delivered == 0 {
+		return nil, errors.New("not a JetStream message")
+	}
+	return &jetstream.MsgMetadata{
+		NumDelivered: m.delivered,
+		Sequence:     jetstream.SequencePair{Stream: m.sequence},
+		Timestamp:    m.published,
+	}, nil
+}
+
+// fakeDB records the batches sent and how their transactions ended. It
+// fails the batches containing a statement with the query "FAIL" (a
+// constraint violation) or "DOWN" (a lost connection), and every commit
+// while commitErr is set. Commits take commitDelay.
+type fakeDB struct {
+	batches     [][]string
+	commits     int
+	rollbacks   int
+	commitErr   error
+	commitDelay time.Duration
+}
+
+func (db *fakeDB) Begin(context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: db}, nil
+}
+
+// fakeTx is a transaction of a fakeDB.
+type fakeTx struct {
+	pgx.Tx
+	db   *fakeDB
+	done bool
+}
+
+func (tx *fakeTx) SendBatch(_ context.Context, b *pgx.Batch) pgx.BatchResults {
+	var queries []string
+	for _, q := range b.QueuedQueries {
+		queries = append(queries, q.SQL)
+	}
+	tx.db.batches = append(tx.db.batches, queries)
+	return &fakeBatchResults{queries: queries}
+}
+
+func (tx *fakeTx) Commit(context.Context) error {
+	time.Sleep(tx.db.commitDelay)
+	tx.done = true
+	if tx.db.commitErr != nil {
+		tx.db.rollbacks++
+		return tx.db.commitErr
+	}
+	tx.db.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback(context.Context) error {
+	if !tx.done {
+		tx.done = true
+		tx.db.rollbacks++
+	}
+	return nil
+}
+
+// fakeBatchResults fails the Exec of a "FAIL" or "DOWN" statement.
+type fakeBatchResults struct {
+	pgx.BatchResults
+	queries []string
+	next    int
+}
+
+func (r *fakeBatchResults) Exec() (pgconn.CommandTag, error) {
+	query := r.queries[r.next]
+	r.next++
+	switch query {
+	case "FAIL":
+		return pgconn.CommandTag{}, &pgconn.PgError{Code: "23502", Message: "null value in column violates not-null constraint"}
+	case "DOWN":
+		return pgconn.CommandTag{}, errors.New("connection reset by peer")
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (r *fakeBatchResults) Close() error { return nil }
+
+// testPending returns a buffered message with the given statements.
+func testPending(queries ...string) (pendingMessage, *fakeMsg) {
+	msg := &fakeMsg{subject: "POLYMARKET.OrderFilled.0xab", header: nats.Header{}, delivered: 1}
+	m := pendingMessage{msg: msg, eventType: "OrderFilled", event: models.Event{TxHash: "0x01"}}
+	for _, q := range queries {
+		m.statements = append(m.statements, postgres.Statement{Query: q})
+	}
+	return m, msg
+}
+
+// TestBatchWriterAcksAfterFlush tests that buffered messages are written in
+// one batch and acknowledged only once it is flushed, when it is full or
+// on demand, and that the buffered messages gauge follows the buffer.
+func TestBatchWriterAcksAfterFlush(t *testing.T) {
+	db := &fakeDB{}
+	w := newBatchWriter(db, 3, zerolog.Nop())
+	buffered := testutil.ToFloat64(consumer.BufferedMessages)
+
+	a, msgA := testPending("INSERT a", "INSERT a2")
+	b, msgB := testPending("INSERT b")
+	w.add(context.Background(), a)
+	w.add(context.Background(), b)
+	require.Empty(t, db.batches)
+	require.Zero(t, msgA.acks+msgB.acks)
+	require.Equal(t, buffered+2, testutil.ToFloat64(consumer.BufferedMessages))
+
+	c, msgC := testPending("INSERT c")
+	w.add(context.Background(), c)
+	require.Equal(t, [][]string{{"INSERT a", "INSERT a2", "INSERT b", "INSERT c"}}, db.batches)
+	require.Equal(t, []int{1, 1, 1}, []int{msgA.acks, msgB.acks, msgC.acks})
+	require.Equal(t, buffered, testutil.ToFloat64(consumer.BufferedMessages))
+
+	d, msgD := testPending("INSERT d")
+	w.add(context.Background(), d)
+	w.flush(context.Background())
+	require.Len(t, db.batches, 2)
+	require.Equal(t, 1, msgD.acks)
+
+	w.flush(context.Background())
+	require.Len(t, db.batches, 2, "nothing buffered")
+}
+
+// TestBatchWriterIsolatesFailures tests that a failed batch is retried
+// message by message, so only the messages that cannot be stored are
+// rejected: terminated if the database rejected their data, redelivered
+// later otherwise.
+func TestBatchWriterIsolatesFailures(t *testing.T) {
+	db := &fakeDB{}
+	w := newBatchWriter(db, 10, zerolog.Nop())
+
+	good, goodMsg := testPending("INSERT good")
+	invalid, invalidMsg := testPending("INSERT invalid", "FAIL")
+	unavailable, unavailableMsg := testPending("DOWN")
+	w.add(context.Background(), good)
+	w.add(context.Background(), invalid)
+	w.add(context.Background(), unavailable)
+	w.flush(context.Background())
+
+	require.Len(t, db.batches, 4)
+	require.Equal(t, 1, db.commits, "only the good message commits")
+	require.Equal(t, 3, db.rollbacks)
+	require.Equal(t, 1, goodMsg.acks)
+	require.Zero(t, goodMsg.naks+goodMsg.terms)
+
+	require.Zero(t, invalidMsg.acks+invalidMsg.naks)
+	require.Equal(t, 1, invalidMsg.terms)
+
+	require.Zero(t, unavailableMsg.acks+unavailableMsg.terms)
+	require.Equal(t, 1, unavailableMsg.naks)
+	require.Equal(t, nakDelays[0], unavailableMsg.nakDelay)
+}
+
+// TestBatchWriterObservesAfterCommit tests that statement results are
+// observed only once the transaction running them committed.
+func TestBatchWriterObservesAfterCommit(t *testing.T) {
+	db := &fakeDB{commitErr: errors.New("connection lost")}
+	w := newBatchWriter(db, 10, zerolog.Nop())
+
+	var observed int
+	m, _ := testPending("INSERT a")
+	m.statements[0].Observe = func(pgconn.CommandTag) { observed++ }
+	w.add(context.Background(), m)
+	w.flush(context.Background())
+	require.Zero(t, observed)
+
+	db.commitErr = nil
+	w.add(context.Background(), m)
+	w.flush(context.Background())
+	require.Equal(t, 1, observed)
+}
+
+// TestBatchWriterCommitFailure tests that messages are not acknowledged
+// when the transaction writing them fails to commit.
+func TestBatchWriterCommitFailure(t *testing.T) {
+	db := &fakeDB{commitErr: errors.New("connection lost")}
+	w := newBatchWriter(db, 10, zerolog.Nop())
+
+	m, msg := testPending("INSERT a", "INSERT b")
+	w.add(context.Background(), m)
+	w.flush(context.Background())
+
+	require.Zero(t, db.commits)
+	require.Zero(t, msg.acks)
+	require.Equal(t, 1, msg.naks)
+}
+
+// pendingRawEvent returns a buffered message storing an event that only has
+// a raw row.
+func pendingRawEvent(t *testing.T, logIndex uint) (pendingMessage, *fakeMsg) {
+	t.Helper()
+	event := models.Event{
+		Block:        100,
+		BlockHash:    "0xb1",
+		Timestamp:    1_700_000_000,
+		TxHash:       "0xt1",
+		LogIndex:     logIndex,
+		ContractAddr: "0xab",
+		EventSig:     "0xsig",
+		EventName:    "OrderCancelled",
+		Payload:      map[string]string{"orderHash": "0x01"},
+		Success:      true,
+	}
+	return pendingEvent(t, event)
+}
+
+// pendingEvent returns a buffered message storing an event.
+func pendingEvent(t *testing.T, event models.Event) (pendingMessage, *fakeMsg) {
+	t.Helper()
+	var recorder postgres.Recorder
+	require.NoError(t, storeEvent(context.Background(), &recorder, event.EventName, event))
+
+	m, msg := testPending()
+	m.eventType = event.EventName
+	m.event = event
+	m.statements = recorder.Statements
+	return m, msg
+}
+
+// storeEvent stores an event with the consumer's store configuration,
+// executing its statements on db.
+func storeEvent(ctx context.Context, db postgres.Execer, eventType string, event models.Event) error {
+	return store.StoreEvent(ctx, postgresStore(db, zerolog.Nop()), eventType, event)
+}
+
+// countEvents returns the number of rows in the events table.
+func countEvents(t *testing.T, pool *pgxpool.Pool) int {
+	t.Helper()
+	var n int
+	require.NoError(t, pool.QueryRow(context.Background(), "SELECT count(*) FROM events").Scan(&n))
+	return n
+}
+
+// TestBatchWriterRedelivery tests against Postgres that messages buffered
+// when the consumer dies before flushing are neither stored nor
+// acknowledged, and that their redelivery, including a second redelivery
+// after the flush committed, stores every event exactly once.
+func TestBatchWriterRedelivery(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+
+	// The consumer dies with three messages buffered
+	crashed := newBatchWriter(pool, 10, zerolog.Nop())
+	var msgs []*fakeMsg
+	for i := uint(0); i < 3; i++ {
+		m, msg := pendingRawEvent(t, i)
+		crashed.add(ctx, m)
+		msgs = append(msgs, msg)
+	}
+	require.Zero(t, countEvents(t, pool))
+	for _, msg := range msgs {
+		require.Zero(t, msg.acks)
+	}
+
+	// JetStream redelivers them to the restarted consumer
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+	for i := uint(0); i < 3; i++ {
+		m, msg := pendingRawEvent(t, i)
+		w.add(ctx, m)
+		msgs[i] = msg
+	}
+	w.flush(ctx)
+	require.Equal(t, 3, countEvents(t, pool))
+	for _, msg := range msgs {
+		require.Equal(t, 1, msg.acks)
+	}
+
+	// An ack lost after the commit redelivers a stored message once more
+	m, msg := pendingRawEvent(t, 1)
+	w.add(ctx, m)
+	w.flush(ctx)
+	require.Equal(t, 1, msg.acks)
+	require.Zero(t, msg.naks)
+	require.Equal(t, 3, countEvents(t, pool))
+}
+
+// TestStatementRecorder tests that store methods are recorded in the order
+// they execute.
+func TestStatementRecorder(t *testing.T) {
+	var recorder postgres.Recorder
+	event := models.Event{TxHash: "0xabc", LogIndex: 7, BlockHash: "0xb1", EventName: "OrderFilled"}
+	require.NoError(t, postgresStore(&recorder, zerolog.Nop()).RevertEvent(context.Background(), "OrderFilled", event))
+	require.Len(t, recorder.Statements, 4)
+	require.True(t, strings.Contains(recorder.Statements[0].Query, "order_fills"))
+	require.Equal(t, []any{"0xabc", uint(7), "0xb1"}, recorder.Statements[1].Args)
+}
+
+// TestBatchWriterRollsBackPartialEvents tests against Postgres that an event
+// whose parsed insert fails leaves no raw row behind, while the other
+// events of its batch are stored and marked processed.
+func TestBatchWriterRollsBackPartialEvents(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	good, goodMsg := pendingRawEvent(t, 0)
+	bad, badMsg := pendingRawEvent(t, 1)
+	bad.statements = append(bad.statements, postgres.Statement{
+		Query: "INSERT INTO order_fills (block_number) VALUES (1)",
+	})
+	w.add(ctx, good)
+	w.add(ctx, bad)
+	w.flush(ctx)
+
+	require.Equal(t, 1, goodMsg.acks)
+	require.Zero(t, badMsg.acks)
+	require.Equal(t, 1, badMsg.terms, "not-null violation is permanent")
+
+	var logIndex int
+	var processed bool
+	require.NoError(t, pool.QueryRow(ctx, "SELECT log_index, processed FROM events").Scan(&logIndex, &processed))
+	require.Zero(t, logIndex)
+	require.True(t, processed)
+}
+
+// TestBatchWriterCountsDuplicates tests that an event whose raw insert wrote
+// no row is acknowledged and counted as a duplicate instead of as stored.
+func TestBatchWriterCountsDuplicates(t *testing.T) {
+	msg := eventMsg(t, cancelledEvent(0))
+	pending, err := processMessage(context.Background(), msg, zerolog.Nop())
+	require.NoError(t, err)
+
+	var raw *postgres.Statement
+	for i := range pending.statements {
+		if strings.Contains(pending.statements[i].Query, "INSERT INTO events") {
+			raw = &pending.statements[i]
+		}
+	}
+	require.NotNil(t, raw)
+	require.NotNil(t, raw.Observe)
+
+	stored := consumer.EventsStored.WithLabelValues(events.OrderCancelled)
+	duplicates := consumer.EventsDuplicate.WithLabelValues(events.OrderCancelled)
+	storedBefore, duplicatesBefore := testutil.ToFloat64(stored), testutil.ToFloat64(duplicates)
+	w := newBatchWriter(&fakeDB{}, 10, zerolog.Nop())
+
+	raw.Observe(pgconn.NewCommandTag("INSERT 0 1"))
+	w.stored(*pending)
+	require.Equal(t, storedBefore+1, testutil.ToFloat64(stored))
+	require.Equal(t, duplicatesBefore, testutil.ToFloat64(duplicates))
+
+	raw.Observe(pgconn.NewCommandTag("INSERT 0 0"))
+	w.stored(*pending)
+	require.Equal(t, storedBefore+1, testutil.ToFloat64(stored))
+	require.Equal(t, duplicatesBefore+1, testutil.ToFloat64(duplicates))
+	require.Equal(t, 2, msg.acks)
+}
+
+// derivedState returns the derived tables a redelivery must not change:
+// candles, balances, open interest and the position ledger.
+func derivedState(t *testing.T, pool *pgxpool.Pool) []string {
+	t.Helper()
+	var ledger string
+	require.NoError(t, pool.QueryRow(context.Background(), `
+		SELECT count(*) || ' ' || COALESCE(sum(quantity), 0)::TEXT FROM position_changes
+	`).Scan(&ledger))
+
+	state := append(candlesOf(t, pool), ledger, openInterestOf(t, pool))
+	for key, balance := range balancesOf(t, pool) {
+		state = append(state, key+" "+balance)
+	}
+	sort.Strings(state)
+	return state
+}
+
+// TestRedeliveryAgainstPostgres tests against Postgres that events
+// delivered twice, a fill, a mint and a split, change candles,
+// balances, open interest and positions once, and that their second
+// delivery is acknowledged and counted as a duplicate.
+func TestRedeliveryAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	delivered := []models.Event{
+		storetest.FillEvent(100, 0, 1_700_000_050, 500_000, 1_000_000),
+		storetest.TransferEvent(1, models.ZeroAddress, storetest.WalletA, 77, 400_000),
+		storetest.PositionEvent(events.PositionSplit, 101, 10_000_000, false),
+	}
+	deliver := func() {
+		for _, event := range delivered {
+			msg := eventMsg(t, event)
+			pending, ok := handleMessage(ctx, msg, zerolog.Nop())
+			require.True(t, ok, event.EventName)
+			w.add(ctx, pending)
+			w.flush(ctx)
+			require.Equal(t, 1, msg.acks, event.EventName)
+		}
+	}
+
+	deliver()
+	first := derivedState(t, pool)
+	require.Contains(t, first, "60 1700000040 0.500000 0.500000 0.500000 0.500000 1.000000 1")
+	require.Contains(t, first, "10000000")
+
+	duplicates := make([]float64, len(delivered))
+	for i, event := range delivered {
+		duplicates[i] = testutil.ToFloat64(consumer.EventsDuplicate.WithLabelValues(event.EventName))
+	}
+	deliver()
+	require.Equal(t, first, derivedState(t, pool))
+	for i, event := range delivered {
+		require.Equal(t, duplicates[i]+1, testutil.ToFloat64(consumer.EventsDuplicate.WithLabelValues(event.EventName)), event.EventName)
+	}
+}
+
+// TestRowCountersAgainstPostgres tests against Postgres that the rows an
+// event's inserts write are counted as inserted on its first delivery and
+// as duplicates on the second, each row of a transfer batch included.
+func TestRowCountersAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	delivered := []models.Event{storetest.FillEvent(100, 0, 1_700_000_050, 500_000, 1_000_000), storetest.TransferBatchEvent(3)}
+	tables := []string{"events", "order_fills", "token_transfers"}
+	counts := func() map[string][2]float64 {
+		out := make(map[string][2]float64)
+		for _, table := range tables {
+			out[table] = [2]float64{
+				testutil.ToFloat64(consumer.RowsInserted.WithLabelValues(table)),
+				testutil.ToFloat64(consumer.RowsDuplicate.WithLabelValues(table)),
+			}
+		}
+		return out
+	}
+	deliver := func() {
+		for _, event := range delivered {
+			pending, ok := handleMessage(ctx, eventMsg(t, event), zerolog.Nop())
+			require.True(t, ok, event.EventName)
+			w.add(ctx, pending)
+		}
+		w.flush(ctx)
+	}
+
+	before := counts()
+	deliver()
+	first := counts()
+	require.Equal(t, before["events"][0]+2, first["events"][0])
+	require.Equal(t, before["order_fills"][0]+1, first["order_fills"][0])
+	require.Equal(t, before["token_transfers"][0]+3, first["token_transfers"][0])
+	for _, table := range tables {
+		require.Equal(t, before[table][1], first[table][1], table)
+	}
+
+	deliver()
+	second := counts()
+	require.Equal(t, first["events"][1]+2, second["events"][1])
+	require.Equal(t, first["order_fills"][1]+1, second["order_fills"][1])
+	require.Equal(t, first["token_transfers"][1]+3, second["token_transfers"][1])
+	for _, table := range tables {
+		require.Equal(t, first[table][0], second[table][0], table)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// parseCandleIntervals parses consumer.candle_intervals. Every width must be
+// a whole number of seconds dividing a day, so buckets start at the same
+// times in the consumer and in rebuild_candles.
+func parseCandleIntervals(values []string) ([]time.Duration, error) {
+	intervals := make([]time.Duration, 0, len(values))
+	seen := make(map[time.Duration]bool, len(values))
+	for _, value := range values {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid candle interval %q: %w", value, err)
+		}
+		if interval < time.Second || interval%time.Second != 0 || (24*time.Hour)%interval != 0 {
+			return nil, fmt.Errorf("invalid candle interval %q: must be whole seconds dividing 24h", value)
+		}
+		if !seen[interval] {
+			seen[interval] = true
+			intervals = append(intervals, interval)
+		}
+	}
+	return intervals, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestParseCandleIntervals tests that candle widths must be whole seconds
+// dividing a day and that duplicates are dropped.
+func TestParseCandleIntervals(t *testing.T) {
+	intervals, err := parseCandleIntervals([]string{"1m", "5m", "1h", "60s", "24h"})
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{time.Minute, 5 * time.Minute, time.Hour, 24 * time.Hour}, intervals)
+
+	for _, value := range []string{"7m", "1.5s", "500ms", "48h", "-1m", "soon"} {
+		_, err := parseCandleIntervals([]string{value})
+		require.Error(t, err, value)
+	}
+}
+
+// candlesOf returns every stored candle as "width bucket open high low close
+// volume trades".
+func candlesOf(t *testing.T, pool *pgxpool.Pool) []string {
+	t.Helper()
+	rows, err := pool.Query(context.Background(), `
+		SELECT concat_ws(' ', interval_seconds, extract(epoch FROM bucket)::BIGINT,
+			open, high, low, close, volume, trades)
+		FROM candles ORDER BY interval_seconds, bucket`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var candles []string
+	for rows.Next() {
+		var candle string
+		require.NoError(t, rows.Scan(&candle))
+		candles = append(candles, candle)
+	}
+	require.NoError(t, rows.Err())
+	return candles
+}
+
+// TestCandlesAgainstPostgres tests against Postgres that trades delivered
+// out of time order, and redelivered, produce the candles rebuilt from the
+// trades, and that a removed trade is taken out of its candles.
+func TestCandlesAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	// Minute 1_700_000_040 holds blocks 100 to 102, the next minute
+	// block 103; all are in hour 1_699_999_200
+	fills := []models.Event{
+		storetest.FillEvent(102, 0, 1_700_000_090, 600_000, 1_000_000),   // 0.60, closes the first minute
+		storetest.FillEvent(103, 0, 1_700_000_110, 550_000, 1_000_000),   // 0.55, alone in the second minute
+		storetest.FillEvent(100, 5, 1_700_000_050, 1_000_000, 2_000_000), // 0.50, opens the first minute
+		storetest.FillEvent(101, 0, 1_700_000_070, 2_100_000, 3_000_000), // 0.70, the high
+		storetest.FillEvent(100, 9, 1_700_000_050, 400_000, 1_000_000),   // 0.40, the low
+		storetest.FillEvent(101, 0, 1_700_000_070, 2_100_000, 3_000_000), // redelivered
+	}
+	store := func(event models.Event) {
+		m, msg := pendingEvent(t, event)
+		w.add(ctx, m)
+		w.flush(ctx)
+		require.Equal(t, 1, msg.acks)
+	}
+	for _, fill := range fills {
+		store(fill)
+	}
+
+	want := []string{
+		"60 1700000040 0.500000 0.700000 0.400000 0.600000 7.000000 4",
+		"60 1700000100 0.550000 0.550000 0.550000 0.550000 1.000000 1",
+		"3600 1699999200 0.500000 0.700000 0.400000 0.550000 8.000000 5",
+	}
+	require.Equal(t, want, candlesOf(t, pool))
+
+	_, err := pool.Exec(ctx, "SELECT rebuild_candles(60), rebuild_candles(3600)")
+	require.NoError(t, err)
+	require.Equal(t, want, candlesOf(t, pool))
+
+	// The high is reorged out
+	removed := fills[3]
+	removed.Success = false
+	store(removed)
+	require.Equal(t, []string{
+		"60 1700000040 0.500000 0.600000 0.400000 0.600000 4.000000 3",
+		"60 1700000100 0.550000 0.550000 0.550000 0.550000 1.000000 1",
+		"3600 1699999200 0.500000 0.600000 0.400000 0.550000 5.000000 4",
+	}, candlesOf(t, pool))
+
+	// Removing the only trade of a bucket removes its candle
+	removed = fills[1]
+	removed.Success = false
+	store(removed)
+	require.Len(t, candlesOf(t, pool), 2)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+)
+
+// chunks reassembles the events published in chunks because their message
+// exceeded the server's max payload.
+var chunks = newChunkAssembler()
+
+// chunkAssembler holds the chunk messages of an event until all of them
+// have arrived. Held chunks are not acknowledged: the event is settled as a
+// whole once it is reassembled, so a consumer dying with some chunks held
+// has all of them redelivered. A redelivered chunk replaces the delivery
+// held for it, and chunks of an event not completed within twice the ack
+// wait are dropped, to be redelivered by JetStream if they still can be.
+// Every chunk of an event must fit within consumer.max_ack_pending.
+type chunkAssembler struct {
+	mu   sync.Mutex
+	sets map[string]*chunkSet // By chunk ID
+}
+
+// chunkSet is the chunks of one event received so far.
+type chunkSet struct {
+	parts    []jetstream.Msg // By index, nil until received
+	received int
+	updated  time.Time
+}
+
+// newChunkAssembler creates an assembler holding no chunks.
+func newChunkAssembler() *chunkAssembler {
+	return &chunkAssembler{sets: make(map[string]*chunkSet)}
+}
+
+// add returns msg unchanged if it is not a chunk, and the reassembled
+// message once the last chunk of its event arrives. It returns false while
+// chunks of the event are missing, and msg with an error if its chunk
+// headers are malformed.
+func (a *chunkAssembler) add(msg jetstream.Msg) (jetstream.Msg, bool, error) {
+	chunk, ok, err := codec.ChunkFromHeaders(msg.Headers())
+	if err != nil {
+		return msg, true, err
+	}
+	if !ok {
+		return msg, true, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	a.expire(now)
+
+	set := a.sets[chunk.ID]
+	if set == nil || len(set.parts) != chunk.Count {
+		if set != nil {
+			consumer.BufferedChunks.Sub(float64(set.received))
+		}
+		set = &chunkSet{parts: make([]jetstream.Msg, chunk.Count)}
+		a.sets[chunk.ID] = set
+	}
+	if set.parts[chunk.Index-1] == nil {
+		set.received++
+		consumer.BufferedChunks.Inc()
+	}
+	set.parts[chunk.Index-1] = msg
+	set.updated = now
+	if set.received < chunk.Count {
+		return nil, false, nil
+	}
+
+	delete(a.sets, chunk.ID)
+	consumer.BufferedChunks.Sub(float64(chunk.Count))
+	consumer.ChunkedEvents.Inc()
+	return newChunkedMsg(set.parts), true, nil
+}
+
+// expire drops the chunks of events not completed within twice the ack
+// wait.
+func (a *chunkAssembler) expire(now time.Time) {
+	for id, set := range a.sets {
+		if now.Sub(set.updated) > 2*ackWait {
+			delete(a.sets, id)
+			consumer.BufferedChunks.Sub(float64(set.received))
+		}
+	}
+}
+
+// receiveMessage passes a consumed message through the chunk assembler and
+// tracks it as delivered once it is whole. It returns false for chunks held
+// until the rest of their event arrives, and for malformed chunks, which
+// are rejected.
+func receiveMessage(msg jetstream.Msg, logger zerolog.Logger) (jetstream.Msg, bool) {
+	msg, complete, err := chunks.add(msg)
+	if !complete {
+		return nil, false
+	}
+	consumer.MessageDelivered(msg)
+	if err != nil {
+		settleProcessed(msg, nil, err, logger)
+		return nil, false
+	}
+	return msg, true
+}
+
+// chunkedMsg is an event reassembled from its chunk messages. It reads as
+// the message that was split, and settles every chunk. Its subject and
+// metadata are those of the first chunk.
+type chunkedMsg struct {
+	jetstream.Msg
+	parts  []jetstream.Msg
+	header nats.Header
+	data   []byte
+}
+
+// newChunkedMsg reassembles the chunks of an event, in order.
+func newChunkedMsg(parts []jetstream.Msg) *chunkedMsg {
+	var size int
+	for _, part := range parts {
+		size += len(part.Data())
+	}
+	data := make([]byte, 0, size)
+	for _, part := range parts {
+		data = append(data, part.Data()...)
+	}
+
+	header := nats.Header{}
+	for key, values := range parts[0].Headers() {
+		header[key] = values
+	}
+	header.Del(codec.HeaderChunk)
+	header.Del(codec.HeaderChunkID)
+	return &chunkedMsg{Msg: parts[0], parts: parts, header: header, data: data}
+}
+
+func (m *chunkedMsg) Data() []byte         { return m.data }
+func (m *chunkedMsg) Headers() nats.Header { return m.header }
+
+func (m *chunkedMsg) Ack() error {
+	return m.each(jetstream.Msg.Ack)
+}
+
+func (m *chunkedMsg) DoubleAck(ctx context.Context) error {
+	return m.each(func(part jetstream.Msg) error { return part.DoubleAck(ctx) })
+}
+
+func (m *chunkedMsg) Nak() error {
+	return m.each(jetstream.Msg.Nak)
+}
+
+func (m *chunkedMsg) NakWithDelay(delay time.Duration) error {
+	return m.each(func(part jetstream.Msg) error { return part.NakWithDelay(delay) })
+}
+
+func (m *chunkedMsg) InProgress() error {
+	return m.each(jetstream.Msg.InProgress)
+}
+
+func (m *chunkedMsg) Term() error {
+	return m.each(jetstream.Msg.Term)
+}
+
+func (m *chunkedMsg) TermWithReason(reason string) error {
+	return m.each(func(part jetstream.Msg) error { return part.TermWithReason(reason) })
+}
+
+// each settles every chunk, returning the failures.
+func (m *chunkedMsg) each(settle func(jetstream.Msg) error) error {
+	var errs []error
+	for _, part := range m.parts {
+		if err := settle(part); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+)
+
+// chunkMsgs splits the message of msg into n chunk messages, as the
+// publisher does for messages exceeding the max payload.
+func chunkMsgs(msg *fakeMsg, id string, n int) []*fakeMsg {
+	size := (len(msg.data) + n - 1) / n
+	parts := make([]*fakeMsg, n)
+	for i := range parts {
+		header := nats.Header{}
+		for key, values := range msg.header {
+			header[key] = values
+		}
+		codec.Chunk{ID: id, Index: i + 1, Count: n}.SetHeaders(header)
+		parts[i] = &fakeMsg{
+			subject:   msg.subject,
+			header:    header,
+			data:      msg.data[i*size : min((i+1)*size, len(msg.data))],
+			delivered: 1,
+			sequence:  uint64(10 + i),
+		}
+	}
+	return parts
+}
+
+// TestHandleMessageReassemblesChunks tests that the chunks of a synthetic
+// 5,000-transfer batch are held until the last arrives, in any order, that
+// the reassembled event is stored as one batch, and that acknowledging it
+// acknowledges the latest delivery of every chunk.
+func TestHandleMessageReassemblesChunks(t *testing.T) {
+	buffered := testutil.ToFloat64(consumer.BufferedChunks)
+	chunked := testutil.ToFloat64(consumer.ChunkedEvents)
+
+	msg := eventMsg(t, storetest.TransferBatchEvent(5000))
+	parts := chunkMsgs(msg, "0xa1-0", 3)
+	first := parts[0]
+	redelivered := &fakeMsg{subject: first.subject, header: first.header, data: first.data, delivered: 2, sequence: first.sequence}
+
+	ctx := context.Background()
+	for _, part := range []*fakeMsg{parts[1], parts[0], redelivered} {
+		_, ok := handleMessage(ctx, part, zerolog.Nop())
+		require.False(t, ok)
+	}
+	require.Equal(t, buffered+2, testutil.ToFloat64(consumer.BufferedChunks))
+
+	pending, ok := handleMessage(ctx, parts[2], zerolog.Nop())
+	require.True(t, ok)
+	require.Equal(t, buffered, testutil.ToFloat64(consumer.BufferedChunks))
+	require.Equal(t, chunked+1, testutil.ToFloat64(consumer.ChunkedEvents))
+	require.Equal(t, msg.data, pending.msg.Data())
+	require.Empty(t, pending.msg.Headers().Get(codec.HeaderChunk))
+
+	var rows int
+	for _, s := range pending.statements {
+		rows = max(rows, s.Rows)
+	}
+	require.Equal(t, 5000, rows)
+
+	require.NoError(t, pending.msg.Ack())
+	require.Equal(t, []int{0, 1, 1, 1}, []int{parts[0].acks, redelivered.acks, parts[1].acks, parts[2].acks})
+}
+
+// TestHandleMessageRejectsMalformedChunks tests that a chunk whose headers
+// are malformed is rejected for good instead of being decoded alone.
+func TestHandleMessageRejectsMalformedChunks(t *testing.T) {
+	msg := eventMsg(t, storetest.TransferBatchEvent(10))
+	msg.header.Set(codec.HeaderChunk, "3/2")
+	msg.header.Set(codec.HeaderChunkID, "0xa1-0")
+
+	_, ok := handleMessage(context.Background(), msg, zerolog.Nop())
+	require.False(t, ok)
+	require.Equal(t, 1, msg.terms)
+	require.Zero(t, msg.acks)
+}
+
+// TestChunkAssemblerExpires tests that the chunks of an event not completed
+// within twice the ack wait are dropped, unacknowledged, when later chunks
+// arrive.
+func TestChunkAssemblerExpires(t *testing.T) {
+	withAckWait(t, 0)
+	a := newChunkAssembler()
+	parts := chunkMsgs(eventMsg(t, storetest.TransferBatchEvent(10)), "0xa1-0", 2)
+
+	_, complete, err := a.add(parts[0])
+	require.NoError(t, err)
+	require.False(t, complete)
+
+	// Expired when the next chunk arrives
+	other := chunkMsgs(eventMsg(t, storetest.TransferBatchEvent(10)), "0xa2-0", 2)
+	_, complete, err = a.add(other[0])
+	require.NoError(t, err)
+	require.False(t, complete)
+	require.Len(t, a.sets, 1)
+	require.Contains(t, a.sets, "0xa2-0")
+	require.Zero(t, parts[0].acks)
+}
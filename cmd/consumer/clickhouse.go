@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/internal/store/clickhouse"
+)
+
+// Storage backends (storage.backend).
+const (
+	backendPostgres   = "postgres"   // TimescaleDB, every table
+	backendClickHouse = "clickhouse" // order fills, transfers and conditions only
+)
+
+// parseBackend validates a storage backend; empty is postgres.
+func parseBackend(backend string) (string, error) {
+	switch backend {
+	case "", backendPostgres:
+		return backendPostgres, nil
+	case backendClickHouse:
+		return backendClickHouse, nil
+	}
+	return "", fmt.Errorf("unknown storage backend %q (expected %q or %q)", backend, backendPostgres, backendClickHouse)
+}
+
+// clickhouseConsumer fetches batches like the pull consumer and writes
+// every fetched batch to ClickHouse with one insert per table: the batch is
+// acknowledged once the inserts are written, and rejected as a whole for
+// redelivery if they fail. Redelivered rows replace the rows they
+// duplicate, so a partly written batch is written again in full.
+//
+// ClickHouse has no quarantine table: malformed events are rejected.
+type clickhouseConsumer struct {
+	consumer  fetcher
+	client    *clickhouse.Client
+	batchSize int
+	maxWait   time.Duration
+	logger    zerolog.Logger
+}
+
+// newClickHouseConsumer creates a consumer writing to client.
+func newClickHouseConsumer(c fetcher, client *clickhouse.Client, batchSize int, maxWait time.Duration, logger zerolog.Logger) *clickhouseConsumer {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	if maxWait <= 0 {
+		maxWait = defaultFetchMaxWait
+	}
+	return &clickhouseConsumer{
+		consumer:  c,
+		client:    client,
+		batchSize: batchSize,
+		maxWait:   maxWait,
+		logger:    logger,
+	}
+}
+
+// run fetches and writes batches until ctx is done. A fetch in progress is
+// finished and its batch written in writeCtx before run returns.
+func (c *clickhouseConsumer) run(ctx, writeCtx context.Context) {
+	for ctx.Err() == nil {
+		if err := c.fetch(writeCtx); err != nil {
+			consumer.ConsumeErrors.WithLabelValues("fetch").Inc()
+			c.logger.Warn().Err(err).Msg("failed to fetch messages")
+			select {
+			case <-ctx.Done():
+			case <-time.After(fetchRetryDelay):
+			}
+		}
+	}
+}
+
+// fetch fetches one batch and writes it. Messages received before the
+// fetch failed are still written.
+func (c *clickhouseConsumer) fetch(ctx context.Context) error {
+	batch, err := c.consumer.Fetch(c.batchSize, jetstream.FetchMaxWait(c.maxWait))
+	if err != nil {
+		return err
+	}
+
+	rows := c.client.NewBatch()
+	var pending []pendingMessage
+	for msg := range batch.Messages() {
+		m, ok := c.decode(msg)
+		if !ok {
+			continue
+		}
+		if err := store.StoreEvent(ctx, rows, m.eventType, m.event); err != nil {
+			// Building rows does not touch ClickHouse, so it fails the
+			// same way on every delivery
+			rejectFailed(m, consumer.Permanent(fmt.Errorf("failed to store event: %w", err)), c.logger)
+			continue
+		}
+		pending = append(pending, m)
+	}
+	c.write(ctx, rows, pending)
+
+	// A batch that did not fill within maxWait ends without an error
+	return batch.Error()
+}
+
+// decode decodes a fetched message, returning it if it is to be written.
+func (c *clickhouseConsumer) decode(msg jetstream.Msg) (pendingMessage, bool) {
+	msg, ok := receiveMessage(msg, c.logger)
+	if !ok {
+		return pendingMessage{}, false
+	}
+	decoded, err := processor.Decode(msg, c.logger)
+	var pending *pendingMessage
+	if decoded != nil {
+		pending = &pendingMessage{
+			msg:         decoded.Msg,
+			eventType:   decoded.EventType,
+			event:       decoded.Event,
+			quarantined: decoded.Quarantine != nil,
+		}
+	}
+	m, ok := settleProcessed(msg, pending, err, c.logger)
+	if ok && m.quarantined {
+		rejectFailed(m, consumer.Permanent(fmt.Errorf("malformed %s event", m.eventType)), c.logger)
+		return pendingMessage{}, false
+	}
+	return m, ok
+}
+
+// write flushes the rows of the pending messages, then settles them.
+func (c *clickhouseConsumer) write(ctx context.Context, rows *clickhouse.Batch, pending []pendingMessage) {
+	if len(pending) == 0 {
+		return
+	}
+
+	stop := keepInProgress(ctx, pendingMsgs(pending), c.logger)
+	start := time.Now()
+	err := rows.Flush(ctx)
+	stop()
+	consumer.FlushDuration.Observe(time.Since(start).Seconds())
+	consumer.FlushSize.Observe(float64(len(pending)))
+	if err != nil {
+		consumer.ConsumeErrors.WithLabelValues("flush").Inc()
+		c.logger.Warn().
+			Err(err).
+			Int("messages", len(pending)).
+			Msg("batch flush failed, rejecting the batch")
+		for _, m := range pending {
+			rejectFailed(m, err, c.logger)
+		}
+		return
+	}
+	for _, m := range pending {
+		ackStored(m, c.logger)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/clickhouse"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestParseBackend tests that postgres is the default storage backend and
+// that unknown backends are rejected.
+func TestParseBackend(t *testing.T) {
+	for input, want := range map[string]string{"": backendPostgres, "postgres": backendPostgres, "clickhouse": backendClickHouse} {
+		backend, err := parseBackend(input)
+		require.NoError(t, err)
+		require.Equal(t, want, backend)
+	}
+	_, err := parseBackend("mysql")
+	require.Error(t, err)
+}
+
+// fakeClickHouse records the queries sent to it, failing them while down.
+type fakeClickHouse struct {
+	mu      sync.Mutex
+	down    bool
+	queries []string
+}
+
+func (f *fakeClickHouse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		http.Error(w, "Code: 242. DB::Exception: Table is in readonly mode", http.StatusInternalServerError)
+		return
+	}
+	f.queries = append(f.queries, r.URL.Query().Get("query"))
+}
+
+// testClickHouseClient returns a client of a fake ClickHouse server.
+func testClickHouseClient(t *testing.T, f *fakeClickHouse) *clickhouse.Client {
+	t.Helper()
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	client, err := clickhouse.NewClient(clickhouse.Config{URL: server.URL})
+	require.NoError(t, err)
+	return client
+}
+
+// TestClickHouseConsumerWritesFetchedBatches tests that the rows of a
+// fetched batch are inserted with one insert per table and the batch
+// acknowledged after them, that malformed events are rejected, and that a
+// batch whose inserts fail is redelivered as a whole.
+func TestClickHouseConsumerWritesFetchedBatches(t *testing.T) {
+	event := func(name string, logIndex uint, payload any) models.Event {
+		return models.Event{EventName: name, TxHash: storetest.TxHash, LogIndex: logIndex, Success: true, Payload: payload}
+	}
+	malformedFill := storetest.Payloads[events.OrderFilled].(models.OrderFilled)
+	malformedFill.Maker = ""
+
+	fill := eventMsg(t, event(events.OrderFilled, 0, storetest.Payloads[events.OrderFilled]))
+	transfer := eventMsg(t, event(events.TransferSingle, 1, storetest.Payloads[events.TransferSingle]))
+	cancelled := eventMsg(t, cancelledEvent(2))
+	malformed := eventMsg(t, event(events.OrderFilled, 3, malformedFill))
+	unwritten := eventMsg(t, event(events.OrderFilled, 4, storetest.Payloads[events.OrderFilled]))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := &fakeFetcher{
+		batches: [][]jetstream.Msg{{fill, transfer, cancelled, malformed}},
+		stop:    cancel,
+	}
+	server := &fakeClickHouse{}
+	c := newClickHouseConsumer(f, testClickHouseClient(t, server), 50, 10*time.Millisecond, zerolog.Nop())
+	c.run(ctx, context.Background())
+
+	require.Equal(t, []string{
+		"INSERT INTO order_fills FORMAT JSONEachRow",
+		"INSERT INTO token_transfers FORMAT JSONEachRow",
+	}, server.queries)
+	for _, msg := range []*fakeMsg{fill, transfer, cancelled} {
+		require.Equal(t, 1, msg.acks, msg.subject)
+	}
+	require.Zero(t, malformed.acks)
+	require.Equal(t, 1, malformed.terms)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	f = &fakeFetcher{batches: [][]jetstream.Msg{{unwritten}}, stop: cancel}
+	server.down = true
+	c = newClickHouseConsumer(f, testClickHouseClient(t, server), 50, 10*time.Millisecond, zerolog.Nop())
+	c.run(ctx, context.Background())
+
+	require.Zero(t, unwritten.acks)
+	require.Equal(t, 1, unwritten.naks)
+}
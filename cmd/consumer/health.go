@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+)
+
+const (
+	// defaultHealthAddress is the default address of the health server
+	defaultHealthAddress = ":8081"
+
+	// defaultHealthTimeout bounds the database ping and consumer info read
+	// of a health check
+	defaultHealthTimeout = 2 * time.Second
+
+	// defaultReadyMaxPending is the default number of pending messages
+	// above which the consumer reports itself not ready
+	defaultReadyMaxPending = 10000
+)
+
+// storeProgress tracks the messages the consumer stored, for the health
+// endpoints.
+type storeProgress struct {
+	mu           sync.Mutex
+	lastSequence uint64
+	lastStored   time.Time
+	stored       map[string]uint64
+}
+
+// progress is the store progress of this process.
+var progress = &storeProgress{stored: make(map[string]uint64)}
+
+// record counts a stored message of eventType at stream sequence seq (zero
+// when it is not known). Workers store out of stream order, so the last
+// sequence is the highest stored. An empty eventType (quarantined
+// messages) only advances the sequence.
+func (p *storeProgress) record(eventType string, seq uint64, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if seq > p.lastSequence {
+		p.lastSequence = seq
+	}
+	if eventType == "" {
+		return
+	}
+	p.lastStored = now
+	p.stored[eventType]++
+}
+
+// snapshot returns the last stored sequence, when a message was last
+// stored and a copy of the counts per event type.
+func (p *storeProgress) snapshot() (uint64, time.Time, map[string]uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stored := make(map[string]uint64, len(p.stored))
+	for eventType, n := range p.stored {
+		stored[eventType] = n
+	}
+	return p.lastSequence, p.lastStored, stored
+}
+
+// natsConn reports the NATS connection state (implemented by nats.Conn).
+type natsConn interface {
+	IsConnected() bool
+}
+
+// leadership reports whether this replica is the leader (implemented by
+// leaderElection).
+type leadership interface {
+	isLeader() bool
+}
+
+// pinger checks the database connection (implemented by pgxpool.Pool).
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// healthStatus is the JSON body of the health endpoints.
+type healthStatus struct {
+	Status             string            `json:"status"`
+	NATSConnected      bool              `json:"nats_connected"`
+	Database           string            `json:"database"`
+	Pending            *uint64           `json:"pending,omitempty"`
+	AckPending         *int              `json:"ack_pending,omitempty"`
+	MaxPending         uint64            `json:"max_pending,omitempty"`
+	ConsumerInfo       string            `json:"consumer_info,omitempty"`
+	Role               string            `json:"role,omitempty"`
+	LastStreamSequence uint64            `json:"last_stream_sequence"`
+	LastStoredAt       *time.Time        `json:"last_stored_at,omitempty"`
+	EventsStored       map[string]uint64 `json:"events_stored"`
+}
+
+// healthChecker serves /healthz and /readyz. The consumer is healthy while
+// NATS is connected and the database answers a ping within timeout, and
+// ready while it is healthy and its pending messages stay below maxPending
+// (0 = no threshold). With leader election, the status also reports the
+// replica's role; standbys are healthy and ready, to take over at once.
+type healthChecker struct {
+	nc         natsConn
+	db         pinger
+	consumer   consumer.ConsumerInfo
+	progress   *storeProgress
+	timeout    time.Duration
+	maxPending uint64
+	leadership leadership
+}
+
+// newHealthChecker creates a health checker.
+func newHealthChecker(nc natsConn, db pinger, c consumer.ConsumerInfo, timeout time.Duration, maxPending uint64) *healthChecker {
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	return &healthChecker{
+		nc:         nc,
+		db:         db,
+		consumer:   c,
+		progress:   progress,
+		timeout:    timeout,
+		maxPending: maxPending,
+	}
+}
+
+// handler returns the health server's handler.
+func (h *healthChecker) handler() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, false)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, true)
+	})
+	return mux
+}
+
+// serve writes the consumer's status, with 503 Service Unavailable if it is
+// not healthy, or not ready when ready is set.
+func (h *healthChecker) serve(w http.ResponseWriter, r *http.Request, ready bool) {
+	status, ok := h.check(r.Context(), ready)
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// check runs the checks of an endpoint and reports whether they passed.
+// The consumer's pending messages are read for both endpoints, but only
+// /readyz requires them.
+func (h *healthChecker) check(ctx context.Context, ready bool) (healthStatus, bool) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	status := healthStatus{
+		NATSConnected: h.nc.IsConnected(),
+		Database:      "ok",
+		MaxPending:    h.maxPending,
+	}
+	ok := status.NATSConnected
+	if err := h.db.Ping(ctx); err != nil {
+		status.Database = err.Error()
+		ok = false
+	}
+
+	info, err := h.consumer.Info(ctx)
+	if err != nil {
+		status.ConsumerInfo = err.Error()
+		if ready {
+			ok = false
+		}
+	} else {
+		status.Pending = &info.NumPending
+		status.AckPending = &info.NumAckPending
+		if ready && h.maxPending > 0 && info.NumPending >= h.maxPending {
+			ok = false
+		}
+	}
+
+	if h.leadership != nil {
+		status.Role = "standby"
+		if h.leadership.isLeader() {
+			status.Role = "leader"
+		}
+	}
+
+	var lastStored time.Time
+	status.LastStreamSequence, lastStored, status.EventsStored = h.progress.snapshot()
+	if !lastStored.IsZero() {
+		status.LastStoredAt = &lastStored
+	}
+
+	status.Status = "ok"
+	if !ok {
+		status.Status = "unavailable"
+	}
+	return status, ok
+}
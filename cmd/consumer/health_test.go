@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConn is a NATS connection in a fixed state.
+type fakeConn struct{ connected bool }
+
+func (c *fakeConn) IsConnected() bool { return c.connected }
+
+// fakePinger is a database answering pings with err, or blocking until the
+// ping's context is done when hang is set.
+type fakePinger struct {
+	err  error
+	hang bool
+}
+
+func (p *fakePinger) Ping(ctx context.Context) error {
+	if p.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return p.err
+}
+
+// fakeInfo reports a fixed consumer state, or an error.
+type fakeInfo struct {
+	info *jetstream.ConsumerInfo
+	err  error
+}
+
+func (f *fakeInfo) Info(context.Context) (*jetstream.ConsumerInfo, error) {
+	return f.info, f.err
+}
+
+// getHealth requests path from h and decodes the returned status.
+func getHealth(t *testing.T, h *healthChecker, path string) (int, healthStatus) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var status healthStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	return rec.Code, status
+}
+
+// TestHealthEndpoints tests that /healthz follows NATS and the database,
+// and that /readyz also requires the pending messages below the threshold.
+func TestHealthEndpoints(t *testing.T) {
+	conn := &fakeConn{connected: true}
+	db := &fakePinger{}
+	info := &fakeInfo{info: &jetstream.ConsumerInfo{NumPending: 50, NumAckPending: 3}}
+	h := newHealthChecker(conn, db, info, time.Second, 100)
+	h.progress = &storeProgress{stored: make(map[string]uint64)}
+
+	code, status := getHealth(t, h, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok", status.Status)
+	code, status = getHealth(t, h, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, uint64(50), *status.Pending)
+	require.Equal(t, 3, *status.AckPending)
+
+	// A backlog makes the consumer unready but not unhealthy
+	info.info.NumPending = 100
+	code, _ = getHealth(t, h, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+	code, status = getHealth(t, h, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "unavailable", status.Status)
+
+	// So does a consumer whose state cannot be read
+	info.info.NumPending = 0
+	info.err = errors.New("nats: timeout")
+	code, _ = getHealth(t, h, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+	code, status = getHealth(t, h, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "nats: timeout", status.ConsumerInfo)
+	require.Nil(t, status.Pending)
+	info.err = nil
+
+	conn.connected = false
+	code, status = getHealth(t, h, "/healthz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.False(t, status.NATSConnected)
+	conn.connected = true
+
+	db.err = errors.New("connection refused")
+	for _, path := range []string{"/healthz", "/readyz"} {
+		code, status = getHealth(t, h, path)
+		require.Equal(t, http.StatusServiceUnavailable, code, path)
+		require.Equal(t, "connection refused", status.Database, path)
+	}
+}
+
+// TestHealthPingTimeout tests that a database not answering fails the check
+// once the timeout expires.
+func TestHealthPingTimeout(t *testing.T) {
+	info := &fakeInfo{info: &jetstream.ConsumerInfo{}}
+	h := newHealthChecker(&fakeConn{connected: true}, &fakePinger{hang: true}, info, 20*time.Millisecond, 0)
+
+	start := time.Now()
+	code, status := getHealth(t, h, "/healthz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, context.DeadlineExceeded.Error(), status.Database)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+// TestHealthNoPendingThreshold tests that a zero threshold disables the
+// backlog check.
+func TestHealthNoPendingThreshold(t *testing.T) {
+	info := &fakeInfo{info: &jetstream.ConsumerInfo{NumPending: 1 << 40}}
+	h := newHealthChecker(&fakeConn{connected: true}, &fakePinger{}, info, time.Second, 0)
+
+	code, _ := getHealth(t, h, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+}
+
+// TestHealthProgress tests that the status reports the highest stored
+// stream sequence and the stored messages by event type.
+func TestHealthProgress(t *testing.T) {
+	info := &fakeInfo{info: &jetstream.ConsumerInfo{}}
+	h := newHealthChecker(&fakeConn{connected: true}, &fakePinger{}, info, time.Second, 0)
+	h.progress = &storeProgress{stored: make(map[string]uint64)}
+
+	_, status := getHealth(t, h, "/healthz")
+	require.Zero(t, status.LastStreamSequence)
+	require.Nil(t, status.LastStoredAt)
+	require.Empty(t, status.EventsStored)
+
+	storedAt := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	h.progress.record("OrderFilled", 12, storedAt)
+	h.progress.record("OrderFilled", 11, storedAt)
+	h.progress.record("TransferSingle", 0, storedAt)
+
+	_, status = getHealth(t, h, "/healthz")
+	require.Equal(t, uint64(12), status.LastStreamSequence)
+	require.True(t, storedAt.Equal(*status.LastStoredAt))
+	require.Equal(t, map[string]uint64{"OrderFilled": 2, "TransferSingle": 1}, status.EventsStored)
+}
+
+// TestStoredRecordsProgress tests that acknowledging a stored message
+// records its stream sequence and event type, and that messages without
+// metadata are still counted.
+func TestStoredRecordsProgress(t *testing.T) {
+	w := newBatchWriter(&fakeDB{}, 1, zerolog.Nop())
+	before, _, counts := progress.snapshot()
+
+	m, msg := testPending("INSERT INTO events (a) VALUES (1)")
+	msg.sequence = before + 1000
+	w.stored(m)
+	seq, _, stored := progress.snapshot()
+	require.Equal(t, before+1000, seq)
+	require.Equal(t, counts[m.eventType]+1, stored[m.eventType])
+
+	m, msg = testPending("INSERT INTO events (a) VALUES (2)")
+	msg.delivered = 0
+	w.stored(m)
+	seq, _, stored = progress.snapshot()
+	require.Equal(t, before+1000, seq)
+	require.Equal(t, counts[m.eventType]+2, stored[m.eventType])
+}
+
+// fakeLeadership is a replica with a fixed role.
+type fakeLeadership struct{ leader bool }
+
+func (l *fakeLeadership) isLeader() bool { return l.leader }
+
+// TestHealthRole tests that the role is reported only with leader election,
+// and that standbys are still ready.
+func TestHealthRole(t *testing.T) {
+	info := &fakeInfo{info: &jetstream.ConsumerInfo{}}
+	h := newHealthChecker(&fakeConn{connected: true}, &fakePinger{}, info, time.Second, 0)
+
+	_, status := getHealth(t, h, "/readyz")
+	require.Empty(t, status.Role)
+
+	l := &fakeLeadership{}
+	h.leadership = l
+	code, status := getHealth(t, h, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "standby", status.Role)
+
+	l.leader = true
+	_, status = getHealth(t, h, "/readyz")
+	require.Equal(t, "leader", status.Role)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+)
+
+// defaultAckWait is the default time JetStream waits for an acknowledgment
+// before redelivering a message
+const defaultAckWait = 30 * time.Second
+
+// ackWait is the ack wait of the consumer (consumer.ack_wait). Messages
+// being written are sent an in-progress acknowledgment every third of it.
+var ackWait = defaultAckWait
+
+// keepInProgress sends an in-progress acknowledgment to msgs every third of
+// the ack wait until the returned stop is called or ctx is done, so
+// JetStream does not redeliver messages whose write outlives the ack wait
+// (a database failover, a large flush) while it is still running. A write
+// still running after two thirds of the ack wait is logged once. stop waits
+// for the last acknowledgment to be sent and may be called more than once.
+func keepInProgress(ctx context.Context, msgs []jetstream.Msg, logger zerolog.Logger) (stop func()) {
+	interval := ackWait / 3
+	if len(msgs) == 0 || interval <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		warned := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, msg := range msgs {
+				if err := msg.InProgress(); err != nil {
+					// Redelivered after the ack wait if it is still not
+					// settled, which is idempotent
+					logger.Debug().Err(err).Str("subject", msg.Subject()).Msg("failed to send in-progress acknowledgment")
+					continue
+				}
+				consumer.InProgressSent.Inc()
+			}
+			if elapsed := time.Since(start); !warned && elapsed >= 2*interval {
+				warned = true
+				consumer.SlowFlushes.Inc()
+				logger.Warn().
+					Dur("elapsed", elapsed).
+					Dur("ack_wait", ackWait).
+					Int("messages", len(msgs)).
+					Msg("write is approaching the ack wait, keeping its messages in progress")
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+}
+
+// pendingMsgs returns the messages of pending.
+func pendingMsgs(pending []pendingMessage) []jetstream.Msg {
+	msgs := make([]jetstream.Msg, len(pending))
+	for i, m := range pending {
+		msgs[i] = m.msg
+	}
+	return msgs
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+)
+
+// withAckWait sets the ack wait for the duration of a test.
+func withAckWait(t *testing.T, d time.Duration) {
+	t.Helper()
+	previous := ackWait
+	ackWait = d
+	t.Cleanup(func() { ackWait = previous })
+}
+
+// TestKeepInProgress tests that every message is sent an in-progress
+// acknowledgment every third of the ack wait until stopped, and that a
+// write reaching two thirds of the ack wait is counted once.
+func TestKeepInProgress(t *testing.T) {
+	withAckWait(t, 30*time.Millisecond)
+	a, b := &fakeMsg{subject: "a"}, &fakeMsg{subject: "b"}
+	slow := testutil.ToFloat64(consumer.SlowFlushes)
+
+	stop := keepInProgress(context.Background(), []jetstream.Msg{a, b}, zerolog.Nop())
+	require.Eventually(t, func() bool { return b.inProgress.Load() >= 3 }, time.Second, time.Millisecond)
+	stop()
+	stop()
+
+	sent := a.inProgress.Load()
+	require.GreaterOrEqual(t, sent, int32(3))
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(t, sent, a.inProgress.Load(), "nothing sent once stopped")
+	require.Equal(t, slow+1, testutil.ToFloat64(consumer.SlowFlushes))
+}
+
+// TestKeepInProgressStopsWithContext tests that the acknowledgments end
+// with the context of the write.
+func TestKeepInProgressStopsWithContext(t *testing.T) {
+	withAckWait(t, 30*time.Millisecond)
+	msg := &fakeMsg{subject: "a"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := keepInProgress(ctx, []jetstream.Msg{msg}, zerolog.Nop())
+	defer stop()
+	require.Eventually(t, func() bool { return msg.inProgress.Load() >= 1 }, time.Second, time.Millisecond)
+	cancel()
+
+	time.Sleep(5 * time.Millisecond)
+	sent := msg.inProgress.Load()
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(t, sent, msg.inProgress.Load())
+}
+
+// TestBatchWriterKeepsSlowFlushInProgress tests that the messages of a
+// flush outliving a third of the ack wait are kept in progress until they
+// are acknowledged, and that fast flushes send nothing.
+func TestBatchWriterKeepsSlowFlushInProgress(t *testing.T) {
+	withAckWait(t, 30*time.Millisecond)
+	db := &fakeDB{commitDelay: 50 * time.Millisecond}
+	w := newBatchWriter(db, 10, zerolog.Nop())
+
+	m, msg := testPending("INSERT a")
+	w.add(context.Background(), m)
+	w.flush(context.Background())
+	require.Equal(t, 1, msg.acks)
+	require.GreaterOrEqual(t, msg.inProgress.Load(), int32(1))
+
+	db.commitDelay = 0
+	m, msg = testPending("INSERT b")
+	w.add(context.Background(), m)
+	w.flush(context.Background())
+	require.Equal(t, 1, msg.acks)
+	require.Zero(t, msg.inProgress.Load())
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+var holderSnapshotRows = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "polymarket_holder_snapshot_rows_total",
+	Help: "Total number of holder balances recorded in holder_snapshots for resolved conditions",
+})
+
+const (
+	// holderPollInterval is how often the snapshotter looks for resolved
+	// conditions when no resolution woke it
+	holderPollInterval = time.Minute
+
+	// holderBatchSize bounds the conditions read per query
+	holderBatchSize = 100
+
+	// pendingHolderSnapshotsQuery returns resolved conditions whose holders
+	// have not been recorded, oldest resolution first
+	pendingHolderSnapshotsQuery = `
+		SELECT condition_id
+		FROM conditions
+		WHERE holders_snapshot_pending
+		ORDER BY resolution_block
+		LIMIT $1
+	`
+
+	// snapshotHolders records the holders of both outcome tokens of
+	// condition $1 and clears its pending flag, returning the holders
+	// recorded. A condition that is no longer pending records nothing.
+	snapshotHolders = `
+		WITH holders AS (
+			SELECT b.token_id, b.wallet, b.balance, b.last_block
+			FROM tokens t
+			JOIN balances b ON b.token_id = t.token_id
+			WHERE t.condition_id = $1 AND b.balance > 0
+		), snapshot AS (
+			UPDATE conditions
+			SET holders_snapshot_pending = false
+			WHERE condition_id = $1 AND holders_snapshot_pending
+			RETURNING GREATEST(resolution_block, (SELECT MAX(last_block) FROM holders)) AS block
+		), inserted AS (
+			INSERT INTO holder_snapshots (condition_id, token_id, wallet, balance, snapshot_block)
+			SELECT $1, h.token_id, h.wallet, h.balance, s.block
+			FROM holders h, snapshot s
+			ON CONFLICT (condition_id, token_id, wallet) DO NOTHING
+			RETURNING 1
+		)
+		SELECT COUNT(*) FROM inserted
+	`
+)
+
+// holderSnapshots is the running holder snapshotter, nil when it is not
+// started. Stored resolutions wake it.
+var holderSnapshots *holderSnapshotter
+
+// holderSnapshotter records the holders of the outcome tokens of resolved
+// conditions in holder_snapshots. It runs apart from the batch writer, so
+// snapshotting a widely held market never holds back consumption.
+type holderSnapshotter struct {
+	db     enricherDB
+	wake   chan struct{}
+	logger zerolog.Logger
+}
+
+// newHolderSnapshotter creates a snapshotter writing to db.
+func newHolderSnapshotter(db enricherDB, logger zerolog.Logger) *holderSnapshotter {
+	return &holderSnapshotter{
+		db:     db,
+		wake:   make(chan struct{}, 1),
+		logger: logger.With().Str("component", "holder_snapshotter").Logger(),
+	}
+}
+
+// notify wakes the snapshotter after a resolution was stored. It never
+// blocks; wakes arriving during a pass are folded into one.
+func (s *holderSnapshotter) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// notifyResolved is the observer of stored resolutions.
+func notifyResolved(pgconn.CommandTag) {
+	if holderSnapshots != nil {
+		holderSnapshots.notify()
+	}
+}
+
+// run snapshots pending conditions when woken and every poll interval
+// until ctx is cancelled.
+func (s *holderSnapshotter) run(ctx context.Context, poll time.Duration) {
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.snapshotPending(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Warn().Err(err).Msg("failed to snapshot holders")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshotPending snapshots every pending condition and returns how many
+// it snapshotted, stopping at the first that fails.
+func (s *holderSnapshotter) snapshotPending(ctx context.Context) (int, error) {
+	var snapshotted int
+	for {
+		conditions, err := s.pending(ctx)
+		if err != nil {
+			return snapshotted, err
+		}
+		for _, conditionID := range conditions {
+			if err := s.snapshot(ctx, conditionID); err != nil {
+				return snapshotted, err
+			}
+			snapshotted++
+		}
+		if len(conditions) < holderBatchSize {
+			return snapshotted, nil
+		}
+	}
+}
+
+// pending returns a batch of conditions to snapshot.
+func (s *holderSnapshotter) pending(ctx context.Context) ([]string, error) {
+	rows, err := s.db.Query(ctx, pendingHolderSnapshotsQuery, holderBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending holder snapshots: %w", err)
+	}
+	conditions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending holder snapshots: %w", err)
+	}
+	return conditions, nil
+}
+
+// snapshot records the current holders of a condition.
+func (s *holderSnapshotter) snapshot(ctx context.Context, conditionID string) error {
+	rows, err := s.db.Query(ctx, snapshotHolders, conditionID)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot holders of %s: %w", conditionID, err)
+	}
+	holders, err := pgx.CollectExactlyOneRow(rows, pgx.RowTo[int64])
+	if err != nil {
+		return fmt.Errorf("failed to snapshot holders of %s: %w", conditionID, err)
+	}
+	holderSnapshotRows.Add(float64(holders))
+	s.logger.Debug().Str("condition_id", conditionID).Int64("holders", holders).Msg("snapshotted holders")
+	return nil
+}
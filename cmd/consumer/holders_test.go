@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/postgres"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestStoreConditionResolutionWakesSnapshotter tests that a stored
+// resolution wakes the holder snapshotter once it is committed, without
+// blocking when it is already awake.
+func TestStoreConditionResolutionWakesSnapshotter(t *testing.T) {
+	snapshotter := newHolderSnapshotter(nil, zerolog.Nop())
+	holderSnapshots = snapshotter
+	t.Cleanup(func() { holderSnapshots = nil })
+
+	var recorder postgres.Recorder
+	require.NoError(t, postgresStore(&recorder, zerolog.Nop()).StoreConditionResolution(context.Background(), storetest.ResolutionEvent(0)))
+	require.Len(t, recorder.Statements, 3)
+	require.Contains(t, recorder.Statements[1].Query, "holders_snapshot_pending")
+	require.Empty(t, snapshotter.wake)
+
+	observe := recorder.Statements[1].Observe
+	require.NotNil(t, observe)
+	observe(pgconn.NewCommandTag("INSERT 0 1"))
+	observe(pgconn.NewCommandTag("INSERT 0 1"))
+	require.Len(t, snapshotter.wake, 1)
+}
+
+// TestHolderSnapshotterAgainstPostgres tests against Postgres that the
+// holders of both outcome tokens of a resolved condition are recorded once,
+// that a redelivered resolution is not snapshotted again and that a
+// reverted resolution removes its snapshot.
+func TestHolderSnapshotterAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	conditionID := "0x" + strings.Repeat("0d", 32)
+	registered := models.Event{
+		Block:     90,
+		TxHash:    "0x" + strings.Repeat("a0", 32),
+		EventName: events.TokenRegistered,
+		Success:   true,
+		Payload: models.TokenRegistered{
+			Token0:      big.NewInt(1001),
+			Token1:      big.NewInt(1002),
+			ConditionID: conditionID,
+		},
+	}
+	require.NoError(t, storeEvent(ctx, pool, events.TokenRegistered, registered))
+
+	var (
+		zero  = "0x0000000000000000000000000000000000000000"
+		alice = "0x1111111111111111111111111111111111111111"
+		bob   = "0x2222222222222222222222222222222222222222"
+		carol = "0x3333333333333333333333333333333333333333"
+	)
+	for i, transfer := range []models.Event{
+		storetest.TransferEvent(0, zero, alice, 1001, 100),
+		storetest.TransferEvent(1, alice, bob, 1001, 40),
+		storetest.TransferEvent(2, zero, carol, 1002, 70),
+		storetest.TransferEvent(3, carol, zero, 1002, 70), // redeemed before resolution, no longer a holder
+		storetest.TransferEvent(4, zero, bob, 1002, 25),
+		storetest.TransferEvent(5, zero, carol, 9999, 10), // another condition's token
+	} {
+		require.NoError(t, storeEvent(ctx, pool, events.TransferSingle, transfer), i)
+	}
+
+	snapshotter := newHolderSnapshotter(pool, logger)
+	snapshotted, err := snapshotter.snapshotPending(ctx)
+	require.NoError(t, err)
+	require.Zero(t, snapshotted, "nothing resolved yet")
+
+	resolution := storetest.ResolutionEvent(0)
+	require.NoError(t, storeEvent(ctx, pool, events.ConditionResolution, resolution))
+	snapshotted, err = snapshotter.snapshotPending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, snapshotted)
+
+	holders := func() map[string]string {
+		rows, err := pool.Query(ctx, `
+			SELECT token_id::TEXT, wallet, balance::TEXT, snapshot_block
+			FROM holder_snapshots WHERE condition_id = $1`, conditionID)
+		require.NoError(t, err)
+		defer rows.Close()
+		out := map[string]string{}
+		for rows.Next() {
+			var token, wallet, balance string
+			var block int64
+			require.NoError(t, rows.Scan(&token, &wallet, &balance, &block))
+			require.Equal(t, int64(resolution.Block), block, "balances last changed before the resolution")
+			out[token+" "+wallet] = balance
+		}
+		require.NoError(t, rows.Err())
+		return out
+	}
+	want := map[string]string{
+		"1001 " + alice: "60",
+		"1001 " + bob:   "40",
+		"1002 " + bob:   "25",
+	}
+	require.Equal(t, want, holders())
+
+	// A redelivered resolution leaves the snapshot as it was
+	require.NoError(t, storeEvent(ctx, pool, events.TransferSingle, storetest.TransferEvent(6, zero, carol, 1001, 5)))
+	require.NoError(t, storeEvent(ctx, pool, events.ConditionResolution, resolution))
+	snapshotted, err = snapshotter.snapshotPending(ctx)
+	require.NoError(t, err)
+	require.Zero(t, snapshotted)
+	require.Equal(t, want, holders())
+
+	reversals, err := postgresStore(pool, logger).Reversals(events.ConditionResolution, resolution)
+	require.NoError(t, err)
+	for _, s := range reversals {
+		_, err := pool.Exec(ctx, s.Query, s.Args...)
+		require.NoError(t, err)
+	}
+	require.Empty(t, holders())
+}
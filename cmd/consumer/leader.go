@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+)
+
+// defaultLeaderRetryInterval is the default interval between two attempts
+// of a standby to take the leader lock, and between two checks of the
+// leader that it still holds it.
+const defaultLeaderRetryInterval = 5 * time.Second
+
+// leaderElection makes one of the consumer replicas sharing a durable
+// consumer the only one consuming. Consumers sharing a durable compete per
+// message, which would interleave batches and break the per-contract order
+// of derived table updates.
+//
+// Leadership is a session advisory lock held on a connection of its own:
+// it is released when the leader shuts down, and by Postgres when the
+// leader's session ends, so a standby takes over within the retry interval
+// of the leader dying. TCP keepalives on the lock session bound how long a
+// vanished leader host keeps it.
+type leaderElection struct {
+	connect  func(ctx context.Context) (*pgx.Conn, error)
+	key      int64
+	interval time.Duration
+	logger   zerolog.Logger
+
+	mu     sync.Mutex
+	conn   *pgx.Conn
+	leader atomic.Bool
+}
+
+// leaderLockKey returns the advisory lock key of the replicas of a durable
+// consumer.
+func leaderLockKey(consumerName string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("polymarket-consumer-leader:" + consumerName))
+	return int64(h.Sum64())
+}
+
+// newLeaderElection creates the election of the replicas of a durable
+// consumer, connecting its lock sessions with connect.
+func newLeaderElection(connect func(ctx context.Context) (*pgx.Conn, error), consumerName string, interval time.Duration, logger zerolog.Logger) *leaderElection {
+	if interval <= 0 {
+		interval = defaultLeaderRetryInterval
+	}
+	return &leaderElection{
+		connect:  connect,
+		key:      leaderLockKey(consumerName),
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// isLeader reports whether this replica holds the leader lock.
+func (l *leaderElection) isLeader() bool {
+	return l.leader.Load()
+}
+
+// acquire blocks as a standby until this replica holds the leader lock, or
+// ctx is done.
+func (l *leaderElection) acquire(ctx context.Context) error {
+	consumer.Leader.Set(0)
+	standby := false
+	for {
+		ok, err := l.tryAcquire(ctx)
+		if err != nil {
+			consumer.ConsumeErrors.WithLabelValues("leader_election").Inc()
+			l.logger.Warn().Err(err).Msg("failed to try the leader lock")
+		}
+		if ok {
+			l.leader.Store(true)
+			consumer.Leader.Set(1)
+			l.logger.Info().Int64("lock_key", l.key).Msg("elected leader, consuming")
+			return nil
+		}
+		if !standby {
+			standby = true
+			l.logger.Info().
+				Int64("lock_key", l.key).
+				Dur("retry_interval", l.interval).
+				Msg("another replica is leader, standing by")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.interval):
+		}
+	}
+}
+
+// tryAcquire takes the leader lock in a new session if it is free. The
+// session is kept while it holds the lock.
+func (l *leaderElection) tryAcquire(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.interval)
+	defer cancel()
+
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	// Postgres drops the session, and the lock with it, once the leader's
+	// host stops answering keepalives for about three intervals
+	seconds := max(int(l.interval.Seconds()), 1)
+	if _, err := conn.Exec(ctx, fmt.Sprintf(
+		"SET tcp_keepalives_idle = %d; SET tcp_keepalives_interval = %d; SET tcp_keepalives_count = 3",
+		seconds, seconds,
+	)); err != nil {
+		conn.Close(context.Background())
+		return false, fmt.Errorf("failed to set keepalives: %w", err)
+	}
+
+	var ok bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&ok); err != nil {
+		conn.Close(context.Background())
+		return false, fmt.Errorf("failed to try lock: %w", err)
+	}
+	if !ok {
+		conn.Close(context.Background())
+		return false, nil
+	}
+
+	l.mu.Lock()
+	l.conn = conn
+	l.mu.Unlock()
+	return true, nil
+}
+
+// hold checks every interval that the lock session is alive and returns
+// once it is lost, or nil when ctx is done. The leader must stop consuming
+// when it returns an error: a standby may already hold the lock.
+func (l *leaderElection) hold(ctx context.Context) error {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if err := l.check(ctx); err != nil {
+			consumer.ConsumeErrors.WithLabelValues("leader_election").Inc()
+			return err
+		}
+	}
+}
+
+// check pings the lock session, closing it if it is lost. The session is
+// locked meanwhile, as a pgx.Conn is not safe for concurrent use.
+func (l *leaderElection) check(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return fmt.Errorf("leader lock released")
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, l.interval)
+	defer cancel()
+	if _, err := l.conn.Exec(checkCtx, "SELECT 1"); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		l.conn.Close(context.Background())
+		l.conn = nil
+		l.leader.Store(false)
+		consumer.Leader.Set(0)
+		return fmt.Errorf("failed to check leader lock session: %w", err)
+	}
+	return nil
+}
+
+// release gives up the leader lock by closing its session, once the
+// messages consumed as leader are written.
+func (l *leaderElection) release(ctx context.Context) {
+	l.mu.Lock()
+	conn := l.conn
+	l.conn = nil
+	l.mu.Unlock()
+
+	l.leader.Store(false)
+	consumer.Leader.Set(0)
+	if conn != nil {
+		conn.Close(ctx)
+		l.logger.Info().Int64("lock_key", l.key).Msg("released leadership")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLeaderLockKey tests that the replicas of a durable consumer share a
+// lock key that other durables do not.
+func TestLeaderLockKey(t *testing.T) {
+	require.Equal(t, leaderLockKey("polymarket-consumer"), leaderLockKey("polymarket-consumer"))
+	require.NotEqual(t, leaderLockKey("polymarket-consumer"), leaderLockKey("polymarket-consumer-v2"))
+}
+
+// testElection returns an election of the durable consumer name whose lock
+// sessions connect to POSTGRES_TEST_URL, or skips the test.
+func testElection(t *testing.T, name string, interval time.Duration) *leaderElection {
+	t.Helper()
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL not set")
+	}
+	l := newLeaderElection(func(ctx context.Context) (*pgx.Conn, error) {
+		return pgx.Connect(ctx, url)
+	}, name, interval, zerolog.Nop())
+	t.Cleanup(func() { l.release(context.Background()) })
+	return l
+}
+
+// TestLeaderHandoverAgainstPostgres tests against Postgres that of two
+// replicas only one leads, that the standby takes over within a bounded
+// time once the leader's session dies, that the deposed leader notices,
+// and that a released lock is taken over as well.
+func TestLeaderHandoverAgainstPostgres(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	name := t.Name() + time.Now().Format(time.RFC3339Nano)
+	first := testElection(t, name, interval)
+	second := testElection(t, name, interval)
+	ctx := context.Background()
+
+	require.NoError(t, first.acquire(ctx))
+	require.True(t, first.isLeader())
+	held := make(chan error, 1)
+	go func() { held <- first.hold(ctx) }()
+
+	elected := make(chan error, 1)
+	go func() { elected <- second.acquire(ctx) }()
+	select {
+	case <-elected:
+		t.Fatal("standby elected while the leader holds the lock")
+	case <-time.After(5 * interval):
+	}
+	require.False(t, second.isLeader())
+
+	// The leader's session dies as with a crashed pod
+	first.mu.Lock()
+	pid := first.conn.PgConn().PID()
+	first.mu.Unlock()
+	admin, err := pgx.Connect(ctx, os.Getenv("POSTGRES_TEST_URL"))
+	require.NoError(t, err)
+	defer admin.Close(ctx)
+	_, err = admin.Exec(ctx, "SELECT pg_terminate_backend($1)", pid)
+	require.NoError(t, err)
+
+	start := time.Now()
+	select {
+	case err := <-elected:
+		require.NoError(t, err)
+	case <-time.After(10 * interval):
+		t.Fatal("standby not elected after the leader died")
+	}
+	require.Less(t, time.Since(start), 5*interval)
+	require.True(t, second.isLeader())
+
+	select {
+	case err := <-held:
+		require.Error(t, err)
+	case <-time.After(10 * interval):
+		t.Fatal("deposed leader did not notice")
+	}
+	require.False(t, first.isLeader())
+
+	// A graceful shutdown hands over as well
+	go func() { elected <- first.acquire(ctx) }()
+	second.release(ctx)
+	select {
+	case err := <-elected:
+		require.NoError(t, err)
+	case <-time.After(10 * interval):
+		t.Fatal("standby not elected after the leader released")
+	}
+	require.True(t, first.isLeader())
+	require.False(t, second.isLeader())
+}
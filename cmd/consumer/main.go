@@ -3,90 +3,246 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"math/big"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/gamma"
+	natspub "github.com/0xkanth/polymarket-indexer/internal/nats"
+	"github.com/0xkanth/polymarket-indexer/internal/store/clickhouse"
+	"github.com/0xkanth/polymarket-indexer/internal/store/migrations"
+	"github.com/0xkanth/polymarket-indexer/internal/store/postgres"
+	"github.com/0xkanth/polymarket-indexer/internal/store/retention"
 	"github.com/0xkanth/polymarket-indexer/internal/util"
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
 	"github.com/0xkanth/polymarket-indexer/pkg/models"
 )
 
-var (
-	eventsConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "polymarket_events_consumed_total",
-		Help: "Total number of events consumed from NATS",
-	}, []string{"event_type"})
-
-	eventsStored = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "polymarket_events_stored_total",
-		Help: "Total number of events stored in database",
-	}, []string{"event_type"})
-
-	consumeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "polymarket_consume_errors_total",
-		Help: "Total number of consume errors",
-	}, []string{"error_type"})
-
-	processingLag = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "polymarket_consumer_lag_seconds",
-		Help: "Time lag between event occurrence and processing",
-	})
-)
-
 const (
 	serviceName = "polymarket-consumer"
+
+	// consumerMaxAckPending bounds the messages delivered but not yet
+	// acknowledged, which includes every buffered message
+	consumerMaxAckPending = 1000
 )
 
+// storeConfig is the configuration events are stored with
+// (consumer.collateral_token, consumer.exchange_addresses and
+// consumer.candle_intervals).
+var storeConfig = postgres.Config{
+	Exchanges:       map[string]bool{},
+	CandleIntervals: postgres.DefaultCandleIntervals,
+	OnPrepared:      notifyPrepared,
+	OnResolved:      notifyResolved,
+}
+
+// processor decodes consumed messages of the schema versions this consumer
+// handles (consumer.schema_versions).
+var processor = consumer.NewProcessor(codec.SchemaV1)
+
 func main() {
+	configPath := flag.String("config", "config.toml", "path to the configuration file")
+	rebuild := flag.String("rebuild", "", "comma-separated derived tables to regenerate from the stored raw events, then exit")
+	backfill := flag.String("backfill", "", "comma-separated new derived tables to fill from the stored raw events, resumably, then exit")
+	fromBlock := flag.Uint64("from-block", 0, "first block replayed by -rebuild or -backfill")
+	toBlock := flag.Uint64("to-block", 0, "last block replayed by -rebuild or -backfill (0 for the last stored block)")
+	flag.Parse()
+
 	// Initialize logger
 	logger := util.InitLogger()
 	logger.Info().Msg("starting polymarket consumer")
 
 	// Load configuration
-	cfg := util.InitConfig(logger, "config.toml")
+	cfg := util.InitConfig(logger, *configPath)
 
 	// Update log level from config
 	util.UpdateLogLevel(cfg, logger)
 
-	// Connect to PostgreSQL
-	dbConfig := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		cfg.String("postgres.host"),
-		cfg.Int("postgres.port"),
-		cfg.String("postgres.user"),
-		cfg.String("postgres.password"),
-		cfg.String("postgres.database"),
-		cfg.String("postgres.sslmode"),
-	)
+	if token := cfg.String("consumer.collateral_token"); token != "" {
+		if !common.IsHexAddress(token) {
+			logger.Fatal().Str("collateral_token", token).Msg("invalid consumer.collateral_token")
+		}
+		storeConfig.CollateralToken = common.HexToAddress(token)
+	} else {
+		logger.Warn().Msg("consumer.collateral_token not set, tokens.outcome_index will be NULL")
+	}
+
+	for _, exchange := range cfg.Strings("consumer.exchange_addresses") {
+		if !common.IsHexAddress(exchange) {
+			logger.Fatal().Str("exchange_address", exchange).Msg("invalid consumer.exchange_addresses")
+		}
+		storeConfig.Exchanges[models.NormalizeAddress(exchange)] = true
+	}
+
+	if cfg.Exists("consumer.candle_intervals") {
+		intervals, err := parseCandleIntervals(cfg.Strings("consumer.candle_intervals"))
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid consumer.candle_intervals")
+		}
+		storeConfig.CandleIntervals = intervals
+	}
 
-	pool, err := pgxpool.New(context.Background(), dbConfig)
+	versions, err := codec.ParseSchemaVersions(cfg.Strings("consumer.schema_versions"))
 	if err != nil {
-		logger.Fatal().Err(err).Msg("failed to connect to database")
+		logger.Fatal().Err(err).Msg("invalid consumer.schema_versions")
 	}
-	defer pool.Close()
+	processor = consumer.NewProcessor(versions...)
+	logger.Info().Stringers("schema_versions", schemaStringers(versions)).Msg("accepting schema versions")
 
-	if err := pool.Ping(context.Background()); err != nil {
-		logger.Fatal().Err(err).Msg("failed to ping database")
+	backend, err := parseBackend(cfg.String("storage.backend"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid storage.backend")
+	}
+	workers := cfg.Int("consumer.workers")
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	// The ClickHouse backend only mirrors the tables analytics read, so it
+	// needs no Postgres connection, and the features built on Postgres
+	// tables are unavailable with it
+	var (
+		pool     *pgxpool.Pool
+		chClient *clickhouse.Client
+	)
+	if backend == backendPostgres {
+		// Connect to PostgreSQL
+		dbConfig := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+			cfg.String("postgres.host"),
+			cfg.Int("postgres.port"),
+			cfg.String("postgres.user"),
+			cfg.String("postgres.password"),
+			cfg.String("postgres.database"),
+			cfg.String("postgres.sslmode"),
+		)
+
+		// Each worker holds a connection of its own, the rest of the pool
+		// serves migrations, checks and the market enricher
+		poolConfig, err := pgxpool.ParseConfig(dbConfig)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid database configuration")
+		}
+		if minConns := int32(workers + 4); poolConfig.MaxConns < minConns {
+			poolConfig.MaxConns = minConns
+		}
+		pool, err = pgxpool.NewWithConfig(context.Background(), poolConfig)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to connect to database")
+		}
+		defer pool.Close()
+
+		if err := pool.Ping(context.Background()); err != nil {
+			logger.Fatal().Err(err).Msg("failed to ping database")
+		}
+		logger.Info().
+			Str("host", cfg.String("postgres.host")).
+			Str("database", cfg.String("postgres.database")).
+			Msg("connected to database")
+
+		if cfg.Bool("postgres.auto_migrate") {
+			applied, err := migrations.Up(context.Background(), pool)
+			for _, m := range applied {
+				logger.Info().Int64("version", m.Version).Str("name", m.Name).Msg("applied migration")
+			}
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to migrate database")
+			}
+		}
+
+		// Retention and compression policies of the hypertables
+		var policies []retention.Policy
+		for _, kind := range []string{retention.KindRetention, retention.KindCompression} {
+			configured, err := retention.Parse(kind, cfg.StringMap(kind))
+			if err != nil {
+				logger.Fatal().Err(err).Msg("invalid hypertable policy")
+			}
+			policies = append(policies, configured...)
+		}
+		if err := retention.Manage(context.Background(), pool, policies, *logger); err != nil {
+			logger.Fatal().Err(err).Msg("failed to apply hypertable policies")
+		}
+
+		// Rebuild and backfill modes replay stored events instead of consuming
+		if *rebuild != "" || *backfill != "" {
+			if *rebuild != "" && *backfill != "" {
+				logger.Fatal().Msg("-rebuild and -backfill are exclusive")
+			}
+			opts := rebuildOptions{
+				fromBlock: *fromBlock,
+				toBlock:   *toBlock,
+				batchSize: cfg.Int("consumer.batch_size"),
+			}
+			tables := *rebuild
+			if *backfill != "" {
+				tables = *backfill
+				opts.backfill = true
+				opts.checkpoint = backfillName(*backfill)
+			}
+			eventTypes, err := parseRebuildTables(tables)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("invalid -rebuild or -backfill")
+			}
+			opts.eventTypes = eventTypes
+			if *toBlock != 0 && *toBlock < *fromBlock {
+				logger.Fatal().Uint64("from_block", *fromBlock).Uint64("to_block", *toBlock).Msg("-to-block is before -from-block")
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			replayed, err := rebuildDerived(ctx, pool, opts, *logger)
+			if err != nil {
+				logger.Fatal().Err(err).Int("replayed", replayed).Msg("failed to rebuild derived tables")
+			}
+			logger.Info().Int("replayed", replayed).Bool("backfill", opts.backfill).Msg("rebuilt derived tables")
+			return
+		}
+	} else {
+		if *rebuild != "" || *backfill != "" {
+			logger.Fatal().Msg("-rebuild and -backfill need the postgres storage backend")
+		}
+		chClient, err = clickhouse.NewClient(clickhouse.Config{
+			URL:      cfg.String("clickhouse.url"),
+			Database: cfg.String("clickhouse.database"),
+			Username: cfg.String("clickhouse.username"),
+			Password: cfg.String("clickhouse.password"),
+		})
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid clickhouse configuration")
+		}
+		if err := chClient.Ping(context.Background()); err != nil {
+			logger.Fatal().Err(err).Msg("failed to ping clickhouse")
+		}
+		logger.Info().
+			Str("url", cfg.String("clickhouse.url")).
+			Str("database", cfg.String("clickhouse.database")).
+			Msg("connected to clickhouse")
+
+		if cfg.Bool("clickhouse.auto_migrate") {
+			if err := chClient.Migrate(context.Background()); err != nil {
+				logger.Fatal().Err(err).Msg("failed to migrate clickhouse")
+			}
+		}
 	}
-	logger.Info().
-		Str("host", cfg.String("postgres.host")).
-		Str("database", cfg.String("postgres.database")).
-		Msg("connected to database")
 
 	// Connect to NATS
-	nc, err := nats.Connect(cfg.String("nats.url"))
+	connOpts, err := natspub.LoadConnConfig(cfg).Options()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid nats configuration")
+	}
+	nc, err := nats.Connect(cfg.String("nats.url"), append(connOpts, nats.Name("polymarket-consumer"))...)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to connect to nats")
 	}
@@ -99,23 +255,69 @@ func main() {
 		logger.Fatal().Err(err).Msg("failed to create jetstream context")
 	}
 
-	// Create durable consumer
-	streamName := cfg.String("nats.stream_name")
+	// Create durable consumer on the stream the indexer publishes to
+	streamCfg, err := natspub.LoadPublisherConfig(cfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid nats configuration")
+	}
 	consumerName := cfg.String("nats.consumer_name")
 
-	consumer, err := js.CreateOrUpdateConsumer(context.Background(), streamName, jetstream.ConsumerConfig{
+	// Messages are acknowledged after the flush writing them commits, so
+	// the flush interval must be well within the ack wait and a full batch
+	// within the unacknowledged messages JetStream delivers
+	if d := cfg.Duration("consumer.ack_wait"); d > 0 {
+		ackWait = d
+	}
+	batchSize := cfg.Int("consumer.batch_size")
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	batchInterval := cfg.Duration("consumer.batch_interval")
+	if batchInterval <= 0 {
+		batchInterval = defaultBatchInterval
+	}
+	if batchSize > consumerMaxAckPending || batchInterval > ackWait/2 {
+		logger.Fatal().
+			Int("batch_size", batchSize).
+			Dur("batch_interval", batchInterval).
+			Msgf("consumer.batch_size must not exceed %d and consumer.batch_interval %s", consumerMaxAckPending, ackWait/2)
+	}
+
+	// Pull mode fetches batches itself; fetched messages wait for the rest
+	// of their batch before they are written and acknowledged
+	mode, err := parseMode(cfg.String("consumer.mode"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid consumer.mode")
+	}
+	if backend == backendClickHouse && mode != modePull {
+		logger.Warn().Str("mode", mode).Msg("consumer.mode is ignored with the clickhouse storage backend, batches are fetched")
+		mode = modePull
+	}
+	fetchMaxWait := cfg.Duration("consumer.fetch_max_wait")
+	if fetchMaxWait <= 0 {
+		fetchMaxWait = defaultFetchMaxWait
+	}
+	if fetchMaxWait > ackWait/2 {
+		logger.Fatal().
+			Dur("fetch_max_wait", fetchMaxWait).
+			Msgf("consumer.fetch_max_wait must not exceed %s", ackWait/2)
+	}
+
+	jsConsumer, err := js.CreateOrUpdateConsumer(context.Background(), streamCfg.StreamName, jetstream.ConsumerConfig{
 		Name:          consumerName,
 		Durable:       consumerName,
 		AckPolicy:     jetstream.AckExplicitPolicy,
-		MaxDeliver:    3,
-		AckWait:       30 * time.Second,
-		FilterSubject: "POLYMARKET.>",
+		MaxDeliver:    consumerMaxDeliver,
+		AckWait:       ackWait,
+		MaxAckPending: consumerMaxAckPending,
+		FilterSubject: streamCfg.SubjectPattern(),
 	})
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to create consumer")
 	}
 	logger.Info().
-		Str("stream", streamName).
+		Str("stream", streamCfg.StreamName).
+		Str("filter_subject", streamCfg.SubjectPattern()).
 		Str("consumer", consumerName).
 		Msg("created consumer")
 
@@ -133,6 +335,52 @@ func main() {
 		}
 	}()
 
+	// Start health server: /healthz checks NATS and the database, /readyz
+	// also the consumer's backlog
+	maxPending := uint64(defaultReadyMaxPending)
+	if cfg.Exists("consumer.ready_max_pending") {
+		maxPending = uint64(max(cfg.Int64("consumer.ready_max_pending"), 0))
+	}
+	healthAddr := cfg.String("consumer.health_address")
+	if healthAddr == "" {
+		healthAddr = defaultHealthAddress
+	}
+	// With leader election, replicas sharing the durable consumer stand by
+	// until they hold the leader lock
+	var election *leaderElection
+	if cfg.Bool("consumer.leader_election") {
+		if backend != backendPostgres {
+			logger.Fatal().Msg("consumer.leader_election needs the postgres storage backend")
+		}
+		election = newLeaderElection(func(ctx context.Context) (*pgx.Conn, error) {
+			return pgx.ConnectConfig(ctx, pool.Config().ConnConfig.Copy())
+		}, consumerName, cfg.Duration("consumer.leader_retry_interval"), *logger)
+	}
+
+	var db pinger = pool
+	if backend == backendClickHouse {
+		db = chClient
+	}
+	checker := newHealthChecker(nc, db, jsConsumer, cfg.Duration("consumer.health_timeout"), maxPending)
+	if election != nil {
+		checker.leadership = election
+	}
+	healthMux := checker.handler()
+	if cfg.Bool("admin.enabled") && backend == backendPostgres {
+		healthMux.HandleFunc("/admin/quarantine", adminQuarantineHandler(pool, *logger))
+	}
+	healthServer := &http.Server{
+		Addr:    healthAddr,
+		Handler: healthMux,
+	}
+
+	go func() {
+		logger.Info().Str("address", healthAddr).Msg("starting health check server")
+		if err := healthServer.ListenAndServe(); err != http.ErrServerClosed {
+			logger.Error().Err(err).Msg("health check server error")
+		}
+	}()
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -141,433 +389,252 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	// Start consuming messages
-	consCtx, err := consumer.Consume(func(msg jetstream.Msg) {
-		if err := processMessage(ctx, pool, msg, *logger); err != nil {
-			consumeErrors.WithLabelValues("process_message").Inc()
-			logger.Error().Err(err).Str("subject", msg.Subject()).Msg("failed to process message")
-			// Negative acknowledgment to retry
-			msg.Nak()
-			return
+	// Pending messages growing while writes stay fast point at NATS, write
+	// durations growing at Postgres
+	go consumer.MonitorPending(ctx, jsConsumer, cfg.Duration("consumer.pending_poll_interval"), *logger)
+
+	// A standby idles here, connected and serving health checks, until it
+	// is elected or stopped. The leader stops consuming and exits once it
+	// loses the lock, and is restarted as a standby.
+	elected := true
+	deposed := make(chan error, 1)
+	if election != nil {
+		waitCtx, stopWait := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		err := election.acquire(waitCtx)
+		stopWait()
+		if err != nil {
+			elected = false
+		} else {
+			go func() {
+				if err := election.hold(ctx); err != nil {
+					deposed <- err
+				}
+			}()
 		}
-		// Acknowledge message
-		msg.Ack()
-	})
-	if err != nil {
-		logger.Fatal().Err(err).Msg("failed to start consuming")
+	} else {
+		consumer.Leader.Set(1)
 	}
-	defer consCtx.Stop()
-
-	logger.Info().Msg("consumer started, waiting for messages")
 
-	// Wait for shutdown signal
-	sig := <-sigChan
-	logger.Info().Str("signal", sig.String()).Msg("received shutdown signal")
+	// Stored messages are acknowledged by the batch writer once its flush
+	// commits
+	var (
+		consCtx  jetstream.ConsumeContext
+		writer   *partitionedWriter
+		sessions []*workerSession
+	)
+	pullCtx, stopPull := context.WithCancel(ctx)
+	defer stopPull()
+	pullDone := make(chan struct{})
+
+	if elected {
+		if backend == backendPostgres {
+			if cfg.Bool("gamma.enabled") {
+				baseURL := cfg.String("gamma.base_url")
+				if baseURL == "" {
+					baseURL = gamma.DefaultBaseURL
+				}
+				client := gamma.NewClient(baseURL,
+					gamma.WithRateLimit(cfg.Float64("gamma.rate_limit")),
+					gamma.WithRetry(gamma.RetryPolicy{MaxAttempts: cfg.Int("gamma.max_attempts"), Backoff: time.Second}),
+				)
+				resync := cfg.Duration("gamma.resync_interval")
+				if resync <= 0 {
+					resync = time.Hour
+				}
+				marketEnrichment = newMarketEnricher(pool, client, resync, *logger)
+				go marketEnrichment.run(ctx, marketPollInterval)
+				logger.Info().Str("base_url", baseURL).Dur("resync_interval", resync).Msg("market enrichment enabled")
+			}
 
-	// Graceful shutdown
-	logger.Info().Msg("shutting down")
-	cancel()
+			holderSnapshots = newHolderSnapshotter(pool, *logger)
+			go holderSnapshots.run(ctx, holderPollInterval)
 
-	// Shutdown metrics server
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer shutdownCancel()
+			if interval := cfg.Duration("consumer.balance_check_interval"); interval > 0 {
+				sample := cfg.Int("consumer.balance_check_sample")
+				if sample <= 0 {
+					sample = defaultBalanceCheckSample
+				}
+				go runBalanceChecks(ctx, pool, interval, sample, *logger)
+			}
 
-	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
-		logger.Error().Err(err).Msg("metrics server shutdown error")
-	}
+			if interval := cfg.Duration("consumer.pnl_reconcile_interval"); interval > 0 {
+				sample := cfg.Int("consumer.pnl_reconcile_sample")
+				if sample <= 0 {
+					sample = defaultPnLReconcileSample
+				}
+				go runPnLReconciliation(ctx, pool, interval, sample, *logger)
+			}
+		}
 
-	logger.Info().Msg("shutdown complete")
-}
+		// Start consuming messages
+		switch mode {
+		case modePull:
+			if workers > 1 {
+				logger.Warn().Int("workers", workers).Msg("consumer.workers is ignored in pull mode, batches are written one at a time")
+			}
+			var pull fetchLoop
+			if backend == backendClickHouse {
+				pull = newClickHouseConsumer(jsConsumer, chClient, batchSize, fetchMaxWait, *logger)
+			} else {
+				pull = newPullConsumer(jsConsumer, pool, batchSize, fetchMaxWait, *logger)
+			}
+			go func() {
+				defer close(pullDone)
+				pull.run(pullCtx, ctx)
+			}()
+
+			logger.Info().
+				Str("mode", mode).
+				Str("backend", backend).
+				Int("batch_size", batchSize).
+				Dur("fetch_max_wait", fetchMaxWait).
+				Msg("consumer started, fetching messages")
+		default:
+			writer = newPartitionedWriter(workers, batchSize, func() txBeginner {
+				session := &workerSession{pool: pool}
+				sessions = append(sessions, session)
+				return session
+			}, *logger)
+			writer.run(ctx, batchInterval)
+
+			consCtx, err = jsConsumer.Consume(func(msg jetstream.Msg) {
+				if pending, ok := handleMessage(ctx, msg, *logger); ok {
+					writer.add(ctx, pending)
+				}
+			})
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to start consuming")
+			}
 
-// processMessage processes a single NATS message.
-func processMessage(ctx context.Context, pool *pgxpool.Pool, msg jetstream.Msg, logger zerolog.Logger) error {
-	// Parse event
-	var event models.Event
-	if err := json.Unmarshal(msg.Data(), &event); err != nil {
-		return fmt.Errorf("failed to unmarshal event: %w", err)
+			logger.Info().
+				Str("mode", mode).
+				Int("workers", workers).
+				Int("batch_size", batchSize).
+				Dur("batch_interval", batchInterval).
+				Msg("consumer started, waiting for messages")
+		}
 	}
 
-	// Calculate processing lag
-	eventTime := time.Unix(int64(event.Timestamp), 0)
-	lag := time.Since(eventTime)
-	processingLag.Set(lag.Seconds())
-
-	// Extract event type from subject (POLYMARKET.{EventType}.{ContractAddress})
-	eventType := extractEventType(msg.Subject())
-	eventsConsumed.WithLabelValues(eventType).Inc()
-
-	logger.Debug().
-		Str("event", eventType).
-		Uint64("block", event.Block).
-		Str("tx", event.TxHash).
-		Msg("processing event")
-
-	// Store event in appropriate table based on type
-	if err := storeEvent(ctx, pool, eventType, event); err != nil {
-		return fmt.Errorf("failed to store event: %w", err)
+	// Wait for shutdown signal, or for the leader lock to be lost
+	lostLeadership := false
+	select {
+	case sig := <-sigChan:
+		logger.Info().Str("signal", sig.String()).Msg("received shutdown signal")
+	case err := <-deposed:
+		lostLeadership = true
+		logger.Error().Err(err).Msg("lost leadership, stopping consumption")
 	}
 
-	eventsStored.WithLabelValues(eventType).Inc()
-	return nil
-}
+	// Graceful shutdown: stop receiving, then write and acknowledge what is
+	// buffered. Messages still in flight are redelivered after AckWait.
+	logger.Info().Msg("shutting down")
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
 
-// extractEventType extracts event type from NATS subject.
-func extractEventType(subject string) string {
-	// Subject format: POLYMARKET.{EventType}.{ContractAddress}
-	// Extract middle part
-	parts := []byte(subject)
-	firstDot := -1
-	secondDot := -1
-	for i, b := range parts {
-		if b == '.' {
-			if firstDot == -1 {
-				firstDot = i
-			} else {
-				secondDot = i
-				break
+	if elected {
+		switch mode {
+		case modePull:
+			// The fetch in progress ends within fetch_max_wait and is written
+			stopPull()
+			select {
+			case <-pullDone:
+			case <-shutdownCtx.Done():
+			}
+			cancel()
+		default:
+			consCtx.Stop()
+			writer.close(shutdownCtx)
+			cancel()
+			for _, session := range sessions {
+				session.release()
 			}
 		}
-	}
-	if firstDot >= 0 && secondDot > firstDot {
-		return subject[firstDot+1 : secondDot]
-	}
-	return "Unknown"
-}
 
-// storeEvent stores an event in the database.
-func storeEvent(ctx context.Context, pool *pgxpool.Pool, eventType string, event models.Event) error {
-	// Store raw event
-	if err := storeRawEvent(ctx, pool, event); err != nil {
-		return fmt.Errorf("failed to store raw event: %w", err)
-	}
-
-	// Store parsed event based on type
-	switch eventType {
-	case "OrderFilled":
-		return storeOrderFilled(ctx, pool, event)
-	case "TokenRegistered":
-		return storeTokenRegistered(ctx, pool, event)
-	case "TransferSingle":
-		return storeTokenTransfer(ctx, pool, event)
-	case "TransferBatch":
-		return storeTokenTransferBatch(ctx, pool, event)
-	case "ConditionPreparation":
-		return storeConditionPreparation(ctx, pool, event)
-	case "ConditionResolution":
-		return storeConditionResolution(ctx, pool, event)
-	case "PositionSplit":
-		return storePositionSplit(ctx, pool, event)
-	case "PositionsMerge":
-		return storePositionsMerge(ctx, pool, event)
-	default:
-		// Unknown event type, already stored as raw event
-		return nil
+		// Only once the consumed messages are written may a standby take
+		// over
+		if election != nil {
+			election.release(shutdownCtx)
+		}
 	}
-}
-
-// storeRawEvent stores the raw event in the events table.
-func storeRawEvent(ctx context.Context, pool *pgxpool.Pool, event models.Event) error {
-	payloadJSON, err := json.Marshal(event.Payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
-	}
-
-	query := `
-		INSERT INTO events (
-			block_number, block_hash, block_timestamp, transaction_hash, log_index,
-			contract_address, event_signature, payload
-		) VALUES ($1, $2, to_timestamp($3), $4, $5, $6, $7, $8)
-		ON CONFLICT (transaction_hash, log_index) DO NOTHING
-	`
-
-	_, err = pool.Exec(ctx, query,
-		event.Block,
-		event.BlockHash,
-		event.Timestamp,
-		event.TxHash,
-		event.LogIndex,
-		event.ContractAddr,
-		event.EventSig,
-		payloadJSON,
-	)
-
-	return err
-}
-
-// storeOrderFilled stores an OrderFilled event.
-func storeOrderFilled(ctx context.Context, pool *pgxpool.Pool, event models.Event) error {
-	payloadJSON, _ := json.Marshal(event.Payload)
-	var order models.OrderFilled
-	if err := json.Unmarshal(payloadJSON, &order); err != nil {
-		return err
-	}
-
-	query := `
-		INSERT INTO order_fills (
-			block_number, block_timestamp, transaction_hash, log_index,
-			order_hash, maker, taker, maker_asset_id, taker_asset_id,
-			maker_amount_filled, taker_amount_filled, fee
-		) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-		ON CONFLICT (transaction_hash, log_index) DO NOTHING
-	`
-
-	_, err := pool.Exec(ctx, query,
-		event.Block,
-		event.Timestamp,
-		event.TxHash,
-		event.LogIndex,
-		order.OrderHash,
-		order.Maker,
-		order.Taker,
-		order.MakerAssetID.String(),
-		order.TakerAssetID.String(),
-		order.MakerAmountFilled.String(),
-		order.TakerAmountFilled.String(),
-		order.Fee.String(),
-	)
-
-	return err
-}
 
-// storeTokenRegistered stores a TokenRegistered event.
-func storeTokenRegistered(ctx context.Context, pool *pgxpool.Pool, event models.Event) error {
-	payloadJSON, _ := json.Marshal(event.Payload)
-	var token models.TokenRegistered
-	if err := json.Unmarshal(payloadJSON, &token); err != nil {
-		return err
-	}
-
-	query := `
-		INSERT INTO token_registrations (
-			block_number, block_timestamp, transaction_hash, log_index,
-			token0, token1, condition_id
-		) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7)
-		ON CONFLICT (transaction_hash, log_index) DO NOTHING
-	`
-
-	_, err := pool.Exec(ctx, query,
-		event.Block,
-		event.Timestamp,
-		event.TxHash,
-		event.LogIndex,
-		token.Token0.String(),
-		token.Token1.String(),
-		token.ConditionID,
-	)
-
-	return err
-}
-
-// storeTokenTransfer stores a TransferSingle event.
-func storeTokenTransfer(ctx context.Context, pool *pgxpool.Pool, event models.Event) error {
-	payloadJSON, _ := json.Marshal(event.Payload)
-	var transfer models.TransferSingle
-	if err := json.Unmarshal(payloadJSON, &transfer); err != nil {
-		return err
-	}
-
-	query := `
-		INSERT INTO token_transfers (
-			block_number, block_timestamp, transaction_hash, log_index,
-			operator, from_address, to_address, token_id, amount
-		) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8, $9)
-		ON CONFLICT (transaction_hash, log_index) DO NOTHING
-	`
-
-	_, err := pool.Exec(ctx, query,
-		event.Block,
-		event.Timestamp,
-		event.TxHash,
-		event.LogIndex,
-		transfer.Operator,
-		transfer.From,
-		transfer.To,
-		transfer.TokenID.String(),
-		transfer.Amount.String(),
-	)
-
-	return err
-}
+	// Shutdown metrics and health servers
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error().Err(err).Msg("metrics server shutdown error")
+	}
 
-// storeTokenTransferBatch stores TransferBatch events (creates multiple records).
-func storeTokenTransferBatch(ctx context.Context, pool *pgxpool.Pool, event models.Event) error {
-	payloadJSON, _ := json.Marshal(event.Payload)
-	var transfer models.TransferBatch
-	if err := json.Unmarshal(payloadJSON, &transfer); err != nil {
-		return err
-	}
-
-	// Insert each token transfer separately
-	for i := range transfer.TokenIDs {
-		query := `
-			INSERT INTO token_transfers (
-				block_number, block_timestamp, transaction_hash, log_index,
-				operator, from_address, to_address, token_id, amount
-			) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8, $9)
-			ON CONFLICT (transaction_hash, log_index, token_id) DO NOTHING
-		`
-
-		if _, err := pool.Exec(ctx, query,
-			event.Block,
-			event.Timestamp,
-			event.TxHash,
-			event.LogIndex,
-			transfer.Operator,
-			transfer.From,
-			transfer.To,
-			transfer.TokenIDs[i].String(),
-			transfer.Amounts[i].String(),
-		); err != nil {
-			return err
-		}
+	if err := healthServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error().Err(err).Msg("health server shutdown error")
 	}
 
-	return nil
+	logger.Info().Msg("shutdown complete")
+	if lostLeadership {
+		// Restarted as a standby by the orchestrator
+		os.Exit(1)
+	}
 }
 
-// storeConditionPreparation stores a ConditionPreparation event.
-func storeConditionPreparation(ctx context.Context, pool *pgxpool.Pool, event models.Event) error {
-	payloadJSON, _ := json.Marshal(event.Payload)
-	var condition models.ConditionPreparation
-	if err := json.Unmarshal(payloadJSON, &condition); err != nil {
-		return err
-	}
-
-	query := `
-		INSERT INTO conditions (
-			condition_id, oracle, question_id, outcome_slot_count,
-			block_number, block_timestamp, transaction_hash
-		) VALUES ($1, $2, $3, $4, $5, to_timestamp($6), $7)
-		ON CONFLICT (condition_id) DO NOTHING
-	`
-
-	_, err := pool.Exec(ctx, query,
-		condition.ConditionID,
-		condition.Oracle,
-		condition.QuestionID,
-		condition.OutcomeSlotCount,
-		event.Block,
-		event.Timestamp,
-		event.TxHash,
-	)
-
-	return err
+// handleMessage processes a consumed message and returns it if it is to be
+// written. Skipped messages are acknowledged and undecodable ones rejected;
+// chunks are held until their event is reassembled.
+func handleMessage(ctx context.Context, msg jetstream.Msg, logger zerolog.Logger) (pendingMessage, bool) {
+	msg, ok := receiveMessage(msg, logger)
+	if !ok {
+		return pendingMessage{}, false
+	}
+	pending, err := processMessage(ctx, msg, logger)
+	return settleProcessed(msg, pending, err, logger)
 }
 
-// storeConditionResolution stores a ConditionResolution event.
-func storeConditionResolution(ctx context.Context, pool *pgxpool.Pool, event models.Event) error {
-	payloadJSON, _ := json.Marshal(event.Payload)
-	var resolution models.ConditionResolution
-	if err := json.Unmarshal(payloadJSON, &resolution); err != nil {
-		return err
-	}
-
-	// Convert payout numerators to string array
-	payouts := make([]string, len(resolution.PayoutNumerators))
-	for i, p := range resolution.PayoutNumerators {
-		payouts[i] = p.String()
-	}
-
-	query := `
-		UPDATE conditions
-		SET resolved = true,
-		    payout_numerators = $1,
-		    resolution_block = $2,
-		    resolution_timestamp = to_timestamp($3),
-		    resolution_tx = $4
-		WHERE condition_id = $5
-	`
-
-	_, err := pool.Exec(ctx, query,
-		payouts,
-		event.Block,
-		event.Timestamp,
-		event.TxHash,
-		resolution.ConditionID,
-	)
-
-	return err
+// settleProcessed returns a processed message if it is to be written, and
+// settles it otherwise: skipped messages are acknowledged and undecodable
+// ones rejected.
+func settleProcessed(msg jetstream.Msg, pending *pendingMessage, err error, logger zerolog.Logger) (pendingMessage, bool) {
+	if err != nil {
+		// Decoding does not touch the database, so it fails the same way
+		// on every delivery
+		consumer.ConsumeErrors.WithLabelValues("process_message").Inc()
+		rejectMessage(msg, consumer.Permanent(err), logger)
+		return pendingMessage{}, false
+	}
+	if pending == nil {
+		// Skipped, nothing to store
+		msg.Ack()
+		consumer.MessageSettled(msg)
+		return pendingMessage{}, false
+	}
+	return *pending, true
 }
 
-// storePositionSplit stores a PositionSplit event.
-func storePositionSplit(ctx context.Context, pool *pgxpool.Pool, event models.Event) error {
-	payloadJSON, _ := json.Marshal(event.Payload)
-	var split models.PositionSplit
-	if err := json.Unmarshal(payloadJSON, &split); err != nil {
-		return err
-	}
-
-	partition := make([]string, len(split.Partition))
-	for i, p := range split.Partition {
-		partition[i] = p.String()
-	}
-
-	query := `
-		INSERT INTO position_splits (
-			block_number, block_timestamp, transaction_hash, log_index,
-			stakeholder, collateral_token, parent_collection_id, condition_id,
-			partition, amount
-		) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8, $9, $10)
-		ON CONFLICT (transaction_hash, log_index) DO NOTHING
-	`
-
-	_, err := pool.Exec(ctx, query,
-		event.Block,
-		event.Timestamp,
-		event.TxHash,
-		event.LogIndex,
-		split.Stakeholder,
-		split.CollateralToken,
-		split.ParentCollectionID,
-		split.ConditionID,
-		partition,
-		split.Amount.String(),
-	)
-
-	return err
+// processMessage decodes a single NATS message and returns the statements
+// that store it, to be written by the batch writer. It returns nil for
+// messages that are skipped, and malformed events with the statement
+// quarantining them.
+func processMessage(ctx context.Context, msg jetstream.Msg, logger zerolog.Logger) (*pendingMessage, error) {
+	var recorder postgres.Recorder
+	m, err := processor.Process(ctx, msg, postgresStore(&recorder, logger), logger)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	return &pendingMessage{
+		msg:         m.Msg,
+		eventType:   m.EventType,
+		event:       m.Event,
+		statements:  recorder.Statements,
+		quarantined: m.Quarantine != nil,
+		duplicate:   postgres.ObserveDuplicate(recorder.Statements),
+	}, nil
 }
 
-// storePositionsMerge stores a PositionsMerge event.
-func storePositionsMerge(ctx context.Context, pool *pgxpool.Pool, event models.Event) error {
-	payloadJSON, _ := json.Marshal(event.Payload)
-	var merge models.PositionsMerge
-	if err := json.Unmarshal(payloadJSON, &merge); err != nil {
-		return err
-	}
-
-	partition := make([]string, len(merge.Partition))
-	for i, p := range merge.Partition {
-		partition[i] = p.String()
-	}
-
-	query := `
-		INSERT INTO position_merges (
-			block_number, block_timestamp, transaction_hash, log_index,
-			stakeholder, collateral_token, parent_collection_id, condition_id,
-			partition, amount
-		) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8, $9, $10)
-		ON CONFLICT (transaction_hash, log_index) DO NOTHING
-	`
-
-	_, err := pool.Exec(ctx, query,
-		event.Block,
-		event.Timestamp,
-		event.TxHash,
-		event.LogIndex,
-		merge.Stakeholder,
-		merge.CollateralToken,
-		merge.ParentCollectionID,
-		merge.ConditionID,
-		partition,
-		merge.Amount.String(),
-	)
-
-	return err
+// postgresStore returns the Postgres store executing its statements on db.
+func postgresStore(db postgres.Execer, logger zerolog.Logger) *postgres.Store {
+	return postgres.New(db, storeConfig, logger)
 }
 
-// bigIntFromString parses a big.Int from string.
-func bigIntFromString(s string) *big.Int {
-	n := new(big.Int)
-	n.SetString(s, 10)
-	return n
+// schemaStringers converts versions for logging.
+func schemaStringers(versions []codec.SchemaVersion) []fmt.Stringer {
+	out := make([]fmt.Stringer, len(versions))
+	for i, v := range versions {
+		out[i] = v
+	}
+	return out
 }
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestStoreAgainstMigratedSchema tests against TimescaleDB that the
+// statements storing every registered event, storing it again on
+// redelivery and reverting it all succeed on the migrated schema.
+func TestStoreAgainstMigratedSchema(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+
+	// Conditions are prepared before they resolve
+	names := []string{events.ConditionPreparation}
+	for _, def := range events.All() {
+		if def.Name != events.ConditionPreparation {
+			names = append(names, def.Name)
+		}
+	}
+
+	var stored []models.Event
+	for i, name := range names {
+		payload, ok := storetest.Payloads[name]
+		require.True(t, ok, "no schema test payload for %s", name)
+		event := models.Event{
+			Block:        100,
+			BlockHash:    "0x" + strings.Repeat("b1", 32),
+			Timestamp:    1_700_000_000,
+			TxHash:       "0x" + strings.Repeat("a1", 32),
+			LogIndex:     uint(i),
+			ContractAddr: "0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e",
+			EventSig:     "0x" + strings.Repeat("5e", 32),
+			EventName:    name,
+			Payload:      payload,
+			Success:      true,
+		}
+		for range 2 {
+			require.NoError(t, storeEvent(ctx, pool, name, event), "store %s", name)
+		}
+		stored = append(stored, event)
+	}
+	require.Equal(t, len(names), countEvents(t, pool))
+
+	var unprocessed int
+	require.NoError(t, pool.QueryRow(ctx, "SELECT count(*) FROM events WHERE NOT processed").Scan(&unprocessed))
+	require.Zero(t, unprocessed)
+
+	var resolved bool
+	require.NoError(t, pool.QueryRow(ctx, "SELECT resolved FROM conditions").Scan(&resolved))
+	require.True(t, resolved)
+
+	var side, price, size, notional string
+	require.NoError(t, pool.QueryRow(ctx,
+		"SELECT side, price::TEXT, size::TEXT, notional::TEXT FROM trades",
+	).Scan(&side, &price, &size, &notional))
+	require.Equal(t, []string{"buy", "0.520000", "100.000000", "52.000000"}, []string{side, price, size, notional})
+
+	var openInterest string
+	require.NoError(t, pool.QueryRow(ctx, "SELECT open_interest::TEXT FROM open_interest").Scan(&openInterest))
+	require.Equal(t, "0", openInterest)
+
+	// Removed logs are reverted in reverse order, like a reorg
+	for i := len(stored) - 1; i >= 0; i-- {
+		event := stored[i]
+		event.Success = false
+		require.NoError(t, storeEvent(ctx, pool, event.EventName, event), "revert %s", event.EventName)
+	}
+	require.Zero(t, countEvents(t, pool))
+	for _, table := range []string{"order_fills", "trades", "token_registrations", "tokens", "token_transfers", "collateral_transfers", "conditions", "position_splits", "position_merges", "payout_redemptions", "position_changes", "wallet_positions", "realized_pnl"} {
+		var n int
+		require.NoError(t, pool.QueryRow(ctx, "SELECT count(*) FROM "+table).Scan(&n))
+		require.Zero(t, n, table)
+	}
+}
+
+// TestReincludedLogAgainstMigratedSchema tests against Postgres that a log
+// removed by a reorg and re-included in another block is stored again, and
+// that the removal redelivered after it leaves the re-included copy.
+func TestReincludedLogAgainstMigratedSchema(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+
+	event := models.Event{
+		Block:        100,
+		BlockHash:    "0x" + strings.Repeat("b1", 32),
+		Timestamp:    1_700_000_000,
+		TxHash:       "0x" + strings.Repeat("a1", 32),
+		LogIndex:     3,
+		ContractAddr: "0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e",
+		EventSig:     "0x" + strings.Repeat("5e", 32),
+		EventName:    events.OrderFilled,
+		Payload:      storetest.Payloads[events.OrderFilled],
+		Success:      true,
+	}
+	removed := event
+	removed.Success = false
+	reincluded := event
+	reincluded.BlockHash = "0x" + strings.Repeat("b2", 32)
+
+	// rows returns the block hash of the stored log and its parsed row count
+	rows := func() (string, int) {
+		t.Helper()
+		var (
+			blockHash string
+			fills     int
+		)
+		require.NoError(t, pool.QueryRow(ctx, "SELECT block_hash FROM events").Scan(&blockHash))
+		require.NoError(t, pool.QueryRow(ctx, "SELECT count(*) FROM order_fills").Scan(&fills))
+		return blockHash, fills
+	}
+
+	for _, e := range []models.Event{event, removed, reincluded} {
+		require.NoError(t, storeEvent(ctx, pool, e.EventName, e))
+	}
+	require.Equal(t, 1, countEvents(t, pool))
+	blockHash, fills := rows()
+	require.Equal(t, reincluded.BlockHash, blockHash)
+	require.Equal(t, 1, fills)
+
+	require.NoError(t, storeEvent(ctx, pool, removed.EventName, removed), "redelivered removal")
+	require.Equal(t, 1, countEvents(t, pool))
+	blockHash, fills = rows()
+	require.Equal(t, reincluded.BlockHash, blockHash)
+	require.Equal(t, 1, fills)
+}
+
+// TestFanOutAgainstMigratedSchema tests against Postgres that the events of
+// a log routed to two handlers are both stored, once each.
+func TestFanOutAgainstMigratedSchema(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+
+	transfer := models.Event{
+		Block:        100,
+		BlockHash:    "0x" + strings.Repeat("b1", 32),
+		Timestamp:    1_700_000_000,
+		TxHash:       "0x" + strings.Repeat("a1", 32),
+		LogIndex:     3,
+		ContractAddr: "0x4d97dcd97ec945f40cf65f87097ace5ea0476045",
+		EventSig:     events.MustLookup(events.TransferSingle).Signature.Hex(),
+		EventName:    events.TransferSingle,
+		Payload:      storetest.Payloads[events.TransferSingle],
+		Success:      true,
+	}
+	balance := transfer
+	balance.EventName = "BalanceChanged"
+
+	for range 2 {
+		for _, event := range []models.Event{transfer, balance} {
+			require.NoError(t, postgresStore(pool, zerolog.Nop()).StoreRawEvent(ctx, event))
+		}
+	}
+	require.Equal(t, 2, countEvents(t, pool))
+}
+
+// TestConditionResolutionOrdering tests against Postgres that a condition
+// ends up prepared and resolved whichever of its two events is stored
+// first, and that only a resolution stored first is counted as out of
+// order.
+func TestConditionResolutionOrdering(t *testing.T) {
+	for _, resolutionFirst := range []bool{false, true} {
+		t.Run(fmt.Sprintf("resolution first %t", resolutionFirst), func(t *testing.T) {
+			pool := pgtest.Migrated(t)
+			ctx := context.Background()
+			w := newBatchWriter(pool, 10, zerolog.Nop())
+
+			order := []models.Event{storetest.PreparationEvent(0), storetest.ResolutionEvent(1)}
+			if resolutionFirst {
+				order[0], order[1] = order[1], order[0]
+			}
+			before := testutil.ToFloat64(consumer.ResolutionsUnprepared)
+			for _, event := range order {
+				m, msg := pendingEvent(t, event)
+				w.add(ctx, m)
+				w.flush(ctx)
+				require.Equal(t, 1, msg.acks, event.EventName)
+			}
+
+			var unprepared float64
+			if resolutionFirst {
+				unprepared = 1
+			}
+			require.Equal(t, before+unprepared, testutil.ToFloat64(consumer.ResolutionsUnprepared))
+
+			var (
+				oracle, prepareTx, resolutionTx string
+				slots                           int
+				block, resolutionBlock          int64
+				resolved                        bool
+				payouts                         []string
+			)
+			require.NoError(t, pool.QueryRow(ctx, `
+				SELECT oracle, outcome_slot_count, block_number, transaction_hash,
+				       resolved, payout_numerators::TEXT[], resolution_block, resolution_tx
+				FROM conditions WHERE condition_id = $1`,
+				"0x"+strings.Repeat("0d", 32),
+			).Scan(&oracle, &slots, &block, &prepareTx, &resolved, &payouts, &resolutionBlock, &resolutionTx))
+
+			require.Equal(t, "0x3333333333333333333333333333333333333333", oracle)
+			require.Equal(t, 2, slots)
+			require.Equal(t, int64(100), block)
+			require.Equal(t, "0x"+strings.Repeat("a1", 32), prepareTx)
+			require.True(t, resolved)
+			require.Equal(t, []string{"1", "0"}, payouts)
+			require.Equal(t, int64(200), resolutionBlock)
+			require.Equal(t, "0x"+strings.Repeat("a2", 32), resolutionTx)
+		})
+	}
+}
+
+// TestConditionReResolutionAgainstPostgres tests against Postgres that
+// every resolution of a condition resolved twice is kept in the history
+// once, that the condition holds the later one whichever is consumed last,
+// and that reorging the later one returns the condition to the earlier.
+func TestConditionReResolutionAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	logger := zerolog.Nop()
+	conditionID := "0x" + strings.Repeat("0d", 32)
+
+	first := storetest.ResolutionEvent(0)
+	second := storetest.ResolutionEvent(3)
+	second.Block = 300
+	second.Timestamp = 1_700_000_200
+	second.TxHash = "0x" + strings.Repeat("a3", 32)
+	disputed := second.Payload.(models.ConditionResolution)
+	disputed.PayoutNumerators = []*big.Int{big.NewInt(0), big.NewInt(1)}
+	second.Payload = disputed
+
+	current := func() (string, []string) {
+		var tx string
+		var payouts []string
+		require.NoError(t, pool.QueryRow(ctx,
+			"SELECT resolution_tx, payout_numerators::TEXT[] FROM conditions WHERE condition_id = $1 AND resolved",
+			conditionID,
+		).Scan(&tx, &payouts))
+		return tx, payouts
+	}
+
+	// The earlier resolution is redelivered after the later one
+	for _, event := range []models.Event{first, second, first, second} {
+		require.NoError(t, storeEvent(ctx, pool, events.ConditionResolution, event))
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT transaction_hash, log_index, block_number, payout_numerators::TEXT[]
+		FROM condition_resolutions WHERE condition_id = $1
+		ORDER BY block_number`, conditionID)
+	require.NoError(t, err)
+	type historyRow struct {
+		TxHash   string
+		LogIndex int
+		Block    int64
+		Payouts  []string
+	}
+	history, err := pgx.CollectRows(rows, pgx.RowToStructByPos[historyRow])
+	require.NoError(t, err)
+	require.Equal(t, []historyRow{
+		{first.TxHash, 0, 200, []string{"1", "0"}},
+		{second.TxHash, 3, 300, []string{"0", "1"}},
+	}, history)
+
+	tx, payouts := current()
+	require.Equal(t, second.TxHash, tx)
+	require.Equal(t, []string{"0", "1"}, payouts)
+
+	reversals, err := postgresStore(pool, logger).Reversals(events.ConditionResolution, second)
+	require.NoError(t, err)
+	for _, s := range reversals {
+		_, err := pool.Exec(ctx, s.Query, s.Args...)
+		require.NoError(t, err)
+	}
+	tx, payouts = current()
+	require.Equal(t, first.TxHash, tx)
+	require.Equal(t, []string{"1", "0"}, payouts)
+
+	var resolutions int
+	require.NoError(t, pool.QueryRow(ctx, "SELECT count(*) FROM condition_resolutions").Scan(&resolutions))
+	require.Equal(t, 1, resolutions)
+}
+
+// TestTransferBatchAgainstPostgres tests against Postgres that every row of
+// a 100-token batch is stored, including repeated token ids, and that
+// redelivering the batch stores nothing more.
+func TestTransferBatchAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	for range 2 {
+		m, msg := pendingEvent(t, storetest.TransferBatchEvent(100))
+		w.add(ctx, m)
+		w.flush(ctx)
+		require.Equal(t, 1, msg.acks)
+	}
+
+	var rows, positions, tokens int
+	var total string
+	require.NoError(t, pool.QueryRow(ctx, `
+		SELECT count(*), count(DISTINCT batch_index), count(DISTINCT token_id), sum(amount)::TEXT
+		FROM token_transfers`,
+	).Scan(&rows, &positions, &tokens, &total))
+	require.Equal(t, 100, rows)
+	require.Equal(t, 100, positions)
+	require.Equal(t, 50, tokens)
+	require.Equal(t, "5050", total)
+
+	var amount string
+	require.NoError(t, pool.QueryRow(ctx,
+		"SELECT amount::TEXT FROM token_transfers WHERE batch_index = 99",
+	).Scan(&amount))
+	require.Equal(t, "100", amount)
+}
+
+// TestCorrectedEventsAgainstPostgres tests against Postgres that events
+// published again with corrected values overwrite their parsed rows without
+// changing their keys, block timestamps or creation times, that balances,
+// candles, open interest and positions follow the correction exactly, and
+// that redelivering the correction changes nothing.
+func TestCorrectedEventsAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	store := func(event models.Event) {
+		m, msg := pendingEvent(t, event)
+		w.add(ctx, m)
+		w.flush(ctx)
+		require.Equal(t, 1, msg.acks, event.EventName)
+	}
+	stamps := func(table string) string {
+		var stamp string
+		require.NoError(t, pool.QueryRow(ctx,
+			"SELECT concat_ws(' ', transaction_hash, log_index, block_number, block_timestamp, created_at) FROM "+table,
+		).Scan(&stamp))
+		return stamp
+	}
+
+	// storetest.WalletA buys 1 share of token 77 at 0.60, corrected to 0.70
+	fill := storetest.FillEvent(100, 0, 1_700_000_050, 600_000, 1_000_000)
+	store(fill)
+	fills, trades := stamps("order_fills"), stamps("trades")
+
+	corrected := storetest.FillEvent(100, 0, 1_700_000_050, 700_000, 1_000_000)
+	for range 2 {
+		store(corrected)
+	}
+	var price, makerAmount string
+	require.NoError(t, pool.QueryRow(ctx, "SELECT price::TEXT FROM trades").Scan(&price))
+	require.NoError(t, pool.QueryRow(ctx, "SELECT maker_amount_filled::TEXT FROM order_fills").Scan(&makerAmount))
+	require.Equal(t, "0.700000", price)
+	require.Equal(t, "700000", makerAmount)
+	require.Equal(t, fills, stamps("order_fills"))
+	require.Equal(t, trades, stamps("trades"))
+	require.Equal(t, []string{
+		"60 1700000040 0.700000 0.700000 0.700000 0.700000 1.000000 1",
+		"3600 1699999200 0.700000 0.700000 0.700000 0.700000 1.000000 1",
+	}, candlesOf(t, pool))
+	require.Equal(t, map[string]string{storetest.WalletA + "/77": "1 0.7 0"}, positionsOf(t, pool))
+
+	// storetest.WalletA sends 20 of token 1000 to storetest.WalletB, corrected to 15 to storetest.WalletA
+	// itself
+	store(storetest.TransferEvent(1, models.ZeroAddress, storetest.WalletA, 1000, 50))
+	store(storetest.TransferEvent(2, storetest.WalletA, storetest.WalletB, 1000, 20))
+	transfers := stamps("token_transfers WHERE log_index = 2")
+	for range 2 {
+		store(storetest.TransferEvent(2, storetest.WalletA, storetest.WalletA, 1000, 15))
+	}
+	require.Equal(t, transfers, stamps("token_transfers WHERE log_index = 2"))
+	require.Equal(t, map[string]string{
+		storetest.WalletA + "/1000": "50",
+		storetest.WalletB + "/1000": "0",
+	}, balancesOf(t, pool))
+
+	// A split of 10 collateral units, corrected to 4
+	store(storetest.PositionEvent(events.PositionSplit, 200, 10_000_000, false))
+	splits := stamps("position_splits")
+	for range 2 {
+		store(storetest.PositionEvent(events.PositionSplit, 200, 4_000_000, false))
+	}
+	require.Equal(t, splits, stamps("position_splits"))
+	require.Equal(t, "4000000", openInterestOf(t, pool))
+
+	// The raw events are never overwritten
+	require.Equal(t, 4, countEvents(t, pool))
+	var payload string
+	require.NoError(t, pool.QueryRow(ctx,
+		"SELECT payload->>'maker_amount_filled' FROM events WHERE transaction_hash = $1", fill.TxHash,
+	).Scan(&payload))
+	require.Equal(t, "600000", payload)
+}
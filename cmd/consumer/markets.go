@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/gamma"
+	"github.com/0xkanth/polymarket-indexer/internal/store/postgres"
+)
+
+var marketEnrichments = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "polymarket_market_enrichments_total",
+	Help: "Total number of market lookups in the Gamma API by result (listed, unlisted, error)",
+}, []string{"result"})
+
+const (
+	// marketPollInterval is how often the enricher looks for conditions to
+	// enrich when no preparation woke it
+	marketPollInterval = time.Minute
+
+	// marketBatchSize bounds the conditions read per query
+	marketBatchSize = 100
+
+	// pendingMarketsQuery returns prepared conditions never looked up, then
+	// unlisted ones last checked more than $1 seconds ago
+	pendingMarketsQuery = `
+		SELECT c.condition_id
+		FROM conditions c
+		LEFT JOIN markets m ON m.condition_id = c.condition_id
+		WHERE c.transaction_hash IS NOT NULL
+		  AND (m.condition_id IS NULL
+		       OR (NOT m.listed AND m.checked_at < NOW() - make_interval(secs => $1)))
+		ORDER BY m.checked_at NULLS FIRST
+		LIMIT $2
+	`
+
+	upsertListedMarket = `
+		INSERT INTO markets (
+			condition_id, question_id, title, slug, outcomes, category, end_date, listed
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, true)
+		ON CONFLICT (condition_id) DO UPDATE SET
+			question_id = EXCLUDED.question_id,
+			title = EXCLUDED.title,
+			slug = EXCLUDED.slug,
+			outcomes = EXCLUDED.outcomes,
+			category = EXCLUDED.category,
+			end_date = EXCLUDED.end_date,
+			listed = true,
+			checked_at = NOW(),
+			updated_at = NOW()
+	`
+
+	upsertUnlistedMarket = `
+		INSERT INTO markets (condition_id, listed) VALUES ($1, false)
+		ON CONFLICT (condition_id) DO UPDATE SET checked_at = NOW()
+	`
+)
+
+// marketEnrichment is the running market enricher, nil when gamma.enabled
+// is off. Stored preparations wake it.
+var marketEnrichment *marketEnricher
+
+// marketFetcher looks up the market of a condition (implemented by
+// gamma.Client).
+type marketFetcher interface {
+	MarketByCondition(ctx context.Context, conditionID string) (gamma.Market, error)
+}
+
+// enricherDB is the database the enricher reads conditions from and writes
+// markets to (implemented by pgxpool.Pool).
+type enricherDB interface {
+	postgres.Execer
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// marketEnricher stores the Gamma API metadata of prepared conditions in
+// markets. It runs apart from the batch writer, so a slow or unavailable
+// API never holds back consumption.
+type marketEnricher struct {
+	db      enricherDB
+	markets marketFetcher
+	resync  time.Duration
+	wake    chan struct{}
+	logger  zerolog.Logger
+}
+
+// newMarketEnricher creates an enricher looking unlisted markets up again
+// every resync.
+func newMarketEnricher(db enricherDB, markets marketFetcher, resync time.Duration, logger zerolog.Logger) *marketEnricher {
+	return &marketEnricher{
+		db:      db,
+		markets: markets,
+		resync:  resync,
+		wake:    make(chan struct{}, 1),
+		logger:  logger.With().Str("component", "market_enricher").Logger(),
+	}
+}
+
+// notify wakes the enricher after a preparation was stored. It never
+// blocks; wakes arriving during a pass are folded into one.
+func (e *marketEnricher) notify() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// notifyPrepared is the observer of stored preparations.
+func notifyPrepared(pgconn.CommandTag) {
+	if marketEnrichment != nil {
+		marketEnrichment.notify()
+	}
+}
+
+// run enriches pending conditions when woken and every poll interval until
+// ctx is cancelled.
+func (e *marketEnricher) run(ctx context.Context, poll time.Duration) {
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		if _, err := e.enrichPending(ctx); err != nil && ctx.Err() == nil {
+			e.logger.Warn().Err(err).Msg("failed to enrich markets")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// enrichPending looks up every pending condition and returns how many it
+// stored. It stops at the first lookup that fails other than with
+// ErrNotFound, leaving the rest for the next pass.
+func (e *marketEnricher) enrichPending(ctx context.Context) (int, error) {
+	var stored int
+	for {
+		conditions, err := e.pending(ctx)
+		if err != nil {
+			return stored, err
+		}
+		for _, conditionID := range conditions {
+			if err := e.enrich(ctx, conditionID); err != nil {
+				return stored, err
+			}
+			stored++
+		}
+		if len(conditions) < marketBatchSize {
+			return stored, nil
+		}
+	}
+}
+
+// pending returns a batch of conditions to look up.
+func (e *marketEnricher) pending(ctx context.Context) ([]string, error) {
+	rows, err := e.db.Query(ctx, pendingMarketsQuery, e.resync.Seconds(), marketBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending markets: %w", err)
+	}
+	conditions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending markets: %w", err)
+	}
+	return conditions, nil
+}
+
+// enrich looks a condition up and stores its market, or that it is not
+// listed yet.
+func (e *marketEnricher) enrich(ctx context.Context, conditionID string) error {
+	market, err := e.markets.MarketByCondition(ctx, conditionID)
+	if errors.Is(err, gamma.ErrNotFound) {
+		marketEnrichments.WithLabelValues("unlisted").Inc()
+		if _, err := e.db.Exec(ctx, upsertUnlistedMarket, conditionID); err != nil {
+			return fmt.Errorf("failed to store unlisted market %s: %w", conditionID, err)
+		}
+		e.logger.Debug().Str("condition_id", conditionID).Msg("market not listed yet")
+		return nil
+	}
+	if err != nil {
+		marketEnrichments.WithLabelValues("error").Inc()
+		return fmt.Errorf("failed to look up market %s: %w", conditionID, err)
+	}
+
+	var endDate *time.Time
+	if !market.EndDate.IsZero() {
+		endDate = &market.EndDate
+	}
+	if _, err := e.db.Exec(ctx, upsertListedMarket,
+		conditionID,
+		nullIfEmpty(market.QuestionID),
+		market.Title,
+		market.Slug,
+		market.Outcomes,
+		nullIfEmpty(market.Category),
+		endDate,
+	); err != nil {
+		return fmt.Errorf("failed to store market %s: %w", conditionID, err)
+	}
+	marketEnrichments.WithLabelValues("listed").Inc()
+	e.logger.Debug().Str("condition_id", conditionID).Str("slug", market.Slug).Msg("stored market")
+	return nil
+}
+
+// nullIfEmpty returns nil for empty strings so they are stored as NULL.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/gamma"
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/postgres"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// fakeMarkets serves the markets it holds and ErrNotFound for others, or
+// err for every lookup when set.
+type fakeMarkets struct {
+	markets map[string]gamma.Market
+	err     error
+	lookups int
+}
+
+func (f *fakeMarkets) MarketByCondition(_ context.Context, conditionID string) (gamma.Market, error) {
+	f.lookups++
+	if f.err != nil {
+		return gamma.Market{}, f.err
+	}
+	market, ok := f.markets[conditionID]
+	if !ok {
+		return gamma.Market{}, gamma.ErrNotFound
+	}
+	return market, nil
+}
+
+// TestStoreConditionPreparationWakesEnricher tests that a stored
+// preparation wakes the market enricher once it is committed, without
+// blocking when it is already awake.
+func TestStoreConditionPreparationWakesEnricher(t *testing.T) {
+	enricher := newMarketEnricher(nil, &fakeMarkets{}, time.Hour, zerolog.Nop())
+	marketEnrichment = enricher
+	t.Cleanup(func() { marketEnrichment = nil })
+
+	var recorder postgres.Recorder
+	require.NoError(t, postgresStore(&recorder, zerolog.Nop()).StoreConditionPreparation(context.Background(), storetest.PreparationEvent(0)))
+	require.Len(t, recorder.Statements, 1)
+	require.Empty(t, enricher.wake)
+
+	observe := recorder.Statements[0].Observe
+	require.NotNil(t, observe)
+	observe(pgconn.NewCommandTag("INSERT 0 1"))
+	observe(pgconn.NewCommandTag("INSERT 0 1"))
+	require.Len(t, enricher.wake, 1)
+}
+
+// TestMarketEnricherAgainstPostgres tests against Postgres that prepared
+// conditions are looked up once, that unlisted markets are looked up again
+// after the resync interval and that a failing API stops the pass without
+// recording anything.
+func TestMarketEnricherAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+
+	listed := "0x" + strings.Repeat("0d", 32)
+	unlisted := "0x" + strings.Repeat("0f", 32)
+	for i, conditionID := range []string{listed, unlisted} {
+		event := storetest.PreparationEvent(uint(i))
+		event.Payload = models.ConditionPreparation{
+			ConditionID:      conditionID,
+			Oracle:           "0x3333333333333333333333333333333333333333",
+			QuestionID:       "0x" + strings.Repeat("0e", 32),
+			OutcomeSlotCount: 2,
+		}
+		require.NoError(t, postgresStore(pool, zerolog.Nop()).StoreConditionPreparation(ctx, event))
+	}
+
+	markets := &fakeMarkets{err: errors.New("gamma api unavailable")}
+	enricher := newMarketEnricher(pool, markets, time.Hour, zerolog.Nop())
+
+	stored, err := enricher.enrichPending(ctx)
+	require.Error(t, err)
+	require.Zero(t, stored)
+	require.Equal(t, 1, markets.lookups)
+
+	end := time.Date(2024, 11, 5, 12, 0, 0, 0, time.UTC)
+	markets.err = nil
+	markets.markets = map[string]gamma.Market{listed: {
+		ConditionID: listed,
+		Title:       "Will it rain tomorrow?",
+		Slug:        "will-it-rain-tomorrow",
+		Outcomes:    []string{"Yes", "No"},
+		Category:    "Weather",
+		EndDate:     end,
+	}}
+	stored, err = enricher.enrichPending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, stored)
+
+	var (
+		title, slug string
+		outcomes    []string
+		endDate     time.Time
+		isListed    bool
+	)
+	require.NoError(t, pool.QueryRow(ctx,
+		"SELECT title, slug, outcomes, end_date, listed FROM markets WHERE condition_id = $1", listed,
+	).Scan(&title, &slug, &outcomes, &endDate, &isListed))
+	require.Equal(t, "Will it rain tomorrow?", title)
+	require.Equal(t, "will-it-rain-tomorrow", slug)
+	require.Equal(t, []string{"Yes", "No"}, outcomes)
+	require.True(t, end.Equal(endDate))
+	require.True(t, isListed)
+
+	// Nothing is due before the resync interval
+	markets.lookups = 0
+	stored, err = enricher.enrichPending(ctx)
+	require.NoError(t, err)
+	require.Zero(t, stored)
+	require.Zero(t, markets.lookups)
+
+	// The unlisted market is listed by the next resync
+	markets.markets[unlisted] = gamma.Market{ConditionID: unlisted, Title: "Listed later", Slug: "listed-later"}
+	enricher.resync = 0
+	stored, err = enricher.enrichPending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, stored)
+	require.NoError(t, pool.QueryRow(ctx,
+		"SELECT title, listed FROM markets WHERE condition_id = $1", unlisted,
+	).Scan(&title, &isListed))
+	require.Equal(t, "Listed later", title)
+	require.True(t, isListed)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// openInterestOf returns the open interest of storetest.OpenInterestCondition.
+func openInterestOf(t *testing.T, pool *pgxpool.Pool) string {
+	t.Helper()
+	var openInterest string
+	require.NoError(t, pool.QueryRow(context.Background(),
+		"SELECT open_interest::TEXT FROM open_interest WHERE condition_id = $1", storetest.OpenInterestCondition,
+	).Scan(&openInterest))
+	return openInterest
+}
+
+// TestOpenInterestAgainstPostgres tests against Postgres that root splits,
+// merges and redemptions, including redelivered ones, move open interest,
+// that nested ones do not, that an update going negative is clamped and
+// counted, and that removed events are undone.
+func TestOpenInterestAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	store := func(event models.Event) {
+		m, msg := pendingEvent(t, event)
+		w.add(ctx, m)
+		w.flush(ctx)
+		require.Equal(t, 1, msg.acks)
+	}
+
+	split := storetest.PositionEvent(events.PositionSplit, 100, 10_000_000, false)
+	store(split)
+	store(split) // redelivered
+	store(storetest.PositionEvent(events.PositionSplit, 101, 7_000_000, true))
+	store(storetest.PositionEvent(events.PositionsMerge, 102, 3_000_000, false))
+	store(storetest.PositionEvent(events.PositionsMerge, 103, 1_000_000, true))
+	require.Equal(t, "7000000", openInterestOf(t, pool))
+
+	clamped := consumer.OpenInterestClamped.WithLabelValues(events.PayoutRedemption)
+	before := testutil.ToFloat64(clamped)
+	redemption := storetest.PositionEvent(events.PayoutRedemption, 104, 9_000_000, false)
+	store(redemption)
+	require.Equal(t, "0", openInterestOf(t, pool))
+	require.Equal(t, before+1, testutil.ToFloat64(clamped))
+
+	var lastBlock uint64
+	require.NoError(t, pool.QueryRow(ctx,
+		"SELECT last_block FROM open_interest WHERE condition_id = $1", storetest.OpenInterestCondition,
+	).Scan(&lastBlock))
+	require.Equal(t, uint64(104), lastBlock)
+
+	// The clamped redemption is reorged out and its payout put back
+	removed := redemption
+	removed.Success = false
+	store(removed)
+	require.Equal(t, "9000000", openInterestOf(t, pool))
+
+	// The rebuild recomputes the exact value from the stored events
+	var rebuilt int64
+	require.NoError(t, pool.QueryRow(ctx, "SELECT rebuild_open_interest()").Scan(&rebuilt))
+	require.Equal(t, int64(1), rebuilt)
+	require.Equal(t, "7000000", openInterestOf(t, pool))
+
+	// Without its split the merge takes out more than was put in
+	removed = split
+	removed.Success = false
+	store(removed)
+	require.Equal(t, "0", openInterestOf(t, pool))
+}
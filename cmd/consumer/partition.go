@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+)
+
+// defaultWorkers is the default number of partitions messages are written
+// from.
+const defaultWorkers = 1
+
+// partitionKey returns the key a message is ordered by: its contract.
+// Every event of a contract is written in stream order, so the derived rows
+// of one market or wallet from one contract (balances, open interest,
+// candles) are applied in order; the same key is published in the
+// PM-Contract header.
+func partitionKey(m pendingMessage) string {
+	return m.event.ContractAddr
+}
+
+// partition returns the worker of a key among n.
+func partition(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// partitionWorker writes the messages of its keys in the order they were
+// queued.
+type partitionWorker struct {
+	queue  chan pendingMessage
+	writer *batchWriter
+}
+
+// partitionedWriter shards consumed messages by partitionKey onto ordered
+// worker queues, each flushed by a batch writer of its own, so messages of
+// a key are written and acknowledged in order while different keys are
+// written in parallel.
+//
+// Derived rows spanning contracts (positions from a fill and the transfer
+// settling it) may be written out of order across workers; positions replay
+// themselves when that happens, and concurrent flushes touching the same
+// rows may deadlock, failing one batch whose messages are then retried one
+// by one.
+type partitionedWriter struct {
+	workers []*partitionWorker
+	loops   sync.WaitGroup
+
+	// mu guards closed: add holds it shared while queueing, close
+	// exclusively while closing the queues
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newPartitionedWriter creates n workers, each writing batches of
+// batchSize messages in the database session returned by session.
+func newPartitionedWriter(n, batchSize int, session func() txBeginner, logger zerolog.Logger) *partitionedWriter {
+	if n <= 0 {
+		n = defaultWorkers
+	}
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	p := &partitionedWriter{}
+	for i := range n {
+		p.workers = append(p.workers, &partitionWorker{
+			queue:  make(chan pendingMessage, batchSize),
+			writer: newBatchWriter(session(), batchSize, logger.With().Int("worker", i).Logger()),
+		})
+	}
+	return p
+}
+
+// run starts the workers: each buffers the messages of its queue and
+// flushes them every interval until ctx is done or the writer is closed.
+func (p *partitionedWriter) run(ctx context.Context, interval time.Duration) {
+	for i, w := range p.workers {
+		label := strconv.Itoa(i)
+		go w.writer.run(ctx, interval)
+
+		p.loops.Add(1)
+		go func() {
+			defer p.loops.Done()
+			for m := range w.queue {
+				consumer.WorkerQueued.WithLabelValues(label).Set(float64(len(w.queue)))
+				w.writer.add(ctx, m)
+			}
+		}()
+	}
+}
+
+// add queues a message on the worker of its key, waiting while the queue
+// is full. Messages added once the writer is closed are dropped, and
+// redelivered by JetStream after AckWait.
+func (p *partitionedWriter) add(ctx context.Context, m pendingMessage) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return
+	}
+
+	w := p.workers[partition(partitionKey(m), len(p.workers))]
+	select {
+	case w.queue <- m:
+	case <-ctx.Done():
+	}
+}
+
+// close stops queueing, waits for the workers to buffer their queued
+// messages and flushes them.
+func (p *partitionedWriter) close(ctx context.Context) {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, w := range p.workers {
+			close(w.queue)
+		}
+	}
+	p.mu.Unlock()
+
+	p.loops.Wait()
+	var flushes sync.WaitGroup
+	for _, w := range p.workers {
+		flushes.Add(1)
+		go func() {
+			defer flushes.Done()
+			w.writer.flush(ctx)
+		}()
+	}
+	flushes.Wait()
+}
+
+// workerSession is the database session of a worker: a pool connection
+// held for the worker's lifetime and replaced once it is closed. The
+// worker's flushes are serialized, so it runs one transaction at a time.
+type workerSession struct {
+	pool *pgxpool.Pool
+
+	mu   sync.Mutex
+	conn *pgxpool.Conn
+}
+
+func (s *workerSession) Begin(ctx context.Context) (pgx.Tx, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil && s.conn.Conn().IsClosed() {
+		s.conn.Release()
+		s.conn = nil
+	}
+	if s.conn == nil {
+		conn, err := s.pool.Acquire(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		}
+		s.conn = conn
+	}
+	return s.conn.Begin(ctx)
+}
+
+// release returns the session's connection to the pool.
+func (s *workerSession) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Release()
+		s.conn = nil
+	}
+}
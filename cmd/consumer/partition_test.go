@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPartition tests that a key always maps to the same worker and that
+// keys spread over every worker.
+func TestPartition(t *testing.T) {
+	used := make(map[int]bool)
+	for i := range 64 {
+		key := fmt.Sprintf("0x%040x", i)
+		worker := partition(key, 4)
+		require.Equal(t, worker, partition(key, 4))
+		require.Less(t, worker, 4)
+		used[worker] = true
+	}
+	require.Len(t, used, 4)
+	require.Zero(t, partition("0xabc", 1))
+}
+
+// orderingDB is a database safe for concurrent transactions that records,
+// per key, the sequence numbers of the statements it committed. Statements
+// are "key/seq". Commits take a random time, so transactions of different
+// workers overlap.
+type orderingDB struct {
+	mu        sync.Mutex
+	committed map[string][]int
+
+	active    atomic.Int32
+	maxActive atomic.Int32
+}
+
+func (db *orderingDB) Begin(context.Context) (pgx.Tx, error) {
+	return &orderingTx{db: db}, nil
+}
+
+// isCommitted reports whether a statement was committed.
+func (db *orderingDB) isCommitted(query string) bool {
+	key, seq := parseOrderingQuery(query)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, committed := range db.committed[key] {
+		if committed == seq {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOrderingQuery splits a "key/seq" statement.
+func parseOrderingQuery(query string) (string, int) {
+	key, seq, _ := strings.Cut(query, "/")
+	n, _ := strconv.Atoi(seq)
+	return key, n
+}
+
+// orderingTx is a transaction of an orderingDB.
+type orderingTx struct {
+	pgx.Tx
+	db      *orderingDB
+	queries []string
+}
+
+func (tx *orderingTx) SendBatch(_ context.Context, b *pgx.Batch) pgx.BatchResults {
+	for _, q := range b.QueuedQueries {
+		tx.queries = append(tx.queries, q.SQL)
+	}
+	return &fakeBatchResults{queries: tx.queries}
+}
+
+func (tx *orderingTx) Commit(context.Context) error {
+	active := tx.db.active.Add(1)
+	for {
+		seen := tx.db.maxActive.Load()
+		if active <= seen || tx.db.maxActive.CompareAndSwap(seen, active) {
+			break
+		}
+	}
+	time.Sleep(time.Duration(rand.IntN(500)) * time.Microsecond)
+	tx.db.active.Add(-1)
+
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	for _, q := range tx.queries {
+		key, seq := parseOrderingQuery(q)
+		tx.db.committed[key] = append(tx.db.committed[key], seq)
+	}
+	return nil
+}
+
+func (tx *orderingTx) Rollback(context.Context) error { return nil }
+
+// orderingMsg is a message recording whether it was acknowledged before its
+// statement was committed.
+type orderingMsg struct {
+	fakeMsg
+	db    *orderingDB
+	query string
+	early *atomic.Int32
+	acked atomic.Int32
+}
+
+func (m *orderingMsg) Ack() error {
+	if !m.db.isCommitted(m.query) {
+		m.early.Add(1)
+	}
+	m.acked.Add(1)
+	return nil
+}
+
+// TestPartitionedWriterOrdersKeys tests under concurrency that the messages
+// of every key are committed in the order they were added, that different
+// keys are written in parallel, and that every message is acknowledged
+// exactly once, after it committed, including those buffered at close.
+func TestPartitionedWriterOrdersKeys(t *testing.T) {
+	const (
+		keys     = 32
+		messages = 4000
+	)
+	db := &orderingDB{committed: make(map[string][]int)}
+	w := newPartitionedWriter(4, 16, func() txBeginner { return db }, zerolog.Nop())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.run(ctx, time.Millisecond)
+
+	var early atomic.Int32
+	var added []*orderingMsg
+	next := make([]int, keys)
+	for range messages {
+		k := rand.IntN(keys)
+		key := fmt.Sprintf("0x%040x", k)
+		query := fmt.Sprintf("%s/%d", key, next[k])
+		next[k]++
+
+		msg := &orderingMsg{fakeMsg: fakeMsg{delivered: 1}, db: db, query: query, early: &early}
+		m, _ := testPending(query)
+		m.msg = msg
+		m.event.ContractAddr = key
+		w.add(ctx, m)
+		added = append(added, msg)
+	}
+	w.close(context.Background())
+
+	for k := range keys {
+		key := fmt.Sprintf("0x%040x", k)
+		want := make([]int, next[k])
+		for i := range want {
+			want[i] = i
+		}
+		if len(want) == 0 {
+			want = nil
+		}
+		require.Equal(t, want, db.committed[key], key)
+	}
+	for _, msg := range added {
+		require.Equal(t, int32(1), msg.acked.Load(), msg.query)
+	}
+	require.Zero(t, early.Load(), "acknowledged before commit")
+	require.Greater(t, db.maxActive.Load(), int32(1), "workers never overlapped")
+
+	// Messages added after close are dropped
+	m, _ := testPending("late/0")
+	w.add(ctx, m)
+	require.Empty(t, db.committed["late"])
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Integers at the top of the uint256 range, beyond float64 precision.
+var (
+	twoTo255   = new(big.Int).Lsh(big.NewInt(1), 255)
+	maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+)
+
+// wideFill returns an OrderFilled payload whose integers need 256 bits.
+func wideFill() models.OrderFilled {
+	return models.OrderFilled{
+		OrderHash:         "0x" + strings.Repeat("0a", 32),
+		Maker:             "0x1111111111111111111111111111111111111111",
+		Taker:             "0x2222222222222222222222222222222222222222",
+		MakerAssetID:      big.NewInt(0),
+		TakerAssetID:      twoTo255,
+		MakerAmountFilled: maxUint256,
+		TakerAmountFilled: new(big.Int).Add(twoTo255, big.NewInt(1)),
+		Fee:               big.NewInt(0),
+	}
+}
+
+// TestProcessMessageBindsWideIntegers tests that the amounts of a JSON
+// message are bound as NUMERIC with their full precision.
+func TestProcessMessageBindsWideIntegers(t *testing.T) {
+	event := storetest.TransferEvent(0, "0x1111111111111111111111111111111111111111", "0x2222222222222222222222222222222222222222", 0, 0)
+	event.Payload = models.TransferSingle{
+		Operator: "0x1111111111111111111111111111111111111111",
+		From:     "0x1111111111111111111111111111111111111111",
+		To:       "0x2222222222222222222222222222222222222222",
+		TokenID:  twoTo255,
+		Amount:   maxUint256,
+	}
+	data, err := codec.JSON.Marshal(event)
+	require.NoError(t, err)
+	msg := &fakeMsg{subject: "POLYMARKET.TransferSingle.0xab", header: nats.Header{}, data: data, delivered: 1}
+
+	pending, err := processMessage(context.Background(), msg, zerolog.Nop())
+	require.NoError(t, err)
+	for _, st := range pending.statements {
+		if consumer.StatementTable(st.Query) == "token_transfers" {
+			require.Equal(t, pgtype.Numeric{Int: twoTo255, Valid: true}, st.Args[7])
+			require.Equal(t, pgtype.Numeric{Int: maxUint256, Valid: true}, st.Args[8])
+			return
+		}
+	}
+	t.Fatal("no token_transfers statement")
+}
+
+// TestWideIntegersAgainstPostgres tests against Postgres that 256-bit
+// amounts consumed as JSON are stored exactly, in the parsed NUMERIC
+// columns and in the raw payload.
+func TestWideIntegersAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+
+	event := models.Event{
+		Block:        100,
+		BlockHash:    "0x" + strings.Repeat("b1", 32),
+		Timestamp:    1_700_000_000,
+		TxHash:       "0x" + strings.Repeat("a1", 32),
+		ContractAddr: "0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e",
+		EventSig:     "0x" + strings.Repeat("d0", 32),
+		EventName:    events.OrderFilled,
+		Payload:      wideFill(),
+		Success:      true,
+	}
+	data, err := codec.JSON.Marshal(event)
+	require.NoError(t, err)
+	var consumed models.Event
+	require.NoError(t, codec.JSON.Unmarshal(data, &consumed))
+
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+	m, msg := pendingEvent(t, consumed)
+	w.add(ctx, m)
+	w.flush(ctx)
+	require.Equal(t, 1, msg.acks)
+
+	var takerAsset, makerAmount, rawTakerAsset string
+	require.NoError(t, pool.QueryRow(ctx, `
+		SELECT f.taker_asset_id::TEXT, f.maker_amount_filled::TEXT, e.payload->>'taker_asset_id'
+		FROM order_fills f JOIN events e USING (transaction_hash, log_index)
+	`).Scan(&takerAsset, &makerAmount, &rawTakerAsset))
+	require.Equal(t, twoTo255.String(), takerAsset)
+	require.Equal(t, maxUint256.String(), makerAmount)
+	require.Equal(t, twoTo255.String(), rawTakerAsset)
+}
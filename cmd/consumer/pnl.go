@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+var (
+	pnlWalletsReconciled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "polymarket_pnl_wallets_reconciled_total",
+		Help: "Total number of sampled wallets whose positions were replayed from the ledger",
+	})
+
+	pnlPositionsMismatched = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "polymarket_pnl_positions_mismatched",
+		Help: "Positions of the sampled wallets that differed from their replay at the last reconciliation",
+	})
+)
+
+const (
+	// defaultPnLReconcileSample is the default number of wallets replayed
+	// per reconciliation
+	defaultPnLReconcileSample = 100
+
+	// sampleWalletsQuery returns random wallets holding positions
+	sampleWalletsQuery = `
+		SELECT wallet FROM (SELECT DISTINCT wallet FROM wallet_positions) wallets
+		ORDER BY random() LIMIT $1
+	`
+
+	// reconcileWalletQuery replays the positions of a wallet and returns
+	// how many differed
+	reconcileWalletQuery = `SELECT reconcile_wallet_positions($1)`
+)
+
+// pnlDB is the database reconciliation samples and replays wallets in
+// (implemented by pgxpool.Pool).
+type pnlDB interface {
+	querier
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// reconcilePositions replays the positions of up to sample random wallets
+// from the ledger and returns how many wallets it replayed and how many
+// positions differed. Replayed positions replace the stored ones.
+func reconcilePositions(ctx context.Context, db pnlDB, sample int) (wallets, mismatched int, err error) {
+	rows, err := db.Query(ctx, sampleWalletsQuery, sample)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to sample wallets: %w", err)
+	}
+	sampled, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to sample wallets: %w", err)
+	}
+
+	for _, wallet := range sampled {
+		var differed int
+		if err := db.QueryRow(ctx, reconcileWalletQuery, wallet).Scan(&differed); err != nil {
+			return wallets, mismatched, fmt.Errorf("failed to reconcile wallet %s: %w", wallet, err)
+		}
+		wallets++
+		mismatched += differed
+	}
+	return wallets, mismatched, nil
+}
+
+// runPnLReconciliation reconciles a sample of wallets every interval until
+// ctx is cancelled. A mismatch means positions were applied out of order
+// without being replayed, or a transfer's sender was replayed after its
+// receiver; "migrate rebuild-pnl" rebuilds every position.
+func runPnLReconciliation(ctx context.Context, db pnlDB, interval time.Duration, sample int, logger zerolog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		wallets, mismatched, err := reconcilePositions(ctx, db, sample)
+		pnlWalletsReconciled.Add(float64(wallets))
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Warn().Err(err).Msg("failed to reconcile positions")
+			}
+			continue
+		}
+		pnlPositionsMismatched.Set(float64(mismatched))
+		if mismatched > 0 {
+			logger.Error().
+				Int("wallets", wallets).
+				Int("mismatched", mismatched).
+				Msg("positions differed from their ledger and were replayed")
+		}
+	}
+}
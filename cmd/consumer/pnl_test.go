@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// orderEvent returns a fill of an order of maker in a transaction of its
+// own per block. A zero makerAsset buys takerAsset, otherwise makerAsset is
+// sold; amounts are in base units and the fee is in the asset received.
+func orderEvent(block uint64, maker, taker string, makerAsset, takerAsset, makerAmount, takerAmount, fee int64) models.Event {
+	event := storetest.FillEvent(block, 0, 1_700_000_000+block, makerAmount, takerAmount)
+	fill := event.Payload.(models.OrderFilled)
+	fill.Maker, fill.Taker = maker, taker
+	fill.MakerAssetID, fill.TakerAssetID = big.NewInt(makerAsset), big.NewInt(takerAsset)
+	fill.Fee = big.NewInt(fee)
+	event.Payload = fill
+	return event
+}
+
+// positionsOf returns every stored position as "quantity cost_basis
+// realized_pnl", keyed by wallet and token id.
+func positionsOf(t *testing.T, pool *pgxpool.Pool) map[string]string {
+	t.Helper()
+	rows, err := pool.Query(context.Background(), `
+		SELECT wallet || '/' || token_id::TEXT,
+			concat_ws(' ', trim_scale(quantity), trim_scale(cost_basis), trim_scale(realized_pnl))
+		FROM wallet_positions`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	positions := make(map[string]string)
+	for rows.Next() {
+		var key, position string
+		require.NoError(t, rows.Scan(&key, &position))
+		positions[key] = position
+	}
+	require.NoError(t, rows.Err())
+	return positions
+}
+
+// TestPnLAgainstPostgres tests against Postgres that splits, buys, sells
+// with fees, transfers, operator fills and redemptions move positions at
+// average cost, that exchange settlement transfers are ignored, that
+// changes stored out of order replay their position, that removed events
+// are undone and that reconciliation and the rebuild agree with the ledger.
+func TestPnLAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	previous := storeConfig.Exchanges
+	storeConfig.Exchanges = map[string]bool{storetest.CTFExchange: true}
+	t.Cleanup(func() { storeConfig.Exchanges = previous })
+
+	// Outcome 0 (token 77) won
+	_, err := pool.Exec(ctx, `
+		INSERT INTO tokens (token_id, complement_token_id, condition_id, outcome_index, block_number, transaction_hash, log_index)
+		VALUES (77, 78, $1, 0, 1, '0x01', 0), (78, 77, $1, 1, 1, '0x01', 1)`, storetest.OpenInterestCondition)
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, `
+		INSERT INTO conditions (
+			condition_id, oracle, question_id, outcome_slot_count, block_number, block_timestamp,
+			transaction_hash, resolved, payout_numerators
+		) VALUES ($1, '0x01', '0x02', 2, 1, NOW(), '0x01', TRUE, '{1,0}')`, storetest.OpenInterestCondition)
+	require.NoError(t, err)
+
+	store := func(event models.Event) {
+		m, msg := pendingEvent(t, event)
+		w.add(ctx, m)
+		w.flush(ctx)
+		require.Equal(t, 1, msg.acks)
+	}
+
+	split := storetest.PositionEvent(events.PositionSplit, 100, 10_000_000, false)
+	store(split)
+	store(split) // redelivered
+	store(orderEvent(101, storetest.WalletA, storetest.WalletB, 0, 77, 6_000_000, 10_000_000, 0))
+	store(orderEvent(102, storetest.WalletA, storetest.WalletB, 77, 0, 5_000_000, 4_000_000, 100_000))
+	require.Equal(t, map[string]string{
+		storetest.WalletA + "/77": "15 8.25 1.15",
+		storetest.WalletA + "/78": "10 5 0",
+	}, positionsOf(t, pool))
+
+	store(storetest.TransferEvent(3, storetest.WalletA, storetest.WalletB, 77, 5_000_000))
+	settlement := storetest.TransferEvent(4, storetest.WalletB, storetest.WalletA, 77, 1_000_000)
+	transfer := settlement.Payload.(models.TransferSingle)
+	transfer.Operator = storetest.CTFExchange
+	settlement.Payload = transfer
+	store(settlement)
+	store(storetest.PositionEvent(events.PayoutRedemption, 105, 10_000_000, false))
+	store(orderEvent(106, storetest.WalletB, storetest.CTFExchange, 0, 77, 2_000_000, 4_000_000, 500_000))
+	require.Equal(t, map[string]string{
+		storetest.WalletA + "/77": "0 0 5.65",
+		storetest.WalletA + "/78": "0 0 -5",
+		storetest.WalletB + "/77": "8.5 4.75 0",
+	}, positionsOf(t, pool))
+
+	var realized int
+	require.NoError(t, pool.QueryRow(ctx, "SELECT count(*) FROM realized_pnl WHERE wallet = $1", storetest.WalletA).Scan(&realized))
+	require.Equal(t, 3, realized)
+
+	// A buy stored after a later sell replays the position
+	sell := orderEvent(107, storetest.WalletB, storetest.WalletA, 77, 0, 4_000_000, 3_600_000, 0)
+	store(sell)
+	require.Equal(t, "4.5 2.514706 1.364706", positionsOf(t, pool)[storetest.WalletB+"/77"])
+	store(orderEvent(99, storetest.WalletB, storetest.WalletA, 0, 77, 1_000_000, 2_000_000, 0))
+	require.Equal(t, "6.5 3.559524 1.409524", positionsOf(t, pool)[storetest.WalletB+"/77"])
+
+	// The sell is reorged out
+	removed := sell
+	removed.Success = false
+	store(removed)
+	require.Equal(t, "10.5 5.75 0", positionsOf(t, pool)[storetest.WalletB+"/77"])
+	require.NoError(t, pool.QueryRow(ctx, "SELECT count(*) FROM realized_pnl WHERE wallet = $1", storetest.WalletB).Scan(&realized))
+	require.Zero(t, realized)
+
+	// Reconciliation replays positions that drifted from the ledger
+	wallets, mismatched, err := reconcilePositions(ctx, pool, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, wallets)
+	require.Zero(t, mismatched)
+
+	_, err = pool.Exec(ctx, "UPDATE wallet_positions SET quantity = 1 WHERE wallet = $1", storetest.WalletB)
+	require.NoError(t, err)
+	_, mismatched, err = reconcilePositions(ctx, pool, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, mismatched)
+	expected := positionsOf(t, pool)
+	require.Equal(t, "10.5 5.75 0", expected[storetest.WalletB+"/77"])
+
+	// The rebuild replays every stored event
+	var recorded int64
+	require.NoError(t, pool.QueryRow(ctx, "SELECT rebuild_position_changes($1)", storeConfig.SettlementExchanges()).Scan(&recorded))
+	require.Equal(t, int64(10), recorded)
+	require.Equal(t, expected, positionsOf(t, pool))
+}
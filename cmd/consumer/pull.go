@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+)
+
+// Consumption modes (consumer.mode).
+const (
+	modePush = "push" // Consume callback, flushed by partitioned workers
+	modePull = "pull" // Fetch loop, one transaction per fetched batch
+)
+
+const (
+	// defaultFetchMaxWait is the default time a fetch waits for a full batch
+	defaultFetchMaxWait = time.Second
+
+	// fetchRetryDelay is the time waited after a failed fetch
+	fetchRetryDelay = time.Second
+)
+
+// parseMode validates a consumption mode; empty is push.
+func parseMode(mode string) (string, error) {
+	switch mode {
+	case "", modePush:
+		return modePush, nil
+	case modePull:
+		return modePull, nil
+	}
+	return "", fmt.Errorf("unknown consumer mode %q (expected %q or %q)", mode, modePush, modePull)
+}
+
+// fetcher fetches batches of messages (implemented by jetstream.Consumer).
+type fetcher interface {
+	Fetch(batch int, opts ...jetstream.FetchOpt) (jetstream.MessageBatch, error)
+}
+
+// fetchLoop fetches and writes batches until its context is done
+// (implemented by pullConsumer and clickhouseConsumer).
+type fetchLoop interface {
+	run(ctx, writeCtx context.Context)
+}
+
+// pullConsumer fetches up to batchSize messages at a time, waiting at most
+// maxWait for a batch to fill, and writes every fetched batch as one
+// transaction with the writer's buffering code: the batch is acknowledged
+// once it commits, and rejected as a whole for redelivery if it fails
+// (split only when Postgres rejects its data, see batchWriter.flush).
+// Unlike the push mode, at most one batch is delivered and unacknowledged
+// at a time, so prefetch is bounded by batchSize.
+type pullConsumer struct {
+	consumer  fetcher
+	writer    *batchWriter
+	batchSize int
+	maxWait   time.Duration
+	logger    zerolog.Logger
+}
+
+// newPullConsumer creates a pull consumer writing to db.
+func newPullConsumer(c fetcher, db txBeginner, batchSize int, maxWait time.Duration, logger zerolog.Logger) *pullConsumer {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	if maxWait <= 0 {
+		maxWait = defaultFetchMaxWait
+	}
+	writer := newBatchWriter(db, batchSize, logger)
+	writer.rejectBatch = true
+	return &pullConsumer{
+		consumer:  c,
+		writer:    writer,
+		batchSize: batchSize,
+		maxWait:   maxWait,
+		logger:    logger,
+	}
+}
+
+// run fetches and writes batches until ctx is done. A fetch in progress is
+// finished and its batch written before run returns; it writes in
+// writeCtx, so it can outlive ctx during shutdown.
+func (p *pullConsumer) run(ctx, writeCtx context.Context) {
+	for ctx.Err() == nil {
+		if err := p.fetch(writeCtx); err != nil {
+			consumer.ConsumeErrors.WithLabelValues("fetch").Inc()
+			p.logger.Warn().Err(err).Msg("failed to fetch messages")
+			select {
+			case <-ctx.Done():
+			case <-time.After(fetchRetryDelay):
+			}
+		}
+	}
+}
+
+// fetch fetches one batch and writes it. Messages received before the
+// fetch failed are still written.
+func (p *pullConsumer) fetch(ctx context.Context) error {
+	batch, err := p.consumer.Fetch(p.batchSize, jetstream.FetchMaxWait(p.maxWait))
+	if err != nil {
+		return err
+	}
+	for msg := range batch.Messages() {
+		if pending, ok := handleMessage(ctx, msg, p.logger); ok {
+			p.writer.add(ctx, pending)
+		}
+	}
+	p.writer.flush(ctx)
+
+	// A batch that did not fill within maxWait ends without an error
+	return batch.Error()
+}
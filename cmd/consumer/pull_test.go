@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestParseMode tests that push is the default mode and that unknown modes
+// are rejected.
+func TestParseMode(t *testing.T) {
+	for input, want := range map[string]string{"": modePush, "push": modePush, "pull": modePull} {
+		mode, err := parseMode(input)
+		require.NoError(t, err)
+		require.Equal(t, want, mode)
+	}
+	_, err := parseMode("poll")
+	require.Error(t, err)
+}
+
+// TestBatchWriterRejectsBatch tests that a writer rejecting batches
+// redelivers every message of a batch that failed for a transient reason,
+// and still splits a batch whose data the database rejected.
+func TestBatchWriterRejectsBatch(t *testing.T) {
+	db := &fakeDB{}
+	w := newBatchWriter(db, 10, zerolog.Nop())
+	w.rejectBatch = true
+
+	good, goodMsg := testPending("INSERT good")
+	unavailable, unavailableMsg := testPending("DOWN")
+	w.add(context.Background(), good)
+	w.add(context.Background(), unavailable)
+	w.flush(context.Background())
+
+	require.Len(t, db.batches, 1, "not written one by one")
+	require.Zero(t, db.commits)
+	for _, msg := range []*fakeMsg{goodMsg, unavailableMsg} {
+		require.Zero(t, msg.acks+msg.terms)
+		require.Equal(t, 1, msg.naks)
+		require.Equal(t, nakDelays[0], msg.nakDelay)
+	}
+
+	good, goodMsg = testPending("INSERT good")
+	invalid, invalidMsg := testPending("FAIL")
+	w.add(context.Background(), good)
+	w.add(context.Background(), invalid)
+	w.flush(context.Background())
+
+	require.Len(t, db.batches, 4)
+	require.Equal(t, 1, goodMsg.acks)
+	require.Equal(t, 1, invalidMsg.terms)
+}
+
+// fakeFetcher returns its batches in order, then cancels stop and returns
+// empty batches.
+type fakeFetcher struct {
+	batches  [][]jetstream.Msg
+	fetchErr error // Returned by the first fetch
+	stop     context.CancelFunc
+
+	fetches int
+	sizes   []int
+}
+
+func (f *fakeFetcher) Fetch(batch int, _ ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	f.fetches++
+	f.sizes = append(f.sizes, batch)
+	if f.fetchErr != nil {
+		err := f.fetchErr
+		f.fetchErr = nil
+		return nil, err
+	}
+
+	msgs := make(chan jetstream.Msg, batch)
+	if len(f.batches) == 0 {
+		f.stop()
+	} else {
+		for _, msg := range f.batches[0] {
+			msgs <- msg
+		}
+		f.batches = f.batches[1:]
+	}
+	close(msgs)
+	return &fakeMessageBatch{msgs: msgs}, nil
+}
+
+// fakeMessageBatch is a fetched batch whose messages are all received.
+type fakeMessageBatch struct {
+	msgs chan jetstream.Msg
+	err  error
+}
+
+func (b *fakeMessageBatch) Messages() <-chan jetstream.Msg { return b.msgs }
+func (b *fakeMessageBatch) Error() error                   { return b.err }
+
+// eventMsg returns a message carrying a JSON encoded event.
+func eventMsg(t *testing.T, event models.Event) *fakeMsg {
+	t.Helper()
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	return &fakeMsg{subject: "POLYMARKET." + event.EventName + ".0xab", header: nats.Header{}, data: data, delivered: 1}
+}
+
+// cancelledEvent returns an OrderCancelled event, stored as a raw event only.
+func cancelledEvent(logIndex uint) models.Event {
+	return models.Event{
+		EventName: events.OrderCancelled,
+		TxHash:    "0x" + strings.Repeat("01", 32),
+		LogIndex:  logIndex,
+		Success:   true,
+		Payload:   models.OrderCancelled{OrderHash: "0x" + strings.Repeat("0a", 32)},
+	}
+}
+
+// TestPullConsumerWritesFetchedBatches tests that every fetched batch is
+// written in one transaction and acknowledged after it commits, that
+// skipped and undecodable messages are settled without being written, and
+// that a failed fetch is retried.
+func TestPullConsumerWritesFetchedBatches(t *testing.T) {
+	cancelled := func(logIndex uint) *fakeMsg {
+		return eventMsg(t, cancelledEvent(logIndex))
+	}
+	first := []*fakeMsg{cancelled(0), cancelled(1)}
+	deadLetter := &fakeMsg{subject: "POLYMARKET.OrderFilled.0xab", header: nats.Header{codec.HeaderDeadLetter: []string{"publish_failed"}}, delivered: 1}
+	undecodable := &fakeMsg{subject: "POLYMARKET.OrderFilled.0xab", header: nats.Header{}, data: []byte("{not json"), delivered: 1}
+	second := cancelled(2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := &fakeFetcher{
+		batches: [][]jetstream.Msg{
+			{first[0], first[1]},
+			{deadLetter, undecodable, second},
+		},
+		fetchErr: errors.New("nats: connection closed"),
+		stop:     cancel,
+	}
+	db := &fakeDB{}
+	p := newPullConsumer(f, db, 50, 10*time.Millisecond, zerolog.Nop())
+	fetchErrors := testutil.ToFloat64(consumer.ConsumeErrors.WithLabelValues("fetch"))
+
+	done := make(chan struct{})
+	go func() {
+		p.run(ctx, context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pull consumer did not stop")
+	}
+
+	require.Equal(t, fetchErrors+1, testutil.ToFloat64(consumer.ConsumeErrors.WithLabelValues("fetch")))
+	require.Equal(t, 4, f.fetches)
+	require.Equal(t, []int{50, 50, 50, 50}, f.sizes)
+
+	require.Len(t, db.batches, 2, "one transaction per fetched batch")
+	require.Len(t, db.batches[0], 4, "two messages of two statements")
+	require.Len(t, db.batches[1], 2)
+	require.Equal(t, 2, db.commits)
+	for _, msg := range append(first, second, deadLetter) {
+		require.Equal(t, 1, msg.acks, msg.subject)
+	}
+	require.Zero(t, undecodable.acks)
+	require.Equal(t, 1, undecodable.terms)
+}
+
+// TestPullConsumerRejectsFailedBatch tests that the messages of a fetched
+// batch whose transaction fails are all redelivered.
+func TestPullConsumerRejectsFailedBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgs := []*fakeMsg{eventMsg(t, cancelledEvent(0)), eventMsg(t, cancelledEvent(1))}
+	f := &fakeFetcher{batches: [][]jetstream.Msg{{msgs[0], msgs[1]}}, stop: cancel}
+	db := &fakeDB{commitErr: errors.New("connection lost")}
+	p := newPullConsumer(f, db, 10, 10*time.Millisecond, zerolog.Nop())
+
+	p.run(ctx, context.Background())
+
+	require.Len(t, db.batches, 1)
+	for _, msg := range msgs {
+		require.Zero(t, msg.acks)
+		require.Equal(t, 1, msg.naks)
+	}
+}
+
+// TestOldestUnackedMessage tests that a consumed message counts towards the
+// oldest unacked age until the batch writing it is acknowledged.
+func TestOldestUnackedMessage(t *testing.T) {
+	msg := eventMsg(t, cancelledEvent(0))
+	msg.sequence = 1 << 40
+	msg.published = time.Now().Add(-24 * 365 * time.Hour)
+
+	pending, ok := handleMessage(context.Background(), msg, zerolog.Nop())
+	require.True(t, ok)
+	require.GreaterOrEqual(t, testutil.ToFloat64(consumer.OldestUnackedAge), (24 * 365 * time.Hour).Seconds())
+
+	w := newBatchWriter(&fakeDB{}, 10, zerolog.Nop())
+	w.add(context.Background(), pending)
+	w.flush(context.Background())
+	require.Equal(t, 1, msg.acks)
+	require.Less(t, testutil.ToFloat64(consumer.OldestUnackedAge), (24 * 365 * time.Hour).Seconds())
+}
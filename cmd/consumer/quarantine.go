@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultQuarantineLimit is the default number of quarantined events
+	// listed by /admin/quarantine
+	defaultQuarantineLimit = 100
+
+	// maxQuarantineLimit bounds the limit parameter of /admin/quarantine
+	maxQuarantineLimit = 1000
+)
+
+// quarantinedEvent is a row of quarantined_events.
+type quarantinedEvent struct {
+	ID             int64           `json:"id"`
+	QuarantinedAt  time.Time       `json:"quarantined_at"`
+	Subject        string          `json:"subject"`
+	StreamSequence *int64          `json:"stream_sequence"`
+	EventType      string          `json:"event_type"`
+	Reason         string          `json:"reason"`
+	Detail         string          `json:"detail"`
+	BlockNumber    *int64          `json:"block_number"`
+	TxHash         *string         `json:"transaction_hash"`
+	LogIndex       *int32          `json:"log_index"`
+	Event          json.RawMessage `json:"event"`
+}
+
+// rowsQuerier runs a query returning rows (implemented by pgxpool.Pool).
+type rowsQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// listQuarantined returns the last limit quarantined events, newest first,
+// of one reason or of all when reason is empty.
+func listQuarantined(ctx context.Context, db rowsQuerier, reason string, limit int) ([]quarantinedEvent, error) {
+	query := `
+		SELECT id, quarantined_at, subject, stream_sequence, event_type, reason, detail,
+		       block_number, transaction_hash, log_index, event
+		FROM quarantined_events
+		WHERE $1 = '' OR reason = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`
+
+	rows, err := db.Query(ctx, query, reason, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quarantined events: %w", err)
+	}
+	defer rows.Close()
+
+	quarantined := []quarantinedEvent{}
+	for rows.Next() {
+		var q quarantinedEvent
+		if err := rows.Scan(&q.ID, &q.QuarantinedAt, &q.Subject, &q.StreamSequence, &q.EventType,
+			&q.Reason, &q.Detail, &q.BlockNumber, &q.TxHash, &q.LogIndex, &q.Event); err != nil {
+			return nil, fmt.Errorf("failed to scan quarantined event: %w", err)
+		}
+		quarantined = append(quarantined, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read quarantined events: %w", err)
+	}
+	return quarantined, nil
+}
+
+// adminQuarantineHandler returns the /admin/quarantine handler.
+//
+//	GET - list the last quarantined events (?reason=missing_field&limit=100)
+func adminQuarantineHandler(db rowsQuerier, logger zerolog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := defaultQuarantineLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 || n > maxQuarantineLimit {
+				http.Error(w, fmt.Sprintf("invalid limit: %s (1 to %d)", value, maxQuarantineLimit), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		quarantined, err := listQuarantined(r.Context(), db, r.URL.Query().Get("reason"), limit)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to list quarantined events")
+			http.Error(w, "failed to list quarantined events", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"quarantined": quarantined})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// malformedBatch returns a message carrying a TransferBatch event with one
+// amount for two token ids.
+func malformedBatch(t *testing.T, sequence uint64) *fakeMsg {
+	payload := storetest.Payloads[events.TransferBatch].(models.TransferBatch)
+	payload.Amounts = payload.Amounts[:1]
+	msg := eventMsg(t, models.Event{
+		Block:     100,
+		EventName: events.TransferBatch,
+		TxHash:    storetest.TxHash,
+		LogIndex:  7,
+		Success:   true,
+		Payload:   payload,
+	})
+	msg.sequence = sequence
+	return msg
+}
+
+// TestProcessMessageQuarantines tests that a malformed event is written to
+// quarantined_events in place of its rows, then acknowledged without being
+// counted as stored.
+func TestProcessMessageQuarantines(t *testing.T) {
+	msg := malformedBatch(t, 42)
+	pending, err := processMessage(context.Background(), msg, zerolog.Nop())
+	require.NoError(t, err)
+	require.NotNil(t, pending)
+	require.True(t, pending.quarantined)
+	require.Len(t, pending.statements, 1)
+
+	st := pending.statements[0]
+	require.Contains(t, st.Query, "INSERT INTO quarantined_events")
+	require.Equal(t, []any{
+		msg.subject, uint64(42), events.TransferBatch, "length_mismatch", "2 token_ids and 1 amounts",
+		uint64(100), storetest.TxHash, uint(7), msg.data,
+	}, st.Args)
+
+	counter := consumer.EventsQuarantined.WithLabelValues(events.TransferBatch, "length_mismatch")
+	quarantined := testutil.ToFloat64(counter)
+	st.Observe(pgconn.NewCommandTag("INSERT 0 1"))
+	require.Equal(t, quarantined+1, testutil.ToFloat64(counter))
+	st.Observe(pgconn.NewCommandTag("INSERT 0 0"))
+	require.Equal(t, quarantined+1, testutil.ToFloat64(counter), "redelivered")
+
+	stored := testutil.ToFloat64(consumer.EventsStored.WithLabelValues(events.TransferBatch))
+	_, _, counts := progress.snapshot()
+	db := &fakeDB{}
+	w := newBatchWriter(db, 10, zerolog.Nop())
+	w.add(context.Background(), *pending)
+	w.flush(context.Background())
+
+	require.Equal(t, 1, db.commits)
+	require.Equal(t, 1, msg.acks)
+	require.Zero(t, msg.naks+msg.terms)
+	require.Equal(t, stored, testutil.ToFloat64(consumer.EventsStored.WithLabelValues(events.TransferBatch)))
+	_, _, after := progress.snapshot()
+	require.Equal(t, counts[events.TransferBatch], after[events.TransferBatch])
+}
+
+// failingQuerier fails every query, recording its arguments.
+type failingQuerier struct {
+	args []any
+}
+
+func (q *failingQuerier) Query(_ context.Context, _ string, args ...any) (pgx.Rows, error) {
+	q.args = args
+	return nil, errors.New("connection refused")
+}
+
+// TestAdminQuarantineHandler tests the parameters of /admin/quarantine.
+func TestAdminQuarantineHandler(t *testing.T) {
+	db := &failingQuerier{}
+	handler := adminQuarantineHandler(db, zerolog.Nop())
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	require.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/admin/quarantine").Code)
+	for _, limit := range []string{"0", "-1", "ten", "1001"} {
+		require.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/admin/quarantine?limit="+limit).Code, limit)
+	}
+	require.Nil(t, db.args, "invalid requests do not query")
+
+	require.Equal(t, http.StatusInternalServerError, serve(http.MethodGet, "/admin/quarantine").Code)
+	require.Equal(t, []any{"", defaultQuarantineLimit}, db.args)
+	serve(http.MethodGet, "/admin/quarantine?reason=missing_field&limit=5")
+	require.Equal(t, []any{"missing_field", 5}, db.args)
+}
+
+// TestQuarantineAgainstPostgres tests against TimescaleDB that malformed
+// events are quarantined once, whatever their redeliveries, and listed by
+// the admin endpoint.
+func TestQuarantineAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	msgs := []*fakeMsg{malformedBatch(t, 1), malformedBatch(t, 1), malformedBatch(t, 2)}
+	for _, msg := range msgs {
+		pending, err := processMessage(ctx, msg, zerolog.Nop())
+		require.NoError(t, err)
+		w.add(ctx, *pending)
+	}
+	w.flush(ctx)
+	for _, msg := range msgs {
+		require.Equal(t, 1, msg.acks)
+	}
+	require.Zero(t, countEvents(t, pool), "nothing stored")
+
+	rec := httptest.NewRecorder()
+	adminQuarantineHandler(pool, zerolog.Nop())(rec, httptest.NewRequest(http.MethodGet, "/admin/quarantine?reason=length_mismatch", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Quarantined []quarantinedEvent `json:"quarantined"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.Quarantined, 2)
+	latest := body.Quarantined[0]
+	require.Equal(t, int64(2), *latest.StreamSequence)
+	require.Equal(t, events.TransferBatch, latest.EventType)
+	require.Equal(t, "2 token_ids and 1 amounts", latest.Detail)
+	require.Equal(t, storetest.TxHash, *latest.TxHash)
+	require.True(t, strings.Contains(string(latest.Event), `"amounts"`))
+
+	none, err := listQuarantined(ctx, pool, "missing_field", 10)
+	require.NoError(t, err)
+	require.Empty(t, none)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/internal/store/postgres"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// rebuildTables maps each derived table the rebuild mode regenerates to the
+// events its rows are derived from. Replaying an event regenerates every
+// row derived from it, so tables sharing events are rebuilt together.
+// conditions is left out: replaying a preparation would drop its resolution
+// and market metadata. Rebuilding condition_resolutions snapshots the
+// holders of the replayed conditions again; backfilling it does not.
+var rebuildTables = map[string][]string{
+	"order_fills":           {events.OrderFilled},
+	"trades":                {events.OrderFilled},
+	"candles":               {events.OrderFilled},
+	"token_registrations":   {events.TokenRegistered},
+	"tokens":                {events.TokenRegistered},
+	"token_transfers":       {events.TransferSingle, events.TransferBatch},
+	"balances":              {events.TransferSingle, events.TransferBatch},
+	"collateral_transfers":  {events.ERC20Transfer},
+	"condition_resolutions": {events.ConditionResolution},
+	"position_splits":       {events.PositionSplit},
+	"position_merges":       {events.PositionsMerge},
+	"payout_redemptions":    {events.PayoutRedemption},
+	"open_interest":         {events.PositionSplit, events.PositionsMerge, events.PayoutRedemption},
+	"wallet_positions":      positionEventTypes(),
+	"realized_pnl":          positionEventTypes(),
+}
+
+// positionEventTypes returns the event types of store.PositionEvents.
+func positionEventTypes() []string {
+	types := make([]string, 0, len(store.PositionEvents))
+	for eventType := range store.PositionEvents {
+		types = append(types, eventType)
+	}
+	return types
+}
+
+// parseRebuildTables returns the event types to replay to rebuild a
+// comma-separated list of derived tables, sorted and without duplicates.
+func parseRebuildTables(spec string) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, table := range strings.Split(spec, ",") {
+		table = strings.TrimSpace(table)
+		if table == "" {
+			continue
+		}
+		eventTypes, ok := rebuildTables[table]
+		if !ok {
+			supported := make([]string, 0, len(rebuildTables))
+			for name := range rebuildTables {
+				supported = append(supported, name)
+			}
+			sort.Strings(supported)
+			return nil, fmt.Errorf("table %q cannot be rebuilt, expected one of %s", table, strings.Join(supported, ", "))
+		}
+		for _, eventType := range eventTypes {
+			selected[eventType] = true
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no table to rebuild")
+	}
+
+	eventTypes := make([]string, 0, len(selected))
+	for eventType := range selected {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+	return eventTypes, nil
+}
+
+// replayStatements returns the statements regenerating the derived rows of
+// a stored event: its reversal, keeping the raw row, followed by the
+// statements the live path stores it with.
+func replayStatements(ctx context.Context, eventType string, event models.Event, logger zerolog.Logger) ([]postgres.Statement, error) {
+	recorder := postgres.Recorder{}
+	s := postgresStore(&recorder, logger)
+	reversals, err := s.Reversals(eventType, event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build reversals: %w", err)
+	}
+
+	// The raw row, deleted last by a reversal, is the source of truth
+	recorder.Statements = reversals[:len(reversals)-1]
+	if err := store.StoreEvent(ctx, s, eventType, event); err != nil {
+		return nil, err
+	}
+	return recorder.Statements, nil
+}
+
+// rebuildOptions selects the stored events a rebuild replays.
+type rebuildOptions struct {
+	eventTypes []string
+	fromBlock  uint64
+	toBlock    uint64 // 0 replays up to the last stored block
+	batchSize  int
+
+	// backfill stores the events again without reversing their rows, so
+	// only rows missing from the derived tables are inserted
+	backfill bool
+	// checkpoint names the backfill_progress row recording the last event
+	// replayed, so an interrupted run resumes after it ("" for none)
+	checkpoint string
+}
+
+const (
+	// rebuildCountQuery counts the stored events a rebuild replays. Events
+	// of other handlers of the same logs (fan-out) are left out by name.
+	rebuildCountQuery = `
+		SELECT count(*) FROM events
+		WHERE event_signature = ANY($1) AND event_name = ANY($4)
+		  AND block_number >= $2 AND ($3::BIGINT = 0 OR block_number <= $3)
+	`
+
+	// rebuildPageQuery reads the next page of stored events after
+	// (block_number, log_index) and locks them, so a reorg removing one
+	// waits for the page to commit instead of having its rows stored again
+	rebuildPageQuery = `
+		SELECT block_number, block_hash, extract(epoch FROM block_timestamp)::BIGINT, transaction_hash,
+			log_index, contract_address, event_signature, payload
+		FROM events
+		WHERE event_signature = ANY($1) AND event_name = ANY($7)
+		  AND block_number >= $2 AND ($3::BIGINT = 0 OR block_number <= $3)
+		  AND (block_number, log_index) > ($4, $5)
+		ORDER BY block_number, log_index
+		LIMIT $6
+		FOR SHARE
+	`
+)
+
+// rebuildDB is the database a rebuild reads and replays events in
+// (implemented by pgxpool.Pool).
+type rebuildDB interface {
+	txBeginner
+	querier
+}
+
+// rebuildDerived replays the stored raw events selected by opts in block and
+// log order through the live store path, regenerating their derived rows,
+// and returns the number of events replayed. Each page of batchSize events
+// is replayed in one transaction, so it is safe to run while the consumer
+// writes; a failed page is rolled back and the rebuild can be resumed from
+// the last block it reported, or from its checkpoint when it has one.
+func rebuildDerived(ctx context.Context, db rebuildDB, opts rebuildOptions, logger zerolog.Logger) (int, error) {
+	if opts.batchSize <= 0 {
+		opts.batchSize = defaultBatchSize
+	}
+
+	eventTypes := make(map[string]string, len(opts.eventTypes))
+	signatures := make([]string, 0, len(opts.eventTypes))
+	for _, eventType := range opts.eventTypes {
+		def, ok := events.Lookup(eventType)
+		if !ok {
+			return 0, fmt.Errorf("event %q is not registered", eventType)
+		}
+		eventTypes[def.Signature.Hex()] = eventType
+		signatures = append(signatures, def.Signature.Hex())
+	}
+
+	var replayed int
+	last := models.Event{Block: opts.fromBlock}
+	lastLogIndex := -1
+	if opts.checkpoint != "" {
+		progress, err := startBackfill(ctx, db, opts)
+		if err != nil {
+			return 0, err
+		}
+		if progress.completed {
+			logger.Info().Str("backfill", opts.checkpoint).Int("replayed", progress.replayed).Msg("backfill already complete")
+			return 0, nil
+		}
+		if progress.lastBlock != nil {
+			replayed = progress.replayed
+			last.Block, lastLogIndex = *progress.lastBlock, *progress.lastLogIndex
+			logger.Info().
+				Str("backfill", opts.checkpoint).
+				Int("replayed", replayed).
+				Uint64("block", last.Block).
+				Msg("resuming backfill")
+		}
+	}
+
+	var total int
+	if err := db.QueryRow(ctx, rebuildCountQuery, signatures, opts.fromBlock, opts.toBlock, opts.eventTypes).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to count events: %w", err)
+	}
+	logger.Info().
+		Strs("event_types", opts.eventTypes).
+		Uint64("from_block", opts.fromBlock).
+		Uint64("to_block", opts.toBlock).
+		Bool("backfill", opts.backfill).
+		Int("events", total).
+		Msg("rebuilding derived tables")
+
+	for {
+		page, err := rebuildPage(ctx, db, eventTypes, signatures, opts, last.Block, lastLogIndex, logger)
+		if err != nil {
+			return replayed, fmt.Errorf("failed to rebuild from block %d: %w", last.Block, err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		replayed += len(page)
+		last = page[len(page)-1]
+		lastLogIndex = int(last.LogIndex)
+
+		logger.Info().
+			Int("replayed", replayed).
+			Int("events", total).
+			Uint64("block", last.Block).
+			Msg("rebuild progress")
+		if len(page) < opts.batchSize {
+			break
+		}
+	}
+
+	if opts.checkpoint != "" {
+		total, err := completeBackfill(ctx, db, opts.checkpoint)
+		if err != nil {
+			return replayed, err
+		}
+		replayed = total
+	}
+	return replayed, nil
+}
+
+// rebuildPage replays the page of stored events after (afterBlock,
+// afterLogIndex) in one transaction and returns the replayed events.
+func rebuildPage(
+	ctx context.Context,
+	db txBeginner,
+	eventTypes map[string]string,
+	signatures []string,
+	opts rebuildOptions,
+	afterBlock uint64,
+	afterLogIndex int,
+	logger zerolog.Logger,
+) ([]models.Event, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// Rolling back after a commit is a no-op
+	defer tx.Rollback(context.Background())
+
+	rows, err := tx.Query(ctx, rebuildPageQuery,
+		signatures, opts.fromBlock, opts.toBlock, afterBlock, afterLogIndex, opts.batchSize, opts.eventTypes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	var page []models.Event
+	for rows.Next() {
+		var event models.Event
+		var payload []byte
+		if err := rows.Scan(
+			&event.Block, &event.BlockHash, &event.Timestamp, &event.TxHash,
+			&event.LogIndex, &event.ContractAddr, &event.EventSig, &payload,
+		); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read events: %w", err)
+		}
+		event.EventName = eventTypes[event.EventSig]
+		event.Payload = json.RawMessage(payload)
+		event.Success = true
+		page = append(page, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	if len(page) == 0 {
+		return nil, nil
+	}
+
+	var statements []postgres.Statement
+	for _, event := range page {
+		var replay []postgres.Statement
+		if opts.backfill {
+			recorder := postgres.Recorder{}
+			err = store.StoreEvent(ctx, postgresStore(&recorder, logger), event.EventName, event)
+			replay = recorder.Statements
+		} else {
+			replay, err = replayStatements(ctx, event.EventName, event, logger)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay %s %s/%d: %w", event.EventName, event.TxHash, event.LogIndex, err)
+		}
+		statements = append(statements, replay...)
+	}
+	if opts.checkpoint != "" {
+		last := page[len(page)-1]
+		statements = append(statements, checkpointStatement(opts.checkpoint, last.Block, last.LogIndex, len(page)))
+	}
+
+	tags, err := execStatements(ctx, tx, statements)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit events: %w", err)
+	}
+	observeStatements(statements, tags)
+	return page, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+)
+
+// TestParseRebuildTables tests that tables map to the events they are
+// derived from, once each and in a stable order, and that unknown tables
+// are rejected.
+func TestParseRebuildTables(t *testing.T) {
+	eventTypes, err := parseRebuildTables("order_fills, trades")
+	require.NoError(t, err)
+	require.Equal(t, []string{events.OrderFilled}, eventTypes)
+
+	eventTypes, err = parseRebuildTables("open_interest,balances")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		events.PayoutRedemption, events.PositionSplit, events.PositionsMerge,
+		events.TransferBatch, events.TransferSingle,
+	}, eventTypes)
+
+	_, err = parseRebuildTables("conditions")
+	require.ErrorContains(t, err, `table "conditions" cannot be rebuilt`)
+
+	_, err = parseRebuildTables(" , ")
+	require.Error(t, err)
+}
+
+// TestReplayStatementsKeepsRawEvent tests that a replay removes the derived
+// rows of an event and stores them again without deleting its raw row.
+func TestReplayStatementsKeepsRawEvent(t *testing.T) {
+	statements, err := replayStatements(context.Background(), events.OrderFilled, storetest.FillEvent(100, 1, 1_700_000_123, 1_000_000, 2_000_000), zerolog.Nop())
+	require.NoError(t, err)
+
+	require.Contains(t, statements[0].Query, "DELETE FROM order_fills")
+	require.Contains(t, statements[len(statements)-1].Query, "UPDATE events SET processed = true")
+	for _, s := range statements {
+		require.NotContains(t, s.Query, "DELETE FROM events")
+	}
+}
+
+// TestRebuildAgainstPostgres tests against Postgres that a rebuild repairs
+// corrupted and missing derived rows of the events in its block range, one
+// page at a time, and leaves the raw events and the rows outside the range
+// alone.
+func TestRebuildAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	w := newBatchWriter(pool, 10, zerolog.Nop())
+
+	for block := uint64(100); block <= 102; block++ {
+		event := storetest.FillEvent(block, 0, 1_700_000_000+block, 500_000, 1_000_000)
+		event.EventSig = events.MustLookup(events.OrderFilled).Signature.Hex()
+		m, msg := pendingEvent(t, event)
+		w.add(ctx, m)
+		w.flush(ctx)
+		require.Equal(t, 1, msg.acks)
+	}
+
+	_, err := pool.Exec(ctx, "UPDATE trades SET price = 0.99 WHERE block_number IN (100, 101)")
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, "DELETE FROM order_fills WHERE block_number = 102")
+	require.NoError(t, err)
+
+	prices := func() []string {
+		rows, err := pool.Query(ctx, "SELECT price::TEXT FROM trades ORDER BY block_number")
+		require.NoError(t, err)
+		defer rows.Close()
+		var prices []string
+		for rows.Next() {
+			var price string
+			require.NoError(t, rows.Scan(&price))
+			prices = append(prices, price)
+		}
+		require.NoError(t, rows.Err())
+		return prices
+	}
+
+	replayed, err := rebuildDerived(ctx, pool, rebuildOptions{
+		eventTypes: []string{events.OrderFilled},
+		fromBlock:  101,
+		batchSize:  1,
+	}, zerolog.Nop())
+	require.NoError(t, err)
+	require.Equal(t, 2, replayed)
+	require.Equal(t, []string{"0.990000", "0.500000", "0.500000"}, prices())
+
+	var fills int
+	require.NoError(t, pool.QueryRow(ctx, "SELECT count(*) FROM order_fills").Scan(&fills))
+	require.Equal(t, 3, fills)
+	require.Equal(t, 3, countEvents(t, pool))
+
+	replayed, err = rebuildDerived(ctx, pool, rebuildOptions{
+		eventTypes: []string{events.OrderFilled},
+		fromBlock:  100,
+		toBlock:    100,
+	}, zerolog.Nop())
+	require.NoError(t, err)
+	require.Equal(t, 1, replayed)
+	require.Equal(t, []string{"0.500000", "0.500000", "0.500000"}, prices())
+}
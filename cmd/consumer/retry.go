@@ -0,0 +1,80 @@
+package main
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+)
+
+// Rejection outcomes.
+const (
+	rejectRetry     = "retry"     // Redelivered after a delay
+	rejectPermanent = "permanent" // Terminated, it would fail on every delivery
+	rejectExhausted = "exhausted" // Terminated on its last delivery
+)
+
+// nakDelays are the redelivery delays after the first, second, ... failed
+// delivery of a message, long enough to ride out a Postgres restart or
+// failover rather than burning every delivery within a second.
+var nakDelays = [...]time.Duration{5 * time.Second, 30 * time.Second, 2 * time.Minute}
+
+// consumerMaxDeliver gives a message one delivery per delay plus the first.
+const consumerMaxDeliver = len(nakDelays) + 1
+
+// nakDelay returns the delay before redelivering a message that failed on
+// its numDelivered-th delivery.
+func nakDelay(numDelivered uint64) time.Duration {
+	if numDelivered == 0 {
+		numDelivered = 1
+	}
+	if numDelivered > uint64(len(nakDelays)) {
+		return nakDelays[len(nakDelays)-1]
+	}
+	return nakDelays[numDelivered-1]
+}
+
+// rejectMessage settles a message that failed with err. Permanent failures
+// and failures on the last delivery are terminated, which JetStream reports
+// with a MSG_TERMINATED advisory for an operator to inspect; other failures
+// are redelivered after a delay growing with every delivery.
+func rejectMessage(msg jetstream.Msg, err error, logger zerolog.Logger) {
+	defer consumer.MessageSettled(msg)
+
+	var delivered uint64
+	if meta, metaErr := msg.Metadata(); metaErr == nil {
+		delivered = meta.NumDelivered
+	}
+
+	outcome := rejectRetry
+	switch {
+	case consumer.IsPermanent(err):
+		outcome = rejectPermanent
+	case delivered >= uint64(consumerMaxDeliver):
+		outcome = rejectExhausted
+	}
+	consumer.MessagesRejected.WithLabelValues(outcome).Inc()
+
+	log := logger.Error().
+		Err(err).
+		Str("subject", msg.Subject()).
+		Uint64("delivered", delivered).
+		Str("outcome", outcome)
+
+	if outcome == rejectRetry {
+		delay := nakDelay(delivered)
+		log.Dur("retry_in", delay).Msg("failed to process message")
+		if err := msg.NakWithDelay(delay); err != nil {
+			// Redelivered after AckWait instead
+			logger.Warn().Err(err).Str("subject", msg.Subject()).Msg("failed to negatively acknowledge message")
+		}
+		return
+	}
+
+	log.Msg("failed to process message, terminating")
+	if err := msg.TermWithReason(outcome + ": " + err.Error()); err != nil {
+		logger.Warn().Err(err).Str("subject", msg.Subject()).Msg("failed to terminate message")
+	}
+}
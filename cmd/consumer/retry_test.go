@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+)
+
+// TestRejectMessage tests that failed messages are redelivered after a
+// delay growing with each delivery, and terminated when the failure is
+// permanent or the message is on its last delivery.
+func TestRejectMessage(t *testing.T) {
+	transient := errors.New("failed to store event: connection refused")
+	unmarshalErr := json.Unmarshal([]byte("{"), &struct{}{})
+
+	tests := []struct {
+		name      string
+		err       error
+		delivered uint64
+		nakDelay  time.Duration // Zero = terminated
+	}{
+		{"transient first delivery", transient, 1, 5 * time.Second},
+		{"transient second delivery", transient, 2, 30 * time.Second},
+		{"transient third delivery", transient, 3, 2 * time.Minute},
+		{"transient last delivery", transient, uint64(consumerMaxDeliver), 0},
+		{"transient without metadata", transient, 0, 5 * time.Second},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, 1, 5 * time.Second},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, 2, 30 * time.Second},
+		{"unmarshal error", consumer.Permanent(fmt.Errorf("failed to unmarshal json event: %w", unmarshalErr)), 1, 0},
+		{"unique violation", fmt.Errorf("failed to store event: %w", &pgconn.PgError{Code: "23505"}), 1, 0},
+		{"not-null violation", &pgconn.PgError{Code: "23502"}, 1, 0},
+		{"numeric out of range", &pgconn.PgError{Code: "22003"}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &fakeMsg{subject: "POLYMARKET.OrderFilled.0xab", delivered: tt.delivered}
+			rejectMessage(msg, tt.err, zerolog.Nop())
+
+			require.Zero(t, msg.acks)
+			if tt.nakDelay == 0 {
+				require.Zero(t, msg.naks)
+				require.Equal(t, 1, msg.terms)
+				return
+			}
+			require.Zero(t, msg.terms)
+			require.Equal(t, 1, msg.naks)
+			require.Equal(t, tt.nakDelay, msg.nakDelay)
+		})
+	}
+}
+
+// TestProcessMessageUndecodable tests that messages whose payload cannot be
+// decoded fail, which the consume callback treats as permanent.
+func TestProcessMessageUndecodable(t *testing.T) {
+	msg := &fakeMsg{subject: "POLYMARKET.OrderFilled.0xab", header: map[string][]string{}, data: []byte("{not json"), delivered: 1}
+	pending, err := processMessage(t.Context(), msg, zerolog.Nop())
+	require.Error(t, err)
+	require.Nil(t, pending)
+
+	rejectMessage(msg, consumer.Permanent(err), zerolog.Nop())
+	require.Equal(t, 1, msg.terms)
+	require.Zero(t, msg.naks)
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// exportTables are the tables that can be exported. Each has block_number,
+// block_timestamp and log_index columns, which ranges and ordering use.
+var exportTables = map[string]bool{
+	"order_fills":     true,
+	"token_transfers": true,
+	"trades":          true,
+}
+
+// fetchSize is the number of rows fetched from the cursor at a time.
+const fetchSize = 10_000
+
+// column is a column of an exportable table.
+type column struct {
+	Name string
+	Type string // information_schema.columns.data_type, e.g. "bigint"
+}
+
+// exportRange selects the rows of an export. Zero fields are unbounded.
+type exportRange struct {
+	FromBlock uint64
+	ToBlock   uint64
+	Since     time.Time
+	Until     time.Time
+}
+
+// tableColumns returns the columns of an exportable table, in table order.
+func tableColumns(ctx context.Context, pool *pgxpool.Pool, table string) ([]column, error) {
+	if !exportTables[table] {
+		return nil, fmt.Errorf("table %q cannot be exported, expected one of %s", table, strings.Join(exportTableNames(), ", "))
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT column_name, data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1
+		ORDER BY ordinal_position
+	`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns: %w", err)
+	}
+	columns, err := pgx.CollectRows(rows, pgx.RowToStructByPos[column])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", table)
+	}
+	return columns, nil
+}
+
+// exportTableNames returns the exportable tables, sorted.
+func exportTableNames() []string {
+	names := make([]string, 0, len(exportTables))
+	for name := range exportTables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectColumns returns the columns of a comma-separated selection, or
+// every column when it is empty.
+func selectColumns(available []column, spec string) ([]column, error) {
+	if strings.TrimSpace(spec) == "" {
+		return available, nil
+	}
+
+	known := make(map[string]column, len(available))
+	for _, c := range available {
+		known[c.Name] = c
+	}
+	var columns []column
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		c, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, expected one of %s", name, strings.Join(columnNames(available), ", "))
+		}
+		columns = append(columns, c)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no column to export")
+	}
+	return columns, nil
+}
+
+// columnNames returns the names of columns.
+func columnNames(columns []column) []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// exportQuery returns the query selecting the columns of a table within a
+// range, as text, in chain order.
+func exportQuery(table string, columns []string, r exportRange) (string, []any, error) {
+	if !exportTables[table] {
+		return "", nil, fmt.Errorf("table %q cannot be exported, expected one of %s", table, strings.Join(exportTableNames(), ", "))
+	}
+	if r.ToBlock != 0 && r.ToBlock < r.FromBlock {
+		return "", nil, fmt.Errorf("to block %d is before from block %d", r.ToBlock, r.FromBlock)
+	}
+	if !r.Until.IsZero() && r.Until.Before(r.Since) {
+		return "", nil, fmt.Errorf("until %s is before since %s", r.Until.Format(time.RFC3339), r.Since.Format(time.RFC3339))
+	}
+
+	selected := make([]string, len(columns))
+	for i, column := range columns {
+		selected[i] = pgx.Identifier{column}.Sanitize() + "::TEXT"
+	}
+
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if r.FromBlock != 0 {
+		where("block_number >= $%d", int64(r.FromBlock))
+	}
+	if r.ToBlock != 0 {
+		where("block_number <= $%d", int64(r.ToBlock))
+	}
+	if !r.Since.IsZero() {
+		where("block_timestamp >= $%d", r.Since)
+	}
+	if !r.Until.IsZero() {
+		where("block_timestamp < $%d", r.Until)
+	}
+
+	query := "SELECT " + strings.Join(selected, ", ") + " FROM " + pgx.Identifier{table}.Sanitize()
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY block_number, log_index"
+	return query, args, nil
+}
+
+// rowWriter writes exported rows to a file format. A nil value is NULL.
+type rowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []*string) error
+	Close() error
+}
+
+// csvWriter writes rows as CSV, with NULL as an empty field.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// newRowWriter returns the writer of columns in a format.
+func newRowWriter(format string, out io.Writer, columns []column) (rowWriter, error) {
+	switch format {
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(out)}, nil
+	case "parquet":
+		return newParquetWriter(out, columns), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected csv or parquet", format)
+	}
+}
+
+func (c *csvWriter) WriteHeader(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) WriteRow(values []*string) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		if v != nil {
+			record[i] = *v
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// output is the file an export is written to, gzipped when asked. Exports
+// to S3 are written to a temporary file uploaded on Close, so a failed
+// export leaves no object behind.
+type output struct {
+	io.Writer
+	file   *os.File
+	gz     *gzip.Writer
+	upload func(*os.File) error // nil for local paths
+}
+
+// createOutput creates the file at a local path or s3://bucket/key URL,
+// uploaded by uploader. Paths ending in .gz are gzipped whether or not
+// compress is set.
+func createOutput(ctx context.Context, path string, compress bool, uploader *s3Uploader) (*output, error) {
+	out := &output{}
+	var err error
+	switch {
+	case strings.HasPrefix(path, "s3://"):
+		bucket, key, urlErr := parseS3URL(path)
+		if urlErr != nil {
+			return nil, urlErr
+		}
+		if uploader == nil {
+			return nil, fmt.Errorf("cannot write to %s: no S3 storage configured", path)
+		}
+		out.upload = func(file *os.File) error { return uploader.upload(ctx, bucket, key, file) }
+		out.file, err = os.CreateTemp("", "export-*")
+	case strings.Contains(path, "://"):
+		return nil, fmt.Errorf("cannot write to %s: only local paths and s3:// URLs are supported", path)
+	default:
+		out.file, err = os.Create(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output: %w", err)
+	}
+
+	out.Writer = out.file
+	if compress || strings.HasSuffix(path, ".gz") {
+		out.gz = gzip.NewWriter(out.file)
+		out.Writer = out.gz
+	}
+	return out, nil
+}
+
+// Close flushes and closes the file, and uploads it for S3 outputs.
+func (o *output) Close() error {
+	if o.gz != nil {
+		if err := o.gz.Close(); err != nil {
+			o.Abort()
+			return fmt.Errorf("failed to compress output: %w", err)
+		}
+	}
+	if o.upload != nil {
+		defer os.Remove(o.file.Name())
+		if err := o.upload(o.file); err != nil {
+			o.file.Close()
+			return err
+		}
+	}
+	if err := o.file.Close(); err != nil {
+		return fmt.Errorf("failed to close output: %w", err)
+	}
+	return nil
+}
+
+// Abort closes and removes the file without uploading it.
+func (o *output) Abort() {
+	o.file.Close()
+	os.Remove(o.file.Name())
+}
+
+// export streams the rows of a query to a writer through a server-side
+// cursor, fetchSize rows at a time, so the result is never held in memory.
+// progress is called with the rows written after every fetch. It returns
+// the number of rows written.
+func export(ctx context.Context, pool *pgxpool.Pool, query string, args []any, columns []string, w rowWriter, progress func(int64)) (int64, error) {
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly, IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	// Timestamps are exported in UTC whatever the server's time zone
+	if _, err := tx.Exec(ctx, "SET LOCAL TimeZone = 'UTC'"); err != nil {
+		return 0, fmt.Errorf("failed to set time zone: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "DECLARE export_rows NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return 0, fmt.Errorf("failed to declare cursor: %w", err)
+	}
+
+	if err := w.WriteHeader(columns); err != nil {
+		return 0, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	var written int64
+	texts := make([]pgtype.Text, len(columns))
+	dest := make([]any, len(columns))
+	for i := range texts {
+		dest[i] = &texts[i]
+	}
+	values := make([]*string, len(columns))
+	for {
+		rows, err := tx.Query(ctx, fmt.Sprintf("FETCH %d FROM export_rows", fetchSize))
+		if err != nil {
+			return written, fmt.Errorf("failed to fetch rows: %w", err)
+		}
+		fetched := 0
+		for rows.Next() {
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return written, fmt.Errorf("failed to scan row: %w", err)
+			}
+			for i := range texts {
+				values[i] = nil
+				if texts[i].Valid {
+					values[i] = &texts[i].String
+				}
+			}
+			if err := w.WriteRow(values); err != nil {
+				rows.Close()
+				return written, fmt.Errorf("failed to write row: %w", err)
+			}
+			fetched++
+			written++
+		}
+		if err := rows.Err(); err != nil {
+			return written, fmt.Errorf("failed to fetch rows: %w", err)
+		}
+		if fetched == 0 {
+			break
+		}
+		if progress != nil {
+			progress(written)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return written, fmt.Errorf("failed to write rows: %w", err)
+	}
+	return written, nil
+}
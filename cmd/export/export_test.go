@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+)
+
+// TestExportQuery tests that ranges become bound conditions and that
+// unknown tables and inverted ranges are rejected.
+func TestExportQuery(t *testing.T) {
+	query, args, err := exportQuery("trades", []string{"block_number", "price"}, exportRange{})
+	require.NoError(t, err)
+	require.Equal(t, `SELECT "block_number"::TEXT, "price"::TEXT FROM "trades" ORDER BY block_number, log_index`, query)
+	require.Empty(t, args)
+
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query, args, err = exportQuery("order_fills", []string{"fee"}, exportRange{FromBlock: 10, ToBlock: 20, Since: since})
+	require.NoError(t, err)
+	require.Equal(t, `SELECT "fee"::TEXT FROM "order_fills" WHERE block_number >= $1 AND block_number <= $2 AND block_timestamp >= $3 ORDER BY block_number, log_index`, query)
+	require.Equal(t, []any{int64(10), int64(20), since}, args)
+
+	_, _, err = exportQuery("events", []string{"payload"}, exportRange{})
+	require.ErrorContains(t, err, "cannot be exported")
+	_, _, err = exportQuery("trades", []string{"price"}, exportRange{FromBlock: 20, ToBlock: 10})
+	require.Error(t, err)
+	_, _, err = exportQuery("trades", []string{"price"}, exportRange{Since: since, Until: since.Add(-time.Hour)})
+	require.Error(t, err)
+}
+
+// TestSelectColumns tests that a selection keeps its order and that unknown
+// columns are rejected.
+func TestSelectColumns(t *testing.T) {
+	available := []column{{"block_number", "bigint"}, {"maker", "text"}, {"taker", "text"}, {"fee", "numeric"}}
+
+	columns, err := selectColumns(available, "")
+	require.NoError(t, err)
+	require.Equal(t, available, columns)
+
+	columns, err = selectColumns(available, " fee, maker ")
+	require.NoError(t, err)
+	require.Equal(t, []column{{"fee", "numeric"}, {"maker", "text"}}, columns)
+	require.Equal(t, []string{"fee", "maker"}, columnNames(columns))
+
+	_, err = selectColumns(available, "maker,price")
+	require.ErrorContains(t, err, `"price"`)
+	_, err = selectColumns(available, ",")
+	require.Error(t, err)
+}
+
+// TestNewRowWriter tests that CSV writes NULL as an empty field and that
+// unknown formats are rejected.
+func TestNewRowWriter(t *testing.T) {
+	columns := []column{{"side", "text"}, {"price", "numeric"}}
+	var buf bytes.Buffer
+	w, err := newRowWriter("csv", &buf, columns)
+	require.NoError(t, err)
+	price := "0.55"
+	require.NoError(t, w.WriteHeader(columnNames(columns)))
+	require.NoError(t, w.WriteRow([]*string{nil, &price}))
+	require.NoError(t, w.Close())
+	require.Equal(t, "side,price\n,0.55\n", buf.String())
+
+	_, err = newRowWriter("xlsx", &buf, columns)
+	require.Error(t, err)
+}
+
+// parquetTrade is a row of a Parquet export of trades read back.
+type parquetTrade struct {
+	BlockNumber    *int64  `parquet:"block_number,optional"`
+	BlockTimestamp int64   `parquet:"block_timestamp,optional,timestamp(microsecond)"`
+	LogIndex       *int32  `parquet:"log_index,optional"`
+	Side           *string `parquet:"side,optional"`
+	Notional       *string `parquet:"notional,optional"`
+	IsOperatorFill *bool   `parquet:"is_operator_fill,optional"`
+}
+
+// TestParquetWriter tests that Parquet columns are typed after their
+// Postgres types, with NULL as a null value, and that values not of their
+// column's type are rejected.
+func TestParquetWriter(t *testing.T) {
+	columns := []column{
+		{"side", "text"},
+		{"block_number", "bigint"},
+		{"block_timestamp", "timestamp with time zone"},
+		{"log_index", "integer"},
+		{"notional", "numeric"},
+		{"is_operator_fill", "boolean"},
+	}
+	text := func(s string) *string { return &s }
+
+	var buf bytes.Buffer
+	w, err := newRowWriter("parquet", &buf, columns)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteHeader(columnNames(columns)))
+	require.NoError(t, w.WriteRow([]*string{
+		text("buy"), text("50000000"), text("2024-01-01 00:00:10.5+00"), text("3"), text("123456789012345678901234567890.000001"), text("false"),
+	}))
+	require.NoError(t, w.WriteRow([]*string{nil, text("50000001"), text("2024-01-01 00:00:12+00"), text("0"), nil, text("true")}))
+	require.NoError(t, w.Close())
+
+	rows, err := parquet.Read[parquetTrade](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	require.Equal(t, "buy", *rows[0].Side)
+	require.Equal(t, int64(50000000), *rows[0].BlockNumber)
+	require.Equal(t, time.Date(2024, 1, 1, 0, 0, 10, 500_000_000, time.UTC), time.UnixMicro(rows[0].BlockTimestamp).UTC())
+	require.Equal(t, int32(3), *rows[0].LogIndex)
+	require.Equal(t, "123456789012345678901234567890.000001", *rows[0].Notional)
+	require.False(t, *rows[0].IsOperatorFill)
+	require.Nil(t, rows[1].Side)
+	require.Nil(t, rows[1].Notional)
+	require.True(t, *rows[1].IsOperatorFill)
+
+	w, err = newRowWriter("parquet", io.Discard, columns[1:2])
+	require.NoError(t, err)
+	require.ErrorContains(t, w.WriteRow([]*string{text("0x01")}), "block_number")
+}
+
+// TestParseS3URL tests that S3 URLs are split into bucket and key, and that
+// URLs naming no object are rejected.
+func TestParseS3URL(t *testing.T) {
+	bucket, key, err := parseS3URL("s3://research/2024/trades.parquet")
+	require.NoError(t, err)
+	require.Equal(t, "research", bucket)
+	require.Equal(t, "2024/trades.parquet", key)
+
+	for _, url := range []string{"s3://research", "s3://research/", "s3:///trades.csv", "s3://research/2024/", "gs://research/trades.csv"} {
+		_, _, err := parseS3URL(url)
+		require.Error(t, err, url)
+	}
+}
+
+// TestCreateOutput tests that .gz paths are gzipped and that URLs other
+// than S3 ones are rejected.
+func TestCreateOutput(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "trades.csv.gz")
+	out, err := createOutput(ctx, path, false, nil)
+	require.NoError(t, err)
+	_, err = io.WriteString(out, "a,b\n")
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	require.Equal(t, "a,b\n", string(data))
+
+	_, err = createOutput(ctx, "s3://research/trades.csv", false, nil)
+	require.ErrorContains(t, err, "no S3 storage")
+	_, err = createOutput(ctx, "gs://research/trades.csv", false, nil)
+	require.Error(t, err)
+}
+
+// fakeS3 is an S3 server storing the objects put to it, in memory.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte // By /bucket/key
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "unexpected "+r.Method, http.StatusNotImplemented)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.objects[r.URL.Path] = body
+	f.mu.Unlock()
+	w.Header().Set("ETag", `"etag"`)
+}
+
+// TestCreateOutputS3 tests that an S3 output is uploaded on Close, once
+// complete, and that an aborted one is not uploaded.
+func TestCreateOutputS3(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+
+	client, err := minio.New(strings.TrimPrefix(server.URL, "https://"), &minio.Options{
+		Creds:     credentials.NewStaticV4("key", "secret", ""),
+		Secure:    true,
+		Region:    "us-east-1",
+		Transport: server.Client().Transport,
+	})
+	require.NoError(t, err)
+	uploader := &s3Uploader{client: client}
+
+	out, err := createOutput(ctx, "s3://research/2024/trades.csv", false, uploader)
+	require.NoError(t, err)
+	_, err = io.WriteString(out, "a,b\n")
+	require.NoError(t, err)
+	require.Empty(t, fake.objects, "uploaded on Close")
+	require.NoError(t, out.Close())
+	require.Equal(t, map[string][]byte{"/research/2024/trades.csv": []byte("a,b\n")}, fake.objects)
+	require.NoFileExists(t, out.file.Name())
+
+	out, err = createOutput(ctx, "s3://research/failed.csv", false, uploader)
+	require.NoError(t, err)
+	_, err = io.WriteString(out, "a,b\n")
+	require.NoError(t, err)
+	out.Abort()
+	require.NotContains(t, fake.objects, "/research/failed.csv")
+	require.NoFileExists(t, out.file.Name())
+}
+
+// TestExportAgainstPostgres tests against Postgres that a block range is
+// exported in chain order across several cursor fetches, with timestamps
+// in UTC.
+func TestExportAgainstPostgres(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+
+	_, err := pool.Exec(ctx, `
+		INSERT INTO trades (
+			block_number, block_timestamp, transaction_hash, log_index, maker, taker,
+			token_id, side, price, size, notional, fee, is_operator_fill
+		)
+		SELECT n, TIMESTAMPTZ '2024-01-01 00:00:00+00' + n * INTERVAL '2 seconds',
+		       '0xt' || n, 0, '0xmaker', '0xtaker', 1, 'buy', 0.5, 10, 5, 0, FALSE
+		FROM generate_series(1, $1) AS n
+	`, 2*fetchSize+10)
+	require.NoError(t, err)
+
+	available, err := tableColumns(ctx, pool, "trades")
+	require.NoError(t, err)
+	selected, err := selectColumns(available, "block_number,block_timestamp,price")
+	require.NoError(t, err)
+	require.Equal(t, []column{{"block_number", "bigint"}, {"block_timestamp", "timestamp with time zone"}, {"price", "numeric"}}, selected)
+	columns := columnNames(selected)
+	query, args, err := exportQuery("trades", columns, exportRange{FromBlock: 5, ToBlock: 2*fetchSize + 5})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w, err := newRowWriter("csv", &buf, selected)
+	require.NoError(t, err)
+	var fetches int
+	rows, err := export(ctx, pool, query, args, columns, w, func(int64) { fetches++ })
+	require.NoError(t, err)
+	require.EqualValues(t, 2*fetchSize+1, rows)
+	require.Equal(t, 3, fetches)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, int(rows)+1)
+	require.Equal(t, columns, records[0])
+	require.Equal(t, []string{"5", "2024-01-01 00:00:10+00", "0.500000"}, records[1])
+	require.Equal(t, fmt.Sprint(2*fetchSize+5), records[len(records)-1][0])
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRowsPerGroup bounds the rows a Parquet writer buffers before
+// writing them out as a row group, so exports run in constant memory.
+const parquetRowsPerGroup = 100_000
+
+// pgTimestampLayout is the text of a timestamptz in the UTC session of an
+// export.
+const pgTimestampLayout = "2006-01-02 15:04:05.999999-07"
+
+// parquetWriter writes rows as a Snappy-compressed Parquet file. Columns are
+// optional, with NULL as a null value, and typed after their Postgres type
+// (see parquetLeaf); the file orders them by name.
+type parquetWriter struct {
+	w       *parquet.Writer
+	columns []parquetColumn // In export order
+	row     parquet.Row
+}
+
+// parquetColumn is where and how a column is written.
+type parquetColumn struct {
+	name  string
+	index int // Leaf column index in the schema
+	value func(text string) (parquet.Value, error)
+}
+
+// newParquetWriter returns a Parquet writer of columns.
+func newParquetWriter(out io.Writer, columns []column) *parquetWriter {
+	group := make(parquet.Group, len(columns))
+	values := make(map[string]func(string) (parquet.Value, error), len(columns))
+	for _, c := range columns {
+		node, value := parquetLeaf(c.Type)
+		group[c.Name] = parquet.Optional(node)
+		values[c.Name] = value
+	}
+	schema := parquet.NewSchema("export", group)
+
+	index := make(map[string]int, len(columns))
+	for i, path := range schema.Columns() {
+		index[path[0]] = i
+	}
+	p := &parquetWriter{
+		w: parquet.NewWriter(out, schema,
+			parquet.Compression(&parquet.Snappy),
+			parquet.MaxRowsPerRowGroup(parquetRowsPerGroup),
+		),
+		columns: make([]parquetColumn, len(columns)),
+		row:     make(parquet.Row, len(columns)),
+	}
+	for i, c := range columns {
+		p.columns[i] = parquetColumn{name: c.Name, index: index[c.Name], value: values[c.Name]}
+	}
+	return p
+}
+
+// parquetLeaf returns the Parquet type of a Postgres data type and the
+// function converting the text of its values. Types without an exact
+// Parquet equivalent, NUMERIC(78, 0) amounts included, are strings.
+func parquetLeaf(dataType string) (parquet.Node, func(string) (parquet.Value, error)) {
+	switch dataType {
+	case "bigint":
+		return parquet.Int(64), func(s string) (parquet.Value, error) {
+			v, err := strconv.ParseInt(s, 10, 64)
+			return parquet.Int64Value(v), err
+		}
+	case "integer", "smallint":
+		return parquet.Int(32), func(s string) (parquet.Value, error) {
+			v, err := strconv.ParseInt(s, 10, 32)
+			return parquet.Int32Value(int32(v)), err
+		}
+	case "boolean":
+		return parquet.Leaf(parquet.BooleanType), func(s string) (parquet.Value, error) {
+			v, err := strconv.ParseBool(s)
+			return parquet.BooleanValue(v), err
+		}
+	case "double precision", "real":
+		return parquet.Leaf(parquet.DoubleType), func(s string) (parquet.Value, error) {
+			v, err := strconv.ParseFloat(s, 64)
+			return parquet.DoubleValue(v), err
+		}
+	case "timestamp with time zone":
+		return parquet.Timestamp(parquet.Microsecond), func(s string) (parquet.Value, error) {
+			t, err := time.Parse(pgTimestampLayout, s)
+			return parquet.Int64Value(t.UnixMicro()), err
+		}
+	default:
+		return parquet.String(), func(s string) (parquet.Value, error) {
+			return parquet.ByteArrayValue([]byte(s)), nil
+		}
+	}
+}
+
+// WriteHeader does nothing: the schema is written with the rows.
+func (p *parquetWriter) WriteHeader([]string) error {
+	return nil
+}
+
+func (p *parquetWriter) WriteRow(values []*string) error {
+	for i, c := range p.columns {
+		if values[i] == nil {
+			p.row[c.index] = parquet.NullValue().Level(0, 0, c.index)
+			continue
+		}
+		value, err := c.value(*values[i])
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", c.name, *values[i], err)
+		}
+		p.row[c.index] = value.Level(0, 1, c.index)
+	}
+	_, err := p.w.WriteRows([]parquet.Row{p.row})
+	return err
+}
+
+func (p *parquetWriter) Close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Config is the S3-compatible storage s3:// outputs are uploaded to.
+type s3Config struct {
+	Endpoint string // host[:port]
+	Region   string
+	UseSSL   bool
+
+	// Static credentials; empty uses AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY, MINIO_ACCESS_KEY and MINIO_SECRET_KEY, or the
+	// AWS credentials file
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// s3Uploader uploads exports to S3-compatible storage.
+type s3Uploader struct {
+	client *minio.Client
+}
+
+// newS3Uploader returns an uploader to the storage of cfg.
+func newS3Uploader(cfg s3Config) (*s3Uploader, error) {
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+	})
+	if cfg.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, "")
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+	return &s3Uploader{client: client}, nil
+}
+
+// parseS3URL returns the bucket and object key of an s3://bucket/key URL.
+func parseS3URL(url string) (bucket, key string, err error) {
+	path, ok := strings.CutPrefix(url, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("%s is not an s3:// URL", url)
+	}
+	bucket, key, _ = strings.Cut(path, "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("%s does not name an object, expected s3://bucket/key", url)
+	}
+	return bucket, key, nil
+}
+
+// upload uploads the file to an object, in parts when it is large.
+func (u *s3Uploader) upload(ctx context.Context, bucket, key string, file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat output: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind output: %w", err)
+	}
+	if _, err := u.client.PutObject(ctx, bucket, key, file, info.Size(), minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to upload to s3://%s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
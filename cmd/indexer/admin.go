@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/db"
+	"github.com/0xkanth/polymarket-indexer/internal/handler"
+	"github.com/0xkanth/polymarket-indexer/internal/processor"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// registerContract adds a runtime contract to the processor, registering
+// generic handlers for its ABI events when an ABI is provided.
+func registerContract(proc *processor.BlockEventsProcessor, contract models.MonitoredContract) ([]string, error) {
+	if !common.IsHexAddress(contract.Address) {
+		return nil, fmt.Errorf("invalid contract address: %s", contract.Address)
+	}
+
+	var events []abi.Event
+	if len(contract.ABI) > 0 {
+		parsed, err := handler.ParseABIEvents(contract.ABI, contract.Events)
+		if err != nil {
+			return nil, err
+		}
+		events = parsed
+	} else if len(contract.Events) > 0 {
+		return nil, fmt.Errorf("events require an ABI")
+	}
+
+	return proc.AddContract(common.HexToAddress(contract.Address), events)
+}
+
+// restoreContracts registers the runtime contracts persisted in store.
+// Contracts that can no longer be registered are logged and skipped.
+func restoreContracts(ctx context.Context, proc *processor.BlockEventsProcessor, store *db.CheckpointDB, logger *zerolog.Logger) error {
+	contracts, err := store.ListContracts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load runtime contracts: %w", err)
+	}
+	for _, contract := range contracts {
+		if _, err := registerContract(proc, contract); err != nil {
+			logger.Error().Err(err).Str("contract", contract.Address).Msg("failed to restore runtime contract")
+		}
+	}
+	return nil
+}
+
+// requireToken wraps an admin handler so it only serves requests carrying
+// token in an "Authorization: Bearer" header.
+func requireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminContractsHandler returns the /admin/contracts handler.
+//
+//	GET    - list monitored contracts
+//	POST   - add a contract (JSON body: address, optional abi and events)
+//	DELETE - remove a runtime contract (?address=0x...)
+func adminContractsHandler(proc *processor.BlockEventsProcessor, store *db.CheckpointDB, logger *zerolog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"contracts": proc.Contracts()})
+
+		case http.MethodPost:
+			var contract models.MonitoredContract
+			if err := json.NewDecoder(r.Body).Decode(&contract); err != nil {
+				http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			registered, err := registerContract(proc, contract)
+			if err != nil {
+				http.Error(w, err.Error(), adminErrorStatus(err))
+				return
+			}
+
+			// Persist so the contract survives a restart
+			contract.Address = common.HexToAddress(contract.Address).Hex()
+			contract.AddedAt = time.Now()
+			if err := store.SaveContract(r.Context(), contract); err != nil {
+				logger.Error().Err(err).Str("contract", contract.Address).Msg("failed to persist contract")
+				if rollbackErr := proc.RemoveContract(common.HexToAddress(contract.Address)); rollbackErr != nil {
+					logger.Error().Err(rollbackErr).Str("contract", contract.Address).Msg("failed to roll back contract")
+				}
+				http.Error(w, "failed to persist contract", http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, http.StatusCreated, map[string]any{
+				"address": contract.Address,
+				"events":  registered,
+			})
+
+		case http.MethodDelete:
+			address := r.URL.Query().Get("address")
+			if !common.IsHexAddress(address) {
+				http.Error(w, fmt.Sprintf("invalid contract address: %s", address), http.StatusBadRequest)
+				return
+			}
+			addr := common.HexToAddress(address)
+
+			if err := proc.RemoveContract(addr); err != nil {
+				http.Error(w, err.Error(), adminErrorStatus(err))
+				return
+			}
+			if err := store.DeleteContract(r.Context(), addr.Hex()); err != nil {
+				logger.Error().Err(err).Str("contract", addr.Hex()).Msg("failed to delete persisted contract")
+				http.Error(w, "failed to delete persisted contract", http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// adminErrorStatus maps processor errors to HTTP status codes.
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, processor.ErrContractConfigured):
+		return http.StatusConflict
+	case errors.Is(err, processor.ErrContractNotRegistered):
+		return http.StatusNotFound
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
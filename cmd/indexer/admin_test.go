@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/db"
+	"github.com/0xkanth/polymarket-indexer/internal/processor"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+const (
+	// configuredContract is monitored from the configuration
+	configuredContract = "0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e"
+
+	// runtimeContract is added through the admin API
+	runtimeContract = "0x1111111111111111111111111111111111111111"
+)
+
+// runtimeContractBody registers runtimeContract with one event of its ABI.
+const runtimeContractBody = `{
+	"address": "0x1111111111111111111111111111111111111111",
+	"abi": [
+		{"type":"event","name":"Deposit","anonymous":false,"inputs":[
+			{"name":"owner","type":"address","indexed":true},
+			{"name":"assets","type":"uint256","indexed":false}]}
+	],
+	"events": ["Deposit"]
+}`
+
+// newTestProcessor returns a processor monitoring configuredContract.
+func newTestProcessor(t *testing.T) *processor.BlockEventsProcessor {
+	t.Helper()
+	proc, err := processor.New(zerolog.Nop(), nil, nil, processor.BlockEventProcessingConfig{
+		Contracts: []string{configuredContract},
+	})
+	require.NoError(t, err)
+	return proc
+}
+
+// newTestCheckpointDB opens the checkpoint DB at path, closed with the test.
+func newTestCheckpointDB(t *testing.T, path string) *db.CheckpointDB {
+	t.Helper()
+	store, err := db.NewCheckpointDB(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// serveAdmin sends a request to the admin contracts handler.
+func serveAdmin(proc *processor.BlockEventsProcessor, store *db.CheckpointDB, method, target, body string) *httptest.ResponseRecorder {
+	logger := zerolog.Nop()
+	rec := httptest.NewRecorder()
+	adminContractsHandler(proc, store, &logger)(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+// listContracts returns the contracts listed by GET /admin/contracts.
+func listContracts(t *testing.T, proc *processor.BlockEventsProcessor, store *db.CheckpointDB) []common.Address {
+	t.Helper()
+	rec := serveAdmin(proc, store, http.MethodGet, "/admin/contracts", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Contracts []common.Address `json:"contracts"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp.Contracts
+}
+
+// TestAdminContracts tests that contracts are added, listed and deleted, in
+// the processor and in the checkpoint DB.
+func TestAdminContracts(t *testing.T) {
+	proc := newTestProcessor(t)
+	store := newTestCheckpointDB(t, filepath.Join(t.TempDir(), "checkpoints.db"))
+	checksummed := common.HexToAddress(runtimeContract).Hex()
+
+	require.Equal(t, []common.Address{common.HexToAddress(configuredContract)}, listContracts(t, proc, store))
+
+	rec := serveAdmin(proc, store, http.MethodPost, "/admin/contracts", runtimeContractBody)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.JSONEq(t, `{"address":"`+checksummed+`","events":["Deposit"]}`, rec.Body.String())
+
+	require.Contains(t, listContracts(t, proc, store), common.HexToAddress(runtimeContract))
+	persisted, err := store.ListContracts(t.Context())
+	require.NoError(t, err)
+	require.Len(t, persisted, 1)
+	require.Equal(t, checksummed, persisted[0].Address)
+	require.Equal(t, []string{"Deposit"}, persisted[0].Events)
+	require.False(t, persisted[0].AddedAt.IsZero())
+
+	rec = serveAdmin(proc, store, http.MethodDelete, "/admin/contracts?address="+runtimeContract, "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	require.NotContains(t, listContracts(t, proc, store), common.HexToAddress(runtimeContract))
+	persisted, err = store.ListContracts(t.Context())
+	require.NoError(t, err)
+	require.Empty(t, persisted)
+}
+
+// TestAdminContractsErrors tests the status codes of rejected requests.
+func TestAdminContractsErrors(t *testing.T) {
+	proc := newTestProcessor(t)
+	store := newTestCheckpointDB(t, filepath.Join(t.TempDir(), "checkpoints.db"))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"invalid body", http.MethodPost, "/admin/contracts", "{", http.StatusBadRequest},
+		{"invalid address", http.MethodPost, "/admin/contracts", `{"address":"0x12"}`, http.StatusBadRequest},
+		{"events without abi", http.MethodPost, "/admin/contracts", `{"address":"` + runtimeContract + `","events":["Deposit"]}`, http.StatusBadRequest},
+		{"configured contract", http.MethodPost, "/admin/contracts", `{"address":"` + configuredContract + `"}`, http.StatusConflict},
+		{"delete invalid address", http.MethodDelete, "/admin/contracts?address=0x12", "", http.StatusBadRequest},
+		{"delete configured contract", http.MethodDelete, "/admin/contracts?address=" + configuredContract, "", http.StatusConflict},
+		{"delete unknown contract", http.MethodDelete, "/admin/contracts?address=" + runtimeContract, "", http.StatusNotFound},
+		{"unsupported method", http.MethodPut, "/admin/contracts", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveAdmin(proc, store, tt.method, tt.target, tt.body)
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+// TestAdminContractsRestored tests that contracts added through the API are
+// monitored again after a restart.
+func TestAdminContractsRestored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.db")
+
+	store, err := db.NewCheckpointDB(path)
+	require.NoError(t, err)
+	rec := serveAdmin(newTestProcessor(t), store, http.MethodPost, "/admin/contracts", runtimeContractBody)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.NoError(t, store.Close())
+
+	// Restart with a new processor over the same file
+	proc := newTestProcessor(t)
+	store = newTestCheckpointDB(t, path)
+	logger := zerolog.Nop()
+	require.NoError(t, restoreContracts(t.Context(), proc, store, &logger))
+	require.Contains(t, listContracts(t, proc, store), common.HexToAddress(runtimeContract))
+
+	// The restored contract is a runtime contract again, so it can be removed
+	rec = serveAdmin(proc, store, http.MethodDelete, "/admin/contracts?address="+runtimeContract, "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+}
+
+// TestAdminContractsRollback tests that a contract that cannot be persisted
+// is not left monitored.
+func TestAdminContractsRollback(t *testing.T) {
+	proc := newTestProcessor(t)
+	store, err := db.NewCheckpointDB(filepath.Join(t.TempDir(), "checkpoints.db"))
+	require.NoError(t, err)
+	// Every write fails once the database is closed
+	require.NoError(t, store.Close())
+
+	rec := serveAdmin(proc, store, http.MethodPost, "/admin/contracts", runtimeContractBody)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Equal(t, []common.Address{common.HexToAddress(configuredContract)}, proc.Contracts())
+
+	// The rollback also unregistered its handlers, so it can be added again
+	var contract models.MonitoredContract
+	require.NoError(t, json.Unmarshal([]byte(runtimeContractBody), &contract))
+	registered, err := registerContract(proc, contract)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Deposit"}, registered)
+}
+
+// TestRequireToken tests that admin requests are only served with the
+// configured bearer token.
+func TestRequireToken(t *testing.T) {
+	served := 0
+	h := requireToken("s3cret", func(w http.ResponseWriter, r *http.Request) {
+		served++
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer guess", http.StatusUnauthorized},
+		{"token prefix", "Bearer s3cre", http.StatusUnauthorized},
+		{"other scheme", "Basic s3cret", http.StatusUnauthorized},
+		{"valid", "Bearer s3cret", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/admin/contracts?address="+runtimeContract, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h(rec, req)
+			require.Equal(t, tt.status, rec.Code)
+			if tt.status == http.StatusUnauthorized {
+				require.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+	require.Equal(t, 1, served)
+}
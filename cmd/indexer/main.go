@@ -3,22 +3,30 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/knadh/koanf/v2"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/0xkanth/polymarket-indexer/internal/chain"
 	"github.com/0xkanth/polymarket-indexer/internal/db"
 	"github.com/0xkanth/polymarket-indexer/internal/nats"
 	"github.com/0xkanth/polymarket-indexer/internal/processor"
+	"github.com/0xkanth/polymarket-indexer/internal/router"
 	"github.com/0xkanth/polymarket-indexer/internal/syncer"
 	"github.com/0xkanth/polymarket-indexer/internal/util"
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
 	"github.com/0xkanth/polymarket-indexer/pkg/config"
+	"github.com/0xkanth/polymarket-indexer/pkg/contracts"
 )
 
 const (
@@ -26,6 +34,9 @@ const (
 )
 
 func main() {
+	skipArchiveCheck := flag.Bool("skip-archive-check", false, "do not check at startup that the RPC endpoint serves the blocks to sync")
+	flag.Parse()
+
 	// Initialize logger
 	logger := util.InitLogger()
 	logger.Info().Msg("starting polymarket indexer")
@@ -61,62 +72,199 @@ func main() {
 		Int("confirmations", selectedChain.Confirmations).
 		Msg("loaded chain configuration")
 
-	// Initialize chain client
-	httpURL := selectedChain.RPCUrls[0]
+	// Initialize chain client over every RPC endpoint, failing over in order
 	wsURL := ""
 	if len(selectedChain.WSUrls) > 0 {
 		wsURL = selectedChain.WSUrls[0]
 	}
 
 	chainClient, err := chain.NewClient(
-		httpURL,
+		selectedChain.RPCUrls,
 		wsURL,
 		selectedChain.ChainID,
 		logger,
+		chain.WithFailover(
+			cfg.Int("chain.failover_threshold"),
+			cfg.Duration("chain.call_timeout"),
+			cfg.Duration("chain.probe_interval"),
+		),
+		chain.WithRetry(
+			cfg.Int("chain.retry_attempts"),
+			cfg.Duration("chain.retry_backoff"),
+			cfg.Duration("chain.retry_max_backoff"),
+		),
+		chain.WithHealthCheck(cfg.Duration("chain.health_check_interval"), cfg.Int("chain.max_block_lag")),
+		chain.WithCircuitBreaker(
+			cfg.Int("chain.breaker_failures"),
+			cfg.Duration("chain.breaker_window"),
+			cfg.Duration("chain.breaker_cooldown"),
+		),
+		chain.WithRPCTimeout(cfg.Duration("chain.rpc_timeout")),
+		chain.WithReceiptWorkers(cfg.Int("chain.receipt_workers")),
+		chain.WithBatchSize(cfg.Int("chain.batch_size")),
+		chain.WithBlockTime(time.Duration(selectedChain.BlockTime)*time.Second),
+		chain.WithLogRangeErrors(cfg.Strings("chain.log_range_errors")...),
+		chain.WithHeaderCache(cfg.Int("chain.header_cache_size")),
+		chain.WithDebugLogging(cfg.Float64("chain.debug_sample_rate")),
+		chain.WithTransport(chain.Transport{
+			MaxIdleConns:        cfg.Int("chain.transport.max_idle_conns"),
+			MaxIdleConnsPerHost: cfg.Int("chain.transport.max_idle_conns_per_host"),
+			IdleConnTimeout:     cfg.Duration("chain.transport.idle_conn_timeout"),
+			TLSHandshakeTimeout: cfg.Duration("chain.transport.tls_handshake_timeout"),
+			ProxyURL:            cfg.String("chain.transport.proxy_url"),
+			CAFile:              cfg.String("chain.transport.ca_file"),
+			InsecureSkipVerify:  cfg.Bool("chain.transport.insecure_skip_verify"),
+			Headers:             cfg.StringMap("chain.transport.headers"),
+		}),
 	)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to create chain client")
 	}
 	logger.Info().
-		Str("http", httpURL).
+		Int("rpc_endpoints", len(selectedChain.RPCUrls)).
 		Str("ws", wsURL).
 		Int64("chain_id", selectedChain.ChainID).
 		Msg("initialized chain client")
 
-	// Initialize checkpoint store
-	checkpointStore, err := db.NewCheckpointDB(cfg.String("db.checkpoint_path"))
+	// Initialize the BoltDB file, holding the runtime contracts and, with
+	// the bolt backend, the checkpoints
+	boltDB, err := db.NewCheckpointDB(cfg.String("db.checkpoint_path"))
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to create checkpoint store")
 	}
-	defer checkpointStore.Close()
+	defer boltDB.Close()
+
+	// Initialize checkpoint store
+	var checkpointStore db.CheckpointStore = boltDB
+	backend := cfg.String("db.checkpoint_backend")
+	switch backend {
+	case "":
+		backend = db.BackendBolt
+	case db.BackendBolt:
+	case db.BackendPostgres:
+		checkpointStore, err = newPostgresCheckpoints(cfg)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to create checkpoint store")
+		}
+		defer checkpointStore.Close()
+	default:
+		logger.Fatal().Str("backend", backend).Msg("db.checkpoint_backend must be bolt or postgres")
+	}
 	logger.Info().
+		Str("backend", backend).
 		Str("path", cfg.String("db.checkpoint_path")).
 		Msg("initialized checkpoint store")
 
 	// Initialize NATS publisher
-	publisher, err := nats.NewPublisher(
-		cfg.String("nats.url"),
-		cfg.Duration("nats.max_age"),
-		cfg.String("nats.stream_name"),
-		logger,
-	)
+	streamCfg, err := nats.LoadPublisherConfig(cfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid nats configuration")
+	}
+	eventCodec, err := codec.ByName(cfg.String("nats.encoding"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid nats configuration")
+	}
+	compression, err := codec.CompressionByName(cfg.String("nats.compression"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid nats configuration")
+	}
+	schemaVersions, err := codec.ParseSchemaVersions(cfg.Strings("nats.schema_versions"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid nats configuration")
+	}
+	publishRetryDelays, err := router.ParseRetryDelays(cfg.Strings("indexer.publish_retry_delays"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid indexer.publish_retry_delays")
+	}
+	connOpts, err := nats.LoadConnConfig(cfg).Options()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid nats configuration")
+	}
+	publisherOpts := []nats.PublisherOption{
+		nats.WithConnectOptions(connOpts...),
+		nats.WithAsyncWindow(cfg.Int("nats.async_window")),
+		nats.WithCodec(eventCodec),
+		nats.WithCompression(compression, cfg.Int("nats.compression_threshold")),
+		nats.WithSchemaVersions(schemaVersions...),
+		nats.WithMsgIDPrefix(cfg.String("nats.msg_id_prefix")),
+		nats.WithChainID(selectedChain.ChainID),
+		nats.WithPublishRetry(cfg.Int("nats.publish_retry_attempts"), cfg.Duration("nats.publish_retry_backoff")),
+		nats.WithCircuitBreaker(cfg.Int("nats.breaker_threshold"), cfg.Duration("nats.breaker_cooldown")),
+	}
+	if firehose := cfg.String("nats.firehose_prefix"); firehose != "" {
+		publisherOpts = append(publisherOpts, nats.WithFirehose(firehose))
+	}
+	if cfg.Exists("nats.stale_after") {
+		publisherOpts = append(publisherOpts, nats.WithStaleAfter(cfg.Duration("nats.stale_after")))
+	}
+	deadLetterDir := cfg.String("nats.dead_letter_dir")
+	if deadLetterDir != "" {
+		publisherOpts = append(publisherOpts, nats.WithDeadLetters(deadLetterDir))
+	}
+	publisher, err := nats.NewPublisher(cfg.String("nats.url"), streamCfg, logger, publisherOpts...)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to create nats publisher")
 	}
 	defer publisher.Close()
 	logger.Info().
 		Str("url", cfg.String("nats.url")).
-		Str("stream", cfg.String("nats.stream_name")).
+		Str("stream", streamCfg.StreamName).
+		Str("subjects", streamCfg.SubjectPattern()).
 		Msg("initialized nats publisher")
 
+	// Republish events spilled to disk while NATS was unavailable
+	if deadLetterDir != "" {
+		replayed, remaining, err := publisher.ReplayDeadLetters(context.Background())
+		event := logger.Info()
+		if err != nil || remaining > 0 {
+			event = logger.Warn().Err(err)
+		}
+		event.
+			Str("dir", deadLetterDir).
+			Int("replayed", replayed).
+			Int("remaining", remaining).
+			Msg("replayed spilled dead letters")
+	}
+
+	// Optionally enrich OrderCancelled events with on-chain order details.
+	// This costs extra RPC calls per cancellation.
+	var enricher processor.EventEnricher
+	if cfg.Bool("indexer.enrich_order_cancellations") {
+		if !common.IsHexAddress(selectedChain.Contracts.CTFExchange) {
+			logger.Fatal().Msg("order cancellation enrichment requires contracts.ctfExchange")
+		}
+		exchange := selectedChain.GetCTFExchangeAddress()
+		caller, err := contracts.NewCTFExchangeCaller(exchange, chainClient.ContractCaller())
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to bind ctf exchange")
+		}
+		enricher = processor.NewOrderCancelledEnricher(*logger, caller, chainClient, exchange)
+		logger.Info().Str("exchange", exchange.Hex()).Msg("order cancellation enrichment enabled")
+	}
+
+	// Live feed of realtime events on core NATS (nil interface when disabled)
+	var live processor.LivePublisher
+	if publisher.FirehoseEnabled() {
+		live = publisher
+	}
+
 	// Initialize processor
 	proc, err := processor.New(
 		*logger,
 		chainClient,
 		publisher,
 		processor.BlockEventProcessingConfig{
-			Contracts:  selectedChain.GetAllContractAddressStrings(),
-			StartBlock: selectedChain.StartBlock,
+			Contracts:         selectedChain.GetAllContractAddressStrings(),
+			StartBlock:        selectedChain.StartBlock,
+			CTFExchange:       selectedChain.Contracts.CTFExchange,
+			ConditionalTokens: selectedChain.Contracts.ConditionalTokens,
+			StrictMode:        cfg.Bool("indexer.strict_mode"),
+			CollateralToken:   selectedChain.Contracts.CollateralToken,
+			HandlerTimeout:    cfg.Duration("indexer.handler_timeout"),
+			Enricher:          enricher,
+			Live:              live,
+			PublishWorkers:    cfg.Int("indexer.publish_workers"),
+			PublishRetry:      router.RetryPolicy{Delays: publishRetryDelays},
 		},
 	)
 	if err != nil {
@@ -127,19 +275,37 @@ func main() {
 		Uint64("start_block", selectedChain.StartBlock).
 		Msg("initialized processor")
 
+	// Restore contracts registered at runtime via the admin API
+	if err := restoreContracts(context.Background(), proc, boltDB, logger); err != nil {
+		logger.Fatal().Err(err).Msg("failed to restore runtime contracts")
+	}
+
 	// Initialize syncer
+	subscription := cfg.String("indexer.subscription")
+	switch subscription {
+	case "":
+		subscription = syncer.SubscriptionPoll
+	case syncer.SubscriptionPoll, syncer.SubscriptionHeads, syncer.SubscriptionLogs:
+	default:
+		logger.Fatal().Str("subscription", subscription).Msg("indexer.subscription must be poll, heads or logs")
+	}
+	if subscription != syncer.SubscriptionPoll && wsURL == "" {
+		logger.Fatal().Str("subscription", subscription).Msg("indexer.subscription requires a WebSocket URL in chains.json")
+	}
 	sync := syncer.New(
 		*logger,
 		chainClient,
 		proc,
 		checkpointStore,
 		syncer.Config{
-			ServiceName:   serviceName,
-			StartBlock:    selectedChain.StartBlock,
-			BatchSize:     uint64(cfg.Int64("indexer.batch_size")),
-			PollInterval:  cfg.Duration("indexer.poll_interval"),
-			Confirmations: uint64(selectedChain.Confirmations),
-			Workers:       cfg.Int("indexer.workers"),
+			ServiceName:      serviceName,
+			StartBlock:       selectedChain.StartBlock,
+			BatchSize:        uint64(cfg.Int64("indexer.batch_size")),
+			PollInterval:     cfg.Duration("indexer.poll_interval"),
+			Confirmations:    uint64(selectedChain.Confirmations),
+			Workers:          cfg.Int("indexer.workers"),
+			Subscription:     subscription,
+			SkipHistoryCheck: *skipArchiveCheck,
 		},
 	)
 	logger.Info().
@@ -147,6 +313,7 @@ func main() {
 		Dur("poll_interval", cfg.Duration("indexer.poll_interval")).
 		Uint64("confirmations", uint64(selectedChain.Confirmations)).
 		Int("workers", cfg.Int("indexer.workers")).
+		Str("subscription", subscription).
 		Msg("initialized syncer")
 
 	// Start metrics server
@@ -163,11 +330,22 @@ func main() {
 		}
 	}()
 
-	// Start health check server
+	// Start health check server (also serves the admin API when enabled)
 	healthAddr := cfg.String("health.address")
+	healthMux := http.NewServeMux()
+	healthMux.HandleFunc("/", healthCheckHandler(sync, publisher, proc))
+	if cfg.Bool("admin.enabled") {
+		// The health port is public, so the admin API requires a token
+		adminToken := cfg.String("admin.token")
+		if adminToken == "" {
+			logger.Fatal().Msg("admin.token must be set when admin.enabled is true")
+		}
+		healthMux.HandleFunc("/admin/contracts", requireToken(adminToken, adminContractsHandler(proc, boltDB, logger)))
+		logger.Info().Msg("admin API enabled at /admin/contracts")
+	}
 	healthServer := &http.Server{
 		Addr:    healthAddr,
-		Handler: http.HandlerFunc(healthCheckHandler(sync, publisher)),
+		Handler: healthMux,
 	}
 
 	go func() {
@@ -220,12 +398,49 @@ func main() {
 	logger.Info().Msg("shutdown complete")
 }
 
-// healthCheckHandler returns a health check handler.
-func healthCheckHandler(sync *syncer.Syncer, pub *nats.Publisher) http.HandlerFunc {
+// newPostgresCheckpoints connects to the [postgres] database and returns
+// a checkpoint store on it.
+func newPostgresCheckpoints(cfg *koanf.Koanf) (*db.PostgresCheckpoints, error) {
+	dbConfig := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.String("postgres.host"),
+		cfg.Int("postgres.port"),
+		cfg.String("postgres.user"),
+		cfg.String("postgres.password"),
+		cfg.String("postgres.database"),
+		cfg.String("postgres.sslmode"),
+	)
+	poolConfig, err := pgxpool.ParseConfig(dbConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	checkpoints, err := db.NewPostgresCheckpoints(ctx, pool)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+// healthCheckHandler returns a health check handler. The publisher's status
+// is reported either way, so on-call can tell NATS connectivity problems
+// (nats_connected: false) from JetStream not storing messages.
+func healthCheckHandler(sync *syncer.Syncer, pub *nats.Publisher, proc *processor.BlockEventsProcessor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		status := pub.Status()
 		if !sync.Healthy() || !pub.Healthy() {
 			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprintf(w, "unhealthy\n")
+			fmt.Fprintf(w, "unhealthy\nsyncer_healthy: %t\n", sync.Healthy())
+			writePublisherStatus(w, status)
 			return
 		}
 
@@ -233,5 +448,29 @@ func healthCheckHandler(sync *syncer.Syncer, pub *nats.Publisher) http.HandlerFu
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "healthy\ncurrent: %d\nlatest: %d\nbehind: %d\n",
 			current, latest, latest-current)
+		writePublisherStatus(w, status)
+		for _, contract := range proc.Contracts() {
+			fmt.Fprintf(w, "contract: %s\n", contract.Hex())
+		}
+	}
+}
+
+// writePublisherStatus writes the NATS publisher's status as health
+// endpoint lines.
+func writePublisherStatus(w io.Writer, status nats.PublisherStatus) {
+	fmt.Fprintf(w, "nats_connected: %t\nnats_circuit_open: %t\nnats_stale: %t\n",
+		status.Connected, status.CircuitOpen, status.Stale)
+	fmt.Fprintf(w, "nats_last_publish: %s\n", formatHealthTime(status.LastPublish))
+	fmt.Fprintf(w, "nats_consecutive_failures: %d\nnats_failing_since: %s\n",
+		status.ConsecutiveFailures, formatHealthTime(status.FailingSince))
+	fmt.Fprintf(w, "nats_reconnects: %d\nnats_disconnects: %d\n", status.Reconnects, status.Disconnects)
+}
+
+// formatHealthTime formats a timestamp for the health endpoint, "never" if
+// it is unset.
+func formatHealthTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
 	}
+	return t.UTC().Format(time.RFC3339)
 }
@@ -0,0 +1,123 @@
+// Migrate service - applies the consumer's schema migrations to TimescaleDB,
+// for deployments that run the consumer with postgres.auto_migrate = false.
+//
+// Usage:
+//
+//	migrate [up]                  apply pending migrations
+//	migrate status                list migrations and when they were applied
+//	migrate rebuild-balances      recompute balances from token_transfers
+//	migrate rebuild-open-interest recompute open interest from splits, merges and redemptions
+//	migrate rebuild-pnl           replay wallet positions and realized PnL from every stored event
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/migrations"
+	"github.com/0xkanth/polymarket-indexer/internal/util"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+func main() {
+	logger := util.InitLogger()
+
+	command := "up"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	switch command {
+	case "up", "status", "rebuild-balances", "rebuild-open-interest", "rebuild-pnl":
+	default:
+		fmt.Fprintf(os.Stderr, "usage: %s [up|status|rebuild-balances|rebuild-open-interest|rebuild-pnl]\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	cfg := util.InitConfig(logger, "config.toml")
+	util.UpdateLogLevel(cfg, logger)
+
+	dbConfig := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.String("postgres.host"),
+		cfg.Int("postgres.port"),
+		cfg.String("postgres.user"),
+		cfg.String("postgres.password"),
+		cfg.String("postgres.database"),
+		cfg.String("postgres.sslmode"),
+	)
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dbConfig)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to connect to database")
+	}
+	defer pool.Close()
+
+	if command == "status" {
+		statuses, err := migrations.Statuses(ctx, pool)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to read migration status")
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if !s.AppliedAt.IsZero() {
+				applied = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+		return
+	}
+
+	if command == "rebuild-balances" {
+		var rebuilt int64
+		if err := pool.QueryRow(ctx, "SELECT rebuild_balances()").Scan(&rebuilt); err != nil {
+			logger.Fatal().Err(err).Msg("failed to rebuild balances")
+		}
+		logger.Info().Int64("balances", rebuilt).Msg("rebuilt balances")
+		return
+	}
+
+	if command == "rebuild-open-interest" {
+		var rebuilt int64
+		if err := pool.QueryRow(ctx, "SELECT rebuild_open_interest()").Scan(&rebuilt); err != nil {
+			logger.Fatal().Err(err).Msg("failed to rebuild open interest")
+		}
+		logger.Info().Int64("conditions", rebuilt).Msg("rebuilt open interest")
+		return
+	}
+
+	if command == "rebuild-pnl" {
+		// Transfers operated by the exchanges settle fills, as in the consumer
+		exchanges := []string{}
+		for _, exchange := range cfg.Strings("consumer.exchange_addresses") {
+			if !common.IsHexAddress(exchange) {
+				logger.Fatal().Str("exchange_address", exchange).Msg("invalid consumer.exchange_addresses")
+			}
+			exchanges = append(exchanges, models.NormalizeAddress(exchange))
+		}
+
+		var recorded int64
+		if err := pool.QueryRow(ctx, "SELECT rebuild_position_changes($1)", exchanges).Scan(&recorded); err != nil {
+			logger.Fatal().Err(err).Msg("failed to rebuild PnL")
+		}
+		logger.Info().Int64("position_changes", recorded).Msg("rebuilt wallet positions and realized PnL")
+		return
+	}
+
+	applied, err := migrations.Up(ctx, pool)
+	for _, m := range applied {
+		logger.Info().Int64("version", m.Version).Str("name", m.Name).Msg("applied migration")
+	}
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to migrate database")
+	}
+	logger.Info().Int("applied", len(applied)).Msg("database is up to date")
+}
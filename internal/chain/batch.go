@@ -0,0 +1,165 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/rpcerr"
+)
+
+// DefaultBatchSize is the default number of calls sent in one JSON-RPC
+// batch; providers usually reject larger batches
+const DefaultBatchSize = 100
+
+// WithBatchSize sets the number of calls sent in one JSON-RPC batch.
+// Non-positive values keep the default.
+func WithBatchSize(size int) ClientOption {
+	return func(c *OnChainClient) {
+		if size > 0 {
+			c.batchSize = size
+		}
+	}
+}
+
+// ItemError is the failure of one item of a batch call.
+type ItemError struct {
+	Index int // Position of the item in the input
+	Err   error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e *ItemError) Unwrap() error { return e.Err }
+
+// GetHeadersByNumbers fetches the headers of blocks by number, in input
+// order, from the header cache or with batched eth_getBlockByNumber calls
+// for those it does not hold. When some items fail it returns the headers
+// fetched, nil for the others, with an error joining an *ItemError per
+// failed item (ethereum.NotFound for a missing block).
+func (c *OnChainClient) GetHeadersByNumbers(ctx context.Context, numbers []uint64) ([]*types.Header, error) {
+	headers := make([]*types.Header, len(numbers))
+	var (
+		elems     []rpc.BatchElem
+		positions []int // Of each element in numbers
+	)
+	for i, number := range numbers {
+		if header, ok := c.headers.getByNumber(number); ok {
+			headers[i] = header
+			continue
+		}
+		elems = append(elems, rpc.BatchElem{
+			Method: "eth_getBlockByNumber",
+			Args:   []any{hexutil.EncodeUint64(number), false},
+			Result: &headers[i],
+		})
+		positions = append(positions, i)
+	}
+	if err := c.batchCall(ctx, "headers_batch", elems); err != nil {
+		return nil, fmt.Errorf("failed to fetch %d headers: %w", len(elems), err)
+	}
+	for _, i := range positions {
+		c.headers.add(headers[i])
+	}
+	return headers, itemErrors(elems, positions, func(i int) bool { return headers[i] != nil })
+}
+
+// GetReceiptsByHashes fetches transaction receipts by hash with batched
+// eth_getTransactionReceipt calls, in input order. When some items fail it
+// returns the receipts fetched, nil for the others, with an error joining
+// an *ItemError per failed item (ethereum.NotFound for an unknown
+// transaction).
+func (c *OnChainClient) GetReceiptsByHashes(ctx context.Context, hashes []common.Hash) ([]*types.Receipt, error) {
+	receipts := make([]*types.Receipt, len(hashes))
+	elems := make([]rpc.BatchElem, len(hashes))
+	for i, hash := range hashes {
+		elems[i] = rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []any{hash},
+			Result: &receipts[i],
+		}
+	}
+	if err := c.batchCall(ctx, "receipts_batch", elems); err != nil {
+		return nil, fmt.Errorf("failed to fetch %d receipts: %w", len(hashes), err)
+	}
+	return receipts, itemErrors(elems, nil, func(i int) bool { return receipts[i] != nil })
+}
+
+// itemErrors joins an *ItemError per element that failed or has no result,
+// found being given the input position of an element. positions maps
+// elements to input positions, nil when they are the same.
+func itemErrors(elems []rpc.BatchElem, positions []int, found func(i int) bool) error {
+	var errs []error
+	for j, elem := range elems {
+		i := j
+		if positions != nil {
+			i = positions[j]
+		}
+		switch {
+		case elem.Error != nil:
+			errs = append(errs, &ItemError{Index: i, Err: elem.Error})
+		case !found(i):
+			errs = append(errs, &ItemError{Index: i, Err: ethereum.NotFound})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// batchCall sends elems in batches of batchSize, setting
+// the result or error of each. A batch goes through retry like any read
+// call: a batch that fails as a whole is sent again, and so are its items
+// failing with a transient error, until the attempts are exhausted. The
+// error returned is that of a batch that got no answer; the errors of
+// answered items are left in elems.
+func (c *OnChainClient) batchCall(ctx context.Context, method string, elems []rpc.BatchElem) error {
+	for start := 0; start < len(elems); start += c.batchSize {
+		chunk := elems[start:min(start+c.batchSize, len(elems))]
+		pending := make([]int, len(chunk))
+		for i := range pending {
+			pending[i] = i
+		}
+
+		var answered bool
+		err := c.retry(ctx, method, func(ctx context.Context, client rpcBackend) error {
+			batch := make([]rpc.BatchElem, len(pending))
+			for i, j := range pending {
+				batch[i] = chunk[j]
+				batch[i].Error = nil
+			}
+			answered = false
+			if err := client.Client().BatchCallContext(ctx, batch); err != nil {
+				return err
+			}
+			answered = true
+
+			var retryable []int
+			var firstErr error
+			for i, j := range pending {
+				chunk[j].Error = batch[i].Error
+				if rpcerr.IsRetryable(batch[i].Error) {
+					retryable = append(retryable, j)
+					if firstErr == nil {
+						firstErr = batch[i].Error
+					}
+				}
+			}
+			pending = retryable
+			if firstErr != nil {
+				return fmt.Errorf("%d of %d items failed: %w", len(retryable), len(batch), firstErr)
+			}
+			return nil
+		})
+		if err != nil && !answered {
+			return err
+		}
+	}
+	return nil
+}
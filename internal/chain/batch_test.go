@@ -0,0 +1,143 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+// serveHeaders answers eth_getBlockByNumber with a header for blocks below
+// head and null above, unless fail returns an error for the block.
+func serveHeaders(t *testing.T, s *rpcStub, head uint64, fail func(number uint64) *stubError) {
+	s.handle("eth_getBlockByNumber", func(params []json.RawMessage) (any, *stubError) {
+		var number hexutil.Uint64
+		require.NoError(t, json.Unmarshal(params[0], &number))
+		if fail != nil {
+			if err := fail(uint64(number)); err != nil {
+				return nil, err
+			}
+		}
+		if uint64(number) >= head {
+			return nil, nil
+		}
+		return &types.Header{
+			UncleHash:  types.EmptyUncleHash,
+			Difficulty: big.NewInt(1),
+			Number:     new(big.Int).SetUint64(uint64(number)),
+			GasLimit:   30_000_000,
+			Time:       1_700_000_000 + 2*uint64(number),
+			Extra:      []byte{},
+		}, nil
+	})
+}
+
+// TestGetHeadersByNumbers tests that headers are fetched in batches of the
+// batch size and returned in input order.
+func TestGetHeadersByNumbers(t *testing.T) {
+	stub := newRPCStub(t)
+	serveHeaders(t, stub, 1000, nil)
+	c := stubClient(t, stub, WithBatchSize(4))
+
+	numbers := []uint64{5, 3, 9, 1, 7, 2, 8, 6, 4, 0}
+	headers, err := c.GetHeadersByNumbers(context.Background(), numbers)
+	require.NoError(t, err)
+	require.Len(t, headers, len(numbers))
+	for i, header := range headers {
+		require.Equal(t, numbers[i], header.Number.Uint64())
+		require.Equal(t, 1_700_000_000+2*numbers[i], header.Time)
+	}
+	require.Equal(t, []int{4, 4, 2}, stub.batchSizes())
+	require.Equal(t, 10, stub.callsOf("eth_getBlockByNumber"))
+
+	headers, err = c.GetHeadersByNumbers(context.Background(), nil)
+	require.NoError(t, err)
+	require.Empty(t, headers)
+	require.Len(t, stub.batchSizes(), 3)
+}
+
+// TestGetHeadersByNumbersItemErrors tests that missing and failed items are
+// reported by position, the others being returned.
+func TestGetHeadersByNumbersItemErrors(t *testing.T) {
+	stub := newRPCStub(t)
+	invalid := &stubError{Code: -32602, Message: "invalid argument 0"}
+	serveHeaders(t, stub, 1000, func(number uint64) *stubError {
+		if number == 3 {
+			return invalid
+		}
+		return nil
+	})
+	c := stubClient(t, stub)
+
+	headers, err := c.GetHeadersByNumbers(context.Background(), []uint64{1, 2000, 3, 4})
+	require.ErrorIs(t, err, ethereum.NotFound)
+	require.Equal(t, uint64(1), headers[0].Number.Uint64())
+	require.Nil(t, headers[1])
+	require.Nil(t, headers[2])
+	require.Equal(t, uint64(4), headers[3].Number.Uint64())
+
+	var failed []int
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var itemErr *ItemError
+		require.True(t, errors.As(err, &itemErr))
+		failed = append(failed, itemErr.Index)
+	}
+	require.Equal(t, []int{1, 2}, failed)
+	require.ErrorContains(t, err, "item 2: invalid argument 0")
+	require.Equal(t, []int{4}, stub.batchSizes(), "answers of the node are not retried")
+}
+
+// TestGetHeadersByNumbersRetriesItems tests that only the items of a batch
+// failing with a transient error are sent again.
+func TestGetHeadersByNumbersRetriesItems(t *testing.T) {
+	stub := newRPCStub(t)
+	limited := true
+	serveHeaders(t, stub, 1000, func(number uint64) *stubError {
+		if number == 7 && limited {
+			limited = false
+			return &stubError{Code: -32005, Message: "limit exceeded"}
+		}
+		return nil
+	})
+	c := stubClient(t, stub, WithRetry(3, time.Millisecond, time.Millisecond))
+
+	headers, err := c.GetHeadersByNumbers(context.Background(), []uint64{6, 7, 8})
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), headers[1].Number.Uint64())
+	require.Equal(t, []int{3, 1}, stub.batchSizes())
+}
+
+// TestGetReceiptsByHashes tests that receipts are fetched in one batch, in
+// input order, and that unknown transactions are reported by position.
+func TestGetReceiptsByHashes(t *testing.T) {
+	stub := newRPCStub(t)
+	f := newFixtureBlock(t, 65_000_000, 5)
+	f.serve(stub, false)
+	c := stubClient(t, stub)
+
+	unknown := common.HexToHash("0x01")
+	hashes := []common.Hash{f.receipts[4].TxHash, f.receipts[0].TxHash, unknown, f.receipts[2].TxHash}
+	receipts, err := c.GetReceiptsByHashes(context.Background(), hashes)
+	require.ErrorIs(t, err, ethereum.NotFound)
+	var itemErr *ItemError
+	require.ErrorAs(t, err, &itemErr)
+	require.Equal(t, 2, itemErr.Index)
+
+	require.Len(t, receipts, len(hashes))
+	for i, receipt := range receipts {
+		if i == 2 {
+			require.Nil(t, receipt)
+			continue
+		}
+		require.Equal(t, hashes[i], receipt.TxHash)
+	}
+	require.Equal(t, []int{4}, stub.batchSizes())
+}
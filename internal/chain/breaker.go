@@ -0,0 +1,145 @@
+package chain
+
+import (
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var rpcEndpointState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "polymarket_rpc_endpoint_state",
+	Help: "State of each RPC endpoint's circuit breaker (0 = closed, 1 = half-open, 2 = open), by endpoint position",
+}, []string{"endpoint_index"})
+
+const (
+	// DefaultBreakerFailures is the default number of failed calls of an
+	// endpoint within the breaker window that open its circuit breaker
+	DefaultBreakerFailures = 5
+
+	// DefaultBreakerWindow is the default window failed calls are counted in
+	DefaultBreakerWindow = time.Minute
+
+	// DefaultBreakerCooldown is the default time an endpoint's circuit
+	// breaker stays open before the endpoint is tried again
+	DefaultBreakerCooldown = 5 * time.Minute
+)
+
+// breakerState is the state of an endpoint's circuit breaker. The values
+// are those of the polymarket_rpc_endpoint_state gauge.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	}
+	return "closed"
+}
+
+// endpointBreaker quarantines a flapping endpoint. It opens after
+// breakerFailures failed calls within breakerWindow, and failovers and
+// fail-backs skip the endpoint while it is open. After breakerCooldown it
+// turns half-open and the endpoint may be switched to again: its next call
+// closes the breaker on success and reopens it on failure. Its fields are
+// guarded by OnChainClient.mu.
+type endpointBreaker struct {
+	state       breakerState
+	failures    []time.Time // Failed calls within the window, while closed
+	openedAt    time.Time
+	lastFailure time.Time
+}
+
+// WithCircuitBreaker sets the number of failed calls of an endpoint within
+// window that quarantine it, and the time it stays quarantined before it
+// is tried again. Non-positive values keep the defaults.
+func WithCircuitBreaker(failures int, window, cooldown time.Duration) ClientOption {
+	return func(c *OnChainClient) {
+		if failures > 0 {
+			c.breakerFailures = failures
+		}
+		if window > 0 {
+			c.breakerWindow = window
+		}
+		if cooldown > 0 {
+			c.breakerCooldown = cooldown
+		}
+	}
+}
+
+// breakerAllows reports whether the breaker of ep lets failovers and
+// fail-backs switch to it, turning it half-open once its cooldown elapsed.
+// The caller holds c.mu.
+func (c *OnChainClient) breakerAllows(ep *endpoint) bool {
+	b := &ep.breaker
+	if b.state == breakerOpen && c.now().Sub(b.openedAt) >= c.breakerCooldown {
+		c.setBreaker(ep, breakerHalfOpen, nil)
+	}
+	return b.state != breakerOpen
+}
+
+// breakerFailure records a failed call of ep. It opens the breaker when
+// the endpoint failed breakerFailures times within the window or failed
+// while half-open, and reports whether the breaker is open. The caller
+// holds c.mu.
+func (c *OnChainClient) breakerFailure(ep *endpoint, err error) bool {
+	now := c.now()
+	b := &ep.breaker
+	b.lastFailure = now
+	switch b.state {
+	case breakerOpen:
+		return true
+	case breakerHalfOpen:
+		b.openedAt = now
+		c.setBreaker(ep, breakerOpen, err)
+		return true
+	}
+
+	b.failures = slices.DeleteFunc(b.failures, func(failed time.Time) bool {
+		return now.Sub(failed) >= c.breakerWindow
+	})
+	b.failures = append(b.failures, now)
+	if len(b.failures) < c.breakerFailures {
+		return false
+	}
+	b.failures = nil
+	b.openedAt = now
+	c.setBreaker(ep, breakerOpen, err)
+	return true
+}
+
+// breakerSuccess closes the breaker of ep if it is half-open. The caller
+// holds c.mu.
+func (c *OnChainClient) breakerSuccess(ep *endpoint) {
+	if ep.breaker.state == breakerHalfOpen {
+		c.setBreaker(ep, breakerClosed, nil)
+	}
+}
+
+// setBreaker moves the breaker of ep to state, logging the transition. The
+// caller holds c.mu.
+func (c *OnChainClient) setBreaker(ep *endpoint, state breakerState, cause error) {
+	from := ep.breaker.state
+	ep.breaker.state = state
+	rpcEndpointState.WithLabelValues(strconv.Itoa(ep.index)).Set(float64(state))
+
+	event := c.logger.Info()
+	if state == breakerOpen {
+		event = c.logger.Warn().Err(cause).Dur("cooldown", c.breakerCooldown)
+	}
+	event.
+		Str("endpoint", ep.label).
+		Stringer("from", from).
+		Stringer("to", state).
+		Msg("RPC endpoint circuit breaker changed state")
+}
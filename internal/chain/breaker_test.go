@@ -0,0 +1,149 @@
+package chain
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// testClock sets the clock of the client's circuit breakers, advanced by
+// the returned function.
+func testClock(c *OnChainClient) func(time.Duration) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return func(d time.Duration) { now = now.Add(d) }
+}
+
+// requireBreaker checks the state of the circuit breaker of the endpoint
+// at position i, and its gauge.
+func requireBreaker(t *testing.T, c *OnChainClient, i int, state breakerState) {
+	t.Helper()
+	c.mu.Lock()
+	require.Equal(t, state, c.endpoints[i].breaker.state, "endpoint %d", i)
+	c.mu.Unlock()
+	require.Equal(t, float64(state), testutil.ToFloat64(rpcEndpointState.WithLabelValues(strconv.Itoa(i))), "endpoint %d", i)
+}
+
+// TestBreakerOpensWithinWindow tests that an endpoint's circuit breaker
+// opens after the configured number of failed calls within the window,
+// failures spread wider not opening it, and that the client fails over to
+// the next endpoint once it opens.
+func TestBreakerOpensWithinWindow(t *testing.T) {
+	primary := &fakeBackend{chainID: 137, err: errConnRefused}
+	backup := &fakeBackend{chainID: 137, blockNumber: 65_000_000}
+	c := testClient(t, "breaker-window", []*fakeBackend{primary, backup},
+		WithFailover(100, time.Second, time.Minute), WithCircuitBreaker(3, time.Minute, 5*time.Minute))
+	advance := testClock(c)
+	ctx := context.Background()
+
+	// Failures more than a window apart
+	for range 3 {
+		_, err := c.GetLatestBlockNumber(ctx)
+		require.ErrorIs(t, err, errConnRefused)
+		advance(61 * time.Second)
+	}
+	requireBreaker(t, c, 0, breakerClosed)
+	require.Equal(t, 0, c.active)
+
+	// Failures within a window
+	for range 2 {
+		_, err := c.GetLatestBlockNumber(ctx)
+		require.ErrorIs(t, err, errConnRefused)
+		advance(20 * time.Second)
+	}
+	requireBreaker(t, c, 0, breakerClosed)
+	number, err := c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err, "retried on the backup")
+	require.Equal(t, uint64(65_000_000), number)
+	requireBreaker(t, c, 0, breakerOpen)
+	require.Equal(t, 1, c.active)
+}
+
+// TestBreakerHalfOpen tests that a quarantined endpoint is not failed back
+// to before the cooldown, even once it recovered, that a failed half-open
+// probe quarantines it for another cooldown, and that a successful one
+// closes its breaker and fails back.
+func TestBreakerHalfOpen(t *testing.T) {
+	primary := &fakeBackend{chainID: 137, err: errConnRefused}
+	backup := &fakeBackend{chainID: 137}
+	c := testClient(t, "breaker-half-open", []*fakeBackend{primary, backup},
+		WithFailover(100, time.Second, time.Minute), WithCircuitBreaker(1, time.Minute, 5*time.Minute))
+	advance := testClock(c)
+	ctx := context.Background()
+
+	_, err := c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	requireBreaker(t, c, 0, breakerOpen)
+	require.Equal(t, 1, c.active)
+
+	// Quarantined until the cooldown elapsed
+	primary.setErr(nil)
+	advance(4 * time.Minute)
+	c.probe(ctx)
+	require.Equal(t, 1, c.active)
+	requireBreaker(t, c, 0, breakerOpen)
+
+	// Failed probe: open for another cooldown
+	primary.setErr(errConnRefused)
+	advance(time.Minute)
+	c.probe(ctx)
+	require.Equal(t, 1, c.active)
+	requireBreaker(t, c, 0, breakerOpen)
+	primary.setErr(nil)
+	advance(4 * time.Minute)
+	c.probe(ctx)
+	requireBreaker(t, c, 0, breakerOpen)
+
+	// Successful probe: closed
+	advance(time.Minute)
+	c.probe(ctx)
+	require.Equal(t, 0, c.active)
+	requireBreaker(t, c, 0, breakerClosed)
+}
+
+// TestBreakerAllOpen tests that once every endpoint's circuit breaker is
+// open the client keeps working on the least recently failed endpoint, and
+// that a failover to a half-open endpoint failing reopens its breaker at
+// once.
+func TestBreakerAllOpen(t *testing.T) {
+	backends := []*fakeBackend{{chainID: 137}, {chainID: 137}, {chainID: 137}}
+	c := testClient(t, "breaker-all-open", backends,
+		WithFailover(100, time.Second, time.Minute), WithCircuitBreaker(1, time.Minute, 5*time.Minute))
+	advance := testClock(c)
+	ctx := context.Background()
+
+	// Each endpoint fails in turn, a second apart
+	for i, b := range backends {
+		b.setErr(errConnRefused)
+		_, err := c.GetLatestBlockNumber(ctx)
+		if i < 2 {
+			require.NoError(t, err)
+			require.Equal(t, i+1, c.active)
+		}
+		requireBreaker(t, c, i, breakerOpen)
+		advance(time.Second)
+	}
+
+	// With every breaker open, failovers go to the least recently failed
+	// endpoint rather than nowhere, and calls succeed once it answers
+	backends[0].setErr(nil)
+	_, err := c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, c.active)
+	requireBreaker(t, c, 0, breakerOpen)
+
+	// After the cooldown, failovers try the half-open endpoints again: one
+	// failing is quarantined again at once, one answering is closed
+	advance(5 * time.Minute)
+	backends[0].setErr(errConnRefused)
+	backends[2].setErr(nil)
+	_, err = c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, c.active)
+	requireBreaker(t, c, 1, breakerOpen)
+	requireBreaker(t, c, 2, breakerClosed)
+}
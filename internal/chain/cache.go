@@ -0,0 +1,174 @@
+package chain
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	headerCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_rpc_header_cache_hits_total",
+		Help: "Total number of block headers served from the chain client cache, by lookup key (number, hash)",
+	}, []string{"key"})
+
+	headerCacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_rpc_header_cache_misses_total",
+		Help: "Total number of block headers looked up in the chain client cache and fetched, by lookup key (number, hash)",
+	}, []string{"key"})
+)
+
+// DefaultHeaderCacheSize is the default number of block headers the client
+// caches
+const DefaultHeaderCacheSize = 1024
+
+// WithHeaderCache sets the number of block headers the client caches, the
+// least recently used being evicted. Zero keeps the default; a negative
+// size disables the cache.
+func WithHeaderCache(size int) ClientOption {
+	return func(c *OnChainClient) {
+		switch {
+		case size > 0:
+			c.headers = newHeaderCache(size)
+		case size < 0:
+			c.headers = nil
+		}
+	}
+}
+
+// InvalidateHeadersAbove drops the cached headers of blocks above height,
+// which a reorg may have replaced.
+func (c *OnChainClient) InvalidateHeadersAbove(height uint64) {
+	if dropped := c.headers.invalidateAbove(height); dropped > 0 {
+		c.logger.Debug().
+			Uint64("height", height).
+			Int("dropped", dropped).
+			Msg("invalidated cached headers")
+	}
+}
+
+// GetHeaderByHash fetches the header of a block by its hash.
+func (c *OnChainClient) GetHeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	if header, ok := c.headers.getByHash(hash); ok {
+		return header, nil
+	}
+	var header *types.Header
+	err := c.retry(ctx, "header_by_hash", func(ctx context.Context, client rpcBackend) (err error) {
+		header, err = client.HeaderByHash(ctx, hash)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch header by hash %s: %w", hash.Hex(), err)
+	}
+	c.headers.add(header)
+	return header, nil
+}
+
+// headerCache is an LRU cache of block headers, looked up by number or
+// hash. A nil cache caches nothing. Cached headers are shared and must not
+// be modified.
+type headerCache struct {
+	mu       sync.Mutex
+	size     int
+	order    *list.List // Of *cachedHeader, most recently used first
+	byNumber map[uint64]*list.Element
+	byHash   map[common.Hash]*list.Element
+}
+
+// cachedHeader is a cached header with its hash, computed once.
+type cachedHeader struct {
+	header *types.Header
+	hash   common.Hash
+}
+
+func newHeaderCache(size int) *headerCache {
+	return &headerCache{
+		size:     size,
+		order:    list.New(),
+		byNumber: make(map[uint64]*list.Element, size),
+		byHash:   make(map[common.Hash]*list.Element, size),
+	}
+}
+
+// getByNumber returns the cached header of block number.
+func (h *headerCache) getByNumber(number uint64) (*types.Header, bool) {
+	if h == nil {
+		return nil, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hit("number", h.byNumber[number])
+}
+
+// getByHash returns the cached header of the block of hash.
+func (h *headerCache) getByHash(hash common.Hash) (*types.Header, bool) {
+	if h == nil {
+		return nil, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hit("hash", h.byHash[hash])
+}
+
+// hit marks elem, if any, as most recently used and counts the lookup.
+func (h *headerCache) hit(key string, elem *list.Element) (*types.Header, bool) {
+	if elem == nil {
+		headerCacheMisses.WithLabelValues(key).Inc()
+		return nil, false
+	}
+	headerCacheHits.WithLabelValues(key).Inc()
+	h.order.MoveToFront(elem)
+	return elem.Value.(*cachedHeader).header, true
+}
+
+// add caches header, replacing a header cached for the same number, and
+// evicts the least recently used header beyond the size.
+func (h *headerCache) add(header *types.Header) {
+	if h == nil || header == nil || header.Number == nil {
+		return
+	}
+	number, hash := header.Number.Uint64(), header.Hash()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if elem, ok := h.byNumber[number]; ok {
+		h.remove(elem)
+	}
+	elem := h.order.PushFront(&cachedHeader{header: header, hash: hash})
+	h.byNumber[number] = elem
+	h.byHash[hash] = elem
+	if h.order.Len() > h.size {
+		h.remove(h.order.Back())
+	}
+}
+
+// invalidateAbove drops the headers of blocks above height, returning the
+// number dropped.
+func (h *headerCache) invalidateAbove(height uint64) int {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	dropped := 0
+	for number, elem := range h.byNumber {
+		if number > height {
+			h.remove(elem)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// remove drops the header of elem.
+func (h *headerCache) remove(elem *list.Element) {
+	cached := h.order.Remove(elem).(*cachedHeader)
+	delete(h.byNumber, cached.header.Number.Uint64())
+	delete(h.byHash, cached.hash)
+}
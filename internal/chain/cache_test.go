@@ -0,0 +1,96 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// cacheHeader returns a header of block number, extra telling apart
+// headers of the same number.
+func cacheHeader(number uint64, extra byte) *types.Header {
+	return &types.Header{Number: new(big.Int).SetUint64(number), Extra: []byte{extra}}
+}
+
+// TestHeaderCache tests that headers are looked up by number and hash, that
+// the least recently used is evicted, that a header replaces the one of
+// the same number, and that headers above a height are invalidated.
+func TestHeaderCache(t *testing.T) {
+	cache := newHeaderCache(3)
+	hits := testutil.ToFloat64(headerCacheHits.WithLabelValues("number"))
+	misses := testutil.ToFloat64(headerCacheMisses.WithLabelValues("number"))
+
+	for number := uint64(1); number <= 3; number++ {
+		cache.add(cacheHeader(number, 0))
+	}
+	_, ok := cache.getByNumber(1)
+	require.True(t, ok)
+	cache.add(cacheHeader(4, 0))
+	_, ok = cache.getByNumber(2)
+	require.False(t, ok, "the least recently used header is evicted")
+	require.Equal(t, hits+1, testutil.ToFloat64(headerCacheHits.WithLabelValues("number")))
+	require.Equal(t, misses+1, testutil.ToFloat64(headerCacheMisses.WithLabelValues("number")))
+
+	replaced := cacheHeader(3, 0)
+	cache.add(cacheHeader(3, 1))
+	_, ok = cache.getByHash(replaced.Hash())
+	require.False(t, ok, "a header of the same number replaces the cached one")
+	header, ok := cache.getByHash(cacheHeader(3, 1).Hash())
+	require.True(t, ok)
+	require.Equal(t, []byte{1}, header.Extra)
+
+	require.Equal(t, 2, cache.invalidateAbove(2))
+	for number, cached := range map[uint64]bool{1: true, 3: false, 4: false} {
+		_, ok := cache.getByNumber(number)
+		require.Equal(t, cached, ok, "block %d", number)
+	}
+	require.Len(t, cache.byHash, 1)
+
+	var disabled *headerCache
+	disabled.add(cacheHeader(1, 0))
+	_, ok = disabled.getByNumber(1)
+	require.False(t, ok)
+}
+
+// TestGetHeadersByNumbersCache tests that batched header fetches only ask
+// for the headers not cached, that they cache the headers they fetch for
+// single lookups, and that item errors keep their input position.
+func TestGetHeadersByNumbersCache(t *testing.T) {
+	stub := newRPCStub(t)
+	serveHeaders(t, stub, 1000, nil)
+	c := stubClient(t, stub)
+	ctx := context.Background()
+
+	_, err := c.GetHeadersByNumbers(ctx, []uint64{1, 2, 3})
+	require.NoError(t, err)
+	headers, err := c.GetHeadersByNumbers(ctx, []uint64{2, 3, 4})
+	require.NoError(t, err)
+	for i, header := range headers {
+		require.Equal(t, uint64(2+i), header.Number.Uint64())
+	}
+	require.Equal(t, []int{3, 1}, stub.batchSizes())
+
+	header, err := c.GetHeaderByNumber(ctx, 4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), header.Number.Uint64())
+	header, err = c.GetHeaderByHash(ctx, header.Hash())
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), header.Number.Uint64())
+	require.Equal(t, 4, stub.callsOf("eth_getBlockByNumber"))
+
+	_, err = c.GetHeadersByNumbers(ctx, []uint64{1, 2000})
+	var itemErr *ItemError
+	require.ErrorAs(t, err, &itemErr)
+	require.Equal(t, 1, itemErr.Index)
+	require.ErrorIs(t, err, ethereum.NotFound)
+
+	c.InvalidateHeadersAbove(3)
+	_, err = c.GetHeaderByNumber(ctx, 4)
+	require.NoError(t, err)
+	require.Equal(t, 6, stub.callsOf("eth_getBlockByNumber"))
+}
@@ -0,0 +1,232 @@
+// Package chaintest provides an in-memory chain.Reader serving synthetic,
+// deterministic blocks and logs for tests of the processor and the syncer.
+package chaintest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/0xkanth/polymarket-indexer/internal/chain"
+)
+
+// BaseTime is the timestamp of block 0; block n is mined at BaseTime + 2n.
+const BaseTime = 1_700_000_000
+
+// ErrNoSubscriptions is returned by the subscription methods: the chain has
+// no WebSocket endpoint.
+var ErrNoSubscriptions = errors.New("chaintest: subscriptions not supported")
+
+// Chain is a chain.Reader serving the blocks up to its head, with the logs
+// added to them, counting the calls of each method. A method made to fail
+// returns its error until cleared.
+type Chain struct {
+	mu            sync.Mutex
+	head          uint64
+	logs          map[uint64][]types.Log
+	hashes        map[common.Hash]uint64
+	calls         map[string]int
+	headerBatches [][]uint64
+	fail          map[string]error
+}
+
+var _ chain.Reader = (*Chain)(nil)
+
+// New returns a chain whose head is block head.
+func New(head uint64) *Chain {
+	return &Chain{
+		head:   head,
+		logs:   make(map[uint64][]types.Log),
+		hashes: make(map[common.Hash]uint64),
+		calls:  make(map[string]int),
+		fail:   make(map[string]error),
+	}
+}
+
+// SetHead moves the head of the chain to block head.
+func (c *Chain) SetHead(head uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.head = head
+}
+
+// AddLogs adds logs to the blocks of their BlockNumber, setting their
+// BlockHash. Logs of blocks past the head are served once it reaches them.
+func (c *Chain) AddLogs(logs ...types.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, log := range logs {
+		log.BlockHash = c.header(log.BlockNumber).Hash()
+		c.logs[log.BlockNumber] = append(c.logs[log.BlockNumber], log)
+	}
+}
+
+// Fail makes method (e.g. "FilterLogs") fail with err, or succeed again if
+// err is nil.
+func (c *Chain) Fail(method string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fail[method] = err
+}
+
+// Calls returns the number of calls of method so far.
+func (c *Chain) Calls(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[method]
+}
+
+// HeaderBatches returns the block numbers of each GetHeadersByNumbers call
+// so far, in call order.
+func (c *Chain) HeaderBatches() [][]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.headerBatches)
+}
+
+// Header returns the header of block number, whether or not the head has
+// reached it.
+func (c *Chain) Header(number uint64) *types.Header {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.header(number)
+}
+
+// header builds the header of block number and remembers its hash. The
+// caller holds c.mu.
+func (c *Chain) header(number uint64) *types.Header {
+	header := &types.Header{
+		UncleHash:  types.EmptyUncleHash,
+		Difficulty: big.NewInt(1),
+		Number:     new(big.Int).SetUint64(number),
+		GasLimit:   30_000_000,
+		Time:       BaseTime + 2*number,
+	}
+	c.hashes[header.Hash()] = number
+	return header
+}
+
+// call counts a call of method and returns the error it was made to fail
+// with. The caller holds c.mu.
+func (c *Chain) call(method string) error {
+	c.calls[method]++
+	return c.fail[method]
+}
+
+func (c *Chain) GetLatestBlockNumber(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetLatestBlockNumber"); err != nil {
+		return 0, err
+	}
+	return c.head, nil
+}
+
+func (c *Chain) GetHeaderByNumber(ctx context.Context, blockNumber uint64) (*types.Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetHeaderByNumber"); err != nil {
+		return nil, err
+	}
+	if blockNumber > c.head {
+		return nil, fmt.Errorf("block %d: %w", blockNumber, ethereum.NotFound)
+	}
+	return c.header(blockNumber), nil
+}
+
+func (c *Chain) GetHeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetHeaderByHash"); err != nil {
+		return nil, err
+	}
+	number, ok := c.hashes[hash]
+	if !ok || number > c.head {
+		return nil, fmt.Errorf("block %s: %w", hash.Hex(), ethereum.NotFound)
+	}
+	return c.header(number), nil
+}
+
+func (c *Chain) GetHeadersByNumbers(ctx context.Context, numbers []uint64) ([]*types.Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.headerBatches = append(c.headerBatches, slices.Clone(numbers))
+	if err := c.call("GetHeadersByNumbers"); err != nil {
+		return nil, err
+	}
+	headers := make([]*types.Header, len(numbers))
+	for i, number := range numbers {
+		if number > c.head {
+			return nil, &chain.ItemError{Index: i, Err: fmt.Errorf("block %d: %w", number, ethereum.NotFound)}
+		}
+		headers[i] = c.header(number)
+	}
+	return headers, nil
+}
+
+// FilterLogs returns the logs matching query in block order, a nil block
+// bound meaning the head as for eth_getLogs.
+func (c *Chain) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("FilterLogs"); err != nil {
+		return nil, err
+	}
+
+	from, to := c.head, c.head
+	if query.BlockHash != nil {
+		number, ok := c.hashes[*query.BlockHash]
+		if !ok {
+			return nil, fmt.Errorf("block %s: %w", query.BlockHash.Hex(), ethereum.NotFound)
+		}
+		from, to = number, number
+	} else {
+		if query.FromBlock != nil {
+			from = query.FromBlock.Uint64()
+		}
+		if query.ToBlock != nil {
+			to = query.ToBlock.Uint64()
+		}
+	}
+
+	var logs []types.Log
+	for number := from; number <= min(to, c.head); number++ {
+		for _, log := range c.logs[number] {
+			if matches(query, log) {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs, nil
+}
+
+// matches reports whether log matches the addresses and topics of query.
+func matches(query ethereum.FilterQuery, log types.Log) bool {
+	if len(query.Addresses) > 0 && !slices.Contains(query.Addresses, log.Address) {
+		return false
+	}
+	if len(query.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, topics := range query.Topics {
+		if len(topics) > 0 && !slices.Contains(topics, log.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Chain) SubscribeNewHead(ctx context.Context) (*chain.HeadSubscription, error) {
+	return nil, ErrNoSubscriptions
+}
+
+func (c *Chain) SubscribeLogs(ctx context.Context, query ethereum.FilterQuery) (*chain.LogSubscription, error) {
+	return nil, ErrNoSubscriptions
+}
@@ -0,0 +1,270 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/rs/zerolog"
+)
+
+// WithDebugLogging logs a sampleRate fraction (0 to 1) of the JSON-RPC
+// requests sent over HTTP at debug level: methods, a summary of their
+// params, duration, response size and errors, the endpoint URL redacted.
+// Non-positive values keep it disabled.
+func WithDebugLogging(sampleRate float64) ClientOption {
+	return func(c *OnChainClient) {
+		if sampleRate > 0 {
+			c.debugSampleRate = min(sampleRate, 1)
+		}
+	}
+}
+
+// debugTransport is an http.RoundTripper logging a sample of the JSON-RPC
+// requests it sends through next. Params are summarized (block numbers,
+// hash and address counts) rather than logged, keeping lines short and
+// payloads out of the logs.
+type debugTransport struct {
+	next       http.RoundTripper
+	logger     *zerolog.Logger
+	sampleRate float64
+	sample     func() float64 // Uniform in [0, 1)
+}
+
+// debugRoundTripper returns next logging a sample of its requests when
+// debug logging is enabled, next itself otherwise.
+func (c *OnChainClient) debugRoundTripper(next http.RoundTripper) http.RoundTripper {
+	if c.debugSampleRate <= 0 {
+		return next
+	}
+	return &debugTransport{next: next, logger: c.logger, sampleRate: c.debugSampleRate, sample: rand.Float64}
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	debug := zerolog.GlobalLevel() <= zerolog.DebugLevel && t.logger.GetLevel() <= zerolog.DebugLevel
+	if !debug || req.Body == nil || t.sample() >= t.sampleRate {
+		return t.next.RoundTrip(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	calls := parseRPCCalls(body)
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	event := t.logger.Debug().
+		Str("endpoint", redactURL(req.URL)).
+		Strs("methods", callMethods(calls)).
+		Str("params", summarizeParams(calls)).
+		Dur("duration", time.Since(start))
+	if len(calls) > 1 {
+		event = event.Int("batch", len(calls))
+	}
+	if err != nil {
+		event.Err(err).Msg("RPC request failed")
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	event = event.Int("status", resp.StatusCode).Int("response_bytes", len(respBody))
+	if err != nil {
+		event.Err(err).Msg("RPC request failed")
+		return resp, nil
+	}
+	if failed, first := responseErrors(respBody); failed > 0 {
+		event = event.Int("failed", failed).Str("rpc_error", first)
+	}
+	event.Msg("RPC request")
+	return resp, nil
+}
+
+// rpcCall is a JSON-RPC call of a request.
+type rpcCall struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// parseRPCCalls returns the calls of a JSON-RPC request body, batched or
+// not, or none if it is not one.
+func parseRPCCalls(body []byte) []rpcCall {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var calls []rpcCall
+		_ = json.Unmarshal(body, &calls)
+		return calls
+	}
+	var call rpcCall
+	if err := json.Unmarshal(body, &call); err != nil {
+		return nil
+	}
+	return []rpcCall{call}
+}
+
+// callMethods returns the distinct methods of calls, in order.
+func callMethods(calls []rpcCall) []string {
+	var methods []string
+	for _, call := range calls {
+		if !slices.Contains(methods, call.Method) {
+			methods = append(methods, call.Method)
+		}
+	}
+	return methods
+}
+
+// summarizeParams summarizes the params of calls: the block numbers or
+// their range, block tags, and the number of hashes, addresses and topics.
+func summarizeParams(calls []rpcCall) string {
+	var s paramSummary
+	for _, call := range calls {
+		for _, param := range call.Params {
+			s.add(param)
+		}
+	}
+	return s.String()
+}
+
+// paramSummary accumulates the params of calls.
+type paramSummary struct {
+	blocks    []uint64
+	tags      []string
+	hashes    int
+	addresses int
+	topics    int
+}
+
+func (s *paramSummary) add(param json.RawMessage) {
+	var value any
+	if err := json.Unmarshal(param, &value); err != nil {
+		return
+	}
+	switch v := value.(type) {
+	case string:
+		s.addString(v)
+	case map[string]any:
+		// Filter query or call message
+		for _, key := range []string{"fromBlock", "toBlock", "blockHash"} {
+			if str, ok := v[key].(string); ok {
+				s.addString(str)
+			}
+		}
+		switch address := v["address"].(type) {
+		case string:
+			s.addresses++
+		case []any:
+			s.addresses += len(address)
+		}
+		if topics, ok := v["topics"].([]any); ok {
+			s.topics += len(topics)
+		}
+		if _, ok := v["to"].(string); ok {
+			s.addresses++
+		}
+	}
+}
+
+func (s *paramSummary) addString(v string) {
+	switch {
+	case len(v) == 66 && strings.HasPrefix(v, "0x"):
+		s.hashes++
+	case len(v) == 42 && strings.HasPrefix(v, "0x"):
+		s.addresses++
+	case strings.HasPrefix(v, "0x"):
+		if number, err := hexutil.DecodeUint64(v); err == nil {
+			s.blocks = append(s.blocks, number)
+		}
+	default:
+		if !slices.Contains(s.tags, v) {
+			s.tags = append(s.tags, v)
+		}
+	}
+}
+
+func (s *paramSummary) String() string {
+	var parts []string
+	switch len(s.blocks) {
+	case 0:
+	case 1:
+		parts = append(parts, "block="+strconv.FormatUint(s.blocks[0], 10))
+	default:
+		parts = append(parts, fmt.Sprintf("blocks=%d..%d", slices.Min(s.blocks), slices.Max(s.blocks)))
+	}
+	if len(s.tags) > 0 {
+		parts = append(parts, "tag="+strings.Join(s.tags, ","))
+	}
+	for _, count := range []struct {
+		name string
+		n    int
+	}{{"hashes", s.hashes}, {"addresses", s.addresses}, {"topics", s.topics}} {
+		if count.n > 0 {
+			parts = append(parts, count.name+"="+strconv.Itoa(count.n))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// responseErrors returns the number of JSON-RPC errors in a response body,
+// batched or not, and the message of the first.
+func responseErrors(body []byte) (int, string) {
+	type response struct {
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	var responses []response
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		_ = json.Unmarshal(body, &responses)
+	} else {
+		var resp response
+		if json.Unmarshal(body, &resp) == nil {
+			responses = append(responses, resp)
+		}
+	}
+
+	failed, first := 0, ""
+	for _, resp := range responses {
+		if resp.Error == nil {
+			continue
+		}
+		if failed == 0 {
+			first = resp.Error.Message
+		}
+		failed++
+	}
+	return failed, first
+}
+
+// redactURL returns u without credentials, the query values and the path
+// segments long enough to be API keys replaced.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	segments := strings.Split(redacted.Path, "/")
+	for i, segment := range segments {
+		if len(segment) >= 16 {
+			segments[i] = "REDACTED"
+		}
+	}
+	redacted.Path, redacted.RawPath = strings.Join(segments, "/"), ""
+	query := redacted.Query()
+	for key := range query {
+		query.Set(key, "REDACTED")
+	}
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
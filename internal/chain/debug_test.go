@@ -0,0 +1,117 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// debugLines returns the JSON log lines written to buf.
+func debugLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &fields))
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+// TestDebugLogging tests that debug logging logs each request's methods,
+// params summary, duration, response size and JSON-RPC error, with the API
+// keys of the endpoint URL redacted.
+func TestDebugLogging(t *testing.T) {
+	stub := newRPCStub(t)
+	stub.handle("eth_getLogs", func([]json.RawMessage) (any, *stubError) { return []any{}, nil })
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).Level(zerolog.DebugLevel)
+
+	rpcURL := stub.server.URL + "/v2/0123456789abcdef0123456789abcdef?apikey=secret"
+	c, err := NewClient([]string{rpcURL}, "", 137, &logger, WithDebugLogging(1), WithRetry(1, 0, 0))
+	require.NoError(t, err)
+	defer c.Close()
+	ctx := context.Background()
+
+	buf.Reset()
+	_, err = c.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: big.NewInt(65_000_000),
+		ToBlock:   big.NewInt(65_000_099),
+		Addresses: []common.Address{{1}, {2}},
+		Topics:    [][]common.Hash{{{3}}},
+	})
+	require.NoError(t, err)
+	_, err = c.GetLatestBlockNumber(ctx)
+	require.Error(t, err, "eth_blockNumber not served by the stub")
+
+	require.NotContains(t, buf.String(), "0123456789abcdef")
+	require.NotContains(t, buf.String(), "secret")
+	lines := debugLines(t, &buf)
+	require.Len(t, lines, 2)
+
+	logs := lines[0]
+	require.Equal(t, "debug", logs["level"])
+	require.Equal(t, []any{"eth_getLogs"}, logs["methods"])
+	require.Equal(t, "blocks=65000000..65000099 addresses=2 topics=1", logs["params"])
+	require.Equal(t, stub.server.URL+"/v2/REDACTED?apikey=REDACTED", logs["endpoint"])
+	require.Equal(t, float64(http.StatusOK), logs["status"])
+	require.Greater(t, logs["response_bytes"], float64(0))
+	require.Contains(t, logs, "duration")
+
+	blockNumber := lines[1]
+	require.Equal(t, []any{"eth_blockNumber"}, blockNumber["methods"])
+	require.Equal(t, float64(1), blockNumber["failed"])
+	require.Contains(t, blockNumber["rpc_error"], "does not exist")
+}
+
+// TestDebugLoggingSampled tests that only the sampled requests are logged,
+// and none when the logger is above debug level.
+func TestDebugLoggingSampled(t *testing.T) {
+	stub := newRPCStub(t)
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).Level(zerolog.DebugLevel)
+	samples := []float64{0.7, 0.3}
+	transport := &debugTransport{
+		next:       http.DefaultTransport,
+		logger:     &logger,
+		sampleRate: 0.5,
+		sample: func() float64 {
+			sample := samples[0]
+			samples = samples[1:]
+			return sample
+		},
+	}
+	client := &http.Client{Transport: transport}
+	post := func() {
+		resp, err := client.Post(stub.server.URL, "application/json",
+			strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0x3dfd240",false]}`))
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+
+	post()
+	require.Empty(t, buf.String(), "not sampled")
+	post()
+	lines := debugLines(t, &buf)
+	require.Len(t, lines, 1)
+	require.Equal(t, "block=65000000", lines[0]["params"])
+
+	buf.Reset()
+	logger = logger.Level(zerolog.InfoLevel)
+	samples = []float64{0}
+	post()
+	require.Empty(t, buf.String(), "debug level disabled")
+	require.Len(t, samples, 1, "not sampled when disabled")
+}
@@ -0,0 +1,419 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	rpcRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_rpc_requests_total",
+		Help: "Total number of RPC requests sent, by endpoint host",
+	}, []string{"endpoint"})
+
+	rpcErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_rpc_errors_total",
+		Help: "Total number of RPC requests that failed for the endpoint (transport errors, timeouts, rate limits), by endpoint host",
+	}, []string{"endpoint"})
+
+	rpcFailovers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_rpc_failovers_total",
+		Help: "Total number of switches of the active RPC endpoint, by the endpoint switched to",
+	}, []string{"endpoint"})
+
+	rpcActiveEndpoint = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "polymarket_rpc_active_endpoint",
+		Help: "1 for the RPC endpoint calls are sent to, 0 for the others",
+	}, []string{"endpoint"})
+)
+
+const (
+	// DefaultFailoverThreshold is the default number of consecutive failed
+	// calls after which the client fails over to the next endpoint
+	DefaultFailoverThreshold = 3
+
+	// DefaultCallTimeout is the default time an RPC call may take before it
+	// counts as a failure of its endpoint
+	DefaultCallTimeout = 30 * time.Second
+
+	// DefaultProbeInterval is the default interval at which the endpoints
+	// preferred over the active one are probed to fail back
+	DefaultProbeInterval = 30 * time.Second
+)
+
+// ErrNoEndpoint is returned when every configured endpoint serves another
+// chain than the configured one.
+var ErrNoEndpoint = errors.New("no RPC endpoint serves the configured chain")
+
+// ErrChainMismatch is returned for an endpoint serving another chain.
+var ErrChainMismatch = errors.New("chain ID mismatch")
+
+// rpcBackend is the JSON-RPC client of one endpoint (implemented by
+// ethclient.Client).
+type rpcBackend interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	Client() *rpc.Client
+	Close()
+}
+
+// endpoint is a configured RPC endpoint. Its fields after client are
+// guarded by OnChainClient.mu.
+type endpoint struct {
+	label  string // Host of the URL, safe to log (the path may hold an API key)
+	index  int    // Position in the configuration, labelling per-method metrics
+	client rpcBackend
+
+	verified bool  // The chain ID was checked since the endpoint became active
+	rejected error // The endpoint serves another chain and is never used
+	lagging  bool  // The endpoint was behind the best one at the last health check
+	failures int   // Consecutive failed calls
+	breaker  endpointBreaker
+}
+
+// endpointLabel returns the host of an endpoint URL, or its position when
+// it has none.
+func endpointLabel(i int, rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "endpoint-" + strconv.Itoa(i)
+}
+
+// ClientOption configures an OnChainClient.
+type ClientOption func(*OnChainClient)
+
+// WithFailover sets the number of consecutive failed calls after which the
+// client fails over to the next endpoint, the time a call may take before
+// it fails, and the interval at which preferred endpoints are probed to
+// fail back. Non-positive values keep the defaults.
+func WithFailover(threshold int, callTimeout, probeInterval time.Duration) ClientOption {
+	return func(c *OnChainClient) {
+		if threshold > 0 {
+			c.threshold = threshold
+		}
+		if callTimeout > 0 {
+			c.callTimeout = callTimeout
+		}
+		if probeInterval > 0 {
+			c.probeInterval = probeInterval
+		}
+	}
+}
+
+// endpointFailure reports whether err is a failure of the endpoint rather
+// than its answer: transport errors, timeouts, HTTP errors and rate limits
+// fail over; a missing block or receipt, or a reverted call, does not.
+func endpointFailure(err error) bool {
+	if errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.ErrorCode() {
+		case -32005, -32603: // Limit exceeded, internal error
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// call runs fn against the active endpoint, checking its chain ID first if
+// it was not checked since it became active. An endpoint serving another chain is rejected for
+// good. After threshold consecutive failures of the active endpoint (see
+// endpointFailure), or once its circuit breaker opens, the client fails
+// over to the next usable one and runs fn there, so a call fails only once
+// every endpoint was tried.
+func (c *OnChainClient) call(ctx context.Context, method string, fn func(context.Context, rpcBackend) error) error {
+	var err error
+	for range c.endpoints {
+		ep, ok := c.current()
+		if !ok {
+			return ErrNoEndpoint
+		}
+
+		err = c.attempt(ctx, ep, method, fn)
+		switch {
+		case errors.Is(err, ErrChainMismatch):
+			c.reject(ep, err)
+			continue
+		case err == nil || !endpointFailure(err):
+			c.succeeded(ep)
+			return err
+		case ctx.Err() != nil:
+			// Abandoned by the caller, not a failure of the endpoint
+			return err
+		}
+		if !c.failed(ep, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// attempt runs fn, a call of method, against one endpoint within the call
+// timeout, checking its chain ID first if it was not checked since it
+// became active.
+func (c *OnChainClient) attempt(ctx context.Context, ep *endpoint, method string, fn func(context.Context, rpcBackend) error) error {
+	callCtx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	c.mu.Lock()
+	verified := ep.verified
+	c.mu.Unlock()
+	if !verified {
+		start := time.Now()
+		err := timedOut(callCtx, ctx, c.callTimeout, c.verify(callCtx, ep))
+		if !errors.Is(err, ErrChainMismatch) {
+			observeCall(ctx, "chain_id", ep.index, start, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	rpcRequests.WithLabelValues(ep.label).Inc()
+	start := time.Now()
+	err := timedOut(callCtx, ctx, c.callTimeout, fn(callCtx, ep.client))
+	observeCall(ctx, method, ep.index, start, err)
+	if err != nil && endpointFailure(err) {
+		rpcErrors.WithLabelValues(ep.label).Inc()
+	}
+	return err
+}
+
+// verify checks that an endpoint serves the configured chain.
+func (c *OnChainClient) verify(ctx context.Context, ep *endpoint) error {
+	rpcRequests.WithLabelValues(ep.label).Inc()
+	chainID, err := ep.client.ChainID(ctx)
+	if err != nil {
+		rpcErrors.WithLabelValues(ep.label).Inc()
+		return fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	if chainID.Cmp(c.chainID) != 0 {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChainMismatch, c.chainID, chainID)
+	}
+
+	c.mu.Lock()
+	ep.verified = true
+	c.mu.Unlock()
+	return nil
+}
+
+// start makes the first endpoint, in configuration order, that serves the
+// chain the active one, so the client starts on a backup when the primary
+// is down. It fails when none does.
+func (c *OnChainClient) start(ctx context.Context) error {
+	var errs []error
+	for i, ep := range c.endpoints {
+		verifyCtx, cancel := context.WithTimeout(ctx, c.callTimeout)
+		began := time.Now()
+		err := c.verify(verifyCtx, ep)
+		cancel()
+		if !errors.Is(err, ErrChainMismatch) {
+			observeCall(ctx, "chain_id", ep.index, began, err)
+		}
+		if err == nil {
+			c.mu.Lock()
+			c.switchTo(i, errors.Join(errs...))
+			ep.verified = true
+			c.mu.Unlock()
+			return nil
+		}
+		if errors.Is(err, ErrChainMismatch) {
+			c.reject(ep, err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", ep.label, err))
+	}
+	return errors.Join(errs...)
+}
+
+// current returns the active endpoint, or false when every endpoint was
+// rejected.
+func (c *OnChainClient) current() (*endpoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ep := c.endpoints[c.active]
+	return ep, ep.rejected == nil
+}
+
+// succeeded resets the consecutive failures of an endpoint and closes its
+// circuit breaker if it was half-open.
+func (c *OnChainClient) succeeded(ep *endpoint) {
+	c.mu.Lock()
+	ep.failures = 0
+	c.breakerSuccess(ep)
+	c.mu.Unlock()
+}
+
+// failed records a failed call and fails over once the endpoint reached the
+// threshold or its circuit breaker opened, reporting whether it did.
+func (c *OnChainClient) failed(ep *endpoint, err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ep.failures++
+	open := c.breakerFailure(ep, err)
+	if (ep.failures < c.threshold && !open) || c.endpoints[c.active] != ep {
+		return false
+	}
+	ep.failures = 0
+	return c.switchTo(c.next(), err)
+}
+
+// reject stops using an endpoint serving another chain and fails over.
+func (c *OnChainClient) reject(ep *endpoint, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ep.rejected != nil {
+		return
+	}
+	ep.rejected = err
+	rpcEndpointMismatches.WithLabelValues(ep.label, "chain_id").Inc()
+	c.logger.Error().
+		Err(err).
+		Str("endpoint", ep.label).
+		Msg("RPC endpoint serves another chain, not using it")
+	if c.endpoints[c.active] == ep {
+		c.switchTo(c.next(), err)
+	}
+}
+
+// next returns the position of the first usable endpoint after the active
+// one, wrapping around. When the circuit breakers of all the others are
+// open, it returns the least recently failed endpoint serving the chain
+// rather than none, or the active one if there is none. The caller holds
+// c.mu.
+func (c *OnChainClient) next() int {
+	for i := 1; i < len(c.endpoints); i++ {
+		candidate := (c.active + i) % len(c.endpoints)
+		if c.usable(c.endpoints[candidate]) {
+			return candidate
+		}
+	}
+
+	next := c.active
+	for i, ep := range c.endpoints {
+		if ep.rejected != nil || ep.lagging {
+			continue
+		}
+		if current := c.endpoints[next]; current.rejected != nil || current.lagging ||
+			ep.breaker.lastFailure.Before(current.breaker.lastFailure) {
+			next = i
+		}
+	}
+	return next
+}
+
+// usable reports whether failovers and fail-backs may switch to the
+// endpoint: it serves the chain, is not lagging and its circuit breaker is
+// not open. The caller holds c.mu.
+func (c *OnChainClient) usable(ep *endpoint) bool {
+	return ep.rejected == nil && !ep.lagging && c.breakerAllows(ep)
+}
+
+// switchTo makes the endpoint at position i the active one, reporting
+// whether it changed. Its chain ID is checked again on its next call, so a
+// failover never mixes in another network's data. The caller holds c.mu.
+func (c *OnChainClient) switchTo(i int, cause error) bool {
+	if i == c.active {
+		return false
+	}
+	from, to := c.endpoints[c.active], c.endpoints[i]
+	c.active = i
+	to.verified = false
+	rpcActiveEndpoint.WithLabelValues(from.label).Set(0)
+	rpcActiveEndpoint.WithLabelValues(to.label).Set(1)
+	rpcFailovers.WithLabelValues(to.label).Inc()
+	c.logger.Warn().
+		Err(cause).
+		Str("from", from.label).
+		Str("to", to.label).
+		Msg("switched RPC endpoint")
+	return true
+}
+
+// runProbes probes the endpoints preferred over the active one every probe
+// interval, and checks the health of every endpoint every health check
+// interval, until ctx is done.
+func (c *OnChainClient) runProbes(ctx context.Context) {
+	ticker := time.NewTicker(c.probeInterval)
+	defer ticker.Stop()
+	health := time.NewTicker(c.healthInterval)
+	defer health.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.probe(ctx)
+		case <-health.C:
+			c.checkHealth(ctx)
+		}
+	}
+}
+
+// probe fails back to the first endpoint, in configuration order, preceding
+// the active one that serves the chain, is not lagging or quarantined by
+// its circuit breaker, and answers a block number request.
+func (c *OnChainClient) probe(ctx context.Context) {
+	c.mu.Lock()
+	active := c.active
+	c.mu.Unlock()
+
+	for i := range active {
+		ep := c.endpoints[i]
+		c.mu.Lock()
+		usable := c.usable(ep)
+		c.mu.Unlock()
+		if !usable {
+			continue
+		}
+
+		err := c.attempt(ctx, ep, "block_number", func(ctx context.Context, client rpcBackend) error {
+			_, err := client.BlockNumber(ctx)
+			return err
+		})
+		if errors.Is(err, ErrChainMismatch) {
+			c.reject(ep, err)
+			continue
+		}
+		if err != nil {
+			c.logger.Debug().Err(err).Str("endpoint", ep.label).Msg("RPC endpoint still failing")
+			if endpointFailure(err) {
+				c.mu.Lock()
+				c.breakerFailure(ep, err)
+				c.mu.Unlock()
+			}
+			continue
+		}
+
+		c.mu.Lock()
+		ep.failures = 0
+		c.breakerSuccess(ep)
+		c.switchTo(i, nil)
+		c.mu.Unlock()
+		return
+	}
+}
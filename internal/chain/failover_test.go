@@ -0,0 +1,235 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+var errConnRefused = errors.New("dial tcp: connection refused")
+
+// fakeBackend is an endpoint answering for chainID, failing every call with
+// err while it is set and taking delay to answer.
+type fakeBackend struct {
+	rpcBackend
+	mu          sync.Mutex
+	chainID     int64
+	err         error
+	delay       time.Duration
+	blockNumber uint64
+	chainIDs    int // ChainID calls
+	calls       int // Other calls
+}
+
+func (f *fakeBackend) ChainID(ctx context.Context) (*big.Int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.chainIDs++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return big.NewInt(f.chainID), nil
+}
+
+func (f *fakeBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	f.mu.Lock()
+	f.calls++
+	err, delay, number := f.err, f.delay, f.blockNumber
+	f.mu.Unlock()
+	if delay > 0 {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return number, err
+}
+
+func (f *fakeBackend) Close() {}
+
+// setErr sets the error of every further call.
+func (f *fakeBackend) setErr(err error) {
+	f.mu.Lock()
+	f.err = err
+	f.mu.Unlock()
+}
+
+// rpcError is a JSON-RPC error answered by a node, with msg as message if
+// set.
+type rpcError struct {
+	code int
+	msg  string
+}
+
+func (e rpcError) Error() string {
+	if e.msg != "" {
+		return e.msg
+	}
+	return "rpc error"
+}
+
+func (e rpcError) ErrorCode() int { return e.code }
+
+// testClient returns a client for chain 137 over backends, labelled
+// name-0, name-1... so tests do not share metrics. Calls are not retried
+// unless opts enable it.
+func testClient(t *testing.T, name string, backends []*fakeBackend, opts ...ClientOption) *OnChainClient {
+	t.Helper()
+	endpoints := make([]*endpoint, len(backends))
+	for i, b := range backends {
+		endpoints[i] = &endpoint{label: endpointLabel(i, "http://"+name+"-"+string(rune('0'+i))), client: b}
+	}
+	logger := zerolog.Nop()
+	return newClient(endpoints, 137, &logger, append([]ClientOption{WithRetry(1, 0, 0)}, opts...)...)
+}
+
+// TestEndpointLabel tests that metrics and logs name endpoints by host, so
+// API keys in the URL path are never exposed.
+func TestEndpointLabel(t *testing.T) {
+	require.Equal(t, "polygon-mainnet.g.alchemy.com", endpointLabel(0, "https://polygon-mainnet.g.alchemy.com/v2/SECRET"))
+	require.Equal(t, "endpoint-2", endpointLabel(2, "not a url"))
+}
+
+// TestFailoverAfterConsecutiveFailures tests that the client fails over
+// once the active endpoint failed threshold calls in a row, retrying the
+// failing call on the next endpoint, and that the metrics follow.
+func TestFailoverAfterConsecutiveFailures(t *testing.T) {
+	primary := &fakeBackend{chainID: 137, err: errConnRefused}
+	backup := &fakeBackend{chainID: 137, blockNumber: 65_000_000}
+	c := testClient(t, "consecutive", []*fakeBackend{primary, backup}, WithFailover(2, time.Second, time.Minute))
+	ctx := context.Background()
+
+	_, err := c.GetLatestBlockNumber(ctx)
+	require.ErrorIs(t, err, errConnRefused)
+	require.Equal(t, 0, c.active)
+
+	number, err := c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(65_000_000), number)
+	require.Equal(t, 1, c.active)
+	require.Equal(t, 1, backup.calls)
+
+	require.Equal(t, float64(2), testutil.ToFloat64(rpcErrors.WithLabelValues("consecutive-0")))
+	require.Equal(t, float64(2), testutil.ToFloat64(rpcRequests.WithLabelValues("consecutive-0")))
+	require.Equal(t, float64(2), testutil.ToFloat64(rpcRequests.WithLabelValues("consecutive-1")), "chain ID and block number")
+	require.Equal(t, float64(1), testutil.ToFloat64(rpcFailovers.WithLabelValues("consecutive-1")))
+	require.Equal(t, float64(0), testutil.ToFloat64(rpcActiveEndpoint.WithLabelValues("consecutive-0")))
+	require.Equal(t, float64(1), testutil.ToFloat64(rpcActiveEndpoint.WithLabelValues("consecutive-1")))
+}
+
+// TestFailoverIgnoresAnswers tests that answers of the node (a missing
+// block, a reverted call) and failures interrupted by a success do not
+// fail over, while rate limits do.
+func TestFailoverIgnoresAnswers(t *testing.T) {
+	primary := &fakeBackend{chainID: 137}
+	backup := &fakeBackend{chainID: 137}
+	c := testClient(t, "answers", []*fakeBackend{primary, backup}, WithFailover(2, time.Second, time.Minute))
+	ctx := context.Background()
+
+	for _, err := range []error{ethereum.NotFound, rpcError{code: 3}, errConnRefused, nil, errConnRefused} {
+		primary.setErr(err)
+		_, callErr := c.GetLatestBlockNumber(ctx)
+		require.ErrorIs(t, callErr, err)
+		require.Equal(t, 0, c.active)
+	}
+
+	primary.setErr(rpcError{code: -32005})
+	_, err := c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, c.active)
+}
+
+// TestFailoverOnTimeout tests that calls outliving the call timeout count
+// as failures, and that calls abandoned by the caller do not.
+func TestFailoverOnTimeout(t *testing.T) {
+	primary := &fakeBackend{chainID: 137, delay: time.Second}
+	backup := &fakeBackend{chainID: 137}
+	c := testClient(t, "timeout", []*fakeBackend{primary, backup}, WithFailover(1, 10*time.Millisecond, time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.GetLatestBlockNumber(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 0, c.active)
+
+	_, err = c.GetLatestBlockNumber(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, c.active)
+}
+
+// TestFailoverRejectsOtherChains tests that every endpoint's chain ID is
+// checked on first use, and that an endpoint serving another chain is
+// skipped for good, by failovers and probes alike.
+func TestFailoverRejectsOtherChains(t *testing.T) {
+	primary := &fakeBackend{chainID: 137, err: errConnRefused}
+	mainnet := &fakeBackend{chainID: 1}
+	backup := &fakeBackend{chainID: 137}
+	c := testClient(t, "chains", []*fakeBackend{primary, mainnet, backup}, WithFailover(1, time.Second, time.Minute))
+	ctx := context.Background()
+
+	_, err := c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, c.active)
+	require.Equal(t, 1, mainnet.chainIDs)
+	require.Zero(t, mainnet.calls)
+	require.ErrorIs(t, c.endpoints[1].rejected, ErrChainMismatch)
+
+	// Failing over from the backup skips the other chain
+	backup.setErr(errConnRefused)
+	primary.setErr(nil)
+	_, err = c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, c.active)
+	require.Zero(t, mainnet.calls)
+
+	c.probe(ctx)
+	require.Equal(t, 1, mainnet.chainIDs)
+}
+
+// TestProbeFailsBack tests that the client returns to a preferred endpoint
+// once it answers again, and stays on the backup while it does not.
+func TestProbeFailsBack(t *testing.T) {
+	primary := &fakeBackend{chainID: 137, err: errConnRefused}
+	backup := &fakeBackend{chainID: 137}
+	c := testClient(t, "probe", []*fakeBackend{primary, backup}, WithFailover(1, time.Second, time.Minute))
+	ctx := context.Background()
+
+	_, err := c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, c.active)
+
+	c.probe(ctx)
+	require.Equal(t, 1, c.active)
+
+	primary.setErr(nil)
+	c.probe(ctx)
+	require.Equal(t, 0, c.active)
+	require.Equal(t, float64(1), testutil.ToFloat64(rpcActiveEndpoint.WithLabelValues("probe-0")))
+	require.Equal(t, float64(0), testutil.ToFloat64(rpcActiveEndpoint.WithLabelValues("probe-1")))
+}
+
+// TestStart tests that the client starts on the first endpoint serving the
+// chain, and fails when none does.
+func TestStart(t *testing.T) {
+	primary := &fakeBackend{chainID: 137, err: errConnRefused}
+	backup := &fakeBackend{chainID: 137}
+	c := testClient(t, "start", []*fakeBackend{primary, backup})
+	require.NoError(t, c.start(context.Background()))
+	require.Equal(t, 1, c.active)
+	require.True(t, c.endpoints[1].verified)
+
+	c = testClient(t, "start-mismatch", []*fakeBackend{{chainID: 1}, {chainID: 80001}})
+	err := c.start(context.Background())
+	require.ErrorIs(t, err, ErrChainMismatch)
+	_, err = c.GetLatestBlockNumber(context.Background())
+	require.ErrorIs(t, err, ErrNoEndpoint)
+}
@@ -0,0 +1,115 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	rpcEndpointMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_rpc_endpoint_mismatches_total",
+		Help: "Total number of RPC endpoints found serving another chain (chain_id) or lagging behind the best endpoint (lagging) and taken out of use, by endpoint host and reason",
+	}, []string{"endpoint", "reason"})
+
+	rpcEndpointLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "polymarket_rpc_endpoint_lag_blocks",
+		Help: "Number of blocks the RPC endpoint was behind the best endpoint at the last health check, by endpoint host",
+	}, []string{"endpoint"})
+)
+
+const (
+	// DefaultHealthCheckInterval is the default interval at which every
+	// endpoint's chain ID and latest block are checked
+	DefaultHealthCheckInterval = 5 * time.Minute
+
+	// DefaultMaxBlockLag is the default number of blocks an endpoint may be
+	// behind the best one before it is no longer used
+	DefaultMaxBlockLag = 50
+)
+
+// errLagging is the cause of a switch away from a lagging endpoint.
+var errLagging = errors.New("endpoint lagging behind")
+
+// WithHealthCheck sets the interval at which every endpoint's chain ID and
+// latest block number are checked, and the number of blocks an endpoint may
+// be behind the best one before failovers and fail-backs skip it.
+// Non-positive values keep the defaults.
+func WithHealthCheck(interval time.Duration, maxBlockLag int) ClientOption {
+	return func(c *OnChainClient) {
+		if interval > 0 {
+			c.healthInterval = interval
+		}
+		if maxBlockLag > 0 {
+			c.maxBlockLag = uint64(maxBlockLag)
+		}
+	}
+}
+
+// checkHealth checks the chain ID and latest block number of every endpoint
+// not rejected. An endpoint serving another chain is rejected for good; one
+// more than maxBlockLag blocks behind the best is skipped by failovers and
+// fail-backs until a later check finds it caught up, the client failing
+// over if it is the active one.
+func (c *OnChainClient) checkHealth(ctx context.Context) {
+	heights := make(map[*endpoint]uint64, len(c.endpoints))
+	var best uint64
+	for _, ep := range c.endpoints {
+		c.mu.Lock()
+		rejected := ep.rejected != nil
+		ep.verified = false
+		c.mu.Unlock()
+		if rejected {
+			continue
+		}
+
+		var number uint64
+		err := c.attempt(ctx, ep, "block_number", func(ctx context.Context, client rpcBackend) (err error) {
+			number, err = client.BlockNumber(ctx)
+			return err
+		})
+		if errors.Is(err, ErrChainMismatch) {
+			c.reject(ep, err)
+			continue
+		}
+		if err != nil {
+			// Failing endpoints are handled by failovers and probes
+			c.logger.Debug().Err(err).Str("endpoint", ep.label).Msg("RPC endpoint health check failed")
+			continue
+		}
+		heights[ep] = number
+		best = max(best, number)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ep, number := range heights {
+		behind := best - number
+		rpcEndpointLag.WithLabelValues(ep.label).Set(float64(behind))
+		lagging := behind > c.maxBlockLag
+		switch {
+		case lagging && !ep.lagging:
+			rpcEndpointMismatches.WithLabelValues(ep.label, "lagging").Inc()
+			c.logger.Error().
+				Str("endpoint", ep.label).
+				Uint64("block", number).
+				Uint64("best_block", best).
+				Uint64("behind", behind).
+				Msg("RPC endpoint lagging behind the others, not using it")
+		case !lagging && ep.lagging:
+			c.logger.Info().
+				Str("endpoint", ep.label).
+				Uint64("behind", behind).
+				Msg("RPC endpoint caught up, using it again")
+		}
+		ep.lagging = lagging
+	}
+
+	if active := c.endpoints[c.active]; active.lagging {
+		c.switchTo(c.next(), fmt.Errorf("%w: %d blocks", errLagging, best-heights[active]))
+	}
+}
@@ -0,0 +1,91 @@
+package chain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// setChain sets the chain ID and latest block number the backend answers.
+func (f *fakeBackend) setChain(chainID int64, blockNumber uint64) {
+	f.mu.Lock()
+	f.chainID, f.blockNumber = chainID, blockNumber
+	f.mu.Unlock()
+}
+
+// TestHealthCheckLagging tests that an endpoint lagging more than the
+// maximum behind the best is failed over from and not failed back to until
+// it catches up, and that the metrics follow.
+func TestHealthCheckLagging(t *testing.T) {
+	primary := &fakeBackend{chainID: 137, blockNumber: 65_000_000}
+	backup := &fakeBackend{chainID: 137, blockNumber: 65_000_100}
+	c := testClient(t, "lagging", []*fakeBackend{primary, backup}, WithHealthCheck(time.Minute, 50))
+	ctx := context.Background()
+
+	c.checkHealth(ctx)
+	require.Equal(t, 1, c.active)
+	require.True(t, c.endpoints[0].lagging)
+	require.Equal(t, float64(100), testutil.ToFloat64(rpcEndpointLag.WithLabelValues("lagging-0")))
+	require.Equal(t, float64(0), testutil.ToFloat64(rpcEndpointLag.WithLabelValues("lagging-1")))
+	require.Equal(t, float64(1), testutil.ToFloat64(rpcEndpointMismatches.WithLabelValues("lagging-0", "lagging")))
+
+	c.probe(ctx)
+	require.Equal(t, 1, c.active, "no fail-back to a lagging endpoint")
+
+	primary.setChain(137, 65_000_090)
+	c.checkHealth(ctx)
+	require.False(t, c.endpoints[0].lagging)
+	c.probe(ctx)
+	require.Equal(t, 0, c.active)
+	require.Equal(t, float64(1), testutil.ToFloat64(rpcEndpointMismatches.WithLabelValues("lagging-0", "lagging")))
+}
+
+// TestHealthCheckChainID tests that every endpoint's chain ID is checked
+// again by health checks, one now serving another chain being rejected.
+func TestHealthCheckChainID(t *testing.T) {
+	primary := &fakeBackend{chainID: 137, blockNumber: 65_000_000}
+	backup := &fakeBackend{chainID: 137, blockNumber: 65_000_000}
+	c := testClient(t, "recheck", []*fakeBackend{primary, backup})
+	ctx := context.Background()
+
+	c.checkHealth(ctx)
+	require.Equal(t, []int{1, 1}, []int{primary.chainIDs, backup.chainIDs})
+
+	primary.setChain(1, 20_000_000)
+	c.checkHealth(ctx)
+	require.ErrorIs(t, c.endpoints[0].rejected, ErrChainMismatch)
+	require.Equal(t, 1, c.active)
+	require.Equal(t, float64(1), testutil.ToFloat64(rpcEndpointMismatches.WithLabelValues("recheck-0", "chain_id")))
+	require.False(t, c.endpoints[1].lagging, "a rejected endpoint's height is ignored")
+}
+
+// TestFailoverRechecksChainID tests that an endpoint's chain ID is checked
+// again whenever calls switch to it.
+func TestFailoverRechecksChainID(t *testing.T) {
+	primary := &fakeBackend{chainID: 137}
+	backup := &fakeBackend{chainID: 137}
+	c := testClient(t, "failover-recheck", []*fakeBackend{primary, backup}, WithFailover(1, time.Second, time.Minute))
+	ctx := context.Background()
+	require.NoError(t, c.start(ctx))
+
+	_, err := c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, primary.chainIDs, "checked once by start")
+
+	primary.setErr(errConnRefused)
+	_, err = c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, c.active)
+
+	primary.setErr(nil)
+	c.probe(ctx)
+	require.Equal(t, 0, c.active)
+	primary.setChain(1, 0)
+	_, err = c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	require.ErrorIs(t, c.endpoints[0].rejected, ErrChainMismatch)
+	require.Equal(t, 1, c.active)
+}
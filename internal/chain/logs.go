@@ -0,0 +1,99 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/rpcerr"
+)
+
+var logRangeSplits = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "polymarket_rpc_log_range_splits_total",
+	Help: "Total number of eth_getLogs queries split in two after the provider rejected their range as too large",
+})
+
+// WithLogRangeErrors adds substrings, matched case-insensitively, of the
+// errors a provider answers for eth_getLogs queries it finds too large, on
+// top of the known ones (see rpcerr.IsRangeTooLarge).
+func WithLogRangeErrors(patterns ...string) ClientOption {
+	return func(c *OnChainClient) {
+		c.logRangeErrors = append(c.logRangeErrors, patterns...)
+	}
+}
+
+// rangeTooLarge is the error of an eth_getLogs query whose range the
+// provider rejected. Being an answer of the node, it is neither retried
+// nor counted as a failure of the endpoint.
+type rangeTooLarge struct{ err error }
+
+func (e rangeTooLarge) Error() string  { return e.err.Error() }
+func (e rangeTooLarge) Unwrap() error  { return e.err }
+func (e rangeTooLarge) ErrorCode() int { return -32602 }
+
+// FilterLogs queries for logs matching the given filter. A query the
+// provider rejects as too large (too many blocks or logs) is split in two
+// halves of its block range, recursively, and the logs of the halves are
+// returned in order.
+func (c *OnChainClient) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	logs, err := c.filterLogs(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter logs: %w", err)
+	}
+	return logs, nil
+}
+
+// filterLogs runs query, bisecting its block range while the provider
+// rejects it as too large. Ranges that cannot be split (a single block, a
+// block hash, or a bound given as a tag like "latest") fail.
+func (c *OnChainClient) filterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	err := c.retry(ctx, "filter_logs", func(ctx context.Context, client rpcBackend) (err error) {
+		logs, err = client.FilterLogs(ctx, query)
+		if rpcerr.IsRangeTooLarge(err, c.logRangeErrors...) {
+			return rangeTooLarge{err}
+		}
+		return err
+	})
+	if !errors.As(err, new(rangeTooLarge)) {
+		return logs, err
+	}
+
+	if query.BlockHash != nil || query.FromBlock == nil || query.ToBlock == nil ||
+		query.FromBlock.Sign() < 0 || query.ToBlock.Sign() < 0 {
+		return nil, err
+	}
+	from, to := query.FromBlock.Uint64(), query.ToBlock.Uint64()
+	if from >= to {
+		return nil, fmt.Errorf("block %d: %w", from, err)
+	}
+
+	mid := from + (to-from)/2
+	logRangeSplits.Inc()
+	c.logger.Debug().
+		Err(err).
+		Uint64("from", from).
+		Uint64("to", to).
+		Uint64("mid", mid).
+		Msg("log query range too large, splitting")
+
+	lower, upper := query, query
+	lower.ToBlock = new(big.Int).SetUint64(mid)
+	upper.FromBlock = new(big.Int).SetUint64(mid + 1)
+
+	logs, err = c.filterLogs(ctx, lower)
+	if err != nil {
+		return nil, err
+	}
+	upperLogs, err := c.filterLogs(ctx, upper)
+	if err != nil {
+		return nil, err
+	}
+	return append(logs, upperLogs...), nil
+}
@@ -0,0 +1,122 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// serveRangeLimitedLogs answers eth_getLogs with one log per block, failing
+// with tooLarge queries spanning more than limit blocks. It returns the
+// ranges queried.
+func serveRangeLimitedLogs(t *testing.T, s *rpcStub, limit uint64, tooLarge *stubError) *[][2]uint64 {
+	var ranges [][2]uint64
+	s.handle("eth_getLogs", func(params []json.RawMessage) (any, *stubError) {
+		var filter struct {
+			FromBlock hexutil.Uint64 `json:"fromBlock"`
+			ToBlock   hexutil.Uint64 `json:"toBlock"`
+		}
+		require.NoError(t, json.Unmarshal(params[0], &filter))
+		from, to := uint64(filter.FromBlock), uint64(filter.ToBlock)
+		ranges = append(ranges, [2]uint64{from, to})
+		if to-from+1 > limit {
+			return nil, tooLarge
+		}
+		logs := []types.Log{}
+		for number := from; number <= to; number++ {
+			logs = append(logs, types.Log{
+				Address:     common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E"),
+				Topics:      []common.Hash{common.BigToHash(new(big.Int).SetUint64(number))},
+				Data:        []byte{},
+				BlockNumber: number,
+				TxHash:      common.BigToHash(new(big.Int).SetUint64(number)),
+				BlockHash:   common.BigToHash(new(big.Int).SetUint64(number + 1)),
+			})
+		}
+		return logs, nil
+	})
+	return &ranges
+}
+
+// rangeQuery returns a query of the logs of blocks from to to.
+func rangeQuery(from, to uint64) ethereum.FilterQuery {
+	return ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: []common.Address{common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")},
+	}
+}
+
+// TestFilterLogsSplitsRange tests that queries rejected by the provider as
+// too large, whatever its wording, are bisected until each range fits, and
+// that the logs come back in block order.
+func TestFilterLogsSplitsRange(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		tooLarge *stubError
+		opts     []ClientOption
+	}{
+		{"results", &stubError{Code: -32005, Message: "query returned more than 10000 results"}, nil},
+		{"span", &stubError{Code: -32000, Message: "block range too large"}, nil},
+		{"maximum", &stubError{Code: -32600, Message: "exceed maximum block range: 10"}, nil},
+		{"configured", &stubError{Code: -32000, Message: "Range Cap Hit"}, []ClientOption{WithLogRangeErrors("range cap hit")}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newRPCStub(t)
+			ranges := serveRangeLimitedLogs(t, stub, 10, tt.tooLarge)
+			c := stubClient(t, stub, tt.opts...)
+			splits := testutil.ToFloat64(logRangeSplits)
+
+			logs, err := c.FilterLogs(context.Background(), rangeQuery(65_000_000, 65_000_099))
+			require.NoError(t, err)
+			require.Len(t, logs, 100)
+			for i, log := range logs {
+				require.Equal(t, uint64(65_000_000+i), log.BlockNumber)
+			}
+
+			rejected := 0
+			queried := make(map[[2]uint64]bool)
+			for _, r := range *ranges {
+				require.False(t, queried[r], "rejected ranges are not retried")
+				queried[r] = true
+				if r[1]-r[0]+1 > 10 {
+					rejected++
+				}
+			}
+			require.Equal(t, float64(rejected), testutil.ToFloat64(logRangeSplits)-splits)
+			require.Equal(t, float64(0), testutil.ToFloat64(rpcErrors.WithLabelValues(endpointLabel(0, stub.server.URL))),
+				"rejected ranges are no failures of the endpoint")
+		})
+	}
+}
+
+// TestFilterLogsRangeErrors tests that other errors are not split and that
+// a single block too large for the provider fails.
+func TestFilterLogsRangeErrors(t *testing.T) {
+	stub := newRPCStub(t)
+	ranges := serveRangeLimitedLogs(t, stub, 0, &stubError{Code: -32005, Message: "query returned more than 10000 results"})
+	c := stubClient(t, stub)
+
+	_, err := c.FilterLogs(context.Background(), rangeQuery(65_000_000, 65_000_003))
+	require.ErrorContains(t, err, "block 65000000: query returned more than 10000 results")
+	require.Equal(t, [][2]uint64{
+		{65_000_000, 65_000_003},
+		{65_000_000, 65_000_001},
+		{65_000_000, 65_000_000},
+	}, *ranges)
+
+	stub = newRPCStub(t)
+	ranges = serveRangeLimitedLogs(t, stub, 1, &stubError{Code: -32602, Message: "invalid argument 0"})
+	c = stubClient(t, stub)
+	_, err = c.FilterLogs(context.Background(), rangeQuery(65_000_000, 65_000_003))
+	require.ErrorContains(t, err, "invalid argument 0")
+	require.Len(t, *ranges, 1)
+}
@@ -0,0 +1,63 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/rpcerr"
+)
+
+// The per-method metrics label endpoints by their position in the
+// configuration ("0", "1"...), which bounds their cardinality. Methods are
+// those of the client: block_number, block_by_number, header_by_number,
+// header_by_hash, block_by_hash, receipt, transaction, filter_logs, code,
+// call, block_receipts, headers_batch, receipts_batch and chain_id.
+var (
+	rpcCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_rpc_calls_total",
+		Help: "Total number of RPC calls sent, each attempt counted, by client method and endpoint position",
+	}, []string{"method", "endpoint"})
+
+	rpcCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "polymarket_rpc_call_duration_seconds",
+		Help:    "Duration of RPC calls, each attempt measured, by client method and endpoint position",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "endpoint"})
+
+	rpcCallErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_rpc_call_errors_total",
+		Help: "Total number of failed RPC calls, by client method, endpoint position and error class (timeout, rate_limited, other)",
+	}, []string{"method", "endpoint", "class"})
+)
+
+// errorClass returns the coarse class of a failed call for metrics:
+// timeout, rate_limited or other.
+func errorClass(err error) string {
+	switch {
+	case rpcerr.IsTimeout(err):
+		return "timeout"
+	case rpcerr.IsRateLimited(err):
+		return "rate_limited"
+	}
+	return "other"
+}
+
+// observeCall records an attempt of method against the endpoint at
+// position index, started at start. A missing block or receipt is an
+// answer rather than an error, and a call abandoned by its caller (ctx
+// done) is no error of the call.
+func observeCall(ctx context.Context, method string, index int, start time.Time, err error) {
+	endpoint := strconv.Itoa(index)
+	rpcCalls.WithLabelValues(method, endpoint).Inc()
+	rpcCallDuration.WithLabelValues(method, endpoint).Observe(time.Since(start).Seconds())
+	if err == nil || errors.Is(err, ethereum.NotFound) || ctx.Err() != nil {
+		return
+	}
+	rpcCallErrors.WithLabelValues(method, endpoint, errorClass(err)).Inc()
+}
@@ -0,0 +1,86 @@
+package chain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+// callSnapshot is the per-method metrics of block_number calls to the
+// first endpoint.
+type callSnapshot struct {
+	calls, observed               uint64
+	timeouts, rateLimited, others float64
+	chainIDCalls                  float64
+}
+
+func snapshotCalls(t *testing.T) callSnapshot {
+	t.Helper()
+	m := &dto.Metric{}
+	require.NoError(t, rpcCallDuration.WithLabelValues("block_number", "0").(prometheus.Histogram).Write(m))
+	return callSnapshot{
+		calls:        uint64(testutil.ToFloat64(rpcCalls.WithLabelValues("block_number", "0"))),
+		observed:     m.GetHistogram().GetSampleCount(),
+		timeouts:     testutil.ToFloat64(rpcCallErrors.WithLabelValues("block_number", "0", "timeout")),
+		rateLimited:  testutil.ToFloat64(rpcCallErrors.WithLabelValues("block_number", "0", "rate_limited")),
+		others:       testutil.ToFloat64(rpcCallErrors.WithLabelValues("block_number", "0", "other")),
+		chainIDCalls: testutil.ToFloat64(rpcCalls.WithLabelValues("chain_id", "0")),
+	}
+}
+
+// TestCallMetrics tests that every call is counted and timed by method and
+// endpoint position, that its errors are classed, and that missing blocks
+// and calls abandoned by the caller are no errors.
+func TestCallMetrics(t *testing.T) {
+	backend := &fakeBackend{chainID: 137, blockNumber: 65_000_000}
+	c := testClient(t, "calls", []*fakeBackend{backend}, WithFailover(100, 10*time.Millisecond, time.Minute))
+	ctx := context.Background()
+	before := snapshotCalls(t)
+
+	_, err := c.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	for _, err := range []error{errConnRefused, rpcError{code: -32005}, ethereum.NotFound} {
+		backend.setErr(err)
+		_, callErr := c.GetLatestBlockNumber(ctx)
+		require.ErrorIs(t, callErr, err)
+	}
+
+	backend.setErr(nil)
+	backend.mu.Lock()
+	backend.delay = time.Second
+	backend.mu.Unlock()
+	_, err = c.GetLatestBlockNumber(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.GetLatestBlockNumber(canceled)
+	require.ErrorIs(t, err, context.Canceled)
+
+	after := snapshotCalls(t)
+	require.Equal(t, uint64(6), after.calls-before.calls)
+	require.Equal(t, uint64(6), after.observed-before.observed)
+	require.Equal(t, float64(1), after.timeouts-before.timeouts)
+	require.Equal(t, float64(1), after.rateLimited-before.rateLimited)
+	require.Equal(t, float64(1), after.others-before.others, "missing blocks and canceled calls are no errors")
+	require.Equal(t, float64(1), after.chainIDCalls-before.chainIDCalls, "the chain ID is checked once")
+}
+
+// TestCallMetricsEndpointPosition tests that calls failed over are counted
+// for the endpoint they were sent to.
+func TestCallMetricsEndpointPosition(t *testing.T) {
+	primary := &fakeBackend{chainID: 137, err: errConnRefused}
+	backup := &fakeBackend{chainID: 137}
+	c := testClient(t, "positions", []*fakeBackend{primary, backup}, WithFailover(1, time.Second, time.Minute))
+	backupCalls := testutil.ToFloat64(rpcCalls.WithLabelValues("block_number", "1"))
+
+	_, err := c.GetLatestBlockNumber(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, backupCalls+1, testutil.ToFloat64(rpcCalls.WithLabelValues("block_number", "1")))
+}
@@ -5,78 +5,215 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/rs/zerolog"
 )
 
 // OnChainClient provides methods to interact with the Ethereum/Polygon blockchain.
+//
+// It holds every configured RPC endpoint and sends each call to the active
+// one, the first in configuration order to start with. After
+// threshold consecutive failed calls (transport errors, timeouts, rate
+// limits) it fails over to the next endpoint and retries the call there;
+// endpoints preferred over the active one are probed every probe interval
+// to fail back. An endpoint's chain ID is checked on first use and after
+// every failover to it, and one serving another chain is never used. Every
+// health check interval, each endpoint's chain ID is checked again and its
+// latest block compared with the others': failovers skip an endpoint lagging
+// more than maxBlockLag blocks behind the best until it catches up. A
+// circuit breaker per endpoint quarantines one failing breakerFailures
+// calls within breakerWindow for breakerCooldown, so a flapping endpoint is
+// not failed back to at every probe; when every endpoint is quarantined,
+// the least recently failed one is used.
+//
+// Read calls failing with a transient error are retried with jittered
+// exponential backoff up to the configured number of attempts, so callers
+// only see errors that outlast a blip. A read call is bounded by the RPC
+// timeout, retries included, unless the caller's context has an earlier
+// deadline; calls timing out in the client fail with ErrTimeout.
+//
+// Connections to the endpoints, HTTP and WebSocket, share the configured
+// transport: connection pool, proxy, TLS settings and request headers.
+// Debug logging, when enabled, logs a sample of the HTTP requests without
+// their payloads or the API keys of the endpoint URLs.
+//
+// The headers of the blocks fetched are kept in an LRU cache, so a header
+// the processor fetched is not fetched again for the syncer's checkpoint.
+// Callers handling a reorg drop the headers above the fork point with
+// InvalidateHeadersAbove.
 type OnChainClient struct {
-	rpcClient *ethclient.Client
-	wsClient  *ethclient.Client
+	endpoints []*endpoint
+	wsURL     string // WebSocket endpoint of head subscriptions, if any
 	chainID   *big.Int
 	logger    *zerolog.Logger
+
+	transport       Transport
+	dialOptions     []rpc.ClientOption // Dial options of every endpoint, built from transport
+	debugSampleRate float64            // Fraction of HTTP requests logged at debug level, 0 when disabled
+
+	threshold     int
+	callTimeout   time.Duration
+	probeInterval time.Duration
+
+	healthInterval time.Duration
+	maxBlockLag    uint64
+
+	breakerFailures int
+	breakerWindow   time.Duration
+	breakerCooldown time.Duration
+	now             func() time.Time // Clock of the circuit breakers
+
+	retryAttempts   int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	rpcTimeout      time.Duration
+
+	receiptWorkers  int
+	batchSize       int
+	noBlockReceipts map[rpcBackend]bool // Endpoints not serving eth_getBlockReceipts, guarded by mu
+
+	blockTime      time.Duration // Expected time between blocks, bounding head subscription silence
+	logRangeErrors []string      // Extra messages of eth_getLogs queries too large for the provider
+	headers        *headerCache  // Nil when disabled
+
+	mu     sync.Mutex
+	active int // Position of the endpoint calls are sent to
+
+	stopProbes context.CancelFunc
+	probesDone chan struct{}
 }
 
-// NewClient creates a new blockchain client with both HTTP and WebSocket connections.
-func NewClient(rpcURL, wsURL string, chainID int64, logger *zerolog.Logger) (*OnChainClient, error) {
-	// Connect to HTTP RPC endpoint
-	rpcClient, err := ethclient.Dial(rpcURL)
+// NewClient creates a new blockchain client over the HTTP RPC endpoints,
+// in order of preference, and an optional WebSocket endpoint for head
+// subscriptions, dialed by each subscription. It fails unless one of the
+// endpoints answers for chainID.
+func NewClient(rpcURLs []string, wsURL string, chainID int64, logger *zerolog.Logger, opts ...ClientOption) (*OnChainClient, error) {
+	if len(rpcURLs) == 0 {
+		return nil, fmt.Errorf("no RPC endpoint configured")
+	}
+	c := newClient(nil, chainID, logger, opts...)
+	c.wsURL = wsURL
+	dialOptions, err := c.transport.dialOptions(c.debugRoundTripper)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RPC endpoint: %w", err)
+		return nil, fmt.Errorf("invalid RPC transport: %w", err)
 	}
+	c.dialOptions = dialOptions
 
-	// Connect to WebSocket endpoint (optional, for real-time subscriptions)
-	var wsClient *ethclient.Client
-	if wsURL != "" {
-		wsClient, err = ethclient.Dial(wsURL)
+	// Connect to HTTP RPC endpoints; HTTP connections are opened on first use
+	endpoints := make([]*endpoint, 0, len(rpcURLs))
+	for i, rpcURL := range rpcURLs {
+		rpcClient, err := rpc.DialOptions(context.Background(), rpcURL, c.dialOptions...)
 		if err != nil {
-			logger.Warn().
-				Err(err).
-				Str("ws_url", wsURL).
-				Msg("failed to connect to WebSocket endpoint, will use HTTP only")
+			for _, ep := range endpoints {
+				ep.client.Close()
+			}
+			return nil, fmt.Errorf("failed to connect to RPC endpoint %s: %w", endpointLabel(i, rpcURL), err)
 		}
+		endpoints = append(endpoints, &endpoint{label: endpointLabel(i, rpcURL), client: ethclient.NewClient(rpcClient)})
 	}
+	c.setEndpoints(endpoints)
 
-	// Verify chain ID
-	actualChainID, err := rpcClient.ChainID(context.Background())
-	if err != nil {
-		rpcClient.Close()
-		if wsClient != nil {
-			wsClient.Close()
-		}
-		return nil, fmt.Errorf("failed to get chain ID: %w", err)
+	// Verify chain ID, failing over past endpoints that are down or serve
+	// another chain
+	if err := c.start(context.Background()); err != nil {
+		c.closeEndpoints()
+		return nil, fmt.Errorf("failed to verify chain ID: %w", err)
 	}
 
-	expectedChainID := big.NewInt(chainID)
-	if actualChainID.Cmp(expectedChainID) != 0 {
-		rpcClient.Close()
-		if wsClient != nil {
-			wsClient.Close()
-		}
-		return nil, fmt.Errorf("chain ID mismatch: expected %d, got %d", chainID, actualChainID)
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stopProbes = cancel
+	c.probesDone = make(chan struct{})
+	go func() {
+		defer close(c.probesDone)
+		c.runProbes(ctx)
+	}()
 
+	labels := make([]string, len(c.endpoints))
+	for i, ep := range c.endpoints {
+		labels[i] = ep.label
+	}
 	logger.Info().
 		Int64("chain_id", chainID).
-		Str("rpc_url", rpcURL).
-		Bool("has_websocket", wsClient != nil).
+		Strs("rpc_endpoints", labels).
+		Str("active", c.endpoints[c.active].label).
+		Int("failover_threshold", c.threshold).
+		Dur("call_timeout", c.callTimeout).
+		Dur("probe_interval", c.probeInterval).
+		Dur("health_check_interval", c.healthInterval).
+		Uint64("max_block_lag", c.maxBlockLag).
+		Int("breaker_failures", c.breakerFailures).
+		Dur("breaker_window", c.breakerWindow).
+		Dur("breaker_cooldown", c.breakerCooldown).
+		Int("retry_attempts", c.retryAttempts).
+		Dur("rpc_timeout", c.rpcTimeout).
+		Bool("has_websocket", c.wsURL != "").
 		Msg("blockchain client initialized")
 
-	return &OnChainClient{
-		rpcClient: rpcClient,
-		wsClient:  wsClient,
-		chainID:   expectedChainID,
-		logger:    logger,
-	}, nil
+	return c, nil
+}
+
+// newClient creates a client over connected endpoints, if any yet, the
+// first one active.
+func newClient(endpoints []*endpoint, chainID int64, logger *zerolog.Logger, opts ...ClientOption) *OnChainClient {
+	c := &OnChainClient{
+		chainID:         big.NewInt(chainID),
+		logger:          logger,
+		threshold:       DefaultFailoverThreshold,
+		callTimeout:     DefaultCallTimeout,
+		probeInterval:   DefaultProbeInterval,
+		healthInterval:  DefaultHealthCheckInterval,
+		maxBlockLag:     DefaultMaxBlockLag,
+		breakerFailures: DefaultBreakerFailures,
+		breakerWindow:   DefaultBreakerWindow,
+		breakerCooldown: DefaultBreakerCooldown,
+		now:             time.Now,
+		retryAttempts:   DefaultRetryAttempts,
+		retryBackoff:    DefaultRetryBackoff,
+		maxRetryBackoff: DefaultMaxRetryBackoff,
+		rpcTimeout:      DefaultRPCTimeout,
+		receiptWorkers:  DefaultReceiptWorkers,
+		batchSize:       DefaultBatchSize,
+		noBlockReceipts: make(map[rpcBackend]bool),
+		blockTime:       DefaultBlockTime,
+		headers:         newHeaderCache(DefaultHeaderCacheSize),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.setEndpoints(endpoints)
+	return c
+}
+
+// setEndpoints sets the endpoints of the client, the first one active.
+func (c *OnChainClient) setEndpoints(endpoints []*endpoint) {
+	c.endpoints = endpoints
+	for i, ep := range endpoints {
+		ep.index = i
+		value := 0.0
+		if i == c.active {
+			value = 1
+		}
+		rpcActiveEndpoint.WithLabelValues(ep.label).Set(value)
+		rpcEndpointState.WithLabelValues(strconv.Itoa(i)).Set(float64(ep.breaker.state))
+	}
 }
 
 // GetLatestBlockNumber returns the latest block number from the chain.
 func (c *OnChainClient) GetLatestBlockNumber(ctx context.Context) (uint64, error) {
-	blockNumber, err := c.rpcClient.BlockNumber(ctx)
+	var blockNumber uint64
+	err := c.retry(ctx, "block_number", func(ctx context.Context, client rpcBackend) (err error) {
+		blockNumber, err = client.BlockNumber(ctx)
+		return err
+	})
 	if err != nil {
 		return 0, fmt.Errorf("failed to get latest block number: %w", err)
 	}
@@ -85,75 +222,100 @@ func (c *OnChainClient) GetLatestBlockNumber(ctx context.Context) (uint64, error
 
 // GetBlockByNumber fetches a block by its number.
 func (c *OnChainClient) GetBlockByNumber(ctx context.Context, blockNumber uint64) (*types.Block, error) {
-	block, err := c.rpcClient.BlockByNumber(ctx, big.NewInt(int64(blockNumber)))
+	var block *types.Block
+	err := c.retry(ctx, "block_by_number", func(ctx context.Context, client rpcBackend) (err error) {
+		block, err = client.BlockByNumber(ctx, big.NewInt(int64(blockNumber)))
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch block %d: %w", blockNumber, err)
 	}
+	c.headers.add(block.Header())
 	return block, nil
 }
 
+// GetHeaderByNumber fetches the header of a block by its number, from the
+// header cache when it holds it.
+func (c *OnChainClient) GetHeaderByNumber(ctx context.Context, blockNumber uint64) (*types.Header, error) {
+	if header, ok := c.headers.getByNumber(blockNumber); ok {
+		return header, nil
+	}
+	var header *types.Header
+	err := c.retry(ctx, "header_by_number", func(ctx context.Context, client rpcBackend) (err error) {
+		header, err = client.HeaderByNumber(ctx, new(big.Int).SetUint64(blockNumber))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch header %d: %w", blockNumber, err)
+	}
+	c.headers.add(header)
+	return header, nil
+}
+
 // GetBlockByHash fetches a block by its hash.
 func (c *OnChainClient) GetBlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
-	block, err := c.rpcClient.BlockByHash(ctx, hash)
+	var block *types.Block
+	err := c.retry(ctx, "block_by_hash", func(ctx context.Context, client rpcBackend) (err error) {
+		block, err = client.BlockByHash(ctx, hash)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch block by hash %s: %w", hash.Hex(), err)
 	}
+	c.headers.add(block.Header())
 	return block, nil
 }
 
 // GetTransactionReceipt fetches a transaction receipt.
 func (c *OnChainClient) GetTransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
-	receipt, err := c.rpcClient.TransactionReceipt(ctx, txHash)
+	var receipt *types.Receipt
+	err := c.retry(ctx, "receipt", func(ctx context.Context, client rpcBackend) (err error) {
+		receipt, err = client.TransactionReceipt(ctx, txHash)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch receipt for tx %s: %w", txHash.Hex(), err)
 	}
 	return receipt, nil
 }
 
-// GetBlockReceipts fetches all receipts for a given block.
-// This is more efficient than fetching receipts individually.
-func (c *OnChainClient) GetBlockReceipts(ctx context.Context, blockNumber uint64) ([]*types.Receipt, error) {
-	block, err := c.GetBlockByNumber(ctx, blockNumber)
+// GetTransactionByHash fetches a transaction by its hash.
+func (c *OnChainClient) GetTransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, error) {
+	var tx *types.Transaction
+	err := c.retry(ctx, "transaction", func(ctx context.Context, client rpcBackend) (err error) {
+		tx, _, err = client.TransactionByHash(ctx, txHash)
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to fetch tx %s: %w", txHash.Hex(), err)
 	}
-
-	receipts := make([]*types.Receipt, 0, len(block.Transactions()))
-	for _, tx := range block.Transactions() {
-		receipt, err := c.GetTransactionReceipt(ctx, tx.Hash())
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch receipt for tx %s in block %d: %w",
-				tx.Hash().Hex(), blockNumber, err)
-		}
-		receipts = append(receipts, receipt)
-	}
-
-	return receipts, nil
+	return tx, nil
 }
 
-// FilterLogs queries for logs matching the given filter.
-func (c *OnChainClient) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
-	logs, err := c.rpcClient.FilterLogs(ctx, query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to filter logs: %w", err)
-	}
-	return logs, nil
+// ContractCaller returns the HTTP client for read-only contract bindings.
+func (c *OnChainClient) ContractCaller() bind.ContractCaller {
+	return c
 }
 
-// SubscribeNewHead subscribes to new block headers via WebSocket.
-// Returns nil if WebSocket client is not available.
-func (c *OnChainClient) SubscribeNewHead(ctx context.Context) (chan *types.Header, ethereum.Subscription, error) {
-	if c.wsClient == nil {
-		return nil, nil, fmt.Errorf("websocket client not available")
-	}
-
-	headers := make(chan *types.Header)
-	sub, err := c.wsClient.SubscribeNewHead(ctx, headers)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to subscribe to new heads: %w", err)
-	}
+// CodeAt returns the code of a contract, implementing bind.ContractCaller.
+func (c *OnChainClient) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	var code []byte
+	err := c.retry(ctx, "code", func(ctx context.Context, client rpcBackend) (err error) {
+		code, err = client.CodeAt(ctx, contract, blockNumber)
+		return err
+	})
+	return code, err
+}
 
-	return headers, sub, nil
+// CallContract executes a read-only contract call, implementing
+// bind.ContractCaller.
+func (c *OnChainClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var result []byte
+	err := c.retry(ctx, "call", func(ctx context.Context, client rpcBackend) (err error) {
+		result, err = client.CallContract(ctx, call, blockNumber)
+		return err
+	})
+	return result, err
 }
 
 // ChainID returns the chain ID.
@@ -163,9 +325,17 @@ func (c *OnChainClient) ChainID() *big.Int {
 
 // Close closes the client connections.
 func (c *OnChainClient) Close() {
-	c.rpcClient.Close()
-	if c.wsClient != nil {
-		c.wsClient.Close()
+	if c.stopProbes != nil {
+		c.stopProbes()
+		<-c.probesDone
 	}
+	c.closeEndpoints()
 	c.logger.Info().Msg("blockchain client closed")
 }
+
+// closeEndpoints closes the HTTP RPC connections.
+func (c *OnChainClient) closeEndpoints() {
+	for _, ep := range c.endpoints {
+		ep.client.Close()
+	}
+}
@@ -0,0 +1,23 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Reader is the read side of the chain used by the processor and the
+// syncer, implemented by OnChainClient and, for tests, by chaintest.Chain.
+type Reader interface {
+	GetLatestBlockNumber(ctx context.Context) (uint64, error)
+	GetHeaderByNumber(ctx context.Context, blockNumber uint64) (*types.Header, error)
+	GetHeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	GetHeadersByNumbers(ctx context.Context, numbers []uint64) ([]*types.Header, error)
+	FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error)
+	SubscribeNewHead(ctx context.Context) (*HeadSubscription, error)
+	SubscribeLogs(ctx context.Context, query ethereum.FilterQuery) (*LogSubscription, error)
+}
+
+var _ Reader = (*OnChainClient)(nil)
@@ -0,0 +1,156 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/rpcerr"
+)
+
+// DefaultReceiptWorkers is the default number of receipts fetched at once
+// from endpoints not serving eth_getBlockReceipts
+const DefaultReceiptWorkers = 8
+
+// WithReceiptWorkers sets the number of receipts fetched at once, one call
+// per transaction, from endpoints not serving eth_getBlockReceipts.
+// Non-positive values keep the default.
+func WithReceiptWorkers(workers int) ClientOption {
+	return func(c *OnChainClient) {
+		if workers > 0 {
+			c.receiptWorkers = workers
+		}
+	}
+}
+
+// methodNotFound is the JSON-RPC error of a method an endpoint is known not
+// to serve. Being an answer of the node, it is neither retried nor counted
+// as a failure of the endpoint.
+type methodNotFound string
+
+func (m methodNotFound) Error() string {
+	return "the method " + string(m) + " does not exist/is not available"
+}
+
+func (m methodNotFound) ErrorCode() int { return -32601 }
+
+// errNoBlockReceipts is returned for endpoints not serving
+// eth_getBlockReceipts.
+var errNoBlockReceipts error = methodNotFound("eth_getBlockReceipts")
+
+// GetBlockReceipts fetches all receipts of a block, in transaction order,
+// with a single eth_getBlockReceipts call. An endpoint answering that it
+// does not serve the method is remembered, and the receipts are then
+// fetched one call per transaction, receiptWorkers at a time.
+func (c *OnChainClient) GetBlockReceipts(ctx context.Context, blockNumber uint64) ([]*types.Receipt, error) {
+	var receipts []*types.Receipt
+	err := c.retry(ctx, "block_receipts", func(ctx context.Context, client rpcBackend) error {
+		c.mu.Lock()
+		unsupported := c.noBlockReceipts[client]
+		c.mu.Unlock()
+		if unsupported {
+			return errNoBlockReceipts
+		}
+
+		receipts = nil
+		err := client.Client().CallContext(ctx, &receipts, "eth_getBlockReceipts", hexutil.EncodeUint64(blockNumber))
+		if rpcerr.IsMethodNotFound(err) {
+			c.blockReceiptsUnsupported(client, err)
+			return errNoBlockReceipts
+		}
+		if err == nil && receipts == nil {
+			return ethereum.NotFound
+		}
+		return err
+	})
+	if errors.Is(err, errNoBlockReceipts) {
+		return c.receiptsByTransaction(ctx, blockNumber)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch receipts of block %d: %w", blockNumber, err)
+	}
+	return receipts, nil
+}
+
+// blockReceiptsUnsupported remembers that an endpoint does not serve
+// eth_getBlockReceipts.
+func (c *OnChainClient) blockReceiptsUnsupported(client rpcBackend, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.noBlockReceipts[client] {
+		return
+	}
+	c.noBlockReceipts[client] = true
+	for _, ep := range c.endpoints {
+		if ep.client == client {
+			c.logger.Warn().
+				Err(err).
+				Str("endpoint", ep.label).
+				Int("workers", c.receiptWorkers).
+				Msg("RPC endpoint does not serve eth_getBlockReceipts, fetching receipts per transaction")
+		}
+	}
+}
+
+// receiptsByTransaction fetches the block and the receipt of each of its
+// transactions, receiptWorkers at a time, in transaction order. The first
+// failure cancels the fetches in flight.
+func (c *OnChainClient) receiptsByTransaction(ctx context.Context, blockNumber uint64) ([]*types.Receipt, error) {
+	block, err := c.GetBlockByNumber(ctx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	receipts := make([]*types.Receipt, len(txs))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indexes := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for range min(c.receiptWorkers, len(txs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				receipt, err := c.GetTransactionReceipt(ctx, txs[i].Hash())
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("failed to fetch receipt for tx %s in block %d: %w", txs[i].Hash().Hex(), blockNumber, err)
+						cancel()
+					})
+					continue
+				}
+				receipts[i] = receipt
+			}
+		}()
+	}
+
+feed:
+	for i := range txs {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch receipts of block %d: %w", blockNumber, err)
+	}
+	return receipts, nil
+}
@@ -0,0 +1,129 @@
+package chain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+// requireFixtureReceipts checks that receipts are those of the fixture, in
+// transaction order.
+func requireFixtureReceipts(t *testing.T, f *fixtureBlock, receipts []*types.Receipt) {
+	t.Helper()
+	require.Len(t, receipts, len(f.receipts))
+	for i, receipt := range receipts {
+		require.Equal(t, f.receipts[i].TxHash, receipt.TxHash)
+		require.Equal(t, uint(i), receipt.TransactionIndex)
+		require.Equal(t, f.header.Hash(), receipt.BlockHash)
+		require.Len(t, receipt.Logs, 1)
+	}
+}
+
+// TestGetBlockReceipts tests that the receipts of a block are fetched with
+// a single eth_getBlockReceipts call.
+func TestGetBlockReceipts(t *testing.T) {
+	stub := newRPCStub(t)
+	f := newFixtureBlock(t, 65_000_000, 20)
+	f.serve(stub, true)
+	c := stubClient(t, stub)
+
+	receipts, err := c.GetBlockReceipts(context.Background(), f.number)
+	require.NoError(t, err)
+	requireFixtureReceipts(t, f, receipts)
+	require.Equal(t, 1, stub.callsOf("eth_getBlockReceipts"))
+	require.Zero(t, stub.callsOf("eth_getBlockByNumber"))
+	require.Zero(t, stub.callsOf("eth_getTransactionReceipt"))
+
+	_, err = c.GetBlockReceipts(context.Background(), f.number+1)
+	require.ErrorIs(t, err, ethereum.NotFound)
+}
+
+// TestGetBlockReceiptsFallback tests that an endpoint answering that it
+// does not serve eth_getBlockReceipts is asked for it only once, its
+// receipts being fetched per transaction from then on.
+func TestGetBlockReceiptsFallback(t *testing.T) {
+	stub := newRPCStub(t)
+	f := newFixtureBlock(t, 65_000_000, 20)
+	f.serve(stub, false)
+	c := stubClient(t, stub)
+
+	for range 2 {
+		receipts, err := c.GetBlockReceipts(context.Background(), f.number)
+		require.NoError(t, err)
+		requireFixtureReceipts(t, f, receipts)
+	}
+	require.Equal(t, 1, stub.callsOf("eth_getBlockReceipts"))
+	require.Equal(t, 2, stub.callsOf("eth_getBlockByNumber"))
+	require.Equal(t, 40, stub.callsOf("eth_getTransactionReceipt"))
+}
+
+// TestGetBlockReceiptsFallbackWorkers tests that receipts fetched per
+// transaction are fetched in parallel, no more than receiptWorkers at a
+// time.
+func TestGetBlockReceiptsFallbackWorkers(t *testing.T) {
+	stub := newRPCStub(t)
+	stub.delay = 5 * time.Millisecond
+	f := newFixtureBlock(t, 65_000_000, 30)
+	f.serve(stub, false)
+	c := stubClient(t, stub, WithReceiptWorkers(3))
+
+	receipts, err := c.GetBlockReceipts(context.Background(), f.number)
+	require.NoError(t, err)
+	requireFixtureReceipts(t, f, receipts)
+	require.Greater(t, stub.peakInFlight(), 1)
+	require.LessOrEqual(t, stub.peakInFlight(), 3)
+}
+
+// TestGetBlockReceiptsFallbackFailure tests that a receipt missing from an
+// endpoint fetching them per transaction fails the block.
+func TestGetBlockReceiptsFallbackFailure(t *testing.T) {
+	stub := newRPCStub(t)
+	f := newFixtureBlock(t, 65_000_000, 10)
+	f.serve(stub, false)
+	delete(f.byHash, f.receipts[7].TxHash.Hex())
+	c := stubClient(t, stub, WithReceiptWorkers(2))
+
+	_, err := c.GetBlockReceipts(context.Background(), f.number)
+	require.ErrorIs(t, err, ethereum.NotFound)
+	require.ErrorContains(t, err, f.receipts[7].TxHash.Hex())
+}
+
+// BenchmarkGetBlockReceipts compares fetching the receipts of a synthetic
+// block of 300 transactions, the size of a busy Polygon block, with one
+// eth_getBlockReceipts call and one call per transaction, from a local
+// stub answering from the prepared fixture after a 1ms round trip (remote
+// providers take tens).
+//
+//	go test -run '^$' -bench GetBlockReceipts ./internal/chain/
+func BenchmarkGetBlockReceipts(b *testing.B) {
+	f := newFixtureBlock(b, 65_000_000, 300)
+	for _, bench := range []struct {
+		name          string
+		blockReceipts bool
+		workers       int
+	}{
+		{"eth_getBlockReceipts", true, 0},
+		{"per_transaction/sequential", false, 1},
+		{"per_transaction/workers=8", false, 8},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			stub := newRPCStub(b)
+			stub.delay = time.Millisecond
+			f.serve(stub, bench.blockReceipts)
+			c := stubClient(b, stub, WithReceiptWorkers(bench.workers))
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.GetBlockReceipts(ctx, f.number); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(stub.callsOf("eth_getTransactionReceipt")+stub.callsOf("eth_getBlockReceipts"))/float64(b.N), "calls/op")
+		})
+	}
+}
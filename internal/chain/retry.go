@@ -0,0 +1,169 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/rpcerr"
+)
+
+var rpcRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "polymarket_rpc_retries_total",
+	Help: "Total number of RPC calls retried after a transient error, by client method",
+}, []string{"method"})
+
+const (
+	// DefaultRetryAttempts is the default number of attempts of a read call,
+	// the first included
+	DefaultRetryAttempts = 3
+
+	// DefaultRetryBackoff is the default wait before the first retry, doubled
+	// for each further one
+	DefaultRetryBackoff = 500 * time.Millisecond
+
+	// DefaultMaxRetryBackoff is the default cap of the wait between retries
+	DefaultMaxRetryBackoff = 5 * time.Second
+
+	// DefaultRPCTimeout is the default time a read call may take, its
+	// retries and failovers included
+	DefaultRPCTimeout = time.Minute
+)
+
+// ErrTimeout is returned, wrapped, for a call that timed out in the
+// client: an attempt exceeding the call timeout, or a read call exceeding
+// the RPC timeout with its retries. Such errors also match
+// context.DeadlineExceeded; a deadline of the caller's own context is not
+// an ErrTimeout.
+var ErrTimeout = errors.New("RPC call timed out")
+
+// ErrHistoryUnavailable is returned, wrapped, for a call the endpoint
+// answered with an error saying it pruned the state or history needed (see
+// rpcerr.IsHistoryUnavailable): only an archive node can serve it. Such
+// calls are not retried.
+var ErrHistoryUnavailable = errors.New("historical state unavailable, the RPC endpoint is not an archive node")
+
+// timeoutError is the error of a call that timed out in the client.
+type timeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s: %v", e.timeout, e.err)
+}
+
+func (e *timeoutError) Unwrap() []error { return []error{ErrTimeout, e.err} }
+
+// timedOut wraps err with ErrTimeout when ctx, derived from parent with
+// timeout, expired while parent did not: the call timed out in the client
+// rather than being abandoned by its caller.
+func timedOut(ctx, parent context.Context, timeout time.Duration, err error) error {
+	if err == nil || errors.Is(err, ErrTimeout) || ctx.Err() != context.DeadlineExceeded || parent.Err() != nil {
+		return err
+	}
+	return &timeoutError{timeout: timeout, err: err}
+}
+
+// WithRetry sets the number of attempts of a read call failing with a
+// transient error, the first included, the wait before the first retry and
+// the cap of the wait as it doubles. Non-positive values keep the defaults;
+// one attempt disables retries.
+func WithRetry(attempts int, backoff, maxBackoff time.Duration) ClientOption {
+	return func(c *OnChainClient) {
+		if attempts > 0 {
+			c.retryAttempts = attempts
+		}
+		if backoff > 0 {
+			c.retryBackoff = backoff
+		}
+		if maxBackoff > 0 {
+			c.maxRetryBackoff = maxBackoff
+		}
+	}
+}
+
+// WithRPCTimeout sets the time a read call may take, its retries and
+// failovers included, unless the caller's context has an earlier deadline.
+// Non-positive values keep the default.
+func WithRPCTimeout(timeout time.Duration) ClientOption {
+	return func(c *OnChainClient) {
+		if timeout > 0 {
+			c.rpcTimeout = timeout
+		}
+	}
+}
+
+// retry runs the idempotent read call fn, named method, retrying it with
+// jittered exponential backoff while it fails with a transient error (see
+// rpcerr.IsRetryable) until the attempts are exhausted, the RPC timeout
+// expires or ctx is done. Each attempt goes through call, so failed
+// attempts count towards failing over. An error after retries is wrapped
+// with the number of attempts, and one for pruned state or history with
+// ErrHistoryUnavailable.
+func (c *OnChainClient) retry(ctx context.Context, method string, fn func(context.Context, rpcBackend) error) error {
+	callCtx := ctx
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > c.rpcTimeout {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, c.rpcTimeout)
+		defer cancel()
+	}
+	err := timedOut(callCtx, ctx, c.rpcTimeout, c.retryCall(callCtx, method, fn))
+	if rpcerr.IsHistoryUnavailable(err) {
+		return fmt.Errorf("%w: %w", ErrHistoryUnavailable, err)
+	}
+	return err
+}
+
+// retryCall is retry within the RPC timeout.
+func (c *OnChainClient) retryCall(ctx context.Context, method string, fn func(context.Context, rpcBackend) error) error {
+	backoff := c.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.call(ctx, method, fn)
+		if err == nil || errors.Is(err, ErrNoEndpoint) || !rpcerr.IsRetryable(err) || ctx.Err() != nil {
+			return attemptsError(attempt, err)
+		}
+		if attempt >= c.retryAttempts {
+			return attemptsError(attempt, err)
+		}
+
+		rpcRetries.WithLabelValues(method).Inc()
+		c.logger.Debug().
+			Err(err).
+			Str("method", method).
+			Int("attempt", attempt).
+			Msg("retrying RPC call")
+
+		timer := time.NewTimer(jitter(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attemptsError(attempt, err)
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, c.maxRetryBackoff)
+	}
+}
+
+// attemptsError wraps the error of a call retried at least once with the
+// number of attempts.
+func attemptsError(attempts int, err error) error {
+	if err == nil || attempts == 1 {
+		return err
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", attempts, err)
+}
+
+// jitter returns a random duration between half of d and d, so clients
+// failing together do not retry together.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d-d/2)
+}
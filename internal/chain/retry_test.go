@@ -0,0 +1,140 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyBackend is an endpoint of chain 137 whose block number and log
+// calls fail with errs in turn before answering.
+type flakyBackend struct {
+	rpcBackend
+	mu    sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (f *flakyBackend) ChainID(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(137), nil
+}
+
+func (f *flakyBackend) next() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *flakyBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	if err := f.next(); err != nil {
+		return 0, err
+	}
+	return 65_000_000, nil
+}
+
+func (f *flakyBackend) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return nil, f.next()
+}
+
+func (f *flakyBackend) Close() {}
+
+// retryClient returns a client over backend with failover out of the way.
+func retryClient(backend *flakyBackend, opts ...ClientOption) *OnChainClient {
+	logger := zerolog.Nop()
+	endpoints := []*endpoint{{label: "retry", client: backend}}
+	return newClient(endpoints, 137, &logger, append([]ClientOption{WithFailover(100, time.Second, time.Minute)}, opts...)...)
+}
+
+// TestRetryTransientErrors tests that a read call failing with transient
+// errors is retried until it succeeds, and that the retries are counted by
+// method.
+func TestRetryTransientErrors(t *testing.T) {
+	retries := testutil.ToFloat64(rpcRetries.WithLabelValues("block_number"))
+	backend := &flakyBackend{errs: []error{errConnRefused, rpcError{code: -32005}}}
+	c := retryClient(backend, WithRetry(3, time.Millisecond, time.Millisecond))
+
+	number, err := c.GetLatestBlockNumber(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(65_000_000), number)
+	require.Equal(t, 3, backend.calls)
+	require.Equal(t, retries+2, testutil.ToFloat64(rpcRetries.WithLabelValues("block_number")))
+}
+
+// TestRetryGivesUp tests that the final error of a call failing every
+// attempt is wrapped with the number of attempts.
+func TestRetryGivesUp(t *testing.T) {
+	backend := &flakyBackend{errs: []error{errConnRefused, errConnRefused, errConnRefused}}
+	c := retryClient(backend, WithRetry(2, time.Millisecond, time.Millisecond))
+
+	_, err := c.FilterLogs(context.Background(), ethereum.FilterQuery{})
+	require.ErrorIs(t, err, errConnRefused)
+	require.ErrorContains(t, err, "gave up after 2 attempts")
+	require.Equal(t, 2, backend.calls)
+}
+
+// TestRetrySkipsPermanentErrors tests that answers of the node are returned
+// at once, unwrapped.
+func TestRetrySkipsPermanentErrors(t *testing.T) {
+	reverted := rpcError{code: 3}
+	backend := &flakyBackend{errs: []error{reverted}}
+	c := retryClient(backend, WithRetry(3, time.Millisecond, time.Millisecond))
+
+	_, err := c.FilterLogs(context.Background(), ethereum.FilterQuery{})
+	require.ErrorIs(t, err, reverted)
+	require.NotContains(t, err.Error(), "gave up")
+	require.Equal(t, 1, backend.calls)
+}
+
+// TestRetryHistoryUnavailable tests that an endpoint answering that it
+// pruned the history a call needs is not retried, the error matching
+// ErrHistoryUnavailable.
+func TestRetryHistoryUnavailable(t *testing.T) {
+	pruned := rpcError{code: -32000, msg: "missing trie node 9f2c0e5a1b3d (path )"}
+	backend := &flakyBackend{errs: []error{pruned}}
+	c := retryClient(backend, WithRetry(3, time.Millisecond, time.Millisecond))
+
+	_, err := c.FilterLogs(context.Background(), ethereum.FilterQuery{})
+	require.ErrorIs(t, err, ErrHistoryUnavailable)
+	require.ErrorIs(t, err, pruned)
+	require.Equal(t, 1, backend.calls)
+}
+
+// TestRetryHonorsContext tests that a caller's context done during the
+// backoff ends the call with the last error instead of waiting it out.
+func TestRetryHonorsContext(t *testing.T) {
+	backend := &flakyBackend{errs: []error{errConnRefused, errConnRefused}}
+	c := retryClient(backend, WithRetry(3, time.Hour, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.GetLatestBlockNumber(ctx)
+	require.ErrorIs(t, err, errConnRefused)
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, 1, backend.calls)
+}
+
+// TestJitter tests that retry waits fall between half the backoff and the
+// backoff.
+func TestJitter(t *testing.T) {
+	for range 100 {
+		d := jitter(time.Second)
+		require.GreaterOrEqual(t, d, 500*time.Millisecond)
+		require.LessOrEqual(t, d, time.Second)
+	}
+	require.Zero(t, jitter(0))
+}
@@ -0,0 +1,332 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// stubError is a JSON-RPC error answered by the stub.
+type stubError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *stubError) Error() string { return e.Message }
+
+// stubRequest is a JSON-RPC request received by the stub.
+type stubRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// stubResponse is a JSON-RPC response of the stub.
+type stubResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *stubError      `json:"error,omitempty"`
+}
+
+// stubHandler answers the params of a JSON-RPC method, a nil result being
+// JSON null.
+type stubHandler func(params []json.RawMessage) (any, *stubError)
+
+// rpcStub is a JSON-RPC server over HTTP for chain 137, answering the
+// methods it has a handler for and method-not-found otherwise. It records
+// the calls of each method, the size of each batch and the most requests
+// handled at once, each taking delay.
+type rpcStub struct {
+	server *httptest.Server
+	delay  time.Duration
+
+	mu          sync.Mutex
+	handlers    map[string]stubHandler
+	calls       map[string]int
+	batches     []int
+	inFlight    int
+	maxInFlight int
+}
+
+// newRPCStub starts a stub, closed with the test.
+func newRPCStub(tb testing.TB) *rpcStub {
+	tb.Helper()
+	s := &rpcStub{
+		handlers: map[string]stubHandler{
+			"eth_chainId": func([]json.RawMessage) (any, *stubError) { return "0x89", nil },
+		},
+		calls: make(map[string]int),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	tb.Cleanup(s.server.Close)
+	return s
+}
+
+// handle sets the handler of method.
+func (s *rpcStub) handle(method string, h stubHandler) {
+	s.mu.Lock()
+	s.handlers[method] = h
+	s.mu.Unlock()
+}
+
+// callsOf returns the number of calls of method, batched or not.
+func (s *rpcStub) callsOf(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// batchSizes returns the size of each batch received.
+func (s *rpcStub) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.batches...)
+}
+
+// peakInFlight returns the most requests handled at once.
+func (s *rpcStub) peakInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxInFlight
+}
+
+func (s *rpcStub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(s.delay)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body = bytes.TrimSpace(body)
+
+	var reply any
+	if len(body) > 0 && body[0] == '[' {
+		var reqs []stubRequest
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.batches = append(s.batches, len(reqs))
+		s.mu.Unlock()
+		resps := make([]stubResponse, len(reqs))
+		for i, req := range reqs {
+			resps[i] = s.answer(req)
+		}
+		reply = resps
+	} else {
+		var req stubRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reply = s.answer(req)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(reply)
+}
+
+// answer runs the handler of a request.
+func (s *rpcStub) answer(req stubRequest) stubResponse {
+	s.mu.Lock()
+	s.calls[req.Method]++
+	h := s.handlers[req.Method]
+	s.mu.Unlock()
+
+	resp := stubResponse{JSONRPC: "2.0", ID: req.ID}
+	if h == nil {
+		resp.Error = &stubError{Code: -32601, Message: "the method " + req.Method + " does not exist/is not available"}
+		return resp
+	}
+	result, rpcErr := h(req.Params)
+	if rpcErr != nil {
+		resp.Error = rpcErr
+		return resp
+	}
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	resp.Result = result
+	return resp
+}
+
+// stubClient returns a client with the stub as its only endpoint.
+func stubClient(tb testing.TB, s *rpcStub, opts ...ClientOption) *OnChainClient {
+	tb.Helper()
+	client, err := ethclient.Dial(s.server.URL)
+	require.NoError(tb, err)
+	logger := zerolog.Nop()
+	c := newClient([]*endpoint{{label: endpointLabel(0, s.server.URL), client: client}}, 137, &logger, opts...)
+	tb.Cleanup(c.closeEndpoints)
+	return c
+}
+
+// fixtureBlock is a synthetic block of signed transactions, each emitting
+// one OrderFilled-shaped log, with the JSON-RPC answers of a node for it.
+type fixtureBlock struct {
+	number   uint64
+	header   *types.Header
+	receipts []*types.Receipt
+	block    json.RawMessage            // eth_getBlockByNumber with full transactions
+	byHash   map[string]json.RawMessage // eth_getTransactionReceipt by transaction hash
+	all      json.RawMessage            // eth_getBlockReceipts
+}
+
+// newFixtureBlock builds a synthetic block of n transactions at number.
+func newFixtureBlock(tb testing.TB, number uint64, n int) *fixtureBlock {
+	tb.Helper()
+	key, err := crypto.HexToECDSA("0000000000000000000000000000000000000000000000000000000000000001")
+	require.NoError(tb, err)
+	signer := types.LatestSignerForChainID(big.NewInt(137))
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	orderFilled := crypto.Keccak256Hash([]byte("OrderFilled(bytes32,address,address,uint256,uint256,uint256,uint256,uint256)"))
+
+	txs := make(types.Transactions, n)
+	for i := range txs {
+		tx, err := types.SignNewTx(key, signer, &types.LegacyTx{
+			Nonce:    uint64(i),
+			GasPrice: big.NewInt(30_000_000_000),
+			Gas:      200_000,
+			To:       &exchange,
+			Data:     crypto.Keccak256(big.NewInt(int64(i)).Bytes()),
+		})
+		require.NoError(tb, err)
+		txs[i] = tx
+	}
+
+	header := &types.Header{
+		ParentHash: crypto.Keccak256Hash(new(big.Int).SetUint64(number - 1).Bytes()),
+		UncleHash:  types.EmptyUncleHash,
+		Coinbase:   common.HexToAddress("0x0000000000000000000000000000000000000000"),
+		TxHash:     types.DeriveSha(txs, trie.NewStackTrie(nil)),
+		Difficulty: big.NewInt(1),
+		Number:     new(big.Int).SetUint64(number),
+		GasLimit:   30_000_000,
+		GasUsed:    uint64(n) * 120_000,
+		Time:       1_700_000_000 + number*2,
+		Extra:      []byte{},
+	}
+	f := &fixtureBlock{number: number, header: header, byHash: make(map[string]json.RawMessage, n)}
+
+	receipts := make([]*types.Receipt, n)
+	for i, tx := range txs {
+		receipt := &types.Receipt{
+			Type:              types.LegacyTxType,
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: uint64(i+1) * 120_000,
+			TxHash:            tx.Hash(),
+			GasUsed:           120_000,
+			EffectiveGasPrice: tx.GasPrice(),
+			BlockNumber:       header.Number,
+			TransactionIndex:  uint(i),
+			Logs: []*types.Log{{
+				Address:     exchange,
+				Topics:      []common.Hash{orderFilled, tx.Hash(), common.BytesToHash(from.Bytes())},
+				Data:        make([]byte, 160),
+				BlockNumber: number,
+				TxHash:      tx.Hash(),
+				TxIndex:     uint(i),
+				Index:       uint(i),
+			}},
+		}
+		receipt.Bloom = types.CreateBloom(receipt)
+		receipts[i] = receipt
+	}
+	header.ReceiptHash = types.DeriveSha(types.Receipts(receipts), trie.NewStackTrie(nil))
+	f.receipts = receipts
+
+	// Receipts name the block by the hash of its header, complete once it
+	// commits to them
+	for _, receipt := range receipts {
+		receipt.BlockHash = header.Hash()
+		receipt.Logs[0].BlockHash = header.Hash()
+		data, err := json.Marshal(receipt)
+		require.NoError(tb, err)
+		f.byHash[receipt.TxHash.Hex()] = data
+	}
+	f.all, err = json.Marshal(receipts)
+	require.NoError(tb, err)
+
+	rpcTxs := make([]map[string]any, n)
+	for i, tx := range txs {
+		data, err := json.Marshal(tx)
+		require.NoError(tb, err)
+		require.NoError(tb, json.Unmarshal(data, &rpcTxs[i]))
+		rpcTxs[i]["blockHash"] = header.Hash()
+		rpcTxs[i]["blockNumber"] = hexutil.Uint64(number)
+		rpcTxs[i]["transactionIndex"] = hexutil.Uint64(i)
+		rpcTxs[i]["from"] = from
+	}
+	var block map[string]any
+	data, err := json.Marshal(header)
+	require.NoError(tb, err)
+	require.NoError(tb, json.Unmarshal(data, &block))
+	block["transactions"] = rpcTxs
+	block["uncles"] = []common.Hash{}
+	f.block, err = json.Marshal(block)
+	require.NoError(tb, err)
+	return f
+}
+
+// serve answers the block, its receipts and those of its transactions,
+// leaving eth_getBlockReceipts unanswered unless blockReceipts is set.
+func (f *fixtureBlock) serve(s *rpcStub, blockReceipts bool) {
+	number := hexutil.EncodeUint64(f.number)
+	atNumber := func(params []json.RawMessage, answer json.RawMessage) (any, *stubError) {
+		var n string
+		if len(params) == 0 || json.Unmarshal(params[0], &n) != nil {
+			return nil, &stubError{Code: -32602, Message: "invalid argument 0"}
+		}
+		if n != number {
+			return nil, nil
+		}
+		return answer, nil
+	}
+
+	s.handle("eth_getBlockByNumber", func(params []json.RawMessage) (any, *stubError) {
+		return atNumber(params, f.block)
+	})
+	s.handle("eth_getTransactionReceipt", func(params []json.RawMessage) (any, *stubError) {
+		var hash common.Hash
+		if len(params) == 0 || json.Unmarshal(params[0], &hash) != nil {
+			return nil, &stubError{Code: -32602, Message: "invalid argument 0"}
+		}
+		if receipt, ok := f.byHash[hash.Hex()]; ok {
+			return receipt, nil
+		}
+		return nil, nil
+	})
+	if blockReceipts {
+		s.handle("eth_getBlockReceipts", func(params []json.RawMessage) (any, *stubError) {
+			return atNumber(params, f.all)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// HeaderInfo identifies a block and links it to its parent, for reorg
+// detection without fetching full blocks.
+type HeaderInfo struct {
+	Number     uint64
+	Hash       common.Hash
+	ParentHash common.Hash
+	Time       uint64 // Unix timestamp
+}
+
+// newHeaderInfo returns the HeaderInfo of header.
+func newHeaderInfo(header *types.Header) HeaderInfo {
+	return HeaderInfo{
+		Number:     header.Number.Uint64(),
+		Hash:       header.Hash(),
+		ParentHash: header.ParentHash,
+		Time:       header.Time,
+	}
+}
+
+// LinkError is returned by VerifyChainSegment for the first block whose
+// parent hash is not the hash of the block before it.
+type LinkError struct {
+	Block  HeaderInfo // The block not linked to the one before it
+	Parent HeaderInfo // The block before it, as fetched
+}
+
+func (e *LinkError) Error() string {
+	return fmt.Sprintf("block %d has parent hash %s, but block %d has hash %s",
+		e.Block.Number, e.Block.ParentHash.Hex(), e.Parent.Number, e.Parent.Hash.Hex())
+}
+
+// GetHeaderInfo returns the number, hash, parent hash and timestamp of a
+// block, from the header cache when it holds its header.
+func (c *OnChainClient) GetHeaderInfo(ctx context.Context, number uint64) (HeaderInfo, error) {
+	header, err := c.GetHeaderByNumber(ctx, number)
+	if err != nil {
+		return HeaderInfo{}, err
+	}
+	return newHeaderInfo(header), nil
+}
+
+// VerifyChainSegment checks that the blocks from from to to, included, form
+// a chain, each one's parent hash being the hash of the block before it. It
+// returns a *LinkError for the first block that is not linked, such as one
+// fetched after a reorg replaced its parent in the header cache. Headers are
+// fetched in batches, from the header cache when it holds them, until the
+// first mismatch.
+func (c *OnChainClient) VerifyChainSegment(ctx context.Context, from, to uint64) error {
+	if from > to {
+		return fmt.Errorf("invalid chain segment: from block %d after to block %d", from, to)
+	}
+
+	var parent *types.Header
+	start := from
+	for {
+		end := min(start+uint64(c.batchSize)-1, to)
+		numbers := make([]uint64, 0, end-start+1)
+		for number := start; number <= end; number++ {
+			numbers = append(numbers, number)
+		}
+		headers, err := c.GetHeadersByNumbers(ctx, numbers)
+		if err != nil {
+			return fmt.Errorf("failed to verify blocks %d-%d: %w", from, to, err)
+		}
+		for _, header := range headers {
+			if parent != nil && header.ParentHash != parent.Hash() {
+				return &LinkError{Block: newHeaderInfo(header), Parent: newHeaderInfo(parent)}
+			}
+			parent = header
+		}
+		if end == to {
+			return nil
+		}
+		start = end + 1
+	}
+}
@@ -0,0 +1,114 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+// serveLinkedHeaders answers eth_getBlockByNumber with the headers of a
+// synthetic chain of head blocks, each linked to the one before it except
+// block broken, whose parent hash is unrelated (none if broken is 0). It
+// returns the headers.
+func serveLinkedHeaders(t *testing.T, s *rpcStub, head, broken uint64) []*types.Header {
+	headers := make([]*types.Header, head)
+	for number := range head {
+		header := &types.Header{
+			UncleHash:  types.EmptyUncleHash,
+			Difficulty: big.NewInt(1),
+			Number:     new(big.Int).SetUint64(number),
+			GasLimit:   30_000_000,
+			Time:       1_700_000_000 + 2*number,
+			Extra:      []byte{},
+		}
+		switch {
+		case number == broken && broken > 0:
+			header.ParentHash = common.Hash{0xde, 0xad}
+		case number > 0:
+			header.ParentHash = headers[number-1].Hash()
+		}
+		headers[number] = header
+	}
+
+	s.handle("eth_getBlockByNumber", func(params []json.RawMessage) (any, *stubError) {
+		var number hexutil.Uint64
+		require.NoError(t, json.Unmarshal(params[0], &number))
+		if uint64(number) >= head {
+			return nil, nil
+		}
+		return headers[number], nil
+	})
+	return headers
+}
+
+// TestGetHeaderInfo tests that a block's number, hash, parent hash and
+// timestamp are returned, from the header cache once fetched.
+func TestGetHeaderInfo(t *testing.T) {
+	stub := newRPCStub(t)
+	headers := serveLinkedHeaders(t, stub, 100, 0)
+	c := stubClient(t, stub)
+	ctx := context.Background()
+
+	info, err := c.GetHeaderInfo(ctx, 42)
+	require.NoError(t, err)
+	require.Equal(t, HeaderInfo{
+		Number:     42,
+		Hash:       headers[42].Hash(),
+		ParentHash: headers[41].Hash(),
+		Time:       1_700_000_084,
+	}, info)
+
+	_, err = c.GetHeaderInfo(ctx, 42)
+	require.NoError(t, err)
+	require.Equal(t, 1, stub.callsOf("eth_getBlockByNumber"))
+
+	_, err = c.GetHeaderInfo(ctx, 100)
+	require.ErrorIs(t, err, ethereum.NotFound)
+}
+
+// TestVerifyChainSegment tests that an intact segment is verified in
+// batches, that a broken link mid-segment or at a batch boundary is
+// reported with the blocks on both sides, no later batch being fetched, and
+// that missing blocks fail the verification.
+func TestVerifyChainSegment(t *testing.T) {
+	ctx := context.Background()
+
+	stub := newRPCStub(t)
+	serveLinkedHeaders(t, stub, 100, 0)
+	c := stubClient(t, stub, WithBatchSize(8))
+	require.NoError(t, c.VerifyChainSegment(ctx, 10, 50))
+	require.Equal(t, []int{8, 8, 8, 8, 8, 1}, stub.batchSizes())
+	require.NoError(t, c.VerifyChainSegment(ctx, 20, 20))
+	require.Error(t, c.VerifyChainSegment(ctx, 50, 10))
+
+	for _, broken := range []uint64{30, 18} {
+		stub := newRPCStub(t)
+		headers := serveLinkedHeaders(t, stub, 100, broken)
+		c := stubClient(t, stub, WithBatchSize(8))
+
+		err := c.VerifyChainSegment(ctx, 10, 50)
+		var linkErr *LinkError
+		require.ErrorAs(t, err, &linkErr)
+		require.Equal(t, broken, linkErr.Block.Number)
+		require.Equal(t, common.Hash{0xde, 0xad}, linkErr.Block.ParentHash)
+		require.Equal(t, broken-1, linkErr.Parent.Number)
+		require.Equal(t, headers[broken-1].Hash(), linkErr.Parent.Hash)
+		require.Equal(t, int(broken-10)/8+1, len(stub.batchSizes()), "stopped at the broken link")
+
+		require.NoError(t, c.VerifyChainSegment(ctx, broken, 50), "the segment starts at the broken block")
+	}
+
+	stub = newRPCStub(t)
+	serveLinkedHeaders(t, stub, 40, 0)
+	c = stubClient(t, stub, WithBatchSize(8))
+	var itemErr *ItemError
+	require.ErrorAs(t, c.VerifyChainSegment(ctx, 30, 50), &itemErr)
+	require.ErrorIs(t, c.VerifyChainSegment(ctx, 30, 50), ethereum.NotFound)
+}
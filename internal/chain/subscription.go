@@ -0,0 +1,287 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+var (
+	wsReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_ws_reconnects_total",
+		Help: "Total number of WebSocket subscriptions re-established after a failure or a stall, by subscription (heads, logs)",
+	}, []string{"subscription"})
+
+	wsStalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_ws_stalls_total",
+		Help: "Total number of WebSocket subscriptions dropped for delivering nothing within 3 block times, by subscription (heads)",
+	}, []string{"subscription"})
+)
+
+// DefaultBlockTime is the default expected time between blocks (Polygon
+// PoS), a head subscription silent for 3 of them being reconnected.
+const DefaultBlockTime = 2 * time.Second
+
+// stallBlocks is the number of block times without a header after which a
+// head subscription is considered stalled.
+const stallBlocks = 3
+
+// errStalled is returned for a subscription delivering nothing within
+// stallBlocks block times.
+var errStalled = errors.New("subscription stalled")
+
+// WithBlockTime sets the expected time between blocks; a head subscription
+// delivering no header within 3 block times is reconnected. Non-positive
+// values keep the default.
+func WithBlockTime(blockTime time.Duration) ClientOption {
+	return func(c *OnChainClient) {
+		if blockTime > 0 {
+			c.blockTime = blockTime
+		}
+	}
+}
+
+// wsConn is a WebSocket connection serving subscriptions (implemented by
+// ethclient.Client).
+type wsConn interface {
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+	SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error)
+	Close()
+}
+
+// HeadSubscription delivers new block headers on a channel that outlives
+// connections. When the subscription fails or stays silent for 3 block
+// times, it reconnects (see managedSubscription).
+type HeadSubscription struct {
+	*managedSubscription[*types.Header]
+}
+
+// Headers returns the channel new headers are delivered on, closed once
+// the subscription is closed.
+func (s *HeadSubscription) Headers() <-chan *types.Header {
+	return s.items
+}
+
+// LogSubscription delivers the logs matching a filter on a channel that
+// outlives connections, removed (reorged) logs included. When the
+// subscription fails it reconnects (see managedSubscription); as logs need
+// not arrive every block, silence is no failure.
+type LogSubscription struct {
+	*managedSubscription[types.Log]
+}
+
+// Logs returns the channel logs are delivered on, closed once the
+// subscription is closed.
+func (s *LogSubscription) Logs() <-chan types.Log {
+	return s.items
+}
+
+// SubscribeNewHead subscribes to new block headers over the WebSocket
+// endpoint until ctx is done or the subscription is closed. Connecting,
+// like reconnecting, happens in the background.
+func (c *OnChainClient) SubscribeNewHead(ctx context.Context) (*HeadSubscription, error) {
+	if c.wsURL == "" {
+		return nil, fmt.Errorf("websocket endpoint not configured")
+	}
+	return c.subscribeHeads(ctx, c.dialWS), nil
+}
+
+// SubscribeLogs subscribes to the logs matching query over the WebSocket
+// endpoint until ctx is done or the subscription is closed. Its block range
+// is ignored: only logs of new blocks are delivered. Connecting, like
+// reconnecting, happens in the background.
+func (c *OnChainClient) SubscribeLogs(ctx context.Context, query ethereum.FilterQuery) (*LogSubscription, error) {
+	if c.wsURL == "" {
+		return nil, fmt.Errorf("websocket endpoint not configured")
+	}
+	return c.subscribeLogs(ctx, c.dialWS, query), nil
+}
+
+// dialWS connects to the WebSocket endpoint with the client's transport.
+func (c *OnChainClient) dialWS(ctx context.Context) (wsConn, error) {
+	client, err := rpc.DialOptions(ctx, c.wsURL, c.dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
+
+// subscribeHeads starts a head subscription over the connections dial
+// opens.
+func (c *OnChainClient) subscribeHeads(ctx context.Context, dial func(ctx context.Context) (wsConn, error)) *HeadSubscription {
+	s := &managedSubscription[*types.Header]{
+		kind: "heads",
+		dial: dial,
+		subscribe: func(ctx context.Context, conn wsConn, ch chan<- *types.Header) (ethereum.Subscription, error) {
+			return conn.SubscribeNewHead(ctx, ch)
+		},
+		stallAfter: stallBlocks * c.blockTime,
+	}
+	s.start(ctx, c)
+	return &HeadSubscription{s}
+}
+
+// subscribeLogs starts a subscription to the logs matching query over the
+// connections dial opens.
+func (c *OnChainClient) subscribeLogs(ctx context.Context, dial func(ctx context.Context) (wsConn, error), query ethereum.FilterQuery) *LogSubscription {
+	query.FromBlock, query.ToBlock, query.BlockHash = nil, nil, nil
+	s := &managedSubscription[types.Log]{
+		kind: "logs",
+		dial: dial,
+		subscribe: func(ctx context.Context, conn wsConn, ch chan<- types.Log) (ethereum.Subscription, error) {
+			return conn.SubscribeFilterLogs(ctx, query, ch)
+		},
+	}
+	s.start(ctx, c)
+	return &LogSubscription{s}
+}
+
+// managedSubscription delivers the items of a subscription on a channel
+// that outlives connections. It owns its WebSocket connection: when the
+// subscription fails, or delivers nothing for stallAfter when set, it
+// closes the connection, re-dials with jittered exponential backoff and
+// subscribes again. Items produced while it was reconnecting are not
+// delivered; Subscribed tells callers when to look for them.
+type managedSubscription[T any] struct {
+	kind       string // Labels metrics and logs: heads, logs
+	dial       func(ctx context.Context) (wsConn, error)
+	subscribe  func(ctx context.Context, conn wsConn, ch chan<- T) (ethereum.Subscription, error)
+	stallAfter time.Duration // Zero disables stall detection
+
+	items      chan T
+	subscribed chan struct{}
+	backoff    time.Duration
+	maxBackoff time.Duration
+	logger     *zerolog.Logger
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// start runs the subscription in the background until ctx is done or it
+// is closed, backing off as the client retries calls.
+func (s *managedSubscription[T]) start(ctx context.Context, c *OnChainClient) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.items = make(chan T)
+	s.subscribed = make(chan struct{}, 1)
+	s.backoff = c.retryBackoff
+	s.maxBackoff = c.maxRetryBackoff
+	s.logger = c.logger
+	s.done = make(chan struct{})
+	go s.run(ctx)
+}
+
+// Subscribed returns a channel signalled each time the subscription is
+// established, the first time included, so callers can fetch what was
+// produced while it was down. Signals not yet received are coalesced.
+func (s *managedSubscription[T]) Subscribed() <-chan struct{} {
+	return s.subscribed
+}
+
+// Close ends the subscription and closes its connection.
+func (s *managedSubscription[T]) Close() {
+	s.cancel()
+	<-s.done
+}
+
+// run subscribes over new connections until ctx is done, backing off
+// between attempts unless the last subscription delivered items.
+func (s *managedSubscription[T]) run(ctx context.Context) {
+	defer close(s.done)
+	defer close(s.items)
+
+	backoff := s.backoff
+	for {
+		delivered, err := s.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if delivered {
+			backoff = s.backoff
+		}
+		if errors.Is(err, errStalled) {
+			wsStalls.WithLabelValues(s.kind).Inc()
+		}
+
+		wait := jitter(backoff)
+		s.logger.Warn().
+			Err(err).
+			Str("subscription", s.kind).
+			Dur("backoff", wait).
+			Msg("WebSocket subscription lost, reconnecting")
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, s.maxBackoff)
+		wsReconnects.WithLabelValues(s.kind).Inc()
+	}
+}
+
+// session dials a connection and forwards the items of its subscription
+// until the subscription fails, stalls or ctx is done. It reports whether
+// any item was delivered.
+func (s *managedSubscription[T]) session(ctx context.Context) (bool, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to WebSocket endpoint: %w", err)
+	}
+	defer conn.Close()
+
+	items := make(chan T, 16)
+	sub, err := s.subscribe(ctx, conn, items)
+	if err != nil {
+		return false, fmt.Errorf("failed to subscribe to %s: %w", s.kind, err)
+	}
+	defer sub.Unsubscribe()
+	select {
+	case s.subscribed <- struct{}{}:
+	default:
+	}
+
+	var stalled <-chan time.Time
+	var stall *time.Timer
+	if s.stallAfter > 0 {
+		stall = time.NewTimer(s.stallAfter)
+		defer stall.Stop()
+		stalled = stall.C
+	}
+
+	delivered := false
+	for {
+		select {
+		case <-ctx.Done():
+			return delivered, ctx.Err()
+		case err := <-sub.Err():
+			if err == nil {
+				err = errors.New("subscription closed by the endpoint")
+			}
+			return delivered, fmt.Errorf("%s subscription failed: %w", s.kind, err)
+		case <-stalled:
+			return delivered, fmt.Errorf("%w: nothing delivered for %s", errStalled, s.stallAfter)
+		case item := <-items:
+			select {
+			case s.items <- item:
+			case <-ctx.Done():
+				return delivered, ctx.Err()
+			}
+			delivered = true
+			if stall != nil {
+				stall.Reset(s.stallAfter)
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWSConn is a WebSocket connection whose subscription is fed by the
+// test: headers are sent on heads, logs on logs and failures on errc.
+type fakeWSConn struct {
+	subscribed chan<- *fakeWSConn // Notified once subscribed
+	heads      chan<- *types.Header
+	logs       chan<- types.Log
+	query      ethereum.FilterQuery
+	errc       chan error
+	closed     chan struct{}
+}
+
+func (f *fakeWSConn) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	f.heads = ch
+	f.subscribed <- f
+	return f, nil
+}
+
+func (f *fakeWSConn) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	f.logs, f.query = ch, q
+	f.subscribed <- f
+	return f, nil
+}
+
+func (f *fakeWSConn) Err() <-chan error { return f.errc }
+func (f *fakeWSConn) Unsubscribe()      {}
+func (f *fakeWSConn) Close()            { close(f.closed) }
+
+// fakeDialer opens fake connections, failing the first failures dials.
+type fakeDialer struct {
+	mu         sync.Mutex
+	failures   int
+	dials      int
+	subscribed chan *fakeWSConn
+}
+
+func newFakeDialer(failures int) *fakeDialer {
+	return &fakeDialer{failures: failures, subscribed: make(chan *fakeWSConn, 1)}
+}
+
+func (d *fakeDialer) dial(ctx context.Context) (wsConn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dials++
+	if d.dials <= d.failures {
+		return nil, errConnRefused
+	}
+	return &fakeWSConn{subscribed: d.subscribed, errc: make(chan error, 1), closed: make(chan struct{})}, nil
+}
+
+// next returns the next subscribed connection.
+func (d *fakeDialer) next(t *testing.T) *fakeWSConn {
+	t.Helper()
+	select {
+	case conn := <-d.subscribed:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("no subscription")
+		return nil
+	}
+}
+
+// receive returns the next header delivered by s.
+func receive(t *testing.T, s *HeadSubscription) *types.Header {
+	t.Helper()
+	select {
+	case header := <-s.Headers():
+		return header
+	case <-time.After(5 * time.Second):
+		t.Fatal("no header delivered")
+		return nil
+	}
+}
+
+func newHeader(number int64) *types.Header {
+	return &types.Header{Number: big.NewInt(number)}
+}
+
+// TestHeadSubscriptionResubscribes tests that a failed subscription is
+// replaced by a new connection, headers arriving on the same channel, and
+// that closing the subscription closes its channel.
+func TestHeadSubscriptionResubscribes(t *testing.T) {
+	c := testClient(t, "ws-resubscribe", nil, WithRetry(1, time.Millisecond, time.Millisecond), WithBlockTime(time.Hour))
+	dialer := newFakeDialer(0)
+	reconnects := testutil.ToFloat64(wsReconnects.WithLabelValues("heads"))
+	s := c.subscribeHeads(context.Background(), dialer.dial)
+
+	first := dialer.next(t)
+	first.heads <- newHeader(65_000_000)
+	require.Equal(t, int64(65_000_000), receive(t, s).Number.Int64())
+
+	first.errc <- errConnRefused
+	second := dialer.next(t)
+	<-first.closed
+	second.heads <- newHeader(65_000_001)
+	require.Equal(t, int64(65_000_001), receive(t, s).Number.Int64())
+	require.Equal(t, reconnects+1, testutil.ToFloat64(wsReconnects.WithLabelValues("heads")))
+
+	s.Close()
+	<-second.closed
+	_, open := <-s.Headers()
+	require.False(t, open)
+}
+
+// TestHeadSubscriptionStall tests that a subscription delivering no header
+// within 3 block times is reconnected.
+func TestHeadSubscriptionStall(t *testing.T) {
+	c := testClient(t, "ws-stall", nil, WithRetry(1, time.Millisecond, time.Millisecond), WithBlockTime(10*time.Millisecond))
+	dialer := newFakeDialer(0)
+	stalls := testutil.ToFloat64(wsStalls.WithLabelValues("heads"))
+	s := c.subscribeHeads(context.Background(), dialer.dial)
+	defer s.Close()
+
+	silent := dialer.next(t)
+	next := dialer.next(t)
+	<-silent.closed
+	require.GreaterOrEqual(t, testutil.ToFloat64(wsStalls.WithLabelValues("heads")), stalls+1)
+
+	next.heads <- newHeader(65_000_000)
+	require.Equal(t, int64(65_000_000), receive(t, s).Number.Int64())
+}
+
+// TestHeadSubscriptionRedials tests that failed dials are retried with
+// backoff until a connection subscribes, and that the subscription ends
+// with its context.
+func TestHeadSubscriptionRedials(t *testing.T) {
+	c := testClient(t, "ws-redial", nil, WithRetry(1, time.Millisecond, 2*time.Millisecond), WithBlockTime(time.Hour))
+	dialer := newFakeDialer(3)
+	reconnects := testutil.ToFloat64(wsReconnects.WithLabelValues("heads"))
+	ctx, cancel := context.WithCancel(context.Background())
+	s := c.subscribeHeads(ctx, dialer.dial)
+
+	conn := dialer.next(t)
+	conn.heads <- newHeader(65_000_000)
+	require.Equal(t, int64(65_000_000), receive(t, s).Number.Int64())
+	require.Equal(t, reconnects+3, testutil.ToFloat64(wsReconnects.WithLabelValues("heads")))
+
+	cancel()
+	<-conn.closed
+	_, open := <-s.Headers()
+	require.False(t, open)
+}
+
+// TestLogSubscriptionResubscribes tests that a log subscription ignores the
+// block range of its query, signals each (re)subscription, delivers removed
+// logs, and is not reconnected for staying silent.
+func TestLogSubscriptionResubscribes(t *testing.T) {
+	c := testClient(t, "ws-logs", nil, WithRetry(1, time.Millisecond, time.Millisecond), WithBlockTime(time.Millisecond))
+	dialer := newFakeDialer(0)
+	reconnects := testutil.ToFloat64(wsReconnects.WithLabelValues("logs"))
+	contract := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	s := c.subscribeLogs(context.Background(), dialer.dial, ethereum.FilterQuery{
+		FromBlock: big.NewInt(65_000_000),
+		Addresses: []common.Address{contract},
+	})
+	defer s.Close()
+
+	first := dialer.next(t)
+	<-s.Subscribed()
+	require.Nil(t, first.query.FromBlock)
+	require.Equal(t, []common.Address{contract}, first.query.Addresses)
+
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-first.closed:
+		t.Fatal("a silent log subscription was reconnected")
+	default:
+	}
+
+	first.errc <- errConnRefused
+	second := dialer.next(t)
+	<-s.Subscribed()
+	second.logs <- types.Log{Address: contract, BlockNumber: 65_000_001, Removed: true}
+	select {
+	case log := <-s.Logs():
+		require.True(t, log.Removed)
+		require.Equal(t, uint64(65_000_001), log.BlockNumber)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no log delivered")
+	}
+	require.Equal(t, reconnects+1, testutil.ToFloat64(wsReconnects.WithLabelValues("logs")))
+}
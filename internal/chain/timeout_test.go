@@ -0,0 +1,72 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// serveSlowBlockNumber answers eth_blockNumber after sleeping the next of
+// delays, then at once.
+func serveSlowBlockNumber(s *rpcStub, delays ...time.Duration) {
+	var mu sync.Mutex
+	s.handle("eth_blockNumber", func([]json.RawMessage) (any, *stubError) {
+		mu.Lock()
+		var delay time.Duration
+		if len(delays) > 0 {
+			delay, delays = delays[0], delays[1:]
+		}
+		mu.Unlock()
+		time.Sleep(delay)
+		return "0x3dfd240", nil
+	})
+}
+
+// TestRPCTimeout tests that a read call is bounded by the RPC timeout,
+// retries included, failing with ErrTimeout, and that a caller's earlier
+// deadline prevails without being reported as an ErrTimeout.
+func TestRPCTimeout(t *testing.T) {
+	stub := newRPCStub(t)
+	serveSlowBlockNumber(stub, 500*time.Millisecond, 500*time.Millisecond)
+	c := stubClient(t, stub, WithRPCTimeout(100*time.Millisecond), WithRetry(3, time.Millisecond, time.Millisecond))
+
+	start := time.Now()
+	_, err := c.GetLatestBlockNumber(context.Background())
+	require.ErrorIs(t, err, ErrTimeout)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "timed out after 100ms")
+	require.Less(t, time.Since(start), 400*time.Millisecond)
+	require.Equal(t, 1, stub.callsOf("eth_blockNumber"), "no retry past the RPC timeout")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = c.GetLatestBlockNumber(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NotErrorIs(t, err, ErrTimeout)
+}
+
+// TestCallTimeoutRetried tests that an attempt exceeding the call timeout
+// fails with ErrTimeout, is counted in the timeout error class, and is
+// retried.
+func TestCallTimeoutRetried(t *testing.T) {
+	stub := newRPCStub(t)
+	serveSlowBlockNumber(stub, 500*time.Millisecond, 500*time.Millisecond)
+	timeouts := testutil.ToFloat64(rpcCallErrors.WithLabelValues("block_number", "0", "timeout"))
+
+	c := stubClient(t, stub, WithFailover(100, 50*time.Millisecond, time.Minute), WithRetry(1, 0, 0))
+	_, err := c.GetLatestBlockNumber(context.Background())
+	require.ErrorIs(t, err, ErrTimeout)
+	require.ErrorContains(t, err, "timed out after 50ms")
+
+	c = stubClient(t, stub, WithFailover(100, 50*time.Millisecond, time.Minute), WithRetry(2, time.Millisecond, time.Millisecond))
+	number, err := c.GetLatestBlockNumber(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(65_000_000), number)
+	require.Equal(t, 3, stub.callsOf("eth_blockNumber"))
+	require.Equal(t, timeouts+2, testutil.ToFloat64(rpcCallErrors.WithLabelValues("block_number", "0", "timeout")))
+}
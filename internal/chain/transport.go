@@ -0,0 +1,145 @@
+package chain
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultMaxIdleConns is the default number of idle keep-alive
+	// connections kept, all endpoints together
+	DefaultMaxIdleConns = 100
+
+	// DefaultMaxIdleConnsPerHost is the default number of idle keep-alive
+	// connections kept per endpoint. Go's default of 2 makes parallel
+	// backfill workers open and close connections on every batch.
+	DefaultMaxIdleConnsPerHost = 32
+
+	// DefaultIdleConnTimeout is the default time an idle connection is kept
+	// before it is closed
+	DefaultIdleConnTimeout = 90 * time.Second
+
+	// DefaultTLSHandshakeTimeout is the default bound of a TLS handshake
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// Transport configures the connections to the RPC endpoints, HTTP and
+// WebSocket alike. Zero values keep the defaults.
+type Transport struct {
+	MaxIdleConns        int               // Idle keep-alive connections kept, all endpoints together
+	MaxIdleConnsPerHost int               // Idle keep-alive connections kept per endpoint
+	IdleConnTimeout     time.Duration     // Time an idle connection is kept before it is closed
+	TLSHandshakeTimeout time.Duration     // Bound of a TLS handshake
+	ProxyURL            string            // Proxy of every connection; HTTP_PROXY, HTTPS_PROXY and NO_PROXY when empty
+	CAFile              string            // PEM certificates trusted in addition to the system ones, e.g. of a TLS-intercepting proxy
+	InsecureSkipVerify  bool              // Skip TLS certificate verification (local testing only)
+	Headers             map[string]string // Sent with every request and WebSocket handshake, e.g. provider API keys; values expand $VARIABLES
+}
+
+// WithTransport sets the connection pool, proxy, TLS settings and headers
+// of the connections to the RPC endpoints.
+func WithTransport(t Transport) ClientOption {
+	return func(c *OnChainClient) {
+		c.transport = t
+	}
+}
+
+// dialOptions returns the options dialing the RPC endpoints with the
+// transport: HTTP endpoints share one HTTP client, its round tripper
+// wrapped by wrap if set, WebSocket ones are dialed through the same proxy
+// with the same TLS settings.
+func (t Transport) dialOptions(wrap func(http.RoundTripper) http.RoundTripper) ([]rpc.ClientOption, error) {
+	tlsConfig, err := t.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy := http.ProxyFromEnvironment
+	if t.ProxyURL != "" {
+		proxyURL, err := url.Parse(t.ProxyURL)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", t.ProxyURL)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        DefaultMaxIdleConns,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     DefaultIdleConnTimeout,
+		TLSHandshakeTimeout: DefaultTLSHandshakeTimeout,
+		TLSClientConfig:     tlsConfig,
+	}
+	if t.MaxIdleConns > 0 {
+		transport.MaxIdleConns = t.MaxIdleConns
+	}
+	if t.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = t.MaxIdleConnsPerHost
+	}
+	if t.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = t.IdleConnTimeout
+	}
+	if t.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = t.TLSHandshakeTimeout
+	}
+
+	headers := make(http.Header, len(t.Headers))
+	for key, value := range t.Headers {
+		headers.Set(key, os.ExpandEnv(value))
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if wrap != nil {
+		roundTripper = wrap(transport)
+	}
+	return []rpc.ClientOption{
+		rpc.WithHTTPClient(&http.Client{Transport: roundTripper}),
+		rpc.WithWebsocketDialer(websocket.Dialer{
+			Proxy:            proxy,
+			TLSClientConfig:  tlsConfig,
+			HandshakeTimeout: transport.TLSHandshakeTimeout,
+			ReadBufferSize:   1024,
+			WriteBufferSize:  1024,
+		}),
+		rpc.WithHeaders(headers),
+	}, nil
+}
+
+// tlsConfig returns the TLS settings of the transport.
+func (t Transport) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile == "" {
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(t.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in CA file %s", t.CAFile)
+	}
+	config.RootCAs = pool
+	return config, nil
+}
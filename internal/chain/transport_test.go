@@ -0,0 +1,114 @@
+package chain
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// proxyStub is an HTTP proxy answering the JSON-RPC requests forwarded to
+// it with a stub and refusing CONNECT tunnels, recording the target host and
+// the headers of every request.
+type proxyStub struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func newProxyStub(t *testing.T, stub *rpcStub) *proxyStub {
+	t.Helper()
+	p := &proxyStub{}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.requests = append(p.requests, r.Clone(context.Background()))
+		p.mu.Unlock()
+		if r.Method == http.MethodConnect {
+			http.Error(w, "tunnels refused", http.StatusForbidden)
+			return
+		}
+		stub.serveHTTP(w, r)
+	}))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// received returns the requests received so far.
+func (p *proxyStub) received() []*http.Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*http.Request(nil), p.requests...)
+}
+
+// TestTransportProxyAndHeaders tests that HTTP calls and WebSocket
+// handshakes go through the configured proxy, with the configured headers
+// and their environment variables expanded.
+func TestTransportProxyAndHeaders(t *testing.T) {
+	t.Setenv("TEST_RPC_API_KEY", "secret")
+	proxy := newProxyStub(t, newRPCStub(t))
+	logger := zerolog.Nop()
+
+	c, err := NewClient([]string{"http://rpc.example.invalid/v2"}, "ws://ws.example.invalid/v2", 137, &logger,
+		WithTransport(Transport{
+			ProxyURL: proxy.server.URL,
+			Headers:  map[string]string{"X-Api-Key": "$TEST_RPC_API_KEY", "X-Client": "polymarket-indexer"},
+		}),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+
+	requests := proxy.received()
+	require.NotEmpty(t, requests, "chain ID verified through the proxy")
+	for _, r := range requests {
+		require.Equal(t, "rpc.example.invalid", r.Host)
+		require.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		require.Equal(t, "polymarket-indexer", r.Header.Get("X-Client"))
+	}
+
+	_, err = c.dialWS(context.Background())
+	require.Error(t, err, "the proxy refuses tunnels")
+	requests = proxy.received()
+	connect := requests[len(requests)-1]
+	require.Equal(t, http.MethodConnect, connect.Method)
+	require.Equal(t, "ws.example.invalid:80", connect.Host)
+}
+
+// TestTransportWebSocketHeaders tests that WebSocket handshakes carry the
+// configured headers.
+func TestTransportWebSocketHeaders(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		http.Error(w, "no WebSocket", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	c := stubClient(t, newRPCStub(t))
+	c.wsURL = "ws" + server.URL[len("http"):]
+	var err error
+	c.dialOptions, err = Transport{Headers: map[string]string{"X-Api-Key": "secret"}}.dialOptions(nil)
+	require.NoError(t, err)
+
+	_, err = c.dialWS(context.Background())
+	require.Error(t, err)
+	require.Equal(t, "secret", (<-headers).Get("X-Api-Key"))
+}
+
+// TestTransportInvalid tests that a client is not created with an invalid
+// proxy URL or CA file.
+func TestTransportInvalid(t *testing.T) {
+	logger := zerolog.Nop()
+	for _, transport := range []Transport{
+		{ProxyURL: "proxy.internal:3128"},
+		{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+	} {
+		_, err := NewClient([]string{"http://rpc.example.invalid"}, "", 137, &logger, WithTransport(transport))
+		require.ErrorContains(t, err, "invalid RPC transport")
+	}
+}
@@ -0,0 +1,37 @@
+package consumer
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// permanentError is a failure that redelivering the message cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure that would recur on every delivery.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether a failure would recur on every delivery:
+// errors marked permanent (undecodable messages) and Postgres rejecting the
+// data itself, data exceptions (SQLSTATE class 22) and integrity constraint
+// violations (class 23).
+func IsPermanent(err error) bool {
+	var perr *permanentError
+	if errors.As(err, &perr) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")
+	}
+	return false
+}
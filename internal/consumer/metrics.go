@@ -0,0 +1,360 @@
+// Package consumer holds the metrics of the consumer's pipeline, from the
+// messages it consumes from JetStream to the statements it writes to
+// TimescaleDB, so a backlog can be told apart between slow NATS delivery
+// (pending messages growing while writes stay fast) and a slow database
+// (write durations and buffered messages growing).
+package consumer
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+var (
+	EventsConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_events_consumed_total",
+		Help: "Total number of events consumed from NATS",
+	}, []string{"event_type"})
+
+	EventsStored = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_events_stored_total",
+		Help: "Total number of events stored in database",
+	}, []string{"event_type"})
+
+	EventsDuplicate = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_consumer_duplicates_total",
+		Help: "Total number of events consumed again after their raw event was stored (redeliveries, re-published corrections)",
+	}, []string{"event_type"})
+
+	LastConsumedBlock = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "polymarket_consumer_last_block",
+		Help: "Block number of the last event consumed from NATS",
+	})
+
+	DeadLettersSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_consumer_dead_letters_skipped_total",
+		Help: "Total number of dead letters on the stream skipped by the consumer",
+	}, []string{"reason"})
+
+	SchemaSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_consumer_schema_skipped_total",
+		Help: "Total number of messages skipped because their schema version is not accepted",
+	}, []string{"version"})
+
+	ConsumeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_consume_errors_total",
+		Help: "Total number of consume errors",
+	}, []string{"error_type"})
+
+	MessagesRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_consumer_rejected_total",
+		Help: "Total number of messages that failed, by outcome (retry, permanent, exhausted)",
+	}, []string{"outcome"})
+
+	EventsQuarantined = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_consumer_quarantined_total",
+		Help: "Total number of malformed events written to quarantined_events instead of being stored, by reason",
+	}, []string{"event_type", "reason"})
+
+	ResolutionsRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "polymarket_resolutions_rejected_total",
+		Help: "Total number of ConditionResolution events rejected for invalid payouts",
+	})
+
+	ResolutionsUnprepared = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "polymarket_resolutions_out_of_order_total",
+		Help: "Total number of ConditionResolution events stored before their ConditionPreparation",
+	})
+
+	OpenInterestClamped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_open_interest_clamped_total",
+		Help: "Total number of open interest updates clamped at zero, by event type",
+	}, []string{"event_type"})
+
+	BlockToStoreLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "polymarket_consumer_block_to_store_seconds",
+		Help:    "Time from the event's block timestamp to the event being stored, by event type",
+		Buckets: latencyBuckets,
+	}, []string{"event_type"})
+
+	IndexerToStoreLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "polymarket_consumer_indexer_to_store_seconds",
+		Help:    "Time from the indexer routing the event to the event being stored, by event type",
+		Buckets: latencyBuckets,
+	}, []string{"event_type"})
+
+	OldestUnackedAge = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "polymarket_consumer_oldest_unacked_age_seconds",
+		Help: "Time since the oldest message delivered to the consumer and not yet settled was published to the stream, 0 when none",
+	}, func() float64 {
+		return unacked.oldestAge(time.Now()).Seconds()
+	})
+
+	FlushSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "polymarket_consumer_flush_messages",
+		Help:    "Number of messages written per database flush",
+		Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000},
+	})
+
+	FlushDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "polymarket_consumer_flush_duration_seconds",
+		Help:    "Time taken to write a batch of messages to the database",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	InProgressSent = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "polymarket_consumer_in_progress_total",
+		Help: "Total number of in-progress acknowledgments sent for messages still being written, resetting their ack wait",
+	})
+
+	SlowFlushes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "polymarket_consumer_slow_flushes_total",
+		Help: "Total number of flushes still running after two thirds of the ack wait",
+	})
+
+	ChunkedEvents = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "polymarket_consumer_chunked_events_total",
+		Help: "Total number of events reassembled from chunk messages",
+	})
+
+	BufferedChunks = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "polymarket_consumer_buffered_chunks",
+		Help: "Number of chunk messages held until the rest of their event arrives",
+	})
+
+	BufferedMessages = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "polymarket_consumer_buffered_messages",
+		Help: "Messages consumed and waiting for their batch to be written",
+	})
+
+	WorkerQueued = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "polymarket_consumer_worker_queued_messages",
+		Help: "Messages queued for a worker and not yet buffered by its batch writer, by worker",
+	}, []string{"worker"})
+
+	WriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "polymarket_consumer_write_duration_seconds",
+		Help:    "Time taken by Postgres to run a statement of a batch, by table written",
+		Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+	}, []string{"table"})
+
+	ConflictSkips = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_consumer_conflict_skips_total",
+		Help: "Total number of inserts that wrote no row because the row was already stored, by table",
+	}, []string{"table"})
+
+	RowsInserted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_rows_inserted_total",
+		Help: "Total number of rows written by inserts, new or corrected in place, by table",
+	}, []string{"table"})
+
+	RowsDuplicate = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_rows_duplicate_total",
+		Help: "Total number of rows inserts found already stored with the same values, by table",
+	}, []string{"table"})
+
+	PendingMessages = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "polymarket_consumer_pending_messages",
+		Help: "Messages on the stream not yet delivered to the consumer, as last reported by JetStream",
+	})
+
+	AckPendingMessages = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "polymarket_consumer_ack_pending_messages",
+		Help: "Messages delivered to the consumer and not yet acknowledged, as last reported by JetStream",
+	})
+
+	Leader = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "polymarket_consumer_leader",
+		Help: "1 while this replica holds the leader lock and consumes, 0 while it stands by (always 1 without leader election)",
+	})
+)
+
+// latencyBuckets span sub-second pipeline delays up to an hour of backlog.
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600}
+
+// DefaultPendingPollInterval is the default interval between two reads of
+// the consumer's pending messages.
+const DefaultPendingPollInterval = 15 * time.Second
+
+// ObserveLatency records how long a stored event took to reach the database,
+// both from its block (includes confirmation delay) and from the indexer
+// (NATS and consumer delay only), under its event type: a backlog of one
+// type is not hidden by fresh events of another.
+func ObserveLatency(eventType string, event models.Event, storedAt time.Time) {
+	BlockToStoreLatency.WithLabelValues(eventType).Observe(storedAt.Sub(time.Unix(int64(event.Timestamp), 0)).Seconds())
+
+	// Events published before ProcessedAt was set carry the zero time
+	if !event.ProcessedAt.IsZero() {
+		IndexerToStoreLatency.WithLabelValues(eventType).Observe(storedAt.Sub(event.ProcessedAt).Seconds())
+	}
+}
+
+// unackedMessages holds the time every message delivered and not yet
+// settled was published to the stream, by stream sequence.
+type unackedMessages struct {
+	mu        sync.Mutex
+	published map[uint64]time.Time
+}
+
+// unacked backs OldestUnackedAge.
+var unacked = &unackedMessages{published: make(map[uint64]time.Time)}
+
+// oldestAge returns the time since the oldest unsettled message was
+// published, zero when every delivered message is settled.
+func (u *unackedMessages) oldestAge(now time.Time) time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var oldest time.Time
+	for _, published := range u.published {
+		// Messages without a publish time have no age
+		if published.IsZero() {
+			continue
+		}
+		if oldest.IsZero() || published.Before(oldest) {
+			oldest = published
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return now.Sub(oldest)
+}
+
+// MessageDelivered tracks a delivered message until MessageSettled is called
+// with it. Redeliveries of a tracked message keep its publish time.
+func MessageDelivered(msg jetstream.Msg) {
+	meta, err := msg.Metadata()
+	if err != nil {
+		return
+	}
+	unacked.mu.Lock()
+	unacked.published[meta.Sequence.Stream] = meta.Timestamp
+	unacked.mu.Unlock()
+}
+
+// MessageSettled stops tracking a message once it is acknowledged, rejected
+// or terminated.
+func MessageSettled(msg jetstream.Msg) {
+	meta, err := msg.Metadata()
+	if err != nil {
+		return
+	}
+	unacked.mu.Lock()
+	delete(unacked.published, meta.Sequence.Stream)
+	unacked.mu.Unlock()
+}
+
+// statementPattern matches the tables a statement writes, and the locking
+// and upsert clauses that read like an update.
+var statementPattern = regexp.MustCompile(`(?i)\b(DO\s+|FOR\s+)?(?:INSERT\s+INTO|DELETE\s+FROM|UPDATE)\s+(\w+)`)
+
+// functionPattern matches a statement that only calls a function.
+var functionPattern = regexp.MustCompile(`(?i)^\s*SELECT\s+(\w+)\s*\([^()]*\)\s*$`)
+
+// insertPattern matches a statement that is a single insert, whose command
+// tag counts the rows it inserted.
+var insertPattern = regexp.MustCompile(`(?i)^\s*INSERT\s+INTO\s`)
+
+// tables caches StatementTable by query: the consumer runs a fixed set of
+// queries.
+var tables sync.Map
+
+// StatementTable returns the table label of a statement: the first table it
+// inserts into, deletes from or updates, or else the function it calls.
+func StatementTable(query string) string {
+	if table, ok := tables.Load(query); ok {
+		return table.(string)
+	}
+	table := "other"
+	if match := functionPattern.FindStringSubmatch(query); match != nil {
+		table = match[1]
+	}
+	for _, match := range statementPattern.FindAllStringSubmatch(query, -1) {
+		if match[1] == "" {
+			table = match[2]
+			break
+		}
+	}
+	tables.Store(query, table)
+	return table
+}
+
+// ObserveWrite records the time a statement took to run.
+func ObserveWrite(query string, d time.Duration) {
+	WriteDuration.WithLabelValues(StatementTable(query)).Observe(d.Seconds())
+}
+
+// ObserveRows counts the rows a committed insert wrote and those it found
+// already stored, by table, from its command tag. rows is the number of
+// rows the statement writes when none is stored; 0 stands for a single-row
+// INSERT statement. Inserts skip stored rows with ON CONFLICT DO NOTHING or
+// DO UPDATE ... WHERE their values differ. Statements feeding aggregates
+// through CTEs report the rows of their last command and pass 0, so they
+// are not counted.
+//
+// An insert that wrote no row of a single-row statement is also counted in
+// ConflictSkips.
+func ObserveRows(query string, tag pgconn.CommandTag, rows int) {
+	if rows == 0 {
+		if !insertPattern.MatchString(query) {
+			return
+		}
+		rows = 1
+	}
+	table := StatementTable(query)
+	written := min(int(tag.RowsAffected()), rows)
+	RowsInserted.WithLabelValues(table).Add(float64(written))
+	RowsDuplicate.WithLabelValues(table).Add(float64(rows - written))
+	if written == 0 && insertPattern.MatchString(query) {
+		ConflictSkips.WithLabelValues(table).Inc()
+	}
+}
+
+// ConsumerInfo reads the state of a JetStream consumer (implemented by
+// jetstream.Consumer).
+type ConsumerInfo interface {
+	Info(ctx context.Context) (*jetstream.ConsumerInfo, error)
+}
+
+// MonitorPending sets PendingMessages and AckPendingMessages from the
+// consumer's state every interval until ctx is done.
+func MonitorPending(ctx context.Context, c ConsumerInfo, interval time.Duration, logger zerolog.Logger) {
+	if interval <= 0 {
+		interval = DefaultPendingPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		updatePending(ctx, c, logger)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updatePending reads the consumer's state once.
+func updatePending(ctx context.Context, c ConsumerInfo, logger zerolog.Logger) {
+	info, err := c.Info(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Warn().Err(err).Msg("failed to read consumer info")
+		}
+		return
+	}
+	PendingMessages.Set(float64(info.NumPending))
+	AckPendingMessages.Set(float64(info.NumAckPending))
+}
@@ -0,0 +1,168 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// sampleCount returns the number of observations of a histogram.
+func sampleCount(t *testing.T, h prometheus.Observer) uint64 {
+	t.Helper()
+	m := &dto.Metric{}
+	require.NoError(t, h.(prometheus.Metric).Write(m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+// TestObserveLatency tests that latency is recorded under the event type,
+// and indexer-to-store latency only for events stamped by the indexer.
+func TestObserveLatency(t *testing.T) {
+	storedAt := time.Unix(1700000100, 0)
+	block, indexer := BlockToStoreLatency.WithLabelValues("OrderFilled"), IndexerToStoreLatency.WithLabelValues("OrderFilled")
+	otherBlock := BlockToStoreLatency.WithLabelValues("TransferSingle")
+
+	blockBefore, indexerBefore, otherBefore := sampleCount(t, block), sampleCount(t, indexer), sampleCount(t, otherBlock)
+	ObserveLatency("OrderFilled", models.Event{Timestamp: 1700000000}, storedAt)
+	require.Equal(t, blockBefore+1, sampleCount(t, block))
+	require.Equal(t, indexerBefore, sampleCount(t, indexer))
+
+	ObserveLatency("OrderFilled", models.Event{Timestamp: 1700000000, ProcessedAt: storedAt.Add(-time.Second)}, storedAt)
+	require.Equal(t, blockBefore+2, sampleCount(t, block))
+	require.Equal(t, indexerBefore+1, sampleCount(t, indexer))
+	require.Equal(t, otherBefore, sampleCount(t, otherBlock))
+}
+
+// TestOldestUnackedAge tests that the age is that of the oldest message
+// still unsettled, messages without a publish time aside, and zero once
+// every message is settled.
+func TestOldestUnackedAge(t *testing.T) {
+	u := &unackedMessages{published: make(map[uint64]time.Time)}
+	now := time.Unix(1700000000, 0)
+	require.Zero(t, u.oldestAge(now))
+
+	u.published[7] = now.Add(-time.Minute)
+	u.published[3] = now.Add(-time.Hour)
+	for seq := range uint64(20) {
+		u.published[100+seq] = time.Time{}
+	}
+	require.Equal(t, time.Hour, u.oldestAge(now))
+
+	delete(u.published, 3)
+	require.Equal(t, time.Minute, u.oldestAge(now))
+}
+
+// TestStatementTable tests that statements are labelled by the first table
+// they write, past the tables they only read and their upsert and locking
+// clauses, or by the function they call.
+func TestStatementTable(t *testing.T) {
+	tests := []struct {
+		query string
+		table string
+	}{
+		{"INSERT INTO events (a) VALUES ($1) ON CONFLICT (a) DO NOTHING", "events"},
+		{"INSERT INTO tokens (a) VALUES ($1) ON CONFLICT (a) DO UPDATE SET b = EXCLUDED.b", "tokens"},
+		{`WITH previous AS (SELECT token_id FROM trades), upserted AS (
+			INSERT INTO trades (a) VALUES ($1) ON CONFLICT (a) DO UPDATE SET b = 1 RETURNING a
+		) INSERT INTO candles SELECT * FROM upserted`, "trades"},
+		{"WITH removed AS (DELETE FROM token_transfers RETURNING *) INSERT INTO balances SELECT 1", "token_transfers"},
+		{"WITH locked AS (SELECT id FROM conditions FOR UPDATE SKIP LOCKED) UPDATE events SET processed = true", "events"},
+		{"UPDATE events SET processed = true WHERE transaction_hash = $1", "events"},
+		{"SELECT record_position_changes($1, $2, $3)", "record_position_changes"},
+		{"SELECT count(*) FROM events", "other"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.table, StatementTable(tt.query), tt.query)
+	}
+}
+
+// TestObserveWrite tests that statement durations are recorded by table.
+func TestObserveWrite(t *testing.T) {
+	histogram := WriteDuration.WithLabelValues("order_fills")
+	before := sampleCount(t, histogram)
+	ObserveWrite("INSERT INTO order_fills (a) VALUES ($1)", 3*time.Millisecond)
+	require.Equal(t, before+1, sampleCount(t, histogram))
+}
+
+// TestObserveRows tests that inserts count the rows they wrote and those
+// already stored, that a statement writing several rows counts each, and
+// that statements whose command tag is that of a later command are not
+// counted.
+func TestObserveRows(t *testing.T) {
+	inserted := RowsInserted.WithLabelValues("collateral_transfers")
+	duplicate := RowsDuplicate.WithLabelValues("collateral_transfers")
+	skips := ConflictSkips.WithLabelValues("collateral_transfers")
+	beforeInserted, beforeDuplicate, beforeSkips := testutil.ToFloat64(inserted), testutil.ToFloat64(duplicate), testutil.ToFloat64(skips)
+
+	insert := "INSERT INTO collateral_transfers (a) VALUES ($1) ON CONFLICT (a) DO NOTHING"
+	ObserveRows(insert, pgconn.NewCommandTag("INSERT 0 1"), 0)
+	require.Equal(t, beforeInserted+1, testutil.ToFloat64(inserted))
+	require.Equal(t, beforeDuplicate, testutil.ToFloat64(duplicate))
+	require.Equal(t, beforeSkips, testutil.ToFloat64(skips))
+	ObserveRows(insert, pgconn.NewCommandTag("INSERT 0 0"), 0)
+	require.Equal(t, beforeInserted+1, testutil.ToFloat64(inserted))
+	require.Equal(t, beforeDuplicate+1, testutil.ToFloat64(duplicate))
+	require.Equal(t, beforeSkips+1, testutil.ToFloat64(skips))
+
+	cte := "WITH upserted AS (INSERT INTO collateral_transfers (a) VALUES ($1) RETURNING a) SELECT 1 FROM upserted"
+	ObserveRows(cte, pgconn.NewCommandTag("SELECT 0"), 0)
+	require.Equal(t, beforeInserted+1, testutil.ToFloat64(inserted))
+	require.Equal(t, beforeDuplicate+1, testutil.ToFloat64(duplicate))
+
+	// A statement of three rows, one of them new
+	ObserveRows(cte, pgconn.NewCommandTag("SELECT 1"), 3)
+	require.Equal(t, beforeInserted+2, testutil.ToFloat64(inserted))
+	require.Equal(t, beforeDuplicate+3, testutil.ToFloat64(duplicate))
+	require.Equal(t, beforeSkips+1, testutil.ToFloat64(skips), "skips count single-row inserts")
+}
+
+// fakeConsumerInfo reports a fixed consumer state, or an error.
+type fakeConsumerInfo struct {
+	info *jetstream.ConsumerInfo
+	err  error
+}
+
+func (f *fakeConsumerInfo) Info(context.Context) (*jetstream.ConsumerInfo, error) {
+	return f.info, f.err
+}
+
+// TestUpdatePending tests that the pending gauges follow the consumer's state
+// and keep their value when it cannot be read.
+func TestUpdatePending(t *testing.T) {
+	c := &fakeConsumerInfo{info: &jetstream.ConsumerInfo{NumPending: 1200, NumAckPending: 35}}
+	updatePending(context.Background(), c, zerolog.Nop())
+	require.Equal(t, float64(1200), testutil.ToFloat64(PendingMessages))
+	require.Equal(t, float64(35), testutil.ToFloat64(AckPendingMessages))
+
+	c.err = errors.New("nats: timeout")
+	updatePending(context.Background(), c, zerolog.Nop())
+	require.Equal(t, float64(1200), testutil.ToFloat64(PendingMessages))
+}
+
+// TestMonitorPending tests that the pending gauges are set when monitoring
+// starts and that monitoring stops with its context.
+func TestMonitorPending(t *testing.T) {
+	c := &fakeConsumerInfo{info: &jetstream.ConsumerInfo{NumPending: 7}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		MonitorPending(ctx, c, time.Hour, zerolog.Nop())
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(PendingMessages) == 7
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
@@ -0,0 +1,38 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// PayloadAs decodes the payload of an event into its type T. Payloads are
+// json.RawMessage when consumed as JSON or read back from the events table,
+// and T itself when decoded from protobuf; integers wider than a float64
+// survive either way. Other values are converted through JSON.
+func PayloadAs[T any](event models.Event) (T, error) {
+	var payload T
+	switch p := event.Payload.(type) {
+	case T:
+		return p, nil
+	case *T:
+		if p != nil {
+			return *p, nil
+		}
+	case nil:
+	case json.RawMessage:
+		if err := json.Unmarshal(p, &payload); err != nil {
+			return payload, Permanent(fmt.Errorf("failed to decode %T payload: %w", payload, err))
+		}
+	default:
+		data, err := json.Marshal(p)
+		if err != nil {
+			return payload, Permanent(fmt.Errorf("failed to encode %T payload: %w", p, err))
+		}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return payload, Permanent(fmt.Errorf("failed to decode %T payload: %w", payload, err))
+		}
+	}
+	return payload, nil
+}
@@ -0,0 +1,67 @@
+package consumer
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Integers at the top of the uint256 range, beyond float64 precision.
+var (
+	twoTo255   = new(big.Int).Lsh(big.NewInt(1), 255)
+	maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+)
+
+// wideFill returns an OrderFilled payload whose integers need 256 bits.
+func wideFill() models.OrderFilled {
+	return models.OrderFilled{
+		OrderHash:         "0x" + strings.Repeat("0a", 32),
+		Maker:             "0x1111111111111111111111111111111111111111",
+		Taker:             "0x2222222222222222222222222222222222222222",
+		MakerAssetID:      big.NewInt(0),
+		TakerAssetID:      twoTo255,
+		MakerAmountFilled: maxUint256,
+		TakerAmountFilled: new(big.Int).Add(twoTo255, big.NewInt(1)),
+		Fee:               big.NewInt(0),
+	}
+}
+
+// TestPayloadAsWideIntegers tests that 256-bit integers decode unchanged
+// from every codec, and from payloads of other types converted through
+// JSON.
+func TestPayloadAsWideIntegers(t *testing.T) {
+	fill := wideFill()
+	for _, c := range []codec.Codec{codec.JSON, codec.Protobuf} {
+		data, err := c.Marshal(models.Event{EventName: events.OrderFilled, Payload: fill})
+		require.NoError(t, err)
+
+		var event models.Event
+		require.NoError(t, c.Unmarshal(data, &event))
+		decoded, err := PayloadAs[models.OrderFilled](event)
+		require.NoError(t, err, c.Name())
+		require.Equal(t, fill, decoded, c.Name())
+	}
+
+	decoded, err := PayloadAs[models.OrderFilled](models.Event{Payload: &fill})
+	require.NoError(t, err)
+	require.Equal(t, fill, decoded)
+
+	transfer, err := PayloadAs[models.ERC20Transfer](models.Event{Payload: map[string]any{"value": json.Number(maxUint256.String())}})
+	require.NoError(t, err)
+	require.Equal(t, maxUint256, transfer.Value)
+}
+
+// TestPayloadAsRejectsMalformed tests that a payload that does not decode
+// into its type is a permanent failure.
+func TestPayloadAsRejectsMalformed(t *testing.T) {
+	_, err := PayloadAs[models.OrderFilled](models.Event{Payload: json.RawMessage(`{"fee": "ten"}`)})
+	require.Error(t, err)
+	require.True(t, IsPermanent(err))
+}
@@ -0,0 +1,230 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Message is a consumed message and the event it carries.
+type Message struct {
+	Msg       jetstream.Msg
+	EventType string
+	Event     models.Event
+
+	// Quarantine is set for malformed events, set aside in place of their
+	// rows
+	Quarantine *store.Quarantined
+}
+
+// Processor decodes consumed messages and writes their events to a
+// store.Store.
+type Processor struct {
+	accepted map[codec.SchemaVersion]bool
+}
+
+// NewProcessor returns a Processor handling messages of the given schema
+// versions. Messages of other versions, such as the second copy of every
+// event while the indexer publishes two versions, are skipped.
+func NewProcessor(versions ...codec.SchemaVersion) *Processor {
+	accepted := make(map[codec.SchemaVersion]bool, len(versions))
+	for _, version := range versions {
+		accepted[version] = true
+	}
+	return &Processor{accepted: accepted}
+}
+
+// Process decodes a message and writes its event to s in one transaction,
+// or quarantines it when it is malformed. It returns nil for messages that
+// are skipped.
+func (p *Processor) Process(ctx context.Context, msg jetstream.Msg, s store.Store, logger zerolog.Logger) (*Message, error) {
+	m, err := p.Decode(msg, logger)
+	if err != nil || m == nil {
+		return m, err
+	}
+
+	if m.Quarantine != nil {
+		if err := s.Quarantine(ctx, *m.Quarantine); err != nil {
+			return nil, fmt.Errorf("failed to quarantine event: %w", err)
+		}
+		return m, nil
+	}
+
+	if err := store.StoreEvent(ctx, s, m.EventType, m.Event); err != nil {
+		return nil, fmt.Errorf("failed to store event: %w", err)
+	}
+	return m, nil
+}
+
+// Decode decodes and validates a message without storing it. It returns nil
+// for messages that are skipped, and malformed events with their
+// Quarantine set.
+func (p *Processor) Decode(msg jetstream.Msg, logger zerolog.Logger) (*Message, error) {
+	// Dead letters share the stream but are not events
+	if reason := msg.Headers().Get(codec.HeaderDeadLetter); reason != "" {
+		DeadLettersSkipped.WithLabelValues(reason).Inc()
+		logger.Warn().
+			Str("subject", msg.Subject()).
+			Str("reason", reason).
+			Msg("skipping dead letter")
+		return nil, nil
+	}
+
+	version, ok := p.acceptSchema(msg.Headers())
+	if !ok {
+		logger.Debug().
+			Str("subject", msg.Subject()).
+			Str("version", msg.Headers().Get(codec.HeaderSchemaVersion)).
+			Msg("skipping message of unaccepted schema version")
+		return nil, nil
+	}
+
+	// Account for the message from its headers when present, so it is counted
+	// even if its payload cannot be decoded
+	meta, fromHeaders := codec.MetadataFromHeaders(msg.Headers())
+	if fromHeaders {
+		recordConsumed(meta)
+	}
+
+	// Parse event with the encoding it was published with; messages without
+	// a Content-Type header are JSON, and without a Content-Encoding header
+	// uncompressed
+	eventCodec, err := codec.ForContentType(msg.Headers().Get(codec.HeaderContentType))
+	if err != nil {
+		return nil, err
+	}
+	data, err := codec.Decompress(msg.Headers().Get(codec.HeaderContentEncoding), msg.Data())
+	if err != nil {
+		return nil, err
+	}
+	// Every schema version still shares the v1 payload; only their subjects
+	// differ
+	var event models.Event
+	if err := eventCodec.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s event: %w", eventCodec.Name(), err)
+	}
+	// Events published before addresses were normalized may still carry
+	// checksummed addresses
+	event.ContractAddr = models.NormalizeAddress(event.ContractAddr)
+
+	// Events published before they carried their name are named by their
+	// subject, so they are dispatched, stored and counted under it
+	if event.EventName == "" {
+		event.EventName = subjectEventName(msg.Subject(), version)
+	}
+
+	// Messages published before the metadata headers are accounted here
+	if !fromHeaders {
+		recordConsumed(codec.MetadataOf(event, 0))
+	}
+
+	// Dispatch on the name set by the indexer; names outside the pkg/events
+	// registry (runtime ABI contracts) are only stored as raw events
+	eventType := eventLabel(event.EventName)
+	m := &Message{Msg: msg, EventType: eventType, Event: event}
+
+	// Malformed events are set aside instead of being written zero-filled
+	if verr := validateEvent(eventType, event); verr != nil {
+		m.Quarantine, err = quarantined(msg, eventCodec, data, eventType, event, verr)
+		if err != nil {
+			return nil, err
+		}
+		logger.Warn().
+			Str("subject", msg.Subject()).
+			Str("event", eventType).
+			Str("tx", event.TxHash).
+			Uint("log_index", event.LogIndex).
+			Str("reason", verr.reason).
+			Str("detail", verr.detail).
+			Msg("quarantining malformed event")
+		return m, nil
+	}
+
+	logger.Debug().
+		Str("event", eventType).
+		Uint64("block", event.Block).
+		Str("tx", event.TxHash).
+		Msg("processing event")
+
+	return m, nil
+}
+
+// quarantined returns the malformed event of a message as it is set aside.
+// raw is the decompressed payload, kept as published when it is JSON.
+func quarantined(msg jetstream.Msg, eventCodec codec.Codec, raw []byte, eventType string, event models.Event, verr *validationError) (*store.Quarantined, error) {
+	if eventCodec.ContentType() != codec.ContentTypeJSON {
+		var err error
+		if raw, err = json.Marshal(event); err != nil {
+			return nil, fmt.Errorf("failed to marshal quarantined event: %w", err)
+		}
+	}
+
+	q := &store.Quarantined{
+		Subject:   msg.Subject(),
+		EventType: eventType,
+		Reason:    verr.reason,
+		Detail:    verr.detail,
+		Event:     event,
+		Raw:       raw,
+	}
+	if meta, err := msg.Metadata(); err == nil {
+		q.Sequence = &meta.Sequence.Stream
+	}
+	return q, nil
+}
+
+// acceptSchema returns the schema version of a message and whether the
+// processor handles it. Messages without a PM-Schema-Version header are v1;
+// skipped messages are counted.
+func (p *Processor) acceptSchema(h nats.Header) (codec.SchemaVersion, bool) {
+	value := h.Get(codec.HeaderSchemaVersion)
+	version, err := codec.ParseSchemaVersion(value)
+	if err != nil {
+		SchemaSkipped.WithLabelValues("unknown").Inc()
+		return 0, false
+	}
+	if !p.accepted[version] {
+		SchemaSkipped.WithLabelValues(version.String()).Inc()
+		return version, false
+	}
+	return version, true
+}
+
+// recordConsumed updates the consumption metrics of a message.
+func recordConsumed(meta codec.Metadata) {
+	EventsConsumed.WithLabelValues(eventLabel(meta.EventName)).Inc()
+	LastConsumedBlock.Set(float64(meta.Block))
+}
+
+// eventLabel returns the event type label of an event name.
+func eventLabel(eventName string) string {
+	if eventName == "" {
+		return "Unknown"
+	}
+	return eventName
+}
+
+// subjectEventName returns the event name segment of a subject published
+// in a schema version ({prefix}.{EventName}.{contract} in v1,
+// {prefix}.{version}.{EventName}.{contract} after), or "" if the subject
+// has none.
+func subjectEventName(subject string, version codec.SchemaVersion) string {
+	name := 1
+	if version != codec.SchemaV1 {
+		name = 2
+	}
+	tokens := strings.SplitN(subject, ".", name+2)
+	if len(tokens) < name+2 {
+		return ""
+	}
+	return tokens[name]
+}
@@ -0,0 +1,201 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// testMsg is a JetStream message carrying data on subject.
+type testMsg struct {
+	jetstream.Msg
+	subject  string
+	header   nats.Header
+	data     []byte
+	sequence uint64 // Stream sequence, zero makes Metadata fail
+}
+
+func (m *testMsg) Subject() string      { return m.subject }
+func (m *testMsg) Headers() nats.Header { return m.header }
+func (m *testMsg) Data() []byte         { return m.data }
+
+func (m *testMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	if m.sequence == 0 {
+		return nil, jetstream.ErrNotJSMessage
+	}
+	return &jetstream.MsgMetadata{Sequence: jetstream.SequencePair{Stream: m.sequence}}, nil
+}
+
+// jsonMsg returns a message carrying event as JSON on its v1 subject.
+func jsonMsg(t *testing.T, event models.Event) *testMsg {
+	t.Helper()
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	return &testMsg{subject: "POLYMARKET." + event.EventName + ".0xab", header: nats.Header{}, data: data}
+}
+
+// TestRecordConsumed tests that consumption metrics are labelled from the
+// message metadata, with unnamed events counted as Unknown.
+func TestRecordConsumed(t *testing.T) {
+	filled := testutil.ToFloat64(EventsConsumed.WithLabelValues(events.OrderFilled))
+	unknown := testutil.ToFloat64(EventsConsumed.WithLabelValues("Unknown"))
+
+	recordConsumed(codec.Metadata{EventName: events.OrderFilled, Block: 65000000})
+	require.Equal(t, filled+1, testutil.ToFloat64(EventsConsumed.WithLabelValues(events.OrderFilled)))
+	require.Equal(t, float64(65000000), testutil.ToFloat64(LastConsumedBlock))
+
+	recordConsumed(codec.MetadataOf(models.Event{Block: 65000001}, 0))
+	require.Equal(t, unknown+1, testutil.ToFloat64(EventsConsumed.WithLabelValues("Unknown")))
+	require.Equal(t, float64(65000001), testutil.ToFloat64(LastConsumedBlock))
+}
+
+// TestSubjectEventName tests that the event name is read from the subject
+// layout of each schema version.
+func TestSubjectEventName(t *testing.T) {
+	contract := ".0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e"
+	require.Equal(t, events.OrderFilled, subjectEventName("POLYMARKET."+events.OrderFilled+contract, codec.SchemaV1))
+	require.Equal(t, events.OrderFilled, subjectEventName("POLYMARKET.v2."+events.OrderFilled+contract, codec.SchemaV2))
+	require.Empty(t, subjectEventName("POLYMARKET."+events.OrderFilled, codec.SchemaV1))
+	require.Empty(t, subjectEventName("POLYMARKET.v2."+events.OrderFilled, codec.SchemaV2))
+	require.Empty(t, subjectEventName("", codec.SchemaV1))
+}
+
+// TestDecodeWithoutEventName tests that events published before they
+// carried their name are dispatched and counted under the name in their
+// subject, in every schema version.
+func TestDecodeWithoutEventName(t *testing.T) {
+	p := NewProcessor(codec.SchemaV1, codec.SchemaV2)
+
+	event := models.Event{
+		TxHash:  storetest.TxHash,
+		Success: true,
+		Payload: storetest.Payloads[events.TransferSingle],
+	}
+	for _, version := range []codec.SchemaVersion{codec.SchemaV1, codec.SchemaV2} {
+		t.Run(version.String(), func(t *testing.T) {
+			msg := jsonMsg(t, event)
+			msg.subject = "POLYMARKET." + events.TransferSingle + ".0xab"
+			if version != codec.SchemaV1 {
+				msg.subject = "POLYMARKET." + version.String() + "." + events.TransferSingle + ".0xab"
+				msg.header.Set(codec.HeaderSchemaVersion, version.String())
+			}
+			consumed := testutil.ToFloat64(EventsConsumed.WithLabelValues(events.TransferSingle))
+
+			m, err := p.Decode(msg, zerolog.Nop())
+			require.NoError(t, err)
+			require.NotNil(t, m)
+			require.Nil(t, m.Quarantine)
+			require.Equal(t, events.TransferSingle, m.EventType)
+			require.Equal(t, events.TransferSingle, m.Event.EventName)
+			require.Equal(t, consumed+1, testutil.ToFloat64(EventsConsumed.WithLabelValues(events.TransferSingle)))
+		})
+	}
+
+	// A named event keeps its name whatever its subject
+	event.EventName = events.TransferSingle
+	msg := jsonMsg(t, event)
+	msg.subject = "POLYMARKET." + events.OrderFilled + ".0xab"
+	m, err := p.Decode(msg, zerolog.Nop())
+	require.NoError(t, err)
+	require.Equal(t, events.TransferSingle, m.EventType)
+}
+
+// TestAcceptSchema tests that messages without a schema header are v1, that
+// only accepted versions are handled and that skipped ones are counted.
+func TestAcceptSchema(t *testing.T) {
+	p := NewProcessor(codec.SchemaV2)
+
+	header := nats.Header{}
+	header.Set(codec.HeaderSchemaVersion, "v2")
+	version, ok := p.acceptSchema(header)
+	require.True(t, ok)
+	require.Equal(t, codec.SchemaV2, version)
+
+	skipped := testutil.ToFloat64(SchemaSkipped.WithLabelValues("v1"))
+	_, ok = p.acceptSchema(nats.Header{})
+	require.False(t, ok)
+	require.Equal(t, skipped+1, testutil.ToFloat64(SchemaSkipped.WithLabelValues("v1")))
+
+	unknown := testutil.ToFloat64(SchemaSkipped.WithLabelValues("unknown"))
+	header.Set(codec.HeaderSchemaVersion, "v9")
+	_, ok = p.acceptSchema(header)
+	require.False(t, ok)
+	require.Equal(t, unknown+1, testutil.ToFloat64(SchemaSkipped.WithLabelValues("unknown")))
+}
+
+// TestProcessStoresEvent tests that a message is stored in one transaction
+// of the store, and that nothing is left of an event whose rows failed.
+func TestProcessStoresEvent(t *testing.T) {
+	p := NewProcessor(codec.SchemaV1)
+	event := storetest.TransferEvent(3, storetest.WalletA, storetest.WalletB, 77, 5)
+
+	var s storetest.Memory
+	m, err := p.Process(context.Background(), jsonMsg(t, event), &s, zerolog.Nop())
+	require.NoError(t, err)
+	require.Equal(t, events.TransferSingle, m.EventType)
+	require.Equal(t, []string{"StoreRawEvent", "StoreTokenTransfer", "RecordPositionChanges", "MarkProcessed"}, methods(s.Calls()))
+
+	failing := storetest.Memory{Fail: map[string]bool{"RecordPositionChanges": true}}
+	m, err = p.Process(context.Background(), jsonMsg(t, event), &failing, zerolog.Nop())
+	require.ErrorContains(t, err, "failed to store event")
+	require.Nil(t, m)
+	require.Empty(t, failing.Calls())
+}
+
+// TestProcessQuarantines tests that a malformed event is quarantined in
+// place of its rows, with the payload as published.
+func TestProcessQuarantines(t *testing.T) {
+	payload := storetest.Payloads[events.TransferBatch].(models.TransferBatch)
+	payload.Amounts = payload.Amounts[:1]
+	msg := jsonMsg(t, models.Event{
+		Block:     100,
+		EventName: events.TransferBatch,
+		TxHash:    storetest.TxHash,
+		LogIndex:  7,
+		Success:   true,
+		Payload:   payload,
+	})
+	msg.sequence = 42
+
+	var s storetest.Memory
+	m, err := NewProcessor(codec.SchemaV1).Process(context.Background(), msg, &s, zerolog.Nop())
+	require.NoError(t, err)
+	require.NotNil(t, m.Quarantine)
+	require.Equal(t, []string{"Quarantine"}, methods(s.Calls()))
+
+	q := s.Quarantined()
+	require.Len(t, q, 1)
+	require.Equal(t, msg.subject, q[0].Subject)
+	require.Equal(t, uint64(42), *q[0].Sequence)
+	require.Equal(t, events.TransferBatch, q[0].EventType)
+	require.Equal(t, reasonLengthMismatch, q[0].Reason)
+	require.Equal(t, "2 token_ids and 1 amounts", q[0].Detail)
+	require.Equal(t, uint(7), q[0].Event.LogIndex)
+	require.Equal(t, msg.data, q[0].Raw)
+
+	// Without metadata the stream sequence is unknown
+	msg.sequence = 0
+	m, err = NewProcessor(codec.SchemaV1).Decode(msg, zerolog.Nop())
+	require.NoError(t, err)
+	require.Nil(t, m.Quarantine.Sequence)
+}
+
+// methods returns the methods of calls, in order.
+func methods(calls []storetest.Call) []string {
+	out := make([]string, len(calls))
+	for i, c := range calls {
+		out[i] = c.Method
+	}
+	return out
+}
@@ -0,0 +1,205 @@
+package consumer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Validation failure reasons, the reason label of
+// polymarket_consumer_quarantined_total.
+const (
+	reasonInvalidPayload = "invalid_payload" // Does not decode into its event type
+	reasonMissingField   = "missing_field"   // Empty string or absent number
+	reasonInvalidHash    = "invalid_hash"    // Not hex of at most 32 bytes
+	reasonInvalidAddress = "invalid_address" // Not a 20 byte hex address
+	reasonNegativeAmount = "negative_amount"
+	reasonLengthMismatch = "length_mismatch" // Parallel arrays of different lengths
+	reasonInvalidPayouts = "invalid_payouts" // See models.ValidatePayouts
+)
+
+// validationError is a malformed event, quarantined instead of stored.
+type validationError struct {
+	reason string
+	detail string
+}
+
+func (e *validationError) Error() string {
+	return e.reason + ": " + e.detail
+}
+
+// payloadCheck collects the first validation failure of an event.
+type payloadCheck struct {
+	err *validationError
+}
+
+func (c *payloadCheck) fail(reason, format string, args ...any) {
+	if c.err == nil {
+		c.err = &validationError{reason: reason, detail: fmt.Sprintf(format, args...)}
+	}
+}
+
+// hash checks a bytes32 field. Short values ("0x0") are accepted, as they
+// are padded by models.NormalizeHash.
+func (c *payloadCheck) hash(field, value string) {
+	if value == "" {
+		c.fail(reasonMissingField, "%s", field)
+		return
+	}
+	digits := strings.TrimPrefix(strings.ToLower(value), "0x")
+	if len(digits)%2 == 1 {
+		digits = "0" + digits
+	}
+	if b, err := hex.DecodeString(digits); err != nil || len(b) > common.HashLength {
+		c.fail(reasonInvalidHash, "%s %q", field, value)
+	}
+}
+
+func (c *payloadCheck) address(field, value string) {
+	if value == "" {
+		c.fail(reasonMissingField, "%s", field)
+		return
+	}
+	if !common.IsHexAddress(value) {
+		c.fail(reasonInvalidAddress, "%s %q", field, value)
+	}
+}
+
+func (c *payloadCheck) amount(field string, value *big.Int) {
+	if value == nil {
+		c.fail(reasonMissingField, "%s", field)
+		return
+	}
+	if value.Sign() < 0 {
+		c.fail(reasonNegativeAmount, "%s %s", field, value)
+	}
+}
+
+func (c *payloadCheck) amounts(field string, values []*big.Int) {
+	if len(values) == 0 {
+		c.fail(reasonMissingField, "%s", field)
+		return
+	}
+	for i, value := range values {
+		c.amount(fmt.Sprintf("%s[%d]", field, i), value)
+	}
+}
+
+// validateFunc checks the payload of an event type.
+type validateFunc func(c *payloadCheck, event models.Event)
+
+// validator decodes a payload into T, as its store function does, and
+// checks it.
+func validator[T any](check func(c *payloadCheck, p T)) validateFunc {
+	return func(c *payloadCheck, event models.Event) {
+		p, err := PayloadAs[T](event)
+		if err != nil {
+			c.fail(reasonInvalidPayload, "%v", err)
+			return
+		}
+		check(c, p)
+	}
+}
+
+// payloadValidators checks the fields every event type's store function
+// writes. Events without one (runtime ABI contracts) are only stored raw
+// and checked for their envelope alone.
+var payloadValidators = map[string]validateFunc{
+	events.OrderFilled: validator(func(c *payloadCheck, p models.OrderFilled) {
+		c.hash("order_hash", p.OrderHash)
+		c.address("maker", p.Maker)
+		c.address("taker", p.Taker)
+		c.amount("maker_asset_id", p.MakerAssetID)
+		c.amount("taker_asset_id", p.TakerAssetID)
+		c.amount("maker_amount_filled", p.MakerAmountFilled)
+		c.amount("taker_amount_filled", p.TakerAmountFilled)
+		c.amount("fee", p.Fee)
+	}),
+	events.OrderCancelled: validator(func(c *payloadCheck, p models.OrderCancelled) {
+		c.hash("order_hash", p.OrderHash)
+	}),
+	events.TokenRegistered: validator(func(c *payloadCheck, p models.TokenRegistered) {
+		c.amount("token0", p.Token0)
+		c.amount("token1", p.Token1)
+		c.hash("condition_id", p.ConditionID)
+	}),
+	events.TransferSingle: validator(func(c *payloadCheck, p models.TransferSingle) {
+		c.address("operator", p.Operator)
+		c.address("from", p.From)
+		c.address("to", p.To)
+		c.amount("token_id", p.TokenID)
+		c.amount("amount", p.Amount)
+	}),
+	events.TransferBatch: validator(func(c *payloadCheck, p models.TransferBatch) {
+		c.address("operator", p.Operator)
+		c.address("from", p.From)
+		c.address("to", p.To)
+		c.amounts("token_ids", p.TokenIDs)
+		c.amounts("amounts", p.Amounts)
+		if len(p.TokenIDs) != len(p.Amounts) {
+			c.fail(reasonLengthMismatch, "%d token_ids and %d amounts", len(p.TokenIDs), len(p.Amounts))
+		}
+	}),
+	events.ERC20Transfer: validator(func(c *payloadCheck, p models.ERC20Transfer) {
+		c.address("token", p.Token)
+		c.address("from", p.From)
+		c.address("to", p.To)
+		c.amount("value", p.Value)
+	}),
+	events.ConditionPreparation: validator(func(c *payloadCheck, p models.ConditionPreparation) {
+		c.hash("condition_id", p.ConditionID)
+		c.address("oracle", p.Oracle)
+		c.hash("question_id", p.QuestionID)
+	}),
+	events.ConditionResolution: validator(func(c *payloadCheck, p models.ConditionResolution) {
+		c.hash("condition_id", p.ConditionID)
+		c.address("oracle", p.Oracle)
+		c.hash("question_id", p.QuestionID)
+		if err := models.ValidatePayouts(uint64(p.OutcomeSlotCount), p.PayoutNumerators); err != nil {
+			c.fail(reasonInvalidPayouts, "%v", err)
+		}
+	}),
+	events.PositionSplit: validator(func(c *payloadCheck, p models.PositionSplit) {
+		c.address("stakeholder", p.Stakeholder)
+		c.address("collateral_token", p.CollateralToken)
+		c.hash("parent_collection_id", p.ParentCollectionID)
+		c.hash("condition_id", p.ConditionID)
+		c.amounts("partition", p.Partition)
+		c.amount("amount", p.Amount)
+	}),
+	events.PositionsMerge: validator(func(c *payloadCheck, p models.PositionsMerge) {
+		c.address("stakeholder", p.Stakeholder)
+		c.address("collateral_token", p.CollateralToken)
+		c.hash("parent_collection_id", p.ParentCollectionID)
+		c.hash("condition_id", p.ConditionID)
+		c.amounts("partition", p.Partition)
+		c.amount("amount", p.Amount)
+	}),
+	events.PayoutRedemption: validator(func(c *payloadCheck, p models.PayoutRedemption) {
+		c.address("redeemer", p.Redeemer)
+		c.address("collateral_token", p.CollateralToken)
+		c.hash("parent_collection_id", p.ParentCollectionID)
+		c.hash("condition_id", p.ConditionID)
+		c.amounts("index_sets", p.IndexSets)
+		c.amount("payout", p.Payout)
+	}),
+}
+
+// validateEvent checks a decoded event before it is stored: the keys every
+// row is written under, then the payload of its type. Payloads missing a
+// field would otherwise be written zero-filled, an empty maker or an
+// amount of "<nil>".
+func validateEvent(eventType string, event models.Event) *validationError {
+	var c payloadCheck
+	c.hash("tx_hash", event.TxHash)
+	if check, ok := payloadValidators[eventType]; ok && c.err == nil {
+		check(&c, event)
+	}
+	return c.err
+}
@@ -0,0 +1,91 @@
+package consumer
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestValidateEventAcceptsPayloads tests that the payload stored for every
+// registered event, and events of unregistered contracts, pass validation.
+func TestValidateEventAcceptsPayloads(t *testing.T) {
+	for _, def := range events.All() {
+		payload, ok := storetest.Payloads[def.Name]
+		require.True(t, ok, "no schema test payload for %s", def.Name)
+		event := models.Event{TxHash: storetest.TxHash, EventName: def.Name, Payload: payload}
+		require.Nil(t, validateEvent(def.Name, event), def.Name)
+	}
+
+	unknown := models.Event{TxHash: storetest.TxHash, Payload: map[string]any{"anything": 1}}
+	require.Nil(t, validateEvent("Custom", unknown))
+}
+
+// TestValidateEventRejects tests the reason malformed events are rejected
+// with.
+func TestValidateEventRejects(t *testing.T) {
+	fill := storetest.Payloads[events.OrderFilled].(models.OrderFilled)
+	noMaker := fill
+	noMaker.Maker = ""
+	badTaker := fill
+	badTaker.Taker = "0x1234"
+	noAmount := fill
+	noAmount.MakerAmountFilled = nil
+	negativeFee := fill
+	negativeFee.Fee = big.NewInt(-1)
+
+	batch := storetest.Payloads[events.TransferBatch].(models.TransferBatch)
+	shortAmounts := batch
+	shortAmounts.Amounts = batch.Amounts[:1]
+	nilTokenID := batch
+	nilTokenID.TokenIDs = []*big.Int{big.NewInt(1), nil}
+
+	resolution := storetest.Payloads[events.ConditionResolution].(models.ConditionResolution)
+	zeroPayouts := resolution
+	zeroPayouts.PayoutNumerators = []*big.Int{big.NewInt(0), big.NewInt(0)}
+
+	registration := storetest.Payloads[events.TokenRegistered].(models.TokenRegistered)
+	longCondition := registration
+	longCondition.ConditionID = "0x" + strings.Repeat("0c", 33)
+
+	tests := []struct {
+		name      string
+		eventType string
+		txHash    string
+		payload   any
+		reason    string
+	}{
+		{"missing tx hash", events.OrderFilled, "", fill, reasonMissingField},
+		{"malformed tx hash", events.OrderFilled, "0xzz", fill, reasonInvalidHash},
+		{"missing maker", events.OrderFilled, storetest.TxHash, noMaker, reasonMissingField},
+		{"short taker", events.OrderFilled, storetest.TxHash, badTaker, reasonInvalidAddress},
+		{"missing amount", events.OrderFilled, storetest.TxHash, noAmount, reasonMissingField},
+		{"negative fee", events.OrderFilled, storetest.TxHash, negativeFee, reasonNegativeAmount},
+		{"amount of another type", events.OrderFilled, storetest.TxHash, map[string]any{"fee": "ten"}, reasonInvalidPayload},
+		{"batch lengths", events.TransferBatch, storetest.TxHash, shortAmounts, reasonLengthMismatch},
+		{"batch nil token", events.TransferBatch, storetest.TxHash, nilTokenID, reasonMissingField},
+		{"zero payouts", events.ConditionResolution, storetest.TxHash, zeroPayouts, reasonInvalidPayouts},
+		{"long condition id", events.TokenRegistered, storetest.TxHash, longCondition, reasonInvalidHash},
+		{"empty cancellation", events.OrderCancelled, storetest.TxHash, map[string]any{}, reasonMissingField},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verr := validateEvent(tt.eventType, models.Event{TxHash: tt.txHash, Payload: tt.payload})
+			require.NotNil(t, verr)
+			require.Equal(t, tt.reason, verr.reason, verr.Error())
+		})
+	}
+}
+
+// TestValidateShortHash tests that short bytes32 values, padded when
+// stored, are accepted.
+func TestValidateShortHash(t *testing.T) {
+	var c payloadCheck
+	c.hash("parent_collection_id", "0x0")
+	require.Nil(t, c.err)
+}
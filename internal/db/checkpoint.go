@@ -4,6 +4,7 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -14,9 +15,13 @@ import (
 const (
 	// checkpointBucket is the BoltDB bucket name for storing checkpoints
 	checkpointBucket = "checkpoints"
+
+	// contractsBucket is the BoltDB bucket name for contracts added at runtime
+	contractsBucket = "contracts"
 )
 
-// CheckpointDB provides checkpoint persistence using BoltDB.
+// CheckpointDB provides checkpoint persistence using BoltDB. It also holds
+// the contracts registered at runtime, whatever the checkpoint backend.
 type CheckpointDB struct {
 	db *bbolt.DB
 }
@@ -30,9 +35,12 @@ func NewCheckpointDB(dbPath string) (*CheckpointDB, error) {
 		return nil, fmt.Errorf("failed to open checkpoint db: %w", err)
 	}
 
-	// Create bucket if it doesn't exist
+	// Create buckets if they don't exist
 	err = db.Update(func(tx *bbolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(checkpointBucket))
+		if _, err := tx.CreateBucketIfNotExists([]byte(checkpointBucket)); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists([]byte(contractsBucket))
 		return err
 	})
 	if err != nil {
@@ -43,83 +51,182 @@ func NewCheckpointDB(dbPath string) (*CheckpointDB, error) {
 	return &CheckpointDB{db: db}, nil
 }
 
-// SaveCheckpoint saves or updates a checkpoint for a service.
-func (c *CheckpointDB) SaveCheckpoint(ctx context.Context, checkpoint models.Checkpoint) error {
-	checkpoint.UpdatedAt = time.Now()
+var _ CheckpointStore = (*CheckpointDB)(nil)
 
+// Save saves or updates a checkpoint for a service.
+func (c *CheckpointDB) Save(ctx context.Context, checkpoint models.Checkpoint) error {
 	return c.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(checkpointBucket))
-		if b == nil {
-			return fmt.Errorf("checkpoint bucket not found")
-		}
-
-		data, err := json.Marshal(checkpoint)
-		if err != nil {
-			return fmt.Errorf("failed to marshal checkpoint: %w", err)
-		}
-
-		return b.Put([]byte(checkpoint.ServiceName), data)
+		return putCheckpoint(tx, checkpoint)
 	})
 }
 
 // GetCheckpoint retrieves a checkpoint for a service.
 func (c *CheckpointDB) GetCheckpoint(ctx context.Context, serviceName string) (*models.Checkpoint, error) {
-	var checkpoint models.Checkpoint
+	var checkpoint *models.Checkpoint
 
 	err := c.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(checkpointBucket))
-		if b == nil {
-			return fmt.Errorf("checkpoint bucket not found")
-		}
+		var err error
+		checkpoint, err = getCheckpoint(tx, serviceName)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoint, nil
+}
+
+// GetOrCreate gets an existing checkpoint or creates a new one with the start block.
+func (c *CheckpointDB) GetOrCreate(ctx context.Context, serviceName string, startBlock uint64) (*models.Checkpoint, error) {
+	var checkpoint *models.Checkpoint
 
-		data := b.Get([]byte(serviceName))
-		if data == nil {
-			return fmt.Errorf("checkpoint not found for service: %s", serviceName)
+	err := c.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		checkpoint, err = getCheckpoint(tx, serviceName)
+		if !errors.Is(err, ErrCheckpointNotFound) {
+			return err
 		}
 
-		return json.Unmarshal(data, &checkpoint)
+		// Create new checkpoint
+		checkpoint = &models.Checkpoint{
+			ServiceName:   serviceName,
+			LastBlock:     startBlock,
+			LastBlockHash: zeroHash,
+			UpdatedAt:     time.Now(),
+		}
+		return putCheckpoint(tx, *checkpoint)
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get or create checkpoint: %w", err)
 	}
 
-	return &checkpoint, nil
+	return checkpoint, nil
 }
 
-// GetOrCreateCheckpoint gets an existing checkpoint or creates a new one with the start block.
-func (c *CheckpointDB) GetOrCreateCheckpoint(ctx context.Context, serviceName string, startBlock uint64) (*models.Checkpoint, error) {
-	checkpoint, err := c.GetCheckpoint(ctx, serviceName)
-	if err == nil {
-		return checkpoint, nil
-	}
+// UpdateBlock moves the checkpoint forward to a block number and hash.
+func (c *CheckpointDB) UpdateBlock(ctx context.Context, serviceName string, blockNumber uint64, blockHash string) error {
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		checkpoint, err := getCheckpoint(tx, serviceName)
+		if err != nil {
+			return err
+		}
+		if checkpoint.LastBlock >= blockNumber {
+			return fmt.Errorf("%w: block %d is not past block %d", ErrStaleCheckpoint, blockNumber, checkpoint.LastBlock)
+		}
+
+		checkpoint.LastBlock = blockNumber
+		checkpoint.LastBlockHash = blockHash
+		return putCheckpoint(tx, *checkpoint)
+	})
+}
+
+// Rewind moves the checkpoint back to a block number and hash.
+func (c *CheckpointDB) Rewind(ctx context.Context, serviceName string, blockNumber uint64, blockHash string) error {
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		checkpoint, err := getCheckpoint(tx, serviceName)
+		if err != nil {
+			return err
+		}
+		if checkpoint.LastBlock < blockNumber {
+			return fmt.Errorf("%w: cannot rewind block %d to block %d", ErrStaleCheckpoint, checkpoint.LastBlock, blockNumber)
+		}
 
-	// Create new checkpoint
-	checkpoint = &models.Checkpoint{
-		ServiceName:   serviceName,
-		LastBlock:     startBlock,
-		LastBlockHash: "0x0000000000000000000000000000000000000000000000000000000000000000",
-		UpdatedAt:     time.Now(),
+		checkpoint.LastBlock = blockNumber
+		checkpoint.LastBlockHash = blockHash
+		return putCheckpoint(tx, *checkpoint)
+	})
+}
+
+// getCheckpoint reads the checkpoint of a service within tx.
+func getCheckpoint(tx *bbolt.Tx, serviceName string) (*models.Checkpoint, error) {
+	b := tx.Bucket([]byte(checkpointBucket))
+	if b == nil {
+		return nil, fmt.Errorf("checkpoint bucket not found")
 	}
 
-	if err := c.SaveCheckpoint(ctx, *checkpoint); err != nil {
-		return nil, fmt.Errorf("failed to create checkpoint: %w", err)
+	data := b.Get([]byte(serviceName))
+	if data == nil {
+		return nil, fmt.Errorf("%w for service: %s", ErrCheckpointNotFound, serviceName)
 	}
 
-	return checkpoint, nil
+	var checkpoint models.Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal checkpoint: %w", err)
+	}
+	return &checkpoint, nil
 }
 
-// UpdateBlock updates just the block number and hash in the checkpoint.
-func (c *CheckpointDB) UpdateBlock(ctx context.Context, serviceName string, blockNumber uint64, blockHash string) error {
-	checkpoint, err := c.GetCheckpoint(ctx, serviceName)
+// putCheckpoint writes a checkpoint within tx, stamping its update time.
+func putCheckpoint(tx *bbolt.Tx, checkpoint models.Checkpoint) error {
+	b := tx.Bucket([]byte(checkpointBucket))
+	if b == nil {
+		return fmt.Errorf("checkpoint bucket not found")
+	}
+
+	checkpoint.UpdatedAt = time.Now()
+	data, err := json.Marshal(checkpoint)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
 	}
 
-	checkpoint.LastBlock = blockNumber
-	checkpoint.LastBlockHash = blockHash
+	return b.Put([]byte(checkpoint.ServiceName), data)
+}
+
+// SaveContract persists a contract registered at runtime, keyed by address.
+func (c *CheckpointDB) SaveContract(ctx context.Context, contract models.MonitoredContract) error {
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(contractsBucket))
+		if b == nil {
+			return fmt.Errorf("contracts bucket not found")
+		}
+
+		data, err := json.Marshal(contract)
+		if err != nil {
+			return fmt.Errorf("failed to marshal contract: %w", err)
+		}
+
+		return b.Put([]byte(contract.Address), data)
+	})
+}
+
+// DeleteContract removes a persisted runtime contract.
+func (c *CheckpointDB) DeleteContract(ctx context.Context, address string) error {
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(contractsBucket))
+		if b == nil {
+			return fmt.Errorf("contracts bucket not found")
+		}
+		return b.Delete([]byte(address))
+	})
+}
+
+// ListContracts returns all persisted runtime contracts.
+func (c *CheckpointDB) ListContracts(ctx context.Context) ([]models.MonitoredContract, error) {
+	var contracts []models.MonitoredContract
+
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(contractsBucket))
+		if b == nil {
+			return fmt.Errorf("contracts bucket not found")
+		}
+
+		return b.ForEach(func(_, data []byte) error {
+			var contract models.MonitoredContract
+			if err := json.Unmarshal(data, &contract); err != nil {
+				return fmt.Errorf("failed to unmarshal contract: %w", err)
+			}
+			contracts = append(contracts, contract)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
 
-	return c.SaveCheckpoint(ctx, *checkpoint)
+	return contracts, nil
 }
 
 // Close closes the database connection.
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// createCheckpointsTable creates the checkpoints table, kept apart from the
+// consumer's migrations so that the indexer needs no migrated database.
+const createCheckpointsTable = `
+CREATE TABLE IF NOT EXISTS checkpoints (
+	service_name    TEXT PRIMARY KEY,
+	last_block      BIGINT NOT NULL,
+	last_block_hash TEXT NOT NULL,
+	updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+)`
+
+// PostgresCheckpoints provides checkpoint persistence using PostgreSQL, for
+// indexers without a persistent local disk. Updates are conditional on the
+// stored block, so concurrent writers never move a checkpoint backward.
+type PostgresCheckpoints struct {
+	pool *pgxpool.Pool
+}
+
+var _ CheckpointStore = (*PostgresCheckpoints)(nil)
+
+// NewPostgresCheckpoints creates the checkpoints table if it does not exist
+// and returns a store using pool, which is closed with the store.
+func NewPostgresCheckpoints(ctx context.Context, pool *pgxpool.Pool) (*PostgresCheckpoints, error) {
+	if _, err := pool.Exec(ctx, createCheckpointsTable); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoints table: %w", err)
+	}
+	return &PostgresCheckpoints{pool: pool}, nil
+}
+
+// GetOrCreate gets an existing checkpoint or creates a new one with the start block.
+func (p *PostgresCheckpoints) GetOrCreate(ctx context.Context, serviceName string, startBlock uint64) (*models.Checkpoint, error) {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO checkpoints (service_name, last_block, last_block_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (service_name) DO NOTHING`,
+		serviceName, int64(startBlock), zeroHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+
+	checkpoint, err := p.get(ctx, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// UpdateBlock moves the checkpoint forward to a block number and hash.
+func (p *PostgresCheckpoints) UpdateBlock(ctx context.Context, serviceName string, blockNumber uint64, blockHash string) error {
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE checkpoints
+		SET last_block = $2, last_block_hash = $3, updated_at = NOW()
+		WHERE service_name = $1 AND last_block < $2`,
+		serviceName, int64(blockNumber), blockHash)
+	if err != nil {
+		return fmt.Errorf("failed to update checkpoint: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	checkpoint, err := p.get(ctx, serviceName)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: block %d is not past block %d", ErrStaleCheckpoint, blockNumber, checkpoint.LastBlock)
+}
+
+// Save saves or updates a checkpoint for a service.
+func (p *PostgresCheckpoints) Save(ctx context.Context, checkpoint models.Checkpoint) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO checkpoints (service_name, last_block, last_block_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (service_name) DO UPDATE
+		SET last_block = EXCLUDED.last_block,
+			last_block_hash = EXCLUDED.last_block_hash,
+			updated_at = NOW()`,
+		checkpoint.ServiceName, int64(checkpoint.LastBlock), checkpoint.LastBlockHash)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Rewind moves the checkpoint back to a block number and hash.
+func (p *PostgresCheckpoints) Rewind(ctx context.Context, serviceName string, blockNumber uint64, blockHash string) error {
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE checkpoints
+		SET last_block = $2, last_block_hash = $3, updated_at = NOW()
+		WHERE service_name = $1 AND last_block >= $2`,
+		serviceName, int64(blockNumber), blockHash)
+	if err != nil {
+		return fmt.Errorf("failed to rewind checkpoint: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	checkpoint, err := p.get(ctx, serviceName)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: cannot rewind block %d to block %d", ErrStaleCheckpoint, checkpoint.LastBlock, blockNumber)
+}
+
+// Close closes the connection pool.
+func (p *PostgresCheckpoints) Close() error {
+	p.pool.Close()
+	return nil
+}
+
+// get retrieves the checkpoint of a service.
+func (p *PostgresCheckpoints) get(ctx context.Context, serviceName string) (*models.Checkpoint, error) {
+	var (
+		checkpoint = models.Checkpoint{ServiceName: serviceName}
+		lastBlock  int64
+	)
+	err := p.pool.QueryRow(ctx, `
+		SELECT last_block, last_block_hash, updated_at
+		FROM checkpoints
+		WHERE service_name = $1`,
+		serviceName).Scan(&lastBlock, &checkpoint.LastBlockHash, &checkpoint.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w for service: %s", ErrCheckpointNotFound, serviceName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checkpoint: %w", err)
+	}
+	checkpoint.LastBlock = uint64(lastBlock)
+	return &checkpoint, nil
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+)
+
+// TestPostgresCheckpointStore tests against Postgres that the Postgres
+// checkpoint store behaves as a CheckpointStore.
+func TestPostgresCheckpointStore(t *testing.T) {
+	testCheckpointStore(t, func(t *testing.T) CheckpointStore {
+		store, err := NewPostgresCheckpoints(context.Background(), pgtest.Database(t))
+		require.NoError(t, err)
+		return store
+	})
+}
+
+// TestPostgresCheckpointsTable tests against Postgres that creating the
+// store again keeps the existing checkpoints, and that the checkpoints
+// table holds them.
+func TestPostgresCheckpointsTable(t *testing.T) {
+	pool := pgtest.Database(t)
+	ctx := context.Background()
+
+	store, err := NewPostgresCheckpoints(ctx, pool)
+	require.NoError(t, err)
+	_, err = store.GetOrCreate(ctx, "indexer", 65_000_000)
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateBlock(ctx, "indexer", 65_000_100, "0x01"))
+
+	store, err = NewPostgresCheckpoints(ctx, pool)
+	require.NoError(t, err)
+	checkpoint, err := store.GetOrCreate(ctx, "indexer", 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(65_000_100), checkpoint.LastBlock)
+
+	var (
+		lastBlock int64
+		hash      string
+	)
+	require.NoError(t, pool.QueryRow(ctx,
+		"SELECT last_block, last_block_hash FROM checkpoints WHERE service_name = 'indexer'").Scan(&lastBlock, &hash))
+	require.Equal(t, int64(65_000_100), lastBlock)
+	require.Equal(t, "0x01", hash)
+}
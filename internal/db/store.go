@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Checkpoint backends, selected by db.checkpoint_backend.
+const (
+	BackendBolt     = "bolt"
+	BackendPostgres = "postgres"
+)
+
+// zeroHash is the block hash of a checkpoint created at the start block.
+const zeroHash = "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+var (
+	// ErrCheckpointNotFound is returned for a service without a checkpoint.
+	ErrCheckpointNotFound = errors.New("checkpoint not found")
+
+	// ErrStaleCheckpoint is returned when a checkpoint is not moved because
+	// it is already past the block, such as after another writer advanced
+	// it, or before it for a rewind.
+	ErrStaleCheckpoint = errors.New("stale checkpoint")
+)
+
+// CheckpointStore persists the last block processed by each service.
+// Checkpoints only move forward through UpdateBlock, and only backward
+// through Rewind, so a writer working from an outdated checkpoint cannot
+// overwrite the progress of another.
+type CheckpointStore interface {
+	// GetOrCreate returns the checkpoint of a service, creating it at
+	// startBlock if it has none.
+	GetOrCreate(ctx context.Context, serviceName string, startBlock uint64) (*models.Checkpoint, error)
+
+	// UpdateBlock moves the checkpoint of a service forward to blockNumber.
+	// It returns ErrStaleCheckpoint if the checkpoint is not before it.
+	UpdateBlock(ctx context.Context, serviceName string, blockNumber uint64, blockHash string) error
+
+	// Save creates or replaces a checkpoint unconditionally.
+	Save(ctx context.Context, checkpoint models.Checkpoint) error
+
+	// Rewind moves the checkpoint of a service back to blockNumber, after a
+	// reorg for instance. It returns ErrStaleCheckpoint if the checkpoint is
+	// before it.
+	Rewind(ctx context.Context, serviceName string, blockNumber uint64, blockHash string) error
+
+	// Close releases the store's resources.
+	Close() error
+}
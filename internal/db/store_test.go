@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// testCheckpointStore runs the tests every CheckpointStore implementation
+// must pass against the stores returned by newStore, each one empty.
+func testCheckpointStore(t *testing.T, newStore func(t *testing.T) CheckpointStore) {
+	ctx := context.Background()
+
+	// get returns the checkpoint of a service, created at block 1 if need be
+	get := func(t *testing.T, store CheckpointStore, serviceName string) *models.Checkpoint {
+		t.Helper()
+		checkpoint, err := store.GetOrCreate(ctx, serviceName, 1)
+		require.NoError(t, err)
+		return checkpoint
+	}
+
+	t.Run("GetOrCreate", func(t *testing.T) {
+		store := newStore(t)
+
+		created, err := store.GetOrCreate(ctx, "indexer", 65_000_000)
+		require.NoError(t, err)
+		require.Equal(t, "indexer", created.ServiceName)
+		require.Equal(t, uint64(65_000_000), created.LastBlock)
+		require.Equal(t, zeroHash, created.LastBlockHash)
+		require.False(t, created.UpdatedAt.IsZero())
+
+		existing, err := store.GetOrCreate(ctx, "indexer", 1)
+		require.NoError(t, err)
+		require.Equal(t, uint64(65_000_000), existing.LastBlock, "start block ignored once created")
+		require.Equal(t, uint64(1), get(t, store, "other").LastBlock, "checkpoints kept per service")
+	})
+
+	t.Run("UpdateBlock", func(t *testing.T) {
+		store := newStore(t)
+		get(t, store, "indexer")
+
+		require.NoError(t, store.UpdateBlock(ctx, "indexer", 100, "0x64"))
+		checkpoint := get(t, store, "indexer")
+		require.Equal(t, uint64(100), checkpoint.LastBlock)
+		require.Equal(t, "0x64", checkpoint.LastBlockHash)
+
+		require.ErrorIs(t, store.UpdateBlock(ctx, "indexer", 100, "0x64"), ErrStaleCheckpoint)
+		require.ErrorIs(t, store.UpdateBlock(ctx, "indexer", 99, "0x63"), ErrStaleCheckpoint)
+		require.Equal(t, uint64(100), get(t, store, "indexer").LastBlock)
+
+		require.ErrorIs(t, store.UpdateBlock(ctx, "missing", 100, "0x64"), ErrCheckpointNotFound)
+	})
+
+	t.Run("Rewind", func(t *testing.T) {
+		store := newStore(t)
+		get(t, store, "indexer")
+		require.NoError(t, store.UpdateBlock(ctx, "indexer", 100, "0x64"))
+
+		require.NoError(t, store.Rewind(ctx, "indexer", 90, "0x5a"))
+		checkpoint := get(t, store, "indexer")
+		require.Equal(t, uint64(90), checkpoint.LastBlock)
+		require.Equal(t, "0x5a", checkpoint.LastBlockHash)
+		require.NoError(t, store.Rewind(ctx, "indexer", 90, "0x5b"), "rewound to the same block, replacing its hash")
+		require.Equal(t, "0x5b", get(t, store, "indexer").LastBlockHash)
+
+		require.ErrorIs(t, store.Rewind(ctx, "indexer", 91, "0x5b"), ErrStaleCheckpoint)
+		require.Equal(t, uint64(90), get(t, store, "indexer").LastBlock)
+		require.NoError(t, store.UpdateBlock(ctx, "indexer", 91, "0x5b"), "moves forward again after a rewind")
+
+		require.ErrorIs(t, store.Rewind(ctx, "missing", 1, zeroHash), ErrCheckpointNotFound)
+	})
+
+	t.Run("Save", func(t *testing.T) {
+		store := newStore(t)
+
+		require.NoError(t, store.Save(ctx, models.Checkpoint{ServiceName: "indexer", LastBlock: 100, LastBlockHash: "0x64"}))
+		require.Equal(t, uint64(100), get(t, store, "indexer").LastBlock)
+
+		require.NoError(t, store.Save(ctx, models.Checkpoint{ServiceName: "indexer", LastBlock: 50, LastBlockHash: "0x32"}))
+		checkpoint := get(t, store, "indexer")
+		require.Equal(t, uint64(50), checkpoint.LastBlock, "saved unconditionally")
+		require.Equal(t, "0x32", checkpoint.LastBlockHash)
+	})
+
+	t.Run("ConcurrentUpdates", func(t *testing.T) {
+		store := newStore(t)
+		get(t, store, "indexer")
+
+		// Writers racing over the same blocks: each block is checkpointed
+		// once at most, and the checkpoint never moves backward
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			updated = map[uint64]int{}
+			errs    []error
+		)
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for block := uint64(2); block <= 50; block++ {
+					err := store.UpdateBlock(ctx, "indexer", block, "0x01")
+					mu.Lock()
+					switch {
+					case err == nil:
+						updated[block]++
+					case !errors.Is(err, ErrStaleCheckpoint):
+						errs = append(errs, err)
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		require.Empty(t, errs)
+		for block, n := range updated {
+			require.Equal(t, 1, n, "block %d", block)
+		}
+		require.Contains(t, updated, uint64(50))
+		require.Equal(t, uint64(50), get(t, store, "indexer").LastBlock)
+	})
+}
+
+// TestBoltCheckpointStore tests that the BoltDB checkpoint store behaves as
+// a CheckpointStore.
+func TestBoltCheckpointStore(t *testing.T) {
+	testCheckpointStore(t, func(t *testing.T) CheckpointStore {
+		store, err := NewCheckpointDB(filepath.Join(t.TempDir(), "checkpoints.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+// TestCheckpointDBContracts tests that runtime contracts are saved keyed by
+// address, survive reopening the database and can be deleted.
+func TestCheckpointDBContracts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "checkpoints.db")
+
+	store, err := NewCheckpointDB(path)
+	require.NoError(t, err)
+
+	contracts, err := store.ListContracts(ctx)
+	require.NoError(t, err)
+	require.Empty(t, contracts)
+
+	vault := models.MonitoredContract{
+		Address: "0x1111111111111111111111111111111111111111",
+		ABI:     json.RawMessage(`[{"type":"event","name":"Paused","inputs":[]}]`),
+		Events:  []string{"Paused"},
+		AddedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	other := models.MonitoredContract{Address: "0x2222222222222222222222222222222222222222"}
+	require.NoError(t, store.SaveContract(ctx, vault))
+	require.NoError(t, store.SaveContract(ctx, other))
+
+	// Saving an address again replaces its contract
+	vault.Events = nil
+	require.NoError(t, store.SaveContract(ctx, vault))
+
+	// Contracts are restored from the file after a restart
+	require.NoError(t, store.Close())
+	store, err = NewCheckpointDB(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	contracts, err = store.ListContracts(ctx)
+	require.NoError(t, err)
+	require.Len(t, contracts, 2)
+	require.Equal(t, vault.Address, contracts[0].Address)
+	require.JSONEq(t, string(vault.ABI), string(contracts[0].ABI))
+	require.Empty(t, contracts[0].Events)
+	require.True(t, vault.AddedAt.Equal(contracts[0].AddedAt))
+	require.Equal(t, other.Address, contracts[1].Address)
+
+	require.NoError(t, store.DeleteContract(ctx, vault.Address))
+	// Deleting an unknown address is not an error
+	require.NoError(t, store.DeleteContract(ctx, vault.Address))
+
+	contracts, err = store.ListContracts(ctx)
+	require.NoError(t, err)
+	require.Len(t, contracts, 1)
+	require.Equal(t, other.Address, contracts[0].Address)
+}
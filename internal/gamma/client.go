@@ -0,0 +1,249 @@
+// Package gamma reads market metadata from the Polymarket Gamma API, which
+// lists the human-readable markets behind on-chain conditions.
+package gamma
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the public Gamma API
+	DefaultBaseURL = "https://gamma-api.polymarket.com"
+
+	// DefaultTimeout bounds a single request
+	DefaultTimeout = 10 * time.Second
+)
+
+var (
+	// ErrNotFound is returned when no market is listed for a condition,
+	// typically because it was prepared before being listed.
+	ErrNotFound = errors.New("market not found")
+
+	// ErrUnexpectedStatus is returned for responses that are neither a
+	// success nor worth retrying.
+	ErrUnexpectedStatus = errors.New("unexpected status")
+)
+
+// Market is the metadata of a market listed on Polymarket.
+type Market struct {
+	ConditionID string
+	QuestionID  string
+	Title       string
+	Slug        string
+	Outcomes    []string
+	Category    string
+	EndDate     time.Time // zero when the market has no end date
+}
+
+// RetryPolicy controls how failed requests are retried. Network errors,
+// 429 and 5xx responses are retried; other responses are final.
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts, including the first
+	Backoff     time.Duration // Delay before the first retry, doubled for each further retry
+}
+
+// Client queries the Gamma API.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	retry   RetryPolicy
+
+	// Requests are spaced at least interval apart (WithRateLimit)
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.http = client
+	}
+}
+
+// WithRateLimit limits the client to perSecond requests per second. Zero
+// disables the limit.
+func WithRateLimit(perSecond float64) Option {
+	return func(c *Client) {
+		c.interval = 0
+		if perSecond > 0 {
+			c.interval = time.Duration(float64(time.Second) / perSecond)
+		}
+	}
+}
+
+// WithRetry retries failed requests. Without it every request is attempted
+// once.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// NewClient creates a client for the Gamma API at baseURL.
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: DefaultTimeout},
+		retry:   RetryPolicy{MaxAttempts: 1},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// market is a market as returned by GET /markets.
+type market struct {
+	ConditionID string          `json:"conditionId"`
+	QuestionID  string          `json:"questionID"`
+	Question    string          `json:"question"`
+	Slug        string          `json:"slug"`
+	Outcomes    json.RawMessage `json:"outcomes"`
+	Category    string          `json:"category"`
+	EndDate     string          `json:"endDate"`
+}
+
+// MarketByCondition returns the market of a condition, or ErrNotFound when
+// none is listed.
+func (c *Client) MarketByCondition(ctx context.Context, conditionID string) (Market, error) {
+	query := url.Values{"condition_ids": {conditionID}}
+	body, err := c.get(ctx, "/markets?"+query.Encode())
+	if err != nil {
+		return Market{}, err
+	}
+
+	var markets []market
+	if err := json.Unmarshal(body, &markets); err != nil {
+		return Market{}, fmt.Errorf("failed to decode markets: %w", err)
+	}
+	for _, m := range markets {
+		if strings.EqualFold(m.ConditionID, conditionID) {
+			return m.parse()
+		}
+	}
+	return Market{}, fmt.Errorf("%w: condition %s", ErrNotFound, conditionID)
+}
+
+// parse converts an API market.
+func (m market) parse() (Market, error) {
+	parsed := Market{
+		ConditionID: strings.ToLower(m.ConditionID),
+		QuestionID:  strings.ToLower(m.QuestionID),
+		Title:       m.Question,
+		Slug:        m.Slug,
+		Category:    m.Category,
+	}
+
+	// Outcomes are a JSON-encoded array inside a string, e.g.
+	// "[\"Yes\", \"No\"]"; a plain array is accepted too
+	if len(m.Outcomes) > 0 && string(m.Outcomes) != "null" {
+		raw := []byte(m.Outcomes)
+		var encoded string
+		if json.Unmarshal(raw, &encoded) == nil {
+			raw = []byte(encoded)
+		}
+		if err := json.Unmarshal(raw, &parsed.Outcomes); err != nil {
+			return Market{}, fmt.Errorf("failed to decode outcomes of %s: %w", m.ConditionID, err)
+		}
+	}
+
+	if m.EndDate != "" {
+		end, err := time.Parse(time.RFC3339, m.EndDate)
+		if err != nil {
+			return Market{}, fmt.Errorf("failed to parse end date of %s: %w", m.ConditionID, err)
+		}
+		parsed.EndDate = end
+	}
+	return parsed, nil
+}
+
+// get returns the body of a successful GET of path, retrying failures
+// allowed by the retry policy.
+func (c *Client) get(ctx context.Context, path string) ([]byte, error) {
+	backoff := c.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		body, retryable, err := c.do(ctx, path)
+		if err == nil || !retryable || attempt >= c.retry.MaxAttempts {
+			return body, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// do sends a single GET of path and reports whether a failure may be
+// retried.
+func (c *Client) do(ctx context.Context, path string) (body []byte, retryable bool, err error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, fmt.Errorf("failed to query gamma api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read gamma api response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		retryable = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retryable, fmt.Errorf("%w: %s from %s", ErrUnexpectedStatus, resp.Status, path)
+	}
+	return body, false, nil
+}
+
+// wait blocks until the rate limit allows another request.
+func (c *Client) wait(ctx context.Context) error {
+	if c.interval == 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	now := time.Now()
+	at := c.next
+	if at.Before(now) {
+		at = now
+	}
+	c.next = at.Add(c.interval)
+	c.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
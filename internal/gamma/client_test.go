@@ -0,0 +1,153 @@
+package gamma
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testCondition = "0xe3b1bc389210504ebcb9cffe4b0ed06ccac50561e0f24abb6379984cec030f00"
+
+// testServer serves handler and returns a client for it.
+func testServer(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient(server.URL+"/", opts...)
+}
+
+// TestMarketByCondition tests that a listed market is decoded, including
+// outcomes encoded as a string, and that the condition is queried.
+func TestMarketByCondition(t *testing.T) {
+	client := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/markets", r.URL.Path)
+		require.Equal(t, testCondition, r.URL.Query().Get("condition_ids"))
+		w.Write([]byte(`[{
+			"conditionId": "0xE3B1BC389210504EBCB9CFFE4B0ED06CCAC50561E0F24ABB6379984CEC030F00",
+			"questionID": "0x0e",
+			"question": "Will it rain tomorrow?",
+			"slug": "will-it-rain-tomorrow",
+			"outcomes": "[\"Yes\", \"No\"]",
+			"category": "Weather",
+			"endDate": "2024-11-05T12:00:00Z"
+		}]`))
+	})
+
+	market, err := client.MarketByCondition(context.Background(), testCondition)
+	require.NoError(t, err)
+	require.Equal(t, Market{
+		ConditionID: testCondition,
+		QuestionID:  "0x0e",
+		Title:       "Will it rain tomorrow?",
+		Slug:        "will-it-rain-tomorrow",
+		Outcomes:    []string{"Yes", "No"},
+		Category:    "Weather",
+		EndDate:     time.Date(2024, 11, 5, 12, 0, 0, 0, time.UTC),
+	}, market)
+}
+
+// TestMarketByConditionOptionalFields tests that outcomes may be a plain
+// array and the end date may be missing.
+func TestMarketByConditionOptionalFields(t *testing.T) {
+	client := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"conditionId": "` + testCondition + `", "outcomes": ["Up", "Down"]}]`))
+	})
+
+	market, err := client.MarketByCondition(context.Background(), testCondition)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Up", "Down"}, market.Outcomes)
+	require.True(t, market.EndDate.IsZero())
+}
+
+// TestMarketByConditionNotFound tests that an unlisted condition, including
+// one missing from a non-empty response, is ErrNotFound.
+func TestMarketByConditionNotFound(t *testing.T) {
+	for name, body := range map[string]string{
+		"empty":         `[]`,
+		"other markets": `[{"conditionId": "0x01"}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(body))
+			})
+			_, err := client.MarketByCondition(context.Background(), testCondition)
+			require.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+// TestRetry tests that 429 and 5xx responses are retried with the policy
+// and other failures are not.
+func TestRetry(t *testing.T) {
+	var calls atomic.Int32
+	client := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`[{"conditionId": "` + testCondition + `"}]`))
+		}
+	}, WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+
+	_, err := client.MarketByCondition(context.Background(), testCondition)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), calls.Load())
+
+	calls.Store(0)
+	client = testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}, WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+
+	_, err = client.MarketByCondition(context.Background(), testCondition)
+	require.ErrorIs(t, err, ErrUnexpectedStatus)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+// TestRetryExhausted tests that the last failure is returned once every
+// attempt failed.
+func TestRetryExhausted(t *testing.T) {
+	var calls atomic.Int32
+	client := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, WithRetry(RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}))
+
+	_, err := client.MarketByCondition(context.Background(), testCondition)
+	require.ErrorIs(t, err, ErrUnexpectedStatus)
+	require.Equal(t, int32(2), calls.Load())
+}
+
+// TestRateLimit tests that requests are spaced by the rate limit.
+func TestRateLimit(t *testing.T) {
+	client := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}, WithRateLimit(20))
+
+	start := time.Now()
+	for range 3 {
+		client.MarketByCondition(context.Background(), testCondition)
+	}
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+// TestRateLimitCancelled tests that waiting for the rate limit stops when
+// the context is cancelled.
+func TestRateLimitCancelled(t *testing.T) {
+	client := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}, WithRateLimit(0.1))
+
+	client.MarketByCondition(context.Background(), testCondition)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := client.MarketByCondition(ctx, testCondition)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,23 @@
+package handler
+
+import "errors"
+
+// Handler errors. Handlers wrap one of these with context so callers can
+// classify failures with errors.Is.
+var (
+	// ErrWrongTopicCount means the log does not have the number of topics
+	// the event signature requires. The log is malformed; never retry.
+	ErrWrongTopicCount = errors.New("wrong topic count")
+
+	// ErrShortData means the log data is shorter than the event's
+	// non-indexed arguments require. The log is malformed; never retry.
+	ErrShortData = errors.New("log data too short")
+
+	// ErrABIUnpack means the log has the expected shape but could not be
+	// decoded with the ABI, which usually indicates a stale ABI.
+	ErrABIUnpack = errors.New("ABI unpack failed")
+
+	// ErrInvalidPayload means the log decoded but its values are not valid
+	// for the event (e.g. payouts not matching the outcome slot count).
+	ErrInvalidPayload = errors.New("invalid event payload")
+)
@@ -4,318 +4,383 @@ package handler
 import (
 	"context"
 	"fmt"
+	"math"
 	"math/big"
 
+	"github.com/0xkanth/polymarket-indexer/pkg/contracts"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
 	"github.com/0xkanth/polymarket-indexer/pkg/models"
 	"github.com/ethereum/go-ethereum/accounts/abi"
-	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/core/types"
 )
 
+// Parsed contract ABIs from the generated bindings, used to unpack logs.
+// Event signatures come from the shared pkg/events registry.
+var (
+	exchangeABI          = mustParseABI(contracts.CTFExchangeMetaData)
+	conditionalTokensABI = mustParseABI(contracts.ConditionalTokensMetaData)
+	erc20ABI             = mustParseABI(contracts.ERC20MetaData)
+)
+
+// priceDecimals is the precision of derived OrderFilled prices.
+const priceDecimals = 6
+
 // Event signatures for CTF Exchange
 var (
 	// OrderFilled(bytes32 indexed orderHash, address indexed maker, address indexed taker,
 	//             uint256 makerAssetId, uint256 takerAssetId, uint256 makerAmountFilled,
 	//             uint256 takerAmountFilled, uint256 fee)
-	OrderFilledSig = common.HexToHash("0xd0a08e8c493f9c94f29311604c9de0fa40fe441d0d4d6e8b87b3e1a4cbadba5c")
+	OrderFilledSig = events.MustLookup(events.OrderFilled).Signature
 
 	// OrderCancelled(bytes32 indexed orderHash)
-	OrderCancelledSig = common.HexToHash("0x5152abf959f6564662358c2e52b702259b78bac5ee7842a0f01937e670efcc7d")
+	OrderCancelledSig = events.MustLookup(events.OrderCancelled).Signature
 
 	// TokenRegistered(uint256 indexed token0, uint256 indexed token1, bytes32 indexed conditionId)
-	TokenRegisteredSig = common.HexToHash("0xd0cba75e58a31a78e930fa8243a934dd8ed3c9d25f8c82e5c2bc7d0fdd1975f8")
+	TokenRegisteredSig = events.MustLookup(events.TokenRegistered).Signature
 )
 
 // Event signatures for Conditional Tokens
 var (
 	// TransferSingle(address indexed operator, address indexed from, address indexed to,
 	//                uint256 id, uint256 value)
-	TransferSingleSig = common.HexToHash("0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62")
+	TransferSingleSig = events.MustLookup(events.TransferSingle).Signature
 
 	// TransferBatch(address indexed operator, address indexed from, address indexed to,
 	//               uint256[] ids, uint256[] values)
-	TransferBatchSig = common.HexToHash("0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb")
+	TransferBatchSig = events.MustLookup(events.TransferBatch).Signature
 
 	// ConditionPreparation(bytes32 indexed conditionId, address indexed oracle,
 	//                       bytes32 indexed questionId, uint256 outcomeSlotCount)
-	ConditionPreparationSig = common.HexToHash("0xcc914d01b5c6aa4ed0f1ce5d86badddf5cce7dc7740b28f5dbbc3dda0dff45b6")
+	ConditionPreparationSig = events.MustLookup(events.ConditionPreparation).Signature
 
 	// ConditionResolution(bytes32 indexed conditionId, address indexed oracle,
 	//                      bytes32 indexed questionId, uint256 outcomeSlotCount, uint256[] payoutNumerators)
-	ConditionResolutionSig = common.HexToHash("0xb3574d9e77eea35b4c597c1ea75c16cb1c2cd18308085b42fc29dcf8bc8c0e3b")
+	ConditionResolutionSig = events.MustLookup(events.ConditionResolution).Signature
 
 	// PositionSplit(address indexed stakeholder, address collateralToken,
 	//               bytes32 indexed parentCollectionId, bytes32 indexed conditionId,
 	//               uint256[] partition, uint256 amount)
-	PositionSplitSig = common.HexToHash("0x708228a5bb6c5c05fb64e66e1ef1fbbf4cf3ba9ec0c8fb333e8df26f7098c81d")
+	PositionSplitSig = events.MustLookup(events.PositionSplit).Signature
 
 	// PositionsMerge(address indexed stakeholder, address collateralToken,
 	//                bytes32 indexed parentCollectionId, bytes32 indexed conditionId,
 	//                uint256[] partition, uint256 amount)
-	PositionsMergeSig = common.HexToHash("0x5c2a65c3f6c72c9fb63c29b54c7f21e2cb10f60de87b9e42b90e7bdd76b6f26c")
+	PositionsMergeSig = events.MustLookup(events.PositionsMerge).Signature
+
+	// PayoutRedemption(address indexed redeemer, address indexed collateralToken,
+	//                  bytes32 indexed parentCollectionId, bytes32 conditionId,
+	//                  uint256[] indexSets, uint256 payout)
+	PayoutRedemptionSig = events.MustLookup(events.PayoutRedemption).Signature
 )
 
+// Event signatures for the collateral token (USDC)
+var (
+	// Transfer(address indexed from, address indexed to, uint256 value)
+	ERC20TransferSig = events.MustLookup(events.ERC20Transfer).Signature
+)
+
+// unpackLog decodes a log into a generated binding event struct using the
+// contract ABI, the same way the generated Parse* filterer methods do.
+//
+// The topic count is derived from the ABI (topic0 plus one topic per indexed
+// argument), so handlers cannot drift from the event layout.
+func unpackLog(contractABI *abi.ABI, out any, eventName string, log types.Log) error {
+	inputs := contractABI.Events[eventName].Inputs
+	if err := requireTopics(log, eventName, topicCount(inputs)); err != nil {
+		return err
+	}
+	if err := checkDataLength(eventName, inputs, log.Data); err != nil {
+		return err
+	}
+	if err := contractABI.UnpackIntoInterface(out, eventName, log.Data); err != nil {
+		return fmt.Errorf("failed to unpack %s data: %w: %w", eventName, ErrABIUnpack, err)
+	}
+
+	var indexed abi.Arguments
+	for _, arg := range inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	if err := abi.ParseTopics(out, indexed, log.Topics[1:]); err != nil {
+		return fmt.Errorf("failed to parse %s topics: %w: %w", eventName, ErrABIUnpack, err)
+	}
+	return nil
+}
+
+// requireTopics verifies that a log has exactly n topics.
+func requireTopics(log types.Log, eventName string, n int) error {
+	if len(log.Topics) != n {
+		return fmt.Errorf("invalid %s event: %w: expected %d topics, got %d",
+			eventName, ErrWrongTopicCount, n, len(log.Topics))
+	}
+	return nil
+}
+
+// topicCount returns the number of topics a non-anonymous event emits.
+func topicCount(inputs abi.Arguments) int {
+	n := 1
+	for _, arg := range inputs {
+		if arg.Indexed {
+			n++
+		}
+	}
+	return n
+}
+
+// checkDataLength verifies that data holds at least one 32-byte head word
+// per non-indexed argument.
+func checkDataLength(eventName string, inputs abi.Arguments, data []byte) error {
+	if minLen := len(inputs.NonIndexed()) * 32; len(data) < minLen {
+		return fmt.Errorf("invalid %s event: %w: got %d bytes, need at least %d",
+			eventName, ErrShortData, len(data), minLen)
+	}
+	return nil
+}
+
+// mustParseABI parses the ABI of a generated binding, panicking on failure
+// since the ABIs are compiled into the binary.
+func mustParseABI(metadata *bind.MetaData) *abi.ABI {
+	parsed, err := metadata.GetAbi()
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse contract ABI: %v", err))
+	}
+	return parsed
+}
+
 // HandleOrderFilled processes OrderFilled events from CTF Exchange.
 func HandleOrderFilled(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
-	if len(log.Topics) != 4 {
-		return nil, fmt.Errorf("invalid OrderFilled event: expected 4 topics, got %d", len(log.Topics))
+	var event contracts.CTFExchangeOrderFilled
+	if err := unpackLog(exchangeABI, &event, "OrderFilled", log); err != nil {
+		return nil, err
 	}
 
-	// Parse indexed parameters from topics
-	orderHash := log.Topics[1].Hex()
-	maker := common.BytesToAddress(log.Topics[2].Bytes()).Hex()
-	taker := common.BytesToAddress(log.Topics[3].Bytes()).Hex()
+	fill := models.OrderFilled{
+		OrderHash:         models.FormatHash(event.OrderHash),
+		Maker:             models.FormatAddress(event.Maker),
+		Taker:             models.FormatAddress(event.Taker),
+		MakerAssetID:      event.MakerAssetId,
+		TakerAssetID:      event.TakerAssetId,
+		MakerAmountFilled: event.MakerAmountFilled,
+		TakerAmountFilled: event.TakerAmountFilled,
+		Fee:               event.Fee,
+		// The exchange emitting the log is the taker when it matches orders
+		// against each other; the fill is then one leg of an internal match.
+		IsOperatorFill: event.Taker == log.Address,
+	}
+	classifyOrderFill(&fill)
 
-	// Parse non-indexed parameters from data
-	// Data contains: makerAssetId, takerAssetId, makerAmountFilled, takerAmountFilled, fee
-	if len(log.Data) < 160 { // 5 * 32 bytes
-		return nil, fmt.Errorf("invalid OrderFilled data length: %d", len(log.Data))
+	return fill, nil
+}
+
+// classifyOrderFill derives the maker's side and the fill price. Asset ID 0
+// is the collateral (USDC); any other ID is an outcome token. Both sides use
+// 6 decimals, so collateral / outcome amount is the price per share.
+func classifyOrderFill(fill *models.OrderFilled) {
+	var collateral, outcome *big.Int
+	switch {
+	case fill.MakerAssetID.Sign() == 0 && fill.TakerAssetID.Sign() != 0:
+		// Maker pays collateral for outcome tokens
+		fill.Side = models.OrderSideBuy
+		collateral, outcome = fill.MakerAmountFilled, fill.TakerAmountFilled
+	case fill.TakerAssetID.Sign() == 0 && fill.MakerAssetID.Sign() != 0:
+		// Maker gives outcome tokens for collateral
+		fill.Side = models.OrderSideSell
+		collateral, outcome = fill.TakerAmountFilled, fill.MakerAmountFilled
+	default:
+		// Both or neither asset is collateral: not a plain buy or sell
+		fill.Side = models.OrderSideUnknown
+		return
 	}
 
-	makerAssetID := new(big.Int).SetBytes(log.Data[0:32])
-	takerAssetID := new(big.Int).SetBytes(log.Data[32:64])
-	makerAmountFilled := new(big.Int).SetBytes(log.Data[64:96])
-	takerAmountFilled := new(big.Int).SetBytes(log.Data[96:128])
-	fee := new(big.Int).SetBytes(log.Data[128:160])
-
-	return models.OrderFilled{
-		OrderHash:         orderHash,
-		Maker:             maker,
-		Taker:             taker,
-		MakerAssetID:      makerAssetID,
-		TakerAssetID:      takerAssetID,
-		MakerAmountFilled: makerAmountFilled,
-		TakerAmountFilled: takerAmountFilled,
-		Fee:               fee,
-	}, nil
+	if outcome.Sign() == 0 {
+		return
+	}
+	fill.Price = new(big.Rat).SetFrac(collateral, outcome).FloatString(priceDecimals)
 }
 
 // HandleOrderCancelled processes OrderCancelled events from CTF Exchange.
 func HandleOrderCancelled(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
-	if len(log.Topics) != 2 {
-		return nil, fmt.Errorf("invalid OrderCancelled event: expected 2 topics, got %d", len(log.Topics))
+	var event contracts.CTFExchangeOrderCancelled
+	if err := unpackLog(exchangeABI, &event, "OrderCancelled", log); err != nil {
+		return nil, err
 	}
 
-	orderHash := log.Topics[1].Hex()
-
 	return models.OrderCancelled{
-		OrderHash: orderHash,
+		OrderHash: models.FormatHash(event.OrderHash),
 	}, nil
 }
 
 // HandleTokenRegistered processes TokenRegistered events from CTF Exchange.
 func HandleTokenRegistered(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
-	if len(log.Topics) != 4 {
-		return nil, fmt.Errorf("invalid TokenRegistered event: expected 4 topics, got %d", len(log.Topics))
+	var event contracts.CTFExchangeTokenRegistered
+	if err := unpackLog(exchangeABI, &event, "TokenRegistered", log); err != nil {
+		return nil, err
 	}
 
-	token0 := new(big.Int).SetBytes(log.Topics[1].Bytes())
-	token1 := new(big.Int).SetBytes(log.Topics[2].Bytes())
-	conditionID := log.Topics[3].Hex()
-
 	return models.TokenRegistered{
-		Token0:      token0,
-		Token1:      token1,
-		ConditionID: conditionID,
+		Token0:      event.Token0,
+		Token1:      event.Token1,
+		ConditionID: models.FormatHash(event.ConditionId),
 	}, nil
 }
 
 // HandleTransferSingle processes TransferSingle events from Conditional Tokens.
 func HandleTransferSingle(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
-	if len(log.Topics) != 4 {
-		return nil, fmt.Errorf("invalid TransferSingle event: expected 4 topics, got %d", len(log.Topics))
-	}
-
-	operator := common.BytesToAddress(log.Topics[1].Bytes()).Hex()
-	from := common.BytesToAddress(log.Topics[2].Bytes()).Hex()
-	to := common.BytesToAddress(log.Topics[3].Bytes()).Hex()
-
-	// Parse data: id and value
-	if len(log.Data) < 64 {
-		return nil, fmt.Errorf("invalid TransferSingle data length: %d", len(log.Data))
+	var event contracts.ConditionalTokensTransferSingle
+	if err := unpackLog(conditionalTokensABI, &event, "TransferSingle", log); err != nil {
+		return nil, err
 	}
 
-	tokenID := new(big.Int).SetBytes(log.Data[0:32])
-	amount := new(big.Int).SetBytes(log.Data[32:64])
-
 	return models.TransferSingle{
-		Operator: operator,
-		From:     from,
-		To:       to,
-		TokenID:  tokenID,
-		Amount:   amount,
+		Operator:     models.FormatAddress(event.Operator),
+		From:         models.FormatAddress(event.From),
+		To:           models.FormatAddress(event.To),
+		TokenID:      event.Id,
+		Amount:       event.Value,
+		TransferKind: models.ClassifyTransfer(event.From.Hex(), event.To.Hex()),
 	}, nil
 }
 
 // HandleTransferBatch processes TransferBatch events from Conditional Tokens.
 func HandleTransferBatch(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
-	if len(log.Topics) != 4 {
-		return nil, fmt.Errorf("invalid TransferBatch event: expected 4 topics, got %d", len(log.Topics))
-	}
-
-	operator := common.BytesToAddress(log.Topics[1].Bytes()).Hex()
-	from := common.BytesToAddress(log.Topics[2].Bytes()).Hex()
-	to := common.BytesToAddress(log.Topics[3].Bytes()).Hex()
-
-	// Parse data: dynamic arrays of ids and values
-	// We need to decode the ABI-encoded dynamic arrays
-	uint256ArrayTy, _ := abi.NewType("uint256[]", "", nil)
-	args := abi.Arguments{
-		{Type: uint256ArrayTy},
-		{Type: uint256ArrayTy},
+	var event contracts.ConditionalTokensTransferBatch
+	if err := unpackLog(conditionalTokensABI, &event, "TransferBatch", log); err != nil {
+		return nil, err
 	}
 
-	unpacked, err := args.Unpack(log.Data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unpack TransferBatch data: %w", err)
-	}
-
-	tokenIDs := unpacked[0].([]*big.Int)
-	amounts := unpacked[1].([]*big.Int)
-
 	return models.TransferBatch{
-		Operator: operator,
-		From:     from,
-		To:       to,
-		TokenIDs: tokenIDs,
-		Amounts:  amounts,
+		Operator:     models.FormatAddress(event.Operator),
+		From:         models.FormatAddress(event.From),
+		To:           models.FormatAddress(event.To),
+		TokenIDs:     event.Ids,
+		Amounts:      event.Values,
+		TransferKind: models.ClassifyTransfer(event.From.Hex(), event.To.Hex()),
 	}, nil
 }
 
 // HandleConditionPreparation processes ConditionPreparation events.
 func HandleConditionPreparation(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
-	if len(log.Topics) != 4 {
-		return nil, fmt.Errorf("invalid ConditionPreparation event: expected 4 topics, got %d", len(log.Topics))
+	var event contracts.ConditionalTokensConditionPreparation
+	if err := unpackLog(conditionalTokensABI, &event, "ConditionPreparation", log); err != nil {
+		return nil, err
 	}
 
-	conditionID := log.Topics[1].Hex()
-	oracle := common.BytesToAddress(log.Topics[2].Bytes()).Hex()
-	questionID := log.Topics[3].Hex()
-
-	// Parse outcomeSlotCount from data
-	if len(log.Data) < 32 {
-		return nil, fmt.Errorf("invalid ConditionPreparation data length: %d", len(log.Data))
+	slots, err := outcomeSlotCount("ConditionPreparation", event.OutcomeSlotCount)
+	if err != nil {
+		return nil, err
 	}
 
-	outcomeSlotCount := uint8(new(big.Int).SetBytes(log.Data[0:32]).Uint64())
-
 	return models.ConditionPreparation{
-		ConditionID:      conditionID,
-		Oracle:           oracle,
-		QuestionID:       questionID,
-		OutcomeSlotCount: outcomeSlotCount,
+		ConditionID:      models.FormatHash(event.ConditionId),
+		Oracle:           models.FormatAddress(event.Oracle),
+		QuestionID:       models.FormatHash(event.QuestionId),
+		OutcomeSlotCount: slots,
 	}, nil
 }
 
 // HandleConditionResolution processes ConditionResolution events.
 func HandleConditionResolution(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
-	if len(log.Topics) != 4 {
-		return nil, fmt.Errorf("invalid ConditionResolution event: expected 4 topics, got %d", len(log.Topics))
+	var event contracts.ConditionalTokensConditionResolution
+	if err := unpackLog(conditionalTokensABI, &event, "ConditionResolution", log); err != nil {
+		return nil, err
 	}
 
-	conditionID := log.Topics[1].Hex()
-	oracle := common.BytesToAddress(log.Topics[2].Bytes()).Hex()
-	questionID := log.Topics[3].Hex()
-
-	// Parse data: outcomeSlotCount and payoutNumerators array
-	uint256Ty, _ := abi.NewType("uint256", "", nil)
-	uint256ArrayTy, _ := abi.NewType("uint256[]", "", nil)
-	args := abi.Arguments{
-		{Type: uint256Ty},      // outcomeSlotCount
-		{Type: uint256ArrayTy}, // payoutNumerators
-	}
-
-	unpacked, err := args.Unpack(log.Data)
+	slots, err := outcomeSlotCount("ConditionResolution", event.OutcomeSlotCount)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unpack ConditionResolution data: %w", err)
+		return nil, err
+	}
+	if err := models.ValidatePayouts(uint64(slots), event.PayoutNumerators); err != nil {
+		return nil, fmt.Errorf("invalid ConditionResolution event for condition %s: %w: %w",
+			models.FormatHash(event.ConditionId), ErrInvalidPayload, err)
 	}
-
-	outcomeSlotCount := uint8(unpacked[0].(*big.Int).Uint64())
-	payoutNumerators := unpacked[1].([]*big.Int)
 
 	return models.ConditionResolution{
-		ConditionID:      conditionID,
-		Oracle:           oracle,
-		QuestionID:       questionID,
-		OutcomeSlotCount: outcomeSlotCount,
-		PayoutNumerators: payoutNumerators,
+		ConditionID:      models.FormatHash(event.ConditionId),
+		Oracle:           models.FormatAddress(event.Oracle),
+		QuestionID:       models.FormatHash(event.QuestionId),
+		OutcomeSlotCount: slots,
+		PayoutNumerators: event.PayoutNumerators,
 	}, nil
 }
 
-// HandlePositionSplit processes PositionSplit events.
-func HandlePositionSplit(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
-	if len(log.Topics) != 4 {
-		return nil, fmt.Errorf("invalid PositionSplit event: expected 4 topics, got %d", len(log.Topics))
-	}
-
-	stakeholder := common.BytesToAddress(log.Topics[1].Bytes()).Hex()
-	parentCollectionID := log.Topics[2].Hex()
-	conditionID := log.Topics[3].Hex()
-
-	// Parse data: collateralToken, partition array, amount
-	addressTy, _ := abi.NewType("address", "", nil)
-	uint256ArrayTy, _ := abi.NewType("uint256[]", "", nil)
-	uint256Ty, _ := abi.NewType("uint256", "", nil)
-	args := abi.Arguments{
-		{Type: addressTy},      // collateralToken
-		{Type: uint256ArrayTy}, // partition
-		{Type: uint256Ty},      // amount
+// outcomeSlotCount converts a decoded outcomeSlotCount to uint32, rejecting
+// values that do not fit instead of wrapping around. The contract allows up
+// to 256 slots, which already overflows a uint8.
+func outcomeSlotCount(eventName string, count *big.Int) (uint32, error) {
+	if !count.IsUint64() || count.Uint64() > math.MaxUint32 {
+		return 0, fmt.Errorf("invalid %s event: %w: outcome slot count %s out of range",
+			eventName, ErrInvalidPayload, count)
 	}
+	return uint32(count.Uint64()), nil
+}
 
-	unpacked, err := args.Unpack(log.Data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unpack PositionSplit data: %w", err)
+// HandlePositionSplit processes PositionSplit events.
+func HandlePositionSplit(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
+	var event contracts.ConditionalTokensPositionSplit
+	if err := unpackLog(conditionalTokensABI, &event, "PositionSplit", log); err != nil {
+		return nil, err
 	}
 
-	collateralToken := unpacked[0].(common.Address).Hex()
-	partition := unpacked[1].([]*big.Int)
-	amount := unpacked[2].(*big.Int)
-
 	return models.PositionSplit{
-		Stakeholder:        stakeholder,
-		CollateralToken:    collateralToken,
-		ParentCollectionID: parentCollectionID,
-		ConditionID:        conditionID,
-		Partition:          partition,
-		Amount:             amount,
+		Stakeholder:        models.FormatAddress(event.Stakeholder),
+		CollateralToken:    models.FormatAddress(event.CollateralToken),
+		ParentCollectionID: models.FormatHash(event.ParentCollectionId),
+		IsRootCollection:   event.ParentCollectionId == [32]byte{},
+		ConditionID:        models.FormatHash(event.ConditionId),
+		Partition:          event.Partition,
+		Amount:             event.Amount,
 	}, nil
 }
 
 // HandlePositionsMerge processes PositionsMerge events.
 func HandlePositionsMerge(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
-	if len(log.Topics) != 4 {
-		return nil, fmt.Errorf("invalid PositionsMerge event: expected 4 topics, got %d", len(log.Topics))
+	var event contracts.ConditionalTokensPositionsMerge
+	if err := unpackLog(conditionalTokensABI, &event, "PositionsMerge", log); err != nil {
+		return nil, err
 	}
 
-	stakeholder := common.BytesToAddress(log.Topics[1].Bytes()).Hex()
-	parentCollectionID := log.Topics[2].Hex()
-	conditionID := log.Topics[3].Hex()
-
-	// Parse data: collateralToken, partition array, amount
-	addressTy, _ := abi.NewType("address", "", nil)
-	uint256ArrayTy, _ := abi.NewType("uint256[]", "", nil)
-	uint256Ty, _ := abi.NewType("uint256", "", nil)
-	args := abi.Arguments{
-		{Type: addressTy},      // collateralToken
-		{Type: uint256ArrayTy}, // partition
-		{Type: uint256Ty},      // amount
-	}
+	return models.PositionsMerge{
+		Stakeholder:        models.FormatAddress(event.Stakeholder),
+		CollateralToken:    models.FormatAddress(event.CollateralToken),
+		ParentCollectionID: models.FormatHash(event.ParentCollectionId),
+		IsRootCollection:   event.ParentCollectionId == [32]byte{},
+		ConditionID:        models.FormatHash(event.ConditionId),
+		Partition:          event.Partition,
+		Amount:             event.Amount,
+	}, nil
+}
 
-	unpacked, err := args.Unpack(log.Data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unpack PositionsMerge data: %w", err)
+// HandlePayoutRedemption processes PayoutRedemption events.
+func HandlePayoutRedemption(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
+	var event contracts.ConditionalTokensPayoutRedemption
+	if err := unpackLog(conditionalTokensABI, &event, "PayoutRedemption", log); err != nil {
+		return nil, err
 	}
 
-	collateralToken := unpacked[0].(common.Address).Hex()
-	partition := unpacked[1].([]*big.Int)
-	amount := unpacked[2].(*big.Int)
+	return models.PayoutRedemption{
+		Redeemer:           models.FormatAddress(event.Redeemer),
+		CollateralToken:    models.FormatAddress(event.CollateralToken),
+		ParentCollectionID: models.FormatHash(event.ParentCollectionId),
+		IsRootCollection:   event.ParentCollectionId == [32]byte{},
+		ConditionID:        models.FormatHash(event.ConditionId),
+		IndexSets:          event.IndexSets,
+		Payout:             event.Payout,
+	}, nil
+}
 
-	return models.PositionsMerge{
-		Stakeholder:        stakeholder,
-		CollateralToken:    collateralToken,
-		ParentCollectionID: parentCollectionID,
-		ConditionID:        conditionID,
-		Partition:          partition,
-		Amount:             amount,
+// HandleERC20Transfer processes collateral token Transfer events.
+func HandleERC20Transfer(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
+	var event contracts.ERC20Transfer
+	if err := unpackLog(erc20ABI, &event, "Transfer", log); err != nil {
+		return nil, err
+	}
+
+	return models.ERC20Transfer{
+		Token: models.FormatAddress(log.Address),
+		From:  models.FormatAddress(event.From),
+		To:    models.FormatAddress(event.To),
+		Value: event.Value,
 	}, nil
 }
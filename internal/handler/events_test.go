@@ -0,0 +1,546 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestEventSignaturesMatchContractABIs tests that every handled signature
+// exists in its contract ABI, matches the keccak of the canonical event
+// signature, and matches the topic documented by the generated bindings.
+func TestEventSignaturesMatchContractABIs(t *testing.T) {
+	tests := []struct {
+		name      string
+		sig       common.Hash
+		contract  *abi.ABI
+		canonical string
+		topic     string
+	}{
+		{"OrderFilled", OrderFilledSig, exchangeABI,
+			"OrderFilled(bytes32,address,address,uint256,uint256,uint256,uint256,uint256)",
+			"0xd0a08e8c493f9c94f29311604c9de1b4e8c8d4c06bd0c789af57f2d65bfec0f6"},
+		{"OrderCancelled", OrderCancelledSig, exchangeABI,
+			"OrderCancelled(bytes32)",
+			"0x5152abf959f6564662358c2e52b702259b78bac5ee7842a0f01937e670efcc7d"},
+		{"TokenRegistered", TokenRegisteredSig, exchangeABI,
+			"TokenRegistered(uint256,uint256,bytes32)",
+			"0xbc9a2432e8aeb48327246cddd6e872ef452812b4243c04e6bfb786a2cd8faf0d"},
+		{"TransferSingle", TransferSingleSig, conditionalTokensABI,
+			"TransferSingle(address,address,address,uint256,uint256)",
+			"0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"},
+		{"TransferBatch", TransferBatchSig, conditionalTokensABI,
+			"TransferBatch(address,address,address,uint256[],uint256[])",
+			"0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"},
+		{"ConditionPreparation", ConditionPreparationSig, conditionalTokensABI,
+			"ConditionPreparation(bytes32,address,bytes32,uint256)",
+			"0xab3760c3bd2bb38b5bcf54dc79802ed67338b4cf29f3054ded67ed24661e4177"},
+		{"ConditionResolution", ConditionResolutionSig, conditionalTokensABI,
+			"ConditionResolution(bytes32,address,bytes32,uint256,uint256[])",
+			"0xb44d84d3289691f71497564b85d4233648d9dbae8cbdbb4329f301c3a0185894"},
+		{"PositionSplit", PositionSplitSig, conditionalTokensABI,
+			"PositionSplit(address,address,bytes32,bytes32,uint256[],uint256)",
+			"0x2e6bb91f8cbcda0c93623c54d0403a43514fabc40084ec96b6d5379a74786298"},
+		{"PositionsMerge", PositionsMergeSig, conditionalTokensABI,
+			"PositionsMerge(address,address,bytes32,bytes32,uint256[],uint256)",
+			"0x6f13ca62553fcc2bcd2372180a43949c1e4cebba603901ede2f4e14f36b282ca"},
+		{"PayoutRedemption", PayoutRedemptionSig, conditionalTokensABI,
+			"PayoutRedemption(address,address,bytes32,bytes32,uint256[],uint256)",
+			"0x2682012a4a4f1973119f1c9b90745d1bd91fa2bab387344f044cb3586864d18d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := tt.contract.Events[tt.name]
+			require.True(t, ok, "event %s missing from ABI", tt.name)
+			require.Equal(t, event.ID, tt.sig)
+			require.Equal(t, tt.canonical, event.Sig)
+			require.Equal(t, crypto.Keccak256Hash([]byte(tt.canonical)), tt.sig)
+			require.Equal(t, common.HexToHash(tt.topic), tt.sig)
+		})
+	}
+}
+
+// Synthetic fixture values shared by the decode tests. The logs built from
+// them are ABI-encoded by hand, not captured from Polygon: captured logs are
+// decoded by TestHandlersDecodePolygonLogs.
+const (
+	fixtureOrderHash   = "0x9b1d5b8a2e2f0d6c4a3b7e8f1c0d9a2b3c4d5e6f708192a3b4c5d6e7f8091a2b"
+	fixtureConditionID = "0x4aa1e8ed1f5d3b1e4f3a3c2d1b0a99887766554433221100ffeeddccbbaa9988"
+	fixtureQuestionID  = "0x1f2e3d4c5b6a79880796a5b4c3d2e1f00112233445566778899aabbccddeeff0"
+	fixtureToken0      = "0x3011e4ede0f6befa0ad3f571001d3e1ffeef3d4af78c3112aaac90416e3a43e7"
+	fixtureToken1      = "0x6ada66b0220f72b49d81cb8dfeec380b656e4f5fa8a179b371e7628463b4e964"
+	fixtureMaker       = "0x1234567890123456789012345678901234567890"
+	fixtureTaker       = "0x0987654321098765432109876543210987654321"
+	fixtureOracle      = "0x5555555555555555555555555555555555555555"
+)
+
+// handlerCase is a valid synthetic log for a handler and its expected JSON
+// payload.
+type handlerCase struct {
+	name    string
+	handler func(context.Context, types.Log, uint64) (any, error)
+	log     types.Log
+	golden  string
+}
+
+// addrTopic returns the topic encoding of an indexed address.
+func addrTopic(addr string) common.Hash {
+	return common.BytesToHash(common.HexToAddress(addr).Bytes())
+}
+
+// handlerCases returns one valid log per handler.
+func handlerCases() []handlerCase {
+	return []handlerCase{
+		{
+			name:    "OrderFilled",
+			handler: HandleOrderFilled,
+			log: types.Log{
+				Topics: []common.Hash{OrderFilledSig, common.HexToHash(fixtureOrderHash), addrTopic(fixtureMaker), addrTopic(fixtureTaker)},
+				Data: common.FromHex("0x" +
+					"0000000000000000000000000000000000000000000000000000000000000000" + // makerAssetId (USDC)
+					"3011e4ede0f6befa0ad3f571001d3e1ffeef3d4af78c3112aaac90416e3a43e7" + // takerAssetId
+					"0000000000000000000000000000000000000000000000000000000003197500" + // makerAmountFilled
+					"0000000000000000000000000000000000000000000000000000000005f5e100" + // takerAmountFilled
+					"0000000000000000000000000000000000000000000000000000000000000000"), // fee
+			},
+			golden: `{"order_hash":"` + fixtureOrderHash + `","maker":"` + fixtureMaker + `","taker":"` + fixtureTaker + `",` +
+				`"maker_asset_id":0,"taker_asset_id":21742633143463906290569050155826241533067272736897614950488156847949938836455,` +
+				`"maker_amount_filled":52000000,"taker_amount_filled":100000000,"fee":0,` +
+				`"side":"buy","price":"0.520000","is_operator_fill":false}`,
+		},
+		{
+			name:    "OrderCancelled",
+			handler: HandleOrderCancelled,
+			log: types.Log{
+				Topics: []common.Hash{OrderCancelledSig, common.HexToHash(fixtureOrderHash)},
+			},
+			golden: `{"order_hash":"` + fixtureOrderHash + `"}`,
+		},
+		{
+			name:    "TokenRegistered",
+			handler: HandleTokenRegistered,
+			log: types.Log{
+				Topics: []common.Hash{TokenRegisteredSig, common.HexToHash(fixtureToken0), common.HexToHash(fixtureToken1), common.HexToHash(fixtureConditionID)},
+			},
+			golden: `{"token0":21742633143463906290569050155826241533067272736897614950488156847949938836455,` +
+				`"token1":48331043336612883890938759509493159234755048973500640148014422747788308965732,` +
+				`"condition_id":"` + fixtureConditionID + `"}`,
+		},
+		{
+			name:    "TransferSingle",
+			handler: HandleTransferSingle,
+			log: types.Log{
+				Topics: []common.Hash{TransferSingleSig, addrTopic(fixtureTaker), addrTopic(fixtureMaker), addrTopic(fixtureTaker)},
+				Data: common.FromHex("0x" +
+					"6ada66b0220f72b49d81cb8dfeec380b656e4f5fa8a179b371e7628463b4e964" + // id
+					"0000000000000000000000000000000000000000000000000000000005f5e100"), // value
+			},
+			golden: `{"operator":"` + fixtureTaker + `","from":"` + fixtureMaker + `","to":"` + fixtureTaker + `",` +
+				`"token_id":48331043336612883890938759509493159234755048973500640148014422747788308965732,"amount":100000000,"transfer_kind":"transfer"}`,
+		},
+		{
+			name:    "TransferBatch",
+			handler: HandleTransferBatch,
+			log: types.Log{
+				Topics: []common.Hash{TransferBatchSig, addrTopic(fixtureTaker), addrTopic(fixtureMaker), addrTopic(fixtureTaker)},
+				Data: common.FromHex("0x" +
+					"0000000000000000000000000000000000000000000000000000000000000040" + // offset ids
+					"00000000000000000000000000000000000000000000000000000000000000a0" + // offset values
+					"0000000000000000000000000000000000000000000000000000000000000002" + // len(ids)
+					"3011e4ede0f6befa0ad3f571001d3e1ffeef3d4af78c3112aaac90416e3a43e7" +
+					"6ada66b0220f72b49d81cb8dfeec380b656e4f5fa8a179b371e7628463b4e964" +
+					"0000000000000000000000000000000000000000000000000000000000000002" + // len(values)
+					"00000000000000000000000000000000000000000000000000000000004c4b40" +
+					"00000000000000000000000000000000000000000000000000000000006acfc0"),
+			},
+			golden: `{"operator":"` + fixtureTaker + `","from":"` + fixtureMaker + `","to":"` + fixtureTaker + `",` +
+				`"token_ids":[21742633143463906290569050155826241533067272736897614950488156847949938836455,` +
+				`48331043336612883890938759509493159234755048973500640148014422747788308965732],` +
+				`"amounts":[5000000,7000000],"transfer_kind":"transfer"}`,
+		},
+		{
+			name:    "ConditionPreparation",
+			handler: HandleConditionPreparation,
+			log: types.Log{
+				Topics: []common.Hash{ConditionPreparationSig, common.HexToHash(fixtureConditionID), addrTopic(fixtureOracle), common.HexToHash(fixtureQuestionID)},
+				Data:   common.FromHex("0x0000000000000000000000000000000000000000000000000000000000000002"),
+			},
+			golden: `{"condition_id":"` + fixtureConditionID + `","oracle":"` + fixtureOracle + `",` +
+				`"question_id":"` + fixtureQuestionID + `","outcome_slot_count":2}`,
+		},
+		{
+			name:    "ConditionResolution",
+			handler: HandleConditionResolution,
+			log: types.Log{
+				Topics: []common.Hash{ConditionResolutionSig, common.HexToHash(fixtureConditionID), addrTopic(fixtureOracle), common.HexToHash(fixtureQuestionID)},
+				Data: common.FromHex("0x" +
+					"0000000000000000000000000000000000000000000000000000000000000002" + // outcomeSlotCount
+					"0000000000000000000000000000000000000000000000000000000000000040" + // offset payoutNumerators
+					"0000000000000000000000000000000000000000000000000000000000000002" +
+					"0000000000000000000000000000000000000000000000000000000000000001" +
+					"0000000000000000000000000000000000000000000000000000000000000000"),
+			},
+			golden: `{"condition_id":"` + fixtureConditionID + `","oracle":"` + fixtureOracle + `",` +
+				`"question_id":"` + fixtureQuestionID + `","outcome_slot_count":2,"payout_numerators":[1,0]}`,
+		},
+		{
+			name:    "PositionSplit",
+			handler: HandlePositionSplit,
+			log: types.Log{
+				Topics: []common.Hash{PositionSplitSig, addrTopic(fixtureMaker), common.Hash{}, common.HexToHash(fixtureConditionID)},
+				Data: common.FromHex("0x" +
+					"0000000000000000000000002791bca1f2de4661ed88a30c99a7a9449aa84174" + // collateralToken
+					"0000000000000000000000000000000000000000000000000000000000000060" + // offset partition
+					"00000000000000000000000000000000000000000000000000000000017d7840" + // amount
+					"0000000000000000000000000000000000000000000000000000000000000002" +
+					"0000000000000000000000000000000000000000000000000000000000000001" +
+					"0000000000000000000000000000000000000000000000000000000000000002"),
+			},
+			golden: `{"stakeholder":"` + fixtureMaker + `","collateral_token":"0x2791bca1f2de4661ed88a30c99a7a9449aa84174",` +
+				`"parent_collection_id":"0x0000000000000000000000000000000000000000000000000000000000000000",` +
+				`"condition_id":"` + fixtureConditionID + `","partition":[1,2],"amount":25000000,"is_root_collection":true}`,
+		},
+		{
+			name:    "PositionsMerge",
+			handler: HandlePositionsMerge,
+			log: types.Log{
+				Topics: []common.Hash{PositionsMergeSig, addrTopic(fixtureMaker), common.Hash{}, common.HexToHash(fixtureConditionID)},
+				Data: common.FromHex("0x" +
+					"0000000000000000000000002791bca1f2de4661ed88a30c99a7a9449aa84174" +
+					"0000000000000000000000000000000000000000000000000000000000000060" +
+					"00000000000000000000000000000000000000000000000000000000017d7840" +
+					"0000000000000000000000000000000000000000000000000000000000000002" +
+					"0000000000000000000000000000000000000000000000000000000000000001" +
+					"0000000000000000000000000000000000000000000000000000000000000002"),
+			},
+			golden: `{"stakeholder":"` + fixtureMaker + `","collateral_token":"0x2791bca1f2de4661ed88a30c99a7a9449aa84174",` +
+				`"parent_collection_id":"0x0000000000000000000000000000000000000000000000000000000000000000",` +
+				`"condition_id":"` + fixtureConditionID + `","partition":[1,2],"amount":25000000,"is_root_collection":true}`,
+		},
+		{
+			name:    "PayoutRedemption",
+			handler: HandlePayoutRedemption,
+			log: types.Log{
+				Topics: []common.Hash{PayoutRedemptionSig, addrTopic(fixtureMaker),
+					addrTopic("0x2791bca1f2de4661ed88a30c99a7a9449aa84174"), common.Hash{}},
+				Data: common.FromHex("0x" +
+					fixtureConditionID[2:] + // conditionId
+					"0000000000000000000000000000000000000000000000000000000000000060" + // offset indexSets
+					"00000000000000000000000000000000000000000000000000000000017d7840" + // payout
+					"0000000000000000000000000000000000000000000000000000000000000002" +
+					"0000000000000000000000000000000000000000000000000000000000000001" +
+					"0000000000000000000000000000000000000000000000000000000000000002"),
+			},
+			golden: `{"redeemer":"` + fixtureMaker + `","collateral_token":"0x2791bca1f2de4661ed88a30c99a7a9449aa84174",` +
+				`"parent_collection_id":"0x0000000000000000000000000000000000000000000000000000000000000000",` +
+				`"condition_id":"` + fixtureConditionID + `","index_sets":[1,2],"payout":25000000,"is_root_collection":true}`,
+		},
+		{
+			name:    "ERC20Transfer",
+			handler: HandleERC20Transfer,
+			log: types.Log{
+				Address: common.HexToAddress("0x2791Bca1f2de4661ED88A30C99A7a9449Aa84174"),
+				Topics:  []common.Hash{ERC20TransferSig, addrTopic(fixtureMaker), addrTopic(fixtureTaker)},
+				Data:    common.FromHex("0x00000000000000000000000000000000000000000000000000000000017d7840"),
+			},
+			golden: `{"token":"0x2791bca1f2de4661ed88a30c99a7a9449aa84174","from":"` + fixtureMaker + `",` +
+				`"to":"` + fixtureTaker + `","value":25000000}`,
+		},
+	}
+}
+
+// TestHandlersGoldenDecode tests that each handler decodes a synthetic
+// ABI-encoded log into exactly the JSON payload published to NATS.
+func TestHandlersGoldenDecode(t *testing.T) {
+	for _, tt := range handlerCases() {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := tt.handler(context.Background(), tt.log, 0)
+			require.NoError(t, err)
+
+			encoded, err := json.Marshal(payload)
+			require.NoError(t, err)
+			require.Equal(t, tt.golden, string(encoded))
+		})
+	}
+}
+
+// TestHandlerErrorTypes tests that every handler accepts its valid log and
+// returns classifiable errors for wrong topic counts and truncated data.
+func TestHandlerErrorTypes(t *testing.T) {
+	for _, tt := range handlerCases() {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.handler(context.Background(), tt.log, 0)
+			require.NoError(t, err)
+
+			missingTopic := tt.log
+			missingTopic.Topics = tt.log.Topics[:len(tt.log.Topics)-1]
+			_, err = tt.handler(context.Background(), missingTopic, 0)
+			require.ErrorIs(t, err, ErrWrongTopicCount)
+
+			if len(tt.log.Data) == 0 {
+				return // All arguments are indexed
+			}
+
+			truncated := tt.log
+			truncated.Data = tt.log.Data[:31]
+			_, err = tt.handler(context.Background(), truncated, 0)
+			require.ErrorIs(t, err, ErrShortData)
+
+			truncated.Data = nil
+			_, err = tt.handler(context.Background(), truncated, 0)
+			require.ErrorIs(t, err, ErrShortData)
+		})
+	}
+}
+
+// TestHandlerABIUnpackError tests that data with valid heads but a dynamic
+// array pointing past the end of the data is reported as an unpack failure.
+func TestHandlerABIUnpackError(t *testing.T) {
+	log := types.Log{
+		Topics: []common.Hash{TransferBatchSig, {}, {}, {}},
+		Data: common.FromHex("0x" +
+			"0000000000000000000000000000000000000000000000000000000000000040" +
+			"00000000000000000000000000000000000000000000000000000000000000a0"),
+	}
+	_, err := HandleTransferBatch(context.Background(), log, 0)
+	require.ErrorIs(t, err, ErrABIUnpack)
+	require.NotErrorIs(t, err, ErrShortData)
+}
+
+// TestHandleOrderFilledClassification tests the derived side, price and
+// operator-fill fields.
+func TestHandleOrderFilledClassification(t *testing.T) {
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	maker := common.HexToAddress(fixtureMaker)
+	taker := common.HexToAddress(fixtureTaker)
+	token := common.HexToHash(fixtureToken0).Big()
+
+	orderFilledLog := func(t *testing.T, taker common.Address, makerAsset, takerAsset, makerAmount, takerAmount int64) types.Log {
+		t.Helper()
+		data, err := exchangeABI.Events["OrderFilled"].Inputs.NonIndexed().Pack(
+			assetID(makerAsset, token), assetID(takerAsset, token),
+			big.NewInt(makerAmount), big.NewInt(takerAmount), big.NewInt(0),
+		)
+		require.NoError(t, err)
+		return types.Log{
+			Address: exchange,
+			Topics: []common.Hash{
+				OrderFilledSig,
+				common.HexToHash(fixtureOrderHash),
+				common.BytesToHash(maker.Bytes()),
+				common.BytesToHash(taker.Bytes()),
+			},
+			Data: data,
+		}
+	}
+
+	tests := []struct {
+		name         string
+		log          types.Log
+		side         string
+		price        string
+		operatorFill bool
+	}{
+		{
+			name:  "maker buys",
+			log:   orderFilledLog(t, taker, 0, 1, 52_000_000, 100_000_000),
+			side:  models.OrderSideBuy,
+			price: "0.520000",
+		},
+		{
+			name:  "maker sells",
+			log:   orderFilledLog(t, taker, 1, 0, 30_000_000, 12_345_678),
+			side:  models.OrderSideSell,
+			price: "0.411523",
+		},
+		{
+			name:         "operator fill",
+			log:          orderFilledLog(t, exchange, 0, 1, 1_000_000, 2_000_000),
+			side:         models.OrderSideBuy,
+			price:        "0.500000",
+			operatorFill: true,
+		},
+		{
+			name: "zero outcome amount",
+			log:  orderFilledLog(t, taker, 0, 1, 1_000_000, 0),
+			side: models.OrderSideBuy,
+		},
+		{
+			name: "both assets are outcome tokens",
+			log:  orderFilledLog(t, taker, 1, 1, 1_000_000, 1_000_000),
+			side: models.OrderSideUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := HandleOrderFilled(context.Background(), tt.log, 0)
+			require.NoError(t, err)
+
+			fill := payload.(models.OrderFilled)
+			require.Equal(t, tt.side, fill.Side)
+			require.Equal(t, tt.price, fill.Price)
+			require.Equal(t, tt.operatorFill, fill.IsOperatorFill)
+		})
+	}
+}
+
+// assetID returns 0 for collateral and the outcome token ID otherwise.
+func assetID(kind int64, token *big.Int) *big.Int {
+	if kind == 0 {
+		return big.NewInt(0)
+	}
+	return token
+}
+
+// TestHandleConditionResolutionValidatesPayouts tests that resolutions are
+// only accepted when the payouts match the outcome slot count.
+func TestHandleConditionResolutionValidatesPayouts(t *testing.T) {
+	resolutionLog := func(t *testing.T, outcomeSlotCount int64, payouts ...int64) types.Log {
+		t.Helper()
+		numerators := make([]*big.Int, len(payouts))
+		for i, p := range payouts {
+			numerators[i] = big.NewInt(p)
+		}
+		data, err := conditionalTokensABI.Events["ConditionResolution"].Inputs.NonIndexed().Pack(
+			big.NewInt(outcomeSlotCount), numerators,
+		)
+		require.NoError(t, err)
+		return types.Log{
+			Topics: []common.Hash{
+				ConditionResolutionSig,
+				common.HexToHash(fixtureConditionID),
+				common.BytesToHash(common.HexToAddress(fixtureOracle).Bytes()),
+				common.HexToHash(fixtureQuestionID),
+			},
+			Data: data,
+		}
+	}
+
+	t.Run("binary market", func(t *testing.T) {
+		payload, err := HandleConditionResolution(context.Background(), resolutionLog(t, 2, 0, 1), 0)
+		require.NoError(t, err)
+		require.Len(t, payload.(models.ConditionResolution).PayoutNumerators, 2)
+	})
+
+	t.Run("multi-outcome market", func(t *testing.T) {
+		payload, err := HandleConditionResolution(context.Background(), resolutionLog(t, 4, 0, 1, 1, 0), 0)
+		require.NoError(t, err)
+		require.EqualValues(t, 4, payload.(models.ConditionResolution).OutcomeSlotCount)
+	})
+
+	t.Run("truncated payouts", func(t *testing.T) {
+		_, err := HandleConditionResolution(context.Background(), resolutionLog(t, 2, 1), 0)
+		require.ErrorContains(t, err, "got 1 numerators for 2 outcome slots")
+	})
+
+	t.Run("all zero payouts", func(t *testing.T) {
+		_, err := HandleConditionResolution(context.Background(), resolutionLog(t, 2, 0, 0), 0)
+		require.ErrorContains(t, err, "all 2 numerators are zero")
+	})
+
+	t.Run("single outcome slot", func(t *testing.T) {
+		_, err := HandleConditionResolution(context.Background(), resolutionLog(t, 1, 1), 0)
+		require.ErrorContains(t, err, "less than 2")
+	})
+}
+
+// TestHandleConditionPreparationOutcomeSlotCount tests that slot counts above
+// 255 are kept intact and values that do not fit are rejected.
+func TestHandleConditionPreparationOutcomeSlotCount(t *testing.T) {
+	preparationLog := func(t *testing.T, outcomeSlotCount *big.Int) types.Log {
+		t.Helper()
+		data, err := conditionalTokensABI.Events["ConditionPreparation"].Inputs.NonIndexed().Pack(outcomeSlotCount)
+		require.NoError(t, err)
+		return types.Log{
+			Topics: []common.Hash{
+				ConditionPreparationSig,
+				common.HexToHash(fixtureConditionID),
+				addrTopic(fixtureOracle),
+				common.HexToHash(fixtureQuestionID),
+			},
+			Data: data,
+		}
+	}
+
+	payload, err := HandleConditionPreparation(context.Background(), preparationLog(t, big.NewInt(256)), 0)
+	require.NoError(t, err)
+	require.Equal(t, uint32(256), payload.(models.ConditionPreparation).OutcomeSlotCount)
+
+	_, err = HandleConditionPreparation(context.Background(), preparationLog(t, new(big.Int).Lsh(big.NewInt(1), 32)), 0)
+	require.ErrorIs(t, err, ErrInvalidPayload)
+}
+
+// TestHandlerTopicCounts audits the topic count each handler requires
+// against the event layouts (topic0 plus one per indexed argument).
+func TestHandlerTopicCounts(t *testing.T) {
+	tests := []struct {
+		contractABI *abi.ABI
+		event       string
+		topics      int
+	}{
+		{exchangeABI, "OrderFilled", 4},
+		{exchangeABI, "OrderCancelled", 2},
+		{exchangeABI, "TokenRegistered", 4},
+		{conditionalTokensABI, "TransferSingle", 4},
+		{conditionalTokensABI, "TransferBatch", 4},
+		{conditionalTokensABI, "ConditionPreparation", 4},
+		{conditionalTokensABI, "ConditionResolution", 4},
+		{conditionalTokensABI, "PositionSplit", 4},
+		{conditionalTokensABI, "PositionsMerge", 4},
+		{conditionalTokensABI, "PayoutRedemption", 4},
+		{erc20ABI, "Transfer", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			require.Equal(t, tt.topics, topicCount(tt.contractABI.Events[tt.event].Inputs))
+		})
+	}
+
+	for _, tt := range handlerCases() {
+		_, err := tt.handler(context.Background(), types.Log{}, 0)
+		require.ErrorIs(t, err, ErrWrongTopicCount, tt.name)
+	}
+}
+
+// FuzzHandlers feeds truncated topics and arbitrary data to every handler
+// and checks that they never panic and only return typed errors.
+func FuzzHandlers(f *testing.F) {
+	cases := handlerCases()
+	for i, tc := range cases {
+		f.Add(uint8(i), uint8(len(tc.log.Topics)), tc.log.Data)
+		f.Add(uint8(i), uint8(len(tc.log.Topics)-1), tc.log.Data)
+		if len(tc.log.Data) > 0 {
+			f.Add(uint8(i), uint8(len(tc.log.Topics)), tc.log.Data[:len(tc.log.Data)/2])
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, index uint8, topics uint8, data []byte) {
+		tc := cases[int(index)%len(cases)]
+		log := tc.log
+		log.Topics = tc.log.Topics[:min(int(topics), len(tc.log.Topics))]
+		log.Data = data
+
+		_, err := tc.handler(context.Background(), log, 0)
+		if err == nil {
+			return
+		}
+		typed := errors.Is(err, ErrWrongTopicCount) ||
+			errors.Is(err, ErrShortData) ||
+			errors.Is(err, ErrABIUnpack) ||
+			errors.Is(err, ErrInvalidPayload)
+		require.True(t, typed, "untyped error from %s: %v", tc.name, err)
+	})
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ParseABIEvents parses a contract ABI and returns the named events.
+// When no names are given, all non-anonymous events in the ABI are returned.
+func ParseABIEvents(abiJSON []byte, names []string) ([]abi.Event, error) {
+	parsed, err := abi.JSON(bytes.NewReader(abiJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ABI: %w", err)
+	}
+
+	if len(names) == 0 {
+		events := make([]abi.Event, 0, len(parsed.Events))
+		for _, event := range parsed.Events {
+			if !event.Anonymous {
+				events = append(events, event)
+			}
+		}
+		return events, nil
+	}
+
+	events := make([]abi.Event, 0, len(names))
+	for _, name := range names {
+		event, ok := parsed.Events[name]
+		if !ok {
+			return nil, fmt.Errorf("event %s not found in ABI", name)
+		}
+		if event.Anonymous {
+			return nil, fmt.Errorf("event %s is anonymous and cannot be routed", name)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// NewABIHandler returns a handler that decodes any event described by an ABI
+// definition into a map keyed by argument name. It is used for contracts
+// registered at runtime that have no dedicated handler.
+func NewABIHandler(event abi.Event) func(context.Context, types.Log, uint64) (any, error) {
+	var indexed abi.Arguments
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+
+	return func(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
+		if err := requireTopics(log, event.Name, len(indexed)+1); err != nil {
+			return nil, err
+		}
+		if err := checkDataLength(event.Name, event.Inputs, log.Data); err != nil {
+			return nil, err
+		}
+
+		payload := make(map[string]any)
+		if err := event.Inputs.UnpackIntoMap(payload, log.Data); err != nil {
+			return nil, fmt.Errorf("failed to unpack %s data: %w: %w", event.Name, ErrABIUnpack, err)
+		}
+		if err := abi.ParseTopicsIntoMap(payload, indexed, log.Topics[1:]); err != nil {
+			return nil, fmt.Errorf("failed to parse %s topics: %w: %w", event.Name, ErrABIUnpack, err)
+		}
+
+		return payload, nil
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+// vaultABI describes a contract registered at runtime, with an anonymous
+// event that cannot be routed by signature.
+var vaultABI = []byte(`[
+	{"type":"event","name":"Deposit","anonymous":false,"inputs":[
+		{"name":"owner","type":"address","indexed":true},
+		{"name":"assets","type":"uint256","indexed":false},
+		{"name":"memo","type":"string","indexed":false}]},
+	{"type":"event","name":"Paused","anonymous":false,"inputs":[]},
+	{"type":"event","name":"Sweep","anonymous":true,"inputs":[
+		{"name":"to","type":"address","indexed":true}]},
+	{"type":"function","name":"deposit","inputs":[{"name":"assets","type":"uint256"}],"outputs":[]}
+]`)
+
+// TestParseABIEvents tests that all routable events are returned when no
+// names are given, and only the named ones otherwise.
+func TestParseABIEvents(t *testing.T) {
+	events, err := ParseABIEvents(vaultABI, nil)
+	require.NoError(t, err)
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = event.Name
+	}
+	require.ElementsMatch(t, []string{"Deposit", "Paused"}, names)
+
+	events, err = ParseABIEvents(vaultABI, []string{"Deposit"})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, crypto.Keccak256Hash([]byte("Deposit(address,uint256,string)")), events[0].ID)
+
+	_, err = ParseABIEvents(vaultABI, []string{"Deposit", "Withdraw"})
+	require.ErrorContains(t, err, "event Withdraw not found in ABI")
+
+	_, err = ParseABIEvents(vaultABI, []string{"Sweep"})
+	require.ErrorContains(t, err, "event Sweep is anonymous")
+
+	_, err = ParseABIEvents([]byte(`{"not":"an abi"}`), nil)
+	require.ErrorContains(t, err, "failed to parse ABI")
+}
+
+// TestNewABIHandler tests that the generic handler decodes indexed and
+// non-indexed arguments by name, and rejects malformed logs with typed
+// errors.
+func TestNewABIHandler(t *testing.T) {
+	events, err := ParseABIEvents(vaultABI, []string{"Deposit"})
+	require.NoError(t, err)
+	deposit := events[0]
+
+	owner := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	data, err := deposit.Inputs.NonIndexed().Pack(big.NewInt(1_000_000), "first deposit")
+	require.NoError(t, err)
+	log := types.Log{
+		Topics: []common.Hash{deposit.ID, common.BytesToHash(owner.Bytes())},
+		Data:   data,
+	}
+
+	handle := NewABIHandler(deposit)
+	payload, err := handle(context.Background(), log, 1_700_000_000)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"owner":  owner,
+		"assets": big.NewInt(1_000_000),
+		"memo":   "first deposit",
+	}, payload)
+
+	_, err = handle(context.Background(), types.Log{Topics: log.Topics[:1], Data: data}, 0)
+	require.ErrorIs(t, err, ErrWrongTopicCount)
+
+	_, err = handle(context.Background(), types.Log{Topics: log.Topics, Data: data[:32]}, 0)
+	require.ErrorIs(t, err, ErrShortData)
+
+	// The string offset points past the data
+	corrupt := append([]byte(nil), data...)
+	corrupt[63] = 0xff
+	_, err = handle(context.Background(), types.Log{Topics: log.Topics, Data: corrupt}, 0)
+	require.ErrorIs(t, err, ErrABIUnpack)
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/stretchr/testify/require"
+)
+
+// capture makes TestHandlersDecodePolygonLogs fetch its logs from the
+// Polygon RPC in POLYGON_RPC_URL before decoding them:
+//
+//	POLYGON_RPC_URL=https://polygon-rpc.com go test ./internal/handler/ -run TestHandlersDecodePolygonLogs -capture
+//
+// Check the transaction hashes and decoded payloads of a capture against a
+// block explorer before committing it.
+var capture = flag.Bool("capture", false, "capture the Polygon logs of the golden tests")
+
+// polygonLogsDir holds one captured log per handler, named after it.
+const polygonLogsDir = "testdata/polygon"
+
+// Capture window: logs are searched backwards from the last final block, in
+// ranges public RPCs accept, for up to about a month of blocks.
+const (
+	captureConfirmations = 100
+	captureRange         = 500
+	captureMaxRanges     = 2_500
+)
+
+// polygonContracts are the Polygon mainnet contracts emitting the events of
+// each handler (config/chains.json, USDC.e for collateral transfers).
+var polygonContracts = map[string]common.Address{
+	"OrderFilled":          common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E"),
+	"OrderCancelled":       common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E"),
+	"TokenRegistered":      common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E"),
+	"TransferSingle":       common.HexToAddress("0x4D97DCd97eC945f40cF65F87097ACe5EA0476045"),
+	"TransferBatch":        common.HexToAddress("0x4D97DCd97eC945f40cF65F87097ACe5EA0476045"),
+	"ConditionPreparation": common.HexToAddress("0x4D97DCd97eC945f40cF65F87097ACe5EA0476045"),
+	"ConditionResolution":  common.HexToAddress("0x4D97DCd97eC945f40cF65F87097ACe5EA0476045"),
+	"PositionSplit":        common.HexToAddress("0x4D97DCd97eC945f40cF65F87097ACe5EA0476045"),
+	"PositionsMerge":       common.HexToAddress("0x4D97DCd97eC945f40cF65F87097ACe5EA0476045"),
+	"PayoutRedemption":     common.HexToAddress("0x4D97DCd97eC945f40cF65F87097ACe5EA0476045"),
+	"ERC20Transfer":        common.HexToAddress("0x2791Bca1f2de4661ED88A30C99A7a9449Aa84174"),
+}
+
+// polygonLog is a captured log and the payload its handler decodes it into.
+// The log records its block, transaction hash and log index.
+type polygonLog struct {
+	Log     *types.Log      `json:"log"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// TestHandlersDecodePolygonLogs tests that each handler decodes a log
+// captured from Polygon mainnet into exactly the captured payload. Handlers
+// without a captured log are skipped.
+func TestHandlersDecodePolygonLogs(t *testing.T) {
+	if *capture {
+		captureLogs(t)
+	}
+
+	for _, tt := range handlerCases() {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join(polygonLogsDir, tt.name+".json"))
+			if errors.Is(err, os.ErrNotExist) {
+				t.Skipf("no captured log in %s, run the test with -capture", polygonLogsDir)
+			}
+			require.NoError(t, err)
+
+			var captured polygonLog
+			require.NoError(t, json.Unmarshal(data, &captured))
+			require.Equal(t, polygonContracts[tt.name], captured.Log.Address)
+			require.Equal(t, tt.log.Topics[0], captured.Log.Topics[0])
+
+			payload, err := tt.handler(context.Background(), *captured.Log, 0)
+			require.NoError(t, err, "tx %s log %d", captured.Log.TxHash, captured.Log.Index)
+
+			encoded, err := json.Marshal(payload)
+			require.NoError(t, err)
+			golden, err := compactJSON(captured.Payload)
+			require.NoError(t, err)
+			require.Equal(t, golden, string(encoded), "tx %s log %d", captured.Log.TxHash, captured.Log.Index)
+		})
+	}
+}
+
+// captureLogs writes the last final log of every handled event to
+// polygonLogsDir, with the payload its handler decodes it into.
+func captureLogs(t *testing.T) {
+	url := os.Getenv("POLYGON_RPC_URL")
+	if url == "" {
+		t.Fatal("-capture needs POLYGON_RPC_URL")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	client, err := ethclient.DialContext(ctx, url)
+	require.NoError(t, err)
+	defer client.Close()
+	head, err := client.BlockNumber(ctx)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(polygonLogsDir, 0o755))
+
+	for _, tt := range handlerCases() {
+		log := lastLog(ctx, t, client, head-captureConfirmations, polygonContracts[tt.name], tt.log.Topics[0])
+		payload, err := tt.handler(ctx, log, 0)
+		require.NoError(t, err, "%s: tx %s log %d", tt.name, log.TxHash, log.Index)
+		encoded, err := json.Marshal(payload)
+		require.NoError(t, err)
+
+		data, err := json.MarshalIndent(polygonLog{Log: &log, Payload: encoded}, "", "  ")
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(polygonLogsDir, tt.name+".json"), append(data, '\n'), 0o644))
+		t.Logf("captured %s: tx %s log %d", tt.name, log.TxHash, log.Index)
+	}
+}
+
+// lastLog returns the last log of an event emitted by contract at or
+// before block to.
+func lastLog(ctx context.Context, t *testing.T, client *ethclient.Client, to uint64, contract common.Address, sig common.Hash) types.Log {
+	for range captureMaxRanges {
+		from := to - captureRange + 1
+		logs, err := client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(to),
+			Addresses: []common.Address{contract},
+			Topics:    [][]common.Hash{{sig}},
+		})
+		require.NoError(t, err)
+		if len(logs) > 0 {
+			return logs[len(logs)-1]
+		}
+		to = from - 1
+	}
+	t.Fatalf("no %s log of %s in the last %d blocks", sig, contract, captureRange*captureMaxRanges)
+	return types.Log{}
+}
+
+// compactJSON returns data without insignificant whitespace.
+func compactJSON(data []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
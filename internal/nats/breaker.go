@@ -0,0 +1,155 @@
+package nats
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var circuitState = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "polymarket_nats_circuit_state",
+	Help: "State of the NATS publish circuit breaker (0 = closed, 1 = half-open, 2 = open)",
+})
+
+const (
+	// DefaultBreakerThreshold is the default number of consecutive publish
+	// failures that open the circuit breaker
+	DefaultBreakerThreshold = 5
+
+	// DefaultBreakerCooldown is the default time the circuit breaker stays
+	// open before letting a probe publish through
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// breakerState is the state of a circuitBreaker. The values are those of the
+// polymarket_nats_circuit_state gauge.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+// CircuitOpenError is returned by Publish while the circuit breaker is open:
+// NATS failed repeatedly and the publish was not attempted. It is not
+// temporary, so the router does not retry it; the block is retried instead.
+type CircuitOpenError struct {
+	Failures int       // Consecutive failures that opened the breaker
+	RetryAt  time.Time // When the next probe publish is let through
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("NATS circuit breaker open after %d consecutive failures, probing at %s",
+		e.Failures, e.RetryAt.Format(time.RFC3339))
+}
+
+// circuitBreaker fails publishes fast once NATS is down. It opens after
+// threshold consecutive failures; after cooldown it turns half-open and lets
+// a single probe through, which closes it on success and reopens it on
+// failure.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool // A half-open probe is in flight
+}
+
+// newCircuitBreaker creates a closed circuit breaker. Non-positive settings
+// select the defaults.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns a CircuitOpenError unless a publish may be attempted. Every
+// allowed publish must be followed by success or failure.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return b.openError()
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return b.openError()
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// success records a successful publish and closes the breaker.
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.setState(breakerClosed)
+}
+
+// failure records a failed publish. It opens the breaker when the threshold
+// is reached or a half-open probe failed, and reports whether it did.
+func (b *circuitBreaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == breakerOpen || (b.state == breakerClosed && b.failures < b.threshold) {
+		return false
+	}
+	b.openedAt = b.now()
+	b.setState(breakerOpen)
+	return true
+}
+
+// release ends an allowed publish that was abandoned by its caller without
+// recording a result, so a half-open breaker lets the next probe through.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// isOpen reports whether publishes are failing fast.
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerOpen
+}
+
+func (b *circuitBreaker) openError() error {
+	return &CircuitOpenError{Failures: b.failures, RetryAt: b.openedAt.Add(b.cooldown)}
+}
+
+func (b *circuitBreaker) setState(state breakerState) {
+	b.state = state
+	circuitState.Set(float64(state))
+}
@@ -0,0 +1,79 @@
+package nats
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// testBreaker returns a circuit breaker whose clock is advanced by the
+// returned function.
+func testBreaker(threshold int, cooldown time.Duration) (*circuitBreaker, func(time.Duration)) {
+	b := newCircuitBreaker(threshold, cooldown)
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+// TestCircuitBreakerOpensAfterThreshold tests that the breaker opens after
+// the configured number of consecutive failures, and that a success resets
+// the count.
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	b, _ := testBreaker(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.allow())
+		require.False(t, b.failure())
+	}
+	require.NoError(t, b.allow())
+	b.success()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.allow())
+		require.False(t, b.failure())
+	}
+	require.NoError(t, b.allow())
+	require.True(t, b.failure())
+	require.True(t, b.isOpen())
+	require.Equal(t, float64(breakerOpen), testutil.ToFloat64(circuitState))
+
+	var openErr *CircuitOpenError
+	require.True(t, errors.As(b.allow(), &openErr))
+	require.Equal(t, 3, openErr.Failures)
+}
+
+// TestCircuitBreakerHalfOpenProbe tests that after the cooldown a single
+// probe is let through, which closes the breaker on success and reopens it
+// on failure.
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	b, advance := testBreaker(1, time.Minute)
+
+	require.NoError(t, b.allow())
+	require.True(t, b.failure())
+
+	advance(59 * time.Second)
+	require.Error(t, b.allow())
+
+	// Failed probe: open for another cooldown
+	advance(time.Second)
+	require.NoError(t, b.allow())
+	require.Equal(t, float64(breakerHalfOpen), testutil.ToFloat64(circuitState))
+	require.Error(t, b.allow(), "only one probe at a time")
+	require.True(t, b.failure())
+	require.Error(t, b.allow())
+
+	// Abandoned probe: the next publish probes instead
+	advance(time.Minute)
+	require.NoError(t, b.allow())
+	b.release()
+	require.NoError(t, b.allow())
+
+	// Successful probe: closed
+	b.success()
+	require.False(t, b.isOpen())
+	require.Equal(t, float64(breakerClosed), testutil.ToFloat64(circuitState))
+	require.NoError(t, b.allow())
+}
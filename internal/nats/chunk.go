@@ -0,0 +1,54 @@
+package nats
+
+import (
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+)
+
+// chunkHeaderReserve is the room kept in every chunk for its PM-Chunk and
+// PM-Chunk-ID headers and the chunk suffix of its deduplication ID, beyond
+// the two copies of the message's deduplication ID they carry
+const chunkHeaderReserve = 128
+
+// outMsg is a message to publish with its deduplication ID.
+type outMsg struct {
+	msg   *nats.Msg
+	msgID string
+}
+
+// chunkMsg returns msg alone when it fits within maxPayload bytes (0 =
+// unlimited), and otherwise the chunk messages it is split into: each
+// carries the headers of msg, its PM-Chunk headers (see codec.Chunk) and
+// the next slice of its payload, and is deduplicated as
+// {msgID}-chunk-{i}-{n}. Splitting is deterministic, so a republished event
+// is deduplicated chunk by chunk.
+func chunkMsg(msg *nats.Msg, msgID string, maxPayload int) ([]outMsg, error) {
+	// The server's limit covers the headers, which the subject is counted
+	// with here to stay on the safe side
+	headers := msg.Size() - len(msg.Data) + len(jetstream.MsgIDHeader) + len(msgID) + 4
+	if maxPayload <= 0 || headers+len(msg.Data) <= maxPayload {
+		return []outMsg{{msg: msg, msgID: msgID}}, nil
+	}
+
+	room := maxPayload - headers - len(msgID) - chunkHeaderReserve
+	if room <= 0 {
+		return nil, fmt.Errorf("%w: headers of %d bytes leave no room for the payload within the max payload of %d bytes",
+			ErrMarshal, headers, maxPayload)
+	}
+	count := (len(msg.Data) + room - 1) / room
+	chunks := make([]outMsg, count)
+	for i := range chunks {
+		chunk := nats.NewMsg(msg.Subject)
+		for key, values := range msg.Header {
+			chunk.Header[key] = append([]string(nil), values...)
+		}
+		codec.Chunk{ID: msgID, Index: i + 1, Count: count}.SetHeaders(chunk.Header)
+		chunk.Data = msg.Data[i*room : min((i+1)*room, len(msg.Data))]
+		chunks[i] = outMsg{msg: chunk, msgID: fmt.Sprintf("%s-chunk-%d-%d", msgID, i+1, count)}
+	}
+	return chunks, nil
+}
@@ -0,0 +1,136 @@
+package nats
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// testMaxPayload is a server max payload below the 1 MB default, which an
+// airdrop batch of 5,000 transfers exceeds
+const testMaxPayload = 256 * 1024
+
+// airdropEvent returns a synthetic TransferBatch of n outcome tokens, with
+// token IDs as random-looking as position IDs, so they do not compress
+// away.
+func airdropEvent(n int) models.Event {
+	transfer := models.TransferBatch{
+		Operator: "0x1111111111111111111111111111111111111111",
+		From:     "0x0000000000000000000000000000000000000000",
+		To:       "0x3333333333333333333333333333333333333333",
+	}
+	for i := range n {
+		id := sha256.Sum256([]byte(strconv.Itoa(i)))
+		transfer.TokenIDs = append(transfer.TokenIDs, new(big.Int).SetBytes(id[:]))
+		transfer.Amounts = append(transfer.Amounts, big.NewInt(1_000_000))
+	}
+	return models.Event{
+		Block:        100,
+		BlockHash:    fmt.Sprintf("0x%064x", 0xb1),
+		TxHash:       fmt.Sprintf("0x%064x", 0xa1),
+		LogIndex:     3,
+		ContractAddr: "0x4D97DCd97eC945f40cF65F87097ACe5EA0476045",
+		EventName:    "TransferBatch",
+		Payload:      transfer,
+		Success:      true,
+	}
+}
+
+// reassemble checks that msgs are the chunks of one message, in order and
+// within testMaxPayload, and returns its payload.
+func reassemble(t *testing.T, msgs []*nats.Msg) []byte {
+	t.Helper()
+	var data []byte
+	for i, msg := range msgs {
+		require.LessOrEqual(t, msg.Size(), testMaxPayload)
+		chunk, ok, err := codec.ChunkFromHeaders(msg.Header)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, i+1, chunk.Index)
+		require.Equal(t, len(msgs), chunk.Count)
+		require.Equal(t, fmt.Sprintf("0x%064x-3-0x%064x-TransferBatch", 0xa1, 0xb1), chunk.ID)
+		require.Equal(t, "TransferBatch", msg.Header.Get(codec.HeaderEvent))
+		require.Equal(t, msgs[0].Subject, msg.Subject)
+		data = append(data, msg.Data...)
+	}
+	return data
+}
+
+// TestPublishChunksOversizedEvent tests that an event exceeding the max
+// payload is published as chunks that each fit and together hold its
+// message, and that smaller events are published whole.
+func TestPublishChunksOversizedEvent(t *testing.T) {
+	event := airdropEvent(5000)
+	chunked := testutil.ToFloat64(chunkedPublishes.WithLabelValues("TransferBatch"))
+
+	js := &fakeJetStream{}
+	p := newFakePublisher(js)
+	p.maxPayload = testMaxPayload
+	require.NoError(t, p.Publish(context.Background(), event))
+	require.Greater(t, len(js.published), 1)
+	require.Equal(t, chunked+1, testutil.ToFloat64(chunkedPublishes.WithLabelValues("TransferBatch")))
+
+	var decoded models.Event
+	require.NoError(t, codec.JSON.Unmarshal(reassemble(t, js.published), &decoded))
+	require.Equal(t, event.TxHash, decoded.TxHash)
+	payload, err := json.Marshal(decoded.Payload)
+	require.NoError(t, err)
+	var transfer models.TransferBatch
+	require.NoError(t, json.Unmarshal(payload, &transfer))
+	require.Equal(t, event.Payload, transfer)
+
+	js = &fakeJetStream{}
+	p = newFakePublisher(js)
+	p.maxPayload = testMaxPayload
+	require.NoError(t, p.Publish(context.Background(), airdropEvent(10)))
+	require.Len(t, js.published, 1)
+	require.Empty(t, js.published[0].Header.Get(codec.HeaderChunk))
+}
+
+// TestPublishBatchChunks tests that the chunks of an event are published
+// asynchronously, compressed as a whole, and that the event counts as
+// published once all of them are acknowledged.
+func TestPublishBatchChunks(t *testing.T) {
+	js := &fakeJetStream{}
+	p := newFakePublisher(js, WithCodec(codec.Protobuf), WithCompression(codec.Gzip, 512))
+	p.maxPayload = 16 * 1024
+
+	result := p.PublishBatch(context.Background(), []models.Event{airdropEvent(5000)})
+	require.Equal(t, 1, result.Published)
+	require.Empty(t, result.Failed)
+	require.Greater(t, len(js.published), 1)
+
+	var data []byte
+	for _, msg := range js.published {
+		require.LessOrEqual(t, msg.Size(), p.maxPayload)
+		require.Equal(t, "gzip", msg.Header.Get(codec.HeaderContentEncoding))
+		data = append(data, msg.Data...)
+	}
+	data, err := codec.Decompress("gzip", data)
+	require.NoError(t, err)
+	var decoded models.Event
+	require.NoError(t, codec.Protobuf.Unmarshal(data, &decoded))
+	require.Len(t, decoded.Payload.(models.TransferBatch).TokenIDs, 5000)
+}
+
+// TestChunkMsgWithoutRoom tests that a max payload the headers alone
+// exceed fails the event as unpublishable instead of retrying it.
+func TestChunkMsgWithoutRoom(t *testing.T) {
+	p := newFakePublisher(&fakeJetStream{})
+	msg, msgID, err := p.encode(airdropEvent(10))
+	require.NoError(t, err)
+
+	_, err = chunkMsg(msg, msgID, 256)
+	require.ErrorIs(t, err, ErrMarshal)
+}
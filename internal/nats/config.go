@@ -0,0 +1,234 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// defaultDuplicateWindow is the deduplication window used when none is
+// configured.
+const defaultDuplicateWindow = 20 * time.Minute
+
+var (
+	// ErrInvalidConfig is returned when the stream configuration is unusable.
+	ErrInvalidConfig = errors.New("invalid NATS stream config")
+
+	// ErrStreamMismatch is returned when an existing stream the indexer does
+	// not manage cannot store the configured subjects.
+	ErrStreamMismatch = errors.New("NATS stream does not match config")
+)
+
+// PublisherConfig describes the JetStream stream the indexer publishes to and
+// the consumer reads from. Both binaries build it with LoadPublisherConfig so
+// they cannot disagree on names.
+type PublisherConfig struct {
+	StreamName       string                  // JetStream stream name
+	SubjectPrefix    string                  // First subject token; the stream covers "{prefix}.>"
+	MaxAge           time.Duration           // Retention (0 = unlimited)
+	Storage          jetstream.StorageType   // File or memory storage
+	Replicas         int                     // Stream replicas (0 = 1)
+	DuplicateWindow  time.Duration           // Message ID deduplication window (0 = 20m)
+	MaxBytes         int64                   // Size limit in bytes (0 = unlimited)
+	Discard          jetstream.DiscardPolicy // What to drop when a limit is reached (default old)
+	PlacementCluster string                  // Cluster to place the stream in (empty = any)
+	PlacementTags    []string                // Server tags the stream's peers must have
+
+	// ManageStream makes the indexer create the stream or update it to this
+	// config on startup. When false the stream must already exist and is only
+	// checked for the configured subjects, so settings an operator made by
+	// hand (e.g. replicas) are never overwritten.
+	ManageStream bool
+}
+
+// LoadPublisherConfig reads the [nats] section of the configuration, applies
+// defaults and validates the result.
+func LoadPublisherConfig(ko *koanf.Koanf) (PublisherConfig, error) {
+	storage, err := ParseStorage(ko.String("nats.storage"))
+	if err != nil {
+		return PublisherConfig{}, err
+	}
+	discard, err := ParseDiscard(ko.String("nats.discard"))
+	if err != nil {
+		return PublisherConfig{}, err
+	}
+
+	cfg := PublisherConfig{
+		StreamName:       ko.String("nats.stream_name"),
+		SubjectPrefix:    ko.String("nats.subject_prefix"),
+		MaxAge:           ko.Duration("nats.max_age"),
+		Storage:          storage,
+		Replicas:         ko.Int("nats.replicas"),
+		DuplicateWindow:  ko.Duration("nats.duplicate_window"),
+		MaxBytes:         ko.Int64("nats.max_bytes"),
+		Discard:          discard,
+		PlacementCluster: ko.String("nats.placement_cluster"),
+		PlacementTags:    ko.Strings("nats.placement_tags"),
+		// The stream is managed unless explicitly disabled
+		ManageStream: !ko.Exists("nats.manage_stream") || ko.Bool("nats.manage_stream"),
+	}.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return PublisherConfig{}, err
+	}
+	return cfg, nil
+}
+
+// ParseStorage parses a storage type: "file" (the default when empty) or
+// "memory".
+func ParseStorage(storage string) (jetstream.StorageType, error) {
+	switch strings.ToLower(storage) {
+	case "", "file":
+		return jetstream.FileStorage, nil
+	case "memory":
+		return jetstream.MemoryStorage, nil
+	default:
+		return 0, fmt.Errorf("%w: unknown storage %q (want file or memory)", ErrInvalidConfig, storage)
+	}
+}
+
+// ParseDiscard parses a discard policy: "old" (the default when empty)
+// drops the oldest messages when a limit is reached, "new" rejects new ones.
+func ParseDiscard(discard string) (jetstream.DiscardPolicy, error) {
+	switch strings.ToLower(discard) {
+	case "", "old":
+		return jetstream.DiscardOld, nil
+	case "new":
+		return jetstream.DiscardNew, nil
+	default:
+		return 0, fmt.Errorf("%w: unknown discard policy %q (want old or new)", ErrInvalidConfig, discard)
+	}
+}
+
+// withDefaults fills in the zero-valued optional fields.
+func (c PublisherConfig) withDefaults() PublisherConfig {
+	if c.Replicas == 0 {
+		c.Replicas = 1
+	}
+	if c.DuplicateWindow == 0 {
+		c.DuplicateWindow = defaultDuplicateWindow
+	}
+	return c
+}
+
+// Validate checks that the stream name and subject prefix are single NATS
+// tokens and that the limits are consistent.
+func (c PublisherConfig) Validate() error {
+	if err := validateToken("stream name", c.StreamName, `/\`); err != nil {
+		return err
+	}
+	if err := validateToken("subject prefix", c.SubjectPrefix, ""); err != nil {
+		return err
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("%w: negative max age %s", ErrInvalidConfig, c.MaxAge)
+	}
+	if c.Replicas < 0 {
+		return fmt.Errorf("%w: negative replicas %d", ErrInvalidConfig, c.Replicas)
+	}
+	if c.DuplicateWindow < 0 {
+		return fmt.Errorf("%w: negative duplicate window %s", ErrInvalidConfig, c.DuplicateWindow)
+	}
+	if c.MaxBytes < 0 {
+		return fmt.Errorf("%w: negative max bytes %d", ErrInvalidConfig, c.MaxBytes)
+	}
+	for _, tag := range c.PlacementTags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("%w: empty placement tag", ErrInvalidConfig)
+		}
+	}
+	// JetStream rejects a deduplication window longer than the retention
+	if c.MaxAge > 0 && c.DuplicateWindow > c.MaxAge {
+		return fmt.Errorf("%w: duplicate window %s exceeds max age %s", ErrInvalidConfig, c.DuplicateWindow, c.MaxAge)
+	}
+	return nil
+}
+
+// SubjectPattern returns the stream subject pattern, see SubjectPattern.
+func (c PublisherConfig) SubjectPattern() string {
+	return SubjectPattern(c.SubjectPrefix)
+}
+
+// StreamConfig returns the JetStream configuration of the stream.
+func (c PublisherConfig) StreamConfig() jetstream.StreamConfig {
+	cfg := jetstream.StreamConfig{
+		Name:       c.StreamName,
+		Subjects:   []string{c.SubjectPattern()},
+		MaxAge:     c.MaxAge,
+		MaxBytes:   c.MaxBytes,
+		Discard:    c.Discard,
+		Storage:    c.Storage,
+		Replicas:   c.Replicas,
+		Duplicates: c.DuplicateWindow,
+		Retention:  jetstream.LimitsPolicy,
+	}
+	if c.MaxBytes == 0 {
+		cfg.MaxBytes = -1 // Unlimited
+	}
+	if c.PlacementCluster != "" || len(c.PlacementTags) > 0 {
+		cfg.Placement = &jetstream.Placement{
+			Cluster: c.PlacementCluster,
+			Tags:    c.PlacementTags,
+		}
+	}
+	return cfg
+}
+
+// CheckStream checks that an existing stream stores every subject published
+// under the configured prefix.
+func (c PublisherConfig) CheckStream(info *jetstream.StreamInfo) error {
+	pattern := c.SubjectPattern()
+	for _, subject := range info.Config.Subjects {
+		if subjectCovers(subject, pattern) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: stream %s subjects %v do not cover %q",
+		ErrStreamMismatch, info.Config.Name, info.Config.Subjects, pattern)
+}
+
+// subjectCovers reports whether every subject matching pattern also matches
+// filter. Both may contain the "*" and ">" wildcards.
+func subjectCovers(filter, pattern string) bool {
+	filterTokens := strings.Split(filter, ".")
+	patternTokens := strings.Split(pattern, ".")
+	for i, token := range filterTokens {
+		if token == ">" {
+			return len(patternTokens) > i
+		}
+		if i >= len(patternTokens) {
+			return false
+		}
+		switch patternTokens[i] {
+		case ">":
+			return false
+		case "*":
+			if token != "*" {
+				return false
+			}
+		default:
+			if token != "*" && token != patternTokens[i] {
+				return false
+			}
+		}
+	}
+	return len(filterTokens) == len(patternTokens)
+}
+
+// validateToken checks that value is a non-empty subject token: no
+// whitespace, separators or wildcards, nor any of the extra characters.
+func validateToken(field, value, extra string) error {
+	if value == "" {
+		return fmt.Errorf("%w: %s is empty", ErrInvalidConfig, field)
+	}
+	for _, r := range value {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune(".*>"+extra, r) {
+			return fmt.Errorf("%w: %s %q contains %q", ErrInvalidConfig, field, value, r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPublisherConfigValidate tests that stream names and subject prefixes
+// must be single NATS tokens and that the limits must be consistent.
+func TestPublisherConfigValidate(t *testing.T) {
+	valid := PublisherConfig{
+		StreamName:      "POLYMARKET_EVENTS",
+		SubjectPrefix:   "POLYMARKET",
+		MaxAge:          168 * time.Hour,
+		Replicas:        1,
+		DuplicateWindow: 20 * time.Minute,
+	}
+	require.NoError(t, valid.Validate())
+	require.Equal(t, "POLYMARKET.>", valid.SubjectPattern())
+
+	tests := []struct {
+		name   string
+		modify func(*PublisherConfig)
+	}{
+		{"empty stream name", func(c *PublisherConfig) { c.StreamName = "" }},
+		{"stream name with dot", func(c *PublisherConfig) { c.StreamName = "POLYMARKET.EVENTS" }},
+		{"stream name with slash", func(c *PublisherConfig) { c.StreamName = "POLYMARKET/EVENTS" }},
+		{"stream name with space", func(c *PublisherConfig) { c.StreamName = "POLYMARKET EVENTS" }},
+		{"empty prefix", func(c *PublisherConfig) { c.SubjectPrefix = "" }},
+		{"prefix with wildcard", func(c *PublisherConfig) { c.SubjectPrefix = "POLYMARKET.*" }},
+		{"prefix with full wildcard", func(c *PublisherConfig) { c.SubjectPrefix = ">" }},
+		{"prefix with tab", func(c *PublisherConfig) { c.SubjectPrefix = "POLY\tMARKET" }},
+		{"negative max age", func(c *PublisherConfig) { c.MaxAge = -time.Hour }},
+		{"negative replicas", func(c *PublisherConfig) { c.Replicas = -1 }},
+		{"duplicate window above max age", func(c *PublisherConfig) { c.MaxAge = time.Minute }},
+		{"negative max bytes", func(c *PublisherConfig) { c.MaxBytes = -1 }},
+		{"empty placement tag", func(c *PublisherConfig) { c.PlacementTags = []string{"az:us-east-1a", " "} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			require.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+		})
+	}
+}
+
+// TestLoadPublisherConfig tests that the [nats] keys are read with defaults
+// for the optional ones.
+func TestLoadPublisherConfig(t *testing.T) {
+	ko := koanf.New(".")
+	for key, value := range map[string]string{
+		"nats.stream_name":    "POLYMARKET_EVENTS",
+		"nats.subject_prefix": "POLYMARKET",
+		"nats.max_age":        "168h",
+		"nats.storage":        "memory",
+	} {
+		require.NoError(t, ko.Set(key, value))
+	}
+
+	cfg, err := LoadPublisherConfig(ko)
+	require.NoError(t, err)
+	require.Equal(t, PublisherConfig{
+		StreamName:      "POLYMARKET_EVENTS",
+		SubjectPrefix:   "POLYMARKET",
+		MaxAge:          168 * time.Hour,
+		Storage:         jetstream.MemoryStorage,
+		Replicas:        1,
+		DuplicateWindow: defaultDuplicateWindow,
+		Discard:         jetstream.DiscardOld,
+		PlacementTags:   []string{},
+		ManageStream:    true,
+	}, cfg)
+
+	for key, value := range map[string]any{
+		"nats.replicas":          3,
+		"nats.max_bytes":         int64(50 << 30),
+		"nats.discard":           "new",
+		"nats.placement_cluster": "nats-east",
+		"nats.placement_tags":    []string{"ssd"},
+		"nats.manage_stream":     false,
+	} {
+		require.NoError(t, ko.Set(key, value))
+	}
+	cfg, err = LoadPublisherConfig(ko)
+	require.NoError(t, err)
+	require.Equal(t, 3, cfg.Replicas)
+	require.Equal(t, int64(50<<30), cfg.MaxBytes)
+	require.Equal(t, jetstream.DiscardNew, cfg.Discard)
+	require.Equal(t, "nats-east", cfg.PlacementCluster)
+	require.Equal(t, []string{"ssd"}, cfg.PlacementTags)
+	require.False(t, cfg.ManageStream)
+
+	require.NoError(t, ko.Set("nats.discard", "oldest"))
+	_, err = LoadPublisherConfig(ko)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+
+	require.NoError(t, ko.Set("nats.discard", "old"))
+	require.NoError(t, ko.Set("nats.storage", "disk"))
+	_, err = LoadPublisherConfig(ko)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+// TestStreamConfig tests the JetStream configuration built for the stream.
+func TestStreamConfig(t *testing.T) {
+	cfg := PublisherConfig{
+		StreamName:      "POLYMARKET_EVENTS",
+		SubjectPrefix:   "POLYMARKET",
+		MaxAge:          time.Hour,
+		Storage:         jetstream.FileStorage,
+		Replicas:        3,
+		DuplicateWindow: time.Minute,
+		Discard:         jetstream.DiscardNew,
+	}
+	require.Equal(t, jetstream.StreamConfig{
+		Name:       "POLYMARKET_EVENTS",
+		Subjects:   []string{"POLYMARKET.>"},
+		MaxAge:     time.Hour,
+		MaxBytes:   -1,
+		Discard:    jetstream.DiscardNew,
+		Storage:    jetstream.FileStorage,
+		Replicas:   3,
+		Duplicates: time.Minute,
+		Retention:  jetstream.LimitsPolicy,
+	}, cfg.StreamConfig())
+
+	cfg.MaxBytes = 1 << 30
+	cfg.PlacementTags = []string{"ssd"}
+	streamCfg := cfg.StreamConfig()
+	require.Equal(t, int64(1<<30), streamCfg.MaxBytes)
+	require.Equal(t, &jetstream.Placement{Tags: []string{"ssd"}}, streamCfg.Placement)
+}
+
+// TestCheckStream tests that an unmanaged stream must store every subject
+// published under the prefix.
+func TestCheckStream(t *testing.T) {
+	cfg := PublisherConfig{StreamName: "POLYMARKET_EVENTS", SubjectPrefix: "POLYMARKET"}
+
+	for _, subjects := range [][]string{
+		{"POLYMARKET.>"},
+		{"OTHER.>", "POLYMARKET.>"},
+		{">"},
+		{"*.>"},
+	} {
+		info := &jetstream.StreamInfo{Config: jetstream.StreamConfig{Name: "POLYMARKET_EVENTS", Subjects: subjects}}
+		require.NoError(t, cfg.CheckStream(info), subjects)
+	}
+
+	for _, subjects := range [][]string{
+		nil,
+		{"POLYMARKET.*"},
+		{"POLYMARKET.OrderFilled.>"},
+		{"POLYMARKET"},
+		{"OTHER.>"},
+	} {
+		info := &jetstream.StreamInfo{Config: jetstream.StreamConfig{Name: "POLYMARKET_EVENTS", Subjects: subjects}}
+		require.ErrorIs(t, cfg.CheckStream(info), ErrStreamMismatch, subjects)
+	}
+}
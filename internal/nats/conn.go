@@ -0,0 +1,113 @@
+package nats
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/nats-io/nats.go"
+)
+
+// ErrInvalidConnConfig is returned when the NATS TLS or credential settings
+// are incomplete or name files that cannot be used.
+var ErrInvalidConnConfig = errors.New("invalid NATS connection config")
+
+// ConnConfig holds the TLS and authentication settings of the NATS
+// connection. The indexer and the consumer both build it with
+// LoadConnConfig. Empty fields are not used.
+type ConnConfig struct {
+	TLSCAFile   string // PEM CA bundle verifying the server (default: system roots)
+	TLSCertFile string // PEM client certificate for mutual TLS
+	TLSKeyFile  string // PEM key of TLSCertFile
+	CredsFile   string // NATS credentials file (user JWT and nkey seed)
+	Username    string
+	Password    string
+	Token       string
+}
+
+// LoadConnConfig reads the connection settings of the [nats] section.
+func LoadConnConfig(ko *koanf.Koanf) ConnConfig {
+	return ConnConfig{
+		TLSCAFile:   ko.String("nats.tls_ca_file"),
+		TLSCertFile: ko.String("nats.tls_cert_file"),
+		TLSKeyFile:  ko.String("nats.tls_key_file"),
+		CredsFile:   ko.String("nats.creds_file"),
+		Username:    ko.String("nats.username"),
+		Password:    ko.String("nats.password"),
+		Token:       ko.String("nats.token"),
+	}
+}
+
+// Options validates the settings and translates them into connect options.
+// Files are read up front so a missing or invalid one is reported by its
+// setting name rather than as a failed handshake.
+func (c ConnConfig) Options() ([]nats.Option, error) {
+	var opts []nats.Option
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+
+	if c.CredsFile != "" {
+		if _, err := os.Stat(c.CredsFile); err != nil {
+			return nil, fmt.Errorf("%w: creds_file: %w", ErrInvalidConnConfig, err)
+		}
+		opts = append(opts, nats.UserCredentials(c.CredsFile))
+	}
+
+	switch {
+	case c.Username != "" && c.Password == "":
+		return nil, fmt.Errorf("%w: username %q is set without a password", ErrInvalidConnConfig, c.Username)
+	case c.Username == "" && c.Password != "":
+		return nil, fmt.Errorf("%w: password is set without a username", ErrInvalidConnConfig)
+	case c.Username != "" && c.Token != "":
+		return nil, fmt.Errorf("%w: username and token are mutually exclusive", ErrInvalidConnConfig)
+	case c.Username != "":
+		opts = append(opts, nats.UserInfo(c.Username, c.Password))
+	case c.Token != "":
+		opts = append(opts, nats.Token(c.Token))
+	}
+	return opts, nil
+}
+
+// tlsConfig builds the TLS configuration, or returns nil if no TLS file is
+// set. Connecting to a tls:// URL then uses the system roots.
+func (c ConnConfig) tlsConfig() (*tls.Config, error) {
+	if c.TLSCAFile == "" && c.TLSCertFile == "" && c.TLSKeyFile == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.TLSCAFile != "" {
+		pem, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: tls_ca_file: %w", ErrInvalidConnConfig, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: tls_ca_file %s: no PEM certificates found", ErrInvalidConnConfig, c.TLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	switch {
+	case c.TLSCertFile != "" && c.TLSKeyFile == "":
+		return nil, fmt.Errorf("%w: tls_cert_file is set without tls_key_file", ErrInvalidConnConfig)
+	case c.TLSCertFile == "" && c.TLSKeyFile != "":
+		return nil, fmt.Errorf("%w: tls_key_file is set without tls_cert_file", ErrInvalidConnConfig)
+	case c.TLSCertFile != "":
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: tls_cert_file/tls_key_file: %w", ErrInvalidConnConfig, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
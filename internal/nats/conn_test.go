@@ -0,0 +1,134 @@
+package nats
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert writes a self-signed certificate and its key as PEM files
+// and returns their paths.
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "polymarket-indexer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+// applyOptions applies connect options to default options.
+func applyOptions(t *testing.T, opts []nats.Option) nats.Options {
+	t.Helper()
+	o := nats.GetDefaultOptions()
+	for _, opt := range opts {
+		require.NoError(t, opt(&o))
+	}
+	return o
+}
+
+// TestConnConfigOptions tests that the TLS and authentication settings are
+// translated into connect options.
+func TestConnConfigOptions(t *testing.T) {
+	opts, err := ConnConfig{}.Options()
+	require.NoError(t, err)
+	require.Empty(t, opts)
+
+	certFile, keyFile := writeTestCert(t)
+	opts, err = ConnConfig{
+		TLSCAFile:   certFile,
+		TLSCertFile: certFile,
+		TLSKeyFile:  keyFile,
+		Username:    "indexer",
+		Password:    "secret",
+	}.Options()
+	require.NoError(t, err)
+	o := applyOptions(t, opts)
+	require.True(t, o.Secure)
+	require.NotNil(t, o.TLSConfig.RootCAs)
+	require.Len(t, o.TLSConfig.Certificates, 1)
+	require.Equal(t, "indexer", o.User)
+	require.Equal(t, "secret", o.Password)
+
+	opts, err = ConnConfig{Token: "s3cr3t"}.Options()
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", applyOptions(t, opts).Token)
+}
+
+// TestConnConfigInvalid tests that incomplete settings and unusable files
+// are rejected with an error naming the setting.
+func TestConnConfigInvalid(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+
+	tests := []struct {
+		name string
+		cfg  ConnConfig
+		want string
+	}{
+		{"missing CA file", ConnConfig{TLSCAFile: missing}, "tls_ca_file"},
+		{"CA file without certificates", ConnConfig{TLSCAFile: keyFile}, "tls_ca_file"},
+		{"cert without key", ConnConfig{TLSCertFile: certFile}, "tls_key_file"},
+		{"key without cert", ConnConfig{TLSKeyFile: keyFile}, "tls_cert_file"},
+		{"mismatched key pair", ConnConfig{TLSCertFile: certFile, TLSKeyFile: certFile}, "tls_cert_file/tls_key_file"},
+		{"missing creds file", ConnConfig{CredsFile: missing}, "creds_file"},
+		{"username without password", ConnConfig{Username: "indexer"}, "password"},
+		{"password without username", ConnConfig{Password: "secret"}, "username"},
+		{"username and token", ConnConfig{Username: "indexer", Password: "secret", Token: "s3cr3t"}, "token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.cfg.Options()
+			require.ErrorIs(t, err, ErrInvalidConnConfig)
+			require.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+// TestConnectTokenAuth tests the plumbing against a server requiring token
+// authentication, e.g. nats-server --jetstream --auth s3cr3t:
+//
+//	NATS_TEST_URL=nats://localhost:4222 NATS_TEST_TOKEN=s3cr3t go test ./internal/nats/
+func TestConnectTokenAuth(t *testing.T) {
+	url := testNATSURL(t)
+	token := os.Getenv("NATS_TEST_TOKEN")
+	if token == "" {
+		t.Skip("NATS_TEST_TOKEN not set, skipping token authentication test")
+	}
+
+	_, err := nats.Connect(url)
+	require.ErrorIs(t, err, nats.ErrAuthorization)
+
+	opts, err := ConnConfig{Token: token}.Options()
+	require.NoError(t, err)
+	nc, err := nats.Connect(url, opts...)
+	require.NoError(t, err)
+	nc.Close()
+}
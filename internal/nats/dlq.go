@@ -0,0 +1,319 @@
+package nats
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+var (
+	deadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_nats_dead_letters_total",
+		Help: "Total number of events that could not be published, by reason (marshal, publish) and destination (stream, spill, dropped)",
+	}, []string{"reason", "destination"})
+
+	deadLettersReplayed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "polymarket_nats_dead_letters_replayed_total",
+		Help: "Total number of spilled dead letters republished on startup",
+	})
+)
+
+const (
+	// deadLetterToken is the subject token of the dead-letter subject
+	deadLetterToken = "DLQ"
+
+	// spillFileLayout names spill files, one per UTC day
+	spillFileLayout = "2006-01-02.ndjson"
+)
+
+// Dead-letter reasons.
+const (
+	DeadLetterMarshal = "marshal" // The event could not be encoded
+	DeadLetterPublish = "publish" // NATS did not store the encoded event
+)
+
+// DeadLetterSubject returns the subject dead letters are published on,
+// "{prefix}.DLQ". It lies inside the stream, so dead letters are retained
+// with the events; consumers recognise them by the PM-Dead-Letter header.
+func DeadLetterSubject(prefix string) string {
+	return prefix + "." + deadLetterToken
+}
+
+// DeadLetter is an event that could not be published, as stored on the
+// dead-letter subject or in a spill file.
+type DeadLetter struct {
+	Reason   string          `json:"reason"`
+	Error    string          `json:"error"`
+	FailedAt time.Time       `json:"failed_at"`
+	MsgID    string          `json:"msg_id"`
+	Event    json.RawMessage `json:"event"` // The event as JSON, its payload as text if that fails
+
+	// The encoded message, for publish failures, which is republished as is
+	Subject string      `json:"subject,omitempty"`
+	Header  nats.Header `json:"header,omitempty"`
+	Data    []byte      `json:"data,omitempty"`
+}
+
+// deadLetterQueue spills dead letters to NDJSON files in dir while NATS is
+// unavailable.
+type deadLetterQueue struct {
+	dir string
+	now func() time.Time
+
+	mu      sync.Mutex
+	spilled map[string]bool // Message IDs spilled by this process
+}
+
+// WithDeadLetters enables the dead-letter path. Events that cannot be
+// encoded are published to DeadLetterSubject; events NATS fails to store
+// (and dead letters that cannot be published) are appended to a spill file
+// in dir, one per day, which ReplayDeadLetters republishes.
+func WithDeadLetters(dir string) PublisherOption {
+	return func(p *Publisher) {
+		p.dlq = &deadLetterQueue{
+			dir:     dir,
+			now:     time.Now,
+			spilled: make(map[string]bool),
+		}
+	}
+}
+
+// deadLetter hands an event that failed with cause to the dead-letter queue.
+// Encoding failures are published to the dead-letter subject since NATS
+// works; publish failures are spilled straight to disk, one dead letter per
+// schema version.
+func (p *Publisher) deadLetter(ctx context.Context, event models.Event, cause error) {
+	logger := p.logger.With().
+		Str("event", event.EventName).
+		Uint64("block", event.Block).
+		Logger()
+
+	base := DeadLetter{
+		Reason:   DeadLetterPublish,
+		Error:    cause.Error(),
+		FailedAt: p.dlq.now().UTC(),
+		MsgID:    p.messageID(event),
+		Event:    eventJSON(event),
+	}
+	var dls []DeadLetter
+	for _, version := range p.schemaVersions() {
+		msg, msgID, err := p.encodeVersion(event, version)
+		if err != nil {
+			dls = nil
+			break
+		}
+		dl := base
+		dl.MsgID = msgID
+		dl.Subject = msg.Subject
+		dl.Header = msg.Header
+		dl.Data = msg.Data
+		dls = append(dls, dl)
+	}
+
+	if dls == nil {
+		dl := base
+		dl.Reason = DeadLetterMarshal
+		err := p.publishDeadLetter(ctx, dl)
+		if err == nil {
+			deadLetters.WithLabelValues(dl.Reason, "stream").Inc()
+			logger.Error().Err(cause).Str("msg_id", dl.MsgID).Msg("event dead-lettered")
+			return
+		}
+		logger.Error().Err(err).Str("msg_id", dl.MsgID).Msg("failed to publish dead letter, spilling to disk")
+		dls = []DeadLetter{dl}
+	}
+
+	for _, dl := range dls {
+		spilled, err := p.dlq.spill(dl)
+		if err != nil {
+			deadLetters.WithLabelValues(dl.Reason, "dropped").Inc()
+			logger.Error().Err(err).AnErr("cause", cause).Str("msg_id", dl.MsgID).Msg("failed to spill dead letter, event dropped")
+			continue
+		}
+		if spilled {
+			deadLetters.WithLabelValues(dl.Reason, "spill").Inc()
+			logger.Error().Err(cause).Str("msg_id", dl.MsgID).Str("dir", p.dlq.dir).Msg("event spilled to disk")
+		}
+	}
+}
+
+// publishDeadLetter publishes a dead letter to the dead-letter subject.
+func (p *Publisher) publishDeadLetter(ctx context.Context, dl DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+	msg := nats.NewMsg(DeadLetterSubject(p.prefix))
+	msg.Data = data
+	msg.Header.Set(codec.HeaderContentType, codec.ContentTypeJSON)
+	msg.Header.Set(codec.HeaderDeadLetter, dl.Reason)
+	if _, err := p.js.PublishMsg(ctx, msg, jetstream.WithMsgID("dlq-"+dl.MsgID)); err != nil {
+		return &TransportError{Err: err}
+	}
+	return nil
+}
+
+// eventJSON encodes an event as JSON. Payloads JSON cannot encode are
+// rendered as text so the event's identity is kept.
+func eventJSON(event models.Event) json.RawMessage {
+	if data, err := json.Marshal(event); err == nil {
+		return data
+	}
+	event.Payload = fmt.Sprintf("%+v", event.Payload)
+	data, _ := json.Marshal(event)
+	return data
+}
+
+// spill appends a dead letter to today's spill file. It reports false if the
+// message was already spilled by this process (retries of the same event).
+func (q *deadLetterQueue) spill(dl DeadLetter) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := dl.Reason + "/" + dl.MsgID
+	if q.spilled[key] {
+		return false, nil
+	}
+
+	line, err := json.Marshal(dl)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+	if err := os.MkdirAll(q.dir, 0o755); err != nil {
+		return false, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+	path := filepath.Join(q.dir, q.now().UTC().Format(spillFileLayout))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return false, fmt.Errorf("failed to open spill file: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return false, fmt.Errorf("failed to write spill file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("failed to write spill file: %w", err)
+	}
+
+	q.spilled[key] = true
+	return true, nil
+}
+
+// ReplayDeadLetters republishes the spilled dead letters: publish failures
+// to their original subject with their original message ID, so JetStream
+// drops those a later retry already stored within the duplicate window, and
+// encoding failures to the dead-letter subject. Spill files are removed once
+// fully replayed; entries that fail again are kept for the next start.
+//
+// Replayed events may arrive after later events of the same log, such as
+// its reversal. It returns the number of dead letters replayed and left.
+func (p *Publisher) ReplayDeadLetters(ctx context.Context) (replayed, remaining int, err error) {
+	if p.dlq == nil {
+		return 0, 0, nil
+	}
+
+	p.dlq.mu.Lock()
+	defer p.dlq.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(p.dlq.dir, "*.ndjson"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list spill files: %w", err)
+	}
+	slices.Sort(files)
+
+	for _, path := range files {
+		n, left, err := p.replaySpillFile(ctx, path)
+		replayed += n
+		remaining += left
+		if err != nil {
+			return replayed, remaining, err
+		}
+	}
+	return replayed, remaining, nil
+}
+
+// replaySpillFile replays one spill file and rewrites it with the entries
+// that failed again, or removes it.
+func (p *Publisher) replaySpillFile(ctx context.Context, path string) (replayed, remaining int, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read spill file: %w", err)
+	}
+
+	var left bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var dl DeadLetter
+		if err := json.Unmarshal(line, &dl); err != nil {
+			// Keep what cannot be parsed for an operator to inspect
+			p.logger.Error().Err(err).Str("file", path).Msg("skipping malformed spilled dead letter")
+		} else if err := p.replay(ctx, dl); err != nil {
+			p.logger.Warn().Err(err).Str("msg_id", dl.MsgID).Msg("failed to replay dead letter")
+		} else {
+			replayed++
+			deadLettersReplayed.Inc()
+			continue
+		}
+		left.Write(line)
+		left.WriteByte('\n')
+		remaining++
+	}
+	if err := scanner.Err(); err != nil {
+		return replayed, remaining, fmt.Errorf("failed to read spill file: %w", err)
+	}
+
+	if remaining == 0 {
+		if err := os.Remove(path); err != nil {
+			return replayed, remaining, fmt.Errorf("failed to remove spill file: %w", err)
+		}
+		return replayed, 0, nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, left.Bytes(), 0o644); err != nil {
+		return replayed, remaining, fmt.Errorf("failed to rewrite spill file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return replayed, remaining, fmt.Errorf("failed to rewrite spill file: %w", err)
+	}
+	return replayed, remaining, nil
+}
+
+// replay republishes a spilled dead letter.
+func (p *Publisher) replay(ctx context.Context, dl DeadLetter) error {
+	if dl.Reason != DeadLetterPublish || dl.Subject == "" {
+		return p.publishDeadLetter(ctx, dl)
+	}
+
+	msg := nats.NewMsg(dl.Subject)
+	msg.Data = dl.Data
+	for key, values := range dl.Header {
+		for _, value := range values {
+			msg.Header.Add(key, value)
+		}
+	}
+	if _, err := p.js.PublishMsg(ctx, msg, jetstream.WithMsgID(dl.MsgID)); err != nil {
+		return &TransportError{Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package nats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// newDeadLetterPublisher returns a fake publisher with a dead-letter queue
+// spilling to a temporary directory.
+func newDeadLetterPublisher(t *testing.T, js *fakeJetStream) *Publisher {
+	p := newFakePublisher(js, WithPublishRetry(1, time.Millisecond), WithDeadLetters(t.TempDir()))
+	p.dlq.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	return p
+}
+
+// spilled returns the dead letters in the spill files.
+func spilled(t *testing.T, dir string) []DeadLetter {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.ndjson"))
+	require.NoError(t, err)
+
+	var dls []DeadLetter
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for dec.More() {
+			var dl DeadLetter
+			require.NoError(t, dec.Decode(&dl))
+			dls = append(dls, dl)
+		}
+	}
+	return dls
+}
+
+// TestDeadLetterMarshalFailure tests that an event that cannot be encoded is
+// published to the dead-letter subject with its identity.
+func TestDeadLetterMarshalFailure(t *testing.T) {
+	js := &fakeJetStream{}
+	p := newDeadLetterPublisher(t, js)
+
+	event := models.Event{Block: 7, BlockHash: "0xb7", TxHash: "0x01", LogIndex: 3, EventName: "Custom", Success: true, Payload: make(chan int)}
+	require.ErrorIs(t, p.Publish(context.Background(), event), ErrMarshal)
+
+	require.Len(t, js.published, 1)
+	msg := js.published[0]
+	require.Equal(t, "POLYMARKET.DLQ", msg.Subject)
+	require.Equal(t, DeadLetterMarshal, msg.Header.Get(codec.HeaderDeadLetter))
+
+	var dl DeadLetter
+	require.NoError(t, json.Unmarshal(msg.Data, &dl))
+	require.Equal(t, "0x01-3-0xb7-Custom", dl.MsgID)
+	require.Contains(t, dl.Error, "failed to marshal event")
+	require.Contains(t, string(dl.Event), `"tx_hash":"0x01"`)
+	require.Empty(t, dl.Data)
+	require.Empty(t, spilled(t, p.dlq.dir))
+}
+
+// TestDeadLetterSpillAndReplay tests that events NATS does not store are
+// spilled to disk once, however often they are retried, and republished
+// unchanged by ReplayDeadLetters.
+func TestDeadLetterSpillAndReplay(t *testing.T) {
+	js := &fakeJetStream{errs: []error{nats.ErrTimeout, nats.ErrTimeout, nats.ErrNoResponders}}
+	p := newDeadLetterPublisher(t, js)
+
+	event := models.Event{
+		Block: 7, BlockHash: "0xb7", TxHash: "0x01", LogIndex: 3, EventName: "OrderCancelled", Success: true,
+		ContractAddr: "0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E",
+		Payload:      models.OrderCancelled{OrderHash: "0x02"},
+	}
+	for i := 0; i < 2; i++ {
+		require.Error(t, p.Publish(context.Background(), event))
+	}
+	other := event
+	other.LogIndex = 4
+	require.Error(t, p.Publish(context.Background(), other))
+
+	dls := spilled(t, p.dlq.dir)
+	require.Len(t, dls, 2)
+	require.Equal(t, DeadLetterPublish, dls[0].Reason)
+	require.Equal(t, "0x01-3-0xb7-OrderCancelled", dls[0].MsgID)
+	require.Equal(t, "POLYMARKET.OrderCancelled.0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e", dls[0].Subject)
+	require.FileExists(t, filepath.Join(p.dlq.dir, "2024-05-01.ndjson"))
+	require.Empty(t, js.published)
+
+	replayed, remaining, err := p.ReplayDeadLetters(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, replayed)
+	require.Zero(t, remaining)
+	require.Empty(t, spilled(t, p.dlq.dir))
+
+	want, _, err := p.encode(event)
+	require.NoError(t, err)
+	require.Len(t, js.published, 2)
+	require.Equal(t, want.Subject, js.published[0].Subject)
+	require.Equal(t, want.Data, js.published[0].Data)
+	require.Equal(t, want.Header.Get(codec.HeaderTxHash), js.published[0].Header.Get(codec.HeaderTxHash))
+}
+
+// TestDeadLetterReplayKeepsFailures tests that dead letters failing to
+// replay stay spilled for the next start, and that encoding failures spilled
+// while NATS was down are replayed to the dead-letter subject.
+func TestDeadLetterReplayKeepsFailures(t *testing.T) {
+	js := &fakeJetStream{errs: []error{nats.ErrTimeout, nats.ErrTimeout}}
+	p := newDeadLetterPublisher(t, js)
+
+	event := models.Event{TxHash: "0x01", EventName: "Custom", Success: true, Payload: make(chan int)}
+	require.ErrorIs(t, p.Publish(context.Background(), event), ErrMarshal)
+	require.Len(t, spilled(t, p.dlq.dir), 1)
+
+	replayed, remaining, err := p.ReplayDeadLetters(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, replayed)
+	require.Equal(t, 1, remaining)
+	require.Len(t, spilled(t, p.dlq.dir), 1)
+
+	replayed, remaining, err = p.ReplayDeadLetters(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, replayed)
+	require.Zero(t, remaining)
+	require.Len(t, js.published, 1)
+	require.Equal(t, "POLYMARKET.DLQ", js.published[0].Subject)
+}
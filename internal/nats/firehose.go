@@ -0,0 +1,66 @@
+package nats
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+var (
+	firehosePublishes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_nats_firehose_publishes_total",
+		Help: "Total number of events published to the core NATS firehose",
+	}, []string{"event_type"})
+
+	firehoseFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_nats_firehose_failures_total",
+		Help: "Total number of events dropped from the core NATS firehose",
+	}, []string{"event_type"})
+)
+
+// WithFirehose enables PublishLive, which additionally publishes events on
+// core NATS subjects "{prefix}.{EventName}", e.g. "polymarket.live.OrderFilled".
+func WithFirehose(prefix string) PublisherOption {
+	return func(p *Publisher) {
+		p.firehose = prefix
+	}
+}
+
+// FirehoseEnabled reports whether the publisher has a firehose subject.
+func (p *Publisher) FirehoseEnabled() bool {
+	return p.firehose != ""
+}
+
+// FirehoseSubject returns the core NATS subject an event is published on by
+// PublishLive.
+func (p *Publisher) FirehoseSubject(event models.Event) string {
+	return p.firehose + "." + event.EventName
+}
+
+// PublishLive publishes an event, encoded as for JetStream, on its firehose
+// subject. It is best-effort and fire-and-forget: nothing is persisted or
+// acknowledged, it never blocks (while disconnected, messages go to the
+// reconnect buffer until it is full) and failures are only logged and
+// counted. It does nothing if the firehose is disabled.
+func (p *Publisher) PublishLive(event models.Event) {
+	if p.firehose == "" || p.nc == nil {
+		return
+	}
+
+	msg, _, err := p.encode(event)
+	if err == nil {
+		msg.Subject = p.FirehoseSubject(event)
+		err = p.nc.PublishMsg(msg)
+	}
+	if err != nil {
+		firehoseFailures.WithLabelValues(event.EventName).Inc()
+		p.logger.Debug().
+			Err(err).
+			Str("event", event.EventName).
+			Uint64("block", event.Block).
+			Msg("failed to publish event to firehose")
+		return
+	}
+	firehosePublishes.WithLabelValues(event.EventName).Inc()
+}
@@ -0,0 +1,61 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestPublishLiveDisabled tests that PublishLive does nothing without a
+// firehose prefix.
+func TestPublishLiveDisabled(t *testing.T) {
+	p := newFakePublisher(&fakeJetStream{})
+	require.False(t, p.FirehoseEnabled())
+	p.PublishLive(models.Event{EventName: "OrderFilled"})
+
+	WithFirehose("polymarket.live")(p)
+	require.True(t, p.FirehoseEnabled())
+	require.Equal(t, "polymarket.live.OrderFilled", p.FirehoseSubject(models.Event{EventName: "OrderFilled"}))
+}
+
+// TestFirehoseInsideStream tests that a firehose prefix whose subjects the
+// stream would store is rejected before connecting.
+func TestFirehoseInsideStream(t *testing.T) {
+	logger := zerolog.Nop()
+	_, err := NewPublisher("nats://127.0.0.1:1", testStreamConfig, &logger, WithFirehose(testStreamConfig.SubjectPrefix+".live"))
+	require.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+// TestPublishLive tests against a NATS server that events are delivered to
+// plain subscribers of the firehose subject with the JetStream headers.
+func TestPublishLive(t *testing.T) {
+	url := testNATSURL(t)
+	logger := zerolog.Nop()
+
+	publisher, err := NewPublisher(url, testStreamConfig, &logger, WithFirehose("polymarket.live"))
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	nc, err := nats.Connect(url)
+	require.NoError(t, err)
+	defer nc.Close()
+	sub, err := nc.SubscribeSync("polymarket.live.>")
+	require.NoError(t, err)
+	require.NoError(t, nc.Flush())
+
+	event := testBatch(1)[0]
+	publisher.PublishLive(event)
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "polymarket.live.OrderFilled", msg.Subject)
+	meta, ok := codec.MetadataFromHeaders(msg.Header)
+	require.True(t, ok)
+	require.Equal(t, event.TxHash, meta.TxHash)
+}
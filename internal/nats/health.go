@@ -0,0 +1,127 @@
+package nats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	natsReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "polymarket_nats_reconnects_total",
+		Help: "Total number of times the publisher reconnected to NATS",
+	})
+
+	lastPublishTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "polymarket_nats_last_publish_timestamp_seconds",
+		Help: "Unix time of the last publish JetStream acknowledged",
+	})
+)
+
+// DefaultStaleAfter is the default time publishes may keep failing before
+// the publisher reports itself unhealthy.
+const DefaultStaleAfter = 5 * time.Minute
+
+// PublisherStatus is a snapshot of the publisher's health. Connected tells
+// NATS connectivity apart from JetStream failing to store messages while
+// connected (storage full, no quorum), which shows as consecutive failures
+// and eventually as Stale.
+type PublisherStatus struct {
+	Connected           bool
+	CircuitOpen         bool
+	LastPublish         time.Time // Last acknowledged publish (zero = none yet)
+	ConsecutiveFailures int       // Failed publish attempts since LastPublish
+	FailingSince        time.Time // First of those failures (zero = not failing)
+	Reconnects          int
+	Disconnects         int
+	Stale               bool // Failing for longer than the staleness threshold
+}
+
+// publisherHealth tracks publish outcomes and connection events. Its zero
+// value is ready to use.
+type publisherHealth struct {
+	mu           sync.Mutex
+	lastPublish  time.Time
+	failures     int
+	failingSince time.Time
+	reconnects   int
+	disconnects  int
+}
+
+// success records an acknowledged publish.
+func (h *publisherHealth) success(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastPublish = now
+	h.failures = 0
+	h.failingSince = time.Time{}
+	lastPublishTimestamp.Set(float64(now.Unix()))
+}
+
+// failure records a failed publish attempt.
+func (h *publisherHealth) failure(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failures == 0 {
+		h.failingSince = now
+	}
+	h.failures++
+}
+
+// reconnected records a reconnect to NATS.
+func (h *publisherHealth) reconnected() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reconnects++
+	natsReconnects.Inc()
+}
+
+// disconnected records a lost NATS connection.
+func (h *publisherHealth) disconnected() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.disconnects++
+}
+
+// status returns the tracked state. Publishes count as stale once they
+// have failed without a success for longer than staleAfter (0 = never), so
+// an idle publisher stays healthy.
+func (h *publisherHealth) status(now time.Time, staleAfter time.Duration) PublisherStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return PublisherStatus{
+		LastPublish:         h.lastPublish,
+		ConsecutiveFailures: h.failures,
+		FailingSince:        h.failingSince,
+		Reconnects:          h.reconnects,
+		Disconnects:         h.disconnects,
+		Stale:               staleAfter > 0 && h.failures > 0 && now.Sub(h.failingSince) > staleAfter,
+	}
+}
+
+// WithStaleAfter sets how long publishes may keep failing without a single
+// success before Healthy reports false (0 = only connectivity and the
+// circuit breaker count). The default is DefaultStaleAfter.
+func WithStaleAfter(d time.Duration) PublisherOption {
+	return func(p *Publisher) {
+		p.staleAfter = d
+	}
+}
+
+// Status returns a snapshot of the publisher's health.
+func (p *Publisher) Status() PublisherStatus {
+	status := p.health.status(time.Now(), p.staleAfter)
+	status.Connected = p.nc != nil && p.nc.IsConnected()
+	status.CircuitOpen = p.breaker.isOpen()
+	return status
+}
+
+// Healthy reports whether the publisher is connected to NATS, the circuit
+// breaker is not open and publishes have not been failing for longer than
+// the staleness threshold.
+func (p *Publisher) Healthy() bool {
+	status := p.Status()
+	return status.Connected && !status.CircuitOpen && !status.Stale
+}
@@ -0,0 +1,59 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestHealthStale tests that publishes count as stale only once they have
+// kept failing for longer than the threshold, and that a success resets
+// the failures.
+func TestHealthStale(t *testing.T) {
+	var h publisherHealth
+	start := time.Unix(1_700_000_000, 0)
+
+	require.False(t, h.status(start.Add(time.Hour), time.Minute).Stale, "idle")
+
+	h.success(start)
+	h.failure(start.Add(time.Second))
+	h.failure(start.Add(2 * time.Second))
+	status := h.status(start.Add(30*time.Second), time.Minute)
+	require.False(t, status.Stale)
+	require.Equal(t, 2, status.ConsecutiveFailures)
+	require.Equal(t, start.Add(time.Second), status.FailingSince)
+	require.Equal(t, start, status.LastPublish)
+
+	require.True(t, h.status(start.Add(2*time.Minute), time.Minute).Stale)
+	require.False(t, h.status(start.Add(2*time.Minute), 0).Stale, "disabled")
+
+	h.success(start.Add(3 * time.Minute))
+	status = h.status(start.Add(time.Hour), time.Minute)
+	require.False(t, status.Stale)
+	require.Zero(t, status.ConsecutiveFailures)
+	require.True(t, status.FailingSince.IsZero())
+}
+
+// TestPublisherStatus tests that failed and acknowledged publishes are
+// reflected in the publisher's status.
+func TestPublisherStatus(t *testing.T) {
+	js := &fakeJetStream{errs: []error{nats.ErrTimeout, nats.ErrTimeout}}
+	p := newFakePublisher(js, WithPublishRetry(2, time.Millisecond))
+	event := models.Event{EventName: "OrderFilled", TxHash: "0x01"}
+
+	require.Error(t, p.Publish(context.Background(), event))
+	status := p.Status()
+	require.Equal(t, 2, status.ConsecutiveFailures)
+	require.True(t, status.LastPublish.IsZero())
+	require.False(t, status.Connected)
+
+	require.NoError(t, p.Publish(context.Background(), event))
+	status = p.Status()
+	require.Zero(t, status.ConsecutiveFailures)
+	require.False(t, status.LastPublish.IsZero())
+}
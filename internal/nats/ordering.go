@@ -0,0 +1,122 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// orderedLanes funnels asynchronous publishes through serialized queues.
+// Events are sharded by contract, so every subject of a contract is handed
+// to JetStream by one lane in the order PublishAsync was called, while
+// different contracts publish in parallel.
+type orderedLanes struct {
+	publisher *Publisher
+	queues    []chan orderedEvent
+	inflight  sync.WaitGroup // Events enqueued but not yet handed to JetStream
+	closeOnce sync.Once
+
+	mu   sync.Mutex
+	errs []error // Events a lane failed to hand to JetStream since the last Flush
+}
+
+// orderedEvent is an event waiting on its lane.
+type orderedEvent struct {
+	ctx   context.Context
+	event models.Event
+}
+
+// WithOrdering enables the ordering mode of PublishAsync with lanes
+// serialized queues of buffer events each. Callers must call PublishAsync in
+// log order for each contract; the contract's messages then reach JetStream,
+// which keeps publish order per subject, in that order.
+//
+// An event a lane fails to publish is reported by the next Flush, but the
+// lane carries on with the contract's later events, so a failed Flush means
+// a gap in the contract's sequence that the caller must republish before
+// checkpointing.
+func WithOrdering(lanes, buffer int) PublisherOption {
+	return func(p *Publisher) {
+		if lanes <= 0 {
+			return
+		}
+		o := &orderedLanes{
+			publisher: p,
+			queues:    make([]chan orderedEvent, lanes),
+		}
+		for i := range o.queues {
+			o.queues[i] = make(chan orderedEvent, buffer)
+			go o.run(o.queues[i])
+		}
+		p.ordering = o
+	}
+}
+
+// run hands the events of a lane to JetStream, in order.
+func (o *orderedLanes) run(queue chan orderedEvent) {
+	for ev := range queue {
+		if err := o.publisher.publishAsync(ev.ctx, ev.event); err != nil {
+			o.mu.Lock()
+			o.errs = append(o.errs, fmt.Errorf("event %s:%d: %w", ev.event.TxHash, ev.event.LogIndex, err))
+			o.mu.Unlock()
+		}
+		o.inflight.Done()
+	}
+}
+
+// enqueue hands an event to the lane owning its contract. It blocks while
+// the lane is full.
+func (o *orderedLanes) enqueue(ctx context.Context, event models.Event) error {
+	queue := o.queues[o.lane(event.ContractAddr)]
+	o.inflight.Add(1)
+	select {
+	case queue <- orderedEvent{ctx: ctx, event: event}:
+		return nil
+	case <-ctx.Done():
+		o.inflight.Done()
+		return ctx.Err()
+	}
+}
+
+// lane returns the index of the lane owning a contract.
+func (o *orderedLanes) lane(contract string) int {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(contract)))
+	return int(h.Sum32() % uint32(len(o.queues)))
+}
+
+// drain waits until every enqueued event has been handed to JetStream and
+// returns the failures since the last drain.
+func (o *orderedLanes) drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		o.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain ordered publishes: %w", ctx.Err())
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	err := errors.Join(o.errs...)
+	o.errs = nil
+	return err
+}
+
+// close stops the lanes. PublishAsync must not be called afterwards.
+func (o *orderedLanes) close() {
+	o.closeOnce.Do(func() {
+		for _, queue := range o.queues {
+			close(queue)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Two contracts whose events land on different lanes of a two-lane publisher
+const (
+	orderingContractA = "0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e"
+	orderingContractB = "0x2791bca1f2de4661ed88a30c99a7a9449aa84174"
+)
+
+// orderingEvents returns n events of contract in log order.
+func orderingEvents(contract string, n int) []models.Event {
+	txHash := fmt.Sprintf("0x%064x", time.Now().UnixNano())
+	events := make([]models.Event, n)
+	for i := range events {
+		events[i] = models.Event{
+			Block:        100,
+			TxHash:       txHash,
+			LogIndex:     uint(i),
+			ContractAddr: contract,
+			EventName:    "OrderFilled",
+			Success:      true,
+		}
+	}
+	return events
+}
+
+// publishInterleaved publishes the events of both contracts concurrently,
+// one goroutine per contract, and flushes.
+func publishInterleaved(t *testing.T, p *Publisher, a, b []models.Event) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(a)+len(b))
+	for _, events := range [][]models.Event{a, b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, event := range events {
+				errs <- p.PublishAsync(ctx, event)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.NoError(t, p.Flush(ctx))
+}
+
+// requireOrderedPerSubject asserts that the log indexes received on every
+// subject are 0, 1, 2, ... and returns the number of messages per subject.
+func requireOrderedPerSubject(t *testing.T, msgs []*nats.Msg) map[string]int {
+	t.Helper()
+	received := make(map[string]int)
+	for _, msg := range msgs {
+		meta, ok := codec.MetadataFromHeaders(msg.Header)
+		require.True(t, ok)
+		require.Equal(t, uint(received[msg.Subject]), meta.LogIndex, "%s out of order", msg.Subject)
+		received[msg.Subject]++
+	}
+	return received
+}
+
+// TestOrderingPreservesSubjectOrder tests that in the ordering mode the
+// events of each contract reach JetStream in publish order while the lanes
+// of different contracts run in parallel: contract A's lane is held until
+// contract B's lane has sent all of its events.
+func TestOrderingPreservesSubjectOrder(t *testing.T) {
+	const n = 50
+	a := orderingEvents(orderingContractA, n)
+	b := orderingEvents(orderingContractB, n)
+
+	var sentB sync.WaitGroup
+	sentB.Add(n)
+	js := &fakeJetStream{onAsync: func(msg *nats.Msg) {
+		if msg.Subject == "POLYMARKET.OrderFilled."+orderingContractB {
+			sentB.Done()
+			return
+		}
+		sentB.Wait()
+	}}
+	p := newFakePublisher(js, WithOrdering(2, n))
+	defer p.Close()
+	require.NotEqual(t, p.ordering.lane(orderingContractA), p.ordering.lane(orderingContractB))
+
+	publishInterleaved(t, p, a, b)
+
+	received := requireOrderedPerSubject(t, js.published)
+	require.Equal(t, map[string]int{
+		"POLYMARKET.OrderFilled." + orderingContractA: n,
+		"POLYMARKET.OrderFilled." + orderingContractB: n,
+	}, received)
+}
+
+// TestOrderingFlushReportsFailures tests that events a lane fails to send
+// are reported by Flush.
+func TestOrderingFlushReportsFailures(t *testing.T) {
+	js := &fakeJetStream{asyncErrs: []error{nil, nats.ErrTimeout}}
+	p := newFakePublisher(js, WithOrdering(2, 4))
+	defer p.Close()
+
+	for _, event := range orderingEvents(orderingContractA, 3) {
+		require.NoError(t, p.PublishAsync(context.Background(), event))
+	}
+	err := p.Flush(context.Background())
+	require.ErrorIs(t, err, nats.ErrTimeout)
+	require.ErrorContains(t, err, ":1:")
+	require.Len(t, js.published, 2)
+	require.NoError(t, p.Flush(context.Background()))
+}
+
+// TestOrderingConsumed tests against a NATS server that a consumer receives
+// the interleaved events of two contracts in order on each subject.
+func TestOrderingConsumed(t *testing.T) {
+	url := testNATSURL(t)
+	logger := zerolog.Nop()
+
+	publisher, err := NewPublisher(url, testStreamConfig, &logger, WithOrdering(4, 16))
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const n = 100
+	a := orderingEvents(orderingContractA, n)
+	b := orderingEvents(orderingContractB, n)
+	// Ordered consumers are created on the first Next, so start after the
+	// last message stored now rather than at new messages
+	stream, err := publisher.js.Stream(ctx, publisher.stream)
+	require.NoError(t, err)
+	info, err := stream.Info(ctx)
+	require.NoError(t, err)
+	consumer, err := stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{
+			testStreamConfig.SubjectPrefix + ".OrderFilled." + orderingContractA,
+			testStreamConfig.SubjectPrefix + ".OrderFilled." + orderingContractB,
+		},
+		DeliverPolicy: jetstream.DeliverByStartSequencePolicy,
+		OptStartSeq:   info.State.LastSeq + 1,
+	})
+	require.NoError(t, err)
+
+	publishInterleaved(t, publisher, a, b)
+
+	var msgs []*nats.Msg
+	for len(msgs) < 2*n {
+		msg, err := consumer.Next(jetstream.FetchMaxWait(5 * time.Second))
+		require.NoError(t, err)
+		msgs = append(msgs, &nats.Msg{Subject: msg.Subject(), Header: msg.Headers()})
+	}
+	requireOrderedPerSubject(t, msgs)
+}
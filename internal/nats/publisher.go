@@ -3,124 +3,455 @@ package nats
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
 	"github.com/0xkanth/polymarket-indexer/pkg/models"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog"
 )
 
-const (
-	// streamName is the NATS JetStream stream name
-	streamName = "POLYMARKET"
+var (
+	asyncPublishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_nats_async_publish_failures_total",
+		Help: "Total number of asynchronous publishes JetStream did not acknowledge",
+	}, []string{"event_type"})
+
+	duplicatePublishes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_nats_duplicate_publishes_total",
+		Help: "Total number of publishes JetStream acknowledged as duplicates of a message ID stored within the duplicate window",
+	}, []string{"event_type"})
 
-	// streamSubjectPattern is the subject pattern for all Polymarket events
-	streamSubjectPattern = "POLYMARKET.*"
+	chunkedPublishes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_nats_chunked_publishes_total",
+		Help: "Total number of event messages published in chunks because they exceeded the server's max payload",
+	}, []string{"event_type"})
+)
 
+const (
 	// streamCreateTimeout is the timeout for stream creation
 	streamCreateTimeout = 10 * time.Second
+
+	// DefaultAsyncWindow is the default maximum number of asynchronous
+	// publishes awaiting an acknowledgment
+	DefaultAsyncWindow = 512
+
+	// DefaultPublishRetryAttempts is the default number of attempts Publish
+	// makes before returning a TransportError
+	DefaultPublishRetryAttempts = 3
+
+	// DefaultPublishRetryBackoff is the default delay before the first
+	// Publish retry; it doubles on every further retry
+	DefaultPublishRetryBackoff = 100 * time.Millisecond
 )
 
+// ErrMarshal is returned by Publish when an event cannot be encoded. It is
+// deterministic, so retrying the publish cannot succeed.
+var ErrMarshal = errors.New("failed to marshal event")
+
+// TransportError is returned by Publish when an encoded event could not be
+// stored by JetStream (timeout, disconnect, no ack). Retrying may succeed.
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("failed to publish to NATS: %v", e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports that the failure is transient, so the router retries it.
+func (e *TransportError) Temporary() bool {
+	return true
+}
+
+// SubjectPattern returns the stream subject pattern covering every subject
+// published under prefix. Subjects have the form
+// {prefix}.{EventName}.{ContractAddress}, so it must use the multi-token
+// wildcard: "{prefix}.*" matches only a single token after the prefix.
+func SubjectPattern(prefix string) string {
+	return fmt.Sprintf("%s.>", prefix)
+}
+
 // Publisher publishes events to NATS JetStream with deduplication.
+// Publish is synchronous; PublishAsync pipelines publishes and collects
+// their acknowledgments on Flush, optionally through per-contract ordered
+// lanes (WithOrdering), and PublishBatch pipelines a batch and reports the
+// outcome of every event.
+//
+// Publish retries transport failures itself and is guarded by a circuit
+// breaker: once NATS has failed repeatedly it returns a CircuitOpenError
+// without attempting the publish until a probe succeeds.
+//
+// An event whose message exceeds the server's max payload, such as a
+// TransferBatch of an airdrop, is published as several chunk messages the
+// consumer reassembles (see codec.Chunk).
 type Publisher struct {
 	js     jetstream.JetStream
 	nc     *nats.Conn
 	logger *zerolog.Logger
 	prefix string
+	stream string
+
+	connOpts    []nats.Option
+	codec       codec.Codec
+	compression codec.Compression // nil = payloads are not compressed
+	compressMin int               // Smallest payload that is compressed
+	dlq         *deadLetterQueue  // nil = failed events are only logged
+	ordering    *orderedLanes     // nil = PublishAsync sends at once
+	firehose    string            // Core NATS subject prefix of PublishLive (empty = disabled)
+	chainID     int64
+	versions    []codec.SchemaVersion // Published schema versions (empty = v1)
+	msgIDPrefix string                // Prepended to every deduplication ID
+	maxPayload  int                   // Larger messages are published in chunks (0 = unlimited)
+	asyncWindow int
+	retries     int
+	backoff     time.Duration
+	breaker     *circuitBreaker
+	health      publisherHealth
+	staleAfter  time.Duration // Failing longer than this is unhealthy (0 = never)
+	mu          sync.Mutex
+	pending     []pendingAck // async publishes since the last Flush
+}
+
+// pendingAck is an asynchronous publish awaiting its acknowledgment.
+type pendingAck struct {
+	future    jetstream.PubAckFuture
+	msgID     string
+	eventName string
+	txHash    string
+	logIndex  uint
+}
+
+// PublisherOption configures a Publisher.
+type PublisherOption func(*Publisher)
+
+// WithAsyncWindow bounds the number of asynchronous publishes awaiting an
+// acknowledgment. PublishAsync blocks while the window is full.
+func WithAsyncWindow(window int) PublisherOption {
+	return func(p *Publisher) {
+		p.asyncWindow = window
+	}
 }
 
-// NewPublisher creates a new NATS JetStream publisher.
-func NewPublisher(natsURL string, persistDuration time.Duration, subjectPrefix string, logger *zerolog.Logger) (*Publisher, error) {
+// WithConnectOptions adds options to the NATS connection, such as the TLS
+// and authentication options of ConnConfig.Options.
+func WithConnectOptions(opts ...nats.Option) PublisherOption {
+	return func(p *Publisher) {
+		p.connOpts = append(p.connOpts, opts...)
+	}
+}
+
+// WithCodec sets the payload encoding. The default is codec.JSON.
+func WithCodec(c codec.Codec) PublisherOption {
+	return func(p *Publisher) {
+		p.codec = c
+	}
+}
+
+// WithCompression compresses encoded payloads of at least threshold bytes,
+// recording the compression in the Content-Encoding header. Smaller payloads,
+// and payloads that do not shrink, are published uncompressed. A nil
+// compression disables it (the default).
+func WithCompression(c codec.Compression, threshold int) PublisherOption {
+	return func(p *Publisher) {
+		p.compression = c
+		p.compressMin = threshold
+	}
+}
+
+// WithSchemaVersions sets the schema versions every event is published in.
+// Several versions are published side by side during a migration, each on
+// its own subject and with its own deduplication ID. The first version is
+// the one SubjectFor reports. The default is v1 alone.
+func WithSchemaVersions(versions ...codec.SchemaVersion) PublisherOption {
+	return func(p *Publisher) {
+		p.versions = versions
+	}
+}
+
+// WithMsgIDPrefix prepends prefix to the deduplication ID of every message,
+// e.g. "reindex-". Deliberate republication, such as a reindex whose events
+// the consumer upserts as corrections, then bypasses deduplication against
+// the original publishes. Messages republished with the same prefix are
+// still deduplicated against each other, so a reindex that must be
+// repeatable within the duplicate window needs a prefix of its own per run.
+func WithMsgIDPrefix(prefix string) PublisherOption {
+	return func(p *Publisher) {
+		p.msgIDPrefix = prefix
+	}
+}
+
+// WithChainID sets the chain ID published in the PM-ChainID header.
+func WithChainID(chainID int64) PublisherOption {
+	return func(p *Publisher) {
+		p.chainID = chainID
+	}
+}
+
+// WithPublishRetry sets how many times Publish attempts a publish that fails
+// in transport, and the delay before the first retry, which doubles on every
+// further retry. Non-positive values keep the defaults. The router retries
+// the returned TransportError on top of this, so keep both small.
+func WithPublishRetry(attempts int, backoff time.Duration) PublisherOption {
+	return func(p *Publisher) {
+		if attempts > 0 {
+			p.retries = attempts
+		}
+		if backoff > 0 {
+			p.backoff = backoff
+		}
+	}
+}
+
+// WithCircuitBreaker sets the number of consecutive failed publishes that
+// open the circuit breaker and how long it stays open before a probe publish
+// is let through. Non-positive values keep the defaults.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) PublisherOption {
+	return func(p *Publisher) {
+		p.breaker = newCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// NewPublisher creates a new NATS JetStream publisher and creates or updates
+// the stream described by cfg, or only verifies it if cfg.ManageStream is
+// false.
+func NewPublisher(natsURL string, cfg PublisherConfig, logger *zerolog.Logger, opts ...PublisherOption) (*Publisher, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := &Publisher{
+		logger:      logger,
+		prefix:      cfg.SubjectPrefix,
+		stream:      cfg.StreamName,
+		codec:       codec.JSON,
+		asyncWindow: DefaultAsyncWindow,
+		retries:     DefaultPublishRetryAttempts,
+		backoff:     DefaultPublishRetryBackoff,
+		breaker:     newCircuitBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown),
+		staleAfter:  DefaultStaleAfter,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	// Firehose messages must not be stored by the stream as well
+	if p.firehose != "" && subjectCovers(SubjectPattern(cfg.SubjectPrefix), p.firehose+".>") {
+		return nil, fmt.Errorf("%w: firehose prefix %q lies inside the stream subjects %q",
+			ErrInvalidConfig, p.firehose, SubjectPattern(cfg.SubjectPrefix))
+	}
+
 	// Connect to NATS
-	nc, err := nats.Connect(natsURL,
+	connOpts := append([]nats.Option{
 		nats.Name("polymarket-indexer"),
 		nats.MaxReconnects(-1), // Unlimited reconnects
-		nats.ReconnectWait(2*time.Second),
+		nats.ReconnectWait(2 * time.Second),
 		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
 			if err != nil {
+				p.health.disconnected()
 				logger.Error().Err(err).Msg("nats disconnected")
 			}
 		}),
 		nats.ReconnectHandler(func(_ *nats.Conn) {
+			p.health.reconnected()
 			logger.Info().Msg("nats reconnected")
 		}),
-	)
+	}, p.connOpts...)
+	nc, err := nats.Connect(natsURL, connOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 
 	// Create JetStream context
-	js, err := jetstream.New(nc)
+	js, err := jetstream.New(nc, jetstream.WithPublishAsyncMaxPending(p.asyncWindow))
 	if err != nil {
 		nc.Close()
 		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
 	}
 
-	// Create or update the stream
+	// Create, update or verify the stream
 	ctx, cancel := context.WithTimeout(context.Background(), streamCreateTimeout)
 	defer cancel()
 
-	duplicateWindow := 20 * time.Minute
-	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
-		Name:       streamName,
-		Subjects:   []string{streamSubjectPattern},
-		MaxAge:     persistDuration,
-		Storage:    jetstream.FileStorage,
-		Duplicates: duplicateWindow,
-		Retention:  jetstream.LimitsPolicy,
-	})
+	info, err := ensureStream(ctx, js, cfg)
 	if err != nil {
 		nc.Close()
-		return nil, fmt.Errorf("failed to create stream: %w", err)
+		return nil, err
 	}
 
-	logger.Info().
-		Str("stream", streamName).
-		Str("subjects", streamSubjectPattern).
-		Dur("max_age", persistDuration).
-		Dur("duplicate_window", duplicateWindow).
+	event := logger.Info().
+		Str("stream", info.Config.Name).
+		Strs("subjects", info.Config.Subjects).
+		Bool("managed", cfg.ManageStream).
+		Dur("max_age", info.Config.MaxAge).
+		Int64("max_bytes", info.Config.MaxBytes).
+		Str("discard", info.Config.Discard.String()).
+		Str("storage", info.Config.Storage.String()).
+		Int("replicas", info.Config.Replicas).
+		Dur("duplicate_window", info.Config.Duplicates).
+		Str("msg_id_prefix", p.msgIDPrefix)
+	if info.Config.Placement != nil {
+		event = event.
+			Str("placement_cluster", info.Config.Placement.Cluster).
+			Strs("placement_tags", info.Config.Placement.Tags)
+	}
+	if info.Cluster != nil {
+		event = event.
+			Str("cluster", info.Cluster.Name).
+			Str("leader", info.Cluster.Leader)
+	}
+	event.
+		Uint64("messages", info.State.Msgs).
+		Int("async_window", p.asyncWindow).
+		Int("publish_retry_attempts", p.retries).
+		Int("breaker_threshold", p.breaker.threshold).
+		Dur("breaker_cooldown", p.breaker.cooldown).
+		Dur("stale_after", p.staleAfter).
+		Str("encoding", p.codec.Name()).
+		Str("compression", compressionName(p.compression)).
+		Int("compression_threshold", p.compressMin).
+		Str("firehose", p.firehose).
+		Int64("max_payload", nc.MaxPayload()).
 		Msg("NATS publisher initialized")
+	if info.Config.Duplicates < cfg.DuplicateWindow {
+		logger.Warn().
+			Dur("duplicate_window", info.Config.Duplicates).
+			Dur("configured", cfg.DuplicateWindow).
+			Msg("stream deduplicates over a shorter window than configured, republished events may be delivered twice")
+	}
 
-	return &Publisher{
-		js:     js,
-		nc:     nc,
-		logger: logger,
-		prefix: subjectPrefix,
-	}, nil
+	p.js = js
+	p.nc = nc
+	p.maxPayload = int(nc.MaxPayload())
+	return p, nil
+}
+
+// compressionName returns the name of c for logging.
+func compressionName(c codec.Compression) string {
+	if c == nil {
+		return "none"
+	}
+	return c.Name()
+}
+
+// ensureStream creates or updates the stream when cfg.ManageStream is set and
+// otherwise checks that the existing stream stores the configured subjects.
+// It returns the stream info reported by the server.
+func ensureStream(ctx context.Context, js jetstream.JetStream, cfg PublisherConfig) (*jetstream.StreamInfo, error) {
+	if cfg.ManageStream {
+		stream, err := js.CreateOrUpdateStream(ctx, cfg.StreamConfig())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stream: %w", err)
+		}
+		info, err := stream.Info(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get stream info: %w", err)
+		}
+		return info, nil
+	}
+
+	stream, err := js.Stream(ctx, cfg.StreamName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up unmanaged stream %s: %w", cfg.StreamName, err)
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream info: %w", err)
+	}
+	if err := cfg.CheckStream(info); err != nil {
+		return nil, err
+	}
+	return info, nil
 }
 
 // Publish publishes an event to NATS JetStream with deduplication.
-// The message ID is constructed from txHash and logIndex to prevent duplicates.
+// The message ID is constructed from txHash and logIndex to prevent duplicates,
+// so retried publishes are stored once.
+//
+// Transport failures are retried with exponential backoff until the attempts
+// are exhausted or ctx is done, and then returned as a TransportError. While
+// the circuit breaker is open, Publish returns a CircuitOpenError at once.
+//
+// With a dead-letter queue configured, an event that fails for any other
+// reason than ctx being done is also handed to it.
 func (p *Publisher) Publish(ctx context.Context, event models.Event) error {
-	// Construct subject: POLYMARKET.{EventName}.{ContractAddress}
-	subject := fmt.Sprintf("%s.%s.%s", p.prefix, event.EventName, event.ContractAddr)
+	err := p.publish(ctx, event)
+	if err != nil && p.dlq != nil && ctx.Err() == nil {
+		p.deadLetter(ctx, event, err)
+	}
+	return err
+}
 
-	// Marshal event to JSON
-	data, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+// publish publishes an event in every schema version, retrying transport
+// failures.
+func (p *Publisher) publish(ctx context.Context, event models.Event) error {
+	for _, version := range p.schemaVersions() {
+		msgs, err := p.messages(event, version)
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if err := p.publishMsg(ctx, event, m.msg, m.msgID); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
 
-	// Create message ID for deduplication: txHash-logIndex
-	msgID := fmt.Sprintf("%s-%d", event.TxHash, event.LogIndex)
+// publishMsg publishes an encoded event, retrying transport failures.
+func (p *Publisher) publishMsg(ctx context.Context, event models.Event, msg *nats.Msg, msgID string) error {
+	backoff := p.backoff
+	for attempt := 1; ; attempt++ {
+		if err := p.breaker.allow(); err != nil {
+			return err
+		}
+
+		// Publish with deduplication
+		ack, err := p.js.PublishMsg(ctx, msg, jetstream.WithMsgID(msgID))
+		if err == nil {
+			p.breaker.success()
+			p.recordAck(ack, event.EventName, msgID)
+			break
+		}
+		if ctx.Err() != nil {
+			// Abandoned by the caller, not a NATS failure
+			p.breaker.release()
+			return &TransportError{Err: err}
+		}
+		p.recordFailure(err)
 
-	// Publish with deduplication
-	_, err = p.js.Publish(ctx, subject, data, jetstream.WithMsgID(msgID))
-	if err != nil {
 		p.logger.Error().
 			Err(err).
-			Str("subject", subject).
+			Str("subject", msg.Subject).
 			Str("msg_id", msgID).
 			Uint64("block", event.Block).
+			Int("attempt", attempt).
 			Msg("failed to publish event")
-		return fmt.Errorf("failed to publish to NATS: %w", err)
+		if attempt >= p.retries {
+			return &TransportError{Err: err}
+		}
+
+		select {
+		case <-ctx.Done():
+			return &TransportError{Err: errors.Join(err, ctx.Err())}
+		case <-time.After(backoff):
+		}
+		backoff *= 2
 	}
 
 	p.logger.Debug().
-		Str("subject", subject).
+		Str("subject", msg.Subject).
 		Str("event", event.EventName).
 		Uint64("block", event.Block).
 		Str("tx", event.TxHash).
@@ -129,25 +460,385 @@ func (p *Publisher) Publish(ctx context.Context, event models.Event) error {
 	return nil
 }
 
-// PublishBatch publishes multiple events in a batch for better performance.
-func (p *Publisher) PublishBatch(ctx context.Context, events []models.Event) error {
-	for _, event := range events {
-		if err := p.Publish(ctx, event); err != nil {
+// recordAck records an acknowledged publish with the health tracker and
+// counts it if JetStream had already stored the message within the
+// duplicate window.
+func (p *Publisher) recordAck(ack *jetstream.PubAck, eventName, msgID string) {
+	p.health.success(time.Now())
+	if ack == nil || !ack.Duplicate {
+		return
+	}
+	duplicatePublishes.WithLabelValues(eventName).Inc()
+	p.logger.Debug().
+		Str("event", eventName).
+		Str("msg_id", msgID).
+		Uint64("seq", ack.Sequence).
+		Msg("publish deduplicated")
+}
+
+// recordFailure records a failed publish with the circuit breaker and the
+// health tracker.
+func (p *Publisher) recordFailure(err error) {
+	p.health.failure(time.Now())
+	if p.breaker.failure() {
+		p.logger.Error().
+			Err(err).
+			Dur("cooldown", p.breaker.cooldown).
+			Msg("NATS circuit breaker opened, failing publishes fast")
+	}
+}
+
+// SubjectFor returns the subject an event is published on in the first
+// configured schema version, see SubjectForVersion.
+func (p *Publisher) SubjectFor(event models.Event) string {
+	return p.SubjectForVersion(event, p.schemaVersions()[0])
+}
+
+// SubjectForVersion returns the subject an event is published on in a
+// schema version:
+//
+//	{prefix}.{EventName}.{contract}           (v1)
+//	{prefix}.{version}.{EventName}.{contract} (v2 and later)
+//
+// where contract is the emitting contract's address in canonical lowercase
+// hex (0x-prefixed), whatever its casing in the event. A consumer of one
+// contract's v1 events filters on e.g.
+// "POLYMARKET.*.0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e".
+func (p *Publisher) SubjectForVersion(event models.Event, version codec.SchemaVersion) string {
+	contract := models.NormalizeAddress(event.ContractAddr)
+	if version == codec.SchemaV1 {
+		return fmt.Sprintf("%s.%s.%s", p.prefix, event.EventName, contract)
+	}
+	return fmt.Sprintf("%s.%s.%s.%s", p.prefix, version, event.EventName, contract)
+}
+
+// schemaVersions returns the published schema versions.
+func (p *Publisher) schemaVersions() []codec.SchemaVersion {
+	if len(p.versions) == 0 {
+		return []codec.SchemaVersion{codec.SchemaV1}
+	}
+	return p.versions
+}
+
+// encode builds the message and deduplication ID of an event in the first
+// configured schema version.
+func (p *Publisher) encode(event models.Event) (*nats.Msg, string, error) {
+	return p.encodeVersion(event, p.schemaVersions()[0])
+}
+
+// encodeVersion builds the message and deduplication ID of an event in a
+// schema version. The payload carries the contract address as given; only
+// the subject is canonicalized. The Content-Type header tells consumers how
+// the payload is encoded, the Content-Encoding header (if any) how it is
+// compressed, PM-Schema-Version its schema and the other PM-* headers carry
+// its routing metadata.
+func (p *Publisher) encodeVersion(event models.Event, version codec.SchemaVersion) (*nats.Msg, string, error) {
+	data, err := p.codec.Marshal(event)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrMarshal, err)
+	}
+	msg := nats.NewMsg(p.SubjectForVersion(event, version))
+	msg.Data = data
+	msg.Header.Set(codec.HeaderContentType, p.codec.ContentType())
+	if p.compression != nil && len(data) >= p.compressMin {
+		compressed, err := p.compression.Compress(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: failed to compress: %w", ErrMarshal, err)
+		}
+		if len(compressed) < len(data) {
+			msg.Data = compressed
+			msg.Header.Set(codec.HeaderContentEncoding, p.compression.Name())
+		}
+	}
+	msg.Header.Set(codec.HeaderSchemaVersion, version.String())
+	codec.MetadataOf(event, p.chainID).SetHeaders(msg.Header)
+
+	// Versions share the stream, so each needs its own deduplication ID
+	msgID := p.messageID(event)
+	if version != codec.SchemaV1 {
+		msgID += "-" + version.String()
+	}
+	return msg, msgID, nil
+}
+
+// messages builds the messages of an event in a schema version: its
+// message, or the chunks it is split into when it exceeds the server's max
+// payload (see chunkMsg).
+func (p *Publisher) messages(event models.Event, version codec.SchemaVersion) ([]outMsg, error) {
+	msg, msgID, err := p.encodeVersion(event, version)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := chunkMsg(msg, msgID, p.maxPayload)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) > 1 {
+		chunkedPublishes.WithLabelValues(event.EventName).Inc()
+		p.logger.Warn().
+			Str("msg_id", msgID).
+			Int("size", len(msg.Data)).
+			Int("max_payload", p.maxPayload).
+			Int("chunks", len(msgs)).
+			Msg("event exceeds the max payload, publishing it in chunks")
+	}
+	return msgs, nil
+}
+
+// messageID returns the deduplication ID of an event:
+// txHash-logIndex-blockHash-eventName, after the configured prefix. A log
+// re-included in another block after a reorg is a new message, as is each
+// event of a log routed to several handlers, and reversals (removed logs)
+// get their own ID so JetStream does not drop them as duplicates of the
+// original publish.
+func (p *Publisher) messageID(event models.Event) string {
+	msgID := fmt.Sprintf("%s%s-%d-%s-%s", p.msgIDPrefix, event.TxHash, event.LogIndex, event.BlockHash, event.EventName)
+	if !event.Success {
+		msgID += "-removed"
+	}
+	return msgID
+}
+
+// PublishAsync sends an event without waiting for JetStream to acknowledge
+// it. It blocks while the async window is full. Acknowledgment failures are
+// reported by the next Flush.
+//
+// In the ordering mode (WithOrdering) the event is queued on its contract's
+// lane instead, and failures to send it are reported by the next Flush too.
+func (p *Publisher) PublishAsync(ctx context.Context, event models.Event) error {
+	if p.ordering != nil {
+		return p.ordering.enqueue(ctx, event)
+	}
+	return p.publishAsync(ctx, event)
+}
+
+// publishAsync sends an event in every schema version, in chunks if it
+// exceeds the max payload, and records the acknowledgments for Flush.
+func (p *Publisher) publishAsync(ctx context.Context, event models.Event) error {
+	for _, version := range p.schemaVersions() {
+		msgs, err := p.messages(event, version)
+		if err != nil {
 			return err
 		}
+		for _, m := range msgs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			future, err := p.js.PublishMsgAsync(m.msg, jetstream.WithMsgID(m.msgID))
+			if err != nil {
+				return &TransportError{Err: err}
+			}
+
+			p.mu.Lock()
+			p.pending = append(p.pending, pendingAck{
+				future:    future,
+				msgID:     m.msgID,
+				eventName: event.EventName,
+				txHash:    event.TxHash,
+				logIndex:  event.LogIndex,
+			})
+			p.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// Flush waits until every PublishAsync call so far has been acknowledged
+// and returns the failed ones, each annotated with its transaction hash and
+// log index.
+func (p *Publisher) Flush(ctx context.Context) error {
+	var errs []error
+	if p.ordering != nil {
+		if err := p.ordering.drain(ctx); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if len(pending) == 0 {
+		return errors.Join(errs...)
+	}
+
+	select {
+	case <-p.js.PublishAsyncComplete():
+	case <-ctx.Done():
+		// Keep the unresolved publishes for the next Flush
+		p.mu.Lock()
+		p.pending = append(pending, p.pending...)
+		p.mu.Unlock()
+		return fmt.Errorf("failed to flush %d async publishes: %w", len(pending), ctx.Err())
+	}
+
+	for _, ack := range pending {
+		select {
+		case pubAck := <-ack.future.Ok():
+			p.recordAck(pubAck, ack.eventName, ack.msgID)
+		case err := <-ack.future.Err():
+			p.health.failure(time.Now())
+			asyncPublishFailures.WithLabelValues(ack.eventName).Inc()
+			p.logger.Error().
+				Err(err).
+				Str("event", ack.eventName).
+				Str("tx", ack.txHash).
+				Uint("log_index", ack.logIndex).
+				Msg("async publish not acknowledged")
+			errs = append(errs, fmt.Errorf("event %s:%d: %w", ack.txHash, ack.logIndex, &TransportError{Err: err}))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// BatchResult is the outcome of PublishBatch.
+type BatchResult struct {
+	Published int           // Events acknowledged by JetStream
+	Failed    []FailedEvent // Events that were not, in batch order
+}
+
+// FailedEvent is an event of a batch that was not published.
+type FailedEvent struct {
+	Event models.Event
+	Err   error
+}
+
+// Err joins the failures of the batch, each annotated with its transaction
+// hash and log index, or returns nil if every event was published.
+func (r BatchResult) Err() error {
+	errs := make([]error, len(r.Failed))
+	for i, f := range r.Failed {
+		errs[i] = fmt.Errorf("event %s:%d: %w", f.Event.TxHash, f.Event.LogIndex, f.Err)
+	}
+	return errors.Join(errs...)
+}
+
+// PublishBatch publishes events asynchronously, each with its own
+// deduplication ID, and waits for all of their acknowledgments. An event
+// counts as published once every schema version of it is acknowledged. A failed
+// event does not stop the rest of the batch; the result reports every
+// failure. Events still unacknowledged when ctx is done are reported as
+// failed with the context error, although JetStream may yet store them.
+//
+// The batch counts as one publish for the circuit breaker: it is rejected as
+// a whole while the breaker is open, and a batch of which nothing was
+// acknowledged counts as a failure.
+func (p *Publisher) PublishBatch(ctx context.Context, events []models.Event) BatchResult {
+	var result BatchResult
+	fail := func(event models.Event, err error) {
+		asyncPublishFailures.WithLabelValues(event.EventName).Inc()
+		result.Failed = append(result.Failed, FailedEvent{Event: event, Err: err})
+		if p.dlq != nil && ctx.Err() == nil {
+			p.deadLetter(ctx, event, err)
+		}
+	}
+
+	if err := p.breaker.allow(); err != nil {
+		for _, event := range events {
+			fail(event, err)
+		}
+		return result
+	}
+
+	// The messages of an event, one per schema version
+	type batchAck struct {
+		futures []jetstream.PubAckFuture
+		event   models.Event
+	}
+	acks := make([]batchAck, 0, len(events))
+	var transportErr error // Last transport failure
+	for _, event := range events {
+		futures, err := p.sendAsync(ctx, event)
+		if err != nil {
+			if errors.As(err, new(*TransportError)) {
+				transportErr = err
+			}
+			fail(event, err)
+			continue
+		}
+		acks = append(acks, batchAck{futures: futures, event: event})
+	}
+
+	for _, ack := range acks {
+		if err := p.awaitAcks(ctx, ack.event, ack.futures); err != nil {
+			if errors.As(err, new(*TransportError)) {
+				transportErr = err
+			}
+			fail(ack.event, err)
+			continue
+		}
+		result.Published++
+	}
+
+	switch {
+	case result.Published > 0:
+		p.breaker.success()
+	case transportErr != nil:
+		p.recordFailure(transportErr)
+	default:
+		p.breaker.release()
+	}
+
+	if len(result.Failed) > 0 {
+		p.logger.Error().
+			Err(result.Err()).
+			Int("published", result.Published).
+			Int("failed", len(result.Failed)).
+			Msg("failed to publish batch")
+	}
+	return result
+}
+
+// sendAsync publishes an event asynchronously in every schema version and
+// returns the acknowledgment futures, one per message or chunk.
+func (p *Publisher) sendAsync(ctx context.Context, event models.Event) ([]jetstream.PubAckFuture, error) {
+	futures := make([]jetstream.PubAckFuture, 0, len(p.schemaVersions()))
+	for _, version := range p.schemaVersions() {
+		msgs, err := p.messages(event, version)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			future, err := p.js.PublishMsgAsync(m.msg, jetstream.WithMsgID(m.msgID))
+			if err != nil {
+				return nil, &TransportError{Err: err}
+			}
+			futures = append(futures, future)
+		}
+	}
+	return futures, nil
+}
+
+// awaitAcks waits for the acknowledgment of every future of an event and
+// returns the first failure.
+func (p *Publisher) awaitAcks(ctx context.Context, event models.Event, futures []jetstream.PubAckFuture) error {
+	for _, future := range futures {
+		select {
+		case ack := <-future.Ok():
+			p.recordAck(ack, event.EventName, future.Msg().Header.Get(jetstream.MsgIDHeader))
+		case err := <-future.Err():
+			return &TransportError{Err: err}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 	return nil
 }
 
 // Close closes the NATS connection.
 func (p *Publisher) Close() {
+	if p.ordering != nil {
+		p.ordering.close()
+	}
 	if p.nc != nil {
 		p.nc.Close()
 		p.logger.Info().Msg("NATS publisher closed")
 	}
 }
-
-// Healthy checks if the NATS connection is healthy.
-func (p *Publisher) Healthy() bool {
-	return p.nc != nil && p.nc.IsConnected()
-}
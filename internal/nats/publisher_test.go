@@ -0,0 +1,662 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/router"
+	"github.com/0xkanth/polymarket-indexer/pkg/codec"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// testNATSURL returns the JetStream-enabled server used by the integration
+// tests in this package, e.g. the docker-compose one:
+//
+//	NATS_TEST_URL=nats://localhost:4222 go test ./internal/nats/
+func testNATSURL(t *testing.T) string {
+	t.Helper()
+	url := os.Getenv("NATS_TEST_URL")
+	if url == "" {
+		t.Skip("NATS_TEST_URL not set, skipping NATS integration test")
+	}
+	return url
+}
+
+// testStreamConfig is the stream the integration tests publish to.
+var testStreamConfig = PublisherConfig{
+	StreamName:    "POLYMARKET_TEST",
+	SubjectPrefix: "POLYMARKET_TEST",
+	MaxAge:        time.Hour,
+	Storage:       jetstream.MemoryStorage,
+	ManageStream:  true,
+}
+
+// TestSubjectPattern tests that the stream subject pattern uses the
+// multi-token wildcard.
+func TestSubjectPattern(t *testing.T) {
+	require.Equal(t, "POLYMARKET.>", SubjectPattern("POLYMARKET"))
+}
+
+// TestPublishThreeTokenSubject tests that an event published on a
+// {prefix}.{EventName}.{ContractAddress} subject is stored by the stream and
+// delivered to a consumer filtering on "{prefix}.>".
+func TestPublishThreeTokenSubject(t *testing.T) {
+	url := testNATSURL(t)
+	logger := zerolog.Nop()
+
+	publisher, err := NewPublisher(url, testStreamConfig, &logger)
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	txHash := "0x" + strings.Repeat("ab", 32)
+	require.NoError(t, publisher.Publish(ctx, models.Event{
+		Block:        100,
+		TxHash:       txHash,
+		LogIndex:     uint(time.Now().UnixNano() % 1_000_000), // unique within the duplicate window
+		ContractAddr: "0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E",
+		EventName:    "OrderFilled",
+		Success:      true,
+	}))
+
+	nc, err := nats.Connect(url)
+	require.NoError(t, err)
+	defer nc.Close()
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+
+	consumer, err := js.OrderedConsumer(ctx, testStreamConfig.StreamName, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{"POLYMARKET_TEST.>"},
+		DeliverPolicy:  jetstream.DeliverLastPolicy,
+	})
+	require.NoError(t, err)
+
+	msg, err := consumer.Next(jetstream.FetchMaxWait(5 * time.Second))
+	require.NoError(t, err)
+	require.Equal(t, "POLYMARKET_TEST.OrderFilled.0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e", msg.Subject())
+	require.Contains(t, string(msg.Data()), txHash)
+}
+
+// TestPublishFanOut tests against a NATS server that a log routed to two
+// handlers is stored once per handler, and routing it again stores nothing.
+func TestPublishFanOut(t *testing.T) {
+	url := testNATSURL(t)
+	logger := zerolog.Nop()
+
+	publisher, err := NewPublisher(url, testStreamConfig, &logger)
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := publisher.js.Stream(ctx, testStreamConfig.StreamName)
+	require.NoError(t, err)
+	info, err := stream.Info(ctx)
+	require.NoError(t, err)
+	consumer, err := stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{SubjectPattern(testStreamConfig.SubjectPrefix)},
+		DeliverPolicy:  jetstream.DeliverByStartSequencePolicy,
+		OptStartSeq:    info.State.LastSeq + 1,
+	})
+	require.NoError(t, err)
+
+	sig := common.HexToHash("0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62")
+	r := router.New(publisher.Publish)
+	for _, name := range []string{"TransferSingle", "BalanceChanged"} {
+		r.RegisterLogHandler(sig, name, func(context.Context, types.Log, uint64) (any, error) {
+			return map[string]string{"handler": name}, nil
+		})
+	}
+	log := types.Log{
+		Address:     common.HexToAddress("0x4D97DCd97eC945f40cF65F87097ACe5EA0476045"),
+		Topics:      []common.Hash{sig},
+		BlockNumber: 100,
+		TxHash:      common.BigToHash(big.NewInt(time.Now().UnixNano())), // unique within the duplicate window
+		Index:       3,
+	}
+	for range 2 {
+		require.NoError(t, r.RouteLog(ctx, log, 1_700_000_000, "0xb1"))
+	}
+
+	var subjects []string
+	for range 2 {
+		msg, err := consumer.Next(jetstream.FetchMaxWait(5 * time.Second))
+		require.NoError(t, err)
+		subjects = append(subjects, msg.Subject())
+	}
+	require.ElementsMatch(t, []string{
+		"POLYMARKET_TEST.TransferSingle.0x4d97dcd97ec945f40cf65f87097ace5ea0476045",
+		"POLYMARKET_TEST.BalanceChanged.0x4d97dcd97ec945f40cf65f87097ace5ea0476045",
+	}, subjects)
+
+	_, err = consumer.Next(jetstream.FetchMaxWait(time.Second))
+	require.ErrorIs(t, err, nats.ErrTimeout, "the second routing is deduplicated")
+}
+
+// TestUnmanagedStream tests that an unmanaged stream is verified but not
+// modified, and that a stream lacking the configured subjects is rejected.
+func TestUnmanagedStream(t *testing.T) {
+	url := testNATSURL(t)
+	logger := zerolog.Nop()
+
+	managed, err := NewPublisher(url, testStreamConfig, &logger)
+	require.NoError(t, err)
+	managed.Close()
+
+	cfg := testStreamConfig
+	cfg.ManageStream = false
+	cfg.MaxAge = 2 * time.Hour
+	publisher, err := NewPublisher(url, cfg, &logger)
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := publisher.js.Stream(ctx, cfg.StreamName)
+	require.NoError(t, err)
+	require.Equal(t, testStreamConfig.MaxAge, stream.CachedInfo().Config.MaxAge)
+
+	cfg.SubjectPrefix = "POLYMARKET_OTHER"
+	_, err = NewPublisher(url, cfg, &logger)
+	require.ErrorIs(t, err, ErrStreamMismatch)
+
+	cfg.StreamName = "POLYMARKET_MISSING"
+	_, err = NewPublisher(url, cfg, &logger)
+	require.ErrorIs(t, err, jetstream.ErrStreamNotFound)
+}
+
+// TestFlushWithoutPending tests that Flush returns immediately when nothing
+// was published asynchronously.
+func TestFlushWithoutPending(t *testing.T) {
+	p := &Publisher{}
+	require.NoError(t, p.Flush(context.Background()))
+}
+
+// testBatch returns n events of a fresh transaction, which keeps them out of
+// the duplicate window.
+func testBatch(n int) []models.Event {
+	txHash := fmt.Sprintf("0x%064x", time.Now().UnixNano())
+	batch := make([]models.Event, n)
+	for i := range batch {
+		batch[i] = models.Event{
+			Block:        100,
+			TxHash:       txHash,
+			LogIndex:     uint(i),
+			ContractAddr: "0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E",
+			EventName:    "OrderFilled",
+			Success:      true,
+		}
+	}
+	return batch
+}
+
+// TestPublishBatch tests that a batch is published asynchronously and every
+// event is stored once its acknowledgments are collected.
+func TestPublishBatch(t *testing.T) {
+	url := testNATSURL(t)
+	logger := zerolog.Nop()
+
+	publisher, err := NewPublisher(url, testStreamConfig, &logger, WithAsyncWindow(4))
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	batch := testBatch(10)
+	stream, err := publisher.js.Stream(ctx, publisher.stream)
+	require.NoError(t, err)
+	info, err := stream.Info(ctx)
+	require.NoError(t, err)
+	stored := info.State.Msgs
+
+	result := publisher.PublishBatch(ctx, batch)
+	require.Equal(t, BatchResult{Published: len(batch)}, result)
+	require.NoError(t, result.Err())
+	info, err = stream.Info(ctx)
+	require.NoError(t, err)
+	require.Equal(t, stored+uint64(len(batch)), info.State.Msgs)
+
+	// Publishing the batch again is deduplicated by message ID
+	require.Equal(t, len(batch), publisher.PublishBatch(ctx, batch).Published)
+	info, err = stream.Info(ctx)
+	require.NoError(t, err)
+	require.Equal(t, stored+uint64(len(batch)), info.State.Msgs)
+}
+
+// TestPublishBatchOutage tests that every event of a batch published while
+// NATS is unreachable is reported as failed.
+func TestPublishBatchOutage(t *testing.T) {
+	url := testNATSURL(t)
+	logger := zerolog.Nop()
+
+	publisher, err := NewPublisher(url, testStreamConfig, &logger)
+	require.NoError(t, err)
+	publisher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	batch := testBatch(3)
+	result := publisher.PublishBatch(ctx, batch)
+	require.Zero(t, result.Published)
+	require.Len(t, result.Failed, len(batch))
+	for i, f := range result.Failed {
+		require.Equal(t, batch[i], f.Event)
+		var transportErr *TransportError
+		require.True(t, errors.As(f.Err, &transportErr))
+	}
+}
+
+// TestSubjectFor tests that the contract segment of a subject is canonical
+// lowercase whatever the casing of the event's address, and that encoding
+// leaves the payload's address as given.
+func TestSubjectFor(t *testing.T) {
+	p := &Publisher{prefix: "POLYMARKET", codec: codec.JSON}
+	want := "POLYMARKET.OrderFilled.0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e"
+
+	for _, addr := range []string{
+		"0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E",
+		"0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e",
+		"0x4BFB41D5B3570DEFD03C39A9A4D8DE6BD8B8982E",
+	} {
+		event := models.Event{EventName: "OrderFilled", ContractAddr: addr}
+		require.Equal(t, want, p.SubjectFor(event), addr)
+
+		msg, _, err := p.encode(event)
+		require.NoError(t, err)
+		require.Equal(t, want, msg.Subject)
+		require.Contains(t, string(msg.Data), addr)
+	}
+}
+
+// TestSubjectForVersion tests that v1 subjects carry no version token and
+// later versions insert theirs after the prefix, with the version in the
+// header and a distinct deduplication ID.
+func TestSubjectForVersion(t *testing.T) {
+	p := &Publisher{prefix: "POLYMARKET", codec: codec.JSON}
+	event := models.Event{EventName: "OrderFilled", ContractAddr: "0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E", TxHash: "0x01", BlockHash: "0xb1", Success: true}
+
+	msg, msgID, err := p.encodeVersion(event, codec.SchemaV1)
+	require.NoError(t, err)
+	require.Equal(t, "POLYMARKET.OrderFilled.0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e", msg.Subject)
+	require.Equal(t, "v1", msg.Header.Get(codec.HeaderSchemaVersion))
+	require.Equal(t, "0x01-0-0xb1-OrderFilled", msgID)
+
+	msg, msgID, err = p.encodeVersion(event, codec.SchemaV2)
+	require.NoError(t, err)
+	require.Equal(t, "POLYMARKET.v2.OrderFilled.0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e", msg.Subject)
+	require.Equal(t, "v2", msg.Header.Get(codec.HeaderSchemaVersion))
+	require.Equal(t, "0x01-0-0xb1-OrderFilled-v2", msgID)
+	require.True(t, subjectCovers(SubjectPattern("POLYMARKET"), msg.Subject))
+}
+
+// TestEncodeContentType tests that messages carry the content type of the
+// configured codec.
+func TestEncodeContentType(t *testing.T) {
+	event := models.Event{EventName: "OrderCancelled", TxHash: "0x01", BlockHash: "0xb1", Payload: models.OrderCancelled{OrderHash: "0x02"}}
+
+	for _, c := range []codec.Codec{codec.JSON, codec.Protobuf} {
+		p := &Publisher{prefix: "POLYMARKET", codec: c}
+		msg, msgID, err := p.encode(event)
+		require.NoError(t, err)
+		require.Equal(t, c.ContentType(), msg.Header.Get(codec.HeaderContentType))
+		require.Equal(t, "0x01-0-0xb1-OrderCancelled-removed", msgID)
+
+		var decoded models.Event
+		require.NoError(t, c.Unmarshal(msg.Data, &decoded))
+		require.Equal(t, event.TxHash, decoded.TxHash)
+	}
+}
+
+// TestEncodeCompression tests that payloads above the threshold are
+// compressed and labelled, and smaller ones are published as encoded.
+func TestEncodeCompression(t *testing.T) {
+	p := &Publisher{prefix: "POLYMARKET", codec: codec.JSON}
+	WithCompression(codec.Gzip, 512)(p)
+
+	small := models.Event{EventName: "OrderCancelled", TxHash: "0x01", Payload: models.OrderCancelled{OrderHash: "0x02"}}
+	msg, _, err := p.encode(small)
+	require.NoError(t, err)
+	require.Empty(t, msg.Header.Get(codec.HeaderContentEncoding))
+	var decoded models.Event
+	require.NoError(t, codec.JSON.Unmarshal(msg.Data, &decoded))
+
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = strings.Repeat("7", 77)
+	}
+	large := models.Event{EventName: "TransferBatch", TxHash: "0x01", Payload: map[string]any{"token_ids": ids}}
+	msg, _, err = p.encode(large)
+	require.NoError(t, err)
+	require.Equal(t, "gzip", msg.Header.Get(codec.HeaderContentEncoding))
+	require.Equal(t, codec.ContentTypeJSON, msg.Header.Get(codec.HeaderContentType))
+
+	data, err := codec.Decompress(msg.Header.Get(codec.HeaderContentEncoding), msg.Data)
+	require.NoError(t, err)
+	require.NoError(t, codec.JSON.Unmarshal(data, &decoded))
+	require.Equal(t, large.EventName, decoded.EventName)
+}
+
+// TestPublishHeadersRoundTrip tests that the content type and metadata
+// headers survive the JetStream round trip.
+func TestPublishHeadersRoundTrip(t *testing.T) {
+	url := testNATSURL(t)
+	logger := zerolog.Nop()
+
+	publisher, err := NewPublisher(url, testStreamConfig, &logger, WithCodec(codec.Protobuf), WithChainID(137))
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	event := models.Event{
+		Block:        65000000,
+		TxHash:       fmt.Sprintf("0x%064x", time.Now().UnixNano()),
+		LogIndex:     7,
+		ContractAddr: "0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E",
+		EventName:    "OrderCancelled",
+		Success:      true,
+		Payload:      models.OrderCancelled{OrderHash: "0x01"},
+	}
+	require.NoError(t, publisher.Publish(ctx, event))
+
+	stream, err := publisher.js.Stream(ctx, publisher.stream)
+	require.NoError(t, err)
+	msg, err := stream.GetLastMsgForSubject(ctx, publisher.SubjectFor(event))
+	require.NoError(t, err)
+
+	require.Equal(t, codec.ContentTypeProtobuf, msg.Header.Get(codec.HeaderContentType))
+	meta, ok := codec.MetadataFromHeaders(msg.Header)
+	require.True(t, ok)
+	require.Equal(t, codec.MetadataOf(event, 137), meta)
+
+	var decoded models.Event
+	require.NoError(t, codec.Protobuf.Unmarshal(msg.Data, &decoded))
+	require.Equal(t, event.TxHash, decoded.TxHash)
+}
+
+// fakeJetStream fails publishes with the queued errors, then acknowledges
+// them. A nil entry in asyncErrs acknowledges that asynchronous publish.
+type fakeJetStream struct {
+	jetstream.JetStream
+	errs      []error
+	asyncErrs []error
+	duplicate bool            // Acknowledge PublishMsg as a duplicate
+	onAsync   func(*nats.Msg) // Called by PublishMsgAsync before it records msg
+	mu        sync.Mutex      // Guards the fields below for concurrent async publishes
+	calls     int
+	published []*nats.Msg // Messages stored by PublishMsg and PublishMsgAsync
+}
+
+func (f *fakeJetStream) PublishMsg(_ context.Context, msg *nats.Msg, _ ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	f.calls++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return nil, err
+	}
+	f.published = append(f.published, msg)
+	return &jetstream.PubAck{Stream: "POLYMARKET", Duplicate: f.duplicate}, nil
+}
+
+// newFakePublisher returns a publisher on a fake JetStream with fast retries.
+func newFakePublisher(js *fakeJetStream, opts ...PublisherOption) *Publisher {
+	logger := zerolog.Nop()
+	p := &Publisher{
+		js:      js,
+		logger:  &logger,
+		prefix:  "POLYMARKET",
+		codec:   codec.JSON,
+		retries: DefaultPublishRetryAttempts,
+		backoff: time.Millisecond,
+		breaker: newCircuitBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// TestPublishRetriesTransportErrors tests that Publish retries transport
+// failures and succeeds once NATS recovers.
+func TestPublishRetriesTransportErrors(t *testing.T) {
+	js := &fakeJetStream{errs: []error{nats.ErrTimeout, nats.ErrNoResponders}}
+	p := newFakePublisher(js)
+
+	require.NoError(t, p.Publish(context.Background(), models.Event{EventName: "OrderFilled", TxHash: "0x01"}))
+	require.Equal(t, 3, js.calls)
+	require.False(t, p.breaker.isOpen())
+}
+
+// TestPublishDuplicateMetric tests that acknowledgments flagged as
+// duplicates are counted.
+func TestPublishDuplicateMetric(t *testing.T) {
+	js := &fakeJetStream{}
+	p := newFakePublisher(js)
+	event := models.Event{EventName: "OrderCancelled", TxHash: "0x01"}
+	duplicates := testutil.ToFloat64(duplicatePublishes.WithLabelValues("OrderCancelled"))
+
+	require.NoError(t, p.Publish(context.Background(), event))
+	require.Equal(t, duplicates, testutil.ToFloat64(duplicatePublishes.WithLabelValues("OrderCancelled")))
+
+	js.duplicate = true
+	require.NoError(t, p.Publish(context.Background(), event))
+	require.Equal(t, duplicates+1, testutil.ToFloat64(duplicatePublishes.WithLabelValues("OrderCancelled")))
+}
+
+// TestMsgIDPrefix tests that the message ID prefix precedes the ID of every
+// schema version, so republished events are not deduplicated against the
+// original publishes.
+func TestMsgIDPrefix(t *testing.T) {
+	p := &Publisher{prefix: "POLYMARKET", codec: codec.JSON}
+	WithMsgIDPrefix("reindex-")(p)
+	event := models.Event{EventName: "OrderFilled", TxHash: "0x01", LogIndex: 7, BlockHash: "0xb1", Success: true}
+
+	_, msgID, err := p.encodeVersion(event, codec.SchemaV1)
+	require.NoError(t, err)
+	require.Equal(t, "reindex-0x01-7-0xb1-OrderFilled", msgID)
+
+	_, msgID, err = p.encodeVersion(event, codec.SchemaV2)
+	require.NoError(t, err)
+	require.Equal(t, "reindex-0x01-7-0xb1-OrderFilled-v2", msgID)
+}
+
+// TestMessageIDReincludedLog tests that a log removed by a reorg and
+// re-included in another block gets three distinct deduplication IDs: the
+// original, its reversal and the re-included copy, so JetStream drops none.
+func TestMessageIDReincludedLog(t *testing.T) {
+	p := &Publisher{prefix: "POLYMARKET", codec: codec.JSON}
+	original := models.Event{EventName: "OrderFilled", TxHash: "0x01", LogIndex: 7, BlockHash: "0xb1", Success: true}
+	removed := original
+	removed.Success = false
+	reincluded := original
+	reincluded.BlockHash = "0xb2"
+
+	ids := map[string]bool{}
+	for _, event := range []models.Event{original, removed, reincluded} {
+		ids[p.messageID(event)] = true
+	}
+	require.Len(t, ids, 3)
+	require.Equal(t, p.messageID(original), p.messageID(original), "redeliveries are still deduplicated")
+}
+
+// TestMessageIDFanOut tests that the events of a log routed to several
+// handlers get distinct deduplication IDs.
+func TestMessageIDFanOut(t *testing.T) {
+	p := &Publisher{prefix: "POLYMARKET", codec: codec.JSON}
+	transfer := models.Event{EventName: "TransferSingle", TxHash: "0x01", LogIndex: 7, BlockHash: "0xb1", Success: true}
+	balance := transfer
+	balance.EventName = "BalanceChanged"
+
+	require.NotEqual(t, p.messageID(transfer), p.messageID(balance))
+}
+
+// TestPublishRetriesExhausted tests that Publish returns a temporary
+// TransportError once its attempts are exhausted.
+func TestPublishRetriesExhausted(t *testing.T) {
+	js := &fakeJetStream{errs: []error{nats.ErrTimeout, nats.ErrTimeout, nats.ErrTimeout}}
+	p := newFakePublisher(js, WithPublishRetry(2, time.Millisecond))
+
+	err := p.Publish(context.Background(), models.Event{EventName: "OrderFilled", TxHash: "0x01"})
+	var transportErr *TransportError
+	require.True(t, errors.As(err, &transportErr))
+	require.ErrorIs(t, err, nats.ErrTimeout)
+	require.Equal(t, 2, js.calls)
+}
+
+// TestPublishHonorsContext tests that Publish stops retrying when the
+// caller's context is done.
+func TestPublishHonorsContext(t *testing.T) {
+	js := &fakeJetStream{errs: []error{nats.ErrTimeout, nats.ErrTimeout}}
+	p := newFakePublisher(js, WithPublishRetry(3, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := p.Publish(ctx, models.Event{EventName: "OrderFilled", TxHash: "0x01"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 1, js.calls)
+}
+
+// TestPublishCircuitBreaker tests that once the breaker opens, Publish fails
+// fast with a non-temporary CircuitOpenError without reaching NATS, and that
+// the publisher reports itself unhealthy.
+func TestPublishCircuitBreaker(t *testing.T) {
+	js := &fakeJetStream{errs: []error{nats.ErrTimeout, nats.ErrTimeout, nats.ErrTimeout, nats.ErrTimeout}}
+	p := newFakePublisher(js, WithCircuitBreaker(2, time.Hour))
+	event := models.Event{EventName: "OrderFilled", TxHash: "0x01"}
+
+	err := p.Publish(context.Background(), event)
+	var openErr *CircuitOpenError
+	require.True(t, errors.As(err, &openErr), "third attempt rejected by the breaker")
+	require.Equal(t, 2, js.calls)
+
+	err = p.Publish(context.Background(), event)
+	require.True(t, errors.As(err, &openErr))
+	require.Equal(t, 2, js.calls)
+
+	var temporary interface{ Temporary() bool }
+	require.False(t, errors.As(err, &temporary))
+	require.False(t, p.Healthy())
+}
+
+func (f *fakeJetStream) PublishMsgAsync(msg *nats.Msg, _ ...jetstream.PublishOpt) (jetstream.PubAckFuture, error) {
+	if f.onAsync != nil {
+		f.onAsync(msg)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+
+	future := &fakePubAckFuture{ok: make(chan *jetstream.PubAck, 1), err: make(chan error, 1), msg: msg}
+	var err error
+	if len(f.asyncErrs) > 0 {
+		err = f.asyncErrs[0]
+		f.asyncErrs = f.asyncErrs[1:]
+	}
+	if err != nil {
+		future.err <- err
+	} else {
+		f.published = append(f.published, msg)
+		future.ok <- &jetstream.PubAck{Stream: "POLYMARKET"}
+	}
+	return future, nil
+}
+
+// PublishAsyncComplete reports every asynchronous publish as resolved, as
+// the fake resolves them when they are sent.
+func (f *fakeJetStream) PublishAsyncComplete() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// fakePubAckFuture is a resolved asynchronous publish.
+type fakePubAckFuture struct {
+	ok  chan *jetstream.PubAck
+	err chan error
+	msg *nats.Msg
+}
+
+func (f *fakePubAckFuture) Ok() <-chan *jetstream.PubAck { return f.ok }
+func (f *fakePubAckFuture) Err() <-chan error            { return f.err }
+func (f *fakePubAckFuture) Msg() *nats.Msg               { return f.msg }
+
+// TestPublishDualSchema tests that every event is published once per
+// configured schema version, and that a batch event counts as published
+// only once all its versions are acknowledged.
+func TestPublishDualSchema(t *testing.T) {
+	js := &fakeJetStream{}
+	p := newFakePublisher(js, WithSchemaVersions(codec.SchemaV1, codec.SchemaV2))
+
+	require.NoError(t, p.Publish(context.Background(), models.Event{EventName: "OrderFilled", ContractAddr: "0xab", TxHash: "0x01"}))
+	require.Len(t, js.published, 2)
+	require.Equal(t, "POLYMARKET.OrderFilled.0xab", js.published[0].Subject)
+	require.Equal(t, "POLYMARKET.v2.OrderFilled.0xab", js.published[1].Subject)
+
+	js = &fakeJetStream{asyncErrs: []error{nil, nats.ErrTimeout, nil, nil}}
+	p = newFakePublisher(js, WithSchemaVersions(codec.SchemaV1, codec.SchemaV2))
+	result := p.PublishBatch(context.Background(), testBatch(2))
+	require.Equal(t, 1, result.Published)
+	require.Len(t, result.Failed, 1)
+	require.Equal(t, uint(0), result.Failed[0].Event.LogIndex)
+}
+
+// TestPublishBatchPartialFailure tests that failed events are reported with
+// their identity and error while the rest of the batch is published.
+func TestPublishBatchPartialFailure(t *testing.T) {
+	js := &fakeJetStream{asyncErrs: []error{nil, nats.ErrTimeout, nil, jetstream.ErrNoStreamResponse}}
+	p := newFakePublisher(js)
+
+	batch := testBatch(5)
+	result := p.PublishBatch(context.Background(), batch)
+	require.Equal(t, 3, result.Published)
+	require.Len(t, result.Failed, 2)
+	require.Equal(t, batch[1], result.Failed[0].Event)
+	require.ErrorIs(t, result.Failed[0].Err, nats.ErrTimeout)
+	require.Equal(t, batch[3], result.Failed[1].Event)
+	require.ErrorIs(t, result.Failed[1].Err, jetstream.ErrNoStreamResponse)
+	require.ErrorContains(t, result.Err(), fmt.Sprintf("event %s:1", batch[0].TxHash))
+	require.Equal(t, len(batch), js.calls)
+	require.False(t, p.breaker.isOpen())
+}
+
+// TestPublishBatchTotalOutage tests that a batch of which nothing is
+// acknowledged counts as a failure for the circuit breaker, and that batches
+// are rejected as a whole while it is open.
+func TestPublishBatchTotalOutage(t *testing.T) {
+	js := &fakeJetStream{asyncErrs: []error{nats.ErrTimeout, nats.ErrTimeout, nats.ErrTimeout}}
+	p := newFakePublisher(js, WithCircuitBreaker(1, time.Hour))
+
+	batch := testBatch(3)
+	result := p.PublishBatch(context.Background(), batch)
+	require.Zero(t, result.Published)
+	require.Len(t, result.Failed, 3)
+	require.True(t, p.breaker.isOpen())
+
+	result = p.PublishBatch(context.Background(), batch)
+	require.Len(t, result.Failed, 3)
+	var openErr *CircuitOpenError
+	require.True(t, errors.As(result.Failed[0].Err, &openErr))
+	require.Equal(t, 3, js.calls)
+}
@@ -13,7 +13,7 @@
 // 5. Consumer picks up from NATS and writes to TimescaleDB
 //
 // KEY COMPONENTS:
-// - chain.OnChainClient: Ethereum JSON-RPC client wrapper (go-ethereum)
+// - chain.Reader: Ethereum JSON-RPC client (chain.OnChainClient, chaintest.Chain in tests)
 // - router.EventLogHandlerRouter: Maps event signatures to handler functions
 // - nats.Publisher: Publishes events to NATS JetStream
 // - handler.Events: Decodes ABI events into Go structs
@@ -23,6 +23,8 @@
 // - polymarket_events_processed_total: Events by type (OrderFilled, OrdersMatched, etc.)
 // - polymarket_block_processing_duration_seconds: Performance tracking
 // - polymarket_processing_errors_total: Error monitoring
+// - polymarket_events_per_block: Event density per block (for batch size tuning)
+// - polymarket_filter_logs_calls_total / polymarket_logs_per_query: getLogs usage
 //
 // USAGE:
 // p := processor.New(logger, chainClient, natsPublisher, cfg)
@@ -30,12 +32,18 @@
 package processor
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/prometheus/client_golang/prometheus"
@@ -44,8 +52,8 @@ import (
 
 	"github.com/0xkanth/polymarket-indexer/internal/chain"
 	"github.com/0xkanth/polymarket-indexer/internal/handler"
-	"github.com/0xkanth/polymarket-indexer/internal/nats"
 	"github.com/0xkanth/polymarket-indexer/internal/router"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
 	"github.com/0xkanth/polymarket-indexer/pkg/models"
 )
 
@@ -70,29 +78,93 @@ var (
 		Name: "polymarket_processing_errors_total",
 		Help: "Total number of processing errors",
 	}, []string{"error_type"})
+
+	eventsPerBlock = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "polymarket_events_per_block",
+		Help:    "Number of monitored contract logs found per processed block",
+		Buckets: logCountBuckets,
+	})
+
+	filterLogsCalls = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "polymarket_filter_logs_calls_total",
+		Help: "Total number of FilterLogs calls made by the processor",
+	})
+
+	logsPerQuery = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "polymarket_logs_per_query",
+		Help:    "Number of logs returned per FilterLogs call",
+		Buckets: logCountBuckets,
+	})
+)
+
+// logCountBuckets are histogram buckets for log/event density metrics.
+var logCountBuckets = []float64{0, 1, 2, 5, 10, 25, 50, 100, 250}
+
+// EventPublisher publishes routed events (implemented by nats.Publisher).
+type EventPublisher interface {
+	Publish(ctx context.Context, event models.Event) error
+}
+
+// LivePublisher publishes events to a best-effort live feed that must never
+// block or fail (implemented by nats.Publisher's core NATS firehose).
+type LivePublisher interface {
+	PublishLive(event models.Event)
+}
+
+var (
+	// ErrContractConfigured is returned when a runtime change targets a contract from chains.json.
+	ErrContractConfigured = errors.New("contract is configured statically")
+
+	// ErrContractNotRegistered is returned when removing a contract that was not added at runtime.
+	ErrContractNotRegistered = errors.New("contract not registered at runtime")
 )
 
 // BlockEventsProcessor handles block and event processing.
 type BlockEventsProcessor struct {
 	logger                zerolog.Logger
-	chain                 *chain.OnChainClient
+	chain                 chain.Reader
 	eventLogHandlerRouter *router.EventLogHandlerRouter
-	natsEventPublisher    *nats.Publisher
-	contracts             []common.Address
+	natsEventPublisher    EventPublisher
 	startBlock            uint64
+	strictMode            bool
+	collateralToken       common.Address // zero when collateral transfers are not indexed
+	backfill              *atomic.Bool   // Set by the syncer while it catches up on history
+
+	// contracts is read by backfill workers while the admin API mutates it
+	mu        sync.RWMutex
+	contracts []common.Address
+	runtime   map[common.Address][]common.Hash // runtime contract -> signatures it registered
+}
+
+// defaultPublishRetry retries transient publish failures of a single event
+// three times, after 100ms, 500ms and 2s.
+var defaultPublishRetry = router.RetryPolicy{
+	Delays: []time.Duration{100 * time.Millisecond, 500 * time.Millisecond, 2 * time.Second},
 }
 
 // BlockEventProcessingConfig holds processor configuration.
 type BlockEventProcessingConfig struct {
-	Contracts  []string // Contract addresses to monitor
-	StartBlock uint64   // Block to start processing from
+	Contracts         []string           // Contract addresses to monitor
+	StartBlock        uint64             // Block to start processing from
+	CTFExchange       string             // Expected emitter of exchange events (optional)
+	ConditionalTokens string             // Expected emitter of conditional token events (optional)
+	StrictMode        bool               // Fail the block instead of skipping events that cannot be published or decoded
+	CollateralToken   string             // Index Transfer events of this ERC20 touching the monitored contracts (optional)
+	HandlerTimeout    time.Duration      // Per-handler timeout (defaults to router.DefaultHandlerTimeout)
+	Enricher          EventEnricher      // Best-effort enrichment applied before publishing (optional)
+	Live              LivePublisher      // Live feed of published events outside backfill (optional)
+	PublishWorkers    int                // Publish asynchronously on this many workers (0 = synchronous)
+	PublishRetry      router.RetryPolicy // Retry policy for transient publish failures (zero = defaultPublishRetry)
 }
 
+// asyncPublishBuffer is the per-worker queue length in asynchronous publish mode.
+const asyncPublishBuffer = 256
+
 // New creates a new processor.
 func New(
 	logger zerolog.Logger,
-	chain *chain.OnChainClient,
-	natsEventPublisher *nats.Publisher,
+	chain chain.Reader,
+	natsEventPublisher EventPublisher,
 	cfg BlockEventProcessingConfig,
 ) (*BlockEventsProcessor, error) {
 	// Parse contract addresses
@@ -104,26 +176,80 @@ func New(
 		contracts[i] = common.HexToAddress(addr)
 	}
 
-	// Create event callback that publishes to NATS
+	// Bind each handler group to the contract expected to emit it
+	exchange, err := expectedContracts(cfg.CTFExchange)
+	if err != nil {
+		return nil, err
+	}
+	conditionalTokens, err := expectedContracts(cfg.ConditionalTokens)
+	if err != nil {
+		return nil, err
+	}
+	collateral, err := expectedContracts(cfg.CollateralToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create event callback that publishes to NATS, and to the live feed
+	// once JetStream has stored the event, unless the syncer is backfilling
+	backfill := new(atomic.Bool)
 	eventCallback := func(ctx context.Context, event models.Event) error {
-		return natsEventPublisher.Publish(ctx, event)
+		if cfg.Enricher != nil {
+			event = cfg.Enricher.Enrich(ctx, event)
+		}
+		if err := natsEventPublisher.Publish(ctx, event); err != nil {
+			return err
+		}
+		if cfg.Live != nil && !backfill.Load() {
+			cfg.Live.PublishLive(event)
+		}
+		return nil
 	}
 
 	// Create eventLogHandlerRouter with callback
-	r := router.New(eventCallback)
-
-	// Register CTF Exchange handlers
-	r.RegisterLogHandler(handler.OrderFilledSig, "OrderFilled", handler.HandleOrderFilled)
-	r.RegisterLogHandler(handler.OrderCancelledSig, "OrderCancelled", handler.HandleOrderCancelled)
-	r.RegisterLogHandler(handler.TokenRegisteredSig, "TokenRegistered", handler.HandleTokenRegistered)
+	publishRetry := cfg.PublishRetry
+	if publishRetry.MaxAttempts == 0 && len(publishRetry.Delays) == 0 {
+		publishRetry = defaultPublishRetry
+	}
+	routerOpts := []router.Option{
+		router.WithCallbackRetry(publishRetry),
+		router.WithAllowedContracts(slices.Concat(contracts, collateral)...),
+	}
+	if cfg.HandlerTimeout > 0 {
+		routerOpts = append(routerOpts, router.WithHandlerTimeout(cfg.HandlerTimeout))
+	}
+	if cfg.StrictMode {
+		routerOpts = append(routerOpts, router.WithFailFast())
+	}
+	if cfg.PublishWorkers > 0 {
+		routerOpts = append(routerOpts, router.WithAsyncCallback(cfg.PublishWorkers, asyncPublishBuffer))
+	}
+	r := router.New(eventCallback, routerOpts...)
+
+	// Register a handler for every event in the shared registry, bound to the
+	// contract expected to emit it
+	bindings := map[events.Contract][]common.Address{
+		events.CTFExchange:       exchange,
+		events.ConditionalTokens: conditionalTokens,
+		events.CollateralToken:   collateral,
+	}
+	for _, def := range events.All() {
+		logHandler, ok := eventHandlers[def.Name]
+		if !ok {
+			return nil, fmt.Errorf("no handler for registered event %s", def.Name)
+		}
+		// Collateral transfers are only indexed when a token is configured:
+		// unbound, the ERC20 Transfer signature would match any token or NFT
+		if def.Contract == events.CollateralToken && len(collateral) == 0 {
+			continue
+		}
+		r.RegisterLogHandler(def.Signature, def.Name, logHandler, bindings[def.Contract]...)
+	}
 
-	// Register Conditional Tokens handlers
-	r.RegisterLogHandler(handler.TransferSingleSig, "TransferSingle", handler.HandleTransferSingle)
-	r.RegisterLogHandler(handler.TransferBatchSig, "TransferBatch", handler.HandleTransferBatch)
-	r.RegisterLogHandler(handler.ConditionPreparationSig, "ConditionPreparation", handler.HandleConditionPreparation)
-	r.RegisterLogHandler(handler.ConditionResolutionSig, "ConditionResolution", handler.HandleConditionResolution)
-	r.RegisterLogHandler(handler.PositionSplitSig, "PositionSplit", handler.HandlePositionSplit)
-	r.RegisterLogHandler(handler.PositionsMergeSig, "PositionsMerge", handler.HandlePositionsMerge)
+	var collateralToken common.Address
+	if len(collateral) > 0 {
+		collateralToken = collateral[0]
+	}
 
 	return &BlockEventsProcessor{
 		logger:                logger.With().Str("component", "processor").Logger(),
@@ -131,10 +257,47 @@ func New(
 		eventLogHandlerRouter: r,
 		natsEventPublisher:    natsEventPublisher,
 		contracts:             contracts,
+		runtime:               make(map[common.Address][]common.Hash),
 		startBlock:            cfg.StartBlock,
+		strictMode:            cfg.StrictMode,
+		collateralToken:       collateralToken,
+		backfill:              backfill,
 	}, nil
 }
 
+// SetBackfill tells the processor whether the syncer is processing
+// historical blocks. Events are not sent to the live feed meanwhile, so live
+// subscribers are not flooded with history.
+func (p *BlockEventsProcessor) SetBackfill(backfill bool) {
+	p.backfill.Store(backfill)
+}
+
+// eventHandlers maps every name in the pkg/events registry to its decoder.
+var eventHandlers = map[string]router.LogHandlerFunc{
+	events.OrderFilled:          handler.HandleOrderFilled,
+	events.OrderCancelled:       handler.HandleOrderCancelled,
+	events.TokenRegistered:      handler.HandleTokenRegistered,
+	events.TransferSingle:       handler.HandleTransferSingle,
+	events.TransferBatch:        handler.HandleTransferBatch,
+	events.ConditionPreparation: handler.HandleConditionPreparation,
+	events.ConditionResolution:  handler.HandleConditionResolution,
+	events.PositionSplit:        handler.HandlePositionSplit,
+	events.PositionsMerge:       handler.HandlePositionsMerge,
+	events.PayoutRedemption:     handler.HandlePayoutRedemption,
+	events.ERC20Transfer:        handler.HandleERC20Transfer,
+}
+
+// expectedContracts parses an optional contract binding for handler registration.
+func expectedContracts(addr string) ([]common.Address, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	if !common.IsHexAddress(addr) {
+		return nil, fmt.Errorf("invalid contract address: %s", addr)
+	}
+	return []common.Address{common.HexToAddress(addr)}, nil
+}
+
 // ProcessBlock processes a single block.
 func (p *BlockEventsProcessor) ProcessBlock(ctx context.Context, blockNumber uint64) error {
 	start := time.Now()
@@ -145,28 +308,42 @@ func (p *BlockEventsProcessor) ProcessBlock(ctx context.Context, blockNumber uin
 	p.logger.Debug().Uint64("block", blockNumber).Msg("processing block")
 
 	// Fetch block header
-	block, err := p.chain.GetBlockByNumber(ctx, blockNumber)
+	header, err := p.chain.GetHeaderByNumber(ctx, blockNumber)
 	if err != nil {
 		processingErrors.WithLabelValues("fetch_block").Inc()
 		return fmt.Errorf("failed to get block %d: %w", blockNumber, err)
 	}
+	return p.processBlock(ctx, header)
+}
+
+// processBlock processes the block of a fetched header.
+func (p *BlockEventsProcessor) processBlock(ctx context.Context, header *types.Header) error {
+	blockNumber := header.Number.Uint64()
+	blockHash := header.Hash().Hex()
 
 	// Filter logs for monitored contracts
-	query := ethereum.FilterQuery{
-		FromBlock: big.NewInt(int64(blockNumber)),
-		ToBlock:   big.NewInt(int64(blockNumber)),
-		Addresses: p.contracts,
+	queries := p.logQueries(header.Number)
+
+	var logs []types.Log
+	for _, query := range queries {
+		filterLogsCalls.Inc()
+		queryLogs, err := p.chain.FilterLogs(ctx, query)
+		if err != nil {
+			processingErrors.WithLabelValues("filter_logs").Inc()
+			return fmt.Errorf("failed to filter logs for block %d: %w", blockNumber, err)
+		}
+		logsPerQuery.Observe(float64(len(queryLogs)))
+		logs = append(logs, queryLogs...)
 	}
-	logs, err := p.chain.FilterLogs(ctx, query)
-	if err != nil {
-		processingErrors.WithLabelValues("filter_logs").Inc()
-		return fmt.Errorf("failed to filter logs for block %d: %w", blockNumber, err)
+	if len(queries) > 1 {
+		logs = mergeLogs(logs)
 	}
+	eventsPerBlock.Observe(float64(len(logs)))
 
 	if len(logs) == 0 {
 		p.logger.Debug().
 			Uint64("block", blockNumber).
-			Uint64("timestamp", block.Time()).
+			Uint64("timestamp", header.Time).
 			Msg("no events in block")
 		blocksProcessed.Inc()
 		return nil
@@ -174,16 +351,27 @@ func (p *BlockEventsProcessor) ProcessBlock(ctx context.Context, blockNumber uin
 
 	p.logger.Info().
 		Uint64("block", blockNumber).
-		Uint64("timestamp", block.Time()).
+		Uint64("timestamp", header.Time).
 		Int("events", len(logs)).
 		Msg("processing block with events")
 
 	// Process each log
 	for _, log := range logs {
-		if err := p.processLog(ctx, log, block.Header(), block.Hash().Hex()); err != nil {
-			processingErrors.WithLabelValues("process_log").Inc()
+		if err := p.processLog(ctx, log, header, blockHash); err != nil {
+			errorType := logErrorType(err)
+			processingErrors.WithLabelValues(errorType).Inc()
+
+			// In strict mode any event we could not handle, other than a
+			// malformed log, fails the whole block so the checkpoint does
+			// not advance past it
+			if p.strictMode && !isMalformedLog(err) {
+				// Drain events already handed to async publishers
+				_ = p.eventLogHandlerRouter.Flush(ctx, blockNumber)
+				return fmt.Errorf("failed to process block %d: %w", blockNumber, err)
+			}
 			p.logger.Error().
 				Err(err).
+				Str("error_type", errorType).
 				Str("tx", log.TxHash.Hex()).
 				Uint("log_index", log.Index).
 				Msg("failed to process log")
@@ -192,43 +380,129 @@ func (p *BlockEventsProcessor) ProcessBlock(ctx context.Context, blockNumber uin
 		}
 	}
 
+	// In asynchronous publish mode, wait for the block's events to be
+	// published before the caller checkpoints it
+	if err := p.eventLogHandlerRouter.Flush(ctx, blockNumber); err != nil {
+		processingErrors.WithLabelValues("event_publish_failed").Inc()
+		if p.strictMode {
+			return fmt.Errorf("failed to publish events of block %d: %w", blockNumber, err)
+		}
+		p.logger.Error().
+			Err(err).
+			Uint64("block", blockNumber).
+			Msg("skipping events that failed to publish")
+	}
+
 	blocksProcessed.Inc()
 	return nil
 }
 
+// LogQueries returns the queries matching the logs the processor handles,
+// without a block range, for log subscriptions. They follow the contracts
+// monitored when called.
+func (p *BlockEventsProcessor) LogQueries() []ethereum.FilterQuery {
+	return p.logQueries(nil)
+}
+
+// logQueries returns the queries for the logs of the monitored contracts and
+// the collateral transfers touching them in block, or in no range if nil.
+func (p *BlockEventsProcessor) logQueries(block *big.Int) []ethereum.FilterQuery {
+	contracts := p.Contracts()
+	queries := []ethereum.FilterQuery{{
+		FromBlock: block,
+		ToBlock:   block,
+		Addresses: contracts,
+	}}
+	return append(queries, collateralTransferQueries(block, p.collateralToken, contracts)...)
+}
+
+// ProcessStreamedLog processes a log delivered by a log subscription. The
+// header of its block is fetched by hash, so a log of a block reorged out
+// since is still published with that block's timestamp; removed logs are
+// published as reversals like in processBlock.
+func (p *BlockEventsProcessor) ProcessStreamedLog(ctx context.Context, log types.Log) error {
+	header, err := p.chain.GetHeaderByHash(ctx, log.BlockHash)
+	if err != nil {
+		processingErrors.WithLabelValues("fetch_block").Inc()
+		return fmt.Errorf("failed to get block %s: %w", log.BlockHash.Hex(), err)
+	}
+
+	if err := p.processLog(ctx, log, header, log.BlockHash.Hex()); err != nil {
+		errorType := logErrorType(err)
+		processingErrors.WithLabelValues(errorType).Inc()
+		if p.strictMode && !isMalformedLog(err) {
+			_ = p.eventLogHandlerRouter.Flush(ctx, log.BlockNumber)
+			return fmt.Errorf("failed to process log %s/%d: %w", log.TxHash.Hex(), log.Index, err)
+		}
+		p.logger.Error().
+			Err(err).
+			Str("error_type", errorType).
+			Str("tx", log.TxHash.Hex()).
+			Uint("log_index", log.Index).
+			Msg("failed to process log")
+		return nil
+	}
+
+	if err := p.eventLogHandlerRouter.Flush(ctx, log.BlockNumber); err != nil {
+		processingErrors.WithLabelValues("event_publish_failed").Inc()
+		if p.strictMode {
+			return fmt.Errorf("failed to publish events of block %d: %w", log.BlockNumber, err)
+		}
+		p.logger.Error().
+			Err(err).
+			Uint64("block", log.BlockNumber).
+			Msg("skipping events that failed to publish")
+	}
+	return nil
+}
+
 // processLog processes a single log entry.
 func (p *BlockEventsProcessor) processLog(ctx context.Context, log types.Log, header *types.Header, blockHash string) error {
+	// Removed logs belong to a reorged block. They are still routed so the
+	// event is published with Success=false and the consumer can undo the
+	// rows written for the original (now non-canonical) log.
 	if log.Removed {
 		p.logger.Warn().
 			Str("tx", log.TxHash.Hex()).
 			Uint("log_index", log.Index).
-			Msg("skipping removed log")
-		return nil
+			Msg("publishing removed log as reversal")
 	}
 
 	// Route log to appropriate handler (this publishes via callback)
 	err := p.eventLogHandlerRouter.RouteLog(ctx, log, header.Time, blockHash)
+	if errors.Is(err, router.ErrNoHandler) || errors.Is(err, router.ErrContractNotAllowed) {
+		// Unknown event type, anonymous log or unmonitored contract, skip silently
+		p.logger.Debug().
+			Err(err).
+			Str("tx", log.TxHash.Hex()).
+			Uint("log_index", log.Index).
+			Msg("no handler for event")
+		return nil
+	}
+
+	// Only used to label metrics and logs; the router decided the routing
+	eventName, _ := p.eventLogHandlerRouter.LogEventName(log.Address, log.Topics[0])
 	if err != nil {
-		// Check if it's just an unknown event (no handler registered)
-		if len(log.Topics) > 0 && !p.eventLogHandlerRouter.HasHandler(log.Topics[0]) {
-			// Unknown event type, skip silently
-			p.logger.Debug().
-				Str("tx", log.TxHash.Hex()).
-				Uint("log_index", log.Index).
-				Str("topic0", log.Topics[0].Hex()).
-				Msg("no handler for event")
-			return nil
+		if !errors.Is(err, router.ErrCallback) {
+			return fmt.Errorf("failed to route %s log: %w", eventName, err)
 		}
-		return fmt.Errorf("failed to route log: %w", err)
-	}
 
-	// Count event (event name is handled in eventLogHandlerRouter callback)
-	var eventName string
-	if len(log.Topics) > 0 {
-		eventName = p.getEventName(log.Topics[0])
-		eventsProcessed.WithLabelValues(eventName).Inc()
+		// Publish retries exhausted
+		if p.strictMode {
+			return fmt.Errorf("failed to publish %s log: %w", eventName, err)
+		}
+		processingErrors.WithLabelValues("event_publish_failed").Inc()
+		p.logger.Error().
+			Err(err).
+			Str("event", eventName).
+			Str("tx", log.TxHash.Hex()).
+			Uint("log_index", log.Index).
+			Msg("skipping event after publish retries exhausted")
+		return nil
 	}
 
+	eventsProcessed.WithLabelValues(eventName).Inc()
+
 	p.logger.Debug().
 		Str("event", eventName).
 		Str("tx", log.TxHash.Hex()).
@@ -238,33 +512,191 @@ func (p *BlockEventsProcessor) processLog(ctx context.Context, log types.Log, he
 	return nil
 }
 
-// getEventName returns a human-readable name for an event signature.
-func (p *BlockEventsProcessor) getEventName(sig common.Hash) string {
-	switch sig {
-	case handler.OrderFilledSig:
-		return "OrderFilled"
-	case handler.OrderCancelledSig:
-		return "OrderCancelled"
-	case handler.TokenRegisteredSig:
-		return "TokenRegistered"
-	case handler.TransferSingleSig:
-		return "TransferSingle"
-	case handler.TransferBatchSig:
-		return "TransferBatch"
-	case handler.ConditionPreparationSig:
-		return "ConditionPreparation"
-	case handler.ConditionResolutionSig:
-		return "ConditionResolution"
-	case handler.PositionSplitSig:
-		return "PositionSplit"
-	case handler.PositionsMergeSig:
-		return "PositionsMerge"
+// AddContract starts monitoring a contract at runtime and registers generic
+// ABI handlers for the given events. Signatures that already have a handler
+// are left untouched. Returns the names of the events that were registered.
+func (p *BlockEventsProcessor) AddContract(addr common.Address, events []abi.Event) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, isRuntime := p.runtime[addr]; !isRuntime && slices.Contains(p.contracts, addr) {
+		return nil, fmt.Errorf("%w: %s", ErrContractConfigured, addr.Hex())
+	}
+	if !slices.Contains(p.contracts, addr) {
+		p.contracts = append(p.contracts, addr)
+		p.eventLogHandlerRouter.SetAllowedContracts(p.allowedContracts())
+	}
+
+	signatures := p.runtime[addr]
+	registered := make([]string, 0, len(events))
+	for _, event := range events {
+		if p.eventLogHandlerRouter.HasHandler(event.ID) {
+			p.logger.Warn().
+				Str("contract", addr.Hex()).
+				Str("event", event.Name).
+				Msg("event already has a handler, skipping")
+			continue
+		}
+		p.eventLogHandlerRouter.RegisterLogHandler(event.ID, event.Name, handler.NewABIHandler(event), addr)
+		signatures = append(signatures, event.ID)
+		registered = append(registered, event.Name)
+	}
+	p.runtime[addr] = signatures
+
+	p.logger.Info().
+		Str("contract", addr.Hex()).
+		Strs("events", registered).
+		Msg("contract added at runtime")
+
+	return registered, nil
+}
+
+// RemoveContract stops monitoring a contract that was added at runtime and
+// unregisters the handlers it registered.
+func (p *BlockEventsProcessor) RemoveContract(addr common.Address) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	signatures, isRuntime := p.runtime[addr]
+	if !isRuntime {
+		if slices.Contains(p.contracts, addr) {
+			return fmt.Errorf("%w: %s", ErrContractConfigured, addr.Hex())
+		}
+		return fmt.Errorf("%w: %s", ErrContractNotRegistered, addr.Hex())
+	}
+
+	for _, sig := range signatures {
+		p.eventLogHandlerRouter.UnregisterLogHandler(sig)
+	}
+	delete(p.runtime, addr)
+
+	// Build a new slice so callers holding the old one are unaffected
+	contracts := make([]common.Address, 0, len(p.contracts))
+	for _, c := range p.contracts {
+		if c != addr {
+			contracts = append(contracts, c)
+		}
+	}
+	p.contracts = contracts
+	p.eventLogHandlerRouter.SetAllowedContracts(p.allowedContracts())
+
+	p.logger.Info().Str("contract", addr.Hex()).Msg("contract removed at runtime")
+	return nil
+}
+
+// allowedContracts returns the contracts the router may route logs from: the
+// monitored contracts plus the collateral token, whose transfers are queried
+// separately. The caller must hold p.mu.
+func (p *BlockEventsProcessor) allowedContracts() []common.Address {
+	if p.collateralToken == (common.Address{}) {
+		return slices.Clone(p.contracts)
+	}
+	return append(slices.Clone(p.contracts), p.collateralToken)
+}
+
+// Contracts returns a snapshot of the monitored contract addresses.
+func (p *BlockEventsProcessor) Contracts() []common.Address {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Clone(p.contracts)
+}
+
+// logErrorType returns the processingErrors label for a processLog error.
+func logErrorType(err error) string {
+	switch {
+	case errors.Is(err, router.ErrCallback):
+		return "event_publish_failed"
+	case errors.Is(err, router.ErrContractMismatch):
+		return "contract_mismatch"
+	case errors.Is(err, router.ErrHandlerTimeout):
+		return "handler_timeout"
+	case errors.Is(err, router.ErrHandlerPanic):
+		return "handler_panic"
+	case errors.Is(err, handler.ErrWrongTopicCount):
+		return "wrong_topic_count"
+	case errors.Is(err, handler.ErrShortData):
+		return "short_data"
+	case errors.Is(err, handler.ErrABIUnpack):
+		return "abi_unpack"
+	case errors.Is(err, handler.ErrInvalidPayload):
+		return "invalid_payload"
 	default:
-		return "Unknown"
+		return "process_log"
+	}
+}
+
+// isMalformedLog reports whether err was caused by the log itself rather
+// than by the indexer. Such logs can never be decoded, so they are skipped
+// even in strict mode. ABI unpack failures are not included: they usually
+// mean our ABI is stale and the event would be lost.
+func isMalformedLog(err error) bool {
+	return errors.Is(err, handler.ErrWrongTopicCount) ||
+		errors.Is(err, handler.ErrShortData) ||
+		errors.Is(err, handler.ErrInvalidPayload) ||
+		errors.Is(err, router.ErrContractMismatch)
+}
+
+// collateralTransferQueries builds the queries for collateral token Transfer
+// logs sent from or to the watched contracts. Topic positions are ANDed by
+// eth_getLogs, so "from OR to" takes one query per position. Filtering on
+// the topics keeps the provider from returning every USDC transfer. The
+// queries cover block, or no range if nil.
+func collateralTransferQueries(block *big.Int, token common.Address, watched []common.Address) []ethereum.FilterQuery {
+	if token == (common.Address{}) || len(watched) == 0 {
+		return nil
+	}
+
+	parties := make([]common.Hash, len(watched))
+	for i, addr := range watched {
+		parties[i] = common.BytesToHash(addr.Bytes())
+	}
+
+	return []ethereum.FilterQuery{
+		{
+			FromBlock: block,
+			ToBlock:   block,
+			Addresses: []common.Address{token},
+			Topics:    [][]common.Hash{{handler.ERC20TransferSig}, parties},
+		},
+		{
+			FromBlock: block,
+			ToBlock:   block,
+			Addresses: []common.Address{token},
+			Topics:    [][]common.Hash{{handler.ERC20TransferSig}, nil, parties},
+		},
+	}
+}
+
+// mergeLogs removes logs returned by more than one query (e.g. a transfer
+// from the exchange to the CTF contract) and restores block order.
+func mergeLogs(logs []types.Log) []types.Log {
+	type logKey struct {
+		txHash common.Hash
+		index  uint
+	}
+
+	seen := make(map[logKey]struct{}, len(logs))
+	merged := logs[:0]
+	for _, log := range logs {
+		key := logKey{log.TxHash, log.Index}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		merged = append(merged, log)
 	}
+
+	slices.SortFunc(merged, func(a, b types.Log) int {
+		if a.BlockNumber != b.BlockNumber {
+			return cmp.Compare(a.BlockNumber, b.BlockNumber)
+		}
+		return cmp.Compare(a.Index, b.Index)
+	})
+	return merged
 }
 
-// ProcessBlockRange processes a range of blocks.
+// ProcessBlockRange processes a range of blocks, fetching their headers
+// with batched RPC calls up front.
 func (p *BlockEventsProcessor) ProcessBlockRange(ctx context.Context, from, to uint64) error {
 	p.logger.Info().
 		Uint64("from", from).
@@ -272,15 +704,28 @@ func (p *BlockEventsProcessor) ProcessBlockRange(ctx context.Context, from, to u
 		Uint64("count", to-from+1).
 		Msg("processing block range")
 
+	numbers := make([]uint64, 0, to-from+1)
 	for block := from; block <= to; block++ {
+		numbers = append(numbers, block)
+	}
+	headers, err := p.chain.GetHeadersByNumbers(ctx, numbers)
+	if err != nil {
+		processingErrors.WithLabelValues("fetch_block").Inc()
+		return fmt.Errorf("failed to get headers of blocks %d-%d: %w", from, to, err)
+	}
+
+	for _, header := range headers {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
-		if err := p.ProcessBlock(ctx, block); err != nil {
-			return fmt.Errorf("failed to process block %d: %w", block, err)
+		start := time.Now()
+		err := p.processBlock(ctx, header)
+		processingDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			return fmt.Errorf("failed to process block %d: %w", header.Number.Uint64(), err)
 		}
 	}
 
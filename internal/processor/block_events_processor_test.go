@@ -0,0 +1,610 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/chain"
+	"github.com/0xkanth/polymarket-indexer/internal/chain/chaintest"
+	"github.com/0xkanth/polymarket-indexer/internal/handler"
+	"github.com/0xkanth/polymarket-indexer/internal/router"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// fakeChain serves blocks with a fixed set of logs, each block at
+// 1700000000 plus its number, recording the batched header fetches. A block
+// hash is taken for its number.
+type fakeChain struct {
+	chain.Reader
+	logs          []types.Log
+	headerBatches [][]uint64
+}
+
+func (f *fakeChain) GetHeaderByNumber(ctx context.Context, blockNumber uint64) (*types.Header, error) {
+	return &types.Header{
+		Number: new(big.Int).SetUint64(blockNumber),
+		Time:   1700000000 + blockNumber,
+	}, nil
+}
+
+func (f *fakeChain) GetHeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return f.GetHeaderByNumber(ctx, hash.Big().Uint64())
+}
+
+func (f *fakeChain) GetHeadersByNumbers(ctx context.Context, numbers []uint64) ([]*types.Header, error) {
+	f.headerBatches = append(f.headerBatches, numbers)
+	headers := make([]*types.Header, len(numbers))
+	for i, number := range numbers {
+		headers[i], _ = f.GetHeaderByNumber(ctx, number)
+	}
+	return headers, nil
+}
+
+func (f *fakeChain) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	return f.logs, nil
+}
+
+// fakePublisher records published events.
+type fakePublisher struct {
+	events []models.Event
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, event models.Event) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+// flakyPublisher fails the first failures publish attempts.
+type flakyPublisher struct {
+	failures int
+	attempts int
+	events   []models.Event
+}
+
+func (f *flakyPublisher) Publish(ctx context.Context, event models.Event) error {
+	f.attempts++
+	if f.attempts <= f.failures {
+		return temporaryError{errors.New("nats: timeout")}
+	}
+	f.events = append(f.events, event)
+	return nil
+}
+
+// temporaryError is a transient publish failure the router retries.
+type temporaryError struct {
+	error
+}
+
+func (temporaryError) Temporary() bool { return true }
+
+// newRetryTestProcessor builds a processor over a single OrderCancelled log
+// with zero retry backoff.
+func newRetryTestProcessor(t *testing.T, publisher EventPublisher, strict bool, topics ...common.Hash) *BlockEventsProcessor {
+	t.Helper()
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	chain := &fakeChain{logs: []types.Log{{Address: exchange, Topics: topics}}}
+
+	p, err := New(zerolog.Nop(), chain, publisher, BlockEventProcessingConfig{
+		Contracts:    []string{exchange.Hex()},
+		StrictMode:   strict,
+		PublishRetry: router.RetryPolicy{MaxAttempts: 4},
+	})
+	require.NoError(t, err)
+	return p
+}
+
+// histogramSnapshot returns the sample count and sum of a histogram.
+func histogramSnapshot(t *testing.T, h prometheus.Histogram) (uint64, float64) {
+	t.Helper()
+	m := &dto.Metric{}
+	require.NoError(t, h.Write(m))
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+// TestRegisteredHandlersHaveEventNames tests that every handler signature
+// resolves to a real event name for metric labels and logs.
+func TestRegisteredHandlersHaveEventNames(t *testing.T) {
+	p, err := New(zerolog.Nop(), nil, nil, BlockEventProcessingConfig{})
+	require.NoError(t, err)
+
+	signatures := []common.Hash{
+		handler.OrderFilledSig,
+		handler.OrderCancelledSig,
+		handler.TokenRegisteredSig,
+		handler.TransferSingleSig,
+		handler.TransferBatchSig,
+		handler.ConditionPreparationSig,
+		handler.ConditionResolutionSig,
+		handler.PositionSplitSig,
+		handler.PositionsMergeSig,
+		handler.PayoutRedemptionSig,
+	}
+	require.Equal(t, len(signatures), p.eventLogHandlerRouter.HandlerCount())
+
+	for _, sig := range signatures {
+		name, ok := p.eventLogHandlerRouter.EventName(sig)
+		require.True(t, ok, "no event name registered for %s", sig.Hex())
+		require.NotEmpty(t, name)
+		require.NotEqual(t, "Unknown", name)
+	}
+}
+
+// TestEveryRegisteredEventIsRouted tests that the processor registers a
+// handler for every event in the shared registry.
+func TestEveryRegisteredEventIsRouted(t *testing.T) {
+	p, err := New(zerolog.Nop(), nil, nil, BlockEventProcessingConfig{
+		CollateralToken: "0x2791Bca1f2de4661ED88A30C99A7a9449Aa84174",
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, len(events.All()), p.eventLogHandlerRouter.HandlerCount())
+	for _, def := range events.All() {
+		name, ok := p.eventLogHandlerRouter.EventName(def.Signature)
+		require.True(t, ok, "no handler registered for %s", def.Name)
+		require.Equal(t, def.Name, name)
+	}
+}
+
+// TestProcessBlockDensityMetrics tests that a block with a known number of
+// logs is reflected in the events-per-block and logs-per-query metrics.
+func TestProcessBlockDensityMetrics(t *testing.T) {
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	chain := &fakeChain{logs: []types.Log{
+		{Address: exchange, Topics: []common.Hash{handler.OrderCancelledSig, common.HexToHash("0x01")}, Index: 0},
+		{Address: exchange, Topics: []common.Hash{handler.OrderCancelledSig, common.HexToHash("0x02")}, Index: 1},
+		{Address: exchange, Topics: []common.Hash{common.HexToHash("0xdead")}, Index: 2},
+	}}
+	publisher := &fakePublisher{}
+
+	p, err := New(zerolog.Nop(), chain, publisher, BlockEventProcessingConfig{
+		Contracts: []string{exchange.Hex()},
+	})
+	require.NoError(t, err)
+
+	callsBefore := testutil.ToFloat64(filterLogsCalls)
+	blockCount, blockSum := histogramSnapshot(t, eventsPerBlock)
+	queryCount, querySum := histogramSnapshot(t, logsPerQuery)
+
+	require.NoError(t, p.ProcessBlock(context.Background(), 100))
+
+	require.Equal(t, callsBefore+1, testutil.ToFloat64(filterLogsCalls))
+
+	count, sum := histogramSnapshot(t, eventsPerBlock)
+	require.Equal(t, blockCount+1, count)
+	require.Equal(t, blockSum+3, sum)
+
+	count, sum = histogramSnapshot(t, logsPerQuery)
+	require.Equal(t, queryCount+1, count)
+	require.Equal(t, querySum+3, sum)
+
+	// Only the two known events are published, stamped by the router
+	require.Len(t, publisher.events, 2)
+	require.False(t, publisher.events[0].ProcessedAt.IsZero())
+}
+
+// TestProcessBlockRetriesTransientPublishErrors tests that a publish failure
+// is retried and the event is not lost.
+func TestProcessBlockRetriesTransientPublishErrors(t *testing.T) {
+	publisher := &flakyPublisher{failures: 2}
+	p := newRetryTestProcessor(t, publisher, false, handler.OrderCancelledSig, common.HexToHash("0x01"))
+
+	require.NoError(t, p.ProcessBlock(context.Background(), 100))
+	require.Equal(t, 3, publisher.attempts)
+	require.Len(t, publisher.events, 1)
+}
+
+// livePublisher records the events sent to the live feed.
+type livePublisher struct {
+	events []models.Event
+}
+
+func (l *livePublisher) PublishLive(event models.Event) {
+	l.events = append(l.events, event)
+}
+
+// TestProcessBlockLiveFeed tests that published events are sent to the live
+// feed outside backfill, and that events which failed to publish or were
+// published during backfill are not.
+func TestProcessBlockLiveFeed(t *testing.T) {
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	chain := &fakeChain{logs: []types.Log{{Address: exchange, Topics: []common.Hash{handler.OrderCancelledSig, common.HexToHash("0x01")}}}}
+	publisher := &flakyPublisher{failures: 1}
+	live := &livePublisher{}
+
+	p, err := New(zerolog.Nop(), chain, publisher, BlockEventProcessingConfig{
+		Contracts:    []string{exchange.Hex()},
+		Live:         live,
+		PublishRetry: router.RetryPolicy{MaxAttempts: 2},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, p.ProcessBlock(context.Background(), 100))
+	require.Len(t, publisher.events, 1)
+	require.Len(t, live.events, 1, "sent once, after the retried publish succeeded")
+
+	p.SetBackfill(true)
+	require.NoError(t, p.ProcessBlock(context.Background(), 101))
+	require.Len(t, publisher.events, 2)
+	require.Len(t, live.events, 1, "not sent during backfill")
+
+	p.SetBackfill(false)
+	require.NoError(t, p.ProcessBlock(context.Background(), 102))
+	require.Len(t, live.events, 2)
+}
+
+// TestProcessBlockRangeBatchesHeaders tests that the headers of a block
+// range are fetched in one batched call, and that each block's events carry
+// the timestamp of its own header.
+func TestProcessBlockRangeBatchesHeaders(t *testing.T) {
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	chain := &fakeChain{logs: []types.Log{{Address: exchange, Topics: []common.Hash{handler.OrderCancelledSig, common.HexToHash("0x01")}}}}
+	publisher := &fakePublisher{}
+
+	p, err := New(zerolog.Nop(), chain, publisher, BlockEventProcessingConfig{
+		Contracts: []string{exchange.Hex()},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, p.ProcessBlockRange(context.Background(), 100, 104))
+	require.Equal(t, [][]uint64{{100, 101, 102, 103, 104}}, chain.headerBatches)
+	require.Len(t, publisher.events, 5)
+	for i, event := range publisher.events {
+		require.Equal(t, uint64(1700000100+i), event.Timestamp)
+	}
+}
+
+// TestProcessBlockDoesNotRetryDecodeErrors tests that deterministic handler
+// errors are not retried.
+func TestProcessBlockDoesNotRetryDecodeErrors(t *testing.T) {
+	publisher := &flakyPublisher{}
+	// OrderCancelled requires two topics
+	p := newRetryTestProcessor(t, publisher, true, handler.OrderCancelledSig)
+
+	require.NoError(t, p.ProcessBlock(context.Background(), 100))
+	require.Equal(t, 0, publisher.attempts)
+}
+
+// TestProcessBlockPublishRetriesExhausted tests the strict and non-strict
+// behavior once all publish retries fail.
+func TestProcessBlockPublishRetriesExhausted(t *testing.T) {
+	topics := []common.Hash{handler.OrderCancelledSig, common.HexToHash("0x01")}
+
+	t.Run("skip", func(t *testing.T) {
+		publisher := &flakyPublisher{failures: 10}
+		p := newRetryTestProcessor(t, publisher, false, topics...)
+
+		before := testutil.ToFloat64(processingErrors.WithLabelValues("event_publish_failed"))
+		require.NoError(t, p.ProcessBlock(context.Background(), 100))
+		require.Equal(t, 4, publisher.attempts)
+		require.Equal(t, before+1, testutil.ToFloat64(processingErrors.WithLabelValues("event_publish_failed")))
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		publisher := &flakyPublisher{failures: 10}
+		p := newRetryTestProcessor(t, publisher, true, topics...)
+
+		err := p.ProcessBlock(context.Background(), 100)
+		require.Error(t, err)
+		require.Equal(t, 4, publisher.attempts)
+	})
+}
+
+// TestProcessBlockClassifiesHandlerErrors tests that handler errors are
+// labelled by type and that strict mode only fails the block for errors
+// that are not caused by a malformed log.
+func TestProcessBlockClassifiesHandlerErrors(t *testing.T) {
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	newProcessor := func(t *testing.T, log types.Log) *BlockEventsProcessor {
+		t.Helper()
+		log.Address = exchange
+		p, err := New(zerolog.Nop(), &fakeChain{logs: []types.Log{log}}, &fakePublisher{}, BlockEventProcessingConfig{
+			Contracts:  []string{exchange.Hex()},
+			StrictMode: true,
+		})
+		require.NoError(t, err)
+		return p
+	}
+
+	t.Run("malformed log is skipped", func(t *testing.T) {
+		p := newProcessor(t, types.Log{Topics: []common.Hash{handler.TransferSingleSig, {}, {}, {}}})
+
+		before := testutil.ToFloat64(processingErrors.WithLabelValues("short_data"))
+		require.NoError(t, p.ProcessBlock(context.Background(), 100))
+		require.Equal(t, before+1, testutil.ToFloat64(processingErrors.WithLabelValues("short_data")))
+	})
+
+	t.Run("ABI unpack failure fails the block", func(t *testing.T) {
+		// Valid heads, but the array offsets point past the end of the data
+		p := newProcessor(t, types.Log{
+			Topics: []common.Hash{handler.TransferBatchSig, {}, {}, {}},
+			Data: common.FromHex("0x" +
+				"0000000000000000000000000000000000000000000000000000000000000040" +
+				"00000000000000000000000000000000000000000000000000000000000000a0"),
+		})
+
+		before := testutil.ToFloat64(processingErrors.WithLabelValues("abi_unpack"))
+		err := p.ProcessBlock(context.Background(), 100)
+		require.ErrorIs(t, err, handler.ErrABIUnpack)
+		require.Equal(t, before+1, testutil.ToFloat64(processingErrors.WithLabelValues("abi_unpack")))
+	})
+}
+
+// TestCollateralTransferQueries tests that collateral transfers are fetched
+// with topic filters on the monitored contracts instead of the whole token.
+func TestCollateralTransferQueries(t *testing.T) {
+	usdc := common.HexToAddress("0x2791Bca1f2de4661ED88A30C99A7a9449Aa84174")
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	ctf := common.HexToAddress("0x4D97DCd97eC945f40cF65F87097ACe5EA0476045")
+
+	require.Empty(t, collateralTransferQueries(big.NewInt(100), common.Address{}, []common.Address{exchange}))
+	require.Empty(t, collateralTransferQueries(big.NewInt(100), usdc, nil))
+
+	queries := collateralTransferQueries(big.NewInt(100), usdc, []common.Address{exchange, ctf})
+	require.Len(t, queries, 2)
+
+	parties := []common.Hash{
+		common.BytesToHash(exchange.Bytes()),
+		common.BytesToHash(ctf.Bytes()),
+	}
+	for _, query := range queries {
+		require.Equal(t, []common.Address{usdc}, query.Addresses)
+		require.Equal(t, uint64(100), query.FromBlock.Uint64())
+		require.Equal(t, uint64(100), query.ToBlock.Uint64())
+		require.Equal(t, []common.Hash{handler.ERC20TransferSig}, query.Topics[0])
+	}
+
+	// from in (exchange, ctf)
+	require.Len(t, queries[0].Topics, 2)
+	require.Equal(t, parties, queries[0].Topics[1])
+
+	// to in (exchange, ctf), any sender
+	require.Len(t, queries[1].Topics, 3)
+	require.Nil(t, queries[1].Topics[1])
+	require.Equal(t, parties, queries[1].Topics[2])
+}
+
+// queryChain returns logs per FilterLogs call in order.
+type queryChain struct {
+	fakeChain
+	results [][]types.Log
+	queries []ethereum.FilterQuery
+}
+
+func (q *queryChain) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	q.queries = append(q.queries, query)
+	logs := q.results[len(q.queries)-1]
+	return logs, nil
+}
+
+// TestProcessBlockCollateralTransfers tests that collateral transfers are
+// fetched, deduplicated across the from/to queries and published in order.
+func TestProcessBlockCollateralTransfers(t *testing.T) {
+	usdc := common.HexToAddress("0x2791Bca1f2de4661ED88A30C99A7a9449Aa84174")
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	ctf := common.HexToAddress("0x4D97DCd97eC945f40cF65F87097ACe5EA0476045")
+	user := common.HexToAddress("0x1234567890123456789012345678901234567890")
+
+	transfer := func(index uint, from, to common.Address) types.Log {
+		return types.Log{
+			Address: usdc,
+			Topics: []common.Hash{
+				handler.ERC20TransferSig,
+				common.BytesToHash(from.Bytes()),
+				common.BytesToHash(to.Bytes()),
+			},
+			Data:        common.LeftPadBytes(big.NewInt(1_000_000).Bytes(), 32),
+			TxHash:      common.HexToHash("0x01"),
+			BlockNumber: 100,
+			Index:       index,
+		}
+	}
+	exchangeToCTF := transfer(3, exchange, ctf)
+
+	chain := &queryChain{results: [][]types.Log{
+		{{Address: exchange, Topics: []common.Hash{handler.OrderCancelledSig, common.HexToHash("0x02")}, TxHash: common.HexToHash("0x01"), BlockNumber: 100, Index: 2}},
+		{exchangeToCTF}, // from monitored
+		{transfer(1, user, exchange), exchangeToCTF}, // to monitored
+	}}
+	publisher := &fakePublisher{}
+
+	p, err := New(zerolog.Nop(), chain, publisher, BlockEventProcessingConfig{
+		Contracts:       []string{exchange.Hex(), ctf.Hex()},
+		CollateralToken: usdc.Hex(),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, p.ProcessBlock(context.Background(), 100))
+	require.Len(t, chain.queries, 3)
+	require.Equal(t, []common.Address{exchange, ctf}, chain.queries[0].Addresses)
+
+	require.Len(t, publisher.events, 3)
+	var order []uint
+	for _, event := range publisher.events {
+		order = append(order, event.LogIndex)
+	}
+	require.Equal(t, []uint{1, 2, 3}, order)
+
+	payload := publisher.events[0].Payload.(models.ERC20Transfer)
+	require.Equal(t, models.FormatAddress(user), payload.From)
+	require.Equal(t, models.FormatAddress(exchange), payload.To)
+	require.Equal(t, int64(1_000_000), payload.Value.Int64())
+}
+
+// TestProcessBlockHandlerTimeout tests that a handler exceeding the handler
+// timeout is counted and skipped while the rest of the block is processed.
+func TestProcessBlockHandlerTimeout(t *testing.T) {
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	slowSig := common.HexToHash("0x5105")
+	chain := &fakeChain{logs: []types.Log{
+		{Address: exchange, Topics: []common.Hash{slowSig}, Index: 0},
+		{Address: exchange, Topics: []common.Hash{handler.OrderCancelledSig, common.HexToHash("0x01")}, Index: 1},
+	}}
+	publisher := &fakePublisher{}
+
+	p, err := New(zerolog.Nop(), chain, publisher, BlockEventProcessingConfig{
+		Contracts:      []string{exchange.Hex()},
+		HandlerTimeout: 20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	defer close(release)
+	p.eventLogHandlerRouter.RegisterLogHandler(slowSig, "Slow", func(ctx context.Context, log types.Log, ts uint64) (any, error) {
+		// Ignores ctx like a handler stuck in a blocking call would
+		<-release
+		return nil, nil
+	})
+
+	before := testutil.ToFloat64(processingErrors.WithLabelValues("handler_timeout"))
+	start := time.Now()
+	require.NoError(t, p.ProcessBlock(context.Background(), 100))
+	require.Less(t, time.Since(start), time.Second)
+
+	require.Equal(t, before+1, testutil.ToFloat64(processingErrors.WithLabelValues("handler_timeout")))
+	require.Len(t, publisher.events, 1)
+	require.Equal(t, "OrderCancelled", publisher.events[0].EventName)
+
+	t.Run("strict", func(t *testing.T) {
+		p.strictMode = true
+		err := p.ProcessBlock(context.Background(), 100)
+		require.ErrorIs(t, err, router.ErrHandlerTimeout)
+	})
+}
+
+// TestProcessBlockSkipsUnmonitoredContracts tests that logs from contracts
+// that are not monitored are skipped, even in strict mode, and that the
+// allowlist follows contracts added and removed at runtime.
+func TestProcessBlockSkipsUnmonitoredContracts(t *testing.T) {
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	chain := &fakeChain{logs: []types.Log{
+		{Address: other, Topics: []common.Hash{handler.OrderCancelledSig, common.HexToHash("0x01")}},
+	}}
+	publisher := &fakePublisher{}
+
+	p, err := New(zerolog.Nop(), chain, publisher, BlockEventProcessingConfig{
+		Contracts:  []string{exchange.Hex()},
+		StrictMode: true,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, p.ProcessBlock(context.Background(), 100))
+	require.Empty(t, publisher.events)
+
+	_, err = p.AddContract(other, nil)
+	require.NoError(t, err)
+	require.NoError(t, p.ProcessBlock(context.Background(), 101))
+	require.Len(t, publisher.events, 1)
+
+	require.NoError(t, p.RemoveContract(other))
+	require.NoError(t, p.ProcessBlock(context.Background(), 102))
+	require.Len(t, publisher.events, 1)
+}
+
+// TestProcessStreamedLog tests that a streamed log is published with the
+// timestamp of the block of its hash, a removed log as a reversal, and that
+// the log queries follow runtime contracts without a block range.
+func TestProcessStreamedLog(t *testing.T) {
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	usdc := common.HexToAddress("0x2791Bca1f2de4661ED88A30C99A7a9449Aa84174")
+	publisher := &fakePublisher{}
+
+	p, err := New(zerolog.Nop(), &fakeChain{}, publisher, BlockEventProcessingConfig{
+		Contracts:       []string{exchange.Hex()},
+		CollateralToken: usdc.Hex(),
+	})
+	require.NoError(t, err)
+
+	log := types.Log{
+		Address:     exchange,
+		Topics:      []common.Hash{handler.OrderCancelledSig, common.HexToHash("0x01")},
+		BlockNumber: 100,
+		BlockHash:   common.BigToHash(big.NewInt(100)),
+		TxHash:      common.HexToHash("0xaa"),
+	}
+	require.NoError(t, p.ProcessStreamedLog(context.Background(), log))
+	log.Removed = true
+	require.NoError(t, p.ProcessStreamedLog(context.Background(), log))
+
+	require.Len(t, publisher.events, 2)
+	for i, success := range []bool{true, false} {
+		require.Equal(t, uint64(1700000100), publisher.events[i].Timestamp)
+		require.Equal(t, log.BlockHash.Hex(), publisher.events[i].BlockHash)
+		require.Equal(t, success, publisher.events[i].Success)
+	}
+
+	other := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	_, err = p.AddContract(other, nil)
+	require.NoError(t, err)
+	queries := p.LogQueries()
+	require.Len(t, queries, 3)
+	require.Equal(t, []common.Address{exchange, other}, queries[0].Addresses)
+	for _, query := range queries {
+		require.Nil(t, query.FromBlock)
+		require.Nil(t, query.ToBlock)
+	}
+}
+
+// TestProcessBlockRoutesLogs tests that the logs of the monitored contracts
+// in a block are published in log order with the block's number, hash and
+// timestamp, while logs of other contracts, other blocks and unknown events
+// are not.
+func TestProcessBlockRoutesLogs(t *testing.T) {
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	cancelled := func(block uint64, index uint, contract common.Address, order byte) types.Log {
+		return types.Log{
+			Address:     contract,
+			Topics:      []common.Hash{handler.OrderCancelledSig, common.BytesToHash([]byte{order})},
+			BlockNumber: block,
+			TxHash:      common.BytesToHash([]byte{byte(block), byte(index)}),
+			Index:       index,
+		}
+	}
+	reader := chaintest.New(101)
+	reader.AddLogs(
+		cancelled(100, 0, other, 1),
+		cancelled(100, 1, exchange, 2),
+		types.Log{Address: exchange, Topics: []common.Hash{common.HexToHash("0x5105")}, BlockNumber: 100, Index: 2},
+		cancelled(100, 3, exchange, 3),
+		cancelled(101, 0, exchange, 4),
+	)
+	publisher := &fakePublisher{}
+
+	p, err := New(zerolog.Nop(), reader, publisher, BlockEventProcessingConfig{
+		Contracts:  []string{exchange.Hex()},
+		StrictMode: true,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, p.ProcessBlock(context.Background(), 100))
+	require.Len(t, publisher.events, 2)
+	for i, index := range []uint{1, 3} {
+		event := publisher.events[i]
+		require.Equal(t, "OrderCancelled", event.EventName)
+		require.Equal(t, index, event.LogIndex)
+		require.Equal(t, uint64(100), event.Block)
+		require.Equal(t, reader.Header(100).Hash().Hex(), event.BlockHash)
+		require.Equal(t, uint64(chaintest.BaseTime+200), event.Timestamp)
+		require.True(t, event.Success)
+	}
+
+	require.NoError(t, p.ProcessBlock(context.Background(), 101))
+	require.Len(t, publisher.events, 3)
+	require.Equal(t, uint64(101), publisher.events[2].Block)
+
+	require.ErrorIs(t, p.ProcessBlock(context.Background(), 102), ethereum.NotFound)
+}
@@ -0,0 +1,182 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/contracts"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+var orderEnrichments = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "polymarket_order_enrichment_total",
+	Help: "Total number of OrderCancelled enrichment attempts by result (hit, miss)",
+}, []string{"result"})
+
+// enrichTimeout bounds the RPC calls made to enrich a single event.
+const enrichTimeout = 5 * time.Second
+
+// EventEnricher attaches data that is not in the log itself to an event
+// before it is published. It must be best-effort: on failure it returns the
+// event unchanged.
+type EventEnricher interface {
+	Enrich(ctx context.Context, event models.Event) models.Event
+}
+
+// OrderReader is the subset of the CTF Exchange bindings used to enrich
+// cancelled orders (implemented by contracts.CTFExchangeCaller).
+type OrderReader interface {
+	GetOrderStatus(opts *bind.CallOpts, orderHash [32]byte) (contracts.OrderStatus, error)
+	HashOrder(opts *bind.CallOpts, order contracts.Order) ([32]byte, error)
+}
+
+// TransactionReader fetches transactions (implemented by chain.OnChainClient).
+type TransactionReader interface {
+	GetTransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, error)
+}
+
+// OrderCancelledEnricher attaches the remaining amount and maker to
+// OrderCancelled events.
+//
+// The remaining amount is read with getOrderStatus at the event's block. The
+// maker is not stored on-chain, so it is recovered from the cancelOrder or
+// cancelOrders calldata of the transaction; it stays empty when the exchange
+// was called through another contract (e.g. a proxy wallet).
+type OrderCancelledEnricher struct {
+	logger   zerolog.Logger
+	orders   OrderReader
+	txs      TransactionReader
+	exchange common.Address
+}
+
+// NewOrderCancelledEnricher creates an enricher reading from the exchange at
+// the given address.
+func NewOrderCancelledEnricher(logger zerolog.Logger, orders OrderReader, txs TransactionReader, exchange common.Address) *OrderCancelledEnricher {
+	return &OrderCancelledEnricher{
+		logger:   logger.With().Str("component", "order_enricher").Logger(),
+		orders:   orders,
+		txs:      txs,
+		exchange: exchange,
+	}
+}
+
+// Enrich implements EventEnricher. Events other than canonical
+// OrderCancelled events are returned as is.
+func (e *OrderCancelledEnricher) Enrich(ctx context.Context, event models.Event) models.Event {
+	cancelled, ok := event.Payload.(models.OrderCancelled)
+	if !ok || event.EventName != events.OrderCancelled || !event.Success {
+		return event
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, enrichTimeout)
+	defer cancel()
+
+	orderHash := common.HexToHash(cancelled.OrderHash)
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(event.Block)}
+
+	status, err := e.orders.GetOrderStatus(opts, orderHash)
+	if err != nil {
+		orderEnrichments.WithLabelValues("miss").Inc()
+		e.logger.Warn().
+			Err(err).
+			Str("order_hash", cancelled.OrderHash).
+			Uint64("block", event.Block).
+			Msg("failed to read order status, publishing bare event")
+		return event
+	}
+	cancelled.Remaining = status.Remaining
+
+	maker, err := e.maker(ctx, opts, common.HexToHash(event.TxHash), orderHash)
+	if err != nil {
+		e.logger.Debug().
+			Err(err).
+			Str("order_hash", cancelled.OrderHash).
+			Str("tx", event.TxHash).
+			Msg("maker not recovered for cancelled order")
+	} else {
+		cancelled.Maker = models.FormatAddress(maker)
+	}
+
+	orderEnrichments.WithLabelValues("hit").Inc()
+	event.Payload = cancelled
+	return event
+}
+
+// maker recovers the maker of orderHash from the calldata of the cancelling
+// transaction.
+func (e *OrderCancelledEnricher) maker(ctx context.Context, opts *bind.CallOpts, txHash, orderHash common.Hash) (common.Address, error) {
+	tx, err := e.txs.GetTransactionByHash(ctx, txHash)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if tx.To() == nil || *tx.To() != e.exchange {
+		return common.Address{}, fmt.Errorf("tx %s does not call the exchange directly", txHash.Hex())
+	}
+
+	orders, err := cancelledOrders(tx.Data())
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	// A single cancelOrder emits exactly this order's hash
+	if len(orders) == 1 {
+		return orders[0].Maker, nil
+	}
+	for _, order := range orders {
+		hash, err := e.orders.HashOrder(opts, order)
+		if err != nil {
+			return common.Address{}, fmt.Errorf("failed to hash order: %w", err)
+		}
+		if hash == orderHash {
+			return order.Maker, nil
+		}
+	}
+	return common.Address{}, fmt.Errorf("order %s not found in tx %s", orderHash.Hex(), txHash.Hex())
+}
+
+// cancelledOrders decodes the orders passed to cancelOrder or cancelOrders.
+func cancelledOrders(calldata []byte) ([]contracts.Order, error) {
+	if len(calldata) < 4 {
+		return nil, fmt.Errorf("calldata too short")
+	}
+	method, err := exchangeABI.MethodById(calldata[:4])
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := method.Inputs.Unpack(calldata[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s calldata: %w", method.Name, err)
+	}
+
+	// Converted the same way the generated bindings convert tuple outputs
+	switch method.Name {
+	case "cancelOrder":
+		order := *abi.ConvertType(args[0], new(contracts.Order)).(*contracts.Order)
+		return []contracts.Order{order}, nil
+	case "cancelOrders":
+		return *abi.ConvertType(args[0], new([]contracts.Order)).(*[]contracts.Order), nil
+	default:
+		return nil, fmt.Errorf("unexpected method %s", method.Name)
+	}
+}
+
+// exchangeABI is the CTF Exchange ABI, used to decode cancel calldata.
+var exchangeABI = func() *abi.ABI {
+	parsed, err := contracts.CTFExchangeMetaData.GetAbi()
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse CTF Exchange ABI: %v", err))
+	}
+	return parsed
+}()
@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/contracts"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// fakeOrderReader serves order status and hashes orders by their salt.
+type fakeOrderReader struct {
+	status    contracts.OrderStatus
+	statusErr error
+	hashes    int
+}
+
+func (f *fakeOrderReader) GetOrderStatus(opts *bind.CallOpts, orderHash [32]byte) (contracts.OrderStatus, error) {
+	return f.status, f.statusErr
+}
+
+func (f *fakeOrderReader) HashOrder(opts *bind.CallOpts, order contracts.Order) ([32]byte, error) {
+	f.hashes++
+	return common.BigToHash(order.Salt), nil
+}
+
+// fakeTxReader serves a single transaction.
+type fakeTxReader struct {
+	tx *types.Transaction
+}
+
+func (f *fakeTxReader) GetTransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, error) {
+	if f.tx == nil {
+		return nil, errors.New("not found")
+	}
+	return f.tx, nil
+}
+
+// testOrder returns an order identified by salt.
+func testOrder(salt int64, maker common.Address) contracts.Order {
+	return contracts.Order{
+		Salt:        big.NewInt(salt),
+		Maker:       maker,
+		Signer:      maker,
+		TokenId:     big.NewInt(1),
+		MakerAmount: big.NewInt(100),
+		TakerAmount: big.NewInt(50),
+		Expiration:  big.NewInt(0),
+		Nonce:       big.NewInt(0),
+		FeeRateBps:  big.NewInt(0),
+		Signature:   []byte{0x01},
+	}
+}
+
+// cancelTx returns a transaction calling method on to with the given args.
+func cancelTx(t *testing.T, to common.Address, method string, args ...any) *types.Transaction {
+	t.Helper()
+	data, err := exchangeABI.Pack(method, args...)
+	require.NoError(t, err)
+	return types.NewTx(&types.LegacyTx{To: &to, Data: data})
+}
+
+// TestOrderCancelledEnricher tests enrichment of OrderCancelled events.
+func TestOrderCancelledEnricher(t *testing.T) {
+	exchange := common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+	makerA := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	makerB := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	status := contracts.OrderStatus{IsFilledOrCancelled: true, Remaining: big.NewInt(40)}
+
+	newEvent := func(salt int64) models.Event {
+		return models.Event{
+			Block:     100,
+			TxHash:    "0x01",
+			EventName: "OrderCancelled",
+			Success:   true,
+			Payload:   models.OrderCancelled{OrderHash: models.FormatHash(common.BigToHash(big.NewInt(salt)))},
+		}
+	}
+
+	t.Run("cancelOrder", func(t *testing.T) {
+		orders := &fakeOrderReader{status: status}
+		txs := &fakeTxReader{tx: cancelTx(t, exchange, "cancelOrder", testOrder(1, makerA))}
+		e := NewOrderCancelledEnricher(zerolog.Nop(), orders, txs, exchange)
+
+		before := testutil.ToFloat64(orderEnrichments.WithLabelValues("hit"))
+		event := e.Enrich(context.Background(), newEvent(1))
+		require.Equal(t, before+1, testutil.ToFloat64(orderEnrichments.WithLabelValues("hit")))
+
+		cancelled := event.Payload.(models.OrderCancelled)
+		require.Equal(t, models.FormatAddress(makerA), cancelled.Maker)
+		require.Equal(t, big.NewInt(40), cancelled.Remaining)
+		require.Zero(t, orders.hashes)
+	})
+
+	t.Run("cancelOrders matches by hash", func(t *testing.T) {
+		orders := &fakeOrderReader{status: status}
+		txs := &fakeTxReader{tx: cancelTx(t, exchange, "cancelOrders",
+			[]contracts.Order{testOrder(1, makerA), testOrder(2, makerB)})}
+		e := NewOrderCancelledEnricher(zerolog.Nop(), orders, txs, exchange)
+
+		cancelled := e.Enrich(context.Background(), newEvent(2)).Payload.(models.OrderCancelled)
+		require.Equal(t, models.FormatAddress(makerB), cancelled.Maker)
+		require.Equal(t, 2, orders.hashes)
+	})
+
+	t.Run("indirect call keeps remaining only", func(t *testing.T) {
+		proxy := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+		orders := &fakeOrderReader{status: status}
+		txs := &fakeTxReader{tx: cancelTx(t, proxy, "cancelOrder", testOrder(1, makerA))}
+		e := NewOrderCancelledEnricher(zerolog.Nop(), orders, txs, exchange)
+
+		cancelled := e.Enrich(context.Background(), newEvent(1)).Payload.(models.OrderCancelled)
+		require.Empty(t, cancelled.Maker)
+		require.Equal(t, big.NewInt(40), cancelled.Remaining)
+	})
+
+	t.Run("RPC failure publishes bare event", func(t *testing.T) {
+		orders := &fakeOrderReader{statusErr: errors.New("rpc unavailable")}
+		e := NewOrderCancelledEnricher(zerolog.Nop(), orders, &fakeTxReader{}, exchange)
+
+		before := testutil.ToFloat64(orderEnrichments.WithLabelValues("miss"))
+		event := newEvent(1)
+		require.Equal(t, event, e.Enrich(context.Background(), event))
+		require.Equal(t, before+1, testutil.ToFloat64(orderEnrichments.WithLabelValues("miss")))
+	})
+
+	t.Run("other events are untouched", func(t *testing.T) {
+		orders := &fakeOrderReader{statusErr: errors.New("must not be called")}
+		e := NewOrderCancelledEnricher(zerolog.Nop(), orders, &fakeTxReader{}, exchange)
+
+		event := models.Event{EventName: "OrderFilled", Success: true, Payload: models.OrderFilled{}}
+		require.Equal(t, event, e.Enrich(context.Background(), event))
+	})
+}
@@ -0,0 +1,123 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// asyncCallback runs the event callback on a pool of workers so publishing
+// does not gate routing. Events are sharded by block number, so all events of
+// a block are handled by one worker in the order they were routed, while
+// blocks routed concurrently are published in parallel.
+type asyncCallback struct {
+	callback EventCallback
+	queues   []chan asyncEvent
+
+	mu      sync.Mutex
+	pending map[uint64]*pendingBlock
+}
+
+// asyncEvent is a routed event waiting for the callback.
+type asyncEvent struct {
+	ctx       context.Context
+	event     models.Event
+	eventName string
+	block     *pendingBlock
+}
+
+// pendingBlock tracks the outstanding callbacks of one block.
+type pendingBlock struct {
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+func (b *pendingBlock) done(err error) {
+	if err != nil {
+		b.mu.Lock()
+		b.errs = append(b.errs, err)
+		b.mu.Unlock()
+	}
+	b.wg.Done()
+}
+
+// newAsyncCallback starts workers goroutines, each with a queue of buffer
+// events.
+func newAsyncCallback(callback EventCallback, workers, buffer int) *asyncCallback {
+	a := &asyncCallback{
+		callback: callback,
+		queues:   make([]chan asyncEvent, workers),
+		pending:  make(map[uint64]*pendingBlock),
+	}
+	for i := range a.queues {
+		a.queues[i] = make(chan asyncEvent, buffer)
+		go a.run(a.queues[i])
+	}
+	return a
+}
+
+// run invokes the callback for every event on queue, in order.
+func (a *asyncCallback) run(queue chan asyncEvent) {
+	for ev := range queue {
+		err := a.callback(ev.ctx, ev.event)
+		if err != nil {
+			callbackErrors.WithLabelValues(ev.eventName).Inc()
+			err = fmt.Errorf("%w: %s log %s:%d: %w", ErrCallback, ev.eventName, ev.event.TxHash, ev.event.LogIndex, err)
+		} else {
+			eventsRouted.WithLabelValues(ev.eventName).Inc()
+		}
+		ev.block.done(err)
+	}
+}
+
+// enqueue hands an event to the worker owning its block.
+func (a *asyncCallback) enqueue(ctx context.Context, eventName string, event models.Event) error {
+	a.mu.Lock()
+	block, ok := a.pending[event.Block]
+	if !ok {
+		block = &pendingBlock{}
+		a.pending[event.Block] = block
+	}
+	block.wg.Add(1)
+	a.mu.Unlock()
+
+	ev := asyncEvent{ctx: ctx, event: event, eventName: eventName, block: block}
+	select {
+	case a.queues[event.Block%uint64(len(a.queues))] <- ev:
+		return nil
+	case <-ctx.Done():
+		block.done(nil)
+		return ctx.Err()
+	}
+}
+
+// flush waits until every event routed for blockNumber has been through the
+// callback and returns their joined errors.
+func (a *asyncCallback) flush(ctx context.Context, blockNumber uint64) error {
+	a.mu.Lock()
+	block, ok := a.pending[blockNumber]
+	delete(a.pending, blockNumber)
+	a.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		block.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		block.mu.Lock()
+		defer block.mu.Unlock()
+		return errors.Join(block.errs...)
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush block %d: %w", blockNumber, ctx.Err())
+	}
+}
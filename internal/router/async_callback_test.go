@@ -0,0 +1,89 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestAsyncCallbackPreservesBlockOrder tests that events of a block reach
+// the callback in routing order when blocks are routed concurrently.
+func TestAsyncCallbackPreservesBlockOrder(t *testing.T) {
+	var mu sync.Mutex
+	published := make(map[uint64][]uint)
+	r := New(func(ctx context.Context, event models.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		published[event.Block] = append(published[event.Block], event.LogIndex)
+		return nil
+	}, WithAsyncCallback(4, 8))
+	r.RegisterLogHandler(testSig, "Async", payloadHandler("payload"))
+
+	const logsPerBlock = 50
+	blocks := []uint64{7, 8, 9}
+
+	// Route blocks concurrently, as the syncer's workers do
+	var wg sync.WaitGroup
+	errs := make(chan error, len(blocks)*(logsPerBlock+1))
+	for _, block := range blocks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := uint(0); i < logsPerBlock; i++ {
+				log := types.Log{Topics: []common.Hash{testSig}, BlockNumber: block, Index: i}
+				errs <- r.RouteLog(context.Background(), log, 0, "")
+			}
+			errs <- r.Flush(context.Background(), block)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	for _, block := range blocks {
+		require.Len(t, published[block], logsPerBlock)
+		for i, index := range published[block] {
+			require.Equal(t, uint(i), index, "block %d out of order", block)
+		}
+	}
+}
+
+// TestAsyncCallbackFlushReturnsErrors tests that callback errors are
+// reported by Flush for the block they belong to.
+func TestAsyncCallbackFlushReturnsErrors(t *testing.T) {
+	r := New(func(ctx context.Context, event models.Event) error {
+		if event.LogIndex == 1 {
+			return errors.New("nats: timeout")
+		}
+		return nil
+	}, WithAsyncCallback(2, 4))
+	r.RegisterLogHandler(testSig, "Async", payloadHandler("payload"))
+
+	for i := uint(0); i < 3; i++ {
+		log := types.Log{Topics: []common.Hash{testSig}, BlockNumber: 10, Index: i}
+		require.NoError(t, r.RouteLog(context.Background(), log, 0, ""))
+	}
+	log := types.Log{Topics: []common.Hash{testSig}, BlockNumber: 11, Index: 1}
+	require.NoError(t, r.RouteLog(context.Background(), log, 0, ""))
+
+	require.ErrorIs(t, r.Flush(context.Background(), 10), ErrCallback)
+	require.ErrorIs(t, r.Flush(context.Background(), 11), ErrCallback)
+
+	// Flushed blocks have nothing pending
+	require.NoError(t, r.Flush(context.Background(), 10))
+}
+
+// TestFlushSynchronous tests that Flush is a no-op without async mode.
+func TestFlushSynchronous(t *testing.T) {
+	r, _ := recordingRouter()
+	require.NoError(t, r.Flush(context.Background(), 1))
+}
@@ -3,59 +3,396 @@ package router
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
 
 	"github.com/0xkanth/polymarket-indexer/pkg/models"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+var (
+	contractMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_router_contract_mismatch_total",
+		Help: "Total number of logs rejected because they were emitted by an unexpected contract",
+	}, []string{"event_type"})
+
+	logsNotAllowed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "polymarket_router_contract_not_allowed_total",
+		Help: "Total number of logs skipped because their contract is not on the allowlist",
+	})
+
+	eventsRouted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_router_events_routed_total",
+		Help: "Total number of events decoded and passed to the callback",
+	}, []string{"event_type"})
+
+	logsWithoutHandler = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_router_no_handler_total",
+		Help: "Total number of logs skipped because no handler is registered",
+	}, []string{"event_type"})
+
+	handlerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_router_handler_errors_total",
+		Help: "Total number of logs a handler failed to decode",
+	}, []string{"event_type"})
+
+	handlerPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_handler_panics_total",
+		Help: "Total number of handler panics recovered by the router",
+	}, []string{"event"})
+
+	callbackRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_router_callback_retries_total",
+		Help: "Total number of callback retries after a transient failure",
+	}, []string{"event_type"})
+
+	callbackErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polymarket_router_callback_errors_total",
+		Help: "Total number of events the callback finally failed to accept, after retries",
+	}, []string{"event_type"})
+)
+
+// unknownEvent labels metrics for logs that match no registered handler,
+// keeping label cardinality bounded by the registered event names.
+const unknownEvent = "Unknown"
+
+var (
+	// ErrContractMismatch is returned when a log's signature is bound to a set of
+	// contracts and the emitting address is not one of them.
+	ErrContractMismatch = errors.New("event emitted by unexpected contract")
+
+	// ErrContractNotAllowed is returned by RouteLog when the router has a
+	// contract allowlist and the emitting address is not on it.
+	ErrContractNotAllowed = errors.New("log emitted by contract not on the allowlist")
+
+	// ErrCallback wraps errors returned by the event callback (e.g. a failed
+	// publish), as opposed to deterministic decode or validation failures.
+	ErrCallback = errors.New("event callback failed")
+
+	// ErrNoHandler is returned by RouteLog when no handler is registered for
+	// a log's signature and emitting contract.
+	ErrNoHandler = errors.New("no handler registered for event")
+
+	// ErrHandlerPanic is returned when a handler panics. The error includes
+	// the panic value and stack trace.
+	ErrHandlerPanic = errors.New("event handler panicked")
+
+	// ErrHandlerTimeout is returned when a handler does not return within the
+	// router's handler timeout.
+	ErrHandlerTimeout = errors.New("event handler timed out")
+)
+
+// DefaultHandlerTimeout bounds a single handler invocation unless overridden
+// with WithHandlerTimeout.
+const DefaultHandlerTimeout = 5 * time.Second
+
 // EventCallback is called after an event is processed by a handler.
+// Errors that implement Temporary() bool and report true (such as
+// nats.TransportError) are retried according to the router's RetryPolicy.
 type EventCallback func(context.Context, models.Event) error
 
+// RetryPolicy controls how transient callback failures are retried. Handler
+// errors are deterministic and never retried.
+type RetryPolicy struct {
+	MaxAttempts int             // Total callback attempts, including the first
+	Backoff     time.Duration   // Delay before the first retry, doubled for each further retry
+	Delays      []time.Duration // Delay before each retry, in place of MaxAttempts and Backoff when set
+}
+
+// delay returns the delay before the nth retry, and false once the policy
+// allows no further attempt.
+func (p RetryPolicy) delay(n int) (time.Duration, bool) {
+	if len(p.Delays) > 0 {
+		if n > len(p.Delays) {
+			return 0, false
+		}
+		return p.Delays[n-1], true
+	}
+	if n >= p.MaxAttempts {
+		return 0, false
+	}
+	return p.Backoff << (n - 1), true
+}
+
+// ParseRetryDelays parses a retry schedule such as ["100ms", "500ms", "2s"].
+func ParseRetryDelays(values []string) ([]time.Duration, error) {
+	delays := make([]time.Duration, 0, len(values))
+	for _, value := range values {
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("invalid retry delay %q", value)
+		}
+		delays = append(delays, delay)
+	}
+	return delays, nil
+}
+
 // LogHandlerFunc processes a log event and returns the parsed payload.
 type LogHandlerFunc func(context.Context, types.Log, uint64) (any, error)
 
 // EventLogHandlerRouter routes blockchain events to their respective handlers.
+// Several handlers may be registered for one signature; each is invoked in
+// registration order and publishes its own event, told apart downstream by
+// its event name, so they need distinct names. Handlers registered for a
+// specific contract take precedence over the signature-wide handlers for logs
+// emitted by that contract. Handlers may be registered at runtime while logs
+// are being routed.
 type EventLogHandlerRouter struct {
-	callback    EventCallback
-	logHandlers map[common.Hash]LogHandlerFunc
-	eventNames  map[common.Hash]string
+	mu               sync.RWMutex
+	callback         EventCallback
+	logHandlers      map[common.Hash][]registration
+	contractHandlers map[common.Hash]map[common.Address][]registration
+	allowed          map[common.Address]struct{} // nil routes logs from any contract
+	timeout          time.Duration
+	failFast         bool
+	retry            RetryPolicy
+
+	// async is set when callbacks run on a worker pool (WithAsyncCallback)
+	async        *asyncCallback
+	asyncWorkers int
+	asyncBuffer  int
+}
+
+// registration is a handler registered for an event signature.
+type registration struct {
+	eventName string
+	handler   LogHandlerFunc
+	contracts map[common.Address]struct{} // nil accepts logs from any contract
+}
+
+// Option configures an EventLogHandlerRouter.
+type Option func(*EventLogHandlerRouter)
+
+// WithHandlerTimeout sets how long a single handler may run before RouteLog
+// gives up on it with ErrHandlerTimeout. Zero disables the timeout.
+func WithHandlerTimeout(timeout time.Duration) Option {
+	return func(r *EventLogHandlerRouter) {
+		r.timeout = timeout
+	}
+}
+
+// WithAllowedContracts only routes logs emitted by the given contracts. See
+// SetAllowedContracts.
+func WithAllowedContracts(contracts ...common.Address) Option {
+	return func(r *EventLogHandlerRouter) {
+		r.allowed = addressSet(contracts)
+	}
+}
+
+// WithCallbackRetry retries callback errors that report themselves as
+// temporary. Without it every callback is attempted once.
+func WithCallbackRetry(policy RetryPolicy) Option {
+	return func(r *EventLogHandlerRouter) {
+		r.retry = policy
+	}
+}
+
+// WithFailFast makes RouteLogs stop at the first log that fails, for strict
+// callers that must not route past a failure.
+func WithFailFast() Option {
+	return func(r *EventLogHandlerRouter) {
+		r.failFast = true
+	}
+}
+
+// WithAsyncCallback runs the callback on workers goroutines instead of in
+// RouteLog, each buffering up to buffer events. Events of one block keep
+// their routing order. Callback errors are no longer returned by RouteLog;
+// call Flush at the end of each block to wait for its events and collect
+// them.
+func WithAsyncCallback(workers, buffer int) Option {
+	return func(r *EventLogHandlerRouter) {
+		r.asyncWorkers = workers
+		r.asyncBuffer = buffer
+	}
 }
 
 // New creates a new event router with the specified callback.
-func New(callback EventCallback) *EventLogHandlerRouter {
-	return &EventLogHandlerRouter{
-		callback:    callback,
-		logHandlers: make(map[common.Hash]LogHandlerFunc),
-		eventNames:  make(map[common.Hash]string),
+func New(callback EventCallback, opts ...Option) *EventLogHandlerRouter {
+	r := &EventLogHandlerRouter{
+		callback:         callback,
+		logHandlers:      make(map[common.Hash][]registration),
+		contractHandlers: make(map[common.Hash]map[common.Address][]registration),
+		timeout:          DefaultHandlerTimeout,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.asyncWorkers > 0 {
+		r.async = newAsyncCallback(r.invokeCallback, r.asyncWorkers, r.asyncBuffer)
+	}
+	return r
+}
+
+// RegisterLogHandler appends a handler for a specific event signature.
+// Handlers already registered for the signature are kept and run first.
+// If contracts are given, the handler only accepts logs from those addresses
+// and logs emitted by any other contract are rejected with ErrContractMismatch.
+// A handler may return a nil payload to publish no event for a log.
+func (r *EventLogHandlerRouter) RegisterLogHandler(eventSignature common.Hash, eventName string, handler LogHandlerFunc, contracts ...common.Address) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reg := registration{eventName: eventName, handler: handler, contracts: addressSet(contracts)}
+
+	r.logHandlers[eventSignature] = appendRegistration(r.logHandlers[eventSignature], reg)
+}
+
+// RegisterContractLogHandler appends a handler for an event signature emitted
+// by one contract. Logs from that contract are routed only to its
+// contract-specific handlers; logs from any other contract fall back to the
+// handlers registered with RegisterLogHandler.
+func (r *EventLogHandlerRouter) RegisterContractLogHandler(contract common.Address, eventSignature common.Hash, eventName string, handler LogHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byContract, ok := r.contractHandlers[eventSignature]
+	if !ok {
+		byContract = make(map[common.Address][]registration)
+		r.contractHandlers[eventSignature] = byContract
+	}
+	byContract[contract] = appendRegistration(byContract[contract], registration{eventName: eventName, handler: handler})
+}
+
+// SetAllowedContracts replaces the contract allowlist. Logs from any other
+// contract are skipped with ErrContractNotAllowed before handler lookup, so
+// logs fed from whole receipts cannot reach handlers of shared signatures
+// (e.g. TransferSingle) from unrelated contracts. An empty list disables the
+// allowlist.
+func (r *EventLogHandlerRouter) SetAllowedContracts(contracts []common.Address) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.allowed = addressSet(contracts)
+}
+
+// addressSet returns the set of addresses, or nil if there are none.
+func addressSet(addrs []common.Address) map[common.Address]struct{} {
+	if len(addrs) == 0 {
+		return nil
+	}
+	set := make(map[common.Address]struct{}, len(addrs))
+	for _, addr := range addrs {
+		set[addr] = struct{}{}
 	}
+	return set
 }
 
-// RegisterLogHandler registers a handler for a specific event signature.
-func (r *EventLogHandlerRouter) RegisterLogHandler(eventSignature common.Hash, eventName string, handler LogHandlerFunc) {
-	r.logHandlers[eventSignature] = handler
-	r.eventNames[eventSignature] = eventName
+// appendRegistration returns a copy of regs with reg appended, so a RouteLog
+// holding the previous slice never sees it change.
+func appendRegistration(regs []registration, reg registration) []registration {
+	out := make([]registration, 0, len(regs)+1)
+	out = append(out, regs...)
+	return append(out, reg)
 }
 
-// RouteLog routes a log event to its registered handler.
+// UnregisterLogHandler removes all signature-wide handlers for a specific
+// event signature. Contract-specific handlers are kept.
+func (r *EventLogHandlerRouter) UnregisterLogHandler(eventSignature common.Hash) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.logHandlers, eventSignature)
+}
+
+// UnregisterContractLogHandler removes the handlers registered for an event
+// signature emitted by one contract.
+func (r *EventLogHandlerRouter) UnregisterContractLogHandler(contract common.Address, eventSignature common.Hash) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byContract := r.contractHandlers[eventSignature]
+	delete(byContract, contract)
+	if len(byContract) == 0 {
+		delete(r.contractHandlers, eventSignature)
+	}
+}
+
+// handlersFor returns the handlers for a log from contract with the given
+// signature: its contract-specific handlers if any, else the signature-wide
+// handlers. The caller must hold r.mu.
+func (r *EventLogHandlerRouter) handlersFor(contract common.Address, eventSignature common.Hash) []registration {
+	if regs := r.contractHandlers[eventSignature][contract]; len(regs) > 0 {
+		return regs
+	}
+	return r.logHandlers[eventSignature]
+}
+
+// allows reports whether logs from contract pass the allowlist. The caller
+// must hold r.mu.
+func (r *EventLogHandlerRouter) allows(contract common.Address) bool {
+	if r.allowed == nil {
+		return true
+	}
+	_, ok := r.allowed[contract]
+	return ok
+}
+
+// RouteLog routes a log event to every handler registered for its signature.
+// It returns ErrContractNotAllowed for logs from contracts outside the
+// allowlist and ErrNoHandler when there is no handler. A failing handler does
+// not stop the others; their errors are joined. A failed callback is returned
+// immediately since the remaining events could not be published either.
 func (r *EventLogHandlerRouter) RouteLog(ctx context.Context, log types.Log, blockTimestamp uint64, blockHash string) error {
-	// Check if we have a handler for this event signature
+	// Anonymous logs have no signature to route on
 	if len(log.Topics) == 0 {
-		return nil // Skip logs without topics
+		logsWithoutHandler.WithLabelValues(unknownEvent).Inc()
+		return fmt.Errorf("%w: anonymous log", ErrNoHandler)
+	}
+
+	eventSig := log.Topics[0]
+	r.mu.RLock()
+	allowed := r.allows(log.Address)
+	regs := r.handlersFor(log.Address, eventSig)
+	r.mu.RUnlock()
+	if !allowed {
+		logsNotAllowed.Inc()
+		return fmt.Errorf("%w: %s", ErrContractNotAllowed, log.Address.Hex())
 	}
+	if len(regs) == 0 {
+		logsWithoutHandler.WithLabelValues(unknownEvent).Inc()
+		return fmt.Errorf("%w: %s", ErrNoHandler, eventSig.Hex())
+	}
+
+	var errs []error
+	for _, reg := range regs {
+		if err := r.routeTo(ctx, reg, log, blockTimestamp, blockHash); err != nil {
+			if errors.Is(err, ErrCallback) {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
 
+// routeTo runs a single registered handler and publishes its event.
+func (r *EventLogHandlerRouter) routeTo(ctx context.Context, reg registration, log types.Log, blockTimestamp uint64, blockHash string) error {
 	eventSig := log.Topics[0]
-	handler, exists := r.logHandlers[eventSig]
-	if !exists {
-		return nil // No handler registered, skip
+
+	// Reject handlers bound to specific contracts when emitted elsewhere
+	if reg.contracts != nil {
+		if _, ok := reg.contracts[log.Address]; !ok {
+			contractMismatches.WithLabelValues(reg.eventName).Inc()
+			return fmt.Errorf("%w: %s from %s", ErrContractMismatch, reg.eventName, log.Address.Hex())
+		}
 	}
 
 	// Execute handler to parse the event
-	payload, err := handler(ctx, log, blockTimestamp)
+	payload, err := r.runHandler(ctx, reg, log, blockTimestamp)
 	if err != nil {
+		handlerErrors.WithLabelValues(reg.eventName).Inc()
 		return fmt.Errorf("handler failed for event %s: %w", eventSig.Hex(), err)
 	}
+	if payload == nil {
+		return nil // Handler chose not to emit an event
+	}
 
 	// Create the event model
 	event := models.Event{
@@ -64,35 +401,178 @@ func (r *EventLogHandlerRouter) RouteLog(ctx context.Context, log types.Log, blo
 		TxHash:       log.TxHash.Hex(),
 		TxIndex:      log.TxIndex,
 		LogIndex:     log.Index,
-		ContractAddr: log.Address.Hex(),
-		EventName:    r.eventNames[eventSig],
+		ContractAddr: models.FormatAddress(log.Address),
+		EventName:    reg.eventName,
 		EventSig:     eventSig.Hex(),
 		Timestamp:    blockTimestamp,
 		Success:      !log.Removed, // Removed logs are from reorged blocks
 		Payload:      payload,
+		ProcessedAt:  time.Now().UTC(),
+	}
+
+	// Hand the event to the workers; Flush reports callback errors
+	if r.async != nil {
+		return r.async.enqueue(ctx, reg.eventName, event)
 	}
 
 	// Call the callback (typically NATS publish)
-	return r.callback(ctx, event)
+	if err := r.invokeCallback(ctx, event); err != nil {
+		callbackErrors.WithLabelValues(reg.eventName).Inc()
+		return fmt.Errorf("%w: %w", ErrCallback, err)
+	}
+	eventsRouted.WithLabelValues(reg.eventName).Inc()
+	return nil
+}
+
+// invokeCallback calls the callback, retrying temporary failures after the
+// delays of the retry policy.
+func (r *EventLogHandlerRouter) invokeCallback(ctx context.Context, event models.Event) error {
+	err := r.callback(ctx, event)
+	for retry := 1; isTemporary(err); retry++ {
+		delay, ok := r.retry.delay(retry)
+		if !ok {
+			break
+		}
+		callbackRetries.WithLabelValues(event.EventName).Inc()
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+
+		err = r.callback(ctx, event)
+	}
+	return err
+}
+
+// isTemporary reports whether err is marked as a transient failure.
+func isTemporary(err error) bool {
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+// handlerResult is the outcome of a handler run by runHandler.
+type handlerResult struct {
+	payload any
+	err     error
+}
+
+// runHandler invokes the handler with the router's timeout. A handler that
+// does not return in time is abandoned: its context is cancelled and its
+// result, if it ever arrives, is discarded.
+func (r *EventLogHandlerRouter) runHandler(ctx context.Context, reg registration, log types.Log, blockTimestamp uint64) (any, error) {
+	if r.timeout <= 0 {
+		return callHandler(ctx, reg, log, blockTimestamp)
+	}
+
+	handlerCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// Buffered so an abandoned handler does not leak a blocked goroutine
+	done := make(chan handlerResult, 1)
+	go func() {
+		payload, err := callHandler(handlerCtx, reg, log, blockTimestamp)
+		done <- handlerResult{payload: payload, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.payload, res.err
+	case <-handlerCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w after %s", ErrHandlerTimeout, r.timeout)
+	}
+}
+
+// callHandler invokes the handler, converting a panic into ErrHandlerPanic
+// so one bad log cannot crash the indexer.
+func callHandler(ctx context.Context, reg registration, log types.Log, blockTimestamp uint64) (payload any, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			handlerPanics.WithLabelValues(reg.eventName).Inc()
+			payload = nil
+			err = fmt.Errorf("%w: %v\n%s", ErrHandlerPanic, rec, debug.Stack())
+		}
+	}()
+	return reg.handler(ctx, log, blockTimestamp)
 }
 
-// RouteLogs routes multiple logs from a receipt.
+// RouteLogs routes the logs of a receipt, skipping those without a handler
+// or outside the allowlist, and joins the failures (the first with WithFailFast).
 func (r *EventLogHandlerRouter) RouteLogs(ctx context.Context, logs []types.Log, blockTimestamp uint64, blockHash string) error {
+	var errs []error
 	for _, log := range logs {
-		if err := r.RouteLog(ctx, log, blockTimestamp, blockHash); err != nil {
+		err := r.RouteLog(ctx, log, blockTimestamp, blockHash)
+		if err == nil || errors.Is(err, ErrNoHandler) || errors.Is(err, ErrContractNotAllowed) {
+			continue
+		}
+		err = fmt.Errorf("log %s:%d: %w", log.TxHash.Hex(), log.Index, err)
+		if r.failFast {
 			return err
 		}
+		errs = append(errs, err)
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
-// HasHandler checks if a handler is registered for the given event signature.
+// Flush waits until the callback has run for every event routed from
+// blockNumber and returns their callback errors, wrapped in ErrCallback.
+// It is a no-op unless the router was created WithAsyncCallback.
+func (r *EventLogHandlerRouter) Flush(ctx context.Context, blockNumber uint64) error {
+	if r.async == nil {
+		return nil
+	}
+	return r.async.flush(ctx, blockNumber)
+}
+
+// HasHandler checks if any handler, signature-wide or contract-specific, is
+// registered for the given event signature.
 func (r *EventLogHandlerRouter) HasHandler(eventSignature common.Hash) bool {
-	_, exists := r.logHandlers[eventSignature]
-	return exists
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.logHandlers[eventSignature]) > 0 || len(r.contractHandlers[eventSignature]) > 0
+}
+
+// EventName returns the name of the first signature-wide handler registered
+// for the given event signature.
+func (r *EventLogHandlerRouter) EventName(eventSignature common.Hash) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	regs := r.logHandlers[eventSignature]
+	if len(regs) == 0 {
+		return "", false
+	}
+	return regs[0].eventName, true
+}
+
+// LogEventName returns the name of the first handler a log from contract with
+// the given signature is routed to, applying the same precedence as RouteLog.
+func (r *EventLogHandlerRouter) LogEventName(contract common.Address, eventSignature common.Hash) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	regs := r.handlersFor(contract, eventSignature)
+	if len(regs) == 0 {
+		return "", false
+	}
+	return regs[0].eventName, true
 }
 
-// HandlerCount returns the number of registered handlers.
+// HandlerCount returns the number of registered handlers across all
+// signatures and contracts.
 func (r *EventLogHandlerRouter) HandlerCount() int {
-	return len(r.logHandlers)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	count := 0
+	for _, regs := range r.logHandlers {
+		count += len(regs)
+	}
+	for _, byContract := range r.contractHandlers {
+		for _, regs := range byContract {
+			count += len(regs)
+		}
+	}
+	return count
 }
@@ -0,0 +1,429 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+var (
+	testSig      = common.HexToHash("0x01")
+	testContract = common.HexToAddress("0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E")
+)
+
+// recordingRouter returns a router whose callback records published events.
+func recordingRouter(opts ...Option) (*EventLogHandlerRouter, *[]models.Event) {
+	var published []models.Event
+	r := New(func(ctx context.Context, event models.Event) error {
+		published = append(published, event)
+		return nil
+	}, opts...)
+	return r, &published
+}
+
+// payloadHandler returns a handler that always returns payload.
+func payloadHandler(payload any) LogHandlerFunc {
+	return func(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
+		return payload, nil
+	}
+}
+
+// TestRouteLogFanOut tests that every handler registered for a signature
+// runs in registration order and publishes its own event.
+func TestRouteLogFanOut(t *testing.T) {
+	r, published := recordingRouter()
+	r.RegisterLogHandler(testSig, "First", payloadHandler("first"))
+	r.RegisterLogHandler(testSig, "Second", payloadHandler("second"))
+
+	require.True(t, r.HasHandler(testSig))
+	require.Equal(t, 2, r.HandlerCount())
+	name, ok := r.EventName(testSig)
+	require.True(t, ok)
+	require.Equal(t, "First", name)
+
+	log := types.Log{Address: testContract, Topics: []common.Hash{testSig}}
+	require.NoError(t, r.RouteLog(context.Background(), log, 1700000000, "0xblock"))
+
+	require.Len(t, *published, 2)
+	require.Equal(t, "First", (*published)[0].EventName)
+	require.Equal(t, "first", (*published)[0].Payload)
+	require.Equal(t, "Second", (*published)[1].EventName)
+	require.Equal(t, "second", (*published)[1].Payload)
+}
+
+// TestRouteLogFanOutHandlerError tests that a failing handler does not stop
+// the other handlers for the signature and that its error is returned.
+func TestRouteLogFanOutHandlerError(t *testing.T) {
+	errDecode := errors.New("decode failed")
+
+	r, published := recordingRouter()
+	r.RegisterLogHandler(testSig, "Broken", func(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
+		return nil, errDecode
+	})
+	r.RegisterLogHandler(testSig, "Working", payloadHandler("ok"))
+
+	log := types.Log{Address: testContract, Topics: []common.Hash{testSig}}
+	err := r.RouteLog(context.Background(), log, 1700000000, "0xblock")
+	require.ErrorIs(t, err, errDecode)
+
+	require.Len(t, *published, 1)
+	require.Equal(t, "Working", (*published)[0].EventName)
+}
+
+// TestRouteLogNilPayload tests that a nil payload publishes no event.
+func TestRouteLogNilPayload(t *testing.T) {
+	r, published := recordingRouter()
+	r.RegisterLogHandler(testSig, "Silent", payloadHandler(nil))
+
+	log := types.Log{Address: testContract, Topics: []common.Hash{testSig}}
+	require.NoError(t, r.RouteLog(context.Background(), log, 1700000000, "0xblock"))
+	require.Empty(t, *published)
+}
+
+// TestRouteLogCallbackErrorStopsFanOut tests that a failed publish is
+// returned as ErrCallback without running the remaining handlers.
+func TestRouteLogCallbackErrorStopsFanOut(t *testing.T) {
+	r := New(func(ctx context.Context, event models.Event) error {
+		return errors.New("nats: timeout")
+	})
+	ran := 0
+	for _, name := range []string{"First", "Second"} {
+		r.RegisterLogHandler(testSig, name, func(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
+			ran++
+			return "payload", nil
+		})
+	}
+
+	log := types.Log{Address: testContract, Topics: []common.Hash{testSig}}
+	err := r.RouteLog(context.Background(), log, 1700000000, "0xblock")
+	require.ErrorIs(t, err, ErrCallback)
+	require.Equal(t, 1, ran)
+}
+
+// TestUnregisterLogHandlerRemovesAll tests that unregistering a signature
+// removes every handler registered for it.
+func TestUnregisterLogHandlerRemovesAll(t *testing.T) {
+	r, _ := recordingRouter()
+	r.RegisterLogHandler(testSig, "First", payloadHandler("first"))
+	r.RegisterLogHandler(testSig, "Second", payloadHandler("second"))
+
+	r.UnregisterLogHandler(testSig)
+	require.False(t, r.HasHandler(testSig))
+	require.Zero(t, r.HandlerCount())
+	_, ok := r.EventName(testSig)
+	require.False(t, ok)
+}
+
+// TestRouteLogContractPrecedence tests that contract-specific handlers take
+// precedence over signature-wide handlers for their contract only.
+func TestRouteLogContractPrecedence(t *testing.T) {
+	negRisk := common.HexToAddress("0xC5d563A36AE78145C45a50134d48A1215220f80a")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000ff")
+
+	r, published := recordingRouter()
+	r.RegisterLogHandler(testSig, "Default", payloadHandler("default"))
+	r.RegisterContractLogHandler(negRisk, testSig, "NegRisk", payloadHandler("negrisk"))
+	require.Equal(t, 2, r.HandlerCount())
+
+	route := func(t *testing.T, addr common.Address) models.Event {
+		t.Helper()
+		*published = nil
+		log := types.Log{Address: addr, Topics: []common.Hash{testSig}}
+		require.NoError(t, r.RouteLog(context.Background(), log, 1700000000, "0xblock"))
+		require.Len(t, *published, 1)
+		return (*published)[0]
+	}
+
+	t.Run("contract-specific handler wins", func(t *testing.T) {
+		require.Equal(t, "NegRisk", route(t, negRisk).EventName)
+		name, ok := r.LogEventName(negRisk, testSig)
+		require.True(t, ok)
+		require.Equal(t, "NegRisk", name)
+	})
+
+	t.Run("other contracts fall back to the signature-wide handler", func(t *testing.T) {
+		require.Equal(t, "Default", route(t, other).EventName)
+		name, ok := r.LogEventName(other, testSig)
+		require.True(t, ok)
+		require.Equal(t, "Default", name)
+	})
+
+	t.Run("unregistering the contract restores the fallback", func(t *testing.T) {
+		r.UnregisterContractLogHandler(negRisk, testSig)
+		require.Equal(t, "Default", route(t, negRisk).EventName)
+		require.Equal(t, 1, r.HandlerCount())
+	})
+}
+
+// TestRouteLogContractOnly tests a signature with only a contract-specific
+// handler: logs from other contracts are skipped.
+func TestRouteLogContractOnly(t *testing.T) {
+	r, published := recordingRouter()
+	r.RegisterContractLogHandler(testContract, testSig, "Scoped", payloadHandler("scoped"))
+	require.True(t, r.HasHandler(testSig))
+
+	other := types.Log{Address: common.HexToAddress("0x00000000000000000000000000000000000000ff"), Topics: []common.Hash{testSig}}
+	require.ErrorIs(t, r.RouteLog(context.Background(), other, 1700000000, "0xblock"), ErrNoHandler)
+	require.Empty(t, *published)
+	_, ok := r.LogEventName(other.Address, testSig)
+	require.False(t, ok)
+
+	scoped := types.Log{Address: testContract, Topics: []common.Hash{testSig}}
+	require.NoError(t, r.RouteLog(context.Background(), scoped, 1700000000, "0xblock"))
+	require.Len(t, *published, 1)
+	require.Equal(t, "Scoped", (*published)[0].EventName)
+}
+
+// TestRouteLogMetrics tests the routing counters and that logs without a
+// handler return ErrNoHandler under the bounded "Unknown" label.
+func TestRouteLogMetrics(t *testing.T) {
+	r, _ := recordingRouter()
+	r.RegisterLogHandler(testSig, "MetricsOK", payloadHandler("ok"))
+	failSig := common.HexToHash("0x02")
+	r.RegisterLogHandler(failSig, "MetricsBroken", func(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
+		return nil, errors.New("decode failed")
+	})
+
+	noHandlerBefore := testutil.ToFloat64(logsWithoutHandler.WithLabelValues(unknownEvent))
+
+	require.NoError(t, r.RouteLog(context.Background(), types.Log{Topics: []common.Hash{testSig}}, 0, ""))
+	require.Error(t, r.RouteLog(context.Background(), types.Log{Topics: []common.Hash{failSig}}, 0, ""))
+	require.ErrorIs(t, r.RouteLog(context.Background(), types.Log{Topics: []common.Hash{common.HexToHash("0x03")}}, 0, ""), ErrNoHandler)
+	require.ErrorIs(t, r.RouteLog(context.Background(), types.Log{}, 0, ""), ErrNoHandler)
+
+	require.Equal(t, float64(1), testutil.ToFloat64(eventsRouted.WithLabelValues("MetricsOK")))
+	require.Equal(t, float64(1), testutil.ToFloat64(handlerErrors.WithLabelValues("MetricsBroken")))
+	require.Equal(t, noHandlerBefore+2, testutil.ToFloat64(logsWithoutHandler.WithLabelValues(unknownEvent)))
+
+	failing := New(func(ctx context.Context, event models.Event) error {
+		return errors.New("nats: timeout")
+	})
+	failing.RegisterLogHandler(testSig, "MetricsUnpublished", payloadHandler("ok"))
+	require.ErrorIs(t, failing.RouteLog(context.Background(), types.Log{Topics: []common.Hash{testSig}}, 0, ""), ErrCallback)
+	require.Equal(t, float64(1), testutil.ToFloat64(callbackErrors.WithLabelValues("MetricsUnpublished")))
+}
+
+// TestRouteLogsAggregatesErrors tests that RouteLogs routes every log past a
+// failure and reports each failure with its log position.
+func TestRouteLogsAggregatesErrors(t *testing.T) {
+	errDecode := errors.New("decode failed")
+	failSig := common.HexToHash("0x02")
+	logs := []types.Log{
+		{Topics: []common.Hash{testSig}, TxHash: common.HexToHash("0xaa"), Index: 0},
+		{Topics: []common.Hash{failSig}, TxHash: common.HexToHash("0xaa"), Index: 1},
+		{Topics: []common.Hash{common.HexToHash("0x03")}, TxHash: common.HexToHash("0xaa"), Index: 2},
+		{Topics: []common.Hash{testSig}, TxHash: common.HexToHash("0xaa"), Index: 3},
+		{Topics: []common.Hash{failSig}, TxHash: common.HexToHash("0xaa"), Index: 4},
+	}
+	register := func(r *EventLogHandlerRouter) {
+		r.RegisterLogHandler(testSig, "OK", payloadHandler("ok"))
+		r.RegisterLogHandler(failSig, "Broken", func(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
+			return nil, errDecode
+		})
+	}
+
+	t.Run("aggregate", func(t *testing.T) {
+		r, published := recordingRouter()
+		register(r)
+
+		err := r.RouteLogs(context.Background(), logs, 0, "")
+		require.ErrorIs(t, err, errDecode)
+		require.Contains(t, err.Error(), ":1:")
+		require.Contains(t, err.Error(), ":4:")
+
+		// Both successes, including the one after the first failure, were published
+		require.Len(t, *published, 2)
+		require.Equal(t, uint(0), (*published)[0].LogIndex)
+		require.Equal(t, uint(3), (*published)[1].LogIndex)
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		r, published := recordingRouter(WithFailFast())
+		register(r)
+
+		err := r.RouteLogs(context.Background(), logs, 0, "")
+		require.ErrorIs(t, err, errDecode)
+		require.NotContains(t, err.Error(), ":4:")
+		require.Len(t, *published, 1)
+	})
+}
+
+// TestRouteLogRecoversHandlerPanic tests that a panicking handler is turned
+// into an error, with and without a handler timeout, and that the router
+// keeps routing afterwards.
+func TestRouteLogRecoversHandlerPanic(t *testing.T) {
+	panicSig := common.HexToHash("0x0bad")
+	for name, timeout := range map[string]time.Duration{"inline": 0, "with timeout": time.Second} {
+		t.Run(name, func(t *testing.T) {
+			r, published := recordingRouter(WithHandlerTimeout(timeout))
+			r.RegisterLogHandler(panicSig, "Panicky", func(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
+				var data []byte
+				return data[31], nil // index out of range
+			})
+			r.RegisterLogHandler(testSig, "OK", payloadHandler("ok"))
+
+			before := testutil.ToFloat64(handlerPanics.WithLabelValues("Panicky"))
+			err := r.RouteLog(context.Background(), types.Log{Topics: []common.Hash{panicSig}}, 0, "")
+			require.ErrorIs(t, err, ErrHandlerPanic)
+			require.Contains(t, err.Error(), "index out of range")
+			require.Contains(t, err.Error(), "goroutine")
+			require.Equal(t, before+1, testutil.ToFloat64(handlerPanics.WithLabelValues("Panicky")))
+
+			require.NoError(t, r.RouteLog(context.Background(), types.Log{Topics: []common.Hash{testSig}}, 0, ""))
+			require.Len(t, *published, 1)
+		})
+	}
+}
+
+// temporaryError is a transient callback failure.
+type temporaryError struct {
+	error
+}
+
+func (temporaryError) Temporary() bool { return true }
+
+// TestRouteLogRetriesTemporaryCallbackErrors tests that only temporary
+// callback errors are retried, up to the policy's attempts.
+func TestRouteLogRetriesTemporaryCallbackErrors(t *testing.T) {
+	retrySig := common.HexToHash("0x0e77")
+	errTimeout := temporaryError{errors.New("nats: timeout")}
+	errMarshal := errors.New("failed to marshal event")
+
+	tests := []struct {
+		name      string
+		failures  []error
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "recovers", failures: []error{errTimeout, errTimeout}, wantCalls: 3},
+		{name: "exhausted", failures: []error{errTimeout, errTimeout, errTimeout, errTimeout}, wantCalls: 3, wantErr: errTimeout},
+		{name: "permanent", failures: []error{errMarshal}, wantCalls: 1, wantErr: errMarshal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			r := New(func(ctx context.Context, event models.Event) error {
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			}, WithCallbackRetry(RetryPolicy{MaxAttempts: 3}))
+			r.RegisterLogHandler(retrySig, "Retried", payloadHandler("ok"))
+
+			before := testutil.ToFloat64(callbackRetries.WithLabelValues("Retried"))
+			err := r.RouteLog(context.Background(), types.Log{Topics: []common.Hash{retrySig}}, 0, "")
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, ErrCallback)
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.wantCalls, calls)
+			require.Equal(t, before+float64(tt.wantCalls-1), testutil.ToFloat64(callbackRetries.WithLabelValues("Retried")))
+		})
+	}
+}
+
+// TestRetryPolicyDelays tests that a policy with Delays retries once after
+// each of them, and that one without doubles Backoff up to MaxAttempts.
+func TestRetryPolicyDelays(t *testing.T) {
+	schedule := func(p RetryPolicy) []time.Duration {
+		var delays []time.Duration
+		for n := 1; ; n++ {
+			delay, ok := p.delay(n)
+			if !ok {
+				return delays
+			}
+			delays = append(delays, delay)
+		}
+	}
+
+	requested := []time.Duration{100 * time.Millisecond, 500 * time.Millisecond, 2 * time.Second}
+	require.Equal(t, requested, schedule(RetryPolicy{MaxAttempts: 10, Delays: requested}))
+	require.Equal(t, []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, time.Second},
+		schedule(RetryPolicy{MaxAttempts: 4, Backoff: 250 * time.Millisecond}))
+	require.Empty(t, schedule(RetryPolicy{}))
+
+	delays, err := ParseRetryDelays([]string{"100ms", "500ms", "2s"})
+	require.NoError(t, err)
+	require.Equal(t, requested, delays)
+	_, err = ParseRetryDelays([]string{"soon"})
+	require.Error(t, err)
+}
+
+// TestRouteLogDoesNotRetryHandlerErrors tests that handler errors are never
+// retried, even when they are temporary.
+func TestRouteLogDoesNotRetryHandlerErrors(t *testing.T) {
+	calls := 0
+	r, published := recordingRouter(WithCallbackRetry(RetryPolicy{MaxAttempts: 3}))
+	r.RegisterLogHandler(testSig, "Broken", func(ctx context.Context, log types.Log, timestamp uint64) (any, error) {
+		calls++
+		return nil, temporaryError{errors.New("rpc: timeout")}
+	})
+
+	err := r.RouteLog(context.Background(), types.Log{Topics: []common.Hash{testSig}}, 0, "")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrCallback)
+	require.Equal(t, 1, calls)
+	require.Empty(t, *published)
+}
+
+// TestRouteLogAllowedContracts tests that logs from contracts outside the
+// allowlist are skipped before handler lookup, and that RouteLogs skips them.
+func TestRouteLogAllowedContracts(t *testing.T) {
+	other := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	r, published := recordingRouter(WithAllowedContracts(testContract))
+	r.RegisterLogHandler(testSig, "Transfer", payloadHandler("ok"))
+
+	before := testutil.ToFloat64(logsNotAllowed)
+	err := r.RouteLog(context.Background(), types.Log{Address: other, Topics: []common.Hash{testSig}}, 0, "")
+	require.ErrorIs(t, err, ErrContractNotAllowed)
+	require.Equal(t, before+1, testutil.ToFloat64(logsNotAllowed))
+	require.Empty(t, *published)
+
+	logs := []types.Log{
+		{Address: other, Topics: []common.Hash{testSig}},
+		{Address: testContract, Topics: []common.Hash{testSig}},
+	}
+	require.NoError(t, r.RouteLogs(context.Background(), logs, 0, ""))
+	require.Len(t, *published, 1)
+	require.Equal(t, models.FormatAddress(testContract), (*published)[0].ContractAddr)
+
+	r.SetAllowedContracts([]common.Address{testContract, other})
+	require.NoError(t, r.RouteLog(context.Background(), logs[0], 0, ""))
+	require.Len(t, *published, 2)
+
+	// An empty allowlist routes logs from any contract
+	r.SetAllowedContracts(nil)
+	require.NoError(t, r.RouteLog(context.Background(), types.Log{Address: common.HexToAddress("0xbb"), Topics: []common.Hash{testSig}}, 0, ""))
+	require.Len(t, *published, 3)
+}
+
+// TestRouteLogContractMismatch tests that a log whose signature is bound to
+// a contract is rejected and counted when another contract emits it, and
+// that the bound contract is still routed.
+func TestRouteLogContractMismatch(t *testing.T) {
+	other := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	r, published := recordingRouter()
+	r.RegisterLogHandler(testSig, "Bound", payloadHandler("ok"), testContract)
+
+	before := testutil.ToFloat64(contractMismatches.WithLabelValues("Bound"))
+	err := r.RouteLog(context.Background(), types.Log{Address: other, Topics: []common.Hash{testSig}}, 0, "")
+	require.ErrorIs(t, err, ErrContractMismatch)
+	require.ErrorContains(t, err, other.Hex())
+	require.Equal(t, before+1, testutil.ToFloat64(contractMismatches.WithLabelValues("Bound")))
+	require.Empty(t, *published)
+
+	require.NoError(t, r.RouteLog(context.Background(), types.Log{Address: testContract, Topics: []common.Hash{testSig}}, 0, ""))
+	require.Equal(t, before+1, testutil.ToFloat64(contractMismatches.WithLabelValues("Bound")))
+	require.Len(t, *published, 1)
+}
@@ -0,0 +1,382 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Tables written by a Batch, in the order they are flushed.
+const (
+	tableOrderFills           = "order_fills"
+	tableTokenTransfers       = "token_transfers"
+	tableConditions           = "conditions"
+	tableConditionResolutions = "condition_resolutions"
+)
+
+var tables = []string{tableOrderFills, tableTokenTransfers, tableConditions, tableConditionResolutions}
+
+// Batch is the store.Store buffering the rows of a batch of events until
+// Flush. Only order fills, token transfers and conditions are mirrored:
+// raw events, the other parsed events, wallet positions and quarantined
+// events are kept in Postgres only, so their methods store nothing.
+//
+// Each row gets a version above every row buffered before it, so of the
+// rows sharing a key (a redelivery, or a row and its reorg tombstone) the
+// last one stored is the one kept.
+type Batch struct {
+	client  *Client
+	rows    map[string][]any
+	version uint64
+}
+
+var _ store.Store = (*Batch)(nil)
+
+// NewBatch returns an empty batch flushed to c.
+func (c *Client) NewBatch() *Batch {
+	return &Batch{client: c, rows: make(map[string][]any)}
+}
+
+// Len returns the number of buffered rows.
+func (b *Batch) Len() int {
+	n := 0
+	for _, rows := range b.rows {
+		n += len(rows)
+	}
+	return n
+}
+
+// Flush inserts the buffered rows, one insert per table, and empties the
+// batch once they are all written. A failed flush may have written some
+// tables; flushing the same events again replaces those rows.
+func (b *Batch) Flush(ctx context.Context) error {
+	for _, table := range tables {
+		if rows := b.rows[table]; len(rows) > 0 {
+			if err := b.client.insert(ctx, table, rows); err != nil {
+				return err
+			}
+		}
+	}
+	b.rows = make(map[string][]any)
+	return nil
+}
+
+// WithTx runs fn on b, dropping the rows it buffered if it fails, so a
+// failed event flushes none of its rows.
+func (b *Batch) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	buffered := make(map[string]int, len(b.rows))
+	for table, rows := range b.rows {
+		buffered[table] = len(rows)
+	}
+	if err := fn(b); err != nil {
+		for table, rows := range b.rows {
+			b.rows[table] = rows[:buffered[table]]
+		}
+		return err
+	}
+	return nil
+}
+
+// nextVersion returns the version of the next buffered row.
+func (b *Batch) nextVersion() uint64 {
+	b.version = max(b.version+1, uint64(time.Now().UnixNano()))
+	return b.version
+}
+
+// add buffers a row of table.
+func (b *Batch) add(table string, row any) {
+	b.rows[table] = append(b.rows[table], row)
+}
+
+// logRow holds the columns every table has: the log a row was stored from,
+// and the ReplacingMergeTree version and tombstone flag.
+type logRow struct {
+	BlockNumber     uint64 `json:"block_number"`
+	BlockTimestamp  uint64 `json:"block_timestamp"`
+	TransactionHash string `json:"transaction_hash"`
+	LogIndex        uint   `json:"log_index"`
+	Version         uint64 `json:"version"`
+	IsDeleted       uint8  `json:"is_deleted"`
+}
+
+func (b *Batch) logRow(event models.Event, deleted bool) logRow {
+	row := logRow{
+		BlockNumber:     event.Block,
+		BlockTimestamp:  event.Timestamp,
+		TransactionHash: event.TxHash,
+		LogIndex:        event.LogIndex,
+		Version:         b.nextVersion(),
+	}
+	if deleted {
+		row.IsDeleted = 1
+	}
+	return row
+}
+
+type orderFillRow struct {
+	logRow
+	OrderHash         string  `json:"order_hash"`
+	Maker             string  `json:"maker"`
+	Taker             string  `json:"taker"`
+	MakerAssetID      string  `json:"maker_asset_id"`
+	TakerAssetID      string  `json:"taker_asset_id"`
+	MakerAmountFilled string  `json:"maker_amount_filled"`
+	TakerAmountFilled string  `json:"taker_amount_filled"`
+	Fee               string  `json:"fee"`
+	Side              string  `json:"side"`
+	Price             *string `json:"price"`
+	IsOperatorFill    bool    `json:"is_operator_fill"`
+}
+
+type tokenTransferRow struct {
+	logRow
+	BatchIndex   int    `json:"batch_index"`
+	Operator     string `json:"operator"`
+	FromAddress  string `json:"from_address"`
+	ToAddress    string `json:"to_address"`
+	TokenID      string `json:"token_id"`
+	Amount       string `json:"amount"`
+	TransferKind string `json:"transfer_kind"`
+}
+
+type conditionRow struct {
+	logRow
+	ConditionID      string `json:"condition_id"`
+	Oracle           string `json:"oracle"`
+	QuestionID       string `json:"question_id"`
+	OutcomeSlotCount uint32 `json:"outcome_slot_count"`
+}
+
+type conditionResolutionRow struct {
+	logRow
+	ConditionID      string   `json:"condition_id"`
+	PayoutNumerators []string `json:"payout_numerators"`
+}
+
+func (b *Batch) StoreRawEvent(ctx context.Context, event models.Event) error { return nil }
+
+func (b *Batch) StoreOrderFilled(ctx context.Context, event models.Event) error {
+	order, err := payloadAs[models.OrderFilled](event)
+	if err != nil {
+		return err
+	}
+	b.add(tableOrderFills, b.orderFillRow(event, order, false))
+	return nil
+}
+
+func (b *Batch) orderFillRow(event models.Event, order models.OrderFilled, deleted bool) orderFillRow {
+	row := orderFillRow{
+		logRow:            b.logRow(event, deleted),
+		OrderHash:         order.OrderHash,
+		Maker:             models.NormalizeAddress(order.Maker),
+		Taker:             models.NormalizeAddress(order.Taker),
+		MakerAssetID:      uint256(order.MakerAssetID),
+		TakerAssetID:      uint256(order.TakerAssetID),
+		MakerAmountFilled: uint256(order.MakerAmountFilled),
+		TakerAmountFilled: uint256(order.TakerAmountFilled),
+		Fee:               uint256(order.Fee),
+		Side:              order.Side,
+		IsOperatorFill:    order.IsOperatorFill,
+	}
+	if order.Price != "" {
+		row.Price = &order.Price
+	}
+	return row
+}
+
+func (b *Batch) StoreTokenRegistered(ctx context.Context, event models.Event) error { return nil }
+
+func (b *Batch) StoreTokenTransfer(ctx context.Context, event models.Event) error {
+	rows, err := b.transferRows(event, events.TransferSingle, false)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		b.add(tableTokenTransfers, row)
+	}
+	return nil
+}
+
+func (b *Batch) StoreTokenTransferBatch(ctx context.Context, event models.Event) error {
+	rows, err := b.transferRows(event, events.TransferBatch, false)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		b.add(tableTokenTransfers, row)
+	}
+	return nil
+}
+
+// transferRows returns the token_transfers rows of a TransferSingle or
+// TransferBatch event, one per token numbered by its position in the batch.
+func (b *Batch) transferRows(event models.Event, eventType string, deleted bool) ([]tokenTransferRow, error) {
+	var operator, from, to, kind string
+	var tokenIDs, amounts []*big.Int
+	if eventType == events.TransferSingle {
+		transfer, err := payloadAs[models.TransferSingle](event)
+		if err != nil {
+			return nil, err
+		}
+		operator, from, to, kind = transfer.Operator, transfer.From, transfer.To, transfer.TransferKind
+		tokenIDs, amounts = []*big.Int{transfer.TokenID}, []*big.Int{transfer.Amount}
+	} else {
+		transfer, err := payloadAs[models.TransferBatch](event)
+		if err != nil {
+			return nil, err
+		}
+		operator, from, to, kind = transfer.Operator, transfer.From, transfer.To, transfer.TransferKind
+		tokenIDs, amounts = transfer.TokenIDs, transfer.Amounts
+	}
+	if len(tokenIDs) != len(amounts) {
+		return nil, fmt.Errorf("transfer batch has %d token ids and %d amounts", len(tokenIDs), len(amounts))
+	}
+	if kind == "" {
+		kind = models.ClassifyTransfer(from, to)
+	}
+
+	rows := make([]tokenTransferRow, len(tokenIDs))
+	for i := range tokenIDs {
+		rows[i] = tokenTransferRow{
+			logRow:       b.logRow(event, deleted),
+			BatchIndex:   i,
+			Operator:     models.NormalizeAddress(operator),
+			FromAddress:  models.NormalizeAddress(from),
+			ToAddress:    models.NormalizeAddress(to),
+			TokenID:      uint256(tokenIDs[i]),
+			Amount:       uint256(amounts[i]),
+			TransferKind: kind,
+		}
+	}
+	return rows, nil
+}
+
+func (b *Batch) StoreCollateralTransfer(ctx context.Context, event models.Event) error { return nil }
+
+func (b *Batch) StoreConditionPreparation(ctx context.Context, event models.Event) error {
+	condition, err := payloadAs[models.ConditionPreparation](event)
+	if err != nil {
+		return err
+	}
+	b.add(tableConditions, b.conditionRow(event, condition, false))
+	return nil
+}
+
+func (b *Batch) conditionRow(event models.Event, condition models.ConditionPreparation, deleted bool) conditionRow {
+	return conditionRow{
+		logRow:           b.logRow(event, deleted),
+		ConditionID:      models.NormalizeHash(condition.ConditionID),
+		Oracle:           models.NormalizeAddress(condition.Oracle),
+		QuestionID:       models.NormalizeHash(condition.QuestionID),
+		OutcomeSlotCount: condition.OutcomeSlotCount,
+	}
+}
+
+// StoreConditionResolution stores a resolution as a row of its own rather
+// than updating the condition, so it may arrive before the preparation.
+func (b *Batch) StoreConditionResolution(ctx context.Context, event models.Event) error {
+	resolution, err := payloadAs[models.ConditionResolution](event)
+	if err != nil {
+		return err
+	}
+	if err := models.ValidatePayouts(uint64(resolution.OutcomeSlotCount), resolution.PayoutNumerators); err != nil {
+		return fmt.Errorf("rejected resolution for condition %s: %w", resolution.ConditionID, err)
+	}
+	b.add(tableConditionResolutions, b.resolutionRow(event, resolution, false))
+	return nil
+}
+
+func (b *Batch) resolutionRow(event models.Event, resolution models.ConditionResolution, deleted bool) conditionResolutionRow {
+	numerators := make([]string, len(resolution.PayoutNumerators))
+	for i, n := range resolution.PayoutNumerators {
+		numerators[i] = uint256(n)
+	}
+	return conditionResolutionRow{
+		logRow:           b.logRow(event, deleted),
+		ConditionID:      models.NormalizeHash(resolution.ConditionID),
+		PayoutNumerators: numerators,
+	}
+}
+
+func (b *Batch) StorePositionSplit(ctx context.Context, event models.Event) error    { return nil }
+func (b *Batch) StorePositionsMerge(ctx context.Context, event models.Event) error   { return nil }
+func (b *Batch) StorePayoutRedemption(ctx context.Context, event models.Event) error { return nil }
+
+func (b *Batch) RecordPositionChanges(ctx context.Context, event models.Event) error { return nil }
+
+func (b *Batch) MarkProcessed(ctx context.Context, event models.Event) error { return nil }
+
+func (b *Batch) Quarantine(ctx context.Context, q store.Quarantined) error { return nil }
+
+// RevertEvent stores tombstones replacing the rows of a removed log. They
+// carry the removed row's columns, so they sort and partition with it.
+func (b *Batch) RevertEvent(ctx context.Context, eventType string, event models.Event) error {
+	switch eventType {
+	case events.OrderFilled:
+		order, err := payloadAs[models.OrderFilled](event)
+		if err != nil {
+			return err
+		}
+		b.add(tableOrderFills, b.orderFillRow(event, order, true))
+	case events.TransferSingle, events.TransferBatch:
+		rows, err := b.transferRows(event, eventType, true)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			b.add(tableTokenTransfers, row)
+		}
+	case events.ConditionPreparation:
+		condition, err := payloadAs[models.ConditionPreparation](event)
+		if err != nil {
+			return err
+		}
+		b.add(tableConditions, b.conditionRow(event, condition, true))
+	case events.ConditionResolution:
+		resolution, err := payloadAs[models.ConditionResolution](event)
+		if err != nil {
+			return err
+		}
+		b.add(tableConditionResolutions, b.resolutionRow(event, resolution, true))
+	}
+	return nil
+}
+
+// uint256 formats an amount for a UInt256 column, which JSONEachRow reads
+// from a string; a missing amount is stored as 0.
+func uint256(n *big.Int) string {
+	if n == nil {
+		return "0"
+	}
+	return n.String()
+}
+
+// payloadAs returns the payload of an event as T, re-decoding it when it
+// was decoded generically.
+func payloadAs[T any](event models.Event) (T, error) {
+	var payload T
+	switch p := event.Payload.(type) {
+	case T:
+		return p, nil
+	case *T:
+		if p != nil {
+			return *p, nil
+		}
+	case nil:
+	default:
+		data, err := json.Marshal(p)
+		if err != nil {
+			return payload, fmt.Errorf("failed to encode %T payload: %w", p, err)
+		}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return payload, fmt.Errorf("failed to decode %T payload: %w", payload, err)
+		}
+	}
+	return payload, nil
+}
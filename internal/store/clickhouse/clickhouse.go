@@ -0,0 +1,136 @@
+// Package clickhouse is a store.Store writing order fills, token transfers
+// and conditions to ClickHouse, for analytics over the full trade history.
+//
+// The consumer talks to ClickHouse over its HTTP interface: a Batch buffers
+// the rows of the events of a fetched batch, and Flush sends them with one
+// asynchronous insert per table, waiting for ClickHouse to write them so a
+// batch is acknowledged only once its rows are stored.
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultTimeout bounds a request to ClickHouse.
+const defaultTimeout = 30 * time.Second
+
+// Config is the [clickhouse] section of the consumer's configuration.
+type Config struct {
+	URL      string // HTTP interface, e.g. http://localhost:8123
+	Database string
+	Username string
+	Password string
+}
+
+// Client sends queries to the HTTP interface of a ClickHouse server.
+type Client struct {
+	cfg  Config
+	http *http.Client
+}
+
+// NewClient creates a client of the server at cfg.URL.
+func NewClient(cfg Config) (*Client, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clickhouse url %q: %w", cfg.URL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid clickhouse url %q: expected http(s)://host:port", cfg.URL)
+	}
+	if cfg.Database == "" {
+		cfg.Database = "default"
+	}
+	return &Client{cfg: cfg, http: &http.Client{Timeout: defaultTimeout}}, nil
+}
+
+// Ping checks that the server answers.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.cfg.URL, "/")+"/ping", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to ping clickhouse: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to ping clickhouse: %s", resp.Status)
+	}
+	return nil
+}
+
+// Migrate creates the tables that are missing.
+func (c *Client) Migrate(ctx context.Context) error {
+	for _, ddl := range schema {
+		if err := c.exec(ctx, ddl, nil, nil); err != nil {
+			return fmt.Errorf("failed to create clickhouse table: %w", err)
+		}
+	}
+	return nil
+}
+
+// insert writes rows to table as one asynchronous insert, returning once
+// ClickHouse has written them.
+func (c *Client) insert(ctx context.Context, table string, rows []any) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("failed to encode %s row: %w", table, err)
+		}
+	}
+
+	settings := url.Values{
+		"async_insert":          {"1"},
+		"wait_for_async_insert": {"1"},
+	}
+	query := fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", table)
+	if err := c.exec(ctx, query, settings, &body); err != nil {
+		return fmt.Errorf("failed to insert into %s: %w", table, err)
+	}
+	return nil
+}
+
+// exec sends a query, with the data of an INSERT as body.
+func (c *Client) exec(ctx context.Context, query string, settings url.Values, body io.Reader) error {
+	params := url.Values{"database": {c.cfg.Database}}
+	for k, v := range settings {
+		params[k] = v
+	}
+
+	// Without data the query itself is the body
+	if body == nil {
+		body = strings.NewReader(query)
+	} else {
+		params.Set("query", query)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.cfg.URL, "/")+"/?"+params.Encode(), body)
+	if err != nil {
+		return err
+	}
+	if c.cfg.Username != "" {
+		req.Header.Set("X-ClickHouse-User", c.cfg.Username)
+		req.Header.Set("X-ClickHouse-Key", c.cfg.Password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("clickhouse returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package clickhouse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// request is a request received by a fake ClickHouse server.
+type request struct {
+	params url.Values
+	header http.Header
+	body   string
+}
+
+// fakeServer records the requests sent to it.
+type fakeServer struct {
+	mu       sync.Mutex
+	requests []request
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, request{params: r.URL.Query(), header: r.Header, body: string(body)})
+}
+
+// testClient returns a client of a fake server.
+func testClient(t *testing.T, cfg Config) (*Client, *fakeServer) {
+	t.Helper()
+	f := &fakeServer{}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	cfg.URL = server.URL
+	client, err := NewClient(cfg)
+	require.NoError(t, err)
+	return client, f
+}
+
+// rows decodes the JSONEachRow body of an insert.
+func rows(t *testing.T, body string) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var row map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+		out = append(out, row)
+	}
+	return out
+}
+
+var (
+	testTxHash = "0x" + strings.Repeat("a1", 32)
+
+	testFill = models.OrderFilled{
+		OrderHash:         "0x" + strings.Repeat("0a", 32),
+		Maker:             "0x1111111111111111111111111111111111111111",
+		Taker:             "0x2222222222222222222222222222222222222222",
+		MakerAssetID:      big.NewInt(0),
+		TakerAssetID:      new(big.Int).Lsh(big.NewInt(1), 255),
+		MakerAmountFilled: big.NewInt(52_000_000),
+		TakerAmountFilled: big.NewInt(100_000_000),
+		Fee:               big.NewInt(0),
+		Side:              models.OrderSideBuy,
+		Price:             "0.52",
+	}
+
+	testBatch = models.TransferBatch{
+		Operator: "0x1111111111111111111111111111111111111111",
+		From:     "0x2222222222222222222222222222222222222222",
+		To:       "0x0000000000000000000000000000000000000000",
+		TokenIDs: []*big.Int{big.NewInt(12345), big.NewInt(67890)},
+		Amounts:  []*big.Int{big.NewInt(1), big.NewInt(2)},
+	}
+)
+
+func testEvent(name string, logIndex uint, payload any) models.Event {
+	return models.Event{
+		Block:     100,
+		Timestamp: 1_700_000_000,
+		TxHash:    testTxHash,
+		LogIndex:  logIndex,
+		EventName: name,
+		Success:   true,
+		Payload:   payload,
+	}
+}
+
+// TestNewClientRejectsInvalidURL tests that a client needs the URL of the
+// HTTP interface.
+func TestNewClientRejectsInvalidURL(t *testing.T) {
+	_, err := NewClient(Config{URL: "localhost:8123"})
+	require.Error(t, err)
+}
+
+// TestMigrate tests that every table is created in the configured
+// database.
+func TestMigrate(t *testing.T) {
+	client, f := testClient(t, Config{Database: "polymarket"})
+	require.NoError(t, client.Migrate(context.Background()))
+
+	require.Len(t, f.requests, len(schema))
+	for i, r := range f.requests {
+		require.Equal(t, []string{"polymarket"}, r.params["database"])
+		require.Equal(t, schema[i], r.body)
+		require.Contains(t, r.body, "ReplacingMergeTree(version, is_deleted)")
+	}
+}
+
+// TestFlushInsertsPerTable tests that a flush sends one asynchronous insert
+// per table it has rows for, with the credentials, and empties the batch.
+func TestFlushInsertsPerTable(t *testing.T) {
+	client, f := testClient(t, Config{Username: "indexer", Password: "secret"})
+	ctx := context.Background()
+
+	batch := client.NewBatch()
+	require.NoError(t, store.StoreEvent(ctx, batch, events.OrderFilled, testEvent(events.OrderFilled, 0, testFill)))
+	require.NoError(t, store.StoreEvent(ctx, batch, events.TransferBatch, testEvent(events.TransferBatch, 1, testBatch)))
+	require.NoError(t, store.StoreEvent(ctx, batch, events.OrderCancelled, testEvent(events.OrderCancelled, 2, nil)))
+	require.Equal(t, 3, batch.Len())
+	require.NoError(t, batch.Flush(ctx))
+	require.Zero(t, batch.Len())
+
+	require.Len(t, f.requests, 2)
+	for _, r := range f.requests {
+		require.Equal(t, []string{"1"}, r.params["async_insert"])
+		require.Equal(t, []string{"1"}, r.params["wait_for_async_insert"])
+		require.Equal(t, "indexer", r.header.Get("X-ClickHouse-User"))
+		require.Equal(t, "secret", r.header.Get("X-ClickHouse-Key"))
+	}
+	require.Equal(t, []string{"INSERT INTO order_fills FORMAT JSONEachRow"}, f.requests[0].params["query"])
+	require.Equal(t, []string{"INSERT INTO token_transfers FORMAT JSONEachRow"}, f.requests[1].params["query"])
+
+	fills := rows(t, f.requests[0].body)
+	require.Len(t, fills, 1)
+	require.Equal(t, testFill.TakerAssetID.String(), fills[0]["taker_asset_id"], "UInt256 sent as a string")
+	require.Equal(t, "0.52", fills[0]["price"])
+	require.Equal(t, float64(1_700_000_000), fills[0]["block_timestamp"])
+	require.Equal(t, float64(0), fills[0]["is_deleted"])
+
+	transfers := rows(t, f.requests[1].body)
+	require.Len(t, transfers, 2)
+	for i, row := range transfers {
+		require.Equal(t, float64(i), row["batch_index"])
+		require.Equal(t, models.TransferKindBurn, row["transfer_kind"], "classified when the payload has no kind")
+	}
+	require.Equal(t, "67890", transfers[1]["token_id"])
+
+	require.NoError(t, batch.Flush(ctx))
+	require.Len(t, f.requests, 2, "nothing to insert")
+}
+
+// TestRevertEventStoresTombstones tests that a removed log is replaced by
+// tombstones with the keys, partition and a higher version of its rows.
+func TestRevertEventStoresTombstones(t *testing.T) {
+	client, _ := testClient(t, Config{})
+	ctx := context.Background()
+	batch := client.NewBatch()
+
+	stored := testEvent(events.TransferBatch, 1, testBatch)
+	removed := stored
+	removed.Success = false
+	require.NoError(t, store.StoreEvent(ctx, batch, events.TransferBatch, stored))
+	require.NoError(t, store.StoreEvent(ctx, batch, events.TransferBatch, removed))
+
+	transfers := batch.rows[tableTokenTransfers]
+	require.Len(t, transfers, 4)
+	for i := range 2 {
+		row, tombstone := transfers[i].(tokenTransferRow), transfers[i+2].(tokenTransferRow)
+		require.Equal(t, uint8(0), row.IsDeleted)
+		require.Equal(t, uint8(1), tombstone.IsDeleted)
+		require.Equal(t, row.BatchIndex, tombstone.BatchIndex)
+		require.Equal(t, row.BlockTimestamp, tombstone.BlockTimestamp)
+		require.Greater(t, tombstone.Version, row.Version)
+	}
+
+	// Events without ClickHouse rows have nothing to revert
+	cancelled := testEvent(events.OrderCancelled, 2, nil)
+	cancelled.Success = false
+	require.NoError(t, store.StoreEvent(ctx, batch, events.OrderCancelled, cancelled))
+	require.Equal(t, 4, batch.Len())
+}
+
+// TestStoreConditionResolutionRejectsInvalidPayouts tests that payouts
+// downstream calculations cannot use are not stored.
+func TestStoreConditionResolutionRejectsInvalidPayouts(t *testing.T) {
+	client, _ := testClient(t, Config{})
+	batch := client.NewBatch()
+	resolution := models.ConditionResolution{
+		ConditionID:      "0x" + strings.Repeat("0d", 32),
+		OutcomeSlotCount: 2,
+		PayoutNumerators: []*big.Int{big.NewInt(0), big.NewInt(0)},
+	}
+	err := batch.StoreConditionResolution(context.Background(), testEvent(events.ConditionResolution, 0, resolution))
+	require.Error(t, err)
+	require.Zero(t, batch.Len())
+}
+
+// TestWithTxDropsFailedRows tests that the rows buffered by a failed
+// transaction are not flushed, and those of earlier ones are.
+func TestWithTxDropsFailedRows(t *testing.T) {
+	client, _ := testClient(t, Config{})
+	ctx := context.Background()
+	batch := client.NewBatch()
+
+	require.NoError(t, store.StoreEvent(ctx, batch, events.OrderFilled, testEvent(events.OrderFilled, 0, testFill)))
+	err := batch.WithTx(ctx, func(tx store.Store) error {
+		require.NoError(t, tx.StoreTokenTransferBatch(ctx, testEvent(events.TransferBatch, 1, testBatch)))
+		return errors.New("failed")
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, batch.Len())
+	require.Len(t, batch.rows[tableOrderFills], 1)
+	require.Empty(t, batch.rows[tableTokenTransfers])
+}
+
+// TestFlushFailure tests that a failed insert returns the server's error
+// and keeps the rows for the next flush.
+func TestFlushFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Code: 60. DB::Exception: Table default.order_fills does not exist", http.StatusNotFound)
+	}))
+	defer server.Close()
+	client, err := NewClient(Config{URL: server.URL})
+	require.NoError(t, err)
+
+	batch := client.NewBatch()
+	require.NoError(t, batch.StoreOrderFilled(context.Background(), testEvent(events.OrderFilled, 0, testFill)))
+	err = batch.Flush(context.Background())
+	require.ErrorContains(t, err, "order_fills does not exist")
+	require.Equal(t, 1, batch.Len())
+}
+
+// TestAgainstClickHouse tests that redelivered rows collapse to one and
+// reverted rows disappear on the ClickHouse server in CLICKHOUSE_TEST_URL,
+// in a database created for the test.
+func TestAgainstClickHouse(t *testing.T) {
+	serverURL := os.Getenv("CLICKHOUSE_TEST_URL")
+	if serverURL == "" {
+		t.Skip("CLICKHOUSE_TEST_URL not set")
+	}
+	ctx := context.Background()
+	name := fmt.Sprintf("clickhouse_test_%d", time.Now().UnixNano())
+
+	admin, err := NewClient(Config{URL: serverURL})
+	require.NoError(t, err)
+	require.NoError(t, admin.Ping(ctx))
+	require.NoError(t, admin.exec(ctx, "CREATE DATABASE "+name, nil, nil))
+	t.Cleanup(func() { admin.exec(context.Background(), "DROP DATABASE IF EXISTS "+name, nil, nil) })
+
+	client, err := NewClient(Config{URL: serverURL, Database: name})
+	require.NoError(t, err)
+	require.NoError(t, client.Migrate(ctx))
+	require.NoError(t, client.Migrate(ctx), "migrations are idempotent")
+
+	fill := testEvent(events.OrderFilled, 0, testFill)
+	transfer := testEvent(events.TransferBatch, 1, testBatch)
+	removed := transfer
+	removed.Success = false
+
+	// The same events delivered twice, in two inserts
+	for range 2 {
+		batch := client.NewBatch()
+		require.NoError(t, store.StoreEvent(ctx, batch, events.OrderFilled, fill))
+		require.NoError(t, store.StoreEvent(ctx, batch, events.TransferBatch, transfer))
+		require.NoError(t, batch.Flush(ctx))
+	}
+	require.Equal(t, "1", query(t, client, "SELECT count() FROM order_fills FINAL"))
+	require.Equal(t, "2", query(t, client, "SELECT count() FROM token_transfers FINAL"))
+	require.Equal(t, testFill.TakerAssetID.String(), query(t, client, "SELECT toString(taker_asset_id) FROM order_fills FINAL"))
+
+	batch := client.NewBatch()
+	require.NoError(t, store.StoreEvent(ctx, batch, events.TransferBatch, removed))
+	require.NoError(t, batch.Flush(ctx))
+	require.Equal(t, "0", query(t, client, "SELECT count() FROM token_transfers FINAL"))
+}
+
+// query returns the single value a query selects.
+func query(t *testing.T, c *Client, q string) string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(c.cfg.URL, "/")+"/?database="+c.cfg.Database, strings.NewReader(q))
+	require.NoError(t, err)
+	resp, err := c.http.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	return strings.TrimSpace(string(body))
+}
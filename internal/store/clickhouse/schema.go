@@ -0,0 +1,86 @@
+package clickhouse
+
+// schema creates the ClickHouse tables mirroring order_fills, token_transfers
+// and conditions of the Postgres schema (internal/store/migrations).
+//
+// ClickHouse has no ON CONFLICT and no UPDATE on the insert path, so:
+//   - Redeliveries are deduplicated by ReplacingMergeTree on each table's
+//     log key: rows with the same key collapse to the highest version when
+//     parts merge. Queries needing exact counts before a merge use FINAL.
+//   - Reorged logs are removed by inserting a tombstone (is_deleted = 1)
+//     with a higher version, which FINAL and merges drop with the row.
+//   - The Postgres UPDATE of a condition on its resolution becomes a row of
+//     condition_resolutions, joined to conditions at query time; a
+//     resolution arriving before its preparation needs no placeholder row.
+//
+// Every table is partitioned by month of block_timestamp, which tombstones
+// carry, so a tombstone lands in the partition of the row it replaces.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS order_fills (
+		block_number UInt64,
+		block_timestamp DateTime('UTC'),
+		transaction_hash String,
+		log_index UInt32,
+		order_hash String,
+		maker String,
+		taker String,
+		maker_asset_id UInt256,
+		taker_asset_id UInt256,
+		maker_amount_filled UInt256,
+		taker_amount_filled UInt256,
+		fee UInt256,
+		side String,
+		price Nullable(Decimal(20, 6)),
+		is_operator_fill Bool,
+		version UInt64,
+		is_deleted UInt8
+	) ENGINE = ReplacingMergeTree(version, is_deleted)
+	PARTITION BY toYYYYMM(block_timestamp)
+	ORDER BY (transaction_hash, log_index)`,
+
+	`CREATE TABLE IF NOT EXISTS token_transfers (
+		block_number UInt64,
+		block_timestamp DateTime('UTC'),
+		transaction_hash String,
+		log_index UInt32,
+		batch_index UInt32,
+		operator String,
+		from_address String,
+		to_address String,
+		token_id UInt256,
+		amount UInt256,
+		transfer_kind String,
+		version UInt64,
+		is_deleted UInt8
+	) ENGINE = ReplacingMergeTree(version, is_deleted)
+	PARTITION BY toYYYYMM(block_timestamp)
+	ORDER BY (transaction_hash, log_index, batch_index)`,
+
+	`CREATE TABLE IF NOT EXISTS conditions (
+		condition_id String,
+		oracle String,
+		question_id String,
+		outcome_slot_count UInt32,
+		block_number UInt64,
+		block_timestamp DateTime('UTC'),
+		transaction_hash String,
+		log_index UInt32,
+		version UInt64,
+		is_deleted UInt8
+	) ENGINE = ReplacingMergeTree(version, is_deleted)
+	PARTITION BY toYYYYMM(block_timestamp)
+	ORDER BY condition_id`,
+
+	`CREATE TABLE IF NOT EXISTS condition_resolutions (
+		condition_id String,
+		payout_numerators Array(UInt256),
+		block_number UInt64,
+		block_timestamp DateTime('UTC'),
+		transaction_hash String,
+		log_index UInt32,
+		version UInt64,
+		is_deleted UInt8
+	) ENGINE = ReplacingMergeTree(version, is_deleted)
+	PARTITION BY toYYYYMM(block_timestamp)
+	ORDER BY condition_id`,
+}
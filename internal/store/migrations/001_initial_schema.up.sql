@@ -0,0 +1,377 @@
+-- Polymarket Indexer - Initial Database Schema
+-- TimescaleDB schema for the tables cmd/consumer writes. Column names and
+-- unique constraints follow the consumer's INSERT statements; every
+-- ON CONFLICT target has a matching unique constraint below.
+--
+-- Hypertables require the partitioning column in every unique index, so
+-- the high-volume tables (events, order_fills, token_transfers) are unique
+-- on (transaction_hash, log_index[, token_id], block_timestamp). A log's
+-- block timestamp is fixed by its block, so this deduplicates redelivered
+-- messages as well. The other tables are plain tables unique on
+-- (transaction_hash, log_index).
+
+CREATE EXTENSION IF NOT EXISTS timescaledb CASCADE;
+
+-- =============================================================================
+-- EVENTS TABLE (Primary hypertable for all blockchain events)
+-- =============================================================================
+
+CREATE TABLE events (
+    block_number BIGINT NOT NULL,
+    block_hash TEXT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    contract_address TEXT NOT NULL,
+    event_signature TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT events_log_unique UNIQUE (transaction_hash, log_index, block_timestamp)
+);
+
+SELECT create_hypertable('events', 'block_timestamp',
+    chunk_time_interval => INTERVAL '1 day',
+    if_not_exists => TRUE
+);
+
+CREATE INDEX idx_events_block_number ON events (block_number DESC);
+CREATE INDEX idx_events_contract ON events (contract_address, block_timestamp DESC);
+CREATE INDEX idx_events_signature ON events (event_signature, block_timestamp DESC);
+CREATE INDEX idx_events_payload ON events USING GIN (payload);
+
+-- =============================================================================
+-- CTF EXCHANGE TABLES
+-- =============================================================================
+
+-- Order filled events (trades)
+-- side:             buy, sell or unknown from the maker's perspective
+-- price:            collateral per outcome token (NULL when undefined)
+-- is_operator_fill: taker is the exchange itself (one leg of an internal match)
+CREATE TABLE order_fills (
+    block_number BIGINT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    order_hash TEXT NOT NULL,
+    maker TEXT NOT NULL,
+    taker TEXT NOT NULL,
+    maker_asset_id NUMERIC(78, 0) NOT NULL,
+    taker_asset_id NUMERIC(78, 0) NOT NULL,
+    maker_amount_filled NUMERIC(78, 0) NOT NULL,
+    taker_amount_filled NUMERIC(78, 0) NOT NULL,
+    fee NUMERIC(78, 0) NOT NULL,
+    side TEXT,
+    price NUMERIC(20, 6),
+    is_operator_fill BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT order_fills_log_unique UNIQUE (transaction_hash, log_index, block_timestamp)
+);
+
+SELECT create_hypertable('order_fills', 'block_timestamp',
+    chunk_time_interval => INTERVAL '1 day',
+    if_not_exists => TRUE
+);
+
+CREATE INDEX idx_order_fills_maker ON order_fills (maker, block_timestamp DESC);
+CREATE INDEX idx_order_fills_taker ON order_fills (taker, block_timestamp DESC);
+CREATE INDEX idx_order_fills_order_hash ON order_fills (order_hash);
+CREATE INDEX idx_order_fills_assets ON order_fills (maker_asset_id, taker_asset_id);
+CREATE INDEX idx_order_fills_side ON order_fills (side, block_timestamp DESC)
+    WHERE NOT is_operator_fill;
+
+-- Token registrations (new markets)
+CREATE TABLE token_registrations (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    token0 NUMERIC(78, 0) NOT NULL,
+    token1 NUMERIC(78, 0) NOT NULL,
+    condition_id TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT token_registrations_log_unique UNIQUE (transaction_hash, log_index)
+);
+
+CREATE INDEX idx_token_registrations_condition ON token_registrations (condition_id);
+
+-- Outcome token lookup
+-- One row per outcome token registered on the exchange, derived from
+-- TokenRegistered: its complement token and the condition it belongs to.
+--
+-- outcome_index is the 0-based outcome slot the token pays out on. It is
+-- computed locally from the CTF positionId math (pkg/ctfmath) and is NULL
+-- when it cannot be derived, e.g. when the consumer has no collateral token
+-- configured or the token is not a root-level position of a binary condition.
+CREATE TABLE tokens (
+    token_id NUMERIC(78, 0) PRIMARY KEY,
+    complement_token_id NUMERIC(78, 0) NOT NULL,
+    condition_id TEXT NOT NULL,
+    outcome_index INTEGER,
+    block_number BIGINT NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_tokens_condition ON tokens (condition_id);
+CREATE INDEX idx_tokens_log ON tokens (transaction_hash, log_index);
+
+-- =============================================================================
+-- CONDITIONAL TOKENS TABLES
+-- =============================================================================
+
+-- ERC1155 transfers, one row per token of a TransferBatch
+-- transfer_kind: mint (from the zero address, position split), burn (to the
+-- zero address, merge or redemption) or transfer (wallet to wallet).
+-- Balance queries should exclude the zero address; it is never a holder.
+CREATE TABLE token_transfers (
+    block_number BIGINT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    operator TEXT NOT NULL,
+    from_address TEXT NOT NULL,
+    to_address TEXT NOT NULL,
+    token_id NUMERIC(78, 0) NOT NULL,
+    amount NUMERIC(78, 0) NOT NULL,
+    transfer_kind TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT token_transfers_log_unique UNIQUE (transaction_hash, log_index, token_id, block_timestamp)
+);
+
+SELECT create_hypertable('token_transfers', 'block_timestamp',
+    chunk_time_interval => INTERVAL '1 day',
+    if_not_exists => TRUE
+);
+
+CREATE INDEX idx_token_transfers_from ON token_transfers (from_address, block_timestamp DESC);
+CREATE INDEX idx_token_transfers_to ON token_transfers (to_address, block_timestamp DESC);
+CREATE INDEX idx_token_transfers_token_id ON token_transfers (token_id, block_timestamp DESC);
+CREATE INDEX idx_token_transfers_kind ON token_transfers (transfer_kind, block_timestamp DESC);
+
+-- Condition preparations (market creation) and their resolutions
+-- condition_id and question_id are 0x-prefixed, lowercase, 64 hex characters.
+CREATE TABLE conditions (
+    condition_id TEXT PRIMARY KEY,
+    oracle TEXT NOT NULL,
+    question_id TEXT NOT NULL,
+    outcome_slot_count INTEGER NOT NULL,
+    block_number BIGINT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    resolved BOOLEAN NOT NULL DEFAULT FALSE,
+    payout_numerators NUMERIC(78, 0)[],
+    resolution_block BIGINT,
+    resolution_timestamp TIMESTAMPTZ,
+    resolution_tx TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_conditions_oracle ON conditions (oracle);
+CREATE INDEX idx_conditions_question_id ON conditions (question_id);
+CREATE INDEX idx_conditions_block_timestamp ON conditions (block_timestamp DESC);
+
+-- Position splits and merges
+-- parent_collection_id is a canonical bytes32; root collections (split
+-- directly from collateral) are flagged with is_root_collection.
+CREATE TABLE position_splits (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    stakeholder TEXT NOT NULL,
+    collateral_token TEXT NOT NULL,
+    parent_collection_id TEXT NOT NULL,
+    condition_id TEXT NOT NULL,
+    partition NUMERIC(78, 0)[] NOT NULL,
+    amount NUMERIC(78, 0) NOT NULL,
+    is_root_collection BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT position_splits_log_unique UNIQUE (transaction_hash, log_index)
+);
+
+CREATE INDEX idx_position_splits_stakeholder ON position_splits (stakeholder, block_timestamp DESC);
+CREATE INDEX idx_position_splits_condition ON position_splits (condition_id);
+
+CREATE TABLE position_merges (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    stakeholder TEXT NOT NULL,
+    collateral_token TEXT NOT NULL,
+    parent_collection_id TEXT NOT NULL,
+    condition_id TEXT NOT NULL,
+    partition NUMERIC(78, 0)[] NOT NULL,
+    amount NUMERIC(78, 0) NOT NULL,
+    is_root_collection BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT position_merges_log_unique UNIQUE (transaction_hash, log_index)
+);
+
+CREATE INDEX idx_position_merges_stakeholder ON position_merges (stakeholder, block_timestamp DESC);
+CREATE INDEX idx_position_merges_condition ON position_merges (condition_id);
+
+-- =============================================================================
+-- COLLATERAL TABLES
+-- =============================================================================
+
+-- Collateral (USDC) transfers
+-- ERC20 Transfer events of chains.json contracts.collateralToken where the
+-- sender or recipient is a monitored contract. Used to reconcile market
+-- volume with the USDC actually moving into and out of the exchange and CTF.
+CREATE TABLE collateral_transfers (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    token TEXT NOT NULL,
+    from_address TEXT NOT NULL,
+    to_address TEXT NOT NULL,
+    amount NUMERIC(78, 0) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT collateral_transfers_log_unique UNIQUE (transaction_hash, log_index)
+);
+
+CREATE INDEX idx_collateral_transfers_from ON collateral_transfers (from_address, block_timestamp DESC);
+CREATE INDEX idx_collateral_transfers_to ON collateral_transfers (to_address, block_timestamp DESC);
+
+-- =============================================================================
+-- CONTINUOUS AGGREGATES (Materialized views for analytics)
+-- =============================================================================
+
+-- Hourly trading volume per market
+CREATE MATERIALIZED VIEW trading_volume_hourly
+WITH (timescaledb.continuous) AS
+SELECT
+    time_bucket('1 hour', block_timestamp) AS hour,
+    maker_asset_id,
+    taker_asset_id,
+    COUNT(*) AS trade_count,
+    SUM(maker_amount_filled) AS maker_volume,
+    SUM(taker_amount_filled) AS taker_volume,
+    SUM(fee) AS total_fees
+FROM order_fills
+GROUP BY hour, maker_asset_id, taker_asset_id
+WITH NO DATA;
+
+-- Refresh policy: update every hour, cover last 2 days
+SELECT add_continuous_aggregate_policy('trading_volume_hourly',
+    start_offset => INTERVAL '2 days',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+-- Daily active users (traders)
+CREATE MATERIALIZED VIEW active_traders_daily
+WITH (timescaledb.continuous) AS
+SELECT
+    time_bucket('1 day', block_timestamp) AS day,
+    COUNT(DISTINCT maker) AS unique_makers,
+    COUNT(DISTINCT taker) AS unique_takers,
+    COUNT(DISTINCT maker) + COUNT(DISTINCT taker) AS unique_traders,
+    COUNT(*) AS total_trades
+FROM order_fills
+GROUP BY day
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('active_traders_daily',
+    start_offset => INTERVAL '7 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 day',
+    if_not_exists => TRUE
+);
+
+-- =============================================================================
+-- HELPER FUNCTIONS
+-- =============================================================================
+
+-- Recent order fills for a market
+CREATE OR REPLACE FUNCTION get_recent_fills(
+    p_maker_asset NUMERIC,
+    p_taker_asset NUMERIC,
+    p_hours INTEGER DEFAULT 24
+)
+RETURNS TABLE (
+    block_timestamp TIMESTAMPTZ,
+    maker TEXT,
+    taker TEXT,
+    maker_amount NUMERIC,
+    taker_amount NUMERIC,
+    price NUMERIC
+) AS $$
+BEGIN
+    RETURN QUERY
+    SELECT
+        f.block_timestamp,
+        f.maker,
+        f.taker,
+        f.maker_amount_filled,
+        f.taker_amount_filled,
+        CASE
+            WHEN f.maker_amount_filled > 0
+            THEN f.taker_amount_filled::NUMERIC / f.maker_amount_filled::NUMERIC
+            ELSE 0
+        END AS price
+    FROM order_fills f
+    WHERE f.maker_asset_id = p_maker_asset
+      AND f.taker_asset_id = p_taker_asset
+      AND f.block_timestamp > NOW() - (p_hours || ' hours')::INTERVAL
+    ORDER BY f.block_timestamp DESC;
+END;
+$$ LANGUAGE plpgsql;
+
+-- User trading stats
+CREATE OR REPLACE FUNCTION get_user_stats(
+    p_user_address TEXT,
+    p_days INTEGER DEFAULT 30
+)
+RETURNS TABLE (
+    total_trades BIGINT,
+    total_volume NUMERIC,
+    unique_markets BIGINT,
+    first_trade TIMESTAMPTZ,
+    last_trade TIMESTAMPTZ
+) AS $$
+BEGIN
+    RETURN QUERY
+    SELECT
+        COUNT(*)::BIGINT,
+        SUM(f.maker_amount_filled + f.taker_amount_filled),
+        COUNT(DISTINCT f.maker_asset_id || '-' || f.taker_asset_id)::BIGINT,
+        MIN(f.block_timestamp),
+        MAX(f.block_timestamp)
+    FROM order_fills f
+    WHERE (f.maker = p_user_address OR f.taker = p_user_address)
+      AND f.block_timestamp > NOW() - (p_days || ' days')::INTERVAL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- =============================================================================
+-- COMMENTS
+-- =============================================================================
+
+COMMENT ON TABLE events IS 'All blockchain events from Polymarket contracts';
+COMMENT ON TABLE order_fills IS 'CTF Exchange order fill events (trades)';
+COMMENT ON TABLE token_registrations IS 'New market token registrations';
+COMMENT ON TABLE tokens IS 'Outcome tokens with their complement and condition';
+COMMENT ON TABLE token_transfers IS 'Conditional token transfers (ERC-1155)';
+COMMENT ON TABLE conditions IS 'Market conditions (questions) and their resolutions';
+COMMENT ON TABLE position_splits IS 'Collateral or positions split into outcome positions';
+COMMENT ON TABLE position_merges IS 'Outcome positions merged back into collateral or a parent position';
+COMMENT ON TABLE collateral_transfers IS 'Collateral (USDC) transfers into and out of monitored contracts';
+
+COMMENT ON MATERIALIZED VIEW trading_volume_hourly IS 'Hourly trading volume aggregates per market';
+COMMENT ON MATERIALIZED VIEW active_traders_daily IS 'Daily active trader counts';
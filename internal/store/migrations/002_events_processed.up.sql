@@ -0,0 +1,11 @@
+-- Polymarket Indexer - Raw event processing flag
+-- processed is set in the transaction that writes an event's parsed rows
+-- (cmd/consumer markProcessed), so a raw event is never marked without
+-- them. Reconciliation finds events whose parsed rows are missing with
+-- WHERE NOT processed.
+
+ALTER TABLE events
+    ADD COLUMN IF NOT EXISTS processed BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_events_unprocessed ON events (block_timestamp DESC)
+    WHERE NOT processed;
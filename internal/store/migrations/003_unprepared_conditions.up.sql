@@ -0,0 +1,9 @@
+-- Polymarket Indexer - Conditions resolved before their preparation
+-- A ConditionResolution consumed before its ConditionPreparation creates
+-- the condition from the resolution's payload; the preparation's block and
+-- transaction stay NULL until the preparation is stored.
+
+ALTER TABLE conditions
+    ALTER COLUMN block_number DROP NOT NULL,
+    ALTER COLUMN block_timestamp DROP NOT NULL,
+    ALTER COLUMN transaction_hash DROP NOT NULL;
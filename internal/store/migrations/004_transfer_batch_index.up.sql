@@ -0,0 +1,14 @@
+-- Polymarket Indexer - Position of a transfer within its TransferBatch
+-- A TransferBatch log may move the same token twice, so token_id alone does
+-- not tell its rows apart. batch_index is the row's position in the batch's
+-- arrays (0 for TransferSingle) and joins the uniqueness key.
+
+ALTER TABLE token_transfers
+    ADD COLUMN IF NOT EXISTS batch_index INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE token_transfers
+    DROP CONSTRAINT token_transfers_log_unique;
+
+ALTER TABLE token_transfers
+    ADD CONSTRAINT token_transfers_log_unique
+    UNIQUE (transaction_hash, log_index, token_id, batch_index, block_timestamp);
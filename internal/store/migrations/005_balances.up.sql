@@ -0,0 +1,47 @@
+-- Polymarket Indexer - Per-wallet token balances
+-- balances is the sum of a wallet's conditional token transfers, maintained
+-- by the consumer in the statement that inserts or removes the transfers
+-- (cmd/consumer/balances.go), so it never drifts from token_transfers. The
+-- zero address (mints and burns) has no balance.
+
+CREATE TABLE balances (
+    wallet TEXT NOT NULL,
+    token_id NUMERIC(78, 0) NOT NULL,
+    balance NUMERIC(78, 0) NOT NULL,
+    last_block BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (wallet, token_id)
+);
+
+CREATE INDEX idx_balances_token_id ON balances (token_id);
+
+COMMENT ON TABLE balances IS 'Conditional token balances per wallet, derived from token_transfers';
+
+-- Recompute every balance from token_transfers, returning the number of
+-- balances. Writers wait on the table lock, so transfers committed while it
+-- runs are applied on top of the rebuilt balances.
+CREATE OR REPLACE FUNCTION rebuild_balances()
+RETURNS BIGINT AS $$
+DECLARE
+    rebuilt BIGINT;
+BEGIN
+    LOCK TABLE balances IN EXCLUSIVE MODE;
+    DELETE FROM balances;
+
+    INSERT INTO balances (wallet, token_id, balance, last_block)
+    SELECT wallet, token_id, SUM(delta), MAX(block_number)
+    FROM (
+        SELECT to_address AS wallet, token_id, amount AS delta, block_number FROM token_transfers
+        UNION ALL
+        SELECT from_address, token_id, -amount, block_number FROM token_transfers
+    ) deltas
+    WHERE wallet <> '0x0000000000000000000000000000000000000000'
+    GROUP BY wallet, token_id;
+
+    GET DIAGNOSTICS rebuilt = ROW_COUNT;
+    RETURN rebuilt;
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT rebuild_balances();
@@ -0,0 +1,60 @@
+-- Polymarket Indexer - Trades derived from order fills
+-- One row per OrderFilled that exchanges collateral (asset ID 0) for an
+-- outcome token, written by the consumer with its order_fills row
+-- (cmd/consumer/trades.go). Amounts are converted from 6-decimal base units:
+-- size is in shares, notional in collateral, price is collateral per share.
+--
+-- Every match emits a fill per maker order and one for the taker order,
+-- whose taker is the exchange itself (is_operator_fill). Volume queries
+-- should count only one of the two, e.g. WHERE NOT is_operator_fill.
+
+CREATE TABLE trades (
+    block_number BIGINT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    maker TEXT NOT NULL,
+    taker TEXT NOT NULL,
+    token_id NUMERIC(78, 0) NOT NULL,
+    side TEXT NOT NULL,
+    price NUMERIC(20, 6) NOT NULL,
+    size NUMERIC(78, 6) NOT NULL,
+    notional NUMERIC(78, 6) NOT NULL,
+    fee NUMERIC(78, 6) NOT NULL,
+    is_operator_fill BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT trades_log_unique UNIQUE (transaction_hash, log_index, block_timestamp)
+);
+
+SELECT create_hypertable('trades', 'block_timestamp',
+    chunk_time_interval => INTERVAL '1 day',
+    if_not_exists => TRUE
+);
+
+CREATE INDEX idx_trades_token ON trades (token_id, block_timestamp DESC);
+CREATE INDEX idx_trades_maker ON trades (maker, block_timestamp DESC);
+CREATE INDEX idx_trades_taker ON trades (taker, block_timestamp DESC);
+
+COMMENT ON TABLE trades IS 'Collateral for outcome token fills with price, size and side';
+
+-- Backfill from the fills stored before this migration
+INSERT INTO trades (
+    block_number, block_timestamp, transaction_hash, log_index, maker, taker,
+    token_id, side, price, size, notional, fee, is_operator_fill
+)
+SELECT
+    block_number, block_timestamp, transaction_hash, log_index, maker, taker,
+    CASE WHEN maker_asset_id = 0 THEN taker_asset_id ELSE maker_asset_id END,
+    CASE WHEN maker_asset_id = 0 THEN 'buy' ELSE 'sell' END,
+    ROUND(
+        CASE WHEN maker_asset_id = 0 THEN maker_amount_filled / taker_amount_filled
+             ELSE taker_amount_filled / maker_amount_filled END, 6),
+    CASE WHEN maker_asset_id = 0 THEN taker_amount_filled ELSE maker_amount_filled END / 1000000,
+    CASE WHEN maker_asset_id = 0 THEN maker_amount_filled ELSE taker_amount_filled END / 1000000,
+    fee / 1000000,
+    is_operator_fill
+FROM order_fills
+WHERE (maker_asset_id = 0) <> (taker_asset_id = 0)
+  AND CASE WHEN maker_asset_id = 0 THEN taker_amount_filled ELSE maker_amount_filled END > 0
+ON CONFLICT DO NOTHING;
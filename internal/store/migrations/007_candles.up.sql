@@ -0,0 +1,71 @@
+-- Polymarket Indexer - OHLCV candles per outcome token
+-- The consumer updates candles with every trade it inserts
+-- (cmd/consumer/candles.go), one row per token, bucket width
+-- (consumer.candle_intervals) and bucket start. Trades may arrive in any
+-- order: open and close are the trades first and last by (block, log
+-- index), tracked in open_block/open_log_index and close_block/close_log_index.
+-- Operator fills are skipped, so each match is counted once.
+
+CREATE TABLE candles (
+    token_id NUMERIC(78, 0) NOT NULL,
+    interval_seconds INTEGER NOT NULL,
+    bucket TIMESTAMPTZ NOT NULL,
+    open NUMERIC(20, 6) NOT NULL,
+    high NUMERIC(20, 6) NOT NULL,
+    low NUMERIC(20, 6) NOT NULL,
+    close NUMERIC(20, 6) NOT NULL,
+    volume NUMERIC(78, 6) NOT NULL,
+    notional NUMERIC(78, 6) NOT NULL,
+    trades INTEGER NOT NULL,
+    open_block BIGINT NOT NULL,
+    open_log_index INTEGER NOT NULL,
+    close_block BIGINT NOT NULL,
+    close_log_index INTEGER NOT NULL,
+
+    PRIMARY KEY (token_id, interval_seconds, bucket)
+);
+
+CREATE INDEX idx_candles_bucket ON candles (interval_seconds, bucket DESC);
+
+COMMENT ON TABLE candles IS 'OHLCV candles per outcome token, derived from trades';
+
+-- Recompute every candle of a bucket width from trades, returning the
+-- number of candles. Used to add a width to consumer.candle_intervals.
+CREATE OR REPLACE FUNCTION rebuild_candles(p_interval_seconds INTEGER)
+RETURNS BIGINT AS $$
+DECLARE
+    rebuilt BIGINT;
+BEGIN
+    LOCK TABLE candles IN EXCLUSIVE MODE;
+    DELETE FROM candles WHERE interval_seconds = p_interval_seconds;
+
+    INSERT INTO candles (
+        token_id, interval_seconds, bucket, open, high, low, close, volume, notional, trades,
+        open_block, open_log_index, close_block, close_log_index
+    )
+    SELECT
+        token_id,
+        p_interval_seconds,
+        time_bucket(make_interval(secs => p_interval_seconds), block_timestamp) AS bucket,
+        (array_agg(price ORDER BY block_number, log_index))[1],
+        MAX(price),
+        MIN(price),
+        (array_agg(price ORDER BY block_number DESC, log_index DESC))[1],
+        SUM(size),
+        SUM(notional),
+        COUNT(*),
+        (array_agg(block_number ORDER BY block_number, log_index))[1],
+        (array_agg(log_index ORDER BY block_number, log_index))[1],
+        (array_agg(block_number ORDER BY block_number DESC, log_index DESC))[1],
+        (array_agg(log_index ORDER BY block_number DESC, log_index DESC))[1]
+    FROM trades
+    WHERE NOT is_operator_fill
+    GROUP BY token_id, bucket;
+
+    GET DIAGNOSTICS rebuilt = ROW_COUNT;
+    RETURN rebuilt;
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT rebuild_candles(60);
+SELECT rebuild_candles(3600);
@@ -0,0 +1,23 @@
+-- Polymarket Indexer - Market metadata from the Gamma API
+-- Written by the consumer's market enricher (cmd/consumer/markets.go) when
+-- gamma.enabled is set: one row per prepared condition once it has been
+-- looked up. Conditions prepared before their market is listed get a row
+-- with listed = false and are looked up again every gamma.resync_interval.
+
+CREATE TABLE markets (
+    condition_id TEXT PRIMARY KEY,
+    question_id TEXT,
+    title TEXT,
+    slug TEXT,
+    outcomes TEXT[],
+    category TEXT,
+    end_date TIMESTAMPTZ,
+    listed BOOLEAN NOT NULL DEFAULT FALSE,
+    checked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_markets_slug ON markets (slug);
+CREATE INDEX idx_markets_unlisted ON markets (checked_at) WHERE NOT listed;
+
+COMMENT ON TABLE markets IS 'Market titles, slugs and outcomes per condition from the Polymarket Gamma API';
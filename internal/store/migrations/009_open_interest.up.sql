@@ -0,0 +1,94 @@
+-- Polymarket Indexer - Payout redemptions and open interest per condition
+-- open_interest is the collateral locked in a condition: root splits add
+-- their amount, root merges and redemptions take out their amount and
+-- payout. The consumer applies each change in the statement that inserts or
+-- removes the event (cmd/consumer/open_interest.go). Splits and merges of
+-- nested positions move no collateral and are ignored.
+
+CREATE TABLE payout_redemptions (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    redeemer TEXT NOT NULL,
+    collateral_token TEXT NOT NULL,
+    parent_collection_id TEXT NOT NULL,
+    condition_id TEXT NOT NULL,
+    index_sets NUMERIC(78, 0)[] NOT NULL,
+    payout NUMERIC(78, 0) NOT NULL,
+    is_root_collection BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT payout_redemptions_log_unique UNIQUE (transaction_hash, log_index)
+);
+
+CREATE INDEX idx_payout_redemptions_redeemer ON payout_redemptions (redeemer, block_timestamp DESC);
+CREATE INDEX idx_payout_redemptions_condition ON payout_redemptions (condition_id);
+
+COMMENT ON TABLE payout_redemptions IS 'Positions of resolved conditions redeemed for their payout';
+
+CREATE TABLE open_interest (
+    condition_id TEXT PRIMARY KEY,
+    open_interest NUMERIC(78, 0) NOT NULL CHECK (open_interest >= 0),
+    last_block BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE open_interest IS 'Collateral locked per condition, derived from root splits, merges and redemptions';
+
+-- Add p_delta to the open interest of a condition, clamping it at zero.
+-- Returns by how much the result was clamped, zero when it was not: a
+-- positive value means events are missing or were stored out of order.
+CREATE OR REPLACE FUNCTION apply_open_interest(p_condition_id TEXT, p_delta NUMERIC, p_block BIGINT)
+RETURNS NUMERIC AS $$
+DECLARE
+    previous NUMERIC;
+BEGIN
+    INSERT INTO open_interest (condition_id, open_interest, last_block)
+    VALUES (p_condition_id, 0, p_block)
+    ON CONFLICT (condition_id) DO NOTHING;
+
+    SELECT open_interest INTO previous
+    FROM open_interest WHERE condition_id = p_condition_id
+    FOR UPDATE;
+
+    UPDATE open_interest SET
+        open_interest = GREATEST(previous + p_delta, 0),
+        last_block = GREATEST(last_block, p_block),
+        updated_at = NOW()
+    WHERE condition_id = p_condition_id;
+
+    RETURN GREATEST(-(previous + p_delta), 0);
+END;
+$$ LANGUAGE plpgsql;
+
+-- Recompute every open interest from the stored events, returning the
+-- number of conditions. A condition taking out more than was put in is
+-- rebuilt at zero. Writers wait on the table lock, so events committed
+-- while it runs are applied on top of the rebuilt values.
+CREATE OR REPLACE FUNCTION rebuild_open_interest()
+RETURNS BIGINT AS $$
+DECLARE
+    rebuilt BIGINT;
+BEGIN
+    LOCK TABLE open_interest IN EXCLUSIVE MODE;
+    DELETE FROM open_interest;
+
+    INSERT INTO open_interest (condition_id, open_interest, last_block)
+    SELECT condition_id, GREATEST(SUM(delta), 0), MAX(block_number)
+    FROM (
+        SELECT condition_id, amount AS delta, block_number FROM position_splits WHERE is_root_collection
+        UNION ALL
+        SELECT condition_id, -amount, block_number FROM position_merges WHERE is_root_collection
+        UNION ALL
+        SELECT condition_id, -payout, block_number FROM payout_redemptions WHERE is_root_collection
+    ) deltas
+    GROUP BY condition_id;
+
+    GET DIAGNOSTICS rebuilt = ROW_COUNT;
+    RETURN rebuilt;
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT rebuild_open_interest();
@@ -0,0 +1,358 @@
+-- Polymarket Indexer - Positions and realized PnL per wallet
+-- position_changes is the ledger of what each event did to the positions
+-- of the wallets involved, derived from the stored events by
+-- record_position_changes (called by the consumer, cmd/consumer/pnl.go):
+--
+--   buy, sell       trades, applied to the owner (maker) of the filled order
+--                   only: the taker order has a fill of its own, the
+--                   operator fill, so counterparties are never applied.
+--                   Fees are paid in the asset received.
+--   transfer_out,   token transfers between wallets. The shares leave the
+--   transfer_in     sender at its average cost and reach the receiver at
+--                   that cost. Transfers settled by an exchange (operator in
+--                   consumer.exchange_addresses) are covered by the fills.
+--   split           root splits buy each outcome of the partition at an
+--                   equal share of the collateral
+--   merge           root merges sell each outcome at that share
+--   redemption      redemptions sell the whole position of each redeemed
+--                   outcome at its payout; outcomes not redeemed are kept
+--
+-- Splits, merges and redemptions are mapped to outcome tokens through
+-- tokens.outcome_index, so they need the token registered and
+-- consumer.collateral_token set.
+--
+-- wallet_positions holds the quantity and cost basis per wallet and token
+-- (average cost method) and realized_pnl a row per sell, merge or
+-- redemption closing shares. Shares disposed beyond the tracked quantity
+-- (acquired before indexing started, or through untracked flows) are
+-- ignored. Changes are applied in ledger order; a change older than the
+-- last one applied to its position replays that position. Events stored
+-- before this migration are recorded by "migrate rebuild-pnl".
+
+CREATE TABLE position_changes (
+    wallet TEXT NOT NULL,
+    token_id NUMERIC(78, 0) NOT NULL,
+    block_number BIGINT NOT NULL,
+    log_index INTEGER NOT NULL,
+    seq INTEGER NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    source TEXT NOT NULL,
+    -- Shares, positive acquired and negative disposed; NULL disposes of the
+    -- whole position
+    quantity NUMERIC(78, 6),
+    -- Total cost of acquired shares
+    cost NUMERIC(78, 6),
+    -- Proceeds per disposed share; NULL disposes at cost
+    price NUMERIC,
+
+    PRIMARY KEY (transaction_hash, log_index, seq, wallet, token_id)
+);
+
+CREATE INDEX idx_position_changes_position ON position_changes (wallet, token_id, block_number, log_index, seq);
+
+COMMENT ON TABLE position_changes IS 'Position changes per wallet and token, derived from trades, transfers, splits, merges and redemptions';
+
+CREATE TABLE wallet_positions (
+    wallet TEXT NOT NULL,
+    token_id NUMERIC(78, 0) NOT NULL,
+    quantity NUMERIC(78, 6) NOT NULL,
+    cost_basis NUMERIC(78, 6) NOT NULL,
+    avg_price NUMERIC(78, 6) GENERATED ALWAYS AS (
+        CASE WHEN quantity > 0 THEN ROUND(cost_basis / quantity, 6) END
+    ) STORED,
+    realized_pnl NUMERIC(78, 6) NOT NULL,
+    last_block BIGINT NOT NULL,
+    last_log_index INTEGER NOT NULL,
+    last_seq INTEGER NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (wallet, token_id)
+);
+
+CREATE INDEX idx_wallet_positions_token_id ON wallet_positions (token_id);
+
+COMMENT ON TABLE wallet_positions IS 'Shares, average cost and realized PnL per wallet and token';
+
+CREATE TABLE realized_pnl (
+    wallet TEXT NOT NULL,
+    token_id NUMERIC(78, 0) NOT NULL,
+    block_number BIGINT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    seq INTEGER NOT NULL,
+    source TEXT NOT NULL,
+    quantity NUMERIC(78, 6) NOT NULL,
+    proceeds NUMERIC(78, 6) NOT NULL,
+    cost_basis NUMERIC(78, 6) NOT NULL,
+    pnl NUMERIC(78, 6) NOT NULL,
+
+    PRIMARY KEY (transaction_hash, log_index, seq, wallet, token_id)
+);
+
+CREATE INDEX idx_realized_pnl_wallet ON realized_pnl (wallet, block_timestamp DESC);
+CREATE INDEX idx_realized_pnl_position ON realized_pnl (wallet, token_id);
+
+COMMENT ON TABLE realized_pnl IS 'PnL realized by sells, merges and redemptions';
+
+-- Apply a ledger row to its position. Outside a replay, a row older than the
+-- last one applied to the position replays the position instead.
+CREATE OR REPLACE FUNCTION apply_position_change(c position_changes, p_replay BOOLEAN)
+RETURNS VOID AS $$
+DECLARE
+    pos wallet_positions;
+    acquired_cost NUMERIC;
+    disposed NUMERIC;
+    disposed_cost NUMERIC;
+    proceeds NUMERIC;
+BEGIN
+    SELECT * INTO pos FROM wallet_positions
+    WHERE wallet = c.wallet AND token_id = c.token_id
+    FOR UPDATE;
+
+    IF FOUND AND NOT p_replay
+       AND (c.block_number, c.log_index, c.seq) <= (pos.last_block, pos.last_log_index, pos.last_seq) THEN
+        PERFORM rebuild_wallet_position(c.wallet, c.token_id);
+        RETURN;
+    END IF;
+
+    IF NOT FOUND THEN
+        pos.quantity := 0;
+        pos.cost_basis := 0;
+        pos.realized_pnl := 0;
+    END IF;
+
+    IF c.quantity > 0 THEN
+        acquired_cost := c.cost;
+        IF c.source = 'transfer_in' THEN
+            -- Set by the sender's row, which may have been applied after c
+            -- was read
+            SELECT cost INTO acquired_cost FROM position_changes
+            WHERE transaction_hash = c.transaction_hash AND log_index = c.log_index
+              AND seq = c.seq AND wallet = c.wallet AND token_id = c.token_id;
+        END IF;
+        pos.quantity := pos.quantity + c.quantity;
+        pos.cost_basis := pos.cost_basis + COALESCE(acquired_cost, 0);
+    ELSE
+        disposed := LEAST(COALESCE(-c.quantity, pos.quantity), pos.quantity);
+        IF disposed >= pos.quantity THEN
+            disposed_cost := pos.cost_basis;
+        ELSE
+            disposed_cost := ROUND(pos.cost_basis * disposed / pos.quantity, 6);
+        END IF;
+        pos.quantity := pos.quantity - disposed;
+        pos.cost_basis := pos.cost_basis - disposed_cost;
+
+        IF c.source = 'transfer_out' THEN
+            -- The receiver's row follows the sender's; shares the sender did
+            -- not track reach it at no cost
+            UPDATE position_changes SET cost = disposed_cost
+            WHERE transaction_hash = c.transaction_hash AND log_index = c.log_index
+              AND seq = c.seq + 1 AND source = 'transfer_in';
+        ELSIF disposed > 0 THEN
+            proceeds := ROUND(disposed * c.price, 6);
+            pos.realized_pnl := pos.realized_pnl + proceeds - disposed_cost;
+            INSERT INTO realized_pnl (
+                wallet, token_id, block_number, block_timestamp, transaction_hash, log_index, seq,
+                source, quantity, proceeds, cost_basis, pnl
+            ) VALUES (
+                c.wallet, c.token_id, c.block_number, c.block_timestamp, c.transaction_hash, c.log_index, c.seq,
+                c.source, disposed, proceeds, disposed_cost, proceeds - disposed_cost
+            );
+        END IF;
+    END IF;
+
+    INSERT INTO wallet_positions (
+        wallet, token_id, quantity, cost_basis, realized_pnl, last_block, last_log_index, last_seq
+    ) VALUES (
+        c.wallet, c.token_id, pos.quantity, pos.cost_basis, pos.realized_pnl, c.block_number, c.log_index, c.seq
+    )
+    ON CONFLICT (wallet, token_id) DO UPDATE SET
+        quantity = EXCLUDED.quantity,
+        cost_basis = EXCLUDED.cost_basis,
+        realized_pnl = EXCLUDED.realized_pnl,
+        last_block = EXCLUDED.last_block,
+        last_log_index = EXCLUDED.last_log_index,
+        last_seq = EXCLUDED.last_seq,
+        updated_at = NOW();
+END;
+$$ LANGUAGE plpgsql;
+
+-- Recompute a position and its realized PnL from its ledger rows. Replaying
+-- a sender updates the cost of its transfers in the ledger, but not the
+-- positions of their receivers.
+CREATE OR REPLACE FUNCTION rebuild_wallet_position(p_wallet TEXT, p_token_id NUMERIC)
+RETURNS VOID AS $$
+DECLARE
+    c position_changes;
+BEGIN
+    DELETE FROM wallet_positions WHERE wallet = p_wallet AND token_id = p_token_id;
+    DELETE FROM realized_pnl WHERE wallet = p_wallet AND token_id = p_token_id;
+
+    FOR c IN
+        SELECT * FROM position_changes
+        WHERE wallet = p_wallet AND token_id = p_token_id
+        ORDER BY block_number, log_index, seq
+    LOOP
+        PERFORM apply_position_change(c, true);
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Derive the ledger rows of an event from the stored events and apply them,
+-- returning the number of rows. An event already in the ledger is skipped,
+-- so redelivered events are applied once. p_exchanges are the exchanges
+-- whose transfers are trade settlements.
+CREATE OR REPLACE FUNCTION record_position_changes(p_tx TEXT, p_log_index INTEGER, p_exchanges TEXT[])
+RETURNS INTEGER AS $$
+DECLARE
+    recorded INTEGER;
+    c position_changes;
+BEGIN
+    IF EXISTS (SELECT 1 FROM position_changes WHERE transaction_hash = p_tx AND log_index = p_log_index) THEN
+        RETURN 0;
+    END IF;
+
+    INSERT INTO position_changes (
+        wallet, token_id, block_number, log_index, seq, block_timestamp, transaction_hash,
+        source, quantity, cost, price
+    )
+    SELECT maker, token_id, block_number, log_index, 0, block_timestamp, transaction_hash,
+           side,
+           CASE WHEN side = 'buy' THEN size - fee ELSE -size END,
+           CASE WHEN side = 'buy' THEN notional END,
+           CASE WHEN side = 'sell' THEN (notional - fee) / NULLIF(size, 0) END
+    FROM trades
+    WHERE transaction_hash = p_tx AND log_index = p_log_index
+    UNION ALL
+    SELECT w.wallet, t.token_id, t.block_number, t.log_index, 2 * t.batch_index + w.received,
+           t.block_timestamp, t.transaction_hash,
+           CASE WHEN w.received = 0 THEN 'transfer_out' ELSE 'transfer_in' END,
+           CASE WHEN w.received = 0 THEN -t.amount ELSE t.amount END / 1000000,
+           NULL, NULL
+    FROM token_transfers t
+    CROSS JOIN LATERAL (VALUES (t.from_address, 0), (t.to_address, 1)) w (wallet, received)
+    WHERE t.transaction_hash = p_tx AND t.log_index = p_log_index
+      AND t.transfer_kind = 'transfer'
+      AND t.operator <> ALL (COALESCE(p_exchanges, '{}'))
+    UNION ALL
+    SELECT s.stakeholder, k.token_id, s.block_number, s.log_index, k.outcome_index,
+           s.block_timestamp, s.transaction_hash,
+           'split', s.amount / 1000000, s.amount / 1000000 / cardinality(s.partition), NULL
+    FROM position_splits s
+    JOIN tokens k ON k.condition_id = s.condition_id AND power(2::NUMERIC, k.outcome_index) = ANY (s.partition)
+    WHERE s.transaction_hash = p_tx AND s.log_index = p_log_index AND s.is_root_collection
+    UNION ALL
+    SELECT m.stakeholder, k.token_id, m.block_number, m.log_index, k.outcome_index,
+           m.block_timestamp, m.transaction_hash,
+           'merge', -m.amount / 1000000, NULL, 1::NUMERIC / cardinality(m.partition)
+    FROM position_merges m
+    JOIN tokens k ON k.condition_id = m.condition_id AND power(2::NUMERIC, k.outcome_index) = ANY (m.partition)
+    WHERE m.transaction_hash = p_tx AND m.log_index = p_log_index AND m.is_root_collection
+    UNION ALL
+    SELECT r.redeemer, k.token_id, r.block_number, r.log_index, k.outcome_index,
+           r.block_timestamp, r.transaction_hash,
+           'redemption', NULL, NULL,
+           cond.payout_numerators[k.outcome_index + 1] / (SELECT SUM(n) FROM unnest(cond.payout_numerators) n)
+    FROM payout_redemptions r
+    JOIN conditions cond ON cond.condition_id = r.condition_id AND cond.resolved
+    JOIN tokens k ON k.condition_id = r.condition_id AND power(2::NUMERIC, k.outcome_index) = ANY (r.index_sets)
+    WHERE r.transaction_hash = p_tx AND r.log_index = p_log_index AND r.is_root_collection;
+
+    GET DIAGNOSTICS recorded = ROW_COUNT;
+
+    FOR c IN
+        SELECT * FROM position_changes
+        WHERE transaction_hash = p_tx AND log_index = p_log_index
+        ORDER BY seq, wallet, token_id
+    LOOP
+        PERFORM apply_position_change(c, false);
+    END LOOP;
+
+    RETURN recorded;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Remove the ledger rows of an event and replay the positions they changed.
+CREATE OR REPLACE FUNCTION revert_position_changes(p_tx TEXT, p_log_index INTEGER)
+RETURNS VOID AS $$
+DECLARE
+    pair RECORD;
+BEGIN
+    FOR pair IN
+        WITH removed AS (
+            DELETE FROM position_changes
+            WHERE transaction_hash = p_tx AND log_index = p_log_index
+            RETURNING wallet, token_id
+        )
+        SELECT DISTINCT wallet, token_id FROM removed
+    LOOP
+        PERFORM rebuild_wallet_position(pair.wallet, pair.token_id);
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Replay every position of a wallet from the ledger, returning the number
+-- of positions that differed from the stored ones.
+CREATE OR REPLACE FUNCTION reconcile_wallet_positions(p_wallet TEXT)
+RETURNS INTEGER AS $$
+DECLARE
+    stored JSONB;
+    replayed JSONB;
+    mismatched INTEGER;
+BEGIN
+    SELECT COALESCE(jsonb_object_agg(token_id::TEXT, jsonb_build_array(quantity, cost_basis, realized_pnl)), '{}')
+    INTO stored
+    FROM wallet_positions WHERE wallet = p_wallet;
+
+    DELETE FROM wallet_positions WHERE wallet = p_wallet;
+    PERFORM rebuild_wallet_position(p_wallet, token_id)
+    FROM (SELECT DISTINCT token_id FROM position_changes WHERE wallet = p_wallet) held;
+
+    SELECT COALESCE(jsonb_object_agg(token_id::TEXT, jsonb_build_array(quantity, cost_basis, realized_pnl)), '{}')
+    INTO replayed
+    FROM wallet_positions WHERE wallet = p_wallet;
+
+    SELECT COUNT(*) INTO mismatched
+    FROM jsonb_each(stored) s
+    FULL JOIN jsonb_each(replayed) r ON r.key = s.key
+    WHERE s.value IS DISTINCT FROM r.value;
+
+    RETURN mismatched;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Rebuild the ledger, positions and realized PnL from every stored event,
+-- returning the number of ledger rows. Writers wait on the table locks.
+CREATE OR REPLACE FUNCTION rebuild_position_changes(p_exchanges TEXT[])
+RETURNS BIGINT AS $$
+DECLARE
+    stored RECORD;
+    rebuilt BIGINT := 0;
+BEGIN
+    LOCK TABLE position_changes, wallet_positions, realized_pnl IN EXCLUSIVE MODE;
+    DELETE FROM position_changes;
+    DELETE FROM wallet_positions;
+    DELETE FROM realized_pnl;
+
+    FOR stored IN
+        SELECT DISTINCT block_number, log_index, transaction_hash FROM (
+            SELECT block_number, log_index, transaction_hash FROM trades
+            UNION ALL
+            SELECT block_number, log_index, transaction_hash FROM token_transfers WHERE transfer_kind = 'transfer'
+            UNION ALL
+            SELECT block_number, log_index, transaction_hash FROM position_splits WHERE is_root_collection
+            UNION ALL
+            SELECT block_number, log_index, transaction_hash FROM position_merges WHERE is_root_collection
+            UNION ALL
+            SELECT block_number, log_index, transaction_hash FROM payout_redemptions WHERE is_root_collection
+        ) events
+        ORDER BY block_number, log_index
+    LOOP
+        rebuilt := rebuilt + record_position_changes(stored.transaction_hash, stored.log_index, p_exchanges);
+    END LOOP;
+
+    RETURN rebuilt;
+END;
+$$ LANGUAGE plpgsql;
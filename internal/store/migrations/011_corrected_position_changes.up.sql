@@ -0,0 +1,117 @@
+-- Polymarket Indexer - Ledger rows of corrected events
+-- The consumer upserts the parsed rows of an event, so an event published
+-- again with corrected values overwrites them. record_position_changes used
+-- to skip events already in the ledger; it now derives their rows again and,
+-- when they differ from the recorded ones, reverts and records them, so
+-- positions and realized PnL follow the correction. Redelivered events
+-- derive the same rows and are still applied once.
+
+-- Derive the ledger rows of an event from its stored rows (see
+-- migration 010 for the sources). p_exchanges are the exchanges whose
+-- transfers are trade settlements.
+CREATE OR REPLACE FUNCTION derive_position_changes(p_tx TEXT, p_log_index INTEGER, p_exchanges TEXT[])
+RETURNS SETOF position_changes AS $$
+    SELECT maker, token_id, block_number, log_index, 0, block_timestamp, transaction_hash,
+           side,
+           CASE WHEN side = 'buy' THEN size - fee ELSE -size END,
+           CASE WHEN side = 'buy' THEN notional END,
+           CASE WHEN side = 'sell' THEN (notional - fee) / NULLIF(size, 0) END
+    FROM trades
+    WHERE transaction_hash = p_tx AND log_index = p_log_index
+    UNION ALL
+    SELECT w.wallet, t.token_id, t.block_number, t.log_index, 2 * t.batch_index + w.received,
+           t.block_timestamp, t.transaction_hash,
+           CASE WHEN w.received = 0 THEN 'transfer_out' ELSE 'transfer_in' END,
+           CASE WHEN w.received = 0 THEN -t.amount ELSE t.amount END / 1000000,
+           NULL, NULL
+    FROM token_transfers t
+    CROSS JOIN LATERAL (VALUES (t.from_address, 0), (t.to_address, 1)) w (wallet, received)
+    WHERE t.transaction_hash = p_tx AND t.log_index = p_log_index
+      AND t.transfer_kind = 'transfer'
+      AND t.operator <> ALL (COALESCE(p_exchanges, '{}'))
+    UNION ALL
+    SELECT s.stakeholder, k.token_id, s.block_number, s.log_index, k.outcome_index,
+           s.block_timestamp, s.transaction_hash,
+           'split', s.amount / 1000000, s.amount / 1000000 / cardinality(s.partition), NULL
+    FROM position_splits s
+    JOIN tokens k ON k.condition_id = s.condition_id AND power(2::NUMERIC, k.outcome_index) = ANY (s.partition)
+    WHERE s.transaction_hash = p_tx AND s.log_index = p_log_index AND s.is_root_collection
+    UNION ALL
+    SELECT m.stakeholder, k.token_id, m.block_number, m.log_index, k.outcome_index,
+           m.block_timestamp, m.transaction_hash,
+           'merge', -m.amount / 1000000, NULL, 1::NUMERIC / cardinality(m.partition)
+    FROM position_merges m
+    JOIN tokens k ON k.condition_id = m.condition_id AND power(2::NUMERIC, k.outcome_index) = ANY (m.partition)
+    WHERE m.transaction_hash = p_tx AND m.log_index = p_log_index AND m.is_root_collection
+    UNION ALL
+    SELECT r.redeemer, k.token_id, r.block_number, r.log_index, k.outcome_index,
+           r.block_timestamp, r.transaction_hash,
+           'redemption', NULL, NULL,
+           cond.payout_numerators[k.outcome_index + 1] / (SELECT SUM(n) FROM unnest(cond.payout_numerators) n)
+    FROM payout_redemptions r
+    JOIN conditions cond ON cond.condition_id = r.condition_id AND cond.resolved
+    JOIN tokens k ON k.condition_id = r.condition_id AND power(2::NUMERIC, k.outcome_index) = ANY (r.index_sets)
+    WHERE r.transaction_hash = p_tx AND r.log_index = p_log_index AND r.is_root_collection;
+$$ LANGUAGE sql STABLE;
+
+-- Derive the ledger rows of an event from the stored events and apply them,
+-- returning the number of rows. An event already in the ledger with the
+-- same rows is skipped, so redelivered events are applied once; one whose
+-- rows changed is reverted first. The cost of a transfer_in row is set by
+-- its sender's row and not compared.
+CREATE OR REPLACE FUNCTION record_position_changes(p_tx TEXT, p_log_index INTEGER, p_exchanges TEXT[])
+RETURNS INTEGER AS $$
+DECLARE
+    recorded INTEGER;
+    changed BOOLEAN;
+    c position_changes;
+BEGIN
+    IF EXISTS (SELECT 1 FROM position_changes WHERE transaction_hash = p_tx AND log_index = p_log_index) THEN
+        WITH derived AS (
+            SELECT wallet, token_id, block_number, seq, block_timestamp, source,
+                   quantity::NUMERIC(78, 6) AS quantity,
+                   CASE WHEN source = 'transfer_in' THEN NULL ELSE cost::NUMERIC(78, 6) END AS cost,
+                   price
+            FROM derive_position_changes(p_tx, p_log_index, p_exchanges)
+        ),
+        recorded_rows AS (
+            SELECT wallet, token_id, block_number, seq, block_timestamp, source,
+                   quantity,
+                   CASE WHEN source = 'transfer_in' THEN NULL ELSE cost END AS cost,
+                   price
+            FROM position_changes
+            WHERE transaction_hash = p_tx AND log_index = p_log_index
+        )
+        SELECT EXISTS (
+            (SELECT * FROM derived EXCEPT ALL SELECT * FROM recorded_rows)
+            UNION ALL
+            (SELECT * FROM recorded_rows EXCEPT ALL SELECT * FROM derived)
+        ) INTO changed;
+
+        IF NOT changed THEN
+            RETURN 0;
+        END IF;
+        PERFORM revert_position_changes(p_tx, p_log_index);
+    END IF;
+
+    INSERT INTO position_changes (
+        wallet, token_id, block_number, log_index, seq, block_timestamp, transaction_hash,
+        source, quantity, cost, price
+    )
+    SELECT wallet, token_id, block_number, log_index, seq, block_timestamp, transaction_hash,
+           source, quantity, cost, price
+    FROM derive_position_changes(p_tx, p_log_index, p_exchanges);
+
+    GET DIAGNOSTICS recorded = ROW_COUNT;
+
+    FOR c IN
+        SELECT * FROM position_changes
+        WHERE transaction_hash = p_tx AND log_index = p_log_index
+        ORDER BY seq, wallet, token_id
+    LOOP
+        PERFORM apply_position_change(c, false);
+    END LOOP;
+
+    RETURN recorded;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,26 @@
+-- Polymarket Indexer - Quarantined events
+-- Events whose payload fails the consumer's validation (missing or malformed
+-- hashes, addresses or amounts, inconsistent batch arrays, unusable payouts;
+-- cmd/consumer/validate.go) are written here instead of their tables and
+-- acknowledged, so they are not redelivered. event is the message as
+-- published (re-encoded as JSON for binary codecs). A redelivered message is
+-- kept once, by its stream sequence.
+
+CREATE TABLE quarantined_events (
+    id BIGSERIAL PRIMARY KEY,
+    quarantined_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    subject TEXT NOT NULL,
+    stream_sequence BIGINT,
+    event_type TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    detail TEXT NOT NULL,
+    block_number BIGINT,
+    transaction_hash TEXT,
+    log_index INTEGER,
+    event JSONB NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_quarantined_events_sequence ON quarantined_events (stream_sequence);
+CREATE INDEX idx_quarantined_events_reason ON quarantined_events (reason, quarantined_at DESC);
+
+COMMENT ON TABLE quarantined_events IS 'Malformed events the consumer did not store, with the validation failure';
@@ -0,0 +1,21 @@
+-- Polymarket Indexer - Backfill progress
+-- The consumer's backfill mode (cmd/consumer -backfill) fills new derived
+-- tables from the stored raw events. Each page of events it replays
+-- records the last event here in the same transaction, so an interrupted
+-- backfill resumes after it. name is the sorted list of tables backfilled;
+-- delete its row to run a completed backfill again.
+
+CREATE TABLE backfill_progress (
+    name TEXT PRIMARY KEY,
+    event_types TEXT[] NOT NULL,
+    from_block BIGINT NOT NULL,
+    to_block BIGINT NOT NULL,
+    last_block BIGINT,
+    last_log_index INTEGER,
+    replayed BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+COMMENT ON TABLE backfill_progress IS 'Last event replayed by each consumer backfill, to resume it';
@@ -0,0 +1,32 @@
+-- Polymarket Indexer - Holders of resolved conditions
+-- Written by the consumer's holder snapshotter (cmd/consumer/holders.go):
+-- once a ConditionResolution is stored, the wallets holding either outcome
+-- token of the condition and their balances. Storing a resolution sets
+-- holders_snapshot_pending on its condition and the snapshot clears it, so a
+-- redelivered resolution is not snapshotted again; conditions resolved before
+-- this migration are not snapshotted.
+--
+-- snapshot_block is the latest block of the condition's token balances when
+-- the snapshot was taken, at least the resolution block. The snapshot runs
+-- right after the resolution is committed, so while consuming live blocks it
+-- is the resolution block or shortly after it.
+
+ALTER TABLE conditions ADD COLUMN holders_snapshot_pending BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_conditions_holders_snapshot_pending ON conditions (resolution_block)
+    WHERE holders_snapshot_pending;
+
+CREATE TABLE holder_snapshots (
+    condition_id TEXT NOT NULL,
+    token_id NUMERIC(78, 0) NOT NULL,
+    wallet TEXT NOT NULL,
+    balance NUMERIC(78, 0) NOT NULL,
+    snapshot_block BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (condition_id, token_id, wallet)
+);
+
+CREATE INDEX idx_holder_snapshots_wallet ON holder_snapshots (wallet);
+
+COMMENT ON TABLE holder_snapshots IS 'Outcome token holders of each condition when its resolution was stored';
@@ -0,0 +1,30 @@
+-- Polymarket Indexer - Resolution history
+-- Every stored ConditionResolution event, one row per log, removed only
+-- when a reorg removes its log. conditions keeps the current state of each
+-- condition: the resolution with the highest block, and the one before it
+-- again when a reorg removes the latest (cmd/consumer/main.go). A question
+-- resolved more than once, e.g. after a dispute, has one row per
+-- resolution here.
+--
+-- Resolutions stored before this migration are filled in from the raw
+-- events with `make backfill TABLES=condition_resolutions`.
+
+CREATE TABLE condition_resolutions (
+    id BIGSERIAL PRIMARY KEY,
+    condition_id TEXT NOT NULL,
+    oracle TEXT NOT NULL,
+    question_id TEXT NOT NULL,
+    outcome_slot_count INTEGER NOT NULL,
+    payout_numerators NUMERIC(78, 0)[] NOT NULL,
+    block_number BIGINT NOT NULL,
+    block_timestamp TIMESTAMPTZ NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT condition_resolutions_log_unique UNIQUE (transaction_hash, log_index)
+);
+
+CREATE INDEX idx_condition_resolutions_condition ON condition_resolutions (condition_id, block_number DESC, log_index DESC);
+
+COMMENT ON TABLE condition_resolutions IS 'Every ConditionResolution event, including re-resolutions of a condition';
@@ -0,0 +1,16 @@
+-- Polymarket Indexer - Position IDs of splits and merges
+-- position_ids holds the ERC1155 token ID of each index set of the
+-- partition, in partition order: the tokens a split minted or a merge
+-- burned, derived by the consumer with the CTF ID math (pkg/ctfmath) from
+-- the collateral token, parent collection and condition. They join splits
+-- and merges to token_transfers, balances and tokens without RPC calls.
+-- NULL when they cannot be derived (an invalid parent collection).
+--
+-- Rows stored before this migration are filled in from the raw events with
+-- `make backfill TABLES=position_splits,position_merges`.
+
+ALTER TABLE position_splits ADD COLUMN position_ids NUMERIC(78, 0)[];
+ALTER TABLE position_merges ADD COLUMN position_ids NUMERIC(78, 0)[];
+
+CREATE INDEX idx_position_splits_position_ids ON position_splits USING GIN (position_ids);
+CREATE INDEX idx_position_merges_position_ids ON position_merges USING GIN (position_ids);
@@ -0,0 +1,35 @@
+-- Polymarket Indexer - Event names of raw events
+-- A log routed to several handlers (fan-out, internal/router) is published
+-- once per handler, each event under its handler's name, so raw events are
+-- unique on the log and its event name: the event of one handler is no
+-- longer dropped as a redelivery of another's.
+--
+-- Events stored before this migration had a single handler per signature
+-- and are named after it.
+
+ALTER TABLE events ADD COLUMN event_name TEXT NOT NULL DEFAULT '';
+
+UPDATE events e
+SET event_name = n.event_name
+FROM (VALUES
+    ('0xd0a08e8c493f9c94f29311604c9de1b4e8c8d4c06bd0c789af57f2d65bfec0f6', 'OrderFilled'),
+    ('0x5152abf959f6564662358c2e52b702259b78bac5ee7842a0f01937e670efcc7d', 'OrderCancelled'),
+    ('0xbc9a2432e8aeb48327246cddd6e872ef452812b4243c04e6bfb786a2cd8faf0d', 'TokenRegistered'),
+    ('0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62', 'TransferSingle'),
+    ('0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb', 'TransferBatch'),
+    ('0xab3760c3bd2bb38b5bcf54dc79802ed67338b4cf29f3054ded67ed24661e4177', 'ConditionPreparation'),
+    ('0xb44d84d3289691f71497564b85d4233648d9dbae8cbdbb4329f301c3a0185894', 'ConditionResolution'),
+    ('0x2e6bb91f8cbcda0c93623c54d0403a43514fabc40084ec96b6d5379a74786298', 'PositionSplit'),
+    ('0x6f13ca62553fcc2bcd2372180a43949c1e4cebba603901ede2f4e14f36b282ca', 'PositionsMerge'),
+    ('0x2682012a4a4f1973119f1c9b90745d1bd91fa2bab387344f044cb3586864d18d', 'PayoutRedemption'),
+    ('0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef', 'ERC20Transfer')
+) AS n (event_signature, event_name)
+WHERE e.event_signature = n.event_signature;
+
+ALTER TABLE events ALTER COLUMN event_name DROP DEFAULT;
+
+ALTER TABLE events DROP CONSTRAINT events_log_unique;
+ALTER TABLE events ADD CONSTRAINT events_log_unique
+    UNIQUE (transaction_hash, log_index, event_name, block_timestamp);
+
+COMMENT ON COLUMN events.event_name IS 'Name of the handler event, one row per handler of a fanned-out log';
@@ -0,0 +1,218 @@
+// Package migrations embeds the versioned TimescaleDB schema written by the
+// consumer and applies it.
+//
+// Migrations are files "{version}_{name}.up.sql" in this directory, applied
+// in version order, each in its own transaction, and recorded in the
+// schema_migrations table. Applied migrations must never be edited; schema
+// changes go in a new file with a higher version.
+package migrations
+
+import (
+	"cmp"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed *.up.sql
+var files embed.FS
+
+const (
+	// fileSuffix ends the name of every migration file
+	fileSuffix = ".up.sql"
+
+	// advisoryLockKey serializes migrations across processes, so consumers
+	// starting together do not apply the same migration twice
+	advisoryLockKey = 0x706d696478 // "pmidx"
+
+	createVersionTable = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`
+)
+
+// ErrInvalidMigration is returned for migration files that cannot be
+// ordered: a name without a version or two files with the same version.
+var ErrInvalidMigration = errors.New("invalid migration")
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	SQL     string
+}
+
+// Status is a migration and when it was applied (zero = pending).
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// All returns the embedded migrations in version order.
+func All() ([]Migration, error) {
+	return load(files)
+}
+
+// load reads the migrations in the root of fsys in version order.
+func load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*"+fileSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	migrations := make([]Migration, 0, len(names))
+	for _, file := range names {
+		base := strings.TrimSuffix(path.Base(file), fileSuffix)
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil || version <= 0 || name == "" {
+			return nil, fmt.Errorf("%w: %s is not named {version}_{name}%s", ErrInvalidMigration, file, fileSuffix)
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(data)})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("%w: version %d is used by %s and %s",
+				ErrInvalidMigration, migrations[i].Version, migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+// Up applies the pending migrations and returns them. It holds a Postgres
+// advisory lock while it runs, so concurrent callers wait and then find
+// nothing left to apply. A failed migration is rolled back and stops Up;
+// the migrations before it stay applied.
+func Up(ctx context.Context, pool *pgxpool.Pool) ([]Migration, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", advisoryLockKey); err != nil {
+		return nil, fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockKey)
+
+	if _, err := conn.Exec(ctx, createVersionTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	applied, err := appliedVersions(ctx, conn.Conn())
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := apply(ctx, conn.Conn(), m); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// apply runs a migration and records it in one transaction.
+func apply(ctx context.Context, conn *pgx.Conn, m Migration) error {
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		// Without arguments the file runs over the simple protocol, which
+		// accepts several statements
+		if _, err := tx.Exec(ctx, m.SQL); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+// appliedVersions returns when each applied migration was applied, none if
+// schema_migrations does not exist yet.
+func appliedVersions(ctx context.Context, conn *pgx.Conn) (map[int64]time.Time, error) {
+	applied := make(map[int64]time.Time)
+
+	var exists bool
+	if err := conn.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// Statuses returns every embedded migration with when it was applied.
+func Statuses(ctx context.Context, pool *pgxpool.Pool) ([]Status, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	applied, err := appliedVersions(ctx, conn.Conn())
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = Status{Migration: m, AppliedAt: applied[m.Version]}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+)
+
+// TestAll tests that the embedded migrations load in strictly increasing
+// version order, starting at 1.
+func TestAll(t *testing.T) {
+	migrations, err := All()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	require.Equal(t, int64(1), migrations[0].Version)
+	require.Equal(t, "initial_schema", migrations[0].Name)
+	for i, m := range migrations {
+		require.NotEmpty(t, m.SQL, m.Name)
+		if i > 0 {
+			require.Greater(t, m.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+// TestEventNamesMigration tests that the migration naming the raw events
+// stored before it covers every registered event.
+func TestEventNamesMigration(t *testing.T) {
+	data, err := files.ReadFile("017_event_names.up.sql")
+	require.NoError(t, err)
+	for _, def := range events.All() {
+		require.Contains(t, string(data), fmt.Sprintf("('%s', '%s')", def.Signature.Hex(), def.Name))
+	}
+}
+
+// TestLoad tests that migration files are ordered by their numeric version
+// and that misnamed files and duplicate versions are rejected.
+func TestLoad(t *testing.T) {
+	migrations, err := load(fstest.MapFS{
+		"10_tenth.up.sql":  {Data: []byte("SELECT 10")},
+		"2_second.up.sql":  {Data: []byte("SELECT 2")},
+		"001_first.up.sql": {Data: []byte("SELECT 1")},
+		"README.md":        {Data: []byte("not a migration")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []Migration{
+		{Version: 1, Name: "first", SQL: "SELECT 1"},
+		{Version: 2, Name: "second", SQL: "SELECT 2"},
+		{Version: 10, Name: "tenth", SQL: "SELECT 10"},
+	}, migrations)
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"no version":        {"initial.up.sql": {}},
+		"no name":           {"1_.up.sql": {}},
+		"zero version":      {"0_initial.up.sql": {}},
+		"duplicate version": {"1_a.up.sql": {}, "01_b.up.sql": {}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := load(fsys)
+			require.ErrorIs(t, err, ErrInvalidMigration)
+		})
+	}
+}
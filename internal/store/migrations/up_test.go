@@ -0,0 +1,64 @@
+package migrations_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/migrations"
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+)
+
+// TestUp tests against TimescaleDB that concurrent callers apply every
+// migration exactly once, that a later Up finds nothing to apply and that
+// the statuses record every migration.
+func TestUp(t *testing.T) {
+	pool := pgtest.Database(t)
+	ctx := context.Background()
+	all, err := migrations.All()
+	require.NoError(t, err)
+
+	statuses, err := migrations.Statuses(ctx, pool)
+	require.NoError(t, err)
+	for _, s := range statuses {
+		require.True(t, s.AppliedAt.IsZero(), "pending before Up")
+	}
+
+	var wg sync.WaitGroup
+	applied := make([][]migrations.Migration, 3)
+	errs := make([]error, 3)
+	for i := range applied {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied[i], errs[i] = migrations.Up(ctx, pool)
+		}()
+	}
+	wg.Wait()
+
+	var total int
+	for i := range applied {
+		require.NoError(t, errs[i])
+		total += len(applied[i])
+	}
+	require.Equal(t, len(all), total)
+
+	again, err := migrations.Up(ctx, pool)
+	require.NoError(t, err)
+	require.Empty(t, again)
+
+	statuses, err = migrations.Statuses(ctx, pool)
+	require.NoError(t, err)
+	require.Len(t, statuses, len(all))
+	for _, s := range statuses {
+		require.False(t, s.AppliedAt.IsZero(), "migration %d applied", s.Version)
+	}
+
+	var hypertables int
+	require.NoError(t, pool.QueryRow(ctx,
+		"SELECT count(*) FROM timescaledb_information.hypertables WHERE hypertable_name IN ('events', 'order_fills', 'token_transfers')",
+	).Scan(&hypertables))
+	require.Equal(t, 3, hypertables)
+}
@@ -0,0 +1,80 @@
+package postgres
+
+const (
+	// applyTransferBalances completes a statement whose last CTE,
+	// "transfers", returns token_transfers rows: it moves each amount from
+	// from_address to to_address in balances. Rows are grouped first, as a
+	// batch may move the same token of a wallet several times and an upsert
+	// cannot update a row twice.
+	applyTransferBalances = transferDeltas + insertTransferDeltas
+
+	// transferDeltas is the CTE of applyTransferBalances reading the balance
+	// changes of "transfers"
+	transferDeltas = `,
+		deltas AS (
+			SELECT to_address AS wallet, token_id, amount AS delta, block_number FROM transfers
+			UNION ALL
+			SELECT from_address, token_id, -amount, block_number FROM transfers
+		)
+	`
+
+	// insertTransferDeltas is the upsert of applyTransferBalances applying
+	// "deltas"
+	insertTransferDeltas = `
+		INSERT INTO balances (wallet, token_id, balance, last_block)
+		SELECT wallet, token_id, SUM(delta), MAX(block_number)
+		FROM deltas
+		WHERE wallet <> '0x0000000000000000000000000000000000000000'
+		GROUP BY wallet, token_id
+		ON CONFLICT (wallet, token_id) DO UPDATE SET
+			balance = balances.balance + EXCLUDED.balance,
+			last_block = GREATEST(balances.last_block, EXCLUDED.last_block),
+			updated_at = NOW()
+	`
+
+	// transferBalanceColumns are the token_transfers columns
+	// applyTransferBalances reads
+	transferBalanceColumns = `from_address, to_address, token_id, amount, block_number`
+
+	// previousTransfers reads the stored rows of the transfer event $3/$4
+	// at timestamp $2, before the statement upserts them
+	previousTransfers = `
+		SELECT ` + transferBalanceColumns + `, batch_index FROM token_transfers
+		WHERE transaction_hash = $3 AND log_index = $4 AND block_timestamp = to_timestamp($2)
+	`
+
+	// upsertTransfer completes an insert into token_transfers: rows already
+	// stored with other values are corrected in place and returned, rows
+	// stored with the same values are left alone and not returned.
+	upsertTransfer = `
+		ON CONFLICT (transaction_hash, log_index, token_id, batch_index, block_timestamp) DO UPDATE SET
+			operator = EXCLUDED.operator,
+			from_address = EXCLUDED.from_address,
+			to_address = EXCLUDED.to_address,
+			amount = EXCLUDED.amount,
+			transfer_kind = EXCLUDED.transfer_kind
+		WHERE (token_transfers.operator, token_transfers.from_address, token_transfers.to_address,
+			token_transfers.amount, token_transfers.transfer_kind)
+			IS DISTINCT FROM (EXCLUDED.operator, EXCLUDED.from_address, EXCLUDED.to_address,
+			EXCLUDED.amount, EXCLUDED.transfer_kind)
+		RETURNING ` + transferBalanceColumns + `, batch_index
+	`
+
+	// applyUpsertedTransferBalances completes a statement whose CTEs
+	// "previous" (previousTransfers) and "upserted" (ending with
+	// upsertTransfer) read and upsert the rows of a transfer event: inserted
+	// rows move their amount, corrected rows first move their stored amount
+	// back. Balances are applied in a CTE so the statement's command tag
+	// counts the transfer rows it wrote (see execRows).
+	applyUpsertedTransferBalances = `,
+		transfers AS (
+			SELECT ` + transferBalanceColumns + ` FROM upserted
+			UNION ALL
+			SELECT p.to_address, p.from_address, p.token_id, p.amount, p.block_number
+			FROM previous p
+			JOIN upserted u ON u.token_id = p.token_id AND u.batch_index = p.batch_index
+		)` + transferDeltas + `,
+		applied AS (` + insertTransferDeltas + `)
+		SELECT 1 FROM upserted
+	`
+)
@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"math/big"
+	"time"
+)
+
+const (
+	// applyTradeCandles completes a statement whose CTE "inserted" returns
+	// the trades rows it inserted: it adds each trade to its candle
+	// of every width, $14 being the widths in seconds and $15 the matching
+	// bucket starts in Unix seconds. A trade earlier or later than the
+	// candle's open or close by (block, log index) replaces it, so trades
+	// may arrive in any order. Operator fills repeat the price of their
+	// match and are skipped.
+	applyTradeCandles = `
+		INSERT INTO candles (
+			token_id, interval_seconds, bucket, open, high, low, close, volume, notional, trades,
+			open_block, open_log_index, close_block, close_log_index
+		)
+		SELECT i.token_id, b.seconds, to_timestamp(b.bucket), i.price, i.price, i.price, i.price,
+			i.size, i.notional, 1, i.block_number, i.log_index, i.block_number, i.log_index
+		FROM inserted i
+		CROSS JOIN unnest($14::INTEGER[], $15::BIGINT[]) AS b(seconds, bucket)
+		WHERE NOT i.is_operator_fill
+		ON CONFLICT (token_id, interval_seconds, bucket) DO UPDATE SET
+			open = CASE WHEN (EXCLUDED.open_block, EXCLUDED.open_log_index) < (candles.open_block, candles.open_log_index)
+				THEN EXCLUDED.open ELSE candles.open END,
+			open_block = CASE WHEN (EXCLUDED.open_block, EXCLUDED.open_log_index) < (candles.open_block, candles.open_log_index)
+				THEN EXCLUDED.open_block ELSE candles.open_block END,
+			open_log_index = CASE WHEN (EXCLUDED.open_block, EXCLUDED.open_log_index) < (candles.open_block, candles.open_log_index)
+				THEN EXCLUDED.open_log_index ELSE candles.open_log_index END,
+			close = CASE WHEN (EXCLUDED.close_block, EXCLUDED.close_log_index) > (candles.close_block, candles.close_log_index)
+				THEN EXCLUDED.close ELSE candles.close END,
+			close_block = CASE WHEN (EXCLUDED.close_block, EXCLUDED.close_log_index) > (candles.close_block, candles.close_log_index)
+				THEN EXCLUDED.close_block ELSE candles.close_block END,
+			close_log_index = CASE WHEN (EXCLUDED.close_block, EXCLUDED.close_log_index) > (candles.close_block, candles.close_log_index)
+				THEN EXCLUDED.close_log_index ELSE candles.close_log_index END,
+			high = GREATEST(candles.high, EXCLUDED.high),
+			low = LEAST(candles.low, EXCLUDED.low),
+			volume = candles.volume + EXCLUDED.volume,
+			notional = candles.notional + EXCLUDED.notional,
+			trades = candles.trades + 1
+	`
+
+	// recomputeUpdatedTradeCandles completes a statement whose CTEs
+	// "previous" and "upserted" return the stored token_id and the upserted
+	// trades row of a fill, the upsert returning nothing when the trade was
+	// stored with the same values: when the trade was corrected, the candles
+	// of its buckets, for its stored and its corrected token, are recomputed
+	// with the corrected values. The statement still sees the trade as
+	// stored, so it is swapped for the upserted row ($3/$4 being its
+	// transaction hash and log index), and candles left without trades are
+	// deleted. Inserted trades are left to applyTradeCandles.
+	recomputeUpdatedTradeCandles = `,
+		replaced AS (
+			SELECT token_id FROM upserted WHERE EXISTS (SELECT 1 FROM previous)
+			UNION
+			SELECT token_id FROM previous WHERE EXISTS (SELECT 1 FROM upserted)
+		),
+		replaced_buckets AS (
+			SELECT r.token_id, b.seconds, b.bucket
+			FROM replaced r
+			CROSS JOIN unnest($14::INTEGER[], $15::BIGINT[]) AS b(seconds, bucket)
+		),
+		bucket_trades AS (
+			SELECT k.token_id, k.seconds, k.bucket, t.price, t.size, t.notional, t.block_number, t.log_index
+			FROM replaced_buckets k
+			JOIN trades t
+				ON t.token_id = k.token_id
+				AND t.block_timestamp >= to_timestamp(k.bucket)
+				AND t.block_timestamp < to_timestamp(k.bucket + k.seconds)
+			WHERE NOT t.is_operator_fill
+			  AND (t.transaction_hash, t.log_index) <> ($3, $4)
+			UNION ALL
+			SELECT k.token_id, k.seconds, k.bucket, u.price, u.size, u.notional, u.block_number, u.log_index
+			FROM replaced_buckets k
+			JOIN upserted u ON u.token_id = k.token_id
+			WHERE NOT u.is_operator_fill
+		),
+		recomputed AS (
+			SELECT
+				token_id,
+				seconds,
+				bucket,
+				(array_agg(price ORDER BY block_number, log_index))[1] AS open,
+				MAX(price) AS high,
+				MIN(price) AS low,
+				(array_agg(price ORDER BY block_number DESC, log_index DESC))[1] AS close,
+				SUM(size) AS volume,
+				SUM(notional) AS notional,
+				COUNT(*) AS trades,
+				(array_agg(block_number ORDER BY block_number, log_index))[1] AS open_block,
+				(array_agg(log_index ORDER BY block_number, log_index))[1] AS open_log_index,
+				(array_agg(block_number ORDER BY block_number DESC, log_index DESC))[1] AS close_block,
+				(array_agg(log_index ORDER BY block_number DESC, log_index DESC))[1] AS close_log_index
+			FROM bucket_trades
+			GROUP BY token_id, seconds, bucket
+		),
+		emptied AS (
+			DELETE FROM candles c
+			USING replaced_buckets k
+			WHERE c.token_id = k.token_id AND c.interval_seconds = k.seconds AND c.bucket = to_timestamp(k.bucket)
+			  AND NOT EXISTS (
+				SELECT 1 FROM recomputed r
+				WHERE r.token_id = k.token_id AND r.seconds = k.seconds AND r.bucket = k.bucket
+			  )
+		),
+		rewritten AS (
+			INSERT INTO candles (
+				token_id, interval_seconds, bucket, open, high, low, close, volume, notional, trades,
+				open_block, open_log_index, close_block, close_log_index
+			)
+			SELECT token_id, seconds, to_timestamp(bucket), open, high, low, close, volume, notional, trades,
+				open_block, open_log_index, close_block, close_log_index
+			FROM recomputed
+			ON CONFLICT (token_id, interval_seconds, bucket) DO UPDATE SET
+				open = EXCLUDED.open,
+				high = EXCLUDED.high,
+				low = EXCLUDED.low,
+				close = EXCLUDED.close,
+				volume = EXCLUDED.volume,
+				notional = EXCLUDED.notional,
+				trades = EXCLUDED.trades,
+				open_block = EXCLUDED.open_block,
+				open_log_index = EXCLUDED.open_log_index,
+				close_block = EXCLUDED.close_block,
+				close_log_index = EXCLUDED.close_log_index
+		)
+	`
+
+	// deleteCandles removes the candles of token $1 with the widths $2 and
+	// bucket starts $3, as in applyTradeCandles.
+	deleteCandles = `
+		DELETE FROM candles c
+		USING unnest($2::INTEGER[], $3::BIGINT[]) AS b(seconds, bucket)
+		WHERE c.token_id = $1 AND c.interval_seconds = b.seconds AND c.bucket = to_timestamp(b.bucket)
+	`
+
+	// insertCandlesFromTrades recomputes the candles deleteCandles removed
+	// from the trades left in their buckets.
+	insertCandlesFromTrades = `
+		INSERT INTO candles (
+			token_id, interval_seconds, bucket, open, high, low, close, volume, notional, trades,
+			open_block, open_log_index, close_block, close_log_index
+		)
+		SELECT
+			t.token_id,
+			b.seconds,
+			to_timestamp(b.bucket),
+			(array_agg(t.price ORDER BY t.block_number, t.log_index))[1],
+			MAX(t.price),
+			MIN(t.price),
+			(array_agg(t.price ORDER BY t.block_number DESC, t.log_index DESC))[1],
+			SUM(t.size),
+			SUM(t.notional),
+			COUNT(*),
+			(array_agg(t.block_number ORDER BY t.block_number, t.log_index))[1],
+			(array_agg(t.log_index ORDER BY t.block_number, t.log_index))[1],
+			(array_agg(t.block_number ORDER BY t.block_number DESC, t.log_index DESC))[1],
+			(array_agg(t.log_index ORDER BY t.block_number DESC, t.log_index DESC))[1]
+		FROM unnest($2::INTEGER[], $3::BIGINT[]) AS b(seconds, bucket)
+		JOIN trades t
+			ON t.token_id = $1
+			AND t.block_timestamp >= to_timestamp(b.bucket)
+			AND t.block_timestamp < to_timestamp(b.bucket + b.seconds)
+		WHERE NOT t.is_operator_fill
+		GROUP BY t.token_id, b.seconds, b.bucket
+	`
+)
+
+// candleBuckets returns the width in seconds and the start in Unix seconds
+// of the bucket of every candle interval holding timestamp.
+func (c Config) candleBuckets(timestamp uint64) (seconds []int32, buckets []int64) {
+	seconds = make([]int32, len(c.CandleIntervals))
+	buckets = make([]int64, len(c.CandleIntervals))
+	for i, interval := range c.CandleIntervals {
+		width := int64(interval / time.Second)
+		seconds[i] = int32(width)
+		buckets[i] = int64(timestamp) - int64(timestamp)%width
+	}
+	return seconds, buckets
+}
+
+// candleReversals recomputes the candles of a removed trade once it has
+// been deleted.
+func (c Config) candleReversals(tokenID *big.Int, timestamp uint64) []Statement {
+	if len(c.CandleIntervals) == 0 {
+		return nil
+	}
+	seconds, buckets := c.candleBuckets(timestamp)
+	args := []any{numeric(tokenID), seconds, buckets}
+	return []Statement{
+		{Query: deleteCandles, Args: args},
+		{Query: insertCandlesFromTrades, Args: args},
+	}
+}
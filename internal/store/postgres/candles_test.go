@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+)
+
+// TestCandleBuckets tests that a timestamp falls in the bucket of every
+// width starting at or before it.
+func TestCandleBuckets(t *testing.T) {
+	seconds, buckets := testConfig().candleBuckets(1_700_000_123)
+	require.Equal(t, []int32{60, 3600}, seconds)
+	require.Equal(t, []int64{1_700_000_100, 1_699_999_200}, buckets)
+}
+
+// TestReversalsOrderFilledRecomputesCandles tests that a removed trade
+// recomputes its candles after the trade is deleted.
+func TestReversalsOrderFilledRecomputesCandles(t *testing.T) {
+	reversals, err := newTestStore().Reversals(events.OrderFilled, storetest.FillEvent(100, 1, 1_700_000_123, 1_000_000, 2_000_000))
+	require.NoError(t, err)
+	require.Len(t, reversals, 6)
+	require.Contains(t, reversals[1].Query, "DELETE FROM trades")
+	require.Equal(t, deleteCandles, reversals[2].Query)
+	require.Equal(t, insertCandlesFromTrades, reversals[3].Query)
+	require.Equal(t, []any{numeric(big.NewInt(77)), []int32{60, 3600}, []int64{1_700_000_100, 1_699_999_200}}, reversals[3].Args)
+	require.Contains(t, reversals[5].Query, "DELETE FROM events")
+}
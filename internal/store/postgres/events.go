@@ -0,0 +1,645 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/pkg/ctfmath"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// binaryOutcomeSlots is the outcome slot count of every condition
+// registered on the CTF exchange.
+const binaryOutcomeSlots = 2
+
+// StoreOrderFilled stores an OrderFilled event.
+func (s *Store) StoreOrderFilled(ctx context.Context, event models.Event) error {
+	order, err := consumer.PayloadAs[models.OrderFilled](event)
+	if err != nil {
+		return err
+	}
+
+	if order.Side == models.OrderSideUnknown {
+		s.logger.Warn().
+			Str("tx", event.TxHash).
+			Uint("log_index", event.LogIndex).
+			Str("maker_asset_id", order.MakerAssetID.String()).
+			Str("taker_asset_id", order.TakerAssetID.String()).
+			Msg("order fill side could not be classified")
+	}
+
+	query := `
+		INSERT INTO order_fills (
+			block_number, block_timestamp, transaction_hash, log_index,
+			order_hash, maker, taker, maker_asset_id, taker_asset_id,
+			maker_amount_filled, taker_amount_filled, fee,
+			side, price, is_operator_fill
+		) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (transaction_hash, log_index, block_timestamp) DO UPDATE SET
+			order_hash = EXCLUDED.order_hash,
+			maker = EXCLUDED.maker,
+			taker = EXCLUDED.taker,
+			maker_asset_id = EXCLUDED.maker_asset_id,
+			taker_asset_id = EXCLUDED.taker_asset_id,
+			maker_amount_filled = EXCLUDED.maker_amount_filled,
+			taker_amount_filled = EXCLUDED.taker_amount_filled,
+			fee = EXCLUDED.fee,
+			side = EXCLUDED.side,
+			price = EXCLUDED.price,
+			is_operator_fill = EXCLUDED.is_operator_fill
+		WHERE (order_fills.order_hash, order_fills.maker, order_fills.taker, order_fills.maker_asset_id,
+			order_fills.taker_asset_id, order_fills.maker_amount_filled, order_fills.taker_amount_filled,
+			order_fills.fee, order_fills.side, order_fills.price, order_fills.is_operator_fill)
+			IS DISTINCT FROM (EXCLUDED.order_hash, EXCLUDED.maker, EXCLUDED.taker, EXCLUDED.maker_asset_id,
+			EXCLUDED.taker_asset_id, EXCLUDED.maker_amount_filled, EXCLUDED.taker_amount_filled,
+			EXCLUDED.fee, EXCLUDED.side, EXCLUDED.price, EXCLUDED.is_operator_fill)
+	`
+
+	_, err = s.db.Exec(ctx, query,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+		event.LogIndex,
+		order.OrderHash,
+		models.NormalizeAddress(order.Maker),
+		models.NormalizeAddress(order.Taker),
+		numeric(order.MakerAssetID),
+		numeric(order.TakerAssetID),
+		numeric(order.MakerAmountFilled),
+		numeric(order.TakerAmountFilled),
+		numeric(order.Fee),
+		nullIfEmpty(order.Side),
+		nullIfEmpty(order.Price),
+		order.IsOperatorFill,
+	)
+	if err != nil {
+		return err
+	}
+
+	trade, ok := s.cfg.deriveTrade(order, event.ContractAddr)
+	if !ok {
+		return nil
+	}
+
+	// A newly inserted trade is added to its candles and a corrected one
+	// recomputes them; a redelivered event changes nothing
+	query = `
+		WITH previous AS (
+			SELECT token_id FROM trades
+			WHERE transaction_hash = $3 AND log_index = $4 AND block_timestamp = to_timestamp($2)
+		),
+		upserted AS (
+			INSERT INTO trades (
+				block_number, block_timestamp, transaction_hash, log_index, maker, taker,
+				token_id, side, price, size, notional, fee, is_operator_fill
+			) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			ON CONFLICT (transaction_hash, log_index, block_timestamp) DO UPDATE SET
+				maker = EXCLUDED.maker,
+				taker = EXCLUDED.taker,
+				token_id = EXCLUDED.token_id,
+				side = EXCLUDED.side,
+				price = EXCLUDED.price,
+				size = EXCLUDED.size,
+				notional = EXCLUDED.notional,
+				fee = EXCLUDED.fee,
+				is_operator_fill = EXCLUDED.is_operator_fill
+			WHERE (trades.maker, trades.taker, trades.token_id, trades.side, trades.price, trades.size,
+				trades.notional, trades.fee, trades.is_operator_fill)
+				IS DISTINCT FROM (EXCLUDED.maker, EXCLUDED.taker, EXCLUDED.token_id, EXCLUDED.side, EXCLUDED.price,
+				EXCLUDED.size, EXCLUDED.notional, EXCLUDED.fee, EXCLUDED.is_operator_fill)
+			RETURNING token_id, price, size, notional, block_number, log_index, is_operator_fill
+		),
+		inserted AS (
+			SELECT * FROM upserted WHERE NOT EXISTS (SELECT 1 FROM previous)
+		)` + recomputeUpdatedTradeCandles + applyTradeCandles
+	seconds, buckets := s.cfg.candleBuckets(event.Timestamp)
+
+	_, err = s.db.Exec(ctx, query,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+		event.LogIndex,
+		models.NormalizeAddress(order.Maker),
+		models.NormalizeAddress(order.Taker),
+		numeric(trade.TokenID),
+		trade.Side,
+		trade.Price,
+		trade.Size,
+		trade.Notional,
+		trade.Fee,
+		trade.IsOperatorFill,
+		seconds,
+		buckets,
+	)
+
+	return err
+}
+
+// StoreTokenRegistered stores a TokenRegistered event.
+func (s *Store) StoreTokenRegistered(ctx context.Context, event models.Event) error {
+	token, err := consumer.PayloadAs[models.TokenRegistered](event)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO token_registrations (
+			block_number, block_timestamp, transaction_hash, log_index,
+			token0, token1, condition_id
+		) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7)
+		ON CONFLICT (transaction_hash, log_index) DO UPDATE SET
+			token0 = EXCLUDED.token0,
+			token1 = EXCLUDED.token1,
+			condition_id = EXCLUDED.condition_id
+		WHERE (token_registrations.token0, token_registrations.token1, token_registrations.condition_id)
+			IS DISTINCT FROM (EXCLUDED.token0, EXCLUDED.token1, EXCLUDED.condition_id)
+	`
+
+	_, err = s.db.Exec(ctx, query,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+		event.LogIndex,
+		numeric(token.Token0),
+		numeric(token.Token1),
+		models.NormalizeHash(token.ConditionID),
+	)
+	if err != nil {
+		return err
+	}
+
+	return s.storeTokenPair(ctx, event, token)
+}
+
+// storeTokenPair upserts both outcome tokens of a registration into the
+// tokens lookup table, each pointing at its complement.
+func (s *Store) storeTokenPair(ctx context.Context, event models.Event, token models.TokenRegistered) error {
+	conditionID := models.NormalizeHash(token.ConditionID)
+
+	query := `
+		INSERT INTO tokens (
+			token_id, complement_token_id, condition_id, outcome_index,
+			block_number, transaction_hash, log_index
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (token_id) DO UPDATE SET
+			complement_token_id = EXCLUDED.complement_token_id,
+			condition_id = EXCLUDED.condition_id,
+			outcome_index = COALESCE(EXCLUDED.outcome_index, tokens.outcome_index)
+		WHERE (tokens.complement_token_id, tokens.condition_id, tokens.outcome_index)
+			IS DISTINCT FROM (EXCLUDED.complement_token_id, EXCLUDED.condition_id,
+			COALESCE(EXCLUDED.outcome_index, tokens.outcome_index))
+	`
+
+	pairs := [][2]*big.Int{{token.Token0, token.Token1}, {token.Token1, token.Token0}}
+	for _, pair := range pairs {
+		_, err := s.db.Exec(ctx, query,
+			numeric(pair[0]),
+			numeric(pair[1]),
+			conditionID,
+			s.cfg.outcomeIndex(conditionID, pair[0]),
+			event.Block,
+			event.TxHash,
+			event.LogIndex,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store token %s: %w", pair[0], err)
+		}
+	}
+
+	return nil
+}
+
+// outcomeIndex derives the outcome slot tokenID pays out on, or nil when it
+// cannot be derived so the column is stored as NULL.
+func (c Config) outcomeIndex(conditionID string, tokenID *big.Int) any {
+	if c.CollateralToken == (common.Address{}) {
+		return nil
+	}
+	index, ok := ctfmath.OutcomeIndex(c.CollateralToken, common.HexToHash(conditionID), tokenID, binaryOutcomeSlots)
+	if !ok {
+		return nil
+	}
+	return index
+}
+
+// positionIDs returns the position IDs of the partition of a split or merge,
+// or nil (NULL) when they cannot be derived.
+func positionIDs(collateral, parentCollectionID, conditionID string, partition []*big.Int) any {
+	ids, err := ctfmath.PositionIDs(common.HexToAddress(collateral), common.HexToHash(parentCollectionID), common.HexToHash(conditionID), partition)
+	if err != nil {
+		return nil
+	}
+	return numerics(ids)
+}
+
+// StoreTokenTransfer stores a TransferSingle event.
+func (s *Store) StoreTokenTransfer(ctx context.Context, event models.Event) error {
+	transfer, err := consumer.PayloadAs[models.TransferSingle](event)
+	if err != nil {
+		return err
+	}
+
+	// Only an inserted or corrected transfer moves balances, so a
+	// redelivered event is not counted twice
+	query := `
+		WITH previous AS (` + previousTransfers + `),
+		upserted AS (
+			INSERT INTO token_transfers (
+				block_number, block_timestamp, transaction_hash, log_index,
+				operator, from_address, to_address, token_id, amount, transfer_kind
+			) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8, $9, $10)
+			` + upsertTransfer + `
+		)` + applyUpsertedTransferBalances
+
+	return execRows(ctx, s.db, 1, query,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+		event.LogIndex,
+		models.NormalizeAddress(transfer.Operator),
+		models.NormalizeAddress(transfer.From),
+		models.NormalizeAddress(transfer.To),
+		numeric(transfer.TokenID),
+		numeric(transfer.Amount),
+		storedTransferKind(transfer.TransferKind, transfer.From, transfer.To),
+	)
+}
+
+// StoreTokenTransferBatch stores a TransferBatch event, one row per token
+// numbered by its position in the batch. The rows are inserted by a single
+// statement, so a batch is never half written.
+func (s *Store) StoreTokenTransferBatch(ctx context.Context, event models.Event) error {
+	transfer, err := consumer.PayloadAs[models.TransferBatch](event)
+	if err != nil {
+		return err
+	}
+	if len(transfer.TokenIDs) != len(transfer.Amounts) {
+		return consumer.Permanent(fmt.Errorf("transfer batch has %d token ids and %d amounts",
+			len(transfer.TokenIDs), len(transfer.Amounts)))
+	}
+
+	query := `
+		WITH previous AS (` + previousTransfers + `),
+		upserted AS (
+			INSERT INTO token_transfers (
+				block_number, block_timestamp, transaction_hash, log_index,
+				operator, from_address, to_address, token_id, amount, transfer_kind, batch_index
+			)
+			SELECT $1::BIGINT, to_timestamp($2), $3::TEXT, $4::INTEGER, $5::TEXT, $6::TEXT, $7::TEXT,
+				t.token_id, t.amount, $10::TEXT, t.position - 1
+			FROM unnest($8::NUMERIC[], $9::NUMERIC[]) WITH ORDINALITY AS t(token_id, amount, position)
+			` + upsertTransfer + `
+		)` + applyUpsertedTransferBalances
+
+	// Each row of the batch is counted
+	return execRows(ctx, s.db, len(transfer.TokenIDs), query,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+		event.LogIndex,
+		models.NormalizeAddress(transfer.Operator),
+		models.NormalizeAddress(transfer.From),
+		models.NormalizeAddress(transfer.To),
+		numerics(transfer.TokenIDs),
+		numerics(transfer.Amounts),
+		storedTransferKind(transfer.TransferKind, transfer.From, transfer.To),
+	)
+}
+
+// StoreCollateralTransfer stores a collateral token (USDC) Transfer event.
+func (s *Store) StoreCollateralTransfer(ctx context.Context, event models.Event) error {
+	transfer, err := consumer.PayloadAs[models.ERC20Transfer](event)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO collateral_transfers (
+			block_number, block_timestamp, transaction_hash, log_index,
+			token, from_address, to_address, amount
+		) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (transaction_hash, log_index) DO UPDATE SET
+			token = EXCLUDED.token,
+			from_address = EXCLUDED.from_address,
+			to_address = EXCLUDED.to_address,
+			amount = EXCLUDED.amount
+		WHERE (collateral_transfers.token, collateral_transfers.from_address,
+			collateral_transfers.to_address, collateral_transfers.amount)
+			IS DISTINCT FROM (EXCLUDED.token, EXCLUDED.from_address, EXCLUDED.to_address, EXCLUDED.amount)
+	`
+
+	_, err = s.db.Exec(ctx, query,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+		event.LogIndex,
+		models.NormalizeAddress(transfer.Token),
+		models.NormalizeAddress(transfer.From),
+		models.NormalizeAddress(transfer.To),
+		numeric(transfer.Value),
+	)
+
+	return err
+}
+
+// StoreConditionPreparation stores a ConditionPreparation event. If the
+// condition's resolution was stored first, the preparation fills in the
+// row it created and leaves the resolution columns alone.
+func (s *Store) StoreConditionPreparation(ctx context.Context, event models.Event) error {
+	condition, err := consumer.PayloadAs[models.ConditionPreparation](event)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO conditions (
+			condition_id, oracle, question_id, outcome_slot_count,
+			block_number, block_timestamp, transaction_hash
+		) VALUES ($1, $2, $3, $4, $5, to_timestamp($6), $7)
+		ON CONFLICT (condition_id) DO UPDATE SET
+			oracle = EXCLUDED.oracle,
+			question_id = EXCLUDED.question_id,
+			outcome_slot_count = EXCLUDED.outcome_slot_count,
+			block_number = EXCLUDED.block_number,
+			block_timestamp = EXCLUDED.block_timestamp,
+			transaction_hash = EXCLUDED.transaction_hash
+		WHERE (conditions.oracle, conditions.question_id, conditions.outcome_slot_count,
+			conditions.block_number, conditions.block_timestamp, conditions.transaction_hash)
+			IS DISTINCT FROM (EXCLUDED.oracle, EXCLUDED.question_id, EXCLUDED.outcome_slot_count,
+			EXCLUDED.block_number, EXCLUDED.block_timestamp, EXCLUDED.transaction_hash)
+	`
+
+	// A new condition is looked up in the Gamma API once it is committed
+	return execObserved(ctx, s.db, s.cfg.OnPrepared, query,
+		models.NormalizeHash(condition.ConditionID),
+		models.NormalizeAddress(condition.Oracle),
+		models.NormalizeHash(condition.QuestionID),
+		condition.OutcomeSlotCount,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+	)
+}
+
+// StoreConditionResolution stores a ConditionResolution event in the
+// resolution history and as the current resolution of its condition.
+// Resolutions can be consumed before their preparation (parallel backfill
+// workers, redeliveries), so the condition is created from the resolution's
+// payload if it does not exist yet; its preparation columns stay NULL until
+// the preparation is stored. A condition resolved again keeps the
+// resolution with the highest block, whichever is consumed last.
+func (s *Store) StoreConditionResolution(ctx context.Context, event models.Event) error {
+	resolution, err := consumer.PayloadAs[models.ConditionResolution](event)
+	if err != nil {
+		return err
+	}
+
+	// Never record payouts that downstream win/loss calculations cannot use
+	if err := models.ValidatePayouts(uint64(resolution.OutcomeSlotCount), resolution.PayoutNumerators); err != nil {
+		consumer.ResolutionsRejected.Inc()
+		return fmt.Errorf("rejected resolution for condition %s: %w", resolution.ConditionID, err)
+	}
+
+	conditionID := models.NormalizeHash(resolution.ConditionID)
+	oracle := models.NormalizeAddress(resolution.Oracle)
+	questionID := models.NormalizeHash(resolution.QuestionID)
+	payouts := numerics(resolution.PayoutNumerators)
+
+	// Count resolutions whose preparation has not been stored
+	prepared := `SELECT 1 FROM conditions WHERE condition_id = $1 AND transaction_hash IS NOT NULL`
+	err = execObserved(ctx, s.db, func(tag pgconn.CommandTag) {
+		if tag.RowsAffected() == 0 {
+			consumer.ResolutionsUnprepared.Inc()
+		}
+	}, prepared, conditionID)
+	if err != nil {
+		return err
+	}
+
+	// Holders are snapshotted when the condition becomes resolved, not when
+	// it is resolved again
+	query := `
+		INSERT INTO conditions (
+			condition_id, oracle, question_id, outcome_slot_count,
+			resolved, payout_numerators, resolution_block, resolution_timestamp, resolution_tx,
+			holders_snapshot_pending
+		) VALUES ($1, $2, $3, $4, true, $5, $6, to_timestamp($7), $8, true)
+		ON CONFLICT (condition_id) DO UPDATE SET
+			resolved = true,
+			payout_numerators = EXCLUDED.payout_numerators,
+			resolution_block = EXCLUDED.resolution_block,
+			resolution_timestamp = EXCLUDED.resolution_timestamp,
+			resolution_tx = EXCLUDED.resolution_tx,
+			holders_snapshot_pending = conditions.holders_snapshot_pending OR NOT conditions.resolved
+		WHERE (conditions.resolved, conditions.payout_numerators, conditions.resolution_block,
+			conditions.resolution_timestamp, conditions.resolution_tx)
+			IS DISTINCT FROM (true, EXCLUDED.payout_numerators, EXCLUDED.resolution_block,
+			EXCLUDED.resolution_timestamp, EXCLUDED.resolution_tx)
+		  AND (conditions.resolution_block IS NULL OR conditions.resolution_block <= EXCLUDED.resolution_block)
+	`
+
+	// A redelivered resolution updates nothing and stays snapshotted; a new
+	// one is snapshotted once it is committed
+	err = execObserved(ctx, s.db, s.cfg.OnResolved, query,
+		conditionID,
+		oracle,
+		questionID,
+		resolution.OutcomeSlotCount,
+		payouts,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	history := `
+		INSERT INTO condition_resolutions (
+			condition_id, oracle, question_id, outcome_slot_count, payout_numerators,
+			block_number, block_timestamp, transaction_hash, log_index
+		) VALUES ($1, $2, $3, $4, $5, $6, to_timestamp($7), $8, $9)
+		ON CONFLICT (transaction_hash, log_index) DO UPDATE SET
+			condition_id = EXCLUDED.condition_id,
+			oracle = EXCLUDED.oracle,
+			question_id = EXCLUDED.question_id,
+			outcome_slot_count = EXCLUDED.outcome_slot_count,
+			payout_numerators = EXCLUDED.payout_numerators
+		WHERE (condition_resolutions.condition_id, condition_resolutions.oracle, condition_resolutions.question_id,
+			condition_resolutions.outcome_slot_count, condition_resolutions.payout_numerators)
+			IS DISTINCT FROM (EXCLUDED.condition_id, EXCLUDED.oracle, EXCLUDED.question_id,
+			EXCLUDED.outcome_slot_count, EXCLUDED.payout_numerators)
+	`
+
+	_, err = s.db.Exec(ctx, history,
+		conditionID,
+		oracle,
+		questionID,
+		resolution.OutcomeSlotCount,
+		payouts,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+		event.LogIndex,
+	)
+	return err
+}
+
+// StorePositionSplit stores a PositionSplit event and applies it to the open
+// interest of its condition.
+func (s *Store) StorePositionSplit(ctx context.Context, event models.Event) error {
+	split, err := consumer.PayloadAs[models.PositionSplit](event)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		WITH previous AS (
+			SELECT condition_id, amount AS delta, block_number, is_root_collection
+			FROM position_splits WHERE transaction_hash = $3 AND log_index = $4
+		),
+		upserted AS (
+			INSERT INTO position_splits (
+				block_number, block_timestamp, transaction_hash, log_index,
+				stakeholder, collateral_token, parent_collection_id, condition_id,
+				partition, amount, is_root_collection, position_ids
+			) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			ON CONFLICT (transaction_hash, log_index) DO UPDATE SET
+				stakeholder = EXCLUDED.stakeholder,
+				collateral_token = EXCLUDED.collateral_token,
+				parent_collection_id = EXCLUDED.parent_collection_id,
+				condition_id = EXCLUDED.condition_id,
+				partition = EXCLUDED.partition,
+				amount = EXCLUDED.amount,
+				is_root_collection = EXCLUDED.is_root_collection,
+				position_ids = EXCLUDED.position_ids
+			WHERE (position_splits.stakeholder, position_splits.collateral_token, position_splits.parent_collection_id, position_splits.condition_id,
+				position_splits.partition, position_splits.amount, position_splits.is_root_collection, position_splits.position_ids)
+				IS DISTINCT FROM (EXCLUDED.stakeholder, EXCLUDED.collateral_token, EXCLUDED.parent_collection_id,
+				EXCLUDED.condition_id, EXCLUDED.partition, EXCLUDED.amount, EXCLUDED.is_root_collection,
+				EXCLUDED.position_ids)
+			RETURNING condition_id, amount AS delta, block_number, is_root_collection
+		)` + upsertedOpenInterestChanges
+
+	return execObserved(ctx, s.db, observeOpenInterest(events.PositionSplit, event, s.logger), query,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+		event.LogIndex,
+		models.NormalizeAddress(split.Stakeholder),
+		models.NormalizeAddress(split.CollateralToken),
+		models.NormalizeHash(split.ParentCollectionID),
+		models.NormalizeHash(split.ConditionID),
+		numerics(split.Partition),
+		numeric(split.Amount),
+		models.IsRootCollection(split.ParentCollectionID),
+		positionIDs(split.CollateralToken, split.ParentCollectionID, split.ConditionID, split.Partition),
+	)
+}
+
+// StorePositionsMerge stores a PositionsMerge event and applies it to the open
+// interest of its condition.
+func (s *Store) StorePositionsMerge(ctx context.Context, event models.Event) error {
+	merge, err := consumer.PayloadAs[models.PositionsMerge](event)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		WITH previous AS (
+			SELECT condition_id, -amount AS delta, block_number, is_root_collection
+			FROM position_merges WHERE transaction_hash = $3 AND log_index = $4
+		),
+		upserted AS (
+			INSERT INTO position_merges (
+				block_number, block_timestamp, transaction_hash, log_index,
+				stakeholder, collateral_token, parent_collection_id, condition_id,
+				partition, amount, is_root_collection, position_ids
+			) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			ON CONFLICT (transaction_hash, log_index) DO UPDATE SET
+				stakeholder = EXCLUDED.stakeholder,
+				collateral_token = EXCLUDED.collateral_token,
+				parent_collection_id = EXCLUDED.parent_collection_id,
+				condition_id = EXCLUDED.condition_id,
+				partition = EXCLUDED.partition,
+				amount = EXCLUDED.amount,
+				is_root_collection = EXCLUDED.is_root_collection,
+				position_ids = EXCLUDED.position_ids
+			WHERE (position_merges.stakeholder, position_merges.collateral_token, position_merges.parent_collection_id, position_merges.condition_id,
+				position_merges.partition, position_merges.amount, position_merges.is_root_collection, position_merges.position_ids)
+				IS DISTINCT FROM (EXCLUDED.stakeholder, EXCLUDED.collateral_token, EXCLUDED.parent_collection_id,
+				EXCLUDED.condition_id, EXCLUDED.partition, EXCLUDED.amount, EXCLUDED.is_root_collection,
+				EXCLUDED.position_ids)
+			RETURNING condition_id, -amount AS delta, block_number, is_root_collection
+		)` + upsertedOpenInterestChanges
+
+	return execObserved(ctx, s.db, observeOpenInterest(events.PositionsMerge, event, s.logger), query,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+		event.LogIndex,
+		models.NormalizeAddress(merge.Stakeholder),
+		models.NormalizeAddress(merge.CollateralToken),
+		models.NormalizeHash(merge.ParentCollectionID),
+		models.NormalizeHash(merge.ConditionID),
+		numerics(merge.Partition),
+		numeric(merge.Amount),
+		models.IsRootCollection(merge.ParentCollectionID),
+		positionIDs(merge.CollateralToken, merge.ParentCollectionID, merge.ConditionID, merge.Partition),
+	)
+}
+
+// StorePayoutRedemption stores a PayoutRedemption event and takes its
+// payout out of the open interest of its condition.
+func (s *Store) StorePayoutRedemption(ctx context.Context, event models.Event) error {
+	redemption, err := consumer.PayloadAs[models.PayoutRedemption](event)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		WITH previous AS (
+			SELECT condition_id, -payout AS delta, block_number, is_root_collection
+			FROM payout_redemptions WHERE transaction_hash = $3 AND log_index = $4
+		),
+		upserted AS (
+			INSERT INTO payout_redemptions (
+				block_number, block_timestamp, transaction_hash, log_index,
+				redeemer, collateral_token, parent_collection_id, condition_id,
+				index_sets, payout, is_root_collection
+			) VALUES ($1, to_timestamp($2), $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (transaction_hash, log_index) DO UPDATE SET
+				redeemer = EXCLUDED.redeemer,
+				collateral_token = EXCLUDED.collateral_token,
+				parent_collection_id = EXCLUDED.parent_collection_id,
+				condition_id = EXCLUDED.condition_id,
+				index_sets = EXCLUDED.index_sets,
+				payout = EXCLUDED.payout,
+				is_root_collection = EXCLUDED.is_root_collection
+			WHERE (payout_redemptions.redeemer, payout_redemptions.collateral_token, payout_redemptions.parent_collection_id, payout_redemptions.condition_id,
+				payout_redemptions.index_sets, payout_redemptions.payout, payout_redemptions.is_root_collection)
+				IS DISTINCT FROM (EXCLUDED.redeemer, EXCLUDED.collateral_token, EXCLUDED.parent_collection_id,
+				EXCLUDED.condition_id, EXCLUDED.index_sets, EXCLUDED.payout, EXCLUDED.is_root_collection)
+			RETURNING condition_id, -payout AS delta, block_number, is_root_collection
+		)` + upsertedOpenInterestChanges
+
+	return execObserved(ctx, s.db, observeOpenInterest(events.PayoutRedemption, event, s.logger), query,
+		event.Block,
+		event.Timestamp,
+		event.TxHash,
+		event.LogIndex,
+		models.NormalizeAddress(redemption.Redeemer),
+		models.NormalizeAddress(redemption.CollateralToken),
+		models.NormalizeHash(redemption.ParentCollectionID),
+		models.NormalizeHash(redemption.ConditionID),
+		numerics(redemption.IndexSets),
+		numeric(redemption.Payout),
+		models.IsRootCollection(redemption.ParentCollectionID),
+	)
+}
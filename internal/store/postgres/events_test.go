@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+	"math/big"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestStoreConditionResolutionCountsUnprepared tests that a resolution is
+// counted as out of order only when its condition had not been prepared,
+// once the statement checking it is committed.
+func TestStoreConditionResolutionCountsUnprepared(t *testing.T) {
+	var recorder Recorder
+	require.NoError(t, New(&recorder, testConfig(), zerolog.Nop()).StoreConditionResolution(context.Background(), storetest.ResolutionEvent(0)))
+	require.Len(t, recorder.Statements, 3)
+	require.Contains(t, recorder.Statements[1].Query, "ON CONFLICT (condition_id) DO UPDATE")
+	require.Contains(t, recorder.Statements[2].Query, "INSERT INTO condition_resolutions")
+
+	check := recorder.Statements[0]
+	require.NotNil(t, check.Observe)
+	before := testutil.ToFloat64(consumer.ResolutionsUnprepared)
+	check.Observe(pgconn.NewCommandTag("SELECT 1"))
+	require.Equal(t, before, testutil.ToFloat64(consumer.ResolutionsUnprepared))
+	check.Observe(pgconn.NewCommandTag("SELECT 0"))
+	require.Equal(t, before+1, testutil.ToFloat64(consumer.ResolutionsUnprepared))
+}
+
+// TestStoreTokenTransferBatch tests that a batch is inserted by a single
+// statement and that a batch whose arrays differ in length is rejected as
+// permanent.
+func TestStoreTokenTransferBatch(t *testing.T) {
+	var recorder Recorder
+	require.NoError(t, New(&recorder, testConfig(), zerolog.Nop()).StoreTokenTransferBatch(context.Background(), storetest.TransferBatchEvent(100)))
+	require.Len(t, recorder.Statements, 1)
+	require.Equal(t, 100, recorder.Statements[0].Rows, "each row of the batch is counted")
+	args := recorder.Statements[0].Args
+	require.Len(t, args[7], 100)
+	require.Equal(t, numeric(big.NewInt(1000)), args[7].([]pgtype.Numeric)[1])
+	require.Equal(t, numeric(big.NewInt(2)), args[8].([]pgtype.Numeric)[1])
+
+	event := storetest.TransferBatchEvent(2)
+	transfer := event.Payload.(models.TransferBatch)
+	transfer.Amounts = transfer.Amounts[:1]
+	event.Payload = transfer
+	err := New(&recorder, testConfig(), zerolog.Nop()).StoreTokenTransferBatch(context.Background(), event)
+	require.Error(t, err)
+	require.True(t, consumer.IsPermanent(err))
+}
+
+// TestStorePositionIDs tests that splits and merges are stored with the
+// position ID of each index set of their partition, and with none when the
+// parent collection is invalid.
+func TestStorePositionIDs(t *testing.T) {
+	const conditionID = "0x0e0df99b0db4a4b54eb056e47b6e618778dc9131677c0498a078bbbe9eaf6ac8"
+	yes, _ := new(big.Int).SetString("82920568567095788639981848039841706550389990987498351315524354004233063046687", 10)
+	no, _ := new(big.Int).SetString("38507028285546991471236137912036679889560729235078357760005666316730865297203", 10)
+
+	withCondition := func(event models.Event, parent string) models.Event {
+		switch p := event.Payload.(type) {
+		case models.PositionSplit:
+			p.ConditionID, p.ParentCollectionID = conditionID, parent
+			event.Payload = p
+		case models.PositionsMerge:
+			p.ConditionID, p.ParentCollectionID = conditionID, parent
+			event.Payload = p
+		}
+		return event
+	}
+
+	for eventType, method := range map[string]func(*Store, context.Context, models.Event) error{
+		events.PositionSplit:  (*Store).StorePositionSplit,
+		events.PositionsMerge: (*Store).StorePositionsMerge,
+	} {
+		var recorder Recorder
+		event := withCondition(storetest.PositionEvent(eventType, 100, 10_000_000, false), models.RootCollectionID)
+		require.NoError(t, method(New(&recorder, testConfig(), zerolog.Nop()), context.Background(), event), eventType)
+		require.Contains(t, recorder.Statements[0].Query, "position_ids", eventType)
+		args := recorder.Statements[0].Args
+		require.Equal(t, numerics([]*big.Int{yes, no}), args[len(args)-1], eventType)
+
+		// 4 is not the x-coordinate of a point on alt_bn128
+		recorder = Recorder{}
+		event = withCondition(storetest.PositionEvent(eventType, 101, 10_000_000, true), "0x"+strings.Repeat("00", 31)+"04")
+		require.NoError(t, method(New(&recorder, testConfig(), zerolog.Nop()), context.Background(), event), eventType)
+		args = recorder.Statements[0].Args
+		require.Nil(t, args[len(args)-1], eventType)
+	}
+}
+
+// upsertPattern matches an ON CONFLICT DO UPDATE clause, capturing its
+// conflict target and its assignments.
+var upsertPattern = regexp.MustCompile(`(?s)ON CONFLICT \(([^)]*)\) DO UPDATE SET(.*?)(?:\bWHERE\b|\bRETURNING\b|\)\s*,|$)`)
+
+// assignedPattern matches the column of an assignment.
+var assignedPattern = regexp.MustCompile(`(\w+)\s*=`)
+
+// TestStoreUpsertsKeepKeys tests that the raw event of every registered event
+// is inserted append-only and that the rows parsed from it are upserted
+// without assigning their conflict target, block, block timestamp or
+// creation time.
+func TestStoreUpsertsKeepKeys(t *testing.T) {
+	upserts := 0
+	for name, payload := range storetest.Payloads {
+		event := models.Event{
+			Block:     100,
+			Timestamp: 1_700_000_000,
+			TxHash:    storetest.TxHash,
+			EventName: name,
+			Payload:   payload,
+			Success:   true,
+		}
+		var recorder Recorder
+		require.NoError(t, store.StoreEvent(context.Background(), New(&recorder, testConfig(), zerolog.Nop()), name, event), name)
+
+		for _, s := range recorder.Statements {
+			if strings.Contains(s.Query, "INSERT INTO events") {
+				require.Contains(t, s.Query, "DO NOTHING", name)
+				require.NotContains(t, s.Query, "DO UPDATE", name)
+				continue
+			}
+			require.NotContains(t, s.Query, "DO NOTHING", name)
+
+			for _, match := range upsertPattern.FindAllStringSubmatch(s.Query, -1) {
+				target := strings.Split(match[1], ",")
+				if !strings.Contains(match[1], "log_index") {
+					continue
+				}
+				upserts++
+				immutable := map[string]bool{"block_number": true, "block_timestamp": true, "created_at": true}
+				for _, column := range target {
+					immutable[strings.TrimSpace(column)] = true
+				}
+				for _, assigned := range assignedPattern.FindAllStringSubmatch(match[2], -1) {
+					require.False(t, immutable[assigned[1]], "%s assigns %s", name, assigned[1])
+				}
+			}
+		}
+	}
+	require.NotZero(t, upserts)
+}
@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"math/big"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// numeric binds an integer to a NUMERIC parameter, so it is sent in the
+// binary format instead of as text; nil binds NULL.
+func numeric(v *big.Int) pgtype.Numeric {
+	if v == nil {
+		return pgtype.Numeric{}
+	}
+	return pgtype.Numeric{Int: new(big.Int).Set(v), Valid: true}
+}
+
+// numerics binds integers to a NUMERIC[] parameter.
+func numerics(values []*big.Int) []pgtype.Numeric {
+	out := make([]pgtype.Numeric, len(values))
+	for i, v := range values {
+		out[i] = numeric(v)
+	}
+	return out
+}
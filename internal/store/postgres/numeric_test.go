@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+// Integers at the top of the uint256 range, beyond float64 precision.
+var (
+	twoTo255   = new(big.Int).Lsh(big.NewInt(1), 255)
+	maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+)
+
+// TestNumericBinaryRoundTrip tests that integers bound as NUMERIC encode in
+// the binary format and decode to the same value, and that nil binds NULL.
+func TestNumericBinaryRoundTrip(t *testing.T) {
+	m := pgtype.NewMap()
+	for _, v := range []*big.Int{big.NewInt(0), big.NewInt(1_000_000), twoTo255, maxUint256} {
+		data, err := m.Encode(pgtype.NumericOID, pgtype.BinaryFormatCode, numeric(v), nil)
+		require.NoError(t, err)
+
+		var decoded pgtype.Numeric
+		require.NoError(t, m.Scan(pgtype.NumericOID, pgtype.BinaryFormatCode, data, &decoded))
+		require.True(t, decoded.Valid)
+		value := new(big.Int).Mul(decoded.Int, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decoded.Exp)), nil))
+		require.Equal(t, 0, v.Cmp(value), "%s decoded as %s", v, value)
+	}
+
+	data, err := m.Encode(pgtype.NumericOID, pgtype.BinaryFormatCode, numeric(nil), nil)
+	require.NoError(t, err)
+	require.Nil(t, data)
+
+	require.Equal(t, []pgtype.Numeric{numeric(twoTo255), {}}, numerics([]*big.Int{twoTo255, nil}))
+}
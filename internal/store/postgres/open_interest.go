@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// applyOpenInterest completes a statement whose last CTE, "changes",
+// returns condition_id, delta, block_number and is_root_collection: it adds
+// each root collection delta to open_interest. The statement returns a row
+// per update clamped at zero, so its command tag counts them.
+const applyOpenInterest = `,
+	applied AS (
+		SELECT apply_open_interest(condition_id, delta, block_number) AS clamped
+		FROM changes
+		WHERE is_root_collection
+	)
+	SELECT 1 FROM applied WHERE clamped > 0
+`
+
+// upsertedOpenInterestChanges completes a statement whose CTEs "previous" and
+// "upserted" return the stored and the upserted condition_id, delta,
+// block_number and is_root_collection of an event row, the upsert returning
+// nothing when the row was stored with the same values. A corrected row takes
+// its stored delta back; deltas are summed per condition first, so a
+// correction is applied at once and clamps only if its net change does.
+const upsertedOpenInterestChanges = `,
+	changes AS (
+		SELECT condition_id, SUM(delta) AS delta, MAX(block_number) AS block_number, is_root_collection
+		FROM (
+			SELECT condition_id, delta, block_number, is_root_collection FROM upserted
+			UNION ALL
+			SELECT condition_id, -delta, block_number, is_root_collection FROM previous
+			WHERE EXISTS (SELECT 1 FROM upserted)
+		) deltas
+		GROUP BY condition_id, is_root_collection
+	)` + applyOpenInterest
+
+// observeOpenInterest returns the observer of a statement ending with
+// applyOpenInterest. Clamped updates mean events are missing or were stored
+// out of order; open interest stays at zero until the next split and can be
+// recomputed with "migrate rebuild-open-interest".
+func observeOpenInterest(eventType string, event models.Event, logger zerolog.Logger) func(pgconn.CommandTag) {
+	return func(tag pgconn.CommandTag) {
+		clamped := tag.RowsAffected()
+		if clamped == 0 {
+			return
+		}
+		consumer.OpenInterestClamped.WithLabelValues(eventType).Add(float64(clamped))
+		logger.Warn().
+			Str("event_type", eventType).
+			Str("tx_hash", event.TxHash).
+			Uint("log_index", event.LogIndex).
+			Bool("removed", !event.Success).
+			Msg("open interest would go negative, clamped at zero")
+	}
+}
@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+)
+
+// TestObserveOpenInterest tests that every clamped update is counted and
+// that statements clamping nothing are not.
+func TestObserveOpenInterest(t *testing.T) {
+	counter := consumer.OpenInterestClamped.WithLabelValues(events.PositionsMerge)
+	before := testutil.ToFloat64(counter)
+
+	observe := observeOpenInterest(events.PositionsMerge, storetest.PositionEvent(events.PositionsMerge, 1, 5, false), zerolog.Nop())
+	observe(pgconn.NewCommandTag("SELECT 0"))
+	require.Equal(t, before, testutil.ToFloat64(counter))
+	observe(pgconn.NewCommandTag("SELECT 1"))
+	require.Equal(t, before+1, testutil.ToFloat64(counter))
+}
+
+// TestReversalsPayoutRedemption tests that a removed redemption puts its
+// payout back into open interest in the statement deleting it.
+func TestReversalsPayoutRedemption(t *testing.T) {
+	reversals, err := newTestStore().Reversals(events.PayoutRedemption, storetest.PositionEvent(events.PayoutRedemption, 1, 5, false))
+	require.NoError(t, err)
+	require.Len(t, reversals, 3)
+	require.Contains(t, reversals[0].Query, "DELETE FROM payout_redemptions")
+	require.Contains(t, reversals[0].Query, "payout AS delta")
+	require.NotNil(t, reversals[0].Observe)
+	require.Contains(t, reversals[2].Query, "DELETE FROM events")
+}
@@ -0,0 +1,194 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// RevertEvent removes or resets the rows written for a log that was later
+// removed from the canonical chain by a reorg.
+func (s *Store) RevertEvent(ctx context.Context, eventType string, event models.Event) error {
+	reversals, err := s.Reversals(eventType, event)
+	if err != nil {
+		return fmt.Errorf("failed to build reversal: %w", err)
+	}
+
+	for _, r := range reversals {
+		if err := execObserved(ctx, s.db, r.Observe, r.Query, r.Args...); err != nil {
+			return fmt.Errorf("failed to revert event: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Reversals returns the statements that undo an event, parsed tables
+// first and the raw events row last so a partial failure is retried cleanly.
+// Derived tables are updated in the statement removing their rows. Rows are
+// only removed while the raw event stored is that of the reorged block (see
+// fromReorgedBlock).
+func (s *Store) Reversals(eventType string, event models.Event) ([]Statement, error) {
+	byLog := []any{event.TxHash, event.LogIndex, event.BlockHash}
+	reorged := fromReorgedBlock(1, 2, 3)
+
+	var reversals []Statement
+	switch eventType {
+	case events.OrderFilled:
+		reversals = append(reversals, Statement{
+			Query: `DELETE FROM order_fills WHERE transaction_hash = $1 AND log_index = $2 AND ` + reorged,
+			Args:  byLog,
+		}, Statement{
+			Query: `DELETE FROM trades WHERE transaction_hash = $1 AND log_index = $2 AND ` + reorged,
+			Args:  byLog,
+		})
+
+		order, err := consumer.PayloadAs[models.OrderFilled](event)
+		if err != nil {
+			return nil, err
+		}
+		if trade, ok := s.cfg.deriveTrade(order, event.ContractAddr); ok {
+			reversals = append(reversals, s.cfg.candleReversals(trade.TokenID, event.Timestamp)...)
+		}
+	case events.TokenRegistered:
+		reversals = append(reversals, Statement{
+			Query: `DELETE FROM token_registrations WHERE transaction_hash = $1 AND log_index = $2 AND ` + reorged,
+			Args:  byLog,
+		}, Statement{
+			Query: `DELETE FROM tokens WHERE transaction_hash = $1 AND log_index = $2 AND ` + reorged,
+			Args:  byLog,
+		})
+	case events.TransferSingle, events.TransferBatch:
+		// Removed transfers are applied to balances in reverse
+		reversals = append(reversals, Statement{
+			Query: `
+				WITH transfers AS (
+					DELETE FROM token_transfers WHERE transaction_hash = $1 AND log_index = $2 AND ` + reorged + `
+					RETURNING to_address AS from_address, from_address AS to_address, token_id, amount, block_number
+				)` + applyTransferBalances,
+			Args: byLog,
+		})
+	case events.ERC20Transfer:
+		reversals = append(reversals, Statement{
+			Query: `DELETE FROM collateral_transfers WHERE transaction_hash = $1 AND log_index = $2 AND ` + reorged,
+			Args:  byLog,
+		})
+	case events.PositionSplit, events.PositionsMerge, events.PayoutRedemption:
+		// Removed events are applied to open interest in reverse
+		table, delta := "position_splits", "-amount"
+		switch eventType {
+		case events.PositionsMerge:
+			table, delta = "position_merges", "amount"
+		case events.PayoutRedemption:
+			table, delta = "payout_redemptions", "payout"
+		}
+		reversals = append(reversals, Statement{
+			Query: `
+				WITH changes AS (
+					DELETE FROM ` + table + ` WHERE transaction_hash = $1 AND log_index = $2 AND ` + reorged + `
+					RETURNING condition_id, ` + delta + ` AS delta, block_number, is_root_collection
+				)` + applyOpenInterest,
+			Args:    byLog,
+			Observe: observeOpenInterest(eventType, event, s.logger),
+		})
+	case events.ConditionPreparation:
+		condition, err := consumer.PayloadAs[models.ConditionPreparation](event)
+		if err != nil {
+			return nil, err
+		}
+		reversals = append(reversals, Statement{
+			Query: `DELETE FROM conditions WHERE condition_id = $1 AND transaction_hash = $2 AND ` + fromReorgedBlock(2, 3, 4),
+			Args:  []any{models.NormalizeHash(condition.ConditionID), event.TxHash, event.LogIndex, event.BlockHash},
+		})
+	case events.ConditionResolution:
+		resolution, err := consumer.PayloadAs[models.ConditionResolution](event)
+		if err != nil {
+			return nil, err
+		}
+		// The condition itself still exists: it goes back to the latest
+		// resolution left, or to unresolved
+		conditionID := models.NormalizeHash(resolution.ConditionID)
+		reversals = append(reversals, Statement{
+			Query: `DELETE FROM condition_resolutions WHERE transaction_hash = $1 AND log_index = $2 AND ` + reorged,
+			Args:  byLog,
+		}, Statement{
+			Query: `
+				UPDATE conditions c
+				SET resolved = r.transaction_hash IS NOT NULL,
+				    payout_numerators = r.payout_numerators,
+				    resolution_block = r.block_number,
+				    resolution_timestamp = r.block_timestamp,
+				    resolution_tx = r.transaction_hash,
+				    holders_snapshot_pending = c.holders_snapshot_pending AND r.transaction_hash IS NOT NULL
+				FROM (SELECT 1) one
+				LEFT JOIN LATERAL (
+					SELECT payout_numerators, block_number, block_timestamp, transaction_hash
+					FROM condition_resolutions
+					WHERE condition_id = $1
+					ORDER BY block_number DESC, log_index DESC
+					LIMIT 1
+				) r ON true
+				WHERE c.condition_id = $1 AND c.resolution_tx = $2
+			`,
+			Args: []any{conditionID, event.TxHash},
+		}, Statement{
+			// The row the resolution created if it arrived before the
+			// preparation
+			Query: `DELETE FROM conditions WHERE condition_id = $1 AND transaction_hash IS NULL AND NOT resolved`,
+			Args:  []any{conditionID},
+		}, Statement{
+			// The holders snapshotted when it was stored
+			Query: `
+				DELETE FROM holder_snapshots
+				WHERE condition_id = $1
+				  AND NOT EXISTS (SELECT 1 FROM conditions WHERE condition_id = $1 AND resolved)
+			`,
+			Args: []any{conditionID},
+		})
+	}
+
+	if store.PositionEvents[eventType] {
+		reversals = append(reversals, Statement{Query: revertPositionChanges + ` WHERE ` + reorged, Args: byLog})
+	}
+
+	reversals = append(reversals, Statement{
+		Query: `DELETE FROM events WHERE transaction_hash = $1 AND log_index = $2 AND block_hash = $3 AND event_name = $4`,
+		Args:  []any{event.TxHash, event.LogIndex, event.BlockHash, event.EventName},
+	})
+
+	return reversals, nil
+}
+
+// fromReorgedBlock returns the condition, on the statement parameters
+// holding the transaction hash, log index and block hash of a removed log,
+// that its raw event is stored from that block. A copy of the log
+// re-included in another block and stored since is kept when a reversal is
+// redelivered after it.
+func fromReorgedBlock(txHash, logIndex, blockHash int) string {
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM events
+		WHERE transaction_hash = $%d AND log_index = $%d AND block_hash = $%d
+	)`, txHash, logIndex, blockHash)
+}
+
+// storedTransferKind returns the transfer kind to store, classifying events
+// published before the indexer attached one.
+func storedTransferKind(kind, from, to string) string {
+	if kind != "" {
+		return kind
+	}
+	return models.ClassifyTransfer(from, to)
+}
+
+// nullIfEmpty returns nil for empty strings so they are stored as NULL.
+// Events published before a field existed decode it as "".
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestReversalsDeletesParsedRows tests that a removed log deletes its
+// parsed row and raw event by (tx_hash, log_index), from its block only.
+func TestReversalsDeletesParsedRows(t *testing.T) {
+	event := models.Event{
+		TxHash:    "0xabc",
+		LogIndex:  7,
+		BlockHash: "0xb1",
+		EventName: "OrderFilled",
+		Success:   false,
+		Payload:   models.OrderFilled{OrderHash: "0x01", MakerAssetID: big.NewInt(1)},
+	}
+
+	reversals, err := newTestStore().Reversals("OrderFilled", event)
+	require.NoError(t, err)
+	require.Len(t, reversals, 4)
+
+	require.Contains(t, reversals[0].Query, "DELETE FROM order_fills")
+	require.Contains(t, reversals[0].Query, "block_hash = $3")
+	require.Equal(t, []any{"0xabc", uint(7), "0xb1"}, reversals[0].Args)
+	require.Contains(t, reversals[1].Query, "DELETE FROM trades")
+	require.Contains(t, reversals[2].Query, revertPositionChanges)
+	require.Contains(t, reversals[2].Query, "block_hash = $3")
+
+	// Raw event is always removed last
+	require.Contains(t, reversals[3].Query, "DELETE FROM events")
+	require.Contains(t, reversals[3].Query, "block_hash = $3 AND event_name = $4")
+	require.Equal(t, []any{"0xabc", uint(7), "0xb1", "OrderFilled"}, reversals[3].Args)
+}
+
+// TestReversalsTransferBatch tests that all rows of a batch transfer
+// are removed together.
+func TestReversalsTransferBatch(t *testing.T) {
+	event := models.Event{TxHash: "0xdef", LogIndex: 3}
+
+	reversals, err := newTestStore().Reversals("TransferBatch", event)
+	require.NoError(t, err)
+	require.Len(t, reversals, 3)
+	require.Contains(t, reversals[0].Query, "DELETE FROM token_transfers")
+}
+
+// TestReversalsTokenRegistered tests that a reorged registration also
+// removes the derived token rows.
+func TestReversalsTokenRegistered(t *testing.T) {
+	event := models.Event{TxHash: "0xdef", LogIndex: 4, BlockHash: "0xb1"}
+
+	reversals, err := newTestStore().Reversals("TokenRegistered", event)
+	require.NoError(t, err)
+	require.Len(t, reversals, 3)
+	require.Contains(t, reversals[0].Query, "DELETE FROM token_registrations")
+	require.Contains(t, reversals[1].Query, "DELETE FROM tokens")
+	require.Equal(t, []any{"0xdef", uint(4), "0xb1"}, reversals[1].Args)
+}
+
+// TestReversalsConditionResolution tests that a reorged resolution
+// is removed from the history and its condition returned to the resolution
+// left instead of being deleted, and that the holders snapshotted for it
+// are removed.
+func TestReversalsConditionResolution(t *testing.T) {
+	event := models.Event{
+		TxHash:    "0x123",
+		LogIndex:  1,
+		BlockHash: "0xb1",
+		Payload: models.ConditionResolution{
+			ConditionID:      "0xcond",
+			PayoutNumerators: []*big.Int{big.NewInt(1), big.NewInt(0)},
+		},
+	}
+
+	reversals, err := newTestStore().Reversals("ConditionResolution", event)
+	require.NoError(t, err)
+	require.Len(t, reversals, 5)
+
+	history := reversals[0]
+	require.Contains(t, history.Query, "DELETE FROM condition_resolutions")
+	require.Equal(t, []any{"0x123", uint(1), "0xb1"}, history.Args)
+
+	update := reversals[1]
+	require.Contains(t, update.Query, "UPDATE conditions")
+	require.Contains(t, update.Query, "FROM condition_resolutions")
+	require.Equal(t, []any{"0xcond", "0x123"}, update.Args)
+
+	// A condition only the resolution created is removed with it
+	placeholder := reversals[2]
+	require.Contains(t, placeholder.Query, "DELETE FROM conditions")
+	require.Contains(t, placeholder.Query, "transaction_hash IS NULL")
+	require.Equal(t, []any{"0xcond"}, placeholder.Args)
+
+	holders := reversals[3]
+	require.Contains(t, holders.Query, "DELETE FROM holder_snapshots")
+	require.Contains(t, holders.Query, "AND resolved")
+	require.Equal(t, []any{"0xcond"}, holders.Args)
+}
+
+// TestReversalsUnknownEvent tests that unknown events only remove the
+// raw event row.
+func TestReversalsUnknownEvent(t *testing.T) {
+	reversals, err := newTestStore().Reversals("Unknown", models.Event{TxHash: "0x1"})
+	require.NoError(t, err)
+	require.Len(t, reversals, 1)
+	require.Contains(t, reversals[0].Query, "DELETE FROM events")
+}
+
+// TestConditionPayloadOutcomeSlotCount tests that condition payloads decode
+// both the old uint8-range outcome_slot_count and values above 255.
+func TestConditionPayloadOutcomeSlotCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{
+			name:    "old payload",
+			payload: `{"condition_id":"0xcond","oracle":"0x01","question_id":"0x02","outcome_slot_count":2}`,
+		},
+		{
+			name:    "wide payload",
+			payload: `{"condition_id":"0xcond","oracle":"0x01","question_id":"0x02","outcome_slot_count":256}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Payloads arrive from NATS as generic JSON values
+			var payload map[string]any
+			require.NoError(t, json.Unmarshal([]byte(tt.payload), &payload))
+
+			event := models.Event{TxHash: "0xabc", LogIndex: 1, BlockHash: "0xb1", Payload: payload}
+			reversals, err := newTestStore().Reversals("ConditionPreparation", event)
+			require.NoError(t, err)
+			require.Equal(t, []any{"0xcond", "0xabc", uint(1), "0xb1"}, reversals[0].Args)
+		})
+	}
+
+	// A uint8 field would reject 256 outright
+	var condition models.ConditionPreparation
+	require.NoError(t, json.Unmarshal([]byte(tests[1].payload), &condition))
+	require.Equal(t, uint32(256), condition.OutcomeSlotCount)
+}
+
+// TestReversalsTransferRestoresBalances tests that a removed transfer is
+// applied to balances from its recipient back to its sender.
+func TestReversalsTransferRestoresBalances(t *testing.T) {
+	reversals, err := newTestStore().Reversals(events.TransferSingle, models.Event{TxHash: "0xdef", LogIndex: 3})
+	require.NoError(t, err)
+	require.Contains(t, reversals[0].Query, "to_address AS from_address, from_address AS to_address")
+	require.Contains(t, reversals[0].Query, "INSERT INTO balances")
+}
@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+)
+
+// Statement is a single SQL statement with its arguments.
+type Statement struct {
+	Query string
+	Args  []any
+
+	// Observe, if set, receives the statement's command tag once the
+	// transaction it ran in committed
+	Observe func(pgconn.CommandTag)
+
+	// Rows, if set, is the number of rows the statement writes when none
+	// is stored, counted by its command tag (see consumer.ObserveRows)
+	Rows int
+}
+
+// Execer executes a statement (implemented by pgxpool.Pool, pgx.Tx and
+// Recorder).
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Beginner starts a transaction (implemented by pgxpool.Pool and pgx.Tx).
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Recorder records the statements a Store executes, so they can be queued
+// on a batch instead of run one by one. None of the Store methods read
+// results, so recording does not change what they write.
+type Recorder struct {
+	Statements []Statement
+}
+
+func (r *Recorder) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	r.Statements = append(r.Statements, Statement{Query: sql, Args: args})
+	return pgconn.CommandTag{}, nil
+}
+
+// execObserved executes a statement and passes its command tag to observe
+// once it is committed: when the flush commits if db is a Recorder, right
+// away otherwise. Store methods use it for metrics that depend on what a
+// statement changed. A nil observe is allowed.
+func execObserved(ctx context.Context, db Execer, observe func(pgconn.CommandTag), sql string, args ...any) error {
+	if r, ok := db.(*Recorder); ok {
+		r.Statements = append(r.Statements, Statement{Query: sql, Args: args, Observe: observe})
+		return nil
+	}
+	tag, err := db.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if observe != nil {
+		observe(tag)
+	}
+	return nil
+}
+
+// execRows executes a statement writing rows rows of a table, whose
+// command tag counts the rows it wrote, and counts them once committed.
+// Single-row INSERT statements are counted without it.
+func execRows(ctx context.Context, db Execer, rows int, sql string, args ...any) error {
+	if r, ok := db.(*Recorder); ok {
+		r.Statements = append(r.Statements, Statement{Query: sql, Args: args, Rows: rows})
+		return nil
+	}
+	tag, err := db.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	consumer.ObserveRows(sql, tag, rows)
+	return nil
+}
@@ -0,0 +1,224 @@
+// Package postgres is the store.Store writing consumed events to
+// TimescaleDB: the raw events, their parsed tables, and the tables derived
+// from them (trades, candles, balances, open interest, wallet positions).
+//
+// Every statement is idempotent, so an event stored twice, a redelivery,
+// writes its rows once, and a re-published correction updates them in
+// place. The consumer stores events over a Recorder and sends the recorded
+// statements in one transaction per batch.
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+
+	"github.com/0xkanth/polymarket-indexer/internal/consumer"
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// DefaultCandleIntervals are the bucket widths candles are maintained for
+// when consumer.candle_intervals is not set.
+var DefaultCandleIntervals = []time.Duration{time.Minute, time.Hour}
+
+// Config is the consumer configuration the stored rows depend on.
+type Config struct {
+	// CollateralToken backs the positions registered on the exchange. It is
+	// used to derive outcome indexes for the tokens table; zero disables
+	// derivation (consumer.collateral_token).
+	CollateralToken common.Address
+
+	// Exchanges are the normalized addresses of the exchanges that appear
+	// as the taker of the fill emitted for the taker order of a match
+	// (consumer.exchange_addresses). The exchange emitting a fill is always
+	// recognized.
+	Exchanges map[string]bool
+
+	// CandleIntervals are the bucket widths candles are maintained for
+	// (consumer.candle_intervals); none disables candles.
+	CandleIntervals []time.Duration
+
+	// OnPrepared and OnResolved, if set, observe the statements storing a
+	// condition preparation and resolution once they are committed.
+	OnPrepared func(pgconn.CommandTag)
+	OnResolved func(pgconn.CommandTag)
+}
+
+// Store is the store.Store writing events to TimescaleDB through db.
+type Store struct {
+	db     Execer
+	cfg    Config
+	logger zerolog.Logger
+}
+
+var _ store.Store = (*Store)(nil)
+
+// New returns a Store executing its statements on db: a pool or a
+// transaction, or a Recorder collecting them for a batch.
+func New(db Execer, cfg Config, logger zerolog.Logger) *Store {
+	return &Store{db: db, cfg: cfg, logger: logger}
+}
+
+// WithTx runs fn on a Store writing in a transaction of db, committed once
+// fn returns nil and rolled back otherwise. The statements of a Store over
+// a Recorder are written in one transaction by the batch sending them, so
+// fn runs on the Store itself.
+func (s *Store) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	db, ok := s.db.(Beginner)
+	if !ok {
+		return fn(s)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // No-op once committed
+
+	if err := fn(New(tx, s.cfg, s.logger)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// insertRawEvent stores the raw event. Like every hypertable, events is
+// unique on the log and its block timestamp, and on the event name as well
+// since a log fanned out to several handlers has one event per handler (see
+// internal/store/migrations).
+const insertRawEvent = `
+	INSERT INTO events (
+		block_number, block_hash, block_timestamp, transaction_hash, log_index,
+		contract_address, event_signature, event_name, payload
+	) VALUES ($1, $2, to_timestamp($3), $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (transaction_hash, log_index, event_name, block_timestamp) DO NOTHING
+`
+
+// ObserveDuplicate returns the flag set once the statements of an event
+// commit if its raw event insert wrote no row: the event was stored by an
+// earlier delivery. Its other statements still run in the same transaction
+// and change nothing, as each derived update only applies the rows its
+// statement inserted or changed (the previous/upserted CTEs, and
+// record_position_changes comparing the ledger rows), so a redelivery is
+// applied once while a re-published correction is still applied.
+func ObserveDuplicate(statements []Statement) *bool {
+	duplicate := new(bool)
+	for i := range statements {
+		if statements[i].Query == insertRawEvent {
+			statements[i].Observe = func(tag pgconn.CommandTag) {
+				*duplicate = tag.RowsAffected() == 0
+			}
+		}
+	}
+	return duplicate
+}
+
+// StoreRawEvent stores the raw event in the events table.
+func (s *Store) StoreRawEvent(ctx context.Context, event models.Event) error {
+	payloadJSON, err := json.Marshal(event.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	_, err = s.db.Exec(ctx, insertRawEvent,
+		event.Block,
+		event.BlockHash,
+		event.Timestamp,
+		event.TxHash,
+		event.LogIndex,
+		event.ContractAddr,
+		event.EventSig,
+		event.EventName,
+		payloadJSON,
+	)
+
+	return err
+}
+
+// MarkProcessed flags the raw event as fully stored. It runs in the
+// transaction writing the parsed rows, so raw events left unprocessed by
+// earlier versions are found by reconciliation queries and fixed on
+// redelivery.
+func (s *Store) MarkProcessed(ctx context.Context, event models.Event) error {
+	query := `
+		UPDATE events SET processed = true
+		WHERE transaction_hash = $1 AND log_index = $2 AND event_name = $3 AND block_timestamp = to_timestamp($4)
+	`
+
+	if _, err := s.db.Exec(ctx, query, event.TxHash, event.LogIndex, event.EventName, event.Timestamp); err != nil {
+		return fmt.Errorf("failed to mark event processed: %w", err)
+	}
+	return nil
+}
+
+const (
+	// recordPositionChanges derives the ledger rows of a stored event and
+	// applies them to wallet_positions and realized_pnl (migration 010)
+	recordPositionChanges = `SELECT record_position_changes($1, $2, $3)`
+
+	// revertPositionChanges removes the ledger rows of an event and replays
+	// the positions they changed
+	revertPositionChanges = `SELECT revert_position_changes($1, $2)`
+)
+
+// RecordPositionChanges runs record_position_changes on the rows just
+// stored, leaving out transfers that settle fills.
+func (s *Store) RecordPositionChanges(ctx context.Context, event models.Event) error {
+	_, err := s.db.Exec(ctx, recordPositionChanges, event.TxHash, event.LogIndex, s.cfg.SettlementExchanges())
+	return err
+}
+
+// SettlementExchanges returns Exchanges in a stable order: token transfers
+// they operate settle fills and are not transfers between wallets.
+func (c Config) SettlementExchanges() []string {
+	exchanges := make([]string, 0, len(c.Exchanges))
+	for exchange := range c.Exchanges {
+		exchanges = append(exchanges, exchange)
+	}
+	sort.Strings(exchanges)
+	return exchanges
+}
+
+// quarantineEvent writes a malformed event to quarantined_events. A
+// redelivery of a message already quarantined writes nothing.
+const quarantineEvent = `
+	INSERT INTO quarantined_events (
+		subject, stream_sequence, event_type, reason, detail,
+		block_number, transaction_hash, log_index, event
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (stream_sequence) DO NOTHING
+`
+
+// Quarantine writes a malformed event to quarantined_events in place of its
+// rows, counted once committed.
+func (s *Store) Quarantine(ctx context.Context, q store.Quarantined) error {
+	var sequence any
+	if q.Sequence != nil {
+		sequence = *q.Sequence
+	}
+
+	return execObserved(ctx, s.db, func(tag pgconn.CommandTag) {
+		if tag.RowsAffected() > 0 {
+			consumer.EventsQuarantined.WithLabelValues(q.EventType, q.Reason).Inc()
+		}
+	}, quarantineEvent,
+		q.Subject,
+		sequence,
+		q.EventType,
+		q.Reason,
+		q.Detail,
+		q.Event.Block,
+		q.Event.TxHash,
+		q.Event.LogIndex,
+		q.Raw,
+	)
+}
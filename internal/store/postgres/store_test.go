@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+)
+
+// testConfig returns the configuration of a consumer left to its defaults.
+func testConfig() Config {
+	return Config{Exchanges: map[string]bool{}, CandleIntervals: DefaultCandleIntervals}
+}
+
+// newTestStore returns a Store recording its statements, with testConfig.
+func newTestStore() *Store {
+	return New(&Recorder{}, testConfig(), zerolog.Nop())
+}
+
+// recorded returns the statements recorded by a Store from newTestStore.
+func recorded(s *Store) []Statement {
+	return s.db.(*Recorder).Statements
+}
+
+// TestSettlementExchanges tests that the configured exchanges are passed in
+// a stable order.
+func TestSettlementExchanges(t *testing.T) {
+	cfg := Config{Exchanges: map[string]bool{storetest.NegRiskExchange: true, storetest.CTFExchange: true}}
+	require.Equal(t, []string{storetest.CTFExchange, storetest.NegRiskExchange}, cfg.SettlementExchanges())
+}
+
+// TestStoreEventRecordsPositionChanges tests that position events record
+// their ledger rows after their parsed rows and that other events do not.
+func TestStoreEventRecordsPositionChanges(t *testing.T) {
+	s := newTestStore()
+	event := storetest.TransferEvent(3, storetest.WalletA, storetest.WalletB, 77, 5)
+	require.NoError(t, store.StoreEvent(context.Background(), s, events.TransferSingle, event))
+
+	statements := recorded(s)
+	changes := statements[len(statements)-2]
+	require.Equal(t, recordPositionChanges, changes.Query)
+	require.Equal(t, []any{event.TxHash, uint(3), []string{}}, changes.Args)
+
+	s = newTestStore()
+	require.NoError(t, store.StoreEvent(context.Background(), s, events.ConditionResolution, storetest.ResolutionEvent(0)))
+	for _, statement := range recorded(s) {
+		require.NotEqual(t, recordPositionChanges, statement.Query)
+	}
+}
+
+// TestWithTxOverRecorder tests that a Store recording its statements runs
+// the transaction on itself, leaving the batch to send them together.
+func TestWithTxOverRecorder(t *testing.T) {
+	s := newTestStore()
+	require.NoError(t, s.WithTx(context.Background(), func(tx store.Store) error {
+		require.Same(t, s, tx)
+		return tx.MarkProcessed(context.Background(), storetest.ResolutionEvent(0))
+	}))
+	require.Len(t, recorded(s), 1)
+}
+
+// TestQuarantine tests that a quarantined event is written with its stream
+// sequence, or NULL when it is unknown, and counted once committed.
+func TestQuarantine(t *testing.T) {
+	sequence := uint64(42)
+	q := store.Quarantined{
+		Subject:   "POLYMARKET.TransferBatch.0xab",
+		Sequence:  &sequence,
+		EventType: events.TransferBatch,
+		Reason:    "length_mismatch",
+		Detail:    "2 token_ids and 1 amounts",
+		Event:     storetest.TransferBatchEvent(2),
+		Raw:       []byte(`{}`),
+	}
+
+	s := newTestStore()
+	require.NoError(t, s.Quarantine(context.Background(), q))
+	q.Sequence = nil
+	require.NoError(t, s.Quarantine(context.Background(), q))
+
+	statements := recorded(s)
+	require.Len(t, statements, 2)
+	require.Equal(t, quarantineEvent, statements[0].Query)
+	require.Equal(t, []any{q.Subject, uint64(42), q.EventType, q.Reason, q.Detail, uint64(100), storetest.TxHash, uint(0), q.Raw}, statements[0].Args)
+	require.Nil(t, statements[1].Args[1])
+	require.NotNil(t, statements[0].Observe)
+}
@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"math/big"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// tradeDecimals are the decimals of both the collateral (USDC) and the
+// outcome tokens, and of the derived amounts.
+const tradeDecimals = 6
+
+// tradeUnit is one whole collateral unit or share in base units.
+var tradeUnit = new(big.Rat).SetInt64(1_000_000)
+
+// trade is an OrderFilled exchanging collateral for an outcome token, with
+// amounts in whole units.
+type trade struct {
+	TokenID        *big.Int
+	Side           string // buy or sell, from the maker's perspective
+	Price          string // collateral per share
+	Size           string // shares
+	Notional       string // collateral
+	Fee            string
+	IsOperatorFill bool
+}
+
+// deriveTrade returns the trade of a fill emitted by exchange. Asset ID 0 is
+// the collateral; fills exchanging two outcome tokens, or none of them, are
+// not trades.
+func (c Config) deriveTrade(fill models.OrderFilled, exchange string) (trade, bool) {
+	if fill.MakerAssetID == nil || fill.TakerAssetID == nil || fill.MakerAmountFilled == nil || fill.TakerAmountFilled == nil {
+		return trade{}, false
+	}
+
+	var t trade
+	var collateral, shares *big.Int
+	switch {
+	case fill.MakerAssetID.Sign() == 0 && fill.TakerAssetID.Sign() != 0:
+		// Maker pays collateral for outcome tokens
+		t.Side, t.TokenID = models.OrderSideBuy, fill.TakerAssetID
+		collateral, shares = fill.MakerAmountFilled, fill.TakerAmountFilled
+	case fill.TakerAssetID.Sign() == 0 && fill.MakerAssetID.Sign() != 0:
+		// Maker gives outcome tokens for collateral
+		t.Side, t.TokenID = models.OrderSideSell, fill.MakerAssetID
+		collateral, shares = fill.TakerAmountFilled, fill.MakerAmountFilled
+	default:
+		return trade{}, false
+	}
+	if shares.Sign() == 0 {
+		return trade{}, false
+	}
+
+	// Both amounts have the same decimals, so their ratio is the price
+	t.Price = new(big.Rat).SetFrac(collateral, shares).FloatString(tradeDecimals)
+	t.Size = wholeUnits(shares)
+	t.Notional = wholeUnits(collateral)
+	t.Fee = wholeUnits(fill.Fee)
+
+	taker := models.NormalizeAddress(fill.Taker)
+	t.IsOperatorFill = taker == models.NormalizeAddress(exchange) || c.Exchanges[taker]
+	return t, true
+}
+
+// wholeUnits converts an amount in base units to whole units.
+func wholeUnits(amount *big.Int) string {
+	if amount == nil {
+		return "0"
+	}
+	return new(big.Rat).Quo(new(big.Rat).SetInt(amount), tradeUnit).FloatString(tradeDecimals)
+}
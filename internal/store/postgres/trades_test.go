@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestDeriveTrade tests the token, side, price and amounts derived from
+// fills in both directions, with amounts in the 6-decimal base units the
+// exchange emits, and which fills are not trades.
+func TestDeriveTrade(t *testing.T) {
+	token, _ := new(big.Int).SetString("21742633143463906290569050155826241533067272736897614950488156847949938836455", 10)
+
+	fill := func(makerAsset, takerAsset *big.Int, makerAmount, takerAmount int64) models.OrderFilled {
+		return models.OrderFilled{
+			OrderHash:         "0x" + "0a",
+			Maker:             "0x1111111111111111111111111111111111111111",
+			Taker:             "0x2222222222222222222222222222222222222222",
+			MakerAssetID:      makerAsset,
+			TakerAssetID:      takerAsset,
+			MakerAmountFilled: big.NewInt(makerAmount),
+			TakerAmountFilled: big.NewInt(takerAmount),
+			Fee:               big.NewInt(0),
+		}
+	}
+	collateral := big.NewInt(0)
+
+	tests := []struct {
+		name  string
+		fill  models.OrderFilled
+		trade trade
+	}{
+		{
+			name: "maker buys shares",
+			fill: fill(collateral, token, 52_000_000, 100_000_000),
+			trade: trade{
+				TokenID: token, Side: models.OrderSideBuy,
+				Price: "0.520000", Size: "100.000000", Notional: "52.000000", Fee: "0.000000",
+			},
+		},
+		{
+			name: "maker sells shares",
+			fill: fill(token, collateral, 30_000_000, 12_345_678),
+			trade: trade{
+				TokenID: token, Side: models.OrderSideSell,
+				Price: "0.411523", Size: "30.000000", Notional: "12.345678", Fee: "0.000000",
+			},
+		},
+		{
+			name: "fractional shares",
+			fill: fill(collateral, token, 1_234_567, 1_371_741),
+			trade: trade{
+				TokenID: token, Side: models.OrderSideBuy,
+				Price: "0.900000", Size: "1.371741", Notional: "1.234567", Fee: "0.000000",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := testConfig().deriveTrade(tt.fill, storetest.CTFExchange)
+			require.True(t, ok)
+			require.Equal(t, tt.trade, got)
+		})
+	}
+
+	withFee := fill(token, collateral, 10_000_000, 6_000_000)
+	withFee.Fee = big.NewInt(120_000)
+	got, ok := testConfig().deriveTrade(withFee, storetest.CTFExchange)
+	require.True(t, ok)
+	require.Equal(t, "0.120000", got.Fee)
+
+	for name, f := range map[string]models.OrderFilled{
+		"two outcome tokens": fill(token, big.NewInt(7), 1_000_000, 1_000_000),
+		"two collaterals":    fill(collateral, collateral, 1_000_000, 1_000_000),
+		"no shares":          fill(collateral, token, 1_000_000, 0),
+	} {
+		_, ok := testConfig().deriveTrade(f, storetest.CTFExchange)
+		require.False(t, ok, name)
+	}
+}
+
+// TestDeriveTradeOperatorFill tests that fills whose taker is the emitting
+// exchange or a configured exchange are flagged as the operator leg.
+func TestDeriveTradeOperatorFill(t *testing.T) {
+	cfg := Config{Exchanges: map[string]bool{storetest.NegRiskExchange: true}}
+
+	fill := models.OrderFilled{
+		Maker:             "0x1111111111111111111111111111111111111111",
+		MakerAssetID:      big.NewInt(0),
+		TakerAssetID:      big.NewInt(1),
+		MakerAmountFilled: big.NewInt(1_000_000),
+		TakerAmountFilled: big.NewInt(2_000_000),
+		Fee:               big.NewInt(0),
+	}
+
+	for taker, operator := range map[string]bool{
+		"0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E": true,
+		"0xC5d563A36AE78145C45a50134d48A1215220f80a": true,
+		"0x2222222222222222222222222222222222222222": false,
+	} {
+		fill.Taker = taker
+		got, ok := cfg.deriveTrade(fill, storetest.CTFExchange)
+		require.True(t, ok)
+		require.Equal(t, operator, got.IsOperatorFill, taker)
+	}
+}
@@ -0,0 +1,310 @@
+// Package retention manages the TimescaleDB retention and compression
+// policies of the consumer's hypertables from configuration, so they are
+// kept as code instead of hand-run SQL.
+//
+// Every configured table gets the policy of its duration: chunks older than
+// it are dropped (retention) or compressed (compression). A table configured
+// "forever" has its policy removed; tables that are not configured keep
+// whatever policy they have.
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// Policy kinds, the configuration block they are read from.
+const (
+	KindRetention   = "retention"
+	KindCompression = "compression"
+)
+
+// Forever disables a policy: chunks are kept, or left uncompressed.
+const Forever = "forever"
+
+// advisoryLockKey serializes policy updates across consumers starting
+// together.
+const advisoryLockKey = 0x706d6964787270 // "pmidxrp"
+
+// ErrNoTimescale is returned by Apply when the database does not have the
+// timescaledb extension, which has no policies to manage.
+var ErrNoTimescale = errors.New("timescaledb extension not installed")
+
+// Policy is the retention or compression policy of a hypertable.
+type Policy struct {
+	Kind  string
+	Table string
+	// After is the age of the chunks dropped or compressed; 0 removes the
+	// policy
+	After time.Duration
+}
+
+// jobs maps policy kinds to their TimescaleDB job and its age setting.
+var jobs = map[string]struct {
+	proc   string
+	config string
+	add    string
+	remove string
+}{
+	KindRetention: {
+		proc:   "policy_retention",
+		config: "drop_after",
+		add:    `SELECT add_retention_policy($1::REGCLASS, drop_after => make_interval(secs => $2))`,
+		remove: `SELECT remove_retention_policy($1::REGCLASS, if_exists => true)`,
+	},
+	KindCompression: {
+		proc:   "policy_compression",
+		config: "compress_after",
+		add:    `SELECT add_compression_policy($1::REGCLASS, compress_after => make_interval(secs => $2))`,
+		remove: `SELECT remove_compression_policy($1::REGCLASS, if_exists => true)`,
+	},
+}
+
+// ParseDuration parses a policy duration: a number of days ("90d"), a Go
+// duration ("168h") or "forever" (0).
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, Forever) {
+		return 0, nil
+	}
+
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid duration %q (expected e.g. \"90d\", \"168h\" or %q)", s, Forever)
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q: must be positive (use %q to keep chunks)", s, Forever)
+	}
+	return d, nil
+}
+
+// FormatDuration formats a policy duration in days when it is whole days.
+func FormatDuration(d time.Duration) string {
+	switch {
+	case d == 0:
+		return Forever
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	default:
+		return d.String()
+	}
+}
+
+// Parse reads the policies of a configuration block mapping tables to
+// durations, in table order.
+func Parse(kind string, tables map[string]string) ([]Policy, error) {
+	if _, ok := jobs[kind]; !ok {
+		return nil, fmt.Errorf("unknown policy kind %q", kind)
+	}
+
+	policies := make([]Policy, 0, len(tables))
+	for table, value := range tables {
+		after, err := ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", kind, table, err)
+		}
+		policies = append(policies, Policy{Kind: kind, Table: table, After: after})
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Table < policies[j].Table })
+	return policies, nil
+}
+
+// Apply creates, updates or removes policies so that the database matches
+// them, in one transaction. Policies already in place are left alone, so
+// applying the same policies again changes nothing. It returns the
+// policies it changed, or ErrNoTimescale on plain Postgres.
+func Apply(ctx context.Context, pool *pgxpool.Pool, policies []Policy) ([]Policy, error) {
+	var timescale bool
+	if err := pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')`,
+	).Scan(&timescale); err != nil {
+		return nil, fmt.Errorf("failed to check for timescaledb: %w", err)
+	}
+	if !timescale {
+		return nil, ErrNoTimescale
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", advisoryLockKey); err != nil {
+		return nil, fmt.Errorf("failed to acquire policy lock: %w", err)
+	}
+
+	var changed []Policy
+	for _, p := range policies {
+		ok, err := apply(ctx, tx, p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply %s policy of %s: %w", p.Kind, p.Table, err)
+		}
+		if ok {
+			changed = append(changed, p)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit policies: %w", err)
+	}
+	return changed, nil
+}
+
+// apply brings one policy in place and reports whether it changed.
+func apply(ctx context.Context, tx pgx.Tx, p Policy) (bool, error) {
+	job, ok := jobs[p.Kind]
+	if !ok {
+		return false, fmt.Errorf("unknown policy kind %q", p.Kind)
+	}
+
+	var compressionEnabled bool
+	err := tx.QueryRow(ctx, `
+		SELECT compression_enabled FROM timescaledb_information.hypertables
+		WHERE hypertable_schema = current_schema() AND hypertable_name = $1
+	`, p.Table).Scan(&compressionEnabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, fmt.Errorf("%s is not a hypertable", p.Table)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read hypertable: %w", err)
+	}
+
+	current, err := currentAfter(ctx, tx, p.Table, job.proc, job.config)
+	if err != nil {
+		return false, err
+	}
+	if current == p.After {
+		return false, nil
+	}
+
+	if current != 0 {
+		if _, err := tx.Exec(ctx, job.remove, p.Table); err != nil {
+			return false, fmt.Errorf("failed to remove policy: %w", err)
+		}
+	}
+	if p.After == 0 {
+		return true, nil
+	}
+
+	// Chunks are only compressed once the hypertable allows it; it is never
+	// turned off again, as that fails while compressed chunks exist
+	if p.Kind == KindCompression && !compressionEnabled {
+		if _, err := tx.Exec(ctx, "ALTER TABLE "+pgx.Identifier{p.Table}.Sanitize()+" SET (timescaledb.compress)"); err != nil {
+			return false, fmt.Errorf("failed to enable compression: %w", err)
+		}
+	}
+	if _, err := tx.Exec(ctx, job.add, p.Table, p.After.Seconds()); err != nil {
+		return false, fmt.Errorf("failed to add policy: %w", err)
+	}
+	return true, nil
+}
+
+// currentAfter returns the age setting of a table's policy job, 0 when it
+// has none.
+func currentAfter(ctx context.Context, tx pgx.Tx, table, proc, config string) (time.Duration, error) {
+	var seconds int64
+	err := tx.QueryRow(ctx, `
+		SELECT EXTRACT(EPOCH FROM (config->>$3)::INTERVAL)::BIGINT
+		FROM timescaledb_information.jobs
+		WHERE proc_name = $2 AND hypertable_schema = current_schema() AND hypertable_name = $1
+		ORDER BY job_id LIMIT 1
+	`, table, proc, config).Scan(&seconds)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read policy: %w", err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// Effective returns the retention and compression policies of every
+// hypertable, in table order.
+func Effective(ctx context.Context, pool *pgxpool.Pool) ([]Policy, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT hypertable_name, proc_name,
+		       EXTRACT(EPOCH FROM COALESCE(config->>'drop_after', config->>'compress_after')::INTERVAL)::BIGINT
+		FROM timescaledb_information.jobs
+		WHERE proc_name IN ('policy_retention', 'policy_compression')
+		  AND hypertable_schema = current_schema()
+		ORDER BY hypertable_name, proc_name DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query policies: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []Policy
+	for rows.Next() {
+		var table, proc string
+		var seconds int64
+		if err := rows.Scan(&table, &proc, &seconds); err != nil {
+			return nil, fmt.Errorf("failed to scan policy: %w", err)
+		}
+		kind := KindRetention
+		if proc == jobs[KindCompression].proc {
+			kind = KindCompression
+		}
+		policies = append(policies, Policy{Kind: kind, Table: table, After: time.Duration(seconds) * time.Second})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read policies: %w", err)
+	}
+	return policies, nil
+}
+
+// Manage applies the configured policies at startup and logs the effective
+// ones. Databases without TimescaleDB are skipped with a warning.
+func Manage(ctx context.Context, pool *pgxpool.Pool, policies []Policy, logger zerolog.Logger) error {
+	if len(policies) == 0 {
+		return nil
+	}
+
+	changed, err := Apply(ctx, pool, policies)
+	if errors.Is(err, ErrNoTimescale) {
+		logger.Warn().Msg("timescaledb not installed, skipping retention and compression policies")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, p := range changed {
+		logger.Info().
+			Str("kind", p.Kind).
+			Str("table", p.Table).
+			Str("after", FormatDuration(p.After)).
+			Msg("updated hypertable policy")
+	}
+
+	effective, err := Effective(ctx, pool)
+	if err != nil {
+		return err
+	}
+	for _, p := range effective {
+		logger.Info().
+			Str("kind", p.Kind).
+			Str("table", p.Table).
+			Str("after", FormatDuration(p.After)).
+			Msg("hypertable policy")
+	}
+	return nil
+}
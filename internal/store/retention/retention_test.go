@@ -0,0 +1,103 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store/pgtest"
+)
+
+// TestParseDuration tests the accepted duration formats.
+func TestParseDuration(t *testing.T) {
+	for input, want := range map[string]time.Duration{
+		"90d":     90 * 24 * time.Hour,
+		" 7d ":    7 * 24 * time.Hour,
+		"168h":    168 * time.Hour,
+		"forever": 0,
+		"Forever": 0,
+	} {
+		got, err := ParseDuration(input)
+		require.NoError(t, err, input)
+		require.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"", "0d", "-1h", "d", "ninety days", "0s"} {
+		_, err := ParseDuration(input)
+		require.Error(t, err, input)
+	}
+}
+
+// TestFormatDuration tests that durations are formatted as configured.
+func TestFormatDuration(t *testing.T) {
+	require.Equal(t, "forever", FormatDuration(0))
+	require.Equal(t, "90d", FormatDuration(90*24*time.Hour))
+	require.Equal(t, "36h0m0s", FormatDuration(36*time.Hour))
+}
+
+// TestParse tests that a configuration block is read in table order and
+// that an invalid duration names its table.
+func TestParse(t *testing.T) {
+	policies, err := Parse(KindRetention, map[string]string{"order_fills": "forever", "events": "90d"})
+	require.NoError(t, err)
+	require.Equal(t, []Policy{
+		{Kind: KindRetention, Table: "events", After: 90 * 24 * time.Hour},
+		{Kind: KindRetention, Table: "order_fills"},
+	}, policies)
+
+	_, err = Parse(KindCompression, map[string]string{"events": "soon"})
+	require.ErrorContains(t, err, "compression.events")
+
+	_, err = Parse("archive", nil)
+	require.Error(t, err)
+}
+
+// TestApplyAgainstTimescale tests against TimescaleDB that the configured
+// policies exist after Apply, that applying them again changes nothing,
+// and that changed durations replace a policy and "forever" removes it.
+func TestApplyAgainstTimescale(t *testing.T) {
+	pool := pgtest.Migrated(t)
+	ctx := context.Background()
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+
+	policies := []Policy{
+		{Kind: KindRetention, Table: "events", After: days(90)},
+		{Kind: KindRetention, Table: "order_fills"},
+		{Kind: KindCompression, Table: "events", After: days(7)},
+		{Kind: KindCompression, Table: "order_fills", After: days(7)},
+	}
+	changed, err := Apply(ctx, pool, policies)
+	require.NoError(t, err)
+	require.Len(t, changed, 3, "order_fills had no retention policy to remove")
+
+	effective, err := Effective(ctx, pool)
+	require.NoError(t, err)
+	require.Equal(t, []Policy{
+		{Kind: KindRetention, Table: "events", After: days(90)},
+		{Kind: KindCompression, Table: "events", After: days(7)},
+		{Kind: KindCompression, Table: "order_fills", After: days(7)},
+	}, effective)
+
+	changed, err = Apply(ctx, pool, policies)
+	require.NoError(t, err)
+	require.Empty(t, changed)
+
+	changed, err = Apply(ctx, pool, []Policy{
+		{Kind: KindRetention, Table: "events", After: days(30)},
+		{Kind: KindCompression, Table: "order_fills"},
+	})
+	require.NoError(t, err)
+	require.Len(t, changed, 2)
+
+	effective, err = Effective(ctx, pool)
+	require.NoError(t, err)
+	require.Equal(t, []Policy{
+		{Kind: KindRetention, Table: "events", After: days(30)},
+		{Kind: KindCompression, Table: "events", After: days(7)},
+	}, effective)
+
+	_, err = Apply(ctx, pool, []Policy{{Kind: KindRetention, Table: "conditions", After: days(1)}})
+	require.ErrorContains(t, err, "not a hypertable")
+}
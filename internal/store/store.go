@@ -0,0 +1,126 @@
+// Package store defines the sink the consumer writes events to, and how an
+// event is dispatched to it: the raw event first, then its parsed form, the
+// wallet positions it changes, and the mark that it was fully stored, all
+// in one transaction of the Store.
+//
+// Implementations: the Postgres store (internal/store/postgres), the
+// ClickHouse mirror (internal/store/clickhouse) and an in-memory fake for
+// tests (internal/store/storetest).
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Store writes the rows of consumed events.
+type Store interface {
+	// WithTx runs fn on a Store whose writes are committed together once
+	// fn returns nil, and discarded if it returns an error.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+
+	// StoreRawEvent stores an event as published, keyed by its log.
+	StoreRawEvent(ctx context.Context, event models.Event) error
+
+	StoreOrderFilled(ctx context.Context, event models.Event) error
+	StoreTokenRegistered(ctx context.Context, event models.Event) error
+	StoreTokenTransfer(ctx context.Context, event models.Event) error
+	StoreTokenTransferBatch(ctx context.Context, event models.Event) error
+	StoreCollateralTransfer(ctx context.Context, event models.Event) error
+	StoreConditionPreparation(ctx context.Context, event models.Event) error
+	StoreConditionResolution(ctx context.Context, event models.Event) error
+	StorePositionSplit(ctx context.Context, event models.Event) error
+	StorePositionsMerge(ctx context.Context, event models.Event) error
+	StorePayoutRedemption(ctx context.Context, event models.Event) error
+
+	// RecordPositionChanges derives the wallet position changes of an event
+	// of PositionEvents from its stored rows.
+	RecordPositionChanges(ctx context.Context, event models.Event) error
+
+	// MarkProcessed flags the raw event as fully stored.
+	MarkProcessed(ctx context.Context, event models.Event) error
+
+	// RevertEvent undoes the rows of a removed (reorged) log.
+	RevertEvent(ctx context.Context, eventType string, event models.Event) error
+
+	// Quarantine sets a malformed event aside in place of its rows.
+	Quarantine(ctx context.Context, q Quarantined) error
+}
+
+// Quarantined is a malformed event, set aside instead of being stored.
+type Quarantined struct {
+	Subject   string
+	Sequence  *uint64 // Stream sequence, nil when unknown
+	EventType string
+	Reason    string // Validation failure, e.g. "missing_field"
+	Detail    string
+	Event     models.Event
+	Raw       []byte // Payload as published when JSON, the event as JSON otherwise
+}
+
+// storeFunc stores the parsed form of an event in a Store.
+type storeFunc func(s Store, ctx context.Context, event models.Event) error
+
+// ParsedStores maps every name in the pkg/events registry to the Store
+// method storing its parsed form, nil for events only stored raw.
+var ParsedStores = map[string]storeFunc{
+	events.OrderFilled:          Store.StoreOrderFilled,
+	events.OrderCancelled:       nil,
+	events.TokenRegistered:      Store.StoreTokenRegistered,
+	events.TransferSingle:       Store.StoreTokenTransfer,
+	events.TransferBatch:        Store.StoreTokenTransferBatch,
+	events.ERC20Transfer:        Store.StoreCollateralTransfer,
+	events.ConditionPreparation: Store.StoreConditionPreparation,
+	events.ConditionResolution:  Store.StoreConditionResolution,
+	events.PositionSplit:        Store.StorePositionSplit,
+	events.PositionsMerge:       Store.StorePositionsMerge,
+	events.PayoutRedemption:     Store.StorePayoutRedemption,
+}
+
+// PositionEvents are the events whose stored rows change wallet positions.
+var PositionEvents = map[string]bool{
+	events.OrderFilled:      true,
+	events.TransferSingle:   true,
+	events.TransferBatch:    true,
+	events.PositionSplit:    true,
+	events.PositionsMerge:   true,
+	events.PayoutRedemption: true,
+}
+
+// StoreEvent writes an event to s in one transaction. Removed logs are
+// reverted; other events are stored raw, then parsed when their type is in
+// ParsedStores (names outside the registry are only stored raw).
+func StoreEvent(ctx context.Context, s Store, eventType string, event models.Event) error {
+	return s.WithTx(ctx, func(tx Store) error {
+		return storeEvent(ctx, tx, eventType, event)
+	})
+}
+
+func storeEvent(ctx context.Context, s Store, eventType string, event models.Event) error {
+	// Removed (reorged) logs arrive with Success=false: undo the original rows
+	if !event.Success {
+		return s.RevertEvent(ctx, eventType, event)
+	}
+
+	if err := s.StoreRawEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to store raw event: %w", err)
+	}
+
+	if store := ParsedStores[eventType]; store != nil {
+		if err := store(s, ctx, event); err != nil {
+			return err
+		}
+	}
+
+	// Wallet positions are derived from the rows just stored
+	if PositionEvents[eventType] {
+		if err := s.RecordPositionChanges(ctx, event); err != nil {
+			return fmt.Errorf("failed to record position changes: %w", err)
+		}
+	}
+
+	return s.MarkProcessed(ctx, event)
+}
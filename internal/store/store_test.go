@@ -0,0 +1,64 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/internal/store/storetest"
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestEveryRegisteredEventIsStored tests that every event in the shared
+// registry is dispatched.
+func TestEveryRegisteredEventIsStored(t *testing.T) {
+	for _, def := range events.All() {
+		require.Contains(t, store.ParsedStores, def.Name, "no store method for %s", def.Name)
+	}
+	require.Len(t, store.ParsedStores, len(events.All()))
+}
+
+// TestStoreEvent tests the methods an event is stored with, in order.
+func TestStoreEvent(t *testing.T) {
+	ctx := context.Background()
+	for eventType, want := range map[string][]string{
+		events.OrderFilled:         {"StoreRawEvent", "StoreOrderFilled", "RecordPositionChanges", "MarkProcessed"},
+		events.ConditionResolution: {"StoreRawEvent", "StoreConditionResolution", "MarkProcessed"},
+		events.OrderCancelled:      {"StoreRawEvent", "MarkProcessed"},
+		"Approval":                 {"StoreRawEvent", "MarkProcessed"},
+	} {
+		s := &storetest.Memory{}
+		require.NoError(t, store.StoreEvent(ctx, s, eventType, models.Event{TxHash: "0xt1", LogIndex: 3, Success: true}))
+		require.Equal(t, want, s.Methods(), eventType)
+		require.Equal(t, storetest.Call{Method: "StoreRawEvent", TxHash: "0xt1", LogIndex: 3}, s.Calls()[0])
+	}
+
+	s := &storetest.Memory{}
+	require.NoError(t, store.StoreEvent(ctx, s, events.TransferBatch, models.Event{Success: false}))
+	require.Equal(t, []string{"RevertEvent"}, s.Methods())
+}
+
+// TestStoreEventStopsOnError tests that a failed write stops the event
+// before it is marked processed, and rolls back the writes before it.
+func TestStoreEventStopsOnError(t *testing.T) {
+	ctx := context.Background()
+
+	s := &storetest.Memory{Fail: map[string]bool{"StoreRawEvent": true}}
+	err := store.StoreEvent(ctx, s, events.OrderFilled, models.Event{Success: true})
+	require.ErrorContains(t, err, "failed to store raw event")
+	require.Empty(t, s.Methods())
+
+	s = &storetest.Memory{Fail: map[string]bool{"RecordPositionChanges": true}}
+	err = store.StoreEvent(ctx, s, events.PositionSplit, models.Event{Success: true})
+	require.ErrorContains(t, err, "failed to record position changes")
+	require.Empty(t, s.Methods())
+
+	// Events stored before in the same store are kept
+	s = &storetest.Memory{Fail: map[string]bool{"StoreTokenTransfer": true}}
+	require.NoError(t, store.StoreEvent(ctx, s, events.OrderCancelled, models.Event{Success: true}))
+	require.Error(t, store.StoreEvent(ctx, s, events.TransferSingle, models.Event{Success: true}))
+	require.Equal(t, []string{"StoreRawEvent", "MarkProcessed"}, s.Methods())
+}
@@ -0,0 +1,254 @@
+package storetest
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/events"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Addresses and hashes the test events are built from.
+const (
+	WalletA         = "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	WalletB         = "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	CTFExchange     = "0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e"
+	NegRiskExchange = "0xc5d563a36ae78145c45a50134d48a1215220f80a"
+
+	// OpenInterestCondition is the condition of the PositionEvent events
+	OpenInterestCondition = "0x0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d"
+)
+
+// TxHash is a well-formed transaction hash.
+var TxHash = "0x" + strings.Repeat("a1", 32)
+
+// Payloads holds a valid payload for every registered event.
+var Payloads = map[string]any{
+	events.OrderFilled: models.OrderFilled{
+		OrderHash:         "0x" + strings.Repeat("0a", 32),
+		Maker:             "0x1111111111111111111111111111111111111111",
+		Taker:             "0x2222222222222222222222222222222222222222",
+		MakerAssetID:      big.NewInt(0),
+		TakerAssetID:      new(big.Int).Lsh(big.NewInt(1), 255),
+		MakerAmountFilled: big.NewInt(52_000_000),
+		TakerAmountFilled: big.NewInt(100_000_000),
+		Fee:               big.NewInt(0),
+		Side:              models.OrderSideBuy,
+		Price:             "0.52",
+	},
+	events.OrderCancelled: map[string]string{"order_hash": "0x" + strings.Repeat("0b", 32)},
+	events.TokenRegistered: models.TokenRegistered{
+		Token0:      new(big.Int).Lsh(big.NewInt(1), 255),
+		Token1:      big.NewInt(12345),
+		ConditionID: "0x" + strings.Repeat("0c", 32),
+	},
+	events.TransferSingle: models.TransferSingle{
+		Operator: "0x1111111111111111111111111111111111111111",
+		From:     "0x0000000000000000000000000000000000000000",
+		To:       "0x2222222222222222222222222222222222222222",
+		TokenID:  big.NewInt(12345),
+		Amount:   big.NewInt(1_000_000),
+	},
+	events.TransferBatch: models.TransferBatch{
+		Operator: "0x1111111111111111111111111111111111111111",
+		From:     "0x2222222222222222222222222222222222222222",
+		To:       "0x0000000000000000000000000000000000000000",
+		TokenIDs: []*big.Int{big.NewInt(12345), big.NewInt(67890)},
+		Amounts:  []*big.Int{big.NewInt(1), big.NewInt(2)},
+	},
+	events.ERC20Transfer: models.ERC20Transfer{
+		Token: "0x2791bca1f2de4661ed88a30c99a7a9449aa84174",
+		From:  "0x1111111111111111111111111111111111111111",
+		To:    "0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e",
+		Value: big.NewInt(1_000_000),
+	},
+	events.ConditionPreparation: models.ConditionPreparation{
+		ConditionID:      "0x" + strings.Repeat("0d", 32),
+		Oracle:           "0x3333333333333333333333333333333333333333",
+		QuestionID:       "0x" + strings.Repeat("0e", 32),
+		OutcomeSlotCount: 2,
+	},
+	events.ConditionResolution: models.ConditionResolution{
+		ConditionID:      "0x" + strings.Repeat("0d", 32),
+		Oracle:           "0x3333333333333333333333333333333333333333",
+		QuestionID:       "0x" + strings.Repeat("0e", 32),
+		OutcomeSlotCount: 2,
+		PayoutNumerators: []*big.Int{big.NewInt(1), big.NewInt(0)},
+	},
+	events.PositionSplit: models.PositionSplit{
+		Stakeholder:        "0x1111111111111111111111111111111111111111",
+		CollateralToken:    "0x2791bca1f2de4661ed88a30c99a7a9449aa84174",
+		ParentCollectionID: "0x" + strings.Repeat("00", 32),
+		ConditionID:        "0x" + strings.Repeat("0d", 32),
+		Partition:          []*big.Int{big.NewInt(1), big.NewInt(2)},
+		Amount:             big.NewInt(1_000_000),
+	},
+	events.PositionsMerge: models.PositionsMerge{
+		Stakeholder:        "0x1111111111111111111111111111111111111111",
+		CollateralToken:    "0x2791bca1f2de4661ed88a30c99a7a9449aa84174",
+		ParentCollectionID: "0x" + strings.Repeat("00", 32),
+		ConditionID:        "0x" + strings.Repeat("0d", 32),
+		Partition:          []*big.Int{big.NewInt(1), big.NewInt(2)},
+		Amount:             big.NewInt(400_000),
+	},
+	events.PayoutRedemption: models.PayoutRedemption{
+		Redeemer:           "0x1111111111111111111111111111111111111111",
+		CollateralToken:    "0x2791bca1f2de4661ed88a30c99a7a9449aa84174",
+		ParentCollectionID: "0x" + strings.Repeat("00", 32),
+		ConditionID:        "0x" + strings.Repeat("0d", 32),
+		IndexSets:          []*big.Int{big.NewInt(1), big.NewInt(2)},
+		Payout:             big.NewInt(600_000),
+	},
+}
+
+// FillEvent returns a fill of WalletA buying outcome token 77 at
+// collateral/shares, both in base units, in a transaction of its own per
+// block.
+func FillEvent(block uint64, logIndex uint, timestamp uint64, collateral, shares int64) models.Event {
+	return models.Event{
+		Block:        block,
+		BlockHash:    "0x" + strings.Repeat("b1", 32),
+		Timestamp:    timestamp,
+		TxHash:       fmt.Sprintf("0x%064x", block),
+		LogIndex:     logIndex,
+		ContractAddr: CTFExchange,
+		EventSig:     "0x" + strings.Repeat("5d", 32),
+		EventName:    events.OrderFilled,
+		Payload: models.OrderFilled{
+			OrderHash:         "0x" + strings.Repeat("0a", 32),
+			Maker:             WalletA,
+			Taker:             WalletB,
+			MakerAssetID:      big.NewInt(0),
+			TakerAssetID:      big.NewInt(77),
+			MakerAmountFilled: big.NewInt(collateral),
+			TakerAmountFilled: big.NewInt(shares),
+			Fee:               big.NewInt(0),
+		},
+		Success: true,
+	}
+}
+
+// TransferEvent returns a TransferSingle of amount of token from one wallet
+// to another.
+func TransferEvent(logIndex uint, from, to string, token, amount int64) models.Event {
+	return models.Event{
+		Block:        100 + uint64(logIndex),
+		BlockHash:    "0x" + strings.Repeat("b1", 32),
+		Timestamp:    1_700_000_000,
+		TxHash:       TxHash,
+		LogIndex:     logIndex,
+		ContractAddr: "0x4d97dcd97ec945f40cf65f87097ace5ea0476045",
+		EventSig:     "0x" + strings.Repeat("5c", 32),
+		EventName:    events.TransferSingle,
+		Payload: models.TransferSingle{
+			Operator: from,
+			From:     from,
+			To:       to,
+			TokenID:  big.NewInt(token),
+			Amount:   big.NewInt(amount),
+		},
+		Success: true,
+	}
+}
+
+// TransferBatchEvent returns a TransferBatch of n tokens in which every
+// token id appears twice.
+func TransferBatchEvent(n int) models.Event {
+	transfer := models.TransferBatch{
+		Operator: "0x1111111111111111111111111111111111111111",
+		From:     "0x2222222222222222222222222222222222222222",
+		To:       "0x3333333333333333333333333333333333333333",
+	}
+	for i := range n {
+		transfer.TokenIDs = append(transfer.TokenIDs, big.NewInt(int64(1000+i/2)))
+		transfer.Amounts = append(transfer.Amounts, big.NewInt(int64(i+1)))
+	}
+	return models.Event{
+		Block:        100,
+		BlockHash:    "0x" + strings.Repeat("b1", 32),
+		Timestamp:    1_700_000_000,
+		TxHash:       TxHash,
+		LogIndex:     0,
+		ContractAddr: "0x4d97dcd97ec945f40cf65f87097ace5ea0476045",
+		EventSig:     "0x" + strings.Repeat("4a", 32),
+		EventName:    events.TransferBatch,
+		Payload:      transfer,
+		Success:      true,
+	}
+}
+
+// PositionEvent returns a split, merge or redemption by WalletA of amount
+// collateral base units of OpenInterestCondition, in a transaction of its
+// own per block. Nested events have a non-root parent collection.
+func PositionEvent(eventType string, block uint64, amount int64, nested bool) models.Event {
+	parent := models.RootCollectionID
+	if nested {
+		parent = "0x" + strings.Repeat("0c", 32)
+	}
+	partition := []*big.Int{big.NewInt(1), big.NewInt(2)}
+
+	var payload any
+	switch eventType {
+	case events.PositionSplit:
+		payload = models.PositionSplit{
+			Stakeholder: WalletA, CollateralToken: "0x2791bca1f2de4661ed88a30c99a7a9449aa84174",
+			ParentCollectionID: parent, ConditionID: OpenInterestCondition, Partition: partition, Amount: big.NewInt(amount),
+		}
+	case events.PositionsMerge:
+		payload = models.PositionsMerge{
+			Stakeholder: WalletA, CollateralToken: "0x2791bca1f2de4661ed88a30c99a7a9449aa84174",
+			ParentCollectionID: parent, ConditionID: OpenInterestCondition, Partition: partition, Amount: big.NewInt(amount),
+		}
+	case events.PayoutRedemption:
+		payload = models.PayoutRedemption{
+			Redeemer: WalletA, CollateralToken: "0x2791bca1f2de4661ed88a30c99a7a9449aa84174",
+			ParentCollectionID: parent, ConditionID: OpenInterestCondition, IndexSets: partition, Payout: big.NewInt(amount),
+		}
+	}
+
+	return models.Event{
+		Block:        block,
+		BlockHash:    "0x" + strings.Repeat("b1", 32),
+		Timestamp:    1_700_000_000 + block,
+		TxHash:       fmt.Sprintf("0x%064x", block),
+		ContractAddr: "0x4d97dcd97ec945f40cf65f87097ace5ea0476045",
+		EventSig:     "0x" + strings.Repeat("5e", 32),
+		EventName:    eventType,
+		Payload:      payload,
+		Success:      true,
+	}
+}
+
+// PreparationEvent returns the preparation of the condition of Payloads.
+func PreparationEvent(logIndex uint) models.Event {
+	return models.Event{
+		Block:        100,
+		BlockHash:    "0x" + strings.Repeat("b1", 32),
+		Timestamp:    1_700_000_000,
+		TxHash:       TxHash,
+		LogIndex:     logIndex,
+		ContractAddr: "0x4d97dcd97ec945f40cf65f87097ace5ea0476045",
+		EventSig:     "0x" + strings.Repeat("5f", 32),
+		EventName:    events.ConditionPreparation,
+		Payload:      Payloads[events.ConditionPreparation],
+		Success:      true,
+	}
+}
+
+// ResolutionEvent returns the resolution of the condition prepared by
+// PreparationEvent.
+func ResolutionEvent(logIndex uint) models.Event {
+	return models.Event{
+		Block:        200,
+		BlockHash:    "0x" + strings.Repeat("b2", 32),
+		Timestamp:    1_700_000_100,
+		TxHash:       "0x" + strings.Repeat("a2", 32),
+		LogIndex:     logIndex,
+		ContractAddr: "0x4d97dcd97ec945f40cf65f87097ace5ea0476045",
+		EventSig:     "0x" + strings.Repeat("5e", 32),
+		EventName:    events.ConditionResolution,
+		Payload:      Payloads[events.ConditionResolution],
+		Success:      true,
+	}
+}
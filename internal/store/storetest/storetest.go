@@ -0,0 +1,149 @@
+// Package storetest provides an in-memory store.Store for tests of the code
+// dispatching events to a store.
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/0xkanth/polymarket-indexer/internal/store"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Call is a Store method called with an event.
+type Call struct {
+	Method   string
+	TxHash   string
+	LogIndex uint
+}
+
+// Memory is a store.Store recording the calls it receives. A method whose
+// name is in Fail returns an error instead of recording its call.
+// Transactions are recorded as they commit: the calls of a WithTx whose
+// function fails are dropped.
+type Memory struct {
+	mu          sync.Mutex
+	calls       []Call
+	quarantined []store.Quarantined
+	Fail        map[string]bool
+}
+
+var _ store.Store = (*Memory)(nil)
+
+// Calls returns the calls recorded so far.
+func (m *Memory) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// Methods returns the methods called so far, in order.
+func (m *Memory) Methods() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	methods := make([]string, len(m.calls))
+	for i, c := range m.calls {
+		methods[i] = c.Method
+	}
+	return methods
+}
+
+// Quarantined returns the events quarantined so far.
+func (m *Memory) Quarantined() []store.Quarantined {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]store.Quarantined(nil), m.quarantined...)
+}
+
+// record records a call of method, or fails it.
+func (m *Memory) record(method string, event models.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Fail[method] {
+		return fmt.Errorf("%s failed", method)
+	}
+	m.calls = append(m.calls, Call{Method: method, TxHash: event.TxHash, LogIndex: event.LogIndex})
+	return nil
+}
+
+// WithTx runs fn on m, dropping the calls it recorded if it fails.
+func (m *Memory) WithTx(_ context.Context, fn func(tx store.Store) error) error {
+	m.mu.Lock()
+	calls, quarantined := len(m.calls), len(m.quarantined)
+	m.mu.Unlock()
+
+	if err := fn(m); err != nil {
+		m.mu.Lock()
+		m.calls, m.quarantined = m.calls[:calls], m.quarantined[:quarantined]
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (m *Memory) StoreRawEvent(_ context.Context, event models.Event) error {
+	return m.record("StoreRawEvent", event)
+}
+
+func (m *Memory) StoreOrderFilled(_ context.Context, event models.Event) error {
+	return m.record("StoreOrderFilled", event)
+}
+
+func (m *Memory) StoreTokenRegistered(_ context.Context, event models.Event) error {
+	return m.record("StoreTokenRegistered", event)
+}
+
+func (m *Memory) StoreTokenTransfer(_ context.Context, event models.Event) error {
+	return m.record("StoreTokenTransfer", event)
+}
+
+func (m *Memory) StoreTokenTransferBatch(_ context.Context, event models.Event) error {
+	return m.record("StoreTokenTransferBatch", event)
+}
+
+func (m *Memory) StoreCollateralTransfer(_ context.Context, event models.Event) error {
+	return m.record("StoreCollateralTransfer", event)
+}
+
+func (m *Memory) StoreConditionPreparation(_ context.Context, event models.Event) error {
+	return m.record("StoreConditionPreparation", event)
+}
+
+func (m *Memory) StoreConditionResolution(_ context.Context, event models.Event) error {
+	return m.record("StoreConditionResolution", event)
+}
+
+func (m *Memory) StorePositionSplit(_ context.Context, event models.Event) error {
+	return m.record("StorePositionSplit", event)
+}
+
+func (m *Memory) StorePositionsMerge(_ context.Context, event models.Event) error {
+	return m.record("StorePositionsMerge", event)
+}
+
+func (m *Memory) StorePayoutRedemption(_ context.Context, event models.Event) error {
+	return m.record("StorePayoutRedemption", event)
+}
+
+func (m *Memory) RecordPositionChanges(_ context.Context, event models.Event) error {
+	return m.record("RecordPositionChanges", event)
+}
+
+func (m *Memory) MarkProcessed(_ context.Context, event models.Event) error {
+	return m.record("MarkProcessed", event)
+}
+
+func (m *Memory) RevertEvent(_ context.Context, _ string, event models.Event) error {
+	return m.record("RevertEvent", event)
+}
+
+func (m *Memory) Quarantine(_ context.Context, q store.Quarantined) error {
+	if err := m.record("Quarantine", q.Event); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.quarantined = append(m.quarantined, q)
+	return nil
+}
@@ -102,6 +102,18 @@
 // - batchSize: uint64         - Blocks per batch in backfill mode (default: 1000)
 // - pollInterval: Duration    - Polling frequency in realtime mode (default: 2s)
 // - workers: int              - Parallel workers for backfill (default: 5)
+// - subscription: string      - Realtime mode: "poll", "heads" or "logs" (default: "poll")
+//
+// # WEBSOCKET SUBSCRIPTIONS
+// With subscription = "heads", realtime mode also syncs to head as soon as a
+// new header arrives over WebSocket, the poll ticker remaining as fallback.
+// With subscription = "logs", it subscribes to the monitored contracts' logs
+// instead of filtering logs block by block: logs are published as they are
+// mined, removed (reorged) logs as reversals, and the checkpoint advances to
+// the safe head on each tick. Every (re)subscription is followed by a
+// catch-up from the checkpoint to the head, logs published twice being
+// deduplicated by NATS. A log subscription that silently stops delivering
+// is not detected: logs need not arrive every block.
 //
 // # SAFETY MECHANISMS
 // - Confirmations: Only process blocks with N confirmations to avoid reorgs
@@ -119,10 +131,16 @@ package syncer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog"
@@ -154,6 +172,18 @@ var (
 	}, []string{"error_type"})
 )
 
+// retryDelay is the wait of the backfill before retrying a batch that
+// failed, once the chain client's own retries of transient RPC errors were
+// exhausted
+const retryDelay = 5 * time.Second
+
+// Realtime mode subscriptions
+const (
+	SubscriptionPoll  = "poll"  // Poll for new blocks every poll interval
+	SubscriptionHeads = "heads" // Also sync on new headers over WebSocket
+	SubscriptionLogs  = "logs"  // Stream the monitored logs over WebSocket
+)
+
 // Syncer coordinates blockchain synchronization lifecycle.
 //
 // It manages the dual-mode strategy (backfill/realtime) and handles:
@@ -170,15 +200,19 @@ var (
 // - isHealthy: Health flag updated on each successful sync cycle
 type Syncer struct {
 	logger        zerolog.Logger
-	chain         *chain.OnChainClient
+	chain         chain.Reader
 	processor     *processor.BlockEventsProcessor
-	checkpoint    *db.CheckpointDB
+	checkpoint    db.CheckpointStore
 	serviceName   string
 	startBlock    uint64
 	batchSize     uint64
 	pollInterval  time.Duration
 	confirmations uint64
 	workers       int
+	subscription  string
+	checkHistory  bool
+	heads         *chain.HeadSubscription                       // Head subscription in heads mode
+	openLogStream func(ctx context.Context) (*logStream, error) // Log subscriptions in logs mode
 	mu            sync.RWMutex
 	currentBlock  uint64
 	latestBlock   uint64
@@ -193,12 +227,14 @@ type Syncer struct {
 // - pollInterval: Polling frequency in realtime mode (default: 2s)
 // - workers: Number of parallel workers for backfill (default: 5)
 type Config struct {
-	ServiceName   string        // Service identifier for checkpoint (e.g., "polymarket-indexer")
-	StartBlock    uint64        // Block to start syncing from (from chains.json)
-	BatchSize     uint64        // Number of blocks to process in one batch (backfill mode)
-	PollInterval  time.Duration // How often to poll for new blocks (realtime mode)
-	Confirmations uint64        // Number of confirmations before processing (safety buffer)
-	Workers       int           // Number of parallel workers for backfill (default: 5)
+	ServiceName      string        // Service identifier for checkpoint (e.g., "polymarket-indexer")
+	StartBlock       uint64        // Block to start syncing from (from chains.json)
+	BatchSize        uint64        // Number of blocks to process in one batch (backfill mode)
+	PollInterval     time.Duration // How often to poll for new blocks (realtime mode)
+	Confirmations    uint64        // Number of confirmations before processing (safety buffer)
+	Workers          int           // Number of parallel workers for backfill (default: 5)
+	Subscription     string        // Realtime mode subscription: SubscriptionPoll (default), SubscriptionHeads or SubscriptionLogs
+	SkipHistoryCheck bool          // Do not check at startup that the RPC endpoint serves the blocks to sync
 }
 
 // New creates a new syncer instance.
@@ -213,12 +249,12 @@ type Config struct {
 // Returns a fully initialized syncer ready to call Start().
 func New(
 	logger zerolog.Logger,
-	chain *chain.OnChainClient,
+	chain chain.Reader,
 	processor *processor.BlockEventsProcessor,
-	checkpoint *db.CheckpointDB,
+	checkpoint db.CheckpointStore,
 	cfg Config,
 ) *Syncer {
-	return &Syncer{
+	s := &Syncer{
 		logger:        logger.With().Str("component", "syncer").Logger(),
 		chain:         chain,
 		processor:     processor,
@@ -229,8 +265,12 @@ func New(
 		pollInterval:  cfg.PollInterval,
 		confirmations: cfg.Confirmations,
 		workers:       cfg.Workers,
+		subscription:  cfg.Subscription,
+		checkHistory:  !cfg.SkipHistoryCheck,
 		isHealthy:     true,
 	}
+	s.openLogStream = s.subscribeLogs
+	return s
 }
 
 // Start begins synchronization and runs until context is canceled.
@@ -249,12 +289,12 @@ func New(
 // - runRealtime() switches to runBackfill() if it falls behind
 //
 // Returns error only on critical failures (checkpoint load, initial RPC call).
-// Transient errors are retried with exponential backoff.
+// Transient RPC errors are retried by the chain client.
 func (s *Syncer) Start(ctx context.Context) error {
 	s.logger.Info().Msg("starting syncer")
 
 	// Get or create checkpoint
-	checkpoint, err := s.checkpoint.GetOrCreateCheckpoint(ctx, s.serviceName, s.startBlock)
+	checkpoint, err := s.checkpoint.GetOrCreate(ctx, s.serviceName, s.startBlock)
 	if err != nil {
 		return fmt.Errorf("failed to get checkpoint: %w", err)
 	}
@@ -265,6 +305,16 @@ func (s *Syncer) Start(ctx context.Context) error {
 		Str("hash", checkpoint.LastBlockHash).
 		Msg("loaded checkpoint")
 
+	// The head subscription outlives switches between modes
+	if s.subscription == SubscriptionHeads {
+		heads, err := s.chain.SubscribeNewHead(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to new heads: %w", err)
+		}
+		defer heads.Close()
+		s.heads = heads
+	}
+
 	// Get latest block
 	latest, err := s.chain.GetLatestBlockNumber(ctx)
 	if err != nil {
@@ -273,6 +323,14 @@ func (s *Syncer) Start(ctx context.Context) error {
 	s.latestBlock = latest
 	chainHeight.Set(float64(latest))
 
+	// Fail fast on an endpoint that pruned the blocks to sync rather than
+	// retrying them forever
+	if s.checkHistory && s.currentBlock < latest {
+		if err := s.verifyHistory(ctx, s.currentBlock+1, latest); err != nil {
+			return err
+		}
+	}
+
 	// Determine sync strategy
 	behind := latest - s.confirmations - s.currentBlock
 	if behind > s.batchSize*2 {
@@ -310,14 +368,15 @@ func (s *Syncer) Start(ctx context.Context) error {
 // - Waits for all workers to complete before checkpointing
 //
 // Error Handling:
-// - On RPC failure: Sleep 5s and retry
-// - On processing failure: Sleep 5s and retry same batch
+// - Transient RPC errors are retried by the chain client itself
+// - On errors outlasting those retries: wait retryDelay and retry same batch
 // - All errors increment syncer_errors_total metric
 func (s *Syncer) runBackfill(ctx context.Context) error {
 	s.logger.Info().
 		Int("workers", s.workers).
 		Uint64("batch_size", s.batchSize).
 		Msg("starting backfill mode")
+	s.processor.SetBackfill(true)
 
 	for {
 		select {
@@ -331,7 +390,9 @@ func (s *Syncer) runBackfill(ctx context.Context) error {
 		if err != nil {
 			syncerErrors.WithLabelValues("get_latest_block").Inc()
 			s.logger.Error().Err(err).Msg("failed to get latest block")
-			time.Sleep(5 * time.Second)
+			if err := wait(ctx, retryDelay); err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -359,29 +420,43 @@ func (s *Syncer) runBackfill(ctx context.Context) error {
 		}
 
 		if err := s.processBatch(ctx, s.currentBlock+1, batchEnd); err != nil {
+			if errors.Is(err, chain.ErrHistoryUnavailable) {
+				syncerErrors.WithLabelValues("history_unavailable").Inc()
+				return historyError(s.currentBlock+1, err)
+			}
 			syncerErrors.WithLabelValues("process_batch").Inc()
 			s.logger.Error().
 				Err(err).
 				Uint64("from", s.currentBlock+1).
 				Uint64("to", batchEnd).
 				Msg("failed to process batch")
-			time.Sleep(5 * time.Second)
+			if err := wait(ctx, retryDelay); err != nil {
+				return err
+			}
 			continue
 		}
 
 		// Update checkpoint
-		block, err := s.chain.GetBlockByNumber(ctx, batchEnd)
+		header, err := s.chain.GetHeaderByNumber(ctx, batchEnd)
 		if err != nil {
 			syncerErrors.WithLabelValues("get_block").Inc()
 			s.logger.Error().Err(err).Uint64("block", batchEnd).Msg("failed to get block for checkpoint")
-			time.Sleep(5 * time.Second)
+			if err := wait(ctx, retryDelay); err != nil {
+				return err
+			}
 			continue
 		}
 
-		if err := s.checkpoint.UpdateBlock(ctx, s.serviceName, batchEnd, block.Hash().Hex()); err != nil {
+		if err := s.checkpoint.UpdateBlock(ctx, s.serviceName, batchEnd, header.Hash().Hex()); err != nil {
 			syncerErrors.WithLabelValues("update_checkpoint").Inc()
+			// Another writer advanced the checkpoint: retrying cannot succeed
+			if errors.Is(err, db.ErrStaleCheckpoint) {
+				return fmt.Errorf("failed to update checkpoint: %w", err)
+			}
 			s.logger.Error().Err(err).Msg("failed to update checkpoint")
-			time.Sleep(5 * time.Second)
+			if err := wait(ctx, retryDelay); err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -418,18 +493,42 @@ func (s *Syncer) runBackfill(ctx context.Context) error {
 // - isHealthy is set to true on successful sync
 // - Exposed via /health endpoint for Kubernetes readiness probes
 func (s *Syncer) runRealtime(ctx context.Context) error {
+	if s.subscription == SubscriptionLogs {
+		return s.runLogs(ctx)
+	}
+
 	s.logger.Info().
 		Dur("poll_interval", s.pollInterval).
 		Uint64("confirmations", s.confirmations).
+		Str("subscription", s.subscription).
 		Msg("starting realtime mode")
+	s.processor.SetBackfill(false)
 
 	ticker := time.NewTicker(s.pollInterval)
 	defer ticker.Stop()
 
+	// Receiving from headers blocks forever without a head subscription
+	var headers <-chan *types.Header
+	if s.heads != nil {
+		headers = s.heads.Headers()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case _, ok := <-headers:
+			if !ok {
+				headers = nil
+				continue
+			}
+			if err := s.syncToHead(ctx); err != nil {
+				syncerErrors.WithLabelValues("sync_to_head").Inc()
+				s.logger.Error().Err(err).Msg("failed to sync to head")
+				s.isHealthy = false
+				continue
+			}
+			s.isHealthy = true
 		case <-ticker.C:
 			if err := s.syncToHead(ctx); err != nil {
 				syncerErrors.WithLabelValues("sync_to_head").Inc()
@@ -501,7 +600,7 @@ func (s *Syncer) syncToHead(ctx context.Context) error {
 		}
 
 		// Update checkpoint
-		header, err := s.chain.GetBlockByNumber(ctx, block)
+		header, err := s.chain.GetHeaderByNumber(ctx, block)
 		if err != nil {
 			return fmt.Errorf("failed to get block %d: %w", block, err)
 		}
@@ -523,6 +622,233 @@ func (s *Syncer) syncToHead(ctx context.Context) error {
 	return nil
 }
 
+// runLogs processes the monitored logs as they are streamed over WebSocket.
+//
+// Used in realtime mode with subscription = "logs" instead of polling each
+// block's logs:
+//  1. Subscribe to the processor's log queries
+//  2. On each (re)subscription, catch up on the blocks from the checkpoint
+//     to the head with processor.ProcessBlockRange(), as logs mined while
+//     unsubscribed are not delivered. Only confirmed blocks are caught up,
+//     since no reversal would follow a reorg of the others: the rest is
+//     caught up on later ticks, once confirmed
+//  3. Publish each streamed log with processor.ProcessStreamedLog(), removed
+//     logs as reversals
+//  4. On each tick, advance the checkpoint to the safe head once caught up,
+//     and resubscribe if the monitored contracts changed
+//
+// A streamed log failing to process triggers a new catch-up, so the
+// checkpoint does not advance past it.
+func (s *Syncer) runLogs(ctx context.Context) error {
+	s.logger.Info().
+		Dur("poll_interval", s.pollInterval).
+		Uint64("confirmations", s.confirmations).
+		Msg("starting realtime mode with log subscriptions")
+	s.processor.SetBackfill(false)
+
+	stream, err := s.openLogStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { stream.close() }()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	// catchUpTo is the head the catch-up runs to, zero until it is read
+	var catchUpTo uint64
+	catchUp := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case log := <-stream.logs:
+			if err := s.processor.ProcessStreamedLog(ctx, log); err != nil {
+				syncerErrors.WithLabelValues("process_streamed_log").Inc()
+				s.logger.Error().
+					Err(err).
+					Uint64("block", log.BlockNumber).
+					Str("tx", log.TxHash.Hex()).
+					Msg("failed to process streamed log")
+				s.isHealthy = false
+				catchUp, catchUpTo = true, 0
+			}
+			continue
+		case <-stream.subscribed:
+			catchUp, catchUpTo = true, 0
+		case <-ticker.C:
+			if !slices.Equal(stream.contracts, s.processor.Contracts()) {
+				s.logger.Info().Msg("monitored contracts changed, resubscribing to logs")
+				stream.close()
+				if stream, err = s.openLogStream(ctx); err != nil {
+					return err
+				}
+				continue
+			}
+			if !catchUp {
+				if err := s.advanceToSafeHead(ctx); err != nil {
+					syncerErrors.WithLabelValues("update_checkpoint").Inc()
+					s.logger.Error().Err(err).Msg("failed to advance checkpoint")
+					s.isHealthy = false
+					continue
+				}
+				s.isHealthy = true
+				continue
+			}
+		}
+
+		done, err := s.catchUpLogs(ctx, &catchUpTo)
+		if err != nil {
+			syncerErrors.WithLabelValues("catch_up").Inc()
+			s.logger.Error().Err(err).Msg("failed to catch up on logs")
+			s.isHealthy = false
+			continue
+		}
+		catchUp = !done
+		s.isHealthy = true
+	}
+}
+
+// catchUpLogs processes the blocks from the checkpoint to *to in batches,
+// covering the logs a log subscription did not deliver, and checkpoints
+// each batch. A zero *to is set to the head. Blocks past the safe head
+// (latest - confirmations) are left for a later call, once confirmed; it
+// returns whether *to was reached.
+func (s *Syncer) catchUpLogs(ctx context.Context, to *uint64) (bool, error) {
+	latest, err := s.chain.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get latest block: %w", err)
+	}
+	s.latestBlock = latest
+	chainHeight.Set(float64(latest))
+	if *to == 0 {
+		*to = latest
+	}
+
+	safeHead := latest
+	if latest > s.confirmations {
+		safeHead = latest - s.confirmations
+	}
+	end := min(*to, safeHead)
+	for s.currentBlock < end {
+		from := s.currentBlock + 1
+		batchEnd := min(from+s.batchSize-1, end)
+		if err := s.processor.ProcessBlockRange(ctx, from, batchEnd); err != nil {
+			return false, fmt.Errorf("failed to catch up on blocks %d-%d: %w", from, batchEnd, err)
+		}
+		if err := s.saveCheckpoint(ctx, batchEnd); err != nil {
+			return false, err
+		}
+	}
+	blocksBehind.Set(float64(safeHead - min(s.currentBlock, safeHead)))
+	return s.currentBlock >= *to, nil
+}
+
+// advanceToSafeHead checkpoints the safe head (latest - confirmations),
+// whose logs were all published by the catch-up or the log subscription.
+func (s *Syncer) advanceToSafeHead(ctx context.Context) error {
+	latest, err := s.chain.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get latest block: %w", err)
+	}
+	s.latestBlock = latest
+	chainHeight.Set(float64(latest))
+
+	safeHead := latest
+	if latest > s.confirmations {
+		safeHead = latest - s.confirmations
+	}
+	if s.currentBlock >= safeHead {
+		blocksBehind.Set(0)
+		return nil
+	}
+
+	if err := s.saveCheckpoint(ctx, safeHead); err != nil {
+		return err
+	}
+	blocksBehind.Set(0)
+	return nil
+}
+
+// saveCheckpoint checkpoints block, whose logs were all published.
+func (s *Syncer) saveCheckpoint(ctx context.Context, block uint64) error {
+	header, err := s.chain.GetHeaderByNumber(ctx, block)
+	if err != nil {
+		return fmt.Errorf("failed to get block %d: %w", block, err)
+	}
+	if err := s.checkpoint.UpdateBlock(ctx, s.serviceName, block, header.Hash().Hex()); err != nil {
+		return fmt.Errorf("failed to update checkpoint: %w", err)
+	}
+
+	s.currentBlock = block
+	syncerHeight.Set(float64(s.currentBlock))
+	return nil
+}
+
+// logStream fans in the logs of the subscriptions to the processor's log
+// queries.
+type logStream struct {
+	contracts  []common.Address // Monitored contracts when subscribed
+	logs       chan types.Log
+	subscribed chan struct{} // Signalled on each (re)subscription
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// subscribeLogs subscribes to the processor's log queries.
+func (s *Syncer) subscribeLogs(ctx context.Context) (*logStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream := &logStream{
+		contracts:  s.processor.Contracts(),
+		logs:       make(chan types.Log),
+		subscribed: make(chan struct{}, 1),
+		cancel:     cancel,
+	}
+	for _, query := range s.processor.LogQueries() {
+		sub, err := s.chain.SubscribeLogs(ctx, query)
+		if err != nil {
+			stream.close()
+			return nil, fmt.Errorf("failed to subscribe to logs: %w", err)
+		}
+		stream.wg.Add(1)
+		go stream.forward(ctx, sub)
+	}
+	return stream, nil
+}
+
+// forward forwards the logs and subscription signals of sub until ctx is
+// done, then closes it.
+func (st *logStream) forward(ctx context.Context, sub *chain.LogSubscription) {
+	defer st.wg.Done()
+	defer sub.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Subscribed():
+			select {
+			case st.subscribed <- struct{}{}:
+			default:
+			}
+		case log, ok := <-sub.Logs():
+			if !ok {
+				return
+			}
+			select {
+			case st.logs <- log:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// close ends the subscriptions.
+func (st *logStream) close() {
+	st.cancel()
+	st.wg.Wait()
+}
+
 // processBatch processes a batch of blocks with parallel workers.
 //
 // Called by runBackfill() to process batches efficiently using a worker pool.
@@ -602,6 +928,65 @@ func (s *Syncer) processBatch(ctx context.Context, from, to uint64) error {
 	return nil
 }
 
+// verifyHistory checks that the RPC endpoint serves the blocks the syncer
+// is about to process, fetching the header of block from and the logs of the
+// monitored contracts in the first batch. An endpoint that pruned them, as
+// a full node does for old blocks, fails it with an error naming the block;
+// other errors are left to the sync loops to retry.
+func (s *Syncer) verifyHistory(ctx context.Context, from, latest uint64) error {
+	to := min(from+s.batchSize-1, latest)
+	_, err := s.chain.GetHeaderByNumber(ctx, from)
+	if errors.Is(err, ethereum.NotFound) {
+		// A block below the head the endpoint does not know was pruned
+		err = fmt.Errorf("%w: %w", chain.ErrHistoryUnavailable, err)
+	}
+	if err == nil {
+		_, err = s.chain.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(to),
+			Addresses: s.processor.Contracts(),
+		})
+	}
+
+	switch {
+	case errors.Is(err, chain.ErrHistoryUnavailable):
+		syncerErrors.WithLabelValues("history_unavailable").Inc()
+		return fmt.Errorf("archive check failed (skip it with -skip-archive-check): %w", historyError(from, err))
+	case err != nil:
+		s.logger.Warn().
+			Err(err).
+			Uint64("from", from).
+			Uint64("to", to).
+			Msg("failed to check that the RPC endpoint serves the blocks to sync")
+	default:
+		s.logger.Info().
+			Uint64("from", from).
+			Uint64("to", to).
+			Msg("RPC endpoint serves the blocks to sync")
+	}
+	return nil
+}
+
+// historyError is the error of the syncer stopping at block, which the RPC
+// endpoint pruned.
+func historyError(block uint64, err error) error {
+	return fmt.Errorf("RPC endpoint cannot serve block %d as it pruned its history: "+
+		"configure an archive node in rpcUrls, or a later startBlock: %w", block, err)
+}
+
+// wait waits for d, returning early with the context error once ctx is
+// done.
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // GetStatus returns current syncer status for monitoring.
 //
 // Returns:
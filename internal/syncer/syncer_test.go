@@ -0,0 +1,401 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/internal/chain"
+	"github.com/0xkanth/polymarket-indexer/internal/chain/chaintest"
+	"github.com/0xkanth/polymarket-indexer/internal/db"
+	"github.com/0xkanth/polymarket-indexer/internal/processor"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// fakeNode is a JSON-RPC node of chain 137 over HTTP serving synthetic
+// headers up to head and no logs, counting the header fetches of each
+// block.
+type fakeNode struct {
+	server *httptest.Server
+
+	mu          sync.Mutex
+	head        uint64
+	headerCalls map[uint64]int
+}
+
+func newFakeNode(t *testing.T, head uint64) *fakeNode {
+	n := &fakeNode{head: head, headerCalls: make(map[uint64]int)}
+	n.server = httptest.NewServer(http.HandlerFunc(n.serveHTTP))
+	t.Cleanup(n.server.Close)
+	return n
+}
+
+type nodeRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type nodeResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+}
+
+func (n *fakeNode) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if body[0] == '[' {
+		var reqs []nodeRequest
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resps := make([]nodeResponse, len(reqs))
+		for i, req := range reqs {
+			resps[i] = n.answer(req)
+		}
+		_ = json.NewEncoder(w).Encode(resps)
+		return
+	}
+	var req nodeRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(n.answer(req))
+}
+
+func (n *fakeNode) answer(req nodeRequest) nodeResponse {
+	resp := nodeResponse{JSONRPC: "2.0", ID: req.ID}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch req.Method {
+	case "eth_chainId":
+		resp.Result = "0x89"
+	case "eth_blockNumber":
+		resp.Result = hexutil.Uint64(n.head)
+	case "eth_getLogs":
+		resp.Result = []types.Log{}
+	case "eth_getBlockByNumber":
+		var number hexutil.Uint64
+		if err := json.Unmarshal(req.Params[0], &number); err != nil || uint64(number) > n.head {
+			resp.Result = nil
+			break
+		}
+		n.headerCalls[uint64(number)]++
+		resp.Result = &types.Header{
+			UncleHash:  types.EmptyUncleHash,
+			Difficulty: big.NewInt(1),
+			Number:     new(big.Int).SetUint64(uint64(number)),
+			GasLimit:   30_000_000,
+			Time:       1_700_000_000 + 2*uint64(number),
+			Extra:      []byte{},
+		}
+	}
+	return resp
+}
+
+// headerFetches returns the number of header fetches of each block from
+// to to.
+func (n *fakeNode) headerFetches(from, to uint64) []int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	fetches := make([]int, 0, to-from+1)
+	for number := from; number <= to; number++ {
+		fetches = append(fetches, n.headerCalls[number])
+	}
+	return fetches
+}
+
+// nopPublisher publishes nothing; the fake node serves no logs.
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(context.Context, models.Event) error { return nil }
+
+// newTestSyncer returns a syncer at checkpoint over a client of node and a
+// processor, with batches of 10 blocks split over 2 workers.
+func newTestSyncer(t *testing.T, node *fakeNode, checkpoint uint64, opts ...chain.ClientOption) (*Syncer, *db.CheckpointDB) {
+	t.Helper()
+	logger := zerolog.Nop()
+	client, err := chain.NewClient([]string{node.server.URL}, "", 137, &logger, opts...)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return newReaderSyncer(t, client, checkpoint)
+}
+
+// newReaderSyncer returns a syncer at checkpoint over reader and a
+// processor, with batches of 10 blocks split over 2 workers.
+func newReaderSyncer(t *testing.T, reader chain.Reader, checkpoint uint64) (*Syncer, *db.CheckpointDB) {
+	t.Helper()
+	logger := zerolog.Nop()
+	proc, err := processor.New(logger, reader, nopPublisher{}, processor.BlockEventProcessingConfig{
+		Contracts: []string{"0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E"},
+	})
+	require.NoError(t, err)
+
+	checkpoints, err := db.NewCheckpointDB(filepath.Join(t.TempDir(), "checkpoint.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = checkpoints.Close() })
+	_, err = checkpoints.GetOrCreate(context.Background(), "polymarket-indexer", checkpoint)
+	require.NoError(t, err)
+
+	s := New(logger, reader, proc, checkpoints, Config{
+		ServiceName:  "polymarket-indexer",
+		StartBlock:   checkpoint,
+		BatchSize:    10,
+		PollInterval: time.Hour,
+		Workers:      2,
+	})
+	s.currentBlock = checkpoint
+	return s, checkpoints
+}
+
+// repeat returns n times fetches.
+func repeat(n, fetches int) []int {
+	all := make([]int, n)
+	for i := range all {
+		all[i] = fetches
+	}
+	return all
+}
+
+// TestSyncToHeadFetchesEachHeaderOnce tests that in realtime mode the
+// header the processor fetched for a block's timestamp is reused for its
+// checkpoint hash when the header cache is enabled, and fetched again
+// otherwise.
+func TestSyncToHeadFetchesEachHeaderOnce(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		opts    []chain.ClientOption
+		fetches int
+	}{
+		{"cached", nil, 1},
+		{"uncached", []chain.ClientOption{chain.WithHeaderCache(-1)}, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeNode(t, 65_000_010)
+			s, checkpoints := newTestSyncer(t, node, 65_000_000, tt.opts...)
+
+			require.NoError(t, s.syncToHead(context.Background()))
+			checkpoint, err := checkpoints.GetCheckpoint(context.Background(), "polymarket-indexer")
+			require.NoError(t, err)
+			require.Equal(t, uint64(65_000_010), checkpoint.LastBlock)
+
+			require.Equal(t, repeat(10, tt.fetches), node.headerFetches(65_000_001, 65_000_010))
+		})
+	}
+}
+
+// TestBackfillFetchesEachHeaderOnce tests that in backfill mode the header
+// of a batch's last block, fetched by a worker, is reused for the
+// checkpoint hash.
+func TestBackfillFetchesEachHeaderOnce(t *testing.T) {
+	node := newFakeNode(t, 65_000_050)
+	s, checkpoints := newTestSyncer(t, node, 65_000_000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.runBackfill(ctx) }()
+
+	require.Eventually(t, func() bool {
+		checkpoint, err := checkpoints.GetCheckpoint(ctx, "polymarket-indexer")
+		return err == nil && checkpoint.LastBlock == 65_000_050
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.True(t, errors.Is(<-done, context.Canceled))
+
+	require.Equal(t, repeat(50, 1), node.headerFetches(65_000_001, 65_000_050))
+}
+
+// TestRunLogsCatchesUpOnSubscribe tests that in log subscription mode each
+// (re)subscription is followed by a catch-up from the checkpoint to the
+// head, that blocks are only caught up and checkpointed once confirmed,
+// and that the checkpoint then advances to the safe head.
+func TestRunLogsCatchesUpOnSubscribe(t *testing.T) {
+	node := newFakeNode(t, 65_000_010)
+	s, checkpoints := newTestSyncer(t, node, 65_000_000, chain.WithHeaderCache(-1))
+	s.pollInterval = 10 * time.Millisecond
+	s.confirmations = 5
+
+	stream := &logStream{
+		logs:       make(chan types.Log),
+		subscribed: make(chan struct{}, 1),
+		cancel:     func() {},
+	}
+	s.openLogStream = func(context.Context) (*logStream, error) {
+		stream.contracts = s.processor.Contracts()
+		return stream, nil
+	}
+	stream.subscribed <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.runLogs(ctx) }()
+
+	checkpointed := func(block uint64) func() bool {
+		return func() bool {
+			checkpoint, err := checkpoints.GetCheckpoint(ctx, "polymarket-indexer")
+			return err == nil && checkpoint.LastBlock == block
+		}
+	}
+	require.Eventually(t, checkpointed(65_000_005), 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, repeat(5, 0), node.headerFetches(65_000_006, 65_000_010), "unconfirmed blocks are not caught up")
+
+	// The blocks mined before the subscription are caught up once confirmed,
+	// the later ones are left to the subscription
+	node.mu.Lock()
+	node.head = 65_000_020
+	node.mu.Unlock()
+	require.Eventually(t, checkpointed(65_000_015), 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []int{1, 1, 1, 1, 2}, node.headerFetches(65_000_006, 65_000_010), "caught up to the head")
+	require.Equal(t, repeat(4, 0), node.headerFetches(65_000_011, 65_000_014))
+
+	stream.subscribed <- struct{}{}
+	require.Eventually(t, func() bool { return len(stream.subscribed) == 0 }, 5*time.Second, time.Millisecond)
+	node.mu.Lock()
+	node.head = 65_000_022
+	node.mu.Unlock()
+	require.Eventually(t, checkpointed(65_000_017), 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []int{1, 2}, node.headerFetches(65_000_016, 65_000_017), "blocks past the checkpoint are caught up again")
+	require.Equal(t, repeat(4, 1), node.headerFetches(65_000_001, 65_000_004))
+	cancel()
+	require.True(t, errors.Is(<-done, context.Canceled))
+}
+
+// TestProcessBatchSplitsAcrossWorkers tests that a batch is split into one
+// range per worker, the last taking the remainder, that no worker gets an
+// empty range, and that a worker's failure fails the batch.
+func TestProcessBatchSplitsAcrossWorkers(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		workers  int
+		from, to uint64
+		ranges   [][]uint64
+	}{
+		{"single", 1, 1, 4, [][]uint64{{1, 2, 3, 4}}},
+		{"remainder", 3, 1, 10, [][]uint64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9, 10}}},
+		{"more workers than blocks", 5, 1, 3, [][]uint64{{1}, {2}, {3}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := chaintest.New(100)
+			s, _ := newReaderSyncer(t, reader, 0)
+			s.workers = tt.workers
+
+			require.NoError(t, s.processBatch(context.Background(), tt.from, tt.to))
+			batches := reader.HeaderBatches()
+			slices.SortFunc(batches, func(a, b []uint64) int { return int(a[0]) - int(b[0]) })
+			require.Equal(t, tt.ranges, batches)
+		})
+	}
+
+	reader := chaintest.New(100)
+	s, _ := newReaderSyncer(t, reader, 0)
+	errRPC := errors.New("connection refused")
+	reader.Fail("FilterLogs", errRPC)
+	require.ErrorIs(t, s.processBatch(context.Background(), 1, 10), errRPC)
+	require.Error(t, s.processBatch(context.Background(), 10, 1))
+}
+
+// TestStartSwitchesModes tests that the syncer starts in realtime mode near
+// the head, processing block by block, switches to backfill once it falls
+// more than 2 batches behind, and returns to realtime once caught up, the
+// checkpoint holding the hash of its block.
+func TestStartSwitchesModes(t *testing.T) {
+	reader := chaintest.New(1_005)
+	s, checkpoints := newReaderSyncer(t, reader, 1_000)
+	s.pollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ctx) }()
+
+	waitForCheckpoint := func(block uint64) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			checkpoint, err := checkpoints.GetCheckpoint(ctx, "polymarket-indexer")
+			return err == nil && checkpoint.LastBlock == block
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	waitForCheckpoint(1_005)
+	require.Empty(t, reader.HeaderBatches(), "realtime mode processes block by block")
+
+	reader.SetHead(1_100)
+	waitForCheckpoint(1_100)
+	batches := reader.HeaderBatches()
+	require.NotEmpty(t, batches, "backfill processes batches")
+	for _, batch := range batches {
+		require.LessOrEqual(t, len(batch), 10)
+	}
+
+	reader.SetHead(1_101)
+	waitForCheckpoint(1_101)
+	require.Len(t, reader.HeaderBatches(), len(batches), "back to realtime mode")
+
+	checkpoint, err := checkpoints.GetCheckpoint(ctx, "polymarket-indexer")
+	require.NoError(t, err)
+	require.Equal(t, reader.Header(1_101).Hash().Hex(), checkpoint.LastBlockHash)
+
+	cancel()
+	require.True(t, errors.Is(<-done, context.Canceled))
+	current, latest, _ := s.GetStatus()
+	require.Equal(t, []uint64{1_101, 1_101}, []uint64{current, latest})
+}
+
+// TestStartChecksHistory tests that the syncer fails at startup, naming the
+// first block to sync, when the RPC endpoint pruned it, that other errors
+// of the check are left to the sync loops, and that with the check skipped
+// backfill still stops at the first pruned batch.
+func TestStartChecksHistory(t *testing.T) {
+	ctx := context.Background()
+	pruned := fmt.Errorf("%w: missing trie node", chain.ErrHistoryUnavailable)
+
+	reader := chaintest.New(100)
+	s, _ := newReaderSyncer(t, reader, 0)
+	reader.Fail("FilterLogs", pruned)
+	err := s.Start(ctx)
+	require.ErrorIs(t, err, chain.ErrHistoryUnavailable)
+	require.ErrorContains(t, err, "cannot serve block 1")
+	require.ErrorContains(t, err, "-skip-archive-check")
+	require.Empty(t, reader.HeaderBatches(), "nothing synced")
+
+	reader = chaintest.New(100)
+	s, _ = newReaderSyncer(t, reader, 0)
+	require.NoError(t, s.verifyHistory(ctx, 1, 100))
+	reader.Fail("GetHeaderByNumber", ethereum.NotFound)
+	require.ErrorIs(t, s.verifyHistory(ctx, 1, 100), chain.ErrHistoryUnavailable, "a missing block below the head was pruned")
+
+	reader = chaintest.New(100)
+	s, _ = newReaderSyncer(t, reader, 0)
+	reader.Fail("GetHeaderByNumber", errors.New("connection refused"))
+	require.NoError(t, s.verifyHistory(ctx, 1, 100))
+
+	reader = chaintest.New(100)
+	s, _ = newReaderSyncer(t, reader, 0)
+	s.checkHistory = false
+	reader.Fail("FilterLogs", pruned)
+	err = s.Start(ctx)
+	require.ErrorIs(t, err, chain.ErrHistoryUnavailable)
+	require.ErrorContains(t, err, "cannot serve block 1")
+	require.NotContains(t, err.Error(), "-skip-archive-check")
+}
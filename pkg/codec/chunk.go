@@ -0,0 +1,61 @@
+package codec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Headers of a chunk message. An event whose message exceeds the server's
+// max payload is published as several chunk messages, each carrying a
+// slice of the encoded (and compressed) payload and the headers of the
+// whole message. Consumers concatenate the payloads of chunks 1 to n, in
+// order, before decoding.
+const (
+	HeaderChunk   = "PM-Chunk"    // "i/n", i counted from 1
+	HeaderChunkID = "PM-Chunk-ID" // Deduplication ID of the whole message
+)
+
+// Chunk is the position of a chunk message within its message.
+type Chunk struct {
+	ID    string // Deduplication ID of the whole message
+	Index int    // From 1 to Count
+	Count int
+}
+
+// SetHeaders writes the chunk headers.
+func (c Chunk) SetHeaders(h nats.Header) {
+	h.Set(HeaderChunk, fmt.Sprintf("%d/%d", c.Index, c.Count))
+	h.Set(HeaderChunkID, c.ID)
+}
+
+// ChunkFromHeaders reads the chunk headers. It returns false for messages
+// that are not chunks, and an error for chunks whose headers are malformed.
+func ChunkFromHeaders(h nats.Header) (Chunk, bool, error) {
+	value := h.Get(HeaderChunk)
+	if value == "" {
+		return Chunk{}, false, nil
+	}
+
+	index, count, found := strings.Cut(value, "/")
+	if !found {
+		return Chunk{}, true, fmt.Errorf("malformed %s header %q", HeaderChunk, value)
+	}
+	c := Chunk{ID: h.Get(HeaderChunkID)}
+	var err error
+	if c.Index, err = strconv.Atoi(index); err != nil {
+		return Chunk{}, true, fmt.Errorf("malformed %s header %q: %w", HeaderChunk, value, err)
+	}
+	if c.Count, err = strconv.Atoi(count); err != nil {
+		return Chunk{}, true, fmt.Errorf("malformed %s header %q: %w", HeaderChunk, value, err)
+	}
+	if c.Index < 1 || c.Index > c.Count {
+		return Chunk{}, true, fmt.Errorf("malformed %s header %q: index out of range", HeaderChunk, value)
+	}
+	if c.ID == "" {
+		return Chunk{}, true, fmt.Errorf("chunk %q without %s header", value, HeaderChunkID)
+	}
+	return c, true, nil
+}
@@ -0,0 +1,44 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChunkHeadersRoundTrip tests that chunk headers are read back
+// unchanged, and that messages without them are not chunks.
+func TestChunkHeadersRoundTrip(t *testing.T) {
+	h := nats.Header{}
+	chunk := Chunk{ID: "0xabc-7", Index: 2, Count: 3}
+	chunk.SetHeaders(h)
+	require.Equal(t, "2/3", h.Get(HeaderChunk))
+
+	read, ok, err := ChunkFromHeaders(h)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, chunk, read)
+
+	_, ok, err = ChunkFromHeaders(nats.Header{})
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+// TestChunkFromHeadersMalformed tests that chunks with malformed headers
+// are reported as errors rather than decoded as whole messages.
+func TestChunkFromHeadersMalformed(t *testing.T) {
+	for _, value := range []string{"2", "a/3", "2/b", "0/3", "4/3"} {
+		h := nats.Header{}
+		h.Set(HeaderChunk, value)
+		h.Set(HeaderChunkID, "0xabc-7")
+		_, ok, err := ChunkFromHeaders(h)
+		require.True(t, ok, value)
+		require.Error(t, err, value)
+	}
+
+	h := nats.Header{}
+	h.Set(HeaderChunk, "1/2")
+	_, _, err := ChunkFromHeaders(h)
+	require.Error(t, err, "no chunk ID")
+}
@@ -0,0 +1,104 @@
+// Package codec encodes events and their metadata headers for NATS. The
+// indexer stamps the codec's content type into the Content-Type header of
+// every message and the consumer picks the decoder from that header, so a
+// stream may mix encodings while publishers are being switched over.
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// HeaderContentType is the NATS header carrying the payload encoding.
+// Messages without it are JSON.
+const HeaderContentType = "Content-Type"
+
+// Content types of the supported encodings.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+// Codec encodes and decodes events.
+type Codec interface {
+	// Name is the configuration name of the codec
+	Name() string
+	// ContentType is stamped into the Content-Type header
+	ContentType() string
+	Marshal(event models.Event) ([]byte, error)
+	// Unmarshal decodes an event. The payload type depends on the codec:
+	// JSON yields the payload as json.RawMessage, protobuf the models
+	// payload struct (json.RawMessage for payloads carried as JSON).
+	Unmarshal(data []byte, event *models.Event) error
+}
+
+var (
+	// JSON encodes events with encoding/json. It is the default.
+	JSON Codec = jsonCodec{}
+
+	// Protobuf encodes events as the Event message of event.proto.
+	Protobuf Codec = protobufCodec{}
+)
+
+// ByName returns the codec configured as name: "json" (the default when
+// empty) or "protobuf".
+func ByName(name string) (Codec, error) {
+	switch name {
+	case "", JSON.Name():
+		return JSON, nil
+	case Protobuf.Name():
+		return Protobuf, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q (want json or protobuf)", name)
+	}
+}
+
+// ForContentType returns the codec for a Content-Type header value. An
+// empty value is JSON, as published before the header existed.
+func ForContentType(contentType string) (Codec, error) {
+	switch contentType {
+	case "", ContentTypeJSON:
+		return JSON, nil
+	case ContentTypeProtobuf:
+		return Protobuf, nil
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string        { return "json" }
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Marshal(event models.Event) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// eventFields decodes the fields of an Event, with Payload shadowed by the
+// raw payload.
+type eventFields models.Event
+
+func (jsonCodec) Unmarshal(data []byte, event *models.Event) error {
+	// The payload is kept as JSON for the consumer to decode into its type:
+	// decoded into any, its integers would be rounded to float64
+	decoded := struct {
+		*eventFields
+		Payload json.RawMessage `json:"payload"`
+	}{eventFields: (*eventFields)(event)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	event.Payload = rawPayload(decoded.Payload)
+	return nil
+}
+
+// rawPayload returns a JSON payload, nil when absent or null.
+func rawPayload(data []byte) any {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	return json.RawMessage(data)
+}
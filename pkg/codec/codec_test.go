@@ -0,0 +1,205 @@
+package codec
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// bigInt parses a decimal integer.
+func bigInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	v, ok := new(big.Int).SetString(s, 10)
+	require.True(t, ok, s)
+	return v
+}
+
+// testEvent returns an event envelope around payload.
+func testEvent(payload any) models.Event {
+	return models.Event{
+		Block:        65000000,
+		BlockHash:    "0x" + "ab" + "00000000000000000000000000000000000000000000000000000000000000",
+		TxHash:       "0x" + "cd" + "00000000000000000000000000000000000000000000000000000000000000",
+		TxIndex:      7,
+		LogIndex:     312,
+		ContractAddr: "0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e",
+		EventName:    "OrderFilled",
+		EventSig:     "0xd0a08e8c493f9c94f29311604c9de1b4e8c8d4c06bd0c789af57f2d65bfec0f6",
+		Timestamp:    1700000000,
+		Success:      true,
+		Payload:      payload,
+		ProcessedAt:  time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC),
+	}
+}
+
+// TestProtobufRoundTrip tests that every payload type survives a protobuf
+// round trip, including integers wider than 64 bits, zero and nil integers.
+func TestProtobufRoundTrip(t *testing.T) {
+	tokenID := bigInt(t, "71321045679252212594626385532706912750332728571942532289631379312455583992563")
+	amount := bigInt(t, "18446744073709551616") // 2^64
+
+	payloads := map[string]any{
+		"OrderFilled": models.OrderFilled{
+			OrderHash:         "0x" + "11" + "00000000000000000000000000000000000000000000000000000000000000",
+			Maker:             "0x1111111111111111111111111111111111111111",
+			Taker:             "0x2222222222222222222222222222222222222222",
+			MakerAssetID:      big.NewInt(0),
+			TakerAssetID:      tokenID,
+			MakerAmountFilled: amount,
+			TakerAmountFilled: big.NewInt(1_000_000),
+			Fee:               big.NewInt(0),
+			Side:              models.OrderSideBuy,
+			Price:             "0.52",
+			IsOperatorFill:    true,
+		},
+		"OrderCancelled bare":     models.OrderCancelled{OrderHash: "0x01"},
+		"OrderCancelled enriched": models.OrderCancelled{OrderHash: "0x01", Maker: "0x1111111111111111111111111111111111111111", Remaining: amount},
+		"TokenRegistered":         models.TokenRegistered{Token0: tokenID, Token1: big.NewInt(1), ConditionID: "0x02"},
+		"TransferSingle": models.TransferSingle{
+			Operator: "0x3333333333333333333333333333333333333333", From: models.ZeroAddress, To: "0x4444444444444444444444444444444444444444",
+			TokenID: tokenID, Amount: amount, TransferKind: models.TransferKindMint,
+		},
+		"TransferBatch": models.TransferBatch{
+			Operator: "0x3333333333333333333333333333333333333333", From: "0x4444444444444444444444444444444444444444", To: models.ZeroAddress,
+			TokenIDs: []*big.Int{tokenID, big.NewInt(0)}, Amounts: []*big.Int{amount, big.NewInt(5)}, TransferKind: models.TransferKindBurn,
+		},
+		"ConditionPreparation": models.ConditionPreparation{ConditionID: "0x02", Oracle: "0x5555555555555555555555555555555555555555", QuestionID: "0x03", OutcomeSlotCount: 2},
+		"ConditionResolution": models.ConditionResolution{
+			ConditionID: "0x02", Oracle: "0x5555555555555555555555555555555555555555", QuestionID: "0x03", OutcomeSlotCount: 2,
+			PayoutNumerators: []*big.Int{big.NewInt(0), big.NewInt(1)},
+		},
+		"PositionSplit": models.PositionSplit{
+			Stakeholder: "0x6666666666666666666666666666666666666666", CollateralToken: "0x7777777777777777777777777777777777777777",
+			ParentCollectionID: models.RootCollectionID, ConditionID: "0x02", Partition: []*big.Int{big.NewInt(1), big.NewInt(2)},
+			Amount: amount, IsRootCollection: true,
+		},
+		"PositionsMerge": models.PositionsMerge{
+			Stakeholder: "0x6666666666666666666666666666666666666666", CollateralToken: "0x7777777777777777777777777777777777777777",
+			ParentCollectionID: "0x08", ConditionID: "0x02", Partition: []*big.Int{big.NewInt(1), big.NewInt(2)}, Amount: big.NewInt(3),
+		},
+		"PayoutRedemption": models.PayoutRedemption{
+			Redeemer: "0x6666666666666666666666666666666666666666", CollateralToken: "0x7777777777777777777777777777777777777777",
+			ParentCollectionID: models.RootCollectionID, ConditionID: "0x02", IndexSets: []*big.Int{big.NewInt(1), big.NewInt(2)},
+			Payout: amount, IsRootCollection: true,
+		},
+		"ERC20Transfer": models.ERC20Transfer{Token: "0x7777777777777777777777777777777777777777", From: "0x1111111111111111111111111111111111111111", To: "0x2222222222222222222222222222222222222222", Value: amount},
+	}
+
+	for name, payload := range payloads {
+		t.Run(name, func(t *testing.T) {
+			event := testEvent(payload)
+
+			data, err := Protobuf.Marshal(event)
+			require.NoError(t, err)
+
+			var decoded models.Event
+			require.NoError(t, Protobuf.Unmarshal(data, &decoded))
+			require.Equal(t, event, decoded)
+
+			// The consumer re-encodes payloads as JSON to parse them
+			want, err := json.Marshal(event)
+			require.NoError(t, err)
+			got, err := json.Marshal(decoded)
+			require.NoError(t, err)
+			require.JSONEq(t, string(want), string(got))
+		})
+	}
+}
+
+// TestProtobufPointerPayload tests that pointer payloads are encoded like
+// their values.
+func TestProtobufPointerPayload(t *testing.T) {
+	payload := models.OrderCancelled{OrderHash: "0x01", Remaining: big.NewInt(0)}
+	event := testEvent(&payload)
+
+	data, err := Protobuf.Marshal(event)
+	require.NoError(t, err)
+
+	var decoded models.Event
+	require.NoError(t, Protobuf.Unmarshal(data, &decoded))
+	require.Equal(t, payload, decoded.Payload)
+}
+
+// TestProtobufJSONPayload tests that payloads without a message, such as
+// events of contracts added at runtime, are carried as JSON.
+func TestProtobufJSONPayload(t *testing.T) {
+	event := testEvent(map[string]any{"value": "42", "owner": "0x1111111111111111111111111111111111111111"})
+	event.Success = false
+	event.ProcessedAt = time.Time{}
+
+	data, err := Protobuf.Marshal(event)
+	require.NoError(t, err)
+
+	var decoded models.Event
+	require.NoError(t, Protobuf.Unmarshal(data, &decoded))
+	require.JSONEq(t, `{"value": "42", "owner": "0x1111111111111111111111111111111111111111"}`, string(decoded.Payload.(json.RawMessage)))
+	decoded.Payload = event.Payload
+	require.Equal(t, event, decoded)
+}
+
+// TestProtobufRejectsNegativeIntegers tests that negative integers, which
+// the unsigned encoding cannot carry, fail to encode.
+func TestProtobufRejectsNegativeIntegers(t *testing.T) {
+	_, err := Protobuf.Marshal(testEvent(models.ERC20Transfer{Value: big.NewInt(-1)}))
+	require.Error(t, err)
+}
+
+// TestJSONRoundTrip tests the default codec, whose payload is kept as JSON
+// so that integers wider than a float64 decode into their type unchanged.
+func TestJSONRoundTrip(t *testing.T) {
+	token0 := new(big.Int).Lsh(big.NewInt(1), 255)
+	token1 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	event := testEvent(models.TokenRegistered{Token0: token0, Token1: token1, ConditionID: "0x02"})
+
+	data, err := JSON.Marshal(event)
+	require.NoError(t, err)
+
+	var decoded models.Event
+	require.NoError(t, JSON.Unmarshal(data, &decoded))
+	payload, ok := decoded.Payload.(json.RawMessage)
+	require.True(t, ok, "payload is %T", decoded.Payload)
+
+	var token models.TokenRegistered
+	require.NoError(t, json.Unmarshal(payload, &token))
+	require.Equal(t, event.Payload, token)
+
+	decoded.Payload = event.Payload
+	require.Equal(t, event, decoded)
+}
+
+// TestJSONNullPayload tests that an event without a payload decodes with a
+// nil payload.
+func TestJSONNullPayload(t *testing.T) {
+	var decoded models.Event
+	require.NoError(t, JSON.Unmarshal([]byte(`{"tx_hash": "0x01", "payload": null}`), &decoded))
+	require.Equal(t, "0x01", decoded.TxHash)
+	require.Nil(t, decoded.Payload)
+}
+
+// TestCodecLookup tests resolving codecs by configuration name and by
+// Content-Type header, with JSON as the default for both.
+func TestCodecLookup(t *testing.T) {
+	for name, want := range map[string]Codec{"": JSON, "json": JSON, "protobuf": Protobuf} {
+		c, err := ByName(name)
+		require.NoError(t, err)
+		require.Equal(t, want, c)
+
+		c, err = ForContentType(want.ContentType())
+		require.NoError(t, err)
+		require.Equal(t, want, c)
+	}
+
+	c, err := ForContentType("")
+	require.NoError(t, err)
+	require.Equal(t, JSON, c)
+
+	_, err = ByName("msgpack")
+	require.Error(t, err)
+	_, err = ForContentType("application/msgpack")
+	require.Error(t, err)
+}
@@ -0,0 +1,136 @@
+package codec
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// transferBatchEvent returns a TransferBatch event of n positions with
+// random 256-bit token IDs, like the outcome tokens of distinct markets.
+func transferBatchEvent(n int) models.Event {
+	rng := rand.New(rand.NewSource(1))
+	limit := new(big.Int).Lsh(big.NewInt(1), 256)
+	payload := models.TransferBatch{
+		Operator:     "0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e",
+		From:         "0x1111111111111111111111111111111111111111",
+		To:           "0x2222222222222222222222222222222222222222",
+		TokenIDs:     make([]*big.Int, n),
+		Amounts:      make([]*big.Int, n),
+		TransferKind: models.TransferKindTransfer,
+	}
+	for i := range payload.TokenIDs {
+		payload.TokenIDs[i] = new(big.Int).Rand(rng, limit)
+		payload.Amounts[i] = big.NewInt(rng.Int63n(1_000_000_000))
+	}
+	return testEvent(payload)
+}
+
+// TestCompressionRoundTrip tests that payloads survive compression and are
+// decompressed by their Content-Encoding header value.
+func TestCompressionRoundTrip(t *testing.T) {
+	data, err := JSON.Marshal(transferBatchEvent(200))
+	require.NoError(t, err)
+
+	for _, c := range []Compression{S2, Gzip} {
+		compressed, err := c.Compress(data)
+		require.NoError(t, err)
+		require.Less(t, len(compressed), len(data), c.Name())
+
+		out, err := Decompress(c.Name(), compressed)
+		require.NoError(t, err)
+		require.Equal(t, data, out)
+	}
+}
+
+// TestDecompressUncompressed tests that messages without a Content-Encoding
+// header are passed through, and that unknown encodings and corrupt payloads
+// are rejected.
+func TestDecompressUncompressed(t *testing.T) {
+	out, err := Decompress("", []byte(`{"block":1}`))
+	require.NoError(t, err)
+	require.Equal(t, []byte(`{"block":1}`), out)
+
+	_, err = Decompress("br", []byte(`{"block":1}`))
+	require.Error(t, err)
+	_, err = Decompress(S2.Name(), []byte(`{"block":1}`))
+	require.Error(t, err)
+	_, err = Decompress(Gzip.Name(), []byte(`{"block":1}`))
+	require.Error(t, err)
+}
+
+// TestDecompressTooLarge tests that payloads decompressing beyond the size
+// limit are rejected.
+func TestDecompressTooLarge(t *testing.T) {
+	data := make([]byte, maxDecompressedSize+1)
+	for _, c := range []Compression{S2, Gzip} {
+		compressed, err := c.Compress(data)
+		require.NoError(t, err)
+		_, err = c.Decompress(compressed)
+		require.ErrorIs(t, err, ErrPayloadTooLarge, c.Name())
+	}
+}
+
+// TestCompressionByName tests resolving compressions by configuration name.
+func TestCompressionByName(t *testing.T) {
+	for name, want := range map[string]Compression{"": nil, "none": nil, "s2": S2, "gzip": Gzip} {
+		c, err := CompressionByName(name)
+		require.NoError(t, err)
+		require.Equal(t, want, c)
+	}
+	_, err := CompressionByName("zstd")
+	require.Error(t, err)
+}
+
+// BenchmarkCompress measures the compression ratio (original/compressed
+// size) and CPU cost of each compression on TransferBatch payloads.
+//
+//	go test -run '^$' -bench Compress ./pkg/codec/
+func BenchmarkCompress(b *testing.B) {
+	for _, size := range []int{10, 100, 500} {
+		for _, enc := range []Codec{JSON, Protobuf} {
+			data, err := enc.Marshal(transferBatchEvent(size))
+			require.NoError(b, err)
+
+			for _, c := range []Compression{S2, Gzip} {
+				b.Run(fmt.Sprintf("%s/%s/%d", enc.Name(), c.Name(), size), func(b *testing.B) {
+					var compressed []byte
+					b.SetBytes(int64(len(data)))
+					for i := 0; i < b.N; i++ {
+						if compressed, err = c.Compress(data); err != nil {
+							b.Fatal(err)
+						}
+					}
+					b.ReportMetric(float64(len(data))/float64(len(compressed)), "ratio")
+					b.ReportMetric(float64(len(compressed)), "bytes")
+				})
+			}
+		}
+	}
+}
+
+// BenchmarkDecompress measures the consumer's decompression cost on
+// TransferBatch payloads.
+func BenchmarkDecompress(b *testing.B) {
+	data, err := JSON.Marshal(transferBatchEvent(100))
+	require.NoError(b, err)
+
+	for _, c := range []Compression{S2, Gzip} {
+		compressed, err := c.Compress(data)
+		require.NoError(b, err)
+
+		b.Run(c.Name(), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := Decompress(c.Name(), compressed); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package codec
+
+import (
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Headers carrying an event's routing metadata, so consumers can label
+// metrics and track lag without decoding the payload. Nats-Msg-Id is set
+// separately by the publisher.
+const (
+	HeaderBlock    = "PM-Block"
+	HeaderTxHash   = "PM-TxHash"
+	HeaderLogIndex = "PM-LogIndex"
+	HeaderEvent    = "PM-Event"
+	HeaderContract = "PM-Contract"
+	HeaderChainID  = "PM-ChainID"
+)
+
+// HeaderDeadLetter marks a dead letter: a JSON document describing an event
+// that could not be published, with the failure reason as value. Consumers
+// of the event subjects skip these messages.
+const HeaderDeadLetter = "PM-Dead-Letter"
+
+// Metadata is the routing metadata of an event.
+type Metadata struct {
+	Block     uint64
+	TxHash    string
+	LogIndex  uint
+	EventName string
+	Contract  string // Lowercase, as in the subject
+	ChainID   int64  // 0 when unknown
+}
+
+// MetadataOf returns the metadata of an event published on chainID.
+func MetadataOf(event models.Event, chainID int64) Metadata {
+	return Metadata{
+		Block:     event.Block,
+		TxHash:    event.TxHash,
+		LogIndex:  event.LogIndex,
+		EventName: event.EventName,
+		Contract:  models.NormalizeAddress(event.ContractAddr),
+		ChainID:   chainID,
+	}
+}
+
+// SetHeaders writes the metadata into message headers.
+func (m Metadata) SetHeaders(h nats.Header) {
+	h.Set(HeaderBlock, strconv.FormatUint(m.Block, 10))
+	h.Set(HeaderTxHash, m.TxHash)
+	h.Set(HeaderLogIndex, strconv.FormatUint(uint64(m.LogIndex), 10))
+	h.Set(HeaderEvent, m.EventName)
+	h.Set(HeaderContract, m.Contract)
+	if m.ChainID != 0 {
+		h.Set(HeaderChainID, strconv.FormatInt(m.ChainID, 10))
+	}
+}
+
+// MetadataFromHeaders reads the metadata from message headers. It returns
+// false for messages published without them (or with malformed ones), whose
+// payload must be decoded instead.
+func MetadataFromHeaders(h nats.Header) (Metadata, bool) {
+	if h.Get(HeaderEvent) == "" {
+		return Metadata{}, false
+	}
+
+	block, err := strconv.ParseUint(h.Get(HeaderBlock), 10, 64)
+	if err != nil {
+		return Metadata{}, false
+	}
+	logIndex, err := strconv.ParseUint(h.Get(HeaderLogIndex), 10, 0)
+	if err != nil {
+		return Metadata{}, false
+	}
+	var chainID int64
+	if v := h.Get(HeaderChainID); v != "" {
+		if chainID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return Metadata{}, false
+		}
+	}
+
+	return Metadata{
+		Block:     block,
+		TxHash:    h.Get(HeaderTxHash),
+		LogIndex:  uint(logIndex),
+		EventName: h.Get(HeaderEvent),
+		Contract:  h.Get(HeaderContract),
+		ChainID:   chainID,
+	}, true
+}
@@ -0,0 +1,51 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// TestMetadataHeadersRoundTrip tests that metadata written to headers is
+// read back unchanged, with the contract lowercased.
+func TestMetadataHeadersRoundTrip(t *testing.T) {
+	event := models.Event{
+		Block:        65000000,
+		TxHash:       "0xabc",
+		LogIndex:     312,
+		EventName:    "OrderFilled",
+		ContractAddr: "0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E",
+	}
+
+	for _, chainID := range []int64{137, 0} {
+		h := nats.Header{}
+		MetadataOf(event, chainID).SetHeaders(h)
+
+		meta, ok := MetadataFromHeaders(h)
+		require.True(t, ok)
+		require.Equal(t, Metadata{
+			Block:     65000000,
+			TxHash:    "0xabc",
+			LogIndex:  312,
+			EventName: "OrderFilled",
+			Contract:  "0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e",
+			ChainID:   chainID,
+		}, meta)
+	}
+}
+
+// TestMetadataFromHeadersMissing tests that messages without metadata
+// headers, or with malformed ones, fall back to the payload.
+func TestMetadataFromHeadersMissing(t *testing.T) {
+	_, ok := MetadataFromHeaders(nil)
+	require.False(t, ok)
+
+	h := nats.Header{}
+	MetadataOf(models.Event{EventName: "OrderFilled", Block: 1}, 137).SetHeaders(h)
+	h.Set(HeaderBlock, "latest")
+	_, ok = MetadataFromHeaders(h)
+	require.False(t, ok)
+}
@@ -0,0 +1,560 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Event message field numbers, see event.proto. Payload messages use the
+// numbers inline in their encode and decode functions.
+const (
+	fieldBlock          protowire.Number = 1
+	fieldBlockHash      protowire.Number = 2
+	fieldTxHash         protowire.Number = 3
+	fieldTxIndex        protowire.Number = 4
+	fieldLogIndex       protowire.Number = 5
+	fieldContract       protowire.Number = 6
+	fieldEventName      protowire.Number = 7
+	fieldEventSignature protowire.Number = 8
+	fieldTimestamp      protowire.Number = 9
+	fieldSuccess        protowire.Number = 10
+	fieldProcessedAt    protowire.Number = 11
+
+	fieldOrderFilled          protowire.Number = 20
+	fieldOrderCancelled       protowire.Number = 21
+	fieldTokenRegistered      protowire.Number = 22
+	fieldTransferSingle       protowire.Number = 23
+	fieldTransferBatch        protowire.Number = 24
+	fieldConditionPreparation protowire.Number = 25
+	fieldConditionResolution  protowire.Number = 26
+	fieldPositionSplit        protowire.Number = 27
+	fieldPositionsMerge       protowire.Number = 28
+	fieldERC20Transfer        protowire.Number = 29
+	fieldPayoutRedemption     protowire.Number = 30
+	fieldJSONPayload          protowire.Number = 100
+)
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string        { return "protobuf" }
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufCodec) Marshal(event models.Event) ([]byte, error) {
+	e := &encoder{}
+	e.varint(fieldBlock, event.Block)
+	e.str(fieldBlockHash, event.BlockHash)
+	e.str(fieldTxHash, event.TxHash)
+	e.varint(fieldTxIndex, uint64(event.TxIndex))
+	e.varint(fieldLogIndex, uint64(event.LogIndex))
+	e.str(fieldContract, event.ContractAddr)
+	e.str(fieldEventName, event.EventName)
+	e.str(fieldEventSignature, event.EventSig)
+	e.varint(fieldTimestamp, event.Timestamp)
+	e.boolean(fieldSuccess, event.Success)
+	if !event.ProcessedAt.IsZero() {
+		e.varint(fieldProcessedAt, uint64(event.ProcessedAt.UnixNano()))
+	}
+	encodePayload(e, event.Payload)
+	return e.b, e.err
+}
+
+func (protobufCodec) Unmarshal(data []byte, event *models.Event) error {
+	*event = models.Event{}
+	return rangeFields(data, func(f field) error {
+		switch f.num {
+		case fieldBlock:
+			event.Block = f.varint
+		case fieldBlockHash:
+			event.BlockHash = f.str()
+		case fieldTxHash:
+			event.TxHash = f.str()
+		case fieldTxIndex:
+			event.TxIndex = uint(f.varint)
+		case fieldLogIndex:
+			event.LogIndex = uint(f.varint)
+		case fieldContract:
+			event.ContractAddr = f.str()
+		case fieldEventName:
+			event.EventName = f.str()
+		case fieldEventSignature:
+			event.EventSig = f.str()
+		case fieldTimestamp:
+			event.Timestamp = f.varint
+		case fieldSuccess:
+			event.Success = f.varint != 0
+		case fieldProcessedAt:
+			event.ProcessedAt = time.Unix(0, int64(f.varint)).UTC()
+		default:
+			payload, err := decodePayload(f)
+			if err != nil {
+				return err
+			}
+			if payload != nil {
+				event.Payload = payload
+			}
+		}
+		return nil
+	})
+}
+
+// encodePayload sets the payload oneof. Payload types without a message are
+// carried as JSON.
+func encodePayload(e *encoder, payload any) {
+	// Handlers return values, but accept pointers to them as well
+	if v := reflect.ValueOf(payload); v.Kind() == reflect.Pointer && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		payload = v.Elem().Interface()
+	}
+
+	switch p := payload.(type) {
+	case nil:
+	case models.OrderFilled:
+		e.message(fieldOrderFilled, func(e *encoder) {
+			e.str(1, p.OrderHash)
+			e.str(2, p.Maker)
+			e.str(3, p.Taker)
+			e.bigInt(4, p.MakerAssetID)
+			e.bigInt(5, p.TakerAssetID)
+			e.bigInt(6, p.MakerAmountFilled)
+			e.bigInt(7, p.TakerAmountFilled)
+			e.bigInt(8, p.Fee)
+			e.str(9, p.Side)
+			e.str(10, p.Price)
+			e.boolean(11, p.IsOperatorFill)
+		})
+	case models.OrderCancelled:
+		e.message(fieldOrderCancelled, func(e *encoder) {
+			e.str(1, p.OrderHash)
+			e.str(2, p.Maker)
+			e.bigInt(3, p.Remaining)
+		})
+	case models.TokenRegistered:
+		e.message(fieldTokenRegistered, func(e *encoder) {
+			e.bigInt(1, p.Token0)
+			e.bigInt(2, p.Token1)
+			e.str(3, p.ConditionID)
+		})
+	case models.TransferSingle:
+		e.message(fieldTransferSingle, func(e *encoder) {
+			e.str(1, p.Operator)
+			e.str(2, p.From)
+			e.str(3, p.To)
+			e.bigInt(4, p.TokenID)
+			e.bigInt(5, p.Amount)
+			e.str(6, p.TransferKind)
+		})
+	case models.TransferBatch:
+		e.message(fieldTransferBatch, func(e *encoder) {
+			e.str(1, p.Operator)
+			e.str(2, p.From)
+			e.str(3, p.To)
+			e.bigInts(4, p.TokenIDs)
+			e.bigInts(5, p.Amounts)
+			e.str(6, p.TransferKind)
+		})
+	case models.ConditionPreparation:
+		e.message(fieldConditionPreparation, func(e *encoder) {
+			e.str(1, p.ConditionID)
+			e.str(2, p.Oracle)
+			e.str(3, p.QuestionID)
+			e.varint(4, uint64(p.OutcomeSlotCount))
+		})
+	case models.ConditionResolution:
+		e.message(fieldConditionResolution, func(e *encoder) {
+			e.str(1, p.ConditionID)
+			e.str(2, p.Oracle)
+			e.str(3, p.QuestionID)
+			e.varint(4, uint64(p.OutcomeSlotCount))
+			e.bigInts(5, p.PayoutNumerators)
+		})
+	case models.PositionSplit:
+		e.message(fieldPositionSplit, func(e *encoder) { encodePositionChange(e, p) })
+	case models.PositionsMerge:
+		e.message(fieldPositionsMerge, func(e *encoder) { encodePositionChange(e, models.PositionSplit(p)) })
+	case models.ERC20Transfer:
+		e.message(fieldERC20Transfer, func(e *encoder) {
+			e.str(1, p.Token)
+			e.str(2, p.From)
+			e.str(3, p.To)
+			e.bigInt(4, p.Value)
+		})
+	case models.PayoutRedemption:
+		e.message(fieldPayoutRedemption, func(e *encoder) {
+			e.str(1, p.Redeemer)
+			e.str(2, p.CollateralToken)
+			e.str(3, p.ParentCollectionID)
+			e.str(4, p.ConditionID)
+			e.bigInts(5, p.IndexSets)
+			e.bigInt(6, p.Payout)
+			e.boolean(7, p.IsRootCollection)
+		})
+	default:
+		data, err := json.Marshal(p)
+		if err != nil {
+			e.fail(fmt.Errorf("failed to encode %T payload as JSON: %w", p, err))
+			return
+		}
+		e.bytes(fieldJSONPayload, data)
+	}
+}
+
+// encodePositionChange encodes the PositionChange message shared by
+// PositionSplit and PositionsMerge.
+func encodePositionChange(e *encoder, p models.PositionSplit) {
+	e.str(1, p.Stakeholder)
+	e.str(2, p.CollateralToken)
+	e.str(3, p.ParentCollectionID)
+	e.str(4, p.ConditionID)
+	e.bigInts(5, p.Partition)
+	e.bigInt(6, p.Amount)
+	e.boolean(7, p.IsRootCollection)
+}
+
+// decodePayload decodes a payload oneof field. It returns nil for fields
+// that are not part of the oneof.
+func decodePayload(f field) (any, error) {
+	switch f.num {
+	case fieldOrderFilled:
+		var p models.OrderFilled
+		err := rangeFields(f.bytes, func(f field) error {
+			switch f.num {
+			case 1:
+				p.OrderHash = f.str()
+			case 2:
+				p.Maker = f.str()
+			case 3:
+				p.Taker = f.str()
+			case 4:
+				p.MakerAssetID = f.bigInt()
+			case 5:
+				p.TakerAssetID = f.bigInt()
+			case 6:
+				p.MakerAmountFilled = f.bigInt()
+			case 7:
+				p.TakerAmountFilled = f.bigInt()
+			case 8:
+				p.Fee = f.bigInt()
+			case 9:
+				p.Side = f.str()
+			case 10:
+				p.Price = f.str()
+			case 11:
+				p.IsOperatorFill = f.varint != 0
+			}
+			return nil
+		})
+		return p, err
+	case fieldOrderCancelled:
+		var p models.OrderCancelled
+		err := rangeFields(f.bytes, func(f field) error {
+			switch f.num {
+			case 1:
+				p.OrderHash = f.str()
+			case 2:
+				p.Maker = f.str()
+			case 3:
+				p.Remaining = f.bigInt()
+			}
+			return nil
+		})
+		return p, err
+	case fieldTokenRegistered:
+		var p models.TokenRegistered
+		err := rangeFields(f.bytes, func(f field) error {
+			switch f.num {
+			case 1:
+				p.Token0 = f.bigInt()
+			case 2:
+				p.Token1 = f.bigInt()
+			case 3:
+				p.ConditionID = f.str()
+			}
+			return nil
+		})
+		return p, err
+	case fieldTransferSingle:
+		var p models.TransferSingle
+		err := rangeFields(f.bytes, func(f field) error {
+			switch f.num {
+			case 1:
+				p.Operator = f.str()
+			case 2:
+				p.From = f.str()
+			case 3:
+				p.To = f.str()
+			case 4:
+				p.TokenID = f.bigInt()
+			case 5:
+				p.Amount = f.bigInt()
+			case 6:
+				p.TransferKind = f.str()
+			}
+			return nil
+		})
+		return p, err
+	case fieldTransferBatch:
+		var p models.TransferBatch
+		err := rangeFields(f.bytes, func(f field) error {
+			switch f.num {
+			case 1:
+				p.Operator = f.str()
+			case 2:
+				p.From = f.str()
+			case 3:
+				p.To = f.str()
+			case 4:
+				p.TokenIDs = append(p.TokenIDs, f.bigInt())
+			case 5:
+				p.Amounts = append(p.Amounts, f.bigInt())
+			case 6:
+				p.TransferKind = f.str()
+			}
+			return nil
+		})
+		return p, err
+	case fieldConditionPreparation:
+		var p models.ConditionPreparation
+		err := rangeFields(f.bytes, func(f field) error {
+			switch f.num {
+			case 1:
+				p.ConditionID = f.str()
+			case 2:
+				p.Oracle = f.str()
+			case 3:
+				p.QuestionID = f.str()
+			case 4:
+				p.OutcomeSlotCount = uint32(f.varint)
+			}
+			return nil
+		})
+		return p, err
+	case fieldConditionResolution:
+		var p models.ConditionResolution
+		err := rangeFields(f.bytes, func(f field) error {
+			switch f.num {
+			case 1:
+				p.ConditionID = f.str()
+			case 2:
+				p.Oracle = f.str()
+			case 3:
+				p.QuestionID = f.str()
+			case 4:
+				p.OutcomeSlotCount = uint32(f.varint)
+			case 5:
+				p.PayoutNumerators = append(p.PayoutNumerators, f.bigInt())
+			}
+			return nil
+		})
+		return p, err
+	case fieldPositionSplit:
+		p, err := decodePositionChange(f.bytes)
+		return p, err
+	case fieldPositionsMerge:
+		p, err := decodePositionChange(f.bytes)
+		return models.PositionsMerge(p), err
+	case fieldERC20Transfer:
+		var p models.ERC20Transfer
+		err := rangeFields(f.bytes, func(f field) error {
+			switch f.num {
+			case 1:
+				p.Token = f.str()
+			case 2:
+				p.From = f.str()
+			case 3:
+				p.To = f.str()
+			case 4:
+				p.Value = f.bigInt()
+			}
+			return nil
+		})
+		return p, err
+	case fieldPayoutRedemption:
+		var p models.PayoutRedemption
+		err := rangeFields(f.bytes, func(f field) error {
+			switch f.num {
+			case 1:
+				p.Redeemer = f.str()
+			case 2:
+				p.CollateralToken = f.str()
+			case 3:
+				p.ParentCollectionID = f.str()
+			case 4:
+				p.ConditionID = f.str()
+			case 5:
+				p.IndexSets = append(p.IndexSets, f.bigInt())
+			case 6:
+				p.Payout = f.bigInt()
+			case 7:
+				p.IsRootCollection = f.varint != 0
+			}
+			return nil
+		})
+		return p, err
+	case fieldJSONPayload:
+		if !json.Valid(f.bytes) {
+			return nil, errors.New("failed to decode JSON payload: invalid JSON")
+		}
+		return rawPayload(bytes.Clone(f.bytes)), nil
+	default:
+		return nil, nil // Unknown field from a newer publisher
+	}
+}
+
+// decodePositionChange decodes the PositionChange message shared by
+// PositionSplit and PositionsMerge.
+func decodePositionChange(data []byte) (models.PositionSplit, error) {
+	var p models.PositionSplit
+	err := rangeFields(data, func(f field) error {
+		switch f.num {
+		case 1:
+			p.Stakeholder = f.str()
+		case 2:
+			p.CollateralToken = f.str()
+		case 3:
+			p.ParentCollectionID = f.str()
+		case 4:
+			p.ConditionID = f.str()
+		case 5:
+			p.Partition = append(p.Partition, f.bigInt())
+		case 6:
+			p.Amount = f.bigInt()
+		case 7:
+			p.IsRootCollection = f.varint != 0
+		}
+		return nil
+	})
+	return p, err
+}
+
+// encoder appends protobuf fields, omitting zero scalars as proto3 does. The
+// first error is kept and reported by Marshal.
+type encoder struct {
+	b   []byte
+	err error
+}
+
+func (e *encoder) fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *encoder) varint(num protowire.Number, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.b = protowire.AppendTag(e.b, num, protowire.VarintType)
+	e.b = protowire.AppendVarint(e.b, v)
+}
+
+func (e *encoder) boolean(num protowire.Number, v bool) {
+	if v {
+		e.varint(num, 1)
+	}
+}
+
+func (e *encoder) str(num protowire.Number, v string) {
+	if v == "" {
+		return
+	}
+	e.b = protowire.AppendTag(e.b, num, protowire.BytesType)
+	e.b = protowire.AppendString(e.b, v)
+}
+
+// bytes appends a length-delimited field, even when empty.
+func (e *encoder) bytes(num protowire.Number, v []byte) {
+	e.b = protowire.AppendTag(e.b, num, protowire.BytesType)
+	e.b = protowire.AppendBytes(e.b, v)
+}
+
+// bigInt appends a non-negative integer as big-endian bytes. A nil integer
+// is omitted and zero is an empty field.
+func (e *encoder) bigInt(num protowire.Number, v *big.Int) {
+	if v == nil {
+		return
+	}
+	if v.Sign() < 0 {
+		e.fail(fmt.Errorf("cannot encode negative integer %s in field %d", v, num))
+		return
+	}
+	e.bytes(num, v.Bytes())
+}
+
+// bigInts appends a repeated integer field. Nil elements are encoded as zero.
+func (e *encoder) bigInts(num protowire.Number, vs []*big.Int) {
+	for _, v := range vs {
+		if v == nil {
+			v = new(big.Int)
+		}
+		e.bigInt(num, v)
+	}
+}
+
+// message appends a nested message, even when empty so a oneof member is
+// still set.
+func (e *encoder) message(num protowire.Number, encode func(*encoder)) {
+	m := &encoder{}
+	encode(m)
+	if m.err != nil {
+		e.fail(m.err)
+		return
+	}
+	e.bytes(num, m.b)
+}
+
+// field is a decoded varint or length-delimited field.
+type field struct {
+	num    protowire.Number
+	varint uint64
+	bytes  []byte
+}
+
+func (f field) str() string {
+	return string(f.bytes)
+}
+
+func (f field) bigInt() *big.Int {
+	return new(big.Int).SetBytes(f.bytes)
+}
+
+// rangeFields calls fn for every varint and length-delimited field of msg in
+// order. Fields of other wire types are skipped.
+func rangeFields(msg []byte, fn func(f field) error) error {
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return fmt.Errorf("failed to decode protobuf tag: %w", protowire.ParseError(n))
+		}
+		msg = msg[n:]
+
+		f := field{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(msg)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(msg)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, msg)
+		}
+		if n < 0 {
+			return fmt.Errorf("failed to decode protobuf field %d: %w", num, protowire.ParseError(n))
+		}
+		msg = msg[n:]
+
+		if typ != protowire.VarintType && typ != protowire.BytesType {
+			continue
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
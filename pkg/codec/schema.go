@@ -0,0 +1,82 @@
+package codec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HeaderSchemaVersion is the NATS header carrying the schema version of a
+// message, e.g. "v2". Messages without it are v1.
+const HeaderSchemaVersion = "PM-Schema-Version"
+
+// SchemaVersion versions the subject layout and payload of published events
+// together.
+//
+// Compatibility rules:
+//   - A released version never changes: its subject layout, field names and
+//     field types stay as they are for as long as it is published.
+//   - Adding an optional payload field is compatible and needs no new
+//     version; consumers must ignore fields they do not know.
+//   - Removing or renaming a field, changing its type or meaning, or
+//     changing the subject layout requires a new version.
+//   - v1 subjects carry no version token ({prefix}.{Event}.{contract}), as
+//     they predate versioning; later versions insert theirs after the
+//     prefix ({prefix}.v2.{Event}.{contract}).
+//   - During a migration the indexer publishes several versions at once and
+//     every consumer accepts exactly one of them, so each event is handled
+//     once. A consumer accepting several versions is only meant for a
+//     stream that switches from one version to the next.
+type SchemaVersion int
+
+// Schema versions.
+const (
+	// SchemaV1 is the original schema and the default.
+	SchemaV1 SchemaVersion = 1
+
+	// SchemaV2 is the next schema. Its payload is still identical to v1;
+	// field changes are made here, never in v1.
+	SchemaV2 SchemaVersion = 2
+
+	// LatestSchema is the newest schema version.
+	LatestSchema = SchemaV2
+)
+
+// String returns the version as it appears in subjects and headers: "v1".
+func (v SchemaVersion) String() string {
+	return "v" + strconv.Itoa(int(v))
+}
+
+// ParseSchemaVersion parses a version such as "v2". An empty string is v1.
+func ParseSchemaVersion(s string) (SchemaVersion, error) {
+	if s == "" {
+		return SchemaV1, nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(s), "v"))
+	if err != nil || n < int(SchemaV1) || n > int(LatestSchema) {
+		return 0, fmt.Errorf("unknown schema version %q (want v1 to %s)", s, LatestSchema)
+	}
+	return SchemaVersion(n), nil
+}
+
+// ParseSchemaVersions parses a list of versions, rejecting duplicates. An
+// empty list is v1 alone.
+func ParseSchemaVersions(list []string) ([]SchemaVersion, error) {
+	if len(list) == 0 {
+		return []SchemaVersion{SchemaV1}, nil
+	}
+	versions := make([]SchemaVersion, 0, len(list))
+	for _, s := range list {
+		v, err := ParseSchemaVersion(s)
+		if err != nil {
+			return nil, err
+		}
+		for _, seen := range versions {
+			if seen == v {
+				return nil, fmt.Errorf("duplicate schema version %s", v)
+			}
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
@@ -0,0 +1,38 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseSchemaVersion tests that versions parse from their subject and
+// header form, that an absent version is v1, and that unknown versions are
+// rejected.
+func TestParseSchemaVersion(t *testing.T) {
+	for s, want := range map[string]SchemaVersion{"": SchemaV1, "v1": SchemaV1, "v2": SchemaV2, "V2": SchemaV2} {
+		v, err := ParseSchemaVersion(s)
+		require.NoError(t, err, s)
+		require.Equal(t, want, v, s)
+	}
+	for _, s := range []string{"v0", "v3", "2.0", "latest"} {
+		_, err := ParseSchemaVersion(s)
+		require.Error(t, err, s)
+	}
+	require.Equal(t, "v2", SchemaV2.String())
+}
+
+// TestParseSchemaVersions tests that an empty list defaults to v1 and that
+// duplicates are rejected.
+func TestParseSchemaVersions(t *testing.T) {
+	versions, err := ParseSchemaVersions(nil)
+	require.NoError(t, err)
+	require.Equal(t, []SchemaVersion{SchemaV1}, versions)
+
+	versions, err = ParseSchemaVersions([]string{"v1", "v2"})
+	require.NoError(t, err)
+	require.Equal(t, []SchemaVersion{SchemaV1, SchemaV2}, versions)
+
+	_, err = ParseSchemaVersions([]string{"v2", "V2"})
+	require.Error(t, err)
+}
@@ -24,6 +24,11 @@ type ChainConfig struct {
 type ContractAddresses struct {
 	CTFExchange       string `json:"ctfExchange"`
 	ConditionalTokens string `json:"conditionalTokens"`
+
+	// CollateralToken (USDC) is optional. When set, its Transfer events to
+	// or from the contracts above are indexed. It is not a monitored
+	// contract itself: its full log volume is never fetched.
+	CollateralToken string `json:"collateralToken,omitempty"`
 }
 
 // Config holds all chain configurations
@@ -0,0 +1,174 @@
+// Package ctfmath implements the Gnosis Conditional Token Framework ID
+// derivations (CTHelpers) locally, so outcome tokens can be mapped to their
+// condition and outcome without contract calls.
+//
+// Collection IDs are points on the alt_bn128 curve (y² = x³ + 3) compressed
+// into 32 bytes, which makes nested collections commutative. Position IDs
+// (the ERC1155 token IDs) hash the collateral token with a collection ID.
+package ctfmath
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// fieldModulus is the alt_bn128 base field modulus P.
+	fieldModulus, _ = new(big.Int).SetString("21888242871839275222246405745257275088696311157297823662689037894645226208583", 10)
+
+	// sqrtExponent is (P+1)/4; P ≡ 3 (mod 4) so a^((P+1)/4) is a square root.
+	sqrtExponent = new(big.Int).Rsh(new(big.Int).Add(fieldModulus, big.NewInt(1)), 2)
+
+	curveB = big.NewInt(3)
+
+	// ErrInvalidCollectionID is returned when a parent collection ID does not
+	// decode to a curve point.
+	ErrInvalidCollectionID = errors.New("invalid parent collection ID")
+
+	// ErrInvalidIndexSet is returned for an index set selecting no outcome.
+	ErrInvalidIndexSet = errors.New("invalid index set")
+)
+
+// ConditionID returns keccak256(oracle ‖ questionId ‖ outcomeSlotCount).
+func ConditionID(oracle common.Address, questionID common.Hash, outcomeSlotCount uint64) common.Hash {
+	return crypto.Keccak256Hash(
+		oracle.Bytes(),
+		questionID.Bytes(),
+		common.LeftPadBytes(new(big.Int).SetUint64(outcomeSlotCount).Bytes(), 32),
+	)
+}
+
+// CollectionID returns the collection ID of indexSet under conditionID,
+// nested in parentCollectionID (the zero hash for the root collection).
+func CollectionID(parentCollectionID, conditionID common.Hash, indexSet *big.Int) (common.Hash, error) {
+	// Hash to a curve point: increment x until x³ + 3 is a square
+	h := crypto.Keccak256(conditionID.Bytes(), common.LeftPadBytes(indexSet.Bytes(), 32))
+	x1 := new(big.Int).SetBytes(h)
+	odd := x1.Bit(255) == 1
+	var y1, yy *big.Int
+	for {
+		x1.Add(x1, big.NewInt(1))
+		x1.Mod(x1, fieldModulus)
+		yy = curveRHS(x1)
+		y1 = new(big.Int).Exp(yy, sqrtExponent, fieldModulus)
+		if isSquareRoot(y1, yy) {
+			break
+		}
+	}
+	if odd != (y1.Bit(0) == 1) {
+		y1.Sub(fieldModulus, y1)
+	}
+
+	x2 := parentCollectionID.Big()
+	if x2.Sign() != 0 {
+		// Decompress the parent: bit 254 carries the parity of y
+		odd = x2.Bit(254) == 1 || x2.Bit(255) == 1
+		x2.SetBit(x2, 255, 0)
+		x2.SetBit(x2, 254, 0)
+		yy = curveRHS(x2)
+		y2 := new(big.Int).Exp(yy, sqrtExponent, fieldModulus)
+		if odd != (y2.Bit(0) == 1) {
+			y2.Sub(fieldModulus, y2)
+		}
+		if !isSquareRoot(y2, yy) {
+			return common.Hash{}, ErrInvalidCollectionID
+		}
+		x1, y1 = pointAdd(x1, y1, x2, y2)
+	}
+
+	// Compress: store the parity of y in bit 254
+	if y1.Bit(0) == 1 {
+		x1.SetBit(x1, 254, 1)
+	}
+	return common.BigToHash(x1), nil
+}
+
+// PositionID returns the ERC1155 token ID of a collection backed by
+// collateralToken: keccak256(collateralToken ‖ collectionId).
+func PositionID(collateralToken common.Address, collectionID common.Hash) *big.Int {
+	return crypto.Keccak256Hash(collateralToken.Bytes(), collectionID.Bytes()).Big()
+}
+
+// PositionIDs returns the position IDs of the index sets of a partition of
+// conditionID nested in parentCollectionID, in partition order: the tokens
+// a PositionSplit mints and a PositionsMerge burns.
+func PositionIDs(collateralToken common.Address, parentCollectionID, conditionID common.Hash, partition []*big.Int) ([]*big.Int, error) {
+	ids := make([]*big.Int, len(partition))
+	for i, indexSet := range partition {
+		if indexSet == nil || indexSet.Sign() <= 0 {
+			return nil, ErrInvalidIndexSet
+		}
+		collectionID, err := CollectionID(parentCollectionID, conditionID, indexSet)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = PositionID(collateralToken, collectionID)
+	}
+	return ids, nil
+}
+
+// OutcomeIndex finds which single outcome of a root-level condition a token
+// represents. It returns false when the token is not a single-outcome
+// position of the condition for this collateral (e.g. wrapped collateral).
+func OutcomeIndex(collateralToken common.Address, conditionID common.Hash, tokenID *big.Int, outcomeSlotCount int) (int, bool) {
+	for i := 0; i < outcomeSlotCount; i++ {
+		indexSet := new(big.Int).Lsh(big.NewInt(1), uint(i))
+		collectionID, err := CollectionID(common.Hash{}, conditionID, indexSet)
+		if err != nil {
+			return 0, false
+		}
+		if PositionID(collateralToken, collectionID).Cmp(tokenID) == 0 {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// curveRHS returns x³ + 3 mod P.
+func curveRHS(x *big.Int) *big.Int {
+	yy := new(big.Int).Exp(x, big.NewInt(3), fieldModulus)
+	yy.Add(yy, curveB)
+	return yy.Mod(yy, fieldModulus)
+}
+
+// isSquareRoot reports whether y² = yy mod P.
+func isSquareRoot(y, yy *big.Int) bool {
+	sq := new(big.Int).Mul(y, y)
+	return sq.Mod(sq, fieldModulus).Cmp(yy) == 0
+}
+
+// pointAdd adds two affine alt_bn128 points, as the ecAdd precompile does.
+func pointAdd(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	var slope *big.Int
+	if x1.Cmp(x2) == 0 {
+		if y1.Cmp(y2) != 0 {
+			// P + (-P) is the point at infinity, encoded as (0, 0)
+			return new(big.Int), new(big.Int)
+		}
+		// Doubling: 3x² / 2y
+		num := new(big.Int).Mul(x1, x1)
+		num.Mul(num, big.NewInt(3))
+		den := new(big.Int).Lsh(y1, 1)
+		slope = num.Mul(num, den.ModInverse(den, fieldModulus))
+	} else {
+		num := new(big.Int).Sub(y2, y1)
+		den := new(big.Int).Sub(x2, x1)
+		den.Mod(den, fieldModulus)
+		slope = num.Mul(num, den.ModInverse(den, fieldModulus))
+	}
+	slope.Mod(slope, fieldModulus)
+
+	x3 := new(big.Int).Mul(slope, slope)
+	x3.Sub(x3, x1)
+	x3.Sub(x3, x2)
+	x3.Mod(x3, fieldModulus)
+
+	y3 := new(big.Int).Sub(x1, x3)
+	y3.Mul(y3, slope)
+	y3.Sub(y3, y1)
+	y3.Mod(y3, fieldModulus)
+	return x3, y3
+}
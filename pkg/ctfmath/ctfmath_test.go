@@ -0,0 +1,139 @@
+package ctfmath
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// Vectors below were computed with an independent (Python) implementation
+// of CTHelpers.getConditionId/getCollectionId/getPositionId.
+var (
+	usdc       = common.HexToAddress("0x2791Bca1f2de4661ED88A30C99A7a9449Aa84174")
+	oracle     = common.HexToAddress("0x6A9D222616C90FcA5754cd1333cFD9b7fb6a4F74")
+	questionID = common.HexToHash("0xe3b1bc389210504ebcb9cffe4b0ed06ccac50561e0f24abb6379984cec030f00")
+	conditionA = common.HexToHash("0x0e0df99b0db4a4b54eb056e47b6e618778dc9131677c0498a078bbbe9eaf6ac8")
+	conditionB = common.HexToHash("0xde79b7f16565b2678a0f76e48649d08cd1bd03fcb1282f7a9eed181fba9e33e1")
+)
+
+func mustBig(t *testing.T, s string) *big.Int {
+	t.Helper()
+	n, ok := new(big.Int).SetString(s, 10)
+	require.True(t, ok)
+	return n
+}
+
+// TestConditionID tests the condition ID hash.
+func TestConditionID(t *testing.T) {
+	require.Equal(t, conditionA, ConditionID(oracle, questionID, 2))
+	require.Equal(t, conditionB, ConditionID(oracle, common.BigToHash(big.NewInt(7)), 3))
+}
+
+// TestBinaryMarketPositionIDs tests the collection and position IDs of both
+// outcomes of a binary market backed by USDC.
+func TestBinaryMarketPositionIDs(t *testing.T) {
+	tests := []struct {
+		indexSet   int64
+		collection string
+		position   string
+	}{
+		{
+			indexSet:   1,
+			collection: "0x48ace824e10e14efaafa76d089e614784ad23268634c79d69c950340ecb66fdf",
+			position:   "82920568567095788639981848039841706550389990987498351315524354004233063046687",
+		},
+		{
+			indexSet:   2,
+			collection: "0x6b33dfeef4af83424b48fcb7de4fcec3a5d092b31c6f4bf4d2b04873a19cce37",
+			position:   "38507028285546991471236137912036679889560729235078357760005666316730865297203",
+		},
+	}
+
+	for _, tt := range tests {
+		collectionID, err := CollectionID(common.Hash{}, conditionA, big.NewInt(tt.indexSet))
+		require.NoError(t, err)
+		require.Equal(t, common.HexToHash(tt.collection), collectionID)
+		require.Equal(t, mustBig(t, tt.position), PositionID(usdc, collectionID))
+	}
+}
+
+// TestNestedCollectionIsCommutative tests that nesting collections yields
+// the same ID regardless of the order the conditions are applied in.
+func TestNestedCollectionIsCommutative(t *testing.T) {
+	parentA, err := CollectionID(common.Hash{}, conditionA, big.NewInt(1))
+	require.NoError(t, err)
+	parentB, err := CollectionID(common.Hash{}, conditionB, big.NewInt(2))
+	require.NoError(t, err)
+
+	nestedAB, err := CollectionID(parentA, conditionB, big.NewInt(2))
+	require.NoError(t, err)
+	nestedBA, err := CollectionID(parentB, conditionA, big.NewInt(1))
+	require.NoError(t, err)
+
+	want := common.HexToHash("0x174a71a2cdabd5cba6d19754faa49a19694f7ef34472d81db4873c33bdf6385e")
+	require.Equal(t, want, nestedAB)
+	require.Equal(t, want, nestedBA)
+}
+
+// TestPositionIDs tests the position IDs of the partitions a split or
+// merge can use: both outcomes of a root collection, a nested collection
+// and the full index set of a binary condition.
+func TestPositionIDs(t *testing.T) {
+	yes := mustBig(t, "82920568567095788639981848039841706550389990987498351315524354004233063046687")
+	no := mustBig(t, "38507028285546991471236137912036679889560729235078357760005666316730865297203")
+
+	ids, err := PositionIDs(usdc, common.Hash{}, conditionA, []*big.Int{big.NewInt(1), big.NewInt(2)})
+	require.NoError(t, err)
+	require.Equal(t, []*big.Int{yes, no}, ids)
+
+	// Partition order is kept
+	ids, err = PositionIDs(usdc, common.Hash{}, conditionA, []*big.Int{big.NewInt(2), big.NewInt(1)})
+	require.NoError(t, err)
+	require.Equal(t, []*big.Int{no, yes}, ids)
+
+	parent, err := CollectionID(common.Hash{}, conditionA, big.NewInt(1))
+	require.NoError(t, err)
+	ids, err = PositionIDs(usdc, parent, conditionB, []*big.Int{big.NewInt(2)})
+	require.NoError(t, err)
+	nested := common.HexToHash("0x174a71a2cdabd5cba6d19754faa49a19694f7ef34472d81db4873c33bdf6385e")
+	require.Equal(t, []*big.Int{PositionID(usdc, nested)}, ids)
+
+	full, err := CollectionID(common.Hash{}, conditionA, big.NewInt(3))
+	require.NoError(t, err)
+	ids, err = PositionIDs(usdc, common.Hash{}, conditionA, []*big.Int{big.NewInt(3)})
+	require.NoError(t, err)
+	require.Equal(t, []*big.Int{PositionID(usdc, full)}, ids)
+}
+
+// TestPositionIDsRejectsInvalidPartitions tests that partitions with an
+// empty index set or under an invalid parent have no position IDs.
+func TestPositionIDsRejectsInvalidPartitions(t *testing.T) {
+	_, err := PositionIDs(usdc, common.Hash{}, conditionA, []*big.Int{big.NewInt(1), big.NewInt(0)})
+	require.ErrorIs(t, err, ErrInvalidIndexSet)
+	_, err = PositionIDs(usdc, common.Hash{}, conditionA, []*big.Int{nil})
+	require.ErrorIs(t, err, ErrInvalidIndexSet)
+
+	// No point has x = 4: 4³ + 3 = 67 is not a square mod P
+	_, err = PositionIDs(usdc, common.BigToHash(big.NewInt(4)), conditionA, []*big.Int{big.NewInt(1)})
+	require.ErrorIs(t, err, ErrInvalidCollectionID)
+}
+
+// TestOutcomeIndex tests mapping token IDs back to outcome indexes.
+func TestOutcomeIndex(t *testing.T) {
+	yes := mustBig(t, "82920568567095788639981848039841706550389990987498351315524354004233063046687")
+	no := mustBig(t, "38507028285546991471236137912036679889560729235078357760005666316730865297203")
+
+	index, ok := OutcomeIndex(usdc, conditionA, yes, 2)
+	require.True(t, ok)
+	require.Equal(t, 0, index)
+
+	index, ok = OutcomeIndex(usdc, conditionA, no, 2)
+	require.True(t, ok)
+	require.Equal(t, 1, index)
+
+	// Different collateral (e.g. wrapped USDC) yields different token IDs
+	_, ok = OutcomeIndex(common.HexToAddress("0x01"), conditionA, yes, 2)
+	require.False(t, ok)
+}
@@ -0,0 +1,103 @@
+// Package events is the registry of Polymarket events shared by the indexer
+// and the consumer. The indexer registers a handler for every entry and the
+// consumer dispatches on the same names, so an event type cannot be added to
+// one side only.
+package events
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/contracts"
+	"github.com/0xkanth/polymarket-indexer/pkg/models"
+)
+
+// Event names, as published in models.Event.EventName and NATS subjects.
+const (
+	OrderFilled          = "OrderFilled"
+	OrderCancelled       = "OrderCancelled"
+	TokenRegistered      = "TokenRegistered"
+	TransferSingle       = "TransferSingle"
+	TransferBatch        = "TransferBatch"
+	ConditionPreparation = "ConditionPreparation"
+	ConditionResolution  = "ConditionResolution"
+	PositionSplit        = "PositionSplit"
+	PositionsMerge       = "PositionsMerge"
+	PayoutRedemption     = "PayoutRedemption"
+	ERC20Transfer        = "ERC20Transfer"
+)
+
+// Contract identifies which configured contract emits an event.
+type Contract string
+
+const (
+	CTFExchange       Contract = "ctfExchange"
+	ConditionalTokens Contract = "conditionalTokens"
+	CollateralToken   Contract = "collateralToken"
+)
+
+// Definition describes one indexed event.
+type Definition struct {
+	Name      string      // Published event name
+	Signature common.Hash // topic0, derived from the contract ABI
+	Contract  Contract    // Contract expected to emit the event
+	NewModel  func() any  // Returns a pointer to the payload model
+}
+
+var (
+	exchangeABI          = mustParseABI(contracts.CTFExchangeMetaData)
+	conditionalTokensABI = mustParseABI(contracts.ConditionalTokensMetaData)
+	erc20ABI             = mustParseABI(contracts.ERC20MetaData)
+)
+
+// registry lists every indexed event in registration order.
+var registry = []Definition{
+	{OrderFilled, exchangeABI.Events["OrderFilled"].ID, CTFExchange, func() any { return &models.OrderFilled{} }},
+	{OrderCancelled, exchangeABI.Events["OrderCancelled"].ID, CTFExchange, func() any { return &models.OrderCancelled{} }},
+	{TokenRegistered, exchangeABI.Events["TokenRegistered"].ID, CTFExchange, func() any { return &models.TokenRegistered{} }},
+	{TransferSingle, conditionalTokensABI.Events["TransferSingle"].ID, ConditionalTokens, func() any { return &models.TransferSingle{} }},
+	{TransferBatch, conditionalTokensABI.Events["TransferBatch"].ID, ConditionalTokens, func() any { return &models.TransferBatch{} }},
+	{ConditionPreparation, conditionalTokensABI.Events["ConditionPreparation"].ID, ConditionalTokens, func() any { return &models.ConditionPreparation{} }},
+	{ConditionResolution, conditionalTokensABI.Events["ConditionResolution"].ID, ConditionalTokens, func() any { return &models.ConditionResolution{} }},
+	{PositionSplit, conditionalTokensABI.Events["PositionSplit"].ID, ConditionalTokens, func() any { return &models.PositionSplit{} }},
+	{PositionsMerge, conditionalTokensABI.Events["PositionsMerge"].ID, ConditionalTokens, func() any { return &models.PositionsMerge{} }},
+	{PayoutRedemption, conditionalTokensABI.Events["PayoutRedemption"].ID, ConditionalTokens, func() any { return &models.PayoutRedemption{} }},
+	{ERC20Transfer, erc20ABI.Events["Transfer"].ID, CollateralToken, func() any { return &models.ERC20Transfer{} }},
+}
+
+// All returns every registered event definition.
+func All() []Definition {
+	return append([]Definition(nil), registry...)
+}
+
+// Lookup returns the definition registered under name.
+func Lookup(name string) (Definition, bool) {
+	for _, def := range registry {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return Definition{}, false
+}
+
+// MustLookup returns the definition registered under name and panics if
+// there is none. It is meant for package-level initialization.
+func MustLookup(name string) Definition {
+	def, ok := Lookup(name)
+	if !ok {
+		panic(fmt.Sprintf("event %q is not registered", name))
+	}
+	return def
+}
+
+// mustParseABI parses the ABI embedded in generated binding metadata.
+func mustParseABI(metadata *bind.MetaData) *abi.ABI {
+	parsed, err := metadata.GetAbi()
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse contract ABI: %v", err))
+	}
+	return parsed
+}
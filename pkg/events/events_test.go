@@ -0,0 +1,42 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegistryEntriesAreUnique tests that no two events share a name or a
+// signature and that every entry is fully populated.
+func TestRegistryEntriesAreUnique(t *testing.T) {
+	names := make(map[string]bool)
+	signatures := make(map[common.Hash]bool)
+
+	for _, def := range All() {
+		require.NotEmpty(t, def.Name)
+		require.NotEqual(t, common.Hash{}, def.Signature, "%s has no signature", def.Name)
+		require.NotEmpty(t, def.Contract, "%s has no contract", def.Name)
+		require.False(t, names[def.Name], "duplicate name %s", def.Name)
+		require.False(t, signatures[def.Signature], "duplicate signature for %s", def.Name)
+		names[def.Name] = true
+		signatures[def.Signature] = true
+
+		model := def.NewModel()
+		require.Equal(t, reflect.Pointer, reflect.TypeOf(model).Kind(), "%s model is not a pointer", def.Name)
+		require.NotSame(t, model, def.NewModel(), "%s model factory reuses its value", def.Name)
+	}
+}
+
+// TestLookup tests lookups of registered and unknown names.
+func TestLookup(t *testing.T) {
+	def, ok := Lookup(OrderFilled)
+	require.True(t, ok)
+	require.Equal(t, CTFExchange, def.Contract)
+	require.Equal(t, common.HexToHash("0xd0a08e8c493f9c94f29311604c9de1b4e8c8d4c06bd0c789af57f2d65bfec0f6"), def.Signature)
+
+	_, ok = Lookup("Unknown")
+	require.False(t, ok)
+	require.Panics(t, func() { MustLookup("Unknown") })
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Addresses are stored and published in lowercase hex so the same wallet
+// never appears under multiple casings. Use common.Address.Hex() (EIP-55
+// checksum) only when presenting an address to users.
+
+// ZeroAddress is the canonical form of the zero address, used as the sender
+// of mints and the recipient of burns.
+var ZeroAddress = FormatAddress(common.Address{})
+
+// FormatAddress returns the canonical lowercase form of an address.
+func FormatAddress(addr common.Address) string {
+	return strings.ToLower(addr.Hex())
+}
+
+// NormalizeAddress converts an address string of any casing to its canonical
+// lowercase form. Strings that are not valid hex addresses are only trimmed
+// and lowercased.
+func NormalizeAddress(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if common.IsHexAddress(addr) {
+		return FormatAddress(common.HexToAddress(addr))
+	}
+	return strings.ToLower(addr)
+}
+
+// ClassifyTransfer returns the transfer kind for a token transfer between
+// two addresses of any casing.
+func ClassifyTransfer(from, to string) string {
+	switch {
+	case NormalizeAddress(from) == ZeroAddress:
+		return TransferKindMint
+	case NormalizeAddress(to) == ZeroAddress:
+		return TransferKindBurn
+	default:
+		return TransferKindTransfer
+	}
+}
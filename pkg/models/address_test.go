@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalizeAddress tests that mixed-case inputs collapse to a single
+// canonical lowercase form.
+func TestNormalizeAddress(t *testing.T) {
+	const canonical = "0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e"
+
+	inputs := []string{
+		"0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E", // checksummed
+		"0x4BFB41D5B3570DEFD03C39A9A4D8DE6BD8B8982E", // uppercase
+		"0x4bfb41d5b3570defd03c39a9a4d8de6bd8b8982e", // lowercase
+		"4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E",   // no prefix
+		" 0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E ",
+	}
+	for _, input := range inputs {
+		require.Equal(t, canonical, NormalizeAddress(input), "input %q", input)
+	}
+
+	require.Equal(t, canonical, FormatAddress(common.HexToAddress(inputs[0])))
+}
+
+// TestNormalizeAddressInvalid tests that non-address strings are lowercased
+// without being padded into an address.
+func TestNormalizeAddressInvalid(t *testing.T) {
+	require.Equal(t, "", NormalizeAddress(""))
+	require.Equal(t, "0xabc", NormalizeAddress("0xABC"))
+}
+
+// TestClassifyTransfer tests mint, burn and transfer classification for
+// zero addresses in any representation.
+func TestClassifyTransfer(t *testing.T) {
+	const wallet = "0x4bFb41d5B3570DeFd03C39a9A4D8dE6Bd8B8982E"
+
+	require.Equal(t, TransferKindMint, ClassifyTransfer(ZeroAddress, wallet))
+	require.Equal(t, TransferKindMint, ClassifyTransfer(common.Address{}.Hex(), wallet))
+	require.Equal(t, TransferKindBurn, ClassifyTransfer(wallet, "0000000000000000000000000000000000000000"))
+	require.Equal(t, TransferKindTransfer, ClassifyTransfer(wallet, wallet))
+	require.Equal(t, "0x0000000000000000000000000000000000000000", ZeroAddress)
+}
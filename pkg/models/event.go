@@ -2,6 +2,8 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
 	"math/big"
 	"time"
 )
@@ -32,11 +34,35 @@ type OrderFilled struct {
 	MakerAmountFilled *big.Int `json:"maker_amount_filled"`
 	TakerAmountFilled *big.Int `json:"taker_amount_filled"`
 	Fee               *big.Int `json:"fee"`
+
+	// Derived fields
+	Side           string `json:"side"`             // buy, sell or unknown, from the maker's perspective
+	Price          string `json:"price,omitempty"`  // collateral per outcome token, empty when undefined
+	IsOperatorFill bool   `json:"is_operator_fill"` // taker is the exchange itself
 }
 
+// Transfer kinds for ERC1155 transfers.
+const (
+	TransferKindMint     = "mint"     // from the zero address (split)
+	TransferKindBurn     = "burn"     // to the zero address (merge or redemption)
+	TransferKindTransfer = "transfer" // wallet to wallet
+)
+
+// OrderFilled sides from the maker's perspective.
+const (
+	OrderSideBuy     = "buy"
+	OrderSideSell    = "sell"
+	OrderSideUnknown = "unknown"
+)
+
 // OrderCancelled represents a CTF Exchange OrderCancelled event.
 type OrderCancelled struct {
 	OrderHash string `json:"order_hash"`
+
+	// Optional enrichment read from the exchange at the event's block.
+	// Empty when enrichment is disabled or the lookup failed.
+	Maker     string   `json:"maker,omitempty"`
+	Remaining *big.Int `json:"remaining,omitempty"`
 }
 
 // TokenRegistered represents a CTF Exchange TokenRegistered event.
@@ -56,28 +82,41 @@ type OrdersMatched struct {
 
 // TransferSingle represents a Conditional Tokens TransferSingle event.
 type TransferSingle struct {
-	Operator string   `json:"operator"`
-	From     string   `json:"from"`
-	To       string   `json:"to"`
-	TokenID  *big.Int `json:"token_id"`
-	Amount   *big.Int `json:"amount"`
+	Operator     string   `json:"operator"`
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	TokenID      *big.Int `json:"token_id"`
+	Amount       *big.Int `json:"amount"`
+	TransferKind string   `json:"transfer_kind"` // mint, burn or transfer
 }
 
 // TransferBatch represents a Conditional Tokens TransferBatch event.
 type TransferBatch struct {
-	Operator string     `json:"operator"`
-	From     string     `json:"from"`
-	To       string     `json:"to"`
-	TokenIDs []*big.Int `json:"token_ids"`
-	Amounts  []*big.Int `json:"amounts"`
+	Operator     string     `json:"operator"`
+	From         string     `json:"from"`
+	To           string     `json:"to"`
+	TokenIDs     []*big.Int `json:"token_ids"`
+	Amounts      []*big.Int `json:"amounts"`
+	TransferKind string     `json:"transfer_kind"` // mint, burn or transfer
+}
+
+// ERC20Transfer represents a collateral token transfer into or out of a
+// monitored contract.
+type ERC20Transfer struct {
+	Token string   `json:"token"`
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Value *big.Int `json:"value"`
 }
 
 // ConditionPreparation represents a new condition/market being created.
+// outcome_slot_count is a JSON number; it was a uint8 before and is now a
+// uint32, so older payloads decode unchanged.
 type ConditionPreparation struct {
 	ConditionID      string `json:"condition_id"`
 	Oracle           string `json:"oracle"`
 	QuestionID       string `json:"question_id"`
-	OutcomeSlotCount uint8  `json:"outcome_slot_count"`
+	OutcomeSlotCount uint32 `json:"outcome_slot_count"`
 }
 
 // ConditionResolution represents a market being resolved.
@@ -85,10 +124,35 @@ type ConditionResolution struct {
 	ConditionID      string     `json:"condition_id"`
 	Oracle           string     `json:"oracle"`
 	QuestionID       string     `json:"question_id"`
-	OutcomeSlotCount uint8      `json:"outcome_slot_count"`
+	OutcomeSlotCount uint32     `json:"outcome_slot_count"`
 	PayoutNumerators []*big.Int `json:"payout_numerators"`
 }
 
+// ValidatePayouts checks that a resolution's payout numerators are usable:
+// at least two outcome slots, exactly one numerator per slot, and at least
+// one non-zero numerator (the denominator is their sum).
+func ValidatePayouts(outcomeSlotCount uint64, payoutNumerators []*big.Int) error {
+	if outcomeSlotCount < 2 {
+		return fmt.Errorf("invalid payouts: outcome slot count %d is less than 2", outcomeSlotCount)
+	}
+	if uint64(len(payoutNumerators)) != outcomeSlotCount {
+		return fmt.Errorf("invalid payouts: got %d numerators for %d outcome slots",
+			len(payoutNumerators), outcomeSlotCount)
+	}
+
+	paid := false
+	for _, numerator := range payoutNumerators {
+		if numerator == nil || numerator.Sign() < 0 {
+			return fmt.Errorf("invalid payouts: missing or negative numerator")
+		}
+		paid = paid || numerator.Sign() > 0
+	}
+	if !paid {
+		return fmt.Errorf("invalid payouts: all %d numerators are zero", len(payoutNumerators))
+	}
+	return nil
+}
+
 // PositionSplit represents minting of conditional tokens.
 type PositionSplit struct {
 	Stakeholder        string     `json:"stakeholder"`
@@ -97,6 +161,7 @@ type PositionSplit struct {
 	ConditionID        string     `json:"condition_id"`
 	Partition          []*big.Int `json:"partition"`
 	Amount             *big.Int   `json:"amount"`
+	IsRootCollection   bool       `json:"is_root_collection"` // split from or merged into collateral
 }
 
 // PositionsMerge represents redemption of conditional tokens.
@@ -107,6 +172,19 @@ type PositionsMerge struct {
 	ConditionID        string     `json:"condition_id"`
 	Partition          []*big.Int `json:"partition"`
 	Amount             *big.Int   `json:"amount"`
+	IsRootCollection   bool       `json:"is_root_collection"` // split from or merged into collateral
+}
+
+// PayoutRedemption represents conditional tokens of a resolved condition
+// redeemed for their payout.
+type PayoutRedemption struct {
+	Redeemer           string     `json:"redeemer"`
+	CollateralToken    string     `json:"collateral_token"`
+	ParentCollectionID string     `json:"parent_collection_id"`
+	ConditionID        string     `json:"condition_id"`
+	IndexSets          []*big.Int `json:"index_sets"`
+	Payout             *big.Int   `json:"payout"`
+	IsRootCollection   bool       `json:"is_root_collection"` // paid out in collateral
 }
 
 // Checkpoint represents the indexer's processing state.
@@ -116,3 +194,11 @@ type Checkpoint struct {
 	LastBlockHash string    `json:"last_block_hash"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
+
+// MonitoredContract represents a contract registered at runtime via the admin API.
+type MonitoredContract struct {
+	Address string          `json:"address"`
+	ABI     json.RawMessage `json:"abi,omitempty"`
+	Events  []string        `json:"events,omitempty"`
+	AddedAt time.Time       `json:"added_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidatePayouts tests that every numerator of a resolution is checked,
+// whatever its position, and that at least one of them must be non-zero.
+func TestValidatePayouts(t *testing.T) {
+	one, zero, minusOne := big.NewInt(1), big.NewInt(0), big.NewInt(-1)
+
+	tests := []struct {
+		name       string
+		slots      uint64
+		numerators []*big.Int
+		err        string
+	}{
+		{name: "binary", slots: 2, numerators: []*big.Int{zero, one}},
+		{name: "split", slots: 3, numerators: []*big.Int{one, one, zero}},
+		{name: "single slot", slots: 1, numerators: []*big.Int{one}, err: "less than 2"},
+		{name: "truncated", slots: 2, numerators: []*big.Int{one}, err: "got 1 numerators for 2 outcome slots"},
+		{name: "all zero", slots: 2, numerators: []*big.Int{zero, zero}, err: "all 2 numerators are zero"},
+		{name: "nil first", slots: 2, numerators: []*big.Int{nil, one}, err: "missing or negative"},
+		{name: "nil after payout", slots: 2, numerators: []*big.Int{one, nil}, err: "missing or negative"},
+		{name: "negative after payout", slots: 2, numerators: []*big.Int{one, minusOne}, err: "missing or negative"},
+		{name: "negative after zero", slots: 3, numerators: []*big.Int{zero, one, minusOne}, err: "missing or negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePayouts(tt.slots, tt.numerators)
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
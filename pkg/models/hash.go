@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// bytes32 values (condition IDs, question IDs, collection IDs, order hashes)
+// are stored and published as 0x-prefixed, lowercase, 64 hex characters so
+// they can be joined across tables without lower()/lpad.
+
+// RootCollectionID is the canonical form of the zero parent collection ID,
+// used for positions split directly from collateral.
+var RootCollectionID = FormatHash(common.Hash{})
+
+// FormatHash returns the canonical form of a bytes32 value.
+func FormatHash(h common.Hash) string {
+	return h.Hex()
+}
+
+// NormalizeHash converts a bytes32 string to its canonical form. Short
+// values such as "0x0" are left-padded and an empty string is the zero
+// value. Strings that are not valid hex of at most 32 bytes are only trimmed
+// and lowercased.
+func NormalizeHash(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	digits := strings.TrimPrefix(s, "0x")
+	if len(digits) > 2*common.HashLength {
+		return s
+	}
+	if len(digits)%2 == 1 {
+		digits = "0" + digits
+	}
+	b, err := hex.DecodeString(digits)
+	if err != nil {
+		return s
+	}
+	return FormatHash(common.BytesToHash(b))
+}
+
+// IsRootCollection reports whether a parent collection ID refers to the root
+// collection (positions backed directly by collateral).
+func IsRootCollection(parentCollectionID string) bool {
+	return NormalizeHash(parentCollectionID) == RootCollectionID
+}
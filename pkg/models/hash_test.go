@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalizeHash tests that the different spellings of a bytes32 value
+// collapse to one canonical form.
+func TestNormalizeHash(t *testing.T) {
+	const canonical = "0x00000000000000000000000000000000000000000000000000000000000000ab"
+
+	for _, input := range []string{
+		"0x00000000000000000000000000000000000000000000000000000000000000AB",
+		"0xab",
+		"AB",
+		"0x0ab",
+		" 0xab ",
+	} {
+		require.Equal(t, canonical, NormalizeHash(input), "input %q", input)
+	}
+
+	require.Equal(t, RootCollectionID, NormalizeHash(""))
+	require.Equal(t, RootCollectionID, NormalizeHash("0x0"))
+	require.Equal(t, "0xnothex", NormalizeHash("0xNotHex"))
+}
+
+// TestIsRootCollection tests root collection detection.
+func TestIsRootCollection(t *testing.T) {
+	require.True(t, IsRootCollection(RootCollectionID))
+	require.True(t, IsRootCollection("0x0"))
+	require.True(t, IsRootCollection(""))
+	require.False(t, IsRootCollection("0x01"))
+}
@@ -0,0 +1,232 @@
+// Package rpcerr classifies Ethereum JSON-RPC errors as transient or
+// permanent, for the callers that retry RPC requests.
+package rpcerr
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// transientMessages are substrings of transport failures, timeouts and
+// overloaded providers.
+var transientMessages = []string{
+	"connection refused",
+	"connection reset",
+	"EOF",
+	"timeout",
+	"TLS handshake timeout",
+	"no such host",
+	"network is unreachable",
+	"429", // Rate limit
+	"502", // Bad gateway
+	"503", // Service unavailable
+	"504", // Gateway timeout
+}
+
+// permanentMessages are substrings of errors a retry answers the same way.
+var permanentMessages = []string{
+	"execution reverted",
+	"insufficient funds",
+	"gas too low",
+	"nonce too low",
+	"replacement transaction underpriced",
+	"already known",
+}
+
+// IsRetryable reports whether err is transient (transport errors, timeouts,
+// HTTP 429 and 5xx, rate limits, internal node errors), so the same request
+// may succeed when sent again. Answers of the node (a missing block or
+// receipt, a reverted call, invalid parameters, history it pruned) and
+// canceled requests are not retryable. Unknown errors are.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == 429 || httpErr.StatusCode >= 500
+	}
+
+	msg := err.Error()
+	for _, transient := range transientMessages {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	for _, permanent := range permanentMessages {
+		if strings.Contains(msg, permanent) {
+			return false
+		}
+	}
+
+	if IsHistoryUnavailable(err) {
+		return false
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.ErrorCode() {
+		case -32000, -32603: // Server error, internal error: may be transient
+			return true
+		case -32005: // Limit exceeded
+			return true
+		}
+		return false
+	}
+
+	// Default: retry on unknown errors
+	return true
+}
+
+// methodNotFoundMessages are lowercase substrings of the errors providers
+// answer for JSON-RPC methods they do not serve.
+var methodNotFoundMessages = []string{
+	"method not found",
+	"does not exist/is not available",
+	"unsupported method",
+	"not supported",
+}
+
+// IsMethodNotFound reports whether err is the answer of a node that does
+// not serve the called JSON-RPC method, which providers report with code
+// -32601 (method not found) or -32004 (method not supported), or only in
+// the message.
+func IsMethodNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.ErrorCode() {
+		case -32601, -32004:
+			return true
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, notFound := range methodNotFoundMessages {
+		if strings.Contains(msg, notFound) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTimeout reports whether err is a request that timed out, on the client
+// (deadline, network timeout) or on the way (HTTP 408 and 504).
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == 408 || httpErr.StatusCode == 504
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "timeout") || strings.Contains(msg, "timed out")
+}
+
+// IsRateLimited reports whether err is a provider refusing a request over
+// its rate limit or quota: HTTP 429, JSON-RPC code -32005 (limit exceeded),
+// or a message saying so.
+func IsRateLimited(err error) bool {
+	if err == nil {
+		return false
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == 429
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && (rpcErr.ErrorCode() == -32005 || rpcErr.ErrorCode() == 429) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "rate limit") || strings.Contains(msg, "too many requests")
+}
+
+// rangeTooLargeMessages are lowercase substrings of the errors providers
+// answer for eth_getLogs queries over their block span or result limits.
+var rangeTooLargeMessages = []string{
+	"query returned more than",   // Geth, Alchemy: "query returned more than 10000 results"
+	"query exceeds max results",  // Various
+	"log response size exceeded", // Alchemy, Infura
+	"block range too large",
+	"block range is too large",
+	"block range is too wide",
+	"exceed maximum block range", // Ankr: "exceed maximum block range: 5000"
+	"eth_getlogs is limited to",
+	"eth_getlogs requests with up to a", // Alchemy free tier
+}
+
+// IsRangeTooLarge reports whether err is a provider rejecting an
+// eth_getLogs query spanning too many blocks or matching too many logs,
+// recognized by a known message or one of the extra substrings, matched
+// case-insensitively. Smaller ranges may be queried instead.
+func IsRangeTooLarge(err error, extra ...string) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, tooLarge := range rangeTooLargeMessages {
+		if strings.Contains(msg, tooLarge) {
+			return true
+		}
+	}
+	for _, tooLarge := range extra {
+		if tooLarge != "" && strings.Contains(msg, strings.ToLower(tooLarge)) {
+			return true
+		}
+	}
+	return false
+}
+
+// historyUnavailableMessages are lowercase substrings of the errors non-archive
+// nodes and providers answer for state or history they pruned. "header not
+// found" is not one of them: it is also the answer for a block a lagging
+// node has not seen yet.
+var historyUnavailableMessages = []string{
+	"missing trie node",                        // Geth
+	"required historical state unavailable",    // Geth
+	"historical state not available",           // Geth path scheme
+	"state is not available",                   // Erigon, Nethermind
+	"state not available",                      // Various
+	"history has been pruned",                  // Geth history expiry
+	"pruned history unavailable",               // Geth history expiry
+	"block has been pruned",                    // Various
+	"distance to target block exceeds maximum", // Erigon
+	"requires an archive node",                 // Providers
+	"archive node access",                      // Providers
+}
+
+// IsHistoryUnavailable reports whether err is the answer of a node that
+// pruned the state or history a request needs, like a full node asked for
+// an old block: only an archive node can serve the request, so retrying it
+// is pointless.
+func IsHistoryUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, unavailable := range historyUnavailableMessages {
+		if strings.Contains(msg, unavailable) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package rpcerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+// codeError is a JSON-RPC error answered by a node.
+type codeError struct {
+	code int
+	msg  string
+}
+
+func (e codeError) Error() string  { return e.msg }
+func (e codeError) ErrorCode() int { return e.code }
+
+// TestIsRetryable tests that transport failures, timeouts, overloaded
+// providers and internal node errors are retryable, and that answers of the
+// node and canceled requests are not.
+func TestIsRetryable(t *testing.T) {
+	for _, tt := range []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{errors.New("dial tcp 10.0.0.1:8545: connection refused"), true},
+		{fmt.Errorf("failed to fetch block: %w", errors.New("unexpected EOF")), true},
+		{context.DeadlineExceeded, true},
+		{rpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"}, true},
+		{rpc.HTTPError{StatusCode: 502, Status: "502 Bad Gateway"}, true},
+		{rpc.HTTPError{StatusCode: 401, Status: "401 Unauthorized"}, false},
+		{codeError{-32005, "limit exceeded"}, true},
+		{codeError{-32603, "internal error"}, true},
+		{codeError{-32000, "header not found"}, true},
+		{codeError{-32000, "nonce too low"}, false},
+		{codeError{-32000, "missing trie node 1f0a... (path )"}, false},
+		{codeError{3, "execution reverted"}, false},
+		{codeError{-32602, "invalid argument 0"}, false},
+		{ethereum.NotFound, false},
+		{fmt.Errorf("failed to fetch receipt: %w", ethereum.NotFound), false},
+		{context.Canceled, false},
+		{errors.New("something unexpected"), true},
+	} {
+		require.Equal(t, tt.retryable, IsRetryable(tt.err), "%v", tt.err)
+	}
+}
+
+// TestIsMethodNotFound tests that the answers providers give for methods
+// they do not serve are recognized, by code or by message.
+func TestIsMethodNotFound(t *testing.T) {
+	for _, tt := range []struct {
+		err      error
+		notFound bool
+	}{
+		{nil, false},
+		{codeError{-32601, "the method eth_getBlockReceipts does not exist/is not available"}, true},
+		{codeError{-32004, "method not supported"}, true},
+		{codeError{-32600, "Unsupported method: eth_getBlockReceipts"}, true},
+		{fmt.Errorf("failed to fetch receipts: %w", errors.New("Method not found")), true},
+		{codeError{-32602, "invalid argument 0"}, false},
+		{codeError{-32005, "limit exceeded"}, false},
+		{errors.New("dial tcp 10.0.0.1:8545: connection refused"), false},
+	} {
+		require.Equal(t, tt.notFound, IsMethodNotFound(tt.err), "%v", tt.err)
+	}
+}
+
+// TestErrorClasses tests that timeouts and rate limits are recognized
+// whether they come from the client, the HTTP layer or the node.
+func TestErrorClasses(t *testing.T) {
+	for _, tt := range []struct {
+		err         error
+		timeout     bool
+		rateLimited bool
+	}{
+		{nil, false, false},
+		{fmt.Errorf("failed to fetch block: %w", context.DeadlineExceeded), true, false},
+		{&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, true, false},
+		{rpc.HTTPError{StatusCode: 504, Status: "504 Gateway Timeout"}, true, false},
+		{errors.New("request timed out"), true, false},
+		{rpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"}, false, true},
+		{codeError{-32005, "limit exceeded"}, false, true},
+		{codeError{429, "exceeded compute units per second"}, false, true},
+		{errors.New("daily request count exceeded, request rate limited"), false, true},
+		{rpc.HTTPError{StatusCode: 502, Status: "502 Bad Gateway"}, false, false},
+		{errors.New("dial tcp 10.0.0.1:8545: connection refused"), false, false},
+		{context.Canceled, false, false},
+	} {
+		require.Equal(t, tt.timeout, IsTimeout(tt.err), "%v", tt.err)
+		require.Equal(t, tt.rateLimited, IsRateLimited(tt.err), "%v", tt.err)
+	}
+}
+
+// timeoutError is a network error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// TestIsRangeTooLarge tests that the answers providers give for log queries
+// over their limits are recognized, as well as extra messages.
+func TestIsRangeTooLarge(t *testing.T) {
+	for _, tt := range []struct {
+		err      error
+		extra    []string
+		tooLarge bool
+	}{
+		{nil, nil, false},
+		{codeError{-32005, "query returned more than 10000 results"}, nil, true},
+		{codeError{-32602, "Log response size exceeded. You can make eth_getLogs requests with up to a 2K block range"}, nil, true},
+		{fmt.Errorf("failed to filter logs: %w", codeError{-32000, "block range too large"}), nil, true},
+		{codeError{-32600, "exceed maximum block range: 5000"}, nil, true},
+		{codeError{-32000, "Range Cap Hit"}, []string{"range cap hit"}, true},
+		{codeError{-32000, "Range Cap Hit"}, nil, false},
+		{codeError{-32005, "limit exceeded"}, []string{""}, false},
+		{errors.New("dial tcp 10.0.0.1:8545: connection refused"), nil, false},
+	} {
+		require.Equal(t, tt.tooLarge, IsRangeTooLarge(tt.err, tt.extra...), "%v", tt.err)
+	}
+}
+
+// TestIsHistoryUnavailable tests that the answers of nodes missing pruned
+// state or history are recognized, and that a block not seen yet is not.
+func TestIsHistoryUnavailable(t *testing.T) {
+	for _, tt := range []struct {
+		err         error
+		unavailable bool
+	}{
+		{nil, false},
+		{codeError{-32000, "missing trie node 3d5f5e1b7f2b8c6d (path ) state 0x3d5f is not available"}, true},
+		{fmt.Errorf("failed to filter logs: %w", codeError{-32000, "History has been pruned for this block"}), true},
+		{codeError{-32000, "required historical state unavailable (reexec=128)"}, true},
+		{codeError{-32603, "This request requires an archive node"}, true},
+		{codeError{-32000, "header not found"}, false},
+		{ethereum.NotFound, false},
+		{errors.New("dial tcp 10.0.0.1:8545: connection refused"), false},
+	} {
+		require.Equal(t, tt.unavailable, IsHistoryUnavailable(tt.err), "%v", tt.err)
+	}
+}
@@ -2,7 +2,6 @@ package txhelper
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
 	"math/big"
@@ -13,7 +12,8 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/0xkanth/polymarket-indexer/pkg/rpcerr"
 )
 
 // TransactionHelper provides reusable transaction utilities for any Ethereum client
@@ -97,61 +97,7 @@ func (h *TransactionHelper) EstimateGasWithBuffer(ctx context.Context, msg ether
 
 // IsRetryableError checks if an error is retryable (RPC/network issues)
 func IsRetryableError(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	errStr := err.Error()
-
-	// RPC errors (retryable)
-	retryableErrors := []string{
-		"connection refused",
-		"connection reset",
-		"EOF",
-		"timeout",
-		"TLS handshake timeout",
-		"no such host",
-		"network is unreachable",
-		"429", // Rate limit
-		"502", // Bad gateway
-		"503", // Service unavailable
-		"504", // Gateway timeout
-	}
-
-	for _, retryable := range retryableErrors {
-		if strings.Contains(errStr, retryable) {
-			return true
-		}
-	}
-
-	// Non-retryable errors (permanent failures)
-	permanentErrors := []string{
-		"execution reverted",
-		"insufficient funds",
-		"gas too low",
-		"nonce too low",
-		"replacement transaction underpriced",
-		"already known",
-	}
-
-	for _, permanent := range permanentErrors {
-		if strings.Contains(errStr, permanent) {
-			return false
-		}
-	}
-
-	// Check for RPC error codes
-	var rpcErr rpc.Error
-	if errors.As(err, &rpcErr) {
-		code := rpcErr.ErrorCode()
-		// Retryable RPC codes
-		if code == -32000 || code == -32603 { // Internal error, may be transient
-			return true
-		}
-	}
-
-	// Default: retry on unknown errors
-	return true
+	return rpcerr.IsRetryable(err)
 }
 
 // SendTransactionWithRetry sends a transaction with exponential backoff retry